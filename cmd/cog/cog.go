@@ -1,7 +1,15 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+
 	"github.com/replicate/cog/pkg/cli"
+	cogerrors "github.com/replicate/cog/pkg/errors"
+	"github.com/replicate/cog/pkg/global"
 	"github.com/replicate/cog/pkg/util/console"
 )
 
@@ -11,7 +19,37 @@ func main() {
 		console.Fatalf("%f", err)
 	}
 
+	// Commands that cog doesn't have run plugins on the PATH, e.g. cog-publish for `cog publish`
+	if ran, err := cli.RunPlugin(cmd, os.Args[1:]); ran {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.ExitCode())
+		}
+		if err != nil {
+			console.Fatalf("%s", err)
+		}
+		return
+	}
+
+	// The model's inputs can be passed to `cog predict` as flags, which cobra doesn't know about
+	cmd.SetArgs(cli.SplitInputFlags(cmd, os.Args[1:]))
+
 	if err = cmd.Execute(); err != nil {
-		console.Fatalf("%s", err)
+		exit(err)
+	}
+}
+
+// exit prints err, as JSON if --error-json is set, and exits with the exit code for it, so scripts can tell
+// failures apart
+func exit(err error) {
+	if global.ErrorJSON {
+		out, jsonErr := json.Marshal(map[string]interface{}{"error": cogerrors.ToObject(err)})
+		if jsonErr != nil {
+			console.Fatalf("%s", err)
+		}
+		fmt.Fprintln(os.Stderr, string(out))
+	} else {
+		console.Error(err.Error())
 	}
+	os.Exit(cogerrors.ExitCode(err))
 }
@@ -0,0 +1,397 @@
+// Package card generates model cards, which describe a model for the people using it
+package card
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/getkin/kin-openapi/openapi3"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/predict"
+)
+
+// ImagePath is where the model card is embedded in the image
+const ImagePath = "/.cog/MODELCARD.md"
+
+// Formats the model card can be written in
+const (
+	FormatMarkdown = "markdown"
+	FormatHTML     = "html"
+)
+
+// licenseFiles are the names of files in the project that may hold the model's license
+var licenseFiles = []string{"LICENSE", "LICENSE.md", "LICENSE.txt", "COPYING"}
+
+// Card is everything that is shown in a model card
+type Card struct {
+	Name        string
+	Description string
+	Authors     []string
+	Homepage    string
+	Inputs      []Input
+	Output      string
+	Examples    []Example
+	License     *License
+	Env         []EnvVar
+	GPU         bool
+	CUDA        string
+	Python      string
+	CogVersion  string
+}
+
+// Input is an input of the model
+type Input struct {
+	Name        string
+	Type        string
+	Required    bool
+	Default     string
+	Description string
+}
+
+// EnvVar is an environment variable set in runtime.env, with its default value
+type EnvVar struct {
+	Name    string
+	Default string
+}
+
+// Example is an example from the examples directory, with its inputs and outputs as JSON
+type Example struct {
+	Name   string
+	Input  string
+	Output string
+}
+
+// License is the license set in cog.yaml, and the license file in the project
+type License struct {
+	Model   string
+	Weights string
+	URL     string
+	File    string
+	// Title is the first line of the license file, which is usually its name
+	Title string
+}
+
+// New returns the model card for the model in projectDir, described by cfg and schema.
+// projectDir can be empty if the model's source isn't available, in which case there are
+// no examples or license.
+func New(cfg *config.Config, schema *openapi3.T, projectDir string) (*Card, error) {
+	c := &Card{
+		Inputs:     Inputs(schema),
+		Output:     OutputType(schema),
+		GPU:        cfg.Build.GPU,
+		CUDA:       cfg.Build.CUDA,
+		Python:     cfg.Build.PythonVersion,
+		CogVersion: global.Version,
+	}
+	if cfg.Metadata != nil {
+		c.Name = cfg.Metadata.Name
+		c.Description = cfg.Metadata.Description
+		c.Authors = cfg.Metadata.Authors
+		c.Homepage = cfg.Metadata.Homepage
+	}
+	if c.Name == "" {
+		c.Name = cfg.Image
+	}
+	if c.Name == "" && projectDir != "" {
+		c.Name = filepath.Base(projectDir)
+	}
+
+	if cfg.License != nil {
+		c.License = &License{Model: cfg.License.Model, Weights: cfg.License.Weights, URL: cfg.License.URL}
+	}
+
+	if cfg.Runtime != nil {
+		names := []string{}
+		for name := range cfg.Runtime.Env {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			c.Env = append(c.Env, EnvVar{Name: name, Default: cfg.Runtime.Env[name]})
+		}
+	}
+
+	if projectDir == "" {
+		return c, nil
+	}
+
+	names, err := predict.ListExamples(projectDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		example, err := predict.ReadExample(projectDir, name)
+		if err != nil {
+			return nil, err
+		}
+		c.Examples = append(c.Examples, Example{
+			Name:   name,
+			Input:  indentJSON(example.Input),
+			Output: indentJSON(example.Output),
+		})
+	}
+
+	for _, name := range licenseFiles {
+		if title, err := firstLine(filepath.Join(projectDir, name)); err == nil {
+			if c.License == nil {
+				c.License = &License{}
+			}
+			c.License.File = name
+			c.License.Title = title
+			break
+		}
+	}
+
+	return c, nil
+}
+
+// Render writes the model card in format
+func (c *Card) Render(format string) ([]byte, error) {
+	var buf bytes.Buffer
+	switch format {
+	case FormatMarkdown:
+		if err := markdownTemplate.Execute(&buf, c); err != nil {
+			return nil, err
+		}
+	case FormatHTML:
+		if err := htmlTemplate.Execute(&buf, c); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("Unknown model card format '%s', it must be '%s' or '%s'", format, FormatMarkdown, FormatHTML)
+	}
+	return buf.Bytes(), nil
+}
+
+// Inputs returns the model's inputs from its schema, in the order they are in the predictor
+func Inputs(schema *openapi3.T) []Input {
+	inputSchema, ok := schema.Components.Schemas["Input"]
+	if !ok || inputSchema.Value == nil {
+		return nil
+	}
+	required := map[string]bool{}
+	for _, name := range inputSchema.Value.Required {
+		required[name] = true
+	}
+
+	result := []Input{}
+	for name, property := range inputSchema.Value.Properties {
+		if property.Value == nil {
+			continue
+		}
+		input := Input{
+			Name:        name,
+			Type:        schemaType(property),
+			Required:    required[name],
+			Description: property.Value.Description,
+		}
+		if property.Value.Default != nil {
+			input.Default = compactJSON(property.Value.Default)
+		}
+		result = append(result, input)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		oi, oj := order(inputSchema.Value.Properties[result[i].Name]), order(inputSchema.Value.Properties[result[j].Name])
+		if oi != oj {
+			return oi < oj
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// OutputType describes the type of the model's output, e.g. "string" or "list of files"
+func OutputType(schema *openapi3.T) string {
+	outputSchema, ok := schema.Components.Schemas["Output"]
+	if !ok || outputSchema.Value == nil {
+		return ""
+	}
+	return schemaType(outputSchema)
+}
+
+// schemaType describes the type of a value in a schema, e.g. "integer" or "list of files"
+func schemaType(ref *openapi3.SchemaRef) string {
+	s := ref.Value
+	// Inputs with choices refer to an enum schema
+	if s.Type == "" && len(s.AllOf) > 0 && s.AllOf[0].Value != nil {
+		s = s.AllOf[0].Value
+	}
+	switch {
+	case s.Type == "string" && s.Format == "uri":
+		return "file"
+	case len(s.Enum) > 0:
+		choices := []string{}
+		for _, choice := range s.Enum {
+			choices = append(choices, compactJSON(choice))
+		}
+		return fmt.Sprintf("%s, one of %s", s.Type, strings.Join(choices, ", "))
+	case s.Type == "array" && s.Items != nil:
+		items := schemaType(s.Items)
+		if s.Extensions["x-cog-array-type"] == "iterator" {
+			return "iterator of " + items
+		}
+		return "list of " + items
+	case s.Type == "":
+		return "object"
+	}
+	return s.Type
+}
+
+func order(property *openapi3.SchemaRef) float64 {
+	if o, ok := property.Value.Extensions["x-order"].(float64); ok {
+		return o
+	}
+	return 0
+}
+
+func firstLine(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			return line, nil
+		}
+	}
+	return "", scanner.Err()
+}
+
+func compactJSON(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+func indentJSON(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+var markdownTemplate = template.Must(template.New("markdown").Parse(`# {{ .Name }}
+{{ if .Description }}
+{{ .Description }}
+{{ end }}{{ if or .Authors .Homepage }}
+{{ if .Authors }}- Authors: {{ range $i, $a := .Authors }}{{ if $i }}, {{ end }}{{ $a }}{{ end }}
+{{ end }}{{ if .Homepage }}- Homepage: {{ .Homepage }}
+{{ end }}{{ end }}
+## Inputs
+{{ if .Inputs }}
+| Name | Type | Default | Description |
+| --- | --- | --- | --- |
+{{ range .Inputs }}| ` + "`{{ .Name }}`" + `{{ if .Required }} (required){{ end }} | {{ .Type }} | {{ if .Default }}` + "`{{ .Default }}`" + `{{ end }} | {{ .Description }} |
+{{ end }}{{ else }}
+This model has no inputs.
+{{ end }}
+## Output
+
+{{ if .Output }}{{ .Output }}{{ else }}Unknown{{ end }}
+{{ if .Examples }}
+## Examples
+{{ range .Examples }}
+### {{ .Name }}
+
+Input:
+
+` + "```json" + `
+{{ .Input }}
+` + "```" + `
+{{ if .Output }}
+Output:
+
+` + "```json" + `
+{{ .Output }}
+` + "```" + `
+{{ end }}{{ end }}{{ end }}
+## Hardware
+
+{{ if .GPU }}Runs on a GPU{{ if .CUDA }} with CUDA {{ .CUDA }}{{ end }}{{ else }}Runs on a CPU{{ end }}{{ if .Python }}, with Python {{ .Python }}{{ end }}.
+{{ if .Env }}
+## Environment variables
+
+These can be overridden when the model runs.
+
+| Name | Default |
+| --- | --- |
+{{ range .Env }}| ` + "`{{ .Name }}`" + ` | {{ if .Default }}` + "`{{ .Default }}`" + `{{ end }} |
+{{ end }}{{ end }}{{ with .License }}
+## License
+{{ if or .Model .Weights .URL }}
+{{ if .Model }}- Model: {{ .Model }}
+{{ end }}{{ if .Weights }}- Weights: {{ .Weights }}
+{{ end }}{{ if .URL }}- Terms: {{ .URL }}
+{{ end }}{{ end }}{{ if .File }}
+{{ .Title }}. See [{{ .File }}]({{ .File }}).
+{{ end }}{{ end }}
+---
+
+Generated by Cog {{ .CogVersion }}.
+`))
+
+var htmlTemplate = htmltemplate.Must(htmltemplate.New("html").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{ .Name }}</title>
+</head>
+<body>
+<h1>{{ .Name }}</h1>
+{{ if .Description }}<p>{{ .Description }}</p>
+{{ end }}{{ if or .Authors .Homepage }}<ul>
+{{ if .Authors }}<li>Authors: {{ range $i, $a := .Authors }}{{ if $i }}, {{ end }}{{ $a }}{{ end }}</li>
+{{ end }}{{ if .Homepage }}<li>Homepage: <a href="{{ .Homepage }}">{{ .Homepage }}</a></li>
+{{ end }}</ul>
+{{ end }}<h2>Inputs</h2>
+{{ if .Inputs }}<table>
+<tr><th>Name</th><th>Type</th><th>Default</th><th>Description</th></tr>
+{{ range .Inputs }}<tr><td><code>{{ .Name }}</code>{{ if .Required }} (required){{ end }}</td><td>{{ .Type }}</td><td>{{ if .Default }}<code>{{ .Default }}</code>{{ end }}</td><td>{{ .Description }}</td></tr>
+{{ end }}</table>
+{{ else }}<p>This model has no inputs.</p>
+{{ end }}<h2>Output</h2>
+<p>{{ if .Output }}{{ .Output }}{{ else }}Unknown{{ end }}</p>
+{{ if .Examples }}<h2>Examples</h2>
+{{ range .Examples }}<h3>{{ .Name }}</h3>
+<p>Input:</p>
+<pre><code>{{ .Input }}</code></pre>
+{{ if .Output }}<p>Output:</p>
+<pre><code>{{ .Output }}</code></pre>
+{{ end }}{{ end }}{{ end }}<h2>Hardware</h2>
+<p>{{ if .GPU }}Runs on a GPU{{ if .CUDA }} with CUDA {{ .CUDA }}{{ end }}{{ else }}Runs on a CPU{{ end }}{{ if .Python }}, with Python {{ .Python }}{{ end }}.</p>
+{{ if .Env }}<h2>Environment variables</h2>
+<p>These can be overridden when the model runs.</p>
+<table>
+<tr><th>Name</th><th>Default</th></tr>
+{{ range .Env }}<tr><td><code>{{ .Name }}</code></td><td>{{ if .Default }}<code>{{ .Default }}</code>{{ end }}</td></tr>
+{{ end }}</table>
+{{ end }}{{ with .License }}<h2>License</h2>
+{{ if or .Model .Weights .URL }}<ul>
+{{ if .Model }}<li>Model: {{ .Model }}</li>
+{{ end }}{{ if .Weights }}<li>Weights: {{ .Weights }}</li>
+{{ end }}{{ if .URL }}<li>Terms: <a href="{{ .URL }}">{{ .URL }}</a></li>
+{{ end }}</ul>
+{{ end }}{{ if .File }}<p>{{ .Title }}. See <a href="{{ .File }}">{{ .File }}</a>.</p>
+{{ end }}{{ end }}<hr>
+<p>Generated by Cog {{ .CogVersion }}.</p>
+</body>
+</html>
+`))
@@ -0,0 +1,175 @@
+package card
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+const testSchema = `{
+  "openapi": "3.0.2",
+  "info": {"title": "Cog", "version": "0.1.0"},
+  "paths": {},
+  "components": {
+    "schemas": {
+      "Input": {
+        "type": "object",
+        "title": "Input",
+        "required": ["image"],
+        "properties": {
+          "threshold": {"type": "number", "title": "Threshold", "default": 0.5, "description": "Minimum confidence", "x-order": 1},
+          "image": {"type": "string", "format": "uri", "title": "Image", "description": "Photo of food", "x-order": 0},
+          "mode": {"allOf": [{"$ref": "#/components/schemas/mode"}], "default": "fast", "x-order": 2}
+        }
+      },
+      "mode": {"type": "string", "title": "mode", "enum": ["fast", "accurate"]},
+      "Output": {"type": "array", "items": {"type": "string"}, "x-cog-array-type": "iterator", "title": "Output"}
+    }
+  }
+}`
+
+func TestCard(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "examples"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "examples", "hotdog.yaml"), []byte("input:\n  image: '@hotdog.jpg'\noutput: [\"hot dog\"]\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "LICENSE"), []byte("\nMIT License\n\nCopyright ...\n"), 0o644))
+
+	cfg, err := config.FromYAML([]byte(`
+build:
+  gpu: true
+  cuda: "11.8"
+  python_version: "3.11"
+predict: predict.py:Predictor
+metadata:
+  name: Hotdog detector
+  description: Detects hot dogs.
+  authors: [Alice, Bob]
+`))
+	require.NoError(t, err)
+	schema, err := openapi3.NewLoader().LoadFromData([]byte(testSchema))
+	require.NoError(t, err)
+
+	c, err := New(cfg, schema, dir)
+	require.NoError(t, err)
+	c.CogVersion = "dev"
+
+	markdown, err := c.Render(FormatMarkdown)
+	require.NoError(t, err)
+	require.Equal(t, "# Hotdog detector\n"+
+		"\n"+
+		"Detects hot dogs.\n"+
+		"\n"+
+		"- Authors: Alice, Bob\n"+
+		"\n"+
+		"## Inputs\n"+
+		"\n"+
+		"| Name | Type | Default | Description |\n"+
+		"| --- | --- | --- | --- |\n"+
+		"| `image` (required) | file |  | Photo of food |\n"+
+		"| `threshold` | number | `0.5` | Minimum confidence |\n"+
+		"| `mode` | string, one of \"fast\", \"accurate\" | `\"fast\"` |  |\n"+
+		"\n"+
+		"## Output\n"+
+		"\n"+
+		"iterator of string\n"+
+		"\n"+
+		"## Examples\n"+
+		"\n"+
+		"### hotdog\n"+
+		"\n"+
+		"Input:\n"+
+		"\n"+
+		"```json\n"+
+		"{\n  \"image\": \"@hotdog.jpg\"\n}\n"+
+		"```\n"+
+		"\n"+
+		"Output:\n"+
+		"\n"+
+		"```json\n"+
+		"[\n  \"hot dog\"\n]\n"+
+		"```\n"+
+		"\n"+
+		"## Hardware\n"+
+		"\n"+
+		"Runs on a GPU with CUDA 11.8, with Python 3.11.\n"+
+		"\n"+
+		"## License\n"+
+		"\n"+
+		"MIT License. See [LICENSE](LICENSE).\n"+
+		"\n"+
+		"---\n"+
+		"\n"+
+		"Generated by Cog dev.\n", string(markdown))
+
+	html, err := c.Render(FormatHTML)
+	require.NoError(t, err)
+	require.Contains(t, string(html), "<h1>Hotdog detector</h1>")
+	require.Contains(t, string(html), "<td><code>image</code> (required)</td><td>file</td>")
+
+	_, err = c.Render("pdf")
+	require.Error(t, err)
+}
+
+func TestCardLicenseFromConfig(t *testing.T) {
+	cfg, err := config.FromYAML([]byte(`
+predict: predict.py:Predictor
+license:
+  model: Apache-2.0
+  weights: CC-BY-NC-4.0
+  url: https://example.com/license
+`))
+	require.NoError(t, err)
+	schema, err := openapi3.NewLoader().LoadFromData([]byte(testSchema))
+	require.NoError(t, err)
+
+	c, err := New(cfg, schema, "")
+	require.NoError(t, err)
+
+	markdown, err := c.Render(FormatMarkdown)
+	require.NoError(t, err)
+	require.Contains(t, string(markdown), "## License\n"+
+		"\n"+
+		"- Model: Apache-2.0\n"+
+		"- Weights: CC-BY-NC-4.0\n"+
+		"- Terms: https://example.com/license\n"+
+		"\n"+
+		"---\n")
+}
+
+func TestCardEnv(t *testing.T) {
+	cfg, err := config.FromYAML([]byte(`
+predict: predict.py:Predictor
+runtime:
+  env:
+    TOKENIZERS_PARALLELISM: false
+    HF_TOKEN: ""
+`))
+	require.NoError(t, err)
+	schema, err := openapi3.NewLoader().LoadFromData([]byte(testSchema))
+	require.NoError(t, err)
+
+	c, err := New(cfg, schema, "")
+	require.NoError(t, err)
+
+	markdown, err := c.Render(FormatMarkdown)
+	require.NoError(t, err)
+	require.Contains(t, string(markdown), "## Environment variables\n"+
+		"\n"+
+		"These can be overridden when the model runs.\n"+
+		"\n"+
+		"| Name | Default |\n"+
+		"| --- | --- |\n"+
+		"| `HF_TOKEN` |  |\n"+
+		"| `TOKENIZERS_PARALLELISM` | `false` |\n"+
+		"\n"+
+		"---\n")
+
+	html, err := c.Render(FormatHTML)
+	require.NoError(t, err)
+	require.Contains(t, string(html), "<tr><td><code>TOKENIZERS_PARALLELISM</code></td><td><code>false</code></td></tr>")
+}
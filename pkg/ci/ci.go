@@ -0,0 +1,152 @@
+// Package ci generates CI pipelines that build, test, scan and push a model's image
+package ci
+
+import (
+	"bytes"
+	// blank import for embeds
+	_ "embed"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/predict"
+)
+
+// Platforms that pipelines can be generated for
+const (
+	// PlatformGitHub is GitHub Actions
+	PlatformGitHub = "github"
+	// PlatformGitLab is GitLab CI/CD
+	PlatformGitLab = "gitlab"
+)
+
+// Platforms are all of the platforms that pipelines can be generated for
+var Platforms = []string{PlatformGitHub, PlatformGitLab}
+
+//go:embed templates/github.yml
+var githubTemplate string
+
+//go:embed templates/gitlab.yml
+var gitlabTemplate string
+
+// Options describe the model a pipeline builds
+type Options struct {
+	// Dir is the model's directory, relative to the root of the repository, with slashes. It's "." if the model is
+	// at the root.
+	Dir string
+	// Name identifies the model in a repository with more than one, e.g. in the name of the pipeline
+	Name string
+	// Image is the image to push, or empty to push to the platform's own registry
+	Image string
+	// GPU is whether the model needs a GPU, so it's tested on a runner with one, and CUDA is its CUDA version
+	GPU  bool
+	CUDA string
+	// Examples are the names of the examples in the examples directory, which are run as tests
+	Examples []string
+}
+
+// OptionsFromConfig returns the options for the model configured by cfg in projectDir, which is in the repository
+// at repoDir
+func OptionsFromConfig(cfg *config.Config, projectDir string, repoDir string) (Options, error) {
+	rel, err := filepath.Rel(repoDir, projectDir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return Options{}, fmt.Errorf("%s isn't in the repository at %s", projectDir, repoDir)
+	}
+	examples, err := predict.ListExamples(projectDir)
+	if err != nil {
+		return Options{}, fmt.Errorf("Failed to list examples: %w", err)
+	}
+	opts := Options{
+		Dir:      filepath.ToSlash(rel),
+		Image:    cfg.Image,
+		GPU:      cfg.Build.GPU,
+		CUDA:     cfg.Build.CUDA,
+		Examples: examples,
+	}
+	if opts.Dir != "." {
+		opts.Name = nonNameChars.ReplaceAllString(strings.ToLower(path.Base(opts.Dir)), "-")
+	}
+	return opts, nil
+}
+
+// FindRepository returns the root of the Git repository dir is in, or dir if it isn't in one
+func FindRepository(dir string) string {
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(filepath.Join(d, ".git")); err == nil {
+			return d
+		}
+		if filepath.Dir(d) == d {
+			return dir
+		}
+	}
+}
+
+// Path returns where the pipeline for platform goes, relative to the root of the repository
+func Path(platform string, opts Options) string {
+	if platform == PlatformGitLab {
+		return ".gitlab-ci.yml"
+	}
+	name := "cog.yml"
+	if opts.Name != "" {
+		name = "cog-" + opts.Name + ".yml"
+	}
+	return filepath.Join(".github", "workflows", name)
+}
+
+// Pipeline returns the pipeline for platform
+func Pipeline(platform string, opts Options) ([]byte, error) {
+	var text string
+	switch platform {
+	case PlatformGitHub:
+		text = githubTemplate
+	case PlatformGitLab:
+		text = gitlabTemplate
+	default:
+		return nil, fmt.Errorf("Unknown CI platform '%s', it must be one of: %s", platform, strings.Join(Platforms, ", "))
+	}
+	// GitHub Actions and GitLab CI use {{ and ${{ themselves
+	tmpl, err := template.New(platform).Delims("[[", "]]").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, newPipelineData(opts)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+var nonNameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// pipelineData is what the templates are executed with
+type pipelineData struct {
+	Options
+	// Registry is the host of the registry Image is pushed to if it isn't the platform's own, or empty for Docker Hub
+	Registry string
+	// Replicate is whether Image is pushed to Replicate, which is logged in to with cog login
+	Replicate bool
+	// CacheScope separates the build cache of each model in a repository
+	CacheScope string
+}
+
+func newPipelineData(opts Options) pipelineData {
+	data := pipelineData{Options: opts, CacheScope: "cog"}
+	if opts.Name != "" {
+		data.CacheScope = "cog-" + opts.Name
+	}
+	if opts.Image == "" {
+		return data
+	}
+	parts := strings.SplitN(opts.Image, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		data.Registry = parts[0]
+	}
+	data.Replicate = data.Registry == global.ReplicateRegistryHost
+	return data
+}
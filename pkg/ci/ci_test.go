@@ -0,0 +1,98 @@
+package ci
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+func TestOptionsFromConfig(t *testing.T) {
+	repoDir := t.TempDir()
+	projectDir := filepath.Join(repoDir, "models", "Hotdog_Detector")
+	require.NoError(t, os.MkdirAll(filepath.Join(projectDir, "examples"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(projectDir, "examples", "hotdog.json"), []byte(`{"input": {}}`), 0o644))
+	require.NoError(t, os.Mkdir(filepath.Join(repoDir, ".git"), 0o755))
+	require.Equal(t, repoDir, FindRepository(projectDir))
+
+	cfg := &config.Config{Build: &config.Build{GPU: true, CUDA: "12.1"}}
+	opts, err := OptionsFromConfig(cfg, projectDir, repoDir)
+	require.NoError(t, err)
+	require.Equal(t, Options{Dir: "models/Hotdog_Detector", Name: "hotdog-detector", GPU: true, CUDA: "12.1", Examples: []string{"hotdog"}}, opts)
+	require.Equal(t, filepath.Join(".github", "workflows", "cog-hotdog-detector.yml"), Path(PlatformGitHub, opts))
+
+	opts, err = OptionsFromConfig(cfg, repoDir, repoDir)
+	require.NoError(t, err)
+	require.Equal(t, ".", opts.Dir)
+	require.Empty(t, opts.Name)
+	require.Equal(t, filepath.Join(".github", "workflows", "cog.yml"), Path(PlatformGitHub, opts))
+	require.Equal(t, ".gitlab-ci.yml", Path(PlatformGitLab, opts))
+
+	_, err = OptionsFromConfig(cfg, t.TempDir(), repoDir)
+	require.Error(t, err)
+}
+
+func TestGitHubPipeline(t *testing.T) {
+	pipeline, err := Pipeline(PlatformGitHub, Options{Dir: ".", Examples: []string{"hotdog", "not-hotdog"}})
+	require.NoError(t, err)
+	workflow := parsePipeline(t, pipeline)
+	job := workflow["jobs"].(map[string]interface{})["cog"].(map[string]interface{})
+	require.Equal(t, "ubuntu-latest", job["runs-on"])
+	require.Contains(t, string(pipeline), `echo "IMAGE=ghcr.io/${GITHUB_REPOSITORY,,}" >> "$GITHUB_ENV"`)
+	require.Contains(t, string(pipeline), "cog predict \"$IMAGE\" --example hotdog\n          cog predict \"$IMAGE\" --example not-hotdog\n")
+	require.Contains(t, string(pipeline), `type=gha,scope=cog,mode=max`)
+	require.Contains(t, string(pipeline), "registry: ghcr.io")
+
+	pipeline, err = Pipeline(PlatformGitHub, Options{Dir: "models/sdxl", Name: "sdxl", Image: "r8.im/acme/sdxl", GPU: true, CUDA: "12.1"})
+	require.NoError(t, err)
+	workflow = parsePipeline(t, pipeline)
+	require.Equal(t, "Cog (sdxl)", workflow["name"])
+	job = workflow["jobs"].(map[string]interface{})["cog"].(map[string]interface{})
+	require.Equal(t, []interface{}{"self-hosted", "linux", "x64", "gpu"}, job["runs-on"])
+	require.Equal(t, map[string]interface{}{"IMAGE": "r8.im/acme/sdxl"}, job["env"])
+	require.Equal(t, "models/sdxl", job["defaults"].(map[string]interface{})["run"].(map[string]interface{})["working-directory"])
+	require.Contains(t, string(pipeline), "cog login --token-stdin")
+	require.Contains(t, string(pipeline), "type=gha,scope=cog-sdxl")
+	require.Contains(t, string(pipeline), "There aren't any examples to test")
+	require.NotContains(t, string(pipeline), "Name the image")
+
+	pipeline, err = Pipeline(PlatformGitHub, Options{Dir: ".", Image: "registry.example.com/acme/model"})
+	require.NoError(t, err)
+	parsePipeline(t, pipeline)
+	require.Contains(t, string(pipeline), "registry: registry.example.com\n          username: ${{ secrets.REGISTRY_USERNAME }}")
+}
+
+func TestGitLabPipeline(t *testing.T) {
+	pipeline, err := Pipeline(PlatformGitLab, Options{Dir: ".", Examples: []string{"hotdog"}})
+	require.NoError(t, err)
+	job := parsePipeline(t, pipeline)["cog"].(map[string]interface{})
+	require.Nil(t, job["tags"])
+	variables := job["variables"].(map[string]interface{})
+	require.Equal(t, "$CI_REGISTRY_IMAGE", variables["IMAGE"])
+	require.Equal(t, "$CI_REGISTRY_IMAGE/cache:cog", variables["CACHE"])
+	require.Contains(t, job["script"], `cog predict "$IMAGE" --example hotdog`)
+
+	pipeline, err = Pipeline(PlatformGitLab, Options{Dir: "models/sdxl", Name: "sdxl", Image: "acme/sdxl", GPU: true})
+	require.NoError(t, err)
+	job = parsePipeline(t, pipeline)["cog-sdxl"].(map[string]interface{})
+	require.Equal(t, []interface{}{"gpu"}, job["tags"])
+	require.Equal(t, "acme/sdxl", job["variables"].(map[string]interface{})["IMAGE"])
+	require.Contains(t, job["script"], "cd models/sdxl")
+	require.Contains(t, string(pipeline), `docker login -u "$REGISTRY_USERNAME" --password-stdin`+"\n")
+}
+
+func TestUnknownPlatform(t *testing.T) {
+	_, err := Pipeline("jenkins", Options{Dir: "."})
+	require.Error(t, err)
+}
+
+func parsePipeline(t *testing.T, pipeline []byte) map[string]interface{} {
+	t.Helper()
+	parsed := map[string]interface{}{}
+	require.NoError(t, yaml.Unmarshal(pipeline, &parsed), string(pipeline))
+	return parsed
+}
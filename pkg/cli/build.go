@@ -1,14 +1,27 @@
 package cli
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 
 	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/dockerfile"
+	"github.com/replicate/cog/pkg/global"
 	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/provenance"
 	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/util/slices"
+	"github.com/replicate/cog/pkg/wasm"
 )
 
 var buildTag string
@@ -19,13 +32,47 @@ var buildProgressOutput string
 var buildSchemaFile string
 var buildUseCudaBaseImage string
 var buildDockerfileFile string
+var buildFormat string
+var buildTarget string
+var buildSBOMFile string
+var buildProvenanceFile string
+var buildDebugOnFailure bool
+var buildTimings bool
+var buildFix bool
+var buildWatch bool
+var buildFlatten bool
+var buildOutput string
+var buildExport *image.Output // where --output exports the image to
+var buildHTTPProxy string
+var buildHTTPSProxy string
+var buildNoProxy []string
+var buildArgValues []string
+var buildWeightsSigningKey string
+var buildResume bool
+var buildTagStrategy string
+var buildAll bool
+
+const (
+	buildTargetDocker = "docker"
+	buildTargetWasm   = "wasm"
+)
+
+const (
+	tagStrategyName    = "name"
+	tagStrategyContent = "content"
+)
 
 func newBuildCommand() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "build",
+		Use:   "build [DIR]",
 		Short: "Build an image from cog.yaml",
-		Args:  cobra.NoArgs,
-		RunE:  buildCommand,
+		Long: `Build an image from cog.yaml.
+
+DIR is the directory of the model to build, if it isn't the current one, e.g.
+'cog build ./models/foo' in a repository with several models. With --all, it's
+where to look for models, which is the current directory by default.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: interruptible(buildCommand),
 	}
 	addBuildProgressOutputFlag(cmd)
 	addSecretsFlag(cmd)
@@ -33,16 +80,130 @@ func newBuildCommand() *cobra.Command {
 	addSeparateWeightsFlag(cmd)
 	addSchemaFlag(cmd)
 	addUseCudaBaseImageFlag(cmd)
+	addProxyFlags(cmd)
+	addBuildArgFlag(cmd)
 	addDockerfileFlag(cmd)
+	addFormatFlag(cmd)
+	addSBOMFlag(cmd)
+	addProvenanceFlag(cmd)
+	addDebugOnFailureFlag(cmd)
+	addTimingsFlag(cmd)
+	addSignWeightsFlag(cmd)
+	addResumeFlag(cmd)
+	addTagStrategyFlag(cmd)
+	addFlattenFlag(cmd)
+	addOutputFormatFlag(cmd)
+	cmd.Flags().BoolVar(&buildFix, "fix", false, "Add system packages that the Python packages need to cog.yaml")
+	cmd.Flags().StringVar(&buildTarget, "target", buildTargetDocker, "What to build: 'docker' (default) for a Docker image, or 'wasm' (experimental) for a wasi-nn bundle of a model that can be converted to ONNX")
 	cmd.Flags().StringVarP(&buildTag, "tag", "t", "", "A name for the built image in the form 'repository:tag'")
+	cmd.Flags().BoolVar(&buildAll, "all", false, "Build every model with a cog.yaml in the directory and its subdirectories, after the models they depend on")
+	cmd.Flags().StringVar(&buildOutput, "output", "", "Also export the image to 'oci:<directory>' as an OCI image layout, or load it into containerd with 'containerd' or 'containerd:<namespace>', which defaults to k8s.io")
+	cmd.Flags().BoolVar(&buildWatch, "watch", false, "Rebuild the image when cog.yaml, the Python requirements or the source change")
 	return cmd
 }
 
 func buildCommand(cmd *cobra.Command, args []string) error {
-	cfg, projectDir, err := config.GetConfig(projectDirFlag)
+	if buildTarget != buildTargetDocker && buildTarget != buildTargetWasm {
+		return fmt.Errorf("Unknown build target '%s', it must be '%s' or '%s'", buildTarget, buildTargetDocker, buildTargetWasm)
+	}
+	if err := checkTagStrategy(); err != nil {
+		return err
+	}
+	if err := checkOutputFormat(); err != nil {
+		return err
+	}
+	if jsonOutput() && (buildAll || buildWatch) {
+		return fmt.Errorf("--output-format json can't be used with --all or --watch")
+	}
+	if buildOutput != "" {
+		if buildAll || buildWatch || buildTarget == buildTargetWasm {
+			return fmt.Errorf("--output can't be used with --all, --watch or --target wasm")
+		}
+		output, err := image.ParseOutput(buildOutput)
+		if err != nil {
+			return err
+		}
+		if output.Kind == image.OutputOCI {
+			// Like the files in the other flags, the directory is relative to where cog was run
+			if err := makeAbsolute(&output.Dest); err != nil {
+				return err
+			}
+		}
+		buildExport = output
+	}
+	if buildAll {
+		return buildAllProjects(cmd.Context(), args)
+	}
+
+	if buildTagStrategy == tagStrategyContent && buildWatch {
+		return fmt.Errorf("--tag-strategy content can't be used with --watch")
+	}
+	if len(args) > 0 {
+		// The files passed in flags are relative to where cog was run, rather than the model's directory
+		for _, p := range []*string{&buildProvenanceFile, &buildSBOMFile, &buildSchemaFile, &buildDockerfileFile} {
+			if err := makeAbsolute(p); err != nil {
+				return err
+			}
+		}
+		if _, err := enterModelDir(args[0]); err != nil {
+			return err
+		}
+	}
+
+	cfg, projectDir, imageName, err := prepareBuild(projectDirFlag)
 	if err != nil {
 		return err
 	}
+	if buildWatch {
+		return watchBuild(cmd.Context(), cfg, projectDir, imageName)
+	}
+	return buildOnce(cmd.Context(), cfg, projectDir, imageName)
+}
+
+// enterModelDir changes the working directory to dir, the directory of a model, because the files in a build are
+// found relative to it. It returns a function that changes back to the directory cog was run in.
+func enterModelDir(dir string) (func() error, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chdir(dir); err != nil {
+		return nil, fmt.Errorf("Failed to change to the model's directory: %w", err)
+	}
+	return func() error {
+		if err := os.Chdir(cwd); err != nil {
+			return fmt.Errorf("Failed to change back to %s: %w", cwd, err)
+		}
+		return nil
+	}, nil
+}
+
+// makeAbsolute makes the path that p points to absolute, if it isn't empty
+func makeAbsolute(p *string) error {
+	if *p == "" {
+		return nil
+	}
+	abs, err := filepath.Abs(*p)
+	if err != nil {
+		return fmt.Errorf("Failed to get absolute path of %s: %w", *p, err)
+	}
+	*p = abs
+	return nil
+}
+
+// prepareBuild loads the config of the model in dir, or the current directory if it's empty, fixes its system
+// packages if --fix is set, and returns it with the project directory and the name of the image to build
+func prepareBuild(dir string) (*config.Config, string, string, error) {
+	cfg, projectDir, err := config.GetConfig(dir)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	if buildFix {
+		if cfg, err = fixSystemPackages(cfg, projectDir); err != nil {
+			return nil, "", "", err
+		}
+	}
 
 	imageName := cfg.Image
 	if buildTag != "" {
@@ -52,12 +213,155 @@ func buildCommand(cmd *cobra.Command, args []string) error {
 		imageName = config.DockerImageName(projectDir)
 	}
 
-	if err := image.Build(cfg, projectDir, imageName, buildSecrets, buildNoCache, buildSeparateWeights, buildUseCudaBaseImage, buildProgressOutput, buildSchemaFile, buildDockerfileFile); err != nil {
+	if buildTagStrategy == tagStrategyContent {
+		if imageName, err = contentTaggedImage(cfg, projectDir, imageName); err != nil {
+			return nil, "", "", err
+		}
+	} else if imageName, err = templatedImageName(cfg, projectDir, imageName); err != nil {
+		return nil, "", "", err
+	}
+	return cfg, projectDir, imageName, nil
+}
+
+// buildOnce builds the image, and writes the provenance and wasm bundle if they were asked for
+func buildOnce(ctx context.Context, cfg *config.Config, projectDir string, imageName string) error {
+	startedOn := time.Now()
+	dockerBuildArgs, err := buildArgs(cfg)
+	if err != nil {
 		return err
 	}
+	cached := alreadyBuilt(imageName)
+	if cached {
+		console.Infof("%s was already built from the same inputs, so it isn't built again", imageName)
+	} else if err := image.Build(ctx, cfg, projectDir, imageName, image.BuildOptions{
+		Secrets:           buildSecrets,
+		BuildArgs:         dockerBuildArgs,
+		NoCache:           buildNoCache,
+		SeparateWeights:   buildSeparateWeights,
+		UseCudaBaseImage:  buildUseCudaBaseImage,
+		ProgressOutput:    buildProgressOutput,
+		SchemaFile:        buildSchemaFile,
+		DockerfileFile:    buildDockerfileFile,
+		Format:            buildFormat,
+		SBOMFile:          buildSBOMFile,
+		DebugOnFailure:    buildDebugOnFailure,
+		Timings:           buildTimings,
+		WeightsSigningKey: weightsSigningKey(),
+		Resume:            buildResume,
+		Flatten:           buildFlatten,
+	}); err != nil {
+		var runErr *docker.BuildError
+		if !buildDebugOnFailure && errors.As(err, &runErr) {
+			console.Info("\nTo debug this, run 'cog build --debug-on-failure' to open a shell in the image just before the command that failed.")
+		}
+		return err
+	}
+
+	if buildProvenanceFile != "" {
+		statement, err := image.Provenance(projectDir, imageName, false, buildFormat, startedOn, time.Now())
+		if err != nil {
+			return err
+		}
+		if err := writeProvenance(statement, buildProvenanceFile); err != nil {
+			return err
+		}
+	}
+
+	if buildTarget == buildTargetWasm {
+		if err := buildWasmBundle(cfg, imageName); err != nil {
+			return err
+		}
+		return printBuildResult(imageName, cached, startedOn)
+	}
+
+	if buildExport != nil {
+		if err := image.Export(ctx, imageName, buildExport); err != nil {
+			return err
+		}
+	}
 
 	console.Infof("\nImage built as %s", imageName)
+	if buildFormat == dockerfile.FormatVertex {
+		console.Infof("\nPush the image to Artifact Registry, then upload it as a Vertex AI model:\n    %s", vertexUploadCommand(imageName))
+	}
+
+	return printBuildResult(imageName, cached, startedOn)
+}
+
+// buildResult is what `cog build --output-format json` prints
+type buildResult struct {
+	image.Summary
+	// Cached is whether the image was already built from the same inputs, so it wasn't built again
+	Cached          bool    `json:"cached"`
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+// printBuildResult prints the image that was built as JSON, if --output-format json is set
+func printBuildResult(imageName string, cached bool, startedOn time.Time) error {
+	if !jsonOutput() {
+		return nil
+	}
+	summary, err := image.Summarize(imageName, false)
+	if err != nil {
+		return err
+	}
+	return printJSON(buildResult{Summary: *summary, Cached: cached, DurationSeconds: seconds(time.Since(startedOn))})
+}
+
+// fixSystemPackages adds the system packages that the Python packages need to cog.yaml, and returns the
+// updated config
+func fixSystemPackages(cfg *config.Config, projectDir string) (*config.Config, error) {
+	packages := []string{}
+	for _, advice := range cfg.SystemPackageAdvice() {
+		for _, pkg := range advice.SystemPackages {
+			if !slices.ContainsString(packages, pkg) {
+				packages = append(packages, pkg)
+			}
+		}
+	}
+	if len(packages) == 0 {
+		return cfg, nil
+	}
+
+	configPath := filepath.Join(projectDir, global.ConfigFilename)
+	contents, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read %s: %w", configPath, err)
+	}
+	contents, err = config.AddSystemPackages(contents, packages)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(configPath, contents, 0o644); err != nil {
+		return nil, fmt.Errorf("Failed to write %s: %w", configPath, err)
+	}
+	console.Infof("Added %s to system_packages in %s", strings.Join(packages, ", "), global.ConfigFilename)
+
+	cfg, _, err = config.GetConfig(projectDir)
+	return cfg, err
+}
 
+// buildWasmBundle converts the model in imageName to ONNX, and writes it as a wasi-nn bundle
+func buildWasmBundle(cfg *config.Config, imageName string) error {
+	name := nameFromImage(imageName)
+	bundleDir := name + "-wasm"
+	if err := os.MkdirAll(bundleDir, 0o755); err != nil {
+		return fmt.Errorf("Failed to create %s: %w", bundleDir, err)
+	}
+
+	console.Info("\nConverting the model to ONNX...")
+	if err := image.ExportONNX(imageName, filepath.Join(bundleDir, wasm.ModelFile), cfg.Build.GPU); err != nil {
+		return err
+	}
+	schema, err := image.GetOpenAPISchema(imageName)
+	if err != nil {
+		return err
+	}
+	if err := wasm.WriteBundle(bundleDir, name, schema, cfg.Build.GPU); err != nil {
+		return err
+	}
+
+	console.Infof("\nwasi-nn bundle written to %s", bundleDir)
 	return nil
 }
 
@@ -73,6 +377,25 @@ func addSecretsFlag(cmd *cobra.Command) {
 	cmd.Flags().StringArrayVar(&buildSecrets, "secret", []string{}, "Secrets to pass to the build environment in the form 'id=foo,src=/path/to/file'")
 }
 
+func addProxyFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&buildHTTPProxy, "http-proxy", "", "Proxy for HTTP requests during the build, instead of build.proxy in cog.yaml or HTTP_PROXY")
+	cmd.Flags().StringVar(&buildHTTPSProxy, "https-proxy", "", "Proxy for HTTPS requests during the build, instead of build.proxy in cog.yaml or HTTPS_PROXY")
+	cmd.Flags().StringSliceVar(&buildNoProxy, "no-proxy", nil, "Hosts and domains the build reaches without the proxy, instead of build.proxy in cog.yaml or NO_PROXY")
+}
+
+func addBuildArgFlag(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVar(&buildArgValues, "build-arg", []string{}, "Set a build arg declared in build.args in cog.yaml, in the form 'KEY=VALUE'")
+}
+
+// buildArgs returns the build args for building the model in cfg
+func buildArgs(cfg *config.Config) ([]string, error) {
+	args, err := cfg.BuildArgs(buildArgValues)
+	if err != nil {
+		return nil, err
+	}
+	return append(cfg.BuildProxy(config.Proxy{HTTP: buildHTTPProxy, HTTPS: buildHTTPSProxy, NoProxy: buildNoProxy}).BuildArgs(), args...), nil
+}
+
 func addNoCacheFlag(cmd *cobra.Command) {
 	cmd.Flags().BoolVar(&buildNoCache, "no-cache", false, "Do not use cache when building the image")
 }
@@ -89,6 +412,102 @@ func addUseCudaBaseImageFlag(cmd *cobra.Command) {
 	cmd.Flags().StringVar(&buildUseCudaBaseImage, "use-cuda-base-image", "auto", "Use Nvidia CUDA base image, 'true' (default) or 'false' (use python base image). False results in a smaller image but may cause problems for non-torch projects")
 }
 
+func addFormatFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&buildFormat, "format", dockerfile.FormatCog, "Format of the image, which sets how it serves predictions: "+strings.Join(dockerfile.Formats, ", "))
+}
+
+func addSBOMFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&buildSBOMFile, "sbom", "", "Write a software bill of materials, with the licenses of the packages in the image, to this path as SPDX JSON")
+}
+
+func addProvenanceFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&buildProvenanceFile, "provenance", "", "Write SLSA provenance, which describes how the image was built, to this path as an in-toto statement")
+}
+
+// writeProvenance writes SLSA provenance to path as JSON
+func writeProvenance(statement *provenance.Statement, path string) error {
+	data, err := json.MarshalIndent(statement, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Failed to convert provenance to JSON: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("Failed to write provenance: %w", err)
+	}
+	console.Infof("Wrote provenance to %s", path)
+	return nil
+}
+
+func addDebugOnFailureFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&buildDebugOnFailure, "debug-on-failure", false, "If a command fails during the build, open a shell in the image as it was just before that command")
+}
+
+func addTimingsFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&buildTimings, "timings", false, "Show how long each section of the build took at the end of the build. Implies --progress=plain")
+}
+
+func addSignWeightsFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&buildWeightsSigningKey, "sign-weights", "", "Sign the manifest of the weights with the Ed25519 private key in this PEM file, so the container checks its weights haven't been tampered with when it starts. Defaults to COG_WEIGHTS_SIGNING_KEY")
+}
+
+// weightsSigningKey returns the path of the key that signs the weights manifest, or "" if it isn't signed
+func weightsSigningKey() string {
+	if buildWeightsSigningKey != "" {
+		return buildWeightsSigningKey
+	}
+	return os.Getenv("COG_WEIGHTS_SIGNING_KEY")
+}
+
+func addTagStrategyFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&buildTagStrategy, "tag-strategy", tagStrategyName, "How to tag the image: '"+tagStrategyName+"' (default) to use the image name as it is, or '"+tagStrategyContent+"' to tag it with a digest of what it's built from, so a build from the same config, source and weights isn't run again")
+}
+
+func checkTagStrategy() error {
+	if buildTagStrategy != tagStrategyName && buildTagStrategy != tagStrategyContent {
+		return fmt.Errorf("Unknown tag strategy '%s', it must be '%s' or '%s'", buildTagStrategy, tagStrategyName, tagStrategyContent)
+	}
+	return nil
+}
+
+// contentTaggedImage returns imageName tagged with the digest of what the image is built from
+func contentTaggedImage(cfg *config.Config, projectDir string, imageName string) (string, error) {
+	if buildDockerfileFile != "" {
+		return "", fmt.Errorf("--tag-strategy %s can't be used with --dockerfile", tagStrategyContent)
+	}
+	dockerBuildArgs, err := buildArgs(cfg)
+	if err != nil {
+		return "", err
+	}
+	digest, err := image.ContentDigest(cfg, projectDir, imageName, buildSeparateWeights, buildUseCudaBaseImage, buildFormat, dockerBuildArgs)
+	if err != nil {
+		return "", fmt.Errorf("Failed to hash what the image is built from: %w", err)
+	}
+	return image.ContentTag(imageName, digest), nil
+}
+
+// templatedImageName returns imageName tagged with image.tag_template in cog.yaml and the version in the VERSION
+// file, if it doesn't have a tag
+func templatedImageName(cfg *config.Config, projectDir string, imageName string) (string, error) {
+	version, err := config.ReadVersion(projectDir)
+	if err != nil {
+		return "", err
+	}
+	return image.TemplatedImageName(cfg, projectDir, imageName, version)
+}
+
+// alreadyBuilt returns whether the image was tagged with the digest of what it's built from, and an image with
+// that tag exists, so building it again would make the same image
+func alreadyBuilt(imageName string) bool {
+	if buildTagStrategy != tagStrategyContent {
+		return false
+	}
+	exists, err := docker.ImageExists(imageName)
+	return err == nil && exists
+}
+
+func addResumeFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&buildResume, "resume", false, "Continue the last build of the image that failed or was interrupted, skipping the stages that finished and reusing the layers Docker cached")
+}
+
 func addDockerfileFlag(cmd *cobra.Command) {
 	cmd.Flags().StringVar(&buildDockerfileFile, "dockerfile", "", "Path to a Dockerfile. If set, cog will use this Dockerfile instead of generating one from cog.yaml")
 	cmd.Flags().VisitAll(func(f *pflag.Flag) {
@@ -97,3 +516,7 @@ func addDockerfileFlag(cmd *cobra.Command) {
 		}
 	})
 }
+
+func addFlattenFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&buildFlatten, "flatten", false, "Merge the layers of the image into one, apart from the weights, which each keep a layer of their own so they can be reused")
+}
@@ -0,0 +1,218 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/util/slices"
+)
+
+// buildAllSkippedDirs are directories that aren't searched for models, as well as hidden ones like .git and .cog
+var buildAllSkippedDirs = []string{"node_modules", "__pycache__", "venv"}
+
+// model is a model found by cog build --all
+type model struct {
+	// dir is the model's directory, and relDir is relative to where the search started
+	dir    string
+	relDir string
+	// contents is the model's cog.yaml and the templates in build.templates, which are searched for the images of
+	// other models it depends on
+	contents string
+	// repository is the name of the model's image, without a tag
+	repository string
+}
+
+// buildAllProjects builds every model in the directory in args, or the current directory, and its subdirectories,
+// after the models they depend on
+func buildAllProjects(ctx context.Context, args []string) error {
+	switch {
+	case buildTag != "":
+		return fmt.Errorf("--tag can't be used with --all, because each model is built as its own image")
+	case buildWatch:
+		return fmt.Errorf("--watch can't be used with --all")
+	case buildProvenanceFile != "" || buildSBOMFile != "" || buildSchemaFile != "" || buildDockerfileFile != "":
+		return fmt.Errorf("--provenance, --sbom, --openapi-schema and --dockerfile can't be used with --all, because they're for a single model")
+	}
+	root := "."
+	if len(args) > 0 {
+		root = args[0]
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return fmt.Errorf("Failed to get absolute path of %s: %w", root, err)
+	}
+
+	models, err := findModels(root)
+	if err != nil {
+		return err
+	}
+	if len(models) == 0 {
+		return fmt.Errorf("There isn't a %s in %s or its subdirectories", global.ConfigFilename, root)
+	}
+	models, err = orderModels(models)
+	if err != nil {
+		return err
+	}
+
+	names := []string{}
+	for _, m := range models {
+		names = append(names, m.relDir)
+	}
+	console.Infof("Building %d models: %s", len(models), strings.Join(names, ", "))
+	for i, m := range models {
+		console.Infof("\n[%d/%d] Building %s...", i+1, len(models), m.relDir)
+		if err := buildModel(ctx, m); err != nil {
+			if errors.Is(err, context.Canceled) {
+				console.Infof("Built %d of %d models before the build was canceled", i, len(models))
+			}
+			return fmt.Errorf("Failed to build %s: %w", m.relDir, err)
+		}
+	}
+	console.Infof("\nBuilt %d models", len(models))
+	return nil
+}
+
+// buildModel builds m from its directory, and changes back to the directory cog was run in
+func buildModel(ctx context.Context, m *model) error {
+	leave, err := enterModelDir(m.dir)
+	if err != nil {
+		return err
+	}
+	cfg, projectDir, imageName, err := prepareBuild(m.dir)
+	if err == nil {
+		err = buildOnce(ctx, cfg, projectDir, imageName)
+	}
+	if leaveErr := leave(); err == nil {
+		err = leaveErr
+	}
+	return err
+}
+
+// findModels returns the models in root and its subdirectories, sorted by directory
+func findModels(root string) ([]*model, error) {
+	models := []*model{}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p != root && (strings.HasPrefix(d.Name(), ".") || slices.ContainsString(buildAllSkippedDirs, d.Name())) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Name() != global.ConfigFilename {
+			return nil
+		}
+		m, err := loadModel(root, filepath.Dir(p))
+		if err != nil {
+			return err
+		}
+		models = append(models, m)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find models in %s: %w", root, err)
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i].relDir < models[j].relDir })
+	return models, nil
+}
+
+func loadModel(root string, dir string) (*model, error) {
+	contents, err := os.ReadFile(filepath.Join(dir, global.ConfigFilename))
+	if err != nil {
+		return nil, err
+	}
+	cfg, _, err := config.GetConfig(dir)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load %s: %w", filepath.Join(dir, global.ConfigFilename), err)
+	}
+	for _, tmpl := range cfg.Build.Templates {
+		tmplContents, err := os.ReadFile(filepath.Join(dir, tmpl))
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read %s: %w", tmpl, err)
+		}
+		contents = append(contents, '\n')
+		contents = append(contents, tmplContents...)
+	}
+	relDir, err := filepath.Rel(root, dir)
+	if err != nil {
+		return nil, err
+	}
+	imageName := cfg.Image
+	if imageName == "" {
+		imageName = config.DockerImageName(dir)
+	}
+	return &model{
+		dir:        dir,
+		relDir:     filepath.ToSlash(relDir),
+		contents:   string(contents),
+		repository: image.ImageRepository(imageName),
+	}, nil
+}
+
+// orderModels returns models in the order they can be built in: a model that refers to another model's image in
+// its cog.yaml or templates, e.g. in a template of the base_image block that builds FROM it, is built after it. Otherwise, they're in
+// the order of their directories.
+func orderModels(models []*model) ([]*model, error) {
+	dependencies := map[*model][]*model{}
+	for _, m := range models {
+		for _, other := range models {
+			if other != m && refersToImage(m.contents, other.repository) {
+				dependencies[m] = append(dependencies[m], other)
+			}
+		}
+	}
+
+	ordered := []*model{}
+	built := map[*model]bool{}
+	for len(ordered) < len(models) {
+		progress := false
+		for _, m := range models {
+			if built[m] || !allBuilt(dependencies[m], built) {
+				continue
+			}
+			ordered = append(ordered, m)
+			built[m] = true
+			progress = true
+			// Start again from the first model, so models are built in the order of their directories where they can be
+			break
+		}
+		if !progress {
+			cycle := []string{}
+			for _, m := range models {
+				if !built[m] {
+					cycle = append(cycle, m.relDir)
+				}
+			}
+			return nil, fmt.Errorf("Can't work out which model to build first, because %s depend on each other's images", strings.Join(cycle, ", "))
+		}
+	}
+	return ordered, nil
+}
+
+func allBuilt(models []*model, built map[*model]bool) bool {
+	for _, m := range models {
+		if !built[m] {
+			return false
+		}
+	}
+	return true
+}
+
+// refersToImage returns whether contents has repository in it as a whole image name, with or without a tag
+func refersToImage(contents string, repository string) bool {
+	re := regexp.MustCompile(`(^|[^A-Za-z0-9._/-])` + regexp.QuoteMeta(repository) + `([^A-Za-z0-9._/-]|$)`)
+	return re.MatchString(contents)
+}
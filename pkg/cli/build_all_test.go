@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeModel(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, contents := range files {
+		p := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		require.NoError(t, os.WriteFile(p, []byte(contents), 0o644))
+	}
+}
+
+func TestFindAndOrderModels(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("COG_DEFAULTS", "")
+	root := t.TempDir()
+	writeModel(t, filepath.Join(root, "models", "base"), map[string]string{
+		"cog.yaml": "build:\n  python_version: \"3.11\"\nimage: r8.im/team/base\n",
+	})
+	writeModel(t, filepath.Join(root, "models", "alpha"), map[string]string{
+		"cog.yaml":           "build:\n  python_version: \"3.11\"\n  templates:\n    base_image: base.tmpl\nimage: r8.im/team/alpha\n",
+		"base.tmpl":          "FROM r8.im/team/base:latest\n",
+		"node_modules/x.txt": "",
+	})
+	writeModel(t, filepath.Join(root, "models", "zeta"), map[string]string{
+		"cog.yaml": "build:\n  python_version: \"3.11\"\nimage: r8.im/team/zeta\n",
+	})
+	// Models in hidden directories and node_modules aren't built
+	writeModel(t, filepath.Join(root, ".cog", "tmp"), map[string]string{"cog.yaml": "build:\n"})
+	writeModel(t, filepath.Join(root, "node_modules", "pkg"), map[string]string{"cog.yaml": "build:\n"})
+
+	models, err := findModels(root)
+	require.NoError(t, err)
+	dirs := []string{}
+	for _, m := range models {
+		dirs = append(dirs, m.relDir)
+	}
+	require.Equal(t, []string{"models/alpha", "models/base", "models/zeta"}, dirs)
+
+	models, err = orderModels(models)
+	require.NoError(t, err)
+	dirs = []string{}
+	for _, m := range models {
+		dirs = append(dirs, m.relDir)
+	}
+	require.Equal(t, []string{"models/base", "models/alpha", "models/zeta"}, dirs)
+}
+
+func TestOrderModelsCycle(t *testing.T) {
+	a := &model{relDir: "a", repository: "r8.im/team/a", contents: "FROM r8.im/team/b"}
+	b := &model{relDir: "b", repository: "r8.im/team/b", contents: "FROM r8.im/team/a:1.0"}
+	c := &model{relDir: "c", repository: "r8.im/team/c", contents: "FROM r8.im/team/a-large"}
+	_, err := orderModels([]*model{a, b, c})
+	require.ErrorContains(t, err, "a, b depend on each other")
+
+	// r8.im/team/a-large isn't r8.im/team/a, and images that aren't built here aren't waited for
+	ordered, err := orderModels([]*model{c, a})
+	require.NoError(t, err)
+	require.Equal(t, []*model{c, a}, ordered)
+}
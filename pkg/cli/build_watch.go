@@ -0,0 +1,150 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/dockerfile"
+	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/watch"
+)
+
+// watchIgnoredFiles are files Cog writes while it builds, so they don't cause another build
+var watchIgnoredFiles = []string{".git", ".cog", "__pycache__"}
+
+// maxChangedFilesShown is how many of the files that changed are listed before a rebuild
+const maxChangedFilesShown = 5
+
+// watchBuild builds the image, then rebuilds it whenever cog.yaml, the Python requirements or the source
+// change, until it is interrupted. Docker reuses the layers that didn't change, and which sections of the
+// Dockerfile are rebuilt is printed before each build. Interrupting it stops the build that's running, and
+// watching.
+func watchBuild(ctx context.Context, cfg *config.Config, projectDir string, imageName string) error {
+	if buildDockerfileFile != "" {
+		return fmt.Errorf("--watch can't be used with --dockerfile")
+	}
+	ignore, err := watchIgnore(cfg, projectDir)
+	if err != nil {
+		return err
+	}
+	watcher, err := watch.New(projectDir, ignore)
+	if err != nil {
+		return fmt.Errorf("Failed to watch %s: %w", projectDir, err)
+	}
+
+	layers, err := generateLayers(cfg, projectDir)
+	if err != nil {
+		return err
+	}
+	if err := buildOnce(ctx, cfg, projectDir, imageName); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		console.Error(err.Error())
+	}
+
+	for {
+		console.Info("\nWatching for changes to cog.yaml, the Python requirements and the source. Press Ctrl+C to stop.")
+		changed, err := watcher.Wait(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to watch %s: %w", projectDir, err)
+		}
+		console.Infof("\nChanged: %s", summarizeChangedFiles(changed))
+
+		newCfg, _, err := config.GetConfig(projectDir)
+		if err != nil {
+			console.Error(err.Error())
+			continue
+		}
+		newLayers, err := generateLayers(newCfg, projectDir)
+		if err != nil {
+			console.Error(err.Error())
+			continue
+		}
+
+		changedSections := []string{}
+		for _, p := range changed {
+			if p != global.ConfigFilename && p != path.Clean(newCfg.Build.PythonRequirements) {
+				changedSections = append(changedSections, dockerfile.SectionSource)
+				break
+			}
+		}
+		invalidated := dockerfile.InvalidatedSections(layers, newLayers, changedSections...)
+		if len(invalidated) == 0 {
+			console.Info("Nothing in the image changed, so it wasn't rebuilt")
+			continue
+		}
+		console.Infof("Rebuilding %s. The layers before them are cached.", strings.Join(invalidated, ", "))
+
+		if err := buildOnce(ctx, newCfg, projectDir, imageName); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			console.Error(err.Error())
+			continue
+		}
+		layers = newLayers
+	}
+}
+
+// watchIgnore returns whether a path in the project doesn't change the image, because it isn't sent to Docker,
+// or because Cog writes it while it builds
+func watchIgnore(cfg *config.Config, projectDir string) (func(p string, isDir bool) bool, error) {
+	contents, err := dockerfile.ReadDockerignore(projectDir)
+	if err != nil {
+		return nil, err
+	}
+	matcher, err := dockerfile.NewDockerignoreMatcher(contents)
+	if err != nil {
+		return nil, err
+	}
+	return func(p string, isDir bool) bool {
+		for _, name := range watchIgnoredFiles {
+			if p == name || strings.HasSuffix(p, "/"+name) {
+				return true
+			}
+		}
+		if isDir && matcher.HasExceptions() {
+			// Files in the directory can be sent to Docker if a line starting with ! includes them again
+			return cfg.IsIgnored(p)
+		}
+		return strings.HasSuffix(p, ".pyc") || matcher.Excludes(p) || cfg.IsIgnored(p)
+	}, nil
+}
+
+// generateLayers generates the Dockerfile for cfg, and returns its layers
+func generateLayers(cfg *config.Config, projectDir string) ([]dockerfile.Layer, error) {
+	generator, err := dockerfile.NewGenerator(cfg, projectDir)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating Dockerfile generator: %w", err)
+	}
+	defer func() {
+		if err := generator.Cleanup(); err != nil {
+			console.Warnf("Error cleaning up Dockerfile generator: %s", err)
+		}
+	}()
+	generator.SetUseCudaBaseImage(buildUseCudaBaseImage)
+	if err := generator.SetFormat(buildFormat); err != nil {
+		return nil, err
+	}
+	contents, err := generator.GenerateDockerfileWithoutSeparateWeights()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to generate Dockerfile: %w", err)
+	}
+	return generator.Layers(contents), nil
+}
+
+// summarizeChangedFiles lists the files that changed, or the first few of them if a lot did
+func summarizeChangedFiles(changed []string) string {
+	if len(changed) <= maxChangedFilesShown {
+		return strings.Join(changed, ", ")
+	}
+	return fmt.Sprintf("%s and %d other files", strings.Join(changed[:maxChangedFilesShown], ", "), len(changed)-maxChangedFilesShown)
+}
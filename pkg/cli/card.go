@@ -0,0 +1,146 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/card"
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var (
+	cardFormat string
+	cardOutput string
+	cardEmbed  bool
+)
+
+func newCardCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "card [IMAGE]",
+		Short: "Generate a model card that describes the model",
+		Long: `Generate a model card that describes the model.
+
+The model card is made from the metadata in cog.yaml, the model's inputs
+and output, the examples in the examples/ directory, and the project's
+license file.
+
+If 'image' is passed, it describes that Docker image, which must have been
+built by Cog. Otherwise, it builds the model in the current directory and
+describes that.`,
+		Example: `cog card -o MODELCARD.md
+cog card --embed`,
+		RunE:              interruptible(cmdCard),
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeImages,
+	}
+	addSecretsFlag(cmd)
+	addNoCacheFlag(cmd)
+	addSchemaFlag(cmd)
+	addUseCudaBaseImageFlag(cmd)
+	addProxyFlags(cmd)
+	addBuildArgFlag(cmd)
+	addDockerfileFlag(cmd)
+	addBuildProgressOutputFlag(cmd)
+
+	cmd.Flags().StringVar(&cardFormat, "format", card.FormatMarkdown, "Format of the model card: 'markdown' or 'html'")
+	cmd.Flags().StringVarP(&cardOutput, "output", "o", "", "Write the model card to this file instead of stdout")
+	cmd.Flags().BoolVar(&cardEmbed, "embed", false, "Also embed the model card in the image at "+card.ImagePath)
+
+	return cmd
+}
+
+func cmdCard(cmd *cobra.Command, args []string) error {
+	imageName := ""
+	projectDir := ""
+	if len(args) > 0 {
+		imageName = args[0]
+	} else {
+		cfg, dir, err := config.GetConfig(projectDirFlag)
+		if err != nil {
+			return err
+		}
+		projectDir = dir
+		imageName = cfg.Image
+		if imageName == "" {
+			imageName = config.DockerImageName(projectDir)
+		}
+		dockerBuildArgs, err := buildArgs(cfg)
+		if err != nil {
+			return err
+		}
+		if err := image.Build(cmd.Context(), cfg, projectDir, imageName, image.BuildOptions{
+			Secrets:          buildSecrets,
+			BuildArgs:        dockerBuildArgs,
+			NoCache:          buildNoCache,
+			UseCudaBaseImage: buildUseCudaBaseImage,
+			ProgressOutput:   buildProgressOutput,
+			SchemaFile:       buildSchemaFile,
+			DockerfileFile:   buildDockerfileFile,
+		}); err != nil {
+			return err
+		}
+	}
+
+	// Read the config from the image, so it matches the schema
+	cfg, err := image.GetConfig(imageName)
+	if err != nil {
+		return err
+	}
+	schema, err := image.GetOpenAPISchema(imageName)
+	if err != nil {
+		return err
+	}
+	modelCard, err := card.New(cfg, schema, projectDir)
+	if err != nil {
+		return err
+	}
+	contents, err := modelCard.Render(cardFormat)
+	if err != nil {
+		return err
+	}
+
+	if cardEmbed {
+		markdown, err := modelCard.Render(card.FormatMarkdown)
+		if err != nil {
+			return err
+		}
+		if err := embedCard(cmd.Context(), imageName, markdown); err != nil {
+			return err
+		}
+		console.Infof("Embedded model card in %s at %s", imageName, card.ImagePath)
+	}
+
+	if cardOutput == "" {
+		_, err = os.Stdout.Write(contents)
+		return err
+	}
+	if err := os.WriteFile(cardOutput, contents, 0o644); err != nil {
+		return fmt.Errorf("Failed to write model card: %w", err)
+	}
+	console.Infof("Wrote model card to %s", cardOutput)
+	return nil
+}
+
+// embedCard adds the model card to imageName at card.ImagePath
+func embedCard(ctx context.Context, imageName string, markdown []byte) error {
+	dir, err := os.MkdirTemp("", "cog-card-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	if err := os.WriteFile(filepath.Join(dir, filepath.Base(card.ImagePath)), markdown, 0o644); err != nil {
+		return err
+	}
+	dockerfile := fmt.Sprintf("FROM %s\nCOPY %s %s\n", imageName, filepath.Base(card.ImagePath), card.ImagePath)
+	if err := docker.Build(ctx, dir, dockerfile, "", imageName, nil, nil, false, buildProgressOutput); err != nil {
+		return fmt.Errorf("Failed to embed model card: %w", err)
+	}
+	return nil
+}
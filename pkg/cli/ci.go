@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/ci"
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/predict"
+	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/util/files"
+)
+
+var ciStdout bool
+
+func newCICommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ci <" + strings.Join(ci.Platforms, "|") + ">",
+		Short: "Generate a CI pipeline that builds, tests, scans and pushes the model",
+		Long: `Generate a CI pipeline that builds, tests, scans and pushes the model.
+
+The pipeline builds the image with its layers cached between runs, runs a
+prediction with each input in the examples directory, scans the image for
+vulnerabilities with Trivy, and pushes it when the default branch changes.
+If the model needs a GPU, it runs on a GPU runner.
+
+It's written to .github/workflows/cog.yml for GitHub Actions, or
+.gitlab-ci.yml for GitLab, in the root of the Git repository.`,
+		Example:   `cog ci github`,
+		Args:      cobra.ExactArgs(1),
+		ValidArgs: ci.Platforms,
+		RunE:      cmdCI,
+	}
+	cmd.Flags().BoolVar(&ciStdout, "stdout", false, "Print the pipeline instead of writing it")
+	return cmd
+}
+
+func cmdCI(cmd *cobra.Command, args []string) error {
+	platform := args[0]
+	cfg, projectDir, err := config.GetConfig(projectDirFlag)
+	if err != nil {
+		return err
+	}
+	repoDir := ci.FindRepository(projectDir)
+	opts, err := ci.OptionsFromConfig(cfg, projectDir, repoDir)
+	if err != nil {
+		return err
+	}
+	pipeline, err := ci.Pipeline(platform, opts)
+	if err != nil {
+		return err
+	}
+	if ciStdout {
+		_, err := os.Stdout.Write(pipeline)
+		return err
+	}
+
+	rel := ci.Path(platform, opts)
+	p := filepath.Join(repoDir, rel)
+	exists, err := files.Exists(p)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("Found an existing %s.\nExiting without overwriting (to be on the safe side!) Run 'cog ci %s --stdout' to see the pipeline", rel, platform)
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return fmt.Errorf("Error creating %s: %w", filepath.Dir(p), err)
+	}
+	if err := os.WriteFile(p, pipeline, 0o644); err != nil {
+		return fmt.Errorf("Error writing %s: %w", p, err)
+	}
+	console.Infof("✅ Created %s", p)
+	if len(opts.Examples) == 0 {
+		console.Infof("Add inputs to the %s directory to run predictions with them in the pipeline.", filepath.Join(projectDir, predict.ExamplesDir))
+	}
+	if opts.GPU {
+		console.Info("The model needs a GPU, so check the pipeline runs on your GPU runners.")
+	}
+	return nil
+}
@@ -0,0 +1,327 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/spf13/cobra"
+	"github.com/vincent-petithory/dataurl"
+
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/predict"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// gpuMemoryInterval is how often the GPU memory of the containers is checked while they run predictions
+const gpuMemoryInterval = 250 * time.Millisecond
+
+// maxSummaryLength is how long outputs shown in the comparison can be before they're shortened
+const maxSummaryLength = 60
+
+// comparedImage is one side of a comparison
+type comparedImage struct {
+	Image     string
+	predictor predict.Predictor
+	// GPU is set if the model runs on a GPU, so its GPU memory is checked
+	GPU        bool
+	Prediction *predict.Response
+	Err        error
+	Latency    time.Duration
+	// GPUMemory is the most GPU memory the container used during the prediction, or -1 if it isn't known
+	GPUMemory int64
+}
+
+func newCompareCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "compare <image-a> <image-b>",
+		Short: "Run a prediction on two images and compare them side by side",
+		Long: `Run a prediction on two images and compare them side by side.
+
+It starts both images, runs the same inputs on them at the same time, and
+shows their outputs, how long the predictions took and how much GPU memory
+they used, so you can check an upgrade to the model's dependencies or
+weights before you push it.
+
+With --output, the outputs of the images are written to a and b directories
+in it, so you can compare files.`,
+		Example:           `cog compare r8.im/your-username/hotdog-detector:v1 hotdog-detector:latest -i image=@hotdog.jpg`,
+		RunE:              cmdCompare,
+		Args:              cobra.ExactArgs(2),
+		ValidArgsFunction: completeImages,
+	}
+
+	addGpusFlag(cmd)
+
+	cmd.Flags().StringArrayVarP(&inputFlags, "input", "i", []string{}, "Inputs, in the form name=value. if value is prefixed with @, then it is read from a file on disk. E.g. -i path=@image.jpg")
+	cmd.Flags().StringVarP(&outPath, "output", "o", "", "Directory to write the outputs of the images to, in a and b directories")
+	cmd.Flags().StringArrayVarP(&envFlags, "env", "e", []string{}, "Environment variables, in the form name=value")
+	cmd.Flags().DurationVar(&timeoutFlag, "timeout", 0, "Cancel the predictions if they haven't finished after this long, e.g. 30s or 5m")
+
+	return cmd
+}
+
+func cmdCompare(cmd *cobra.Command, args []string) error {
+	gpus, err := parseGpusFlag()
+	if err != nil {
+		return err
+	}
+	inputs, err := parseInputFlags(inputFlags)
+	if err != nil {
+		return err
+	}
+
+	sides := make([]*comparedImage, len(args))
+	for i, imageName := range args {
+		if sides[i], err = newComparedImage(imageName, gpus); err != nil {
+			return err
+		}
+	}
+
+	defer func() {
+		stopComparedImages(sides)
+	}()
+	go func() {
+		captureSignal := make(chan os.Signal, 1)
+		signal.Notify(captureSignal, syscall.SIGINT)
+
+		<-captureSignal
+
+		console.Info("Stopping containers...")
+		stopComparedImages(sides)
+	}()
+
+	console.Info("")
+	console.Infof("Starting %s and %s and running setup()...", args[0], args[1])
+	errs := make([]error, len(sides))
+	var wg sync.WaitGroup
+	for i, side := range sides {
+		wg.Add(1)
+		go func(i int, side *comparedImage) {
+			defer wg.Done()
+			errs[i] = side.predictor.Start(os.Stderr)
+		}(i, side)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("Failed to start %s: %w", sides[i].Image, err)
+		}
+	}
+
+	console.Info("Running predictions...")
+	for _, side := range sides {
+		wg.Add(1)
+		go func(side *comparedImage) {
+			defer wg.Done()
+			side.predict(inputs)
+		}(side)
+	}
+	wg.Wait()
+
+	printComparison(sides)
+
+	if outPath != "" {
+		for i, side := range sides {
+			if side.Prediction == nil || side.Prediction.Output == nil {
+				continue
+			}
+			schema, err := side.predictor.GetSchema()
+			if err != nil {
+				return err
+			}
+			dir := filepath.Join(outPath, string(rune('a'+i))) + "/"
+			if err := handlePredictionOutput(side.Prediction, schema, dir, -1); err != nil {
+				return fmt.Errorf("Failed to write the output of %s: %w", side.Image, err)
+			}
+		}
+	}
+
+	for _, side := range sides {
+		if side.Err != nil {
+			return fmt.Errorf("The prediction on %s failed: %w", side.Image, side.Err)
+		}
+	}
+	return nil
+}
+
+// newComparedImage pulls an image if it isn't on this machine, and sets up a predictor to run it
+func newComparedImage(imageName string, gpus string) (*comparedImage, error) {
+	if err := pullIfMissing(imageName); err != nil {
+		return nil, err
+	}
+	conf, err := image.GetConfig(imageName)
+	if err != nil {
+		return nil, err
+	}
+	if gpus == "" && conf.Build.GPU {
+		gpus = "all"
+	}
+	predictor := predict.NewPredictor(docker.RunOptions{
+		GPUs:  gpus,
+		Image: imageName,
+		Env:   envFlags,
+	})
+	if err := configureServer(&predictor, conf); err != nil {
+		return nil, err
+	}
+	return &comparedImage{Image: imageName, predictor: predictor, GPU: gpus != "", GPUMemory: -1}, nil
+}
+
+func stopComparedImages(sides []*comparedImage) {
+	for _, side := range sides {
+		if side.predictor.ContainerID() == "" {
+			continue
+		}
+		if err := side.predictor.Stop(); err != nil {
+			console.Warnf("Failed to stop container: %s", err)
+		}
+	}
+}
+
+// predict runs a prediction, timing it and checking the most GPU memory the container uses while it runs
+func (c *comparedImage) predict(inputs predict.Inputs) {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	if c.GPU {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.watchGPUMemory(done)
+		}()
+	}
+
+	start := time.Now()
+	c.Prediction, c.Err = c.predictor.PredictWithTimeout(inputs, timeoutFlag)
+	c.Latency = time.Since(start)
+	if c.Err == nil && c.Prediction.Status != "succeeded" {
+		c.Err = errors.New(c.Prediction.Error)
+	}
+
+	close(done)
+	wg.Wait()
+}
+
+func (c *comparedImage) watchGPUMemory(done <-chan struct{}) {
+	ticker := time.NewTicker(gpuMemoryInterval)
+	defer ticker.Stop()
+	for {
+		memory, err := docker.ContainerGPUMemory(c.predictor.ContainerID())
+		if err != nil {
+			console.Debugf("Failed to get the GPU memory of %s: %s", c.Image, err)
+			return
+		}
+		if memory > c.GPUMemory {
+			c.GPUMemory = memory
+		}
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func printComparison(sides []*comparedImage) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	row := func(name string, value func(side *comparedImage) string) {
+		fields := []string{name}
+		for _, side := range sides {
+			fields = append(fields, value(side))
+		}
+		fmt.Fprintln(w, strings.Join(fields, "\t"))
+	}
+	row("", func(side *comparedImage) string { return side.Image })
+	row("STATUS", func(side *comparedImage) string {
+		if side.Prediction == nil {
+			return "error"
+		}
+		return string(side.Prediction.Status)
+	})
+	row("LATENCY", func(side *comparedImage) string {
+		return side.Latency.Round(time.Millisecond).String()
+	})
+	row("GPU MEMORY", func(side *comparedImage) string {
+		if side.GPUMemory < 0 {
+			return "-"
+		}
+		return units.BytesSize(float64(side.GPUMemory))
+	})
+	row("OUTPUT", func(side *comparedImage) string {
+		if side.Err != nil {
+			return summarize(side.Err.Error())
+		}
+		if side.Prediction.Output == nil {
+			return "-"
+		}
+		return summarizeOutput(*side.Prediction.Output)
+	})
+	_ = w.Flush()
+
+	if sides[0].Err == nil && sides[1].Err == nil {
+		console.Info("")
+		if reflect.DeepEqual(sides[0].Prediction.Output, sides[1].Prediction.Output) {
+			console.Info("The outputs are the same")
+		} else {
+			console.Info("The outputs are different")
+		}
+	}
+}
+
+// summarizeOutput returns an output as short JSON, with files replaced by their type and size
+func summarizeOutput(output interface{}) string {
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(summarizeFiles(output)); err != nil {
+		return summarize(fmt.Sprint(output))
+	}
+	return summarize(out.String())
+}
+
+func summarizeFiles(output interface{}) interface{} {
+	switch v := output.(type) {
+	case string:
+		if strings.HasPrefix(v, "data:") {
+			if file, err := dataurl.DecodeString(v); err == nil {
+				return fmt.Sprintf("<%s, %s>", file.ContentType(), units.HumanSize(float64(len(file.Data))))
+			}
+		}
+		return v
+	case []interface{}:
+		files := make([]interface{}, len(v))
+		for i, item := range v {
+			files[i] = summarizeFiles(item)
+		}
+		return files
+	case map[string]interface{}:
+		files := map[string]interface{}{}
+		for key, item := range v {
+			files[key] = summarizeFiles(item)
+		}
+		return files
+	default:
+		return v
+	}
+}
+
+// summarize shortens s to fit in a column
+func summarize(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if len([]rune(s)) <= maxSummaryLength {
+		return s
+	}
+	return string([]rune(s)[:maxSummaryLength-3]) + "..."
+}
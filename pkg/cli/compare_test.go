@@ -0,0 +1,18 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummarizeOutput(t *testing.T) {
+	require.Equal(t, `"a hot dog"`, summarizeOutput("a hot dog"))
+	require.Equal(t, `{"score":0.5}`, summarizeOutput(map[string]interface{}{"score": 0.5}))
+	require.Equal(t, `["<image/png, 5B>"]`, summarizeOutput([]interface{}{"data:image/png;base64,aGVsbG8="}))
+
+	long := summarizeOutput(strings.Repeat("hot dog ", 20))
+	require.Len(t, long, maxSummaryLength)
+	require.True(t, strings.HasSuffix(long, "..."))
+}
@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/card"
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/image"
+)
+
+// completeImages completes the names of local images built by Cog, for commands that take an image as their only
+// argument
+func completeImages(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	images, err := docker.ListImages(map[string]string{global.LabelNamespace + "version": ""})
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	completions := []string{}
+	for _, name := range images {
+		if strings.HasPrefix(name, toComplete) {
+			completions = append(completions, name)
+		}
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeInputs completes -i with the names of the model's inputs, from the schema of the image passed as an
+// argument, or of the image built from the project by `cog build`. Once the name is typed, it completes file names
+// for file inputs.
+func completeInputs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	schema, err := completionSchema(args)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	inputs := card.Inputs(schema)
+
+	if name, _, ok := strings.Cut(toComplete, "="); ok {
+		for _, input := range inputs {
+			if input.Name == name && input.Type == "file" {
+				return nil, cobra.ShellCompDirectiveDefault
+			}
+		}
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return inputCompletions(inputs, toComplete), cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+}
+
+// inputCompletions returns the completions of name= for the inputs whose names start with toComplete, with
+// their types and descriptions
+func inputCompletions(inputs []card.Input, toComplete string) []string {
+	completions := []string{}
+	for _, input := range inputs {
+		if !strings.HasPrefix(input.Name, toComplete) {
+			continue
+		}
+		description := input.Type
+		if input.Description != "" {
+			description += ": " + input.Description
+		}
+		completions = append(completions, input.Name+"=\t"+description)
+	}
+	return completions
+}
+
+func completionSchema(args []string) (*openapi3.T, error) {
+	if len(args) > 0 {
+		return image.GetOpenAPISchema(args[0])
+	}
+	cfg, projectDir, err := config.GetConfig(projectDirFlag)
+	if err != nil {
+		return nil, err
+	}
+	imageName := cfg.Image
+	if imageName == "" {
+		imageName = config.DockerImageName(projectDir)
+	}
+	return image.GetOpenAPISchema(imageName)
+}
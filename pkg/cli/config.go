@@ -0,0 +1,143 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+func newConfigCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Get and set keys in " + global.ConfigFilename,
+	}
+	cmd.AddCommand(newConfigGetCommand(), newConfigSetCommand())
+	return cmd
+}
+
+func newConfigGetCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "get [KEY]",
+		Short: "Print the value of a key in " + global.ConfigFilename + ", or the whole file",
+		Example: `cog config get build.gpu
+cog config get build.python_packages`,
+		RunE: cmdConfigGet,
+		Args: cobra.MaximumNArgs(1),
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) > 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			return completeConfigKeys(toComplete), cobra.ShellCompDirectiveNoFileComp
+		},
+	}
+}
+
+func newConfigSetCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "set KEY VALUE",
+		Short: "Set a key in " + global.ConfigFilename + ", keeping its comments and formatting",
+		Long: `Set a key in ` + global.ConfigFilename + `, keeping its comments and formatting.
+
+VALUE is YAML, so lists can be set with [a, b]. The key is added if it isn't set
+already, and ` + global.ConfigFilename + ` is only changed if the result is valid.`,
+		Example: `cog config set build.gpu true
+cog config set build.python_version 3.11
+cog config set build.system_packages "[ffmpeg, libsndfile1]"`,
+		RunE: cmdConfigSet,
+		Args: cobra.ExactArgs(2),
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) > 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			return completeConfigKeys(toComplete), cobra.ShellCompDirectiveNoFileComp
+		},
+	}
+}
+
+func cmdConfigGet(cmd *cobra.Command, args []string) error {
+	configPath, contents, err := readConfigFile()
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		fmt.Print(string(contents))
+		return nil
+	}
+	value, ok, err := config.GetValue(contents, args[0])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%s isn't set in %s", args[0], configPath)
+	}
+	fmt.Println(value)
+	return nil
+}
+
+func cmdConfigSet(cmd *cobra.Command, args []string) error {
+	configPath, contents, err := readConfigFile()
+	if err != nil {
+		return err
+	}
+	updated, err := config.SetValue(contents, args[0], args[1])
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(configPath)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(configPath, updated, info.Mode()); err != nil {
+		return fmt.Errorf("Failed to write %s: %w", configPath, err)
+	}
+	console.Infof("Set %s in %s", args[0], configPath)
+	return nil
+}
+
+// readConfigFile returns the path and contents of the project's cog.yaml, as it is on disk
+func readConfigFile() (string, []byte, error) {
+	projectDir, err := config.GetProjectDir(projectDirFlag)
+	if err != nil {
+		return "", nil, err
+	}
+	configPath := filepath.Join(projectDir, global.ConfigFilename)
+	contents, err := os.ReadFile(configPath)
+	if err != nil {
+		return "", nil, fmt.Errorf("Failed to read %s: %w", configPath, err)
+	}
+	return configPath, contents, nil
+}
+
+// completeConfigKeys completes the keys that can be set in cog.yaml, with the first sentence of their descriptions
+func completeConfigKeys(toComplete string) []string {
+	keys, err := config.Keys()
+	if err != nil {
+		return nil
+	}
+	completions := []string{}
+	for _, key := range keys {
+		if !strings.HasPrefix(key.Name, toComplete) {
+			continue
+		}
+		completions = append(completions, key.Name+"\t"+firstSentence(key.Description))
+	}
+	return completions
+}
+
+// firstSentence returns the first sentence of s, so completion descriptions fit on one line
+func firstSentence(s string) string {
+	for i := 0; i+2 < len(s); i++ {
+		if s[i] == '.' && s[i+1] == ' ' && unicode.IsUpper(rune(s[i+2])) {
+			return s[:i+1]
+		}
+	}
+	return s
+}
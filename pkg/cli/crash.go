@@ -0,0 +1,69 @@
+package cli
+
+import (
+	"fmt"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/crash"
+	"github.com/replicate/cog/pkg/dockerfile"
+	"github.com/replicate/cog/pkg/errors"
+	"github.com/replicate/cog/pkg/predict"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// reportCrash writes a diagnostics bundle to the current directory if err is because the model's container crashed,
+// and returns err saying where it is. projectDir is set if the model was built from a project, so the Dockerfile
+// generated for it is added to the bundle.
+func reportCrash(predictor predict.Predictor, cfg *config.Config, projectDir string, err error) (reported error) {
+	c := predictor.Crashed()
+	if c == nil {
+		return err
+	}
+	defer func() {
+		if c.OutOfMemory() {
+			reported = errors.OutOfMemory(reported)
+		} else {
+			reported = errors.PredictionFailed(reported)
+		}
+	}()
+	bundle := &crash.Bundle{Time: time.Now(), Crash: c, Err: err}
+	bundle.Collect()
+	if cfg != nil {
+		if data, err := yaml.Marshal(cfg); err == nil {
+			bundle.Config = string(data)
+		}
+		if projectDir != "" {
+			bundle.Dockerfile = crashDockerfile(cfg, projectDir)
+		}
+	}
+	path, writeErr := bundle.Write(".")
+	if writeErr != nil {
+		console.Warnf("%s", writeErr)
+		return fmt.Errorf("The model's container crashed, because %s: %w", c.Reason(), err)
+	}
+	return fmt.Errorf("The model's container crashed, because %s. Logs and diagnostics, with secrets redacted, are in %s: %w", c.Reason(), path, err)
+}
+
+// crashDockerfile returns the Dockerfile generated for the project, or "" if it can't be generated
+func crashDockerfile(cfg *config.Config, projectDir string) string {
+	generator, err := dockerfile.NewGenerator(cfg, projectDir)
+	if err != nil {
+		console.Debugf("Failed to create Dockerfile generator for crash diagnostics: %s", err)
+		return ""
+	}
+	defer func() {
+		if err := generator.Cleanup(); err != nil {
+			console.Debugf("Error cleaning up after generating Dockerfile: %s", err)
+		}
+	}()
+	generator.SetUseCudaBaseImage(buildUseCudaBaseImage)
+	contents, err := generator.GenerateDockerfileWithoutSeparateWeights()
+	if err != nil {
+		console.Debugf("Failed to generate Dockerfile for crash diagnostics: %s", err)
+		return ""
+	}
+	return contents
+}
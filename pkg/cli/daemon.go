@@ -0,0 +1,90 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/daemon"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// daemonTokenEnv is the environment variable the daemon's token can be set in, so it isn't in the process list
+const daemonTokenEnv = "COG_DAEMON_TOKEN"
+
+var (
+	daemonHost  string
+	daemonPort  int
+	daemonToken string
+)
+
+func newDaemonCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "daemon",
+		Short: "Serve a REST API to build models and run predictions",
+		Long: `Serve a REST API to build models and run predictions.
+
+Other programs, like GUIs and internal platforms, can use it to drive Cog
+instead of running the CLI and parsing its output. Builds run in the
+background, one at a time, and their progress can be polled. Models are
+started on their first prediction and kept running for the next ones.
+
+  POST   /builds         Queue a build of {"dir": "/path/to/model"}
+  GET    /builds         List builds
+  GET    /builds/ID      Get a build's status, stages and image
+  DELETE /builds/ID      Cancel a build
+  POST   /predictions    Run {"image": "...", "input": {...}}
+  GET    /models         List the models that are running
+  DELETE /models?image=  Stop a model
+
+It only listens on localhost, unless it's given a token with --token or
+` + daemonTokenEnv + `, which requests must send as a bearer token.`,
+		Example: `cog daemon --port 8393
+curl -X POST -H 'Content-Type: application/json' -d '{"dir": "'$PWD'"}' localhost:8393/builds`,
+		RunE: interruptible(cmdDaemon),
+		Args: cobra.NoArgs,
+	}
+	cmd.Flags().StringVar(&daemonHost, "host", "127.0.0.1", "Host to listen on")
+	cmd.Flags().IntVar(&daemonPort, "port", 8393, "Port to listen on")
+	cmd.Flags().StringVar(&daemonToken, "token", "", "Token that requests must send in an Authorization: Bearer header. Defaults to $"+daemonTokenEnv)
+	return cmd
+}
+
+func cmdDaemon(cmd *cobra.Command, args []string) error {
+	if daemonToken == "" {
+		daemonToken = os.Getenv(daemonTokenEnv)
+	}
+	if daemonToken == "" && !daemon.IsLoopback(daemonHost) {
+		return fmt.Errorf("The daemon can build and run anything on this machine, so it needs a token with --token or %s to listen on %s", daemonTokenEnv, daemonHost)
+	}
+
+	api := daemon.New(daemonToken)
+	defer func() {
+		if err := api.Close(); err != nil {
+			console.Warnf("%s", err)
+		}
+	}()
+	addr := net.JoinHostPort(daemonHost, strconv.Itoa(daemonPort))
+	server := &http.Server{Addr: addr, Handler: api, ReadHeaderTimeout: 10 * time.Second}
+
+	ctx := cmd.Context()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	console.Infof("Serving the Cog API at http://%s", addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("Failed to serve the API: %w", err)
+	}
+	return nil
+}
@@ -12,6 +12,8 @@ import (
 )
 
 var imageName string
+var debugStandalone bool
+var debugOutput string
 
 func newDebugCommand() *cobra.Command {
 	cmd := &cobra.Command{
@@ -26,6 +28,35 @@ func newDebugCommand() *cobra.Command {
 	addDockerfileFlag(cmd)
 	cmd.Flags().StringVarP(&imageName, "image-name", "", "", "The image name to use for the generated Dockerfile")
 
+	cmd.AddCommand(newDebugDockerfileCommand())
+	cmd.AddCommand(newDebugPlanCommand())
+
+	return cmd
+}
+
+func newDebugDockerfileCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "dockerfile",
+		Short: "Generate a Dockerfile from " + global.ConfigFilename,
+		Long: `Generate a Dockerfile from ` + global.ConfigFilename + `.
+
+With --standalone, write a build context directory with the Dockerfile, a copy of the
+project, and the files Cog generates for the build, so it can be built with plain
+'docker build' or audited without Cog.`,
+		Example: `  cog debug dockerfile
+  cog debug dockerfile --standalone -o build-context
+  docker build build-context`,
+		RunE: cmdDockerfile,
+		Args: cobra.NoArgs,
+	}
+
+	addSeparateWeightsFlag(cmd)
+	addUseCudaBaseImageFlag(cmd)
+	addDockerfileFlag(cmd)
+	cmd.Flags().StringVarP(&imageName, "image-name", "", "", "The image name to use for the generated Dockerfile")
+	cmd.Flags().BoolVar(&debugStandalone, "standalone", false, "Write a self-contained build context directory that can be built with plain 'docker build'")
+	cmd.Flags().StringVarP(&debugOutput, "output", "o", "cog-build-context", "Directory to write the standalone build context to")
+
 	return cmd
 }
 
@@ -47,6 +78,17 @@ func cmdDockerfile(cmd *cobra.Command, args []string) error {
 
 	generator.SetUseCudaBaseImage(buildUseCudaBaseImage)
 
+	if debugStandalone {
+		if buildSeparateWeights {
+			return fmt.Errorf("--standalone can't be used with --separate-weights")
+		}
+		if err := generator.WriteStandalone(debugOutput); err != nil {
+			return err
+		}
+		console.Infof("Wrote build context to %s. Build it with:\n    docker build %s", debugOutput, debugOutput)
+		return nil
+	}
+
 	if buildSeparateWeights {
 		if imageName == "" {
 			imageName = config.DockerImageName(projectDir)
@@ -0,0 +1,119 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/dockerfile"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var debugPlanJSON bool
+
+func newDebugPlanCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "plan",
+		Short: "Show what a build of the model is made from, without running Docker",
+		Long: `Show what a build of the model is made from, without running Docker: the base image,
+the Dockerfiles and their sections, the files the build reads, and which files are weights.
+
+With --json, the plan is written as JSON, so other tools can audit the build, or build the
+image themselves.`,
+		Example: `  cog debug plan
+  cog debug plan --json > plan.json`,
+		RunE: cmdDebugPlan,
+		Args: cobra.NoArgs,
+	}
+
+	addSeparateWeightsFlag(cmd)
+	addUseCudaBaseImageFlag(cmd)
+	addFormatFlag(cmd)
+	cmd.Flags().StringVarP(&imageName, "image-name", "", "", "The image name to use for the generated Dockerfile")
+	cmd.Flags().BoolVar(&debugPlanJSON, "json", false, "Write the plan as JSON")
+
+	return cmd
+}
+
+func cmdDebugPlan(cmd *cobra.Command, args []string) error {
+	cfg, projectDir, err := config.GetConfig(projectDirFlag)
+	if err != nil {
+		return err
+	}
+	if imageName == "" {
+		imageName = config.DockerImageName(projectDir)
+	}
+
+	generator, err := dockerfile.NewGenerator(cfg, projectDir)
+	if err != nil {
+		return fmt.Errorf("Error creating Dockerfile generator: %w", err)
+	}
+	defer func() {
+		if err := generator.Cleanup(); err != nil {
+			console.Warnf("Error cleaning up after build: %v", err)
+		}
+	}()
+	generator.SetUseCudaBaseImage(buildUseCudaBaseImage)
+	if err := generator.SetFormat(buildFormat); err != nil {
+		return err
+	}
+
+	plan, err := generator.Plan(imageName, buildSeparateWeights)
+	if err != nil {
+		return err
+	}
+
+	if debugPlanJSON {
+		data, err := json.MarshalIndent(plan, "", "  ")
+		if err != nil {
+			return fmt.Errorf("Failed to convert plan to JSON: %w", err)
+		}
+		console.Output(string(data))
+		return nil
+	}
+	console.Output(formatPlan(plan))
+	return nil
+}
+
+// formatPlan describes a plan for people to read
+func formatPlan(plan *dockerfile.Plan) string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Base image: %s\n", plan.BaseImage)
+	fmt.Fprintf(&buf, "Python: %s\n", plan.PythonVersion)
+	if plan.GPU {
+		fmt.Fprintf(&buf, "CUDA: %s, cuDNN: %s\n", plan.CUDA, plan.CuDNN)
+	}
+
+	for _, d := range plan.Dockerfiles {
+		fmt.Fprintf(&buf, "\nDockerfile for the %s image (sha256:%s):\n", d.Name, d.SHA256)
+		w := tabwriter.NewWriter(&buf, 0, 8, 3, ' ', 0)
+		fmt.Fprintln(w, "  SECTION\tINSTRUCTIONS\tSHA256")
+		for _, section := range d.Sections {
+			fmt.Fprintf(w, "  %s\t%d\t%s\n", section.Name, len(section.Instructions), section.SHA256[:12])
+		}
+		_ = w.Flush()
+	}
+
+	fmt.Fprintln(&buf, "\nInputs:")
+	for _, input := range plan.Inputs {
+		fmt.Fprintf(&buf, "  %s  %s\n", input.SHA256[:12], input.Path)
+	}
+
+	fmt.Fprintln(&buf, "\nWeights:")
+	weights := append(append([]string{}, plan.Weights.Dirs...), plan.Weights.Files...)
+	if len(weights) == 0 {
+		fmt.Fprintln(&buf, "  none")
+	}
+	for _, p := range weights {
+		fmt.Fprintf(&buf, "  %s\n", p)
+	}
+	if len(plan.Weights.Lazy) > 0 {
+		fmt.Fprintf(&buf, "  downloaded when the container starts: %s\n", strings.Join(plan.Weights.Lazy, ", "))
+	}
+	return strings.TrimRight(buf.String(), "\n")
+}
@@ -0,0 +1,135 @@
+package cli
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/demo"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/util/files"
+	"github.com/replicate/cog/pkg/util/slices"
+)
+
+var (
+	demoOutput string
+	demoImage  string
+)
+
+func newDemoCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "demo <" + strings.Join(demo.Frameworks, "|") + "> [IMAGE]",
+		Short: "Generate a Gradio or Streamlit demo of the model",
+		Long: `Generate a Gradio or Streamlit demo of the model.
+
+The demo is an app that runs predictions with the model's HTTP API, with
+components for its inputs and output that are inferred from its schema. It's
+written to the demo directory, with its requirements.txt, and a Dockerfile to
+bundle it with the model in an image, which --image builds.
+
+If 'image' is passed, it makes a demo of that Docker image, which must have
+been built by Cog. Otherwise, it builds the model in the current directory
+and makes a demo of that.`,
+		Example: `cog demo gradio
+cog demo streamlit --image hotdog-detector-demo`,
+		Args:      cobra.RangeArgs(1, 2),
+		ValidArgs: demo.Frameworks,
+		RunE:      interruptible(cmdDemo),
+	}
+	addSecretsFlag(cmd)
+	addNoCacheFlag(cmd)
+	addSchemaFlag(cmd)
+	addUseCudaBaseImageFlag(cmd)
+	addProxyFlags(cmd)
+	addBuildArgFlag(cmd)
+	addDockerfileFlag(cmd)
+	addBuildProgressOutputFlag(cmd)
+	cmd.Flags().StringVarP(&demoOutput, "output", "o", "demo", "Directory to write the demo to")
+	cmd.Flags().StringVar(&demoImage, "image", "", fmt.Sprintf("Also build an image with this name that runs the model and serves the demo on port %d", demo.Port))
+	return cmd
+}
+
+func cmdDemo(cmd *cobra.Command, args []string) error {
+	framework := args[0]
+	if !slices.ContainsString(demo.Frameworks, framework) {
+		return fmt.Errorf("Unknown framework '%s', it must be one of %s", framework, strings.Join(demo.Frameworks, ", "))
+	}
+	imageName := ""
+	title := ""
+	if len(args) > 1 {
+		imageName = args[1]
+		if err := pullIfMissing(imageName); err != nil {
+			return err
+		}
+		title = nameFromImage(imageName)
+	} else {
+		cfg, projectDir, err := config.GetConfig(projectDirFlag)
+		if err != nil {
+			return err
+		}
+		imageName = cfg.Image
+		if imageName == "" {
+			imageName = config.DockerImageName(projectDir)
+		}
+		title = filepath.Base(projectDir)
+		dockerBuildArgs, err := buildArgs(cfg)
+		if err != nil {
+			return err
+		}
+		if err := image.Build(cmd.Context(), cfg, projectDir, imageName, image.BuildOptions{
+			Secrets:          buildSecrets,
+			BuildArgs:        dockerBuildArgs,
+			NoCache:          buildNoCache,
+			UseCudaBaseImage: buildUseCudaBaseImage,
+			ProgressOutput:   buildProgressOutput,
+			SchemaFile:       buildSchemaFile,
+			DockerfileFile:   buildDockerfileFile,
+		}); err != nil {
+			return err
+		}
+	}
+
+	schema, err := image.GetOpenAPISchema(imageName)
+	if err != nil {
+		return err
+	}
+	opts, err := demo.NewOptions(framework, title, imageName, schema)
+	if err != nil {
+		return err
+	}
+	app := filepath.Join(demoOutput, "app.py")
+	exists, err := files.Exists(app)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("Found an existing %s.\nExiting without overwriting (to be on the safe side!) Pass another directory with --output", app)
+	}
+	if _, err := demo.Write(demoOutput, opts); err != nil {
+		return err
+	}
+	console.Infof("✅ Created a %s demo in %s", framework, demoOutput)
+
+	if demoImage == "" {
+		console.Infof("Start the model with 'docker run -p 5000:5000 %s', then run the demo with 'COG_URL=http://localhost:5000 %s'", imageName, runDemoCommand(framework))
+		return nil
+	}
+	console.Infof("\nBuilding %s, which bundles the demo with the model...", demoImage)
+	if err := docker.Build(cmd.Context(), demoOutput, demo.Dockerfile(opts), "", demoImage, nil, nil, buildNoCache, buildProgressOutput); err != nil {
+		return fmt.Errorf("Failed to build %s: %w", demoImage, err)
+	}
+	console.Infof("\nImage built as %s. Run it with 'docker run -p %d:%d %s', and open http://localhost:%d", demoImage, demo.Port, demo.Port, demoImage, demo.Port)
+	return nil
+}
+
+func runDemoCommand(framework string) string {
+	if framework == demo.FrameworkStreamlit {
+		return "streamlit run app.py"
+	}
+	return "python app.py"
+}
@@ -0,0 +1,21 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+)
+
+func newDeployCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "deploy",
+		Short: "Deploy the model in the current directory",
+	}
+
+	cmd.AddCommand(
+		newDeployKServeCommand(),
+		newDeployP2PCommand(),
+		newDeployReplicateCommand(),
+		newDeployTerraformCommand(),
+	)
+
+	return cmd
+}
@@ -0,0 +1,119 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/kube"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var (
+	deployKServeKind        string
+	deployKServeName        string
+	deployKServeNamespace   string
+	deployKServeMinReplicas int
+	deployKServeMaxReplicas int
+	deployKServeOutput      string
+)
+
+func newDeployKServeCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "kserve [IMAGE]",
+		Short: "Push the model and generate a KServe or Seldon manifest for it",
+		Long: `Push the model and generate a KServe or Seldon manifest for it.
+
+It builds and pushes the model in the current directory, then prints a
+KServe InferenceService (or a Seldon Core SeldonDeployment with
+--kind seldon) that runs the image. GPUs, concurrency, the prediction
+timeout and the shutdown grace period are taken from cog.yaml.
+
+Apply the manifest with kubectl to deploy the model.`,
+		Example:           `cog deploy kserve registry.example.com/hotdog-detector | kubectl apply -f -`,
+		RunE:              interruptible(cmdDeployKServe),
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeImages,
+	}
+	addSecretsFlag(cmd)
+	addNoCacheFlag(cmd)
+	addSeparateWeightsFlag(cmd)
+	addSchemaFlag(cmd)
+	addUseCudaBaseImageFlag(cmd)
+	addProxyFlags(cmd)
+	addBuildArgFlag(cmd)
+	addDockerfileFlag(cmd)
+	addBuildProgressOutputFlag(cmd)
+
+	cmd.Flags().StringVar(&deployKServeKind, "kind", kube.KindInferenceService, "Kind of manifest to generate: "+strings.Join(kube.Kinds, ", "))
+	cmd.Flags().StringVar(&deployKServeName, "name", "", "Name of the service. Defaults to the name of the image")
+	cmd.Flags().StringVarP(&deployKServeNamespace, "namespace", "n", "", "Namespace to deploy to")
+	cmd.Flags().IntVar(&deployKServeMinReplicas, "min-replicas", -1, "Minimum number of replicas")
+	cmd.Flags().IntVar(&deployKServeMaxReplicas, "max-replicas", -1, "Maximum number of replicas")
+	cmd.Flags().StringVarP(&deployKServeOutput, "output", "o", "", "Write the manifest to this file instead of stdout")
+
+	return cmd
+}
+
+func cmdDeployKServe(cmd *cobra.Command, args []string) error {
+	cfg, projectDir, err := config.GetConfig(projectDirFlag)
+	if err != nil {
+		return err
+	}
+
+	imageName := cfg.Image
+	if len(args) > 0 {
+		imageName = args[0]
+	}
+	if imageName == "" {
+		return fmt.Errorf("To deploy to Kubernetes, you must either set the 'image' option in cog.yaml or pass an image name as an argument. For example, 'cog deploy kserve registry.example.com/hotdog-detector'")
+	}
+
+	name := deployKServeName
+	if name == "" {
+		name = nameFromImage(imageName)
+	}
+	opts := kube.OptionsFromConfig(cfg, name, imageName)
+	opts.Namespace = deployKServeNamespace
+	if deployKServeMinReplicas >= 0 {
+		opts.MinReplicas = &deployKServeMinReplicas
+	}
+	if deployKServeMaxReplicas >= 0 {
+		opts.MaxReplicas = &deployKServeMaxReplicas
+	}
+
+	// Check the kind before spending time on a build
+	manifest, err := kube.Manifest(deployKServeKind, opts)
+	if err != nil {
+		return err
+	}
+
+	if err := buildAndPush(cmd.Context(), cfg, projectDir, imageName); err != nil {
+		return err
+	}
+
+	if deployKServeOutput == "" {
+		_, err = os.Stdout.Write(manifest)
+		return err
+	}
+	if err := os.WriteFile(deployKServeOutput, manifest, 0o644); err != nil {
+		return fmt.Errorf("Failed to write manifest: %w", err)
+	}
+	console.Infof("\nWrote manifest to %s. Deploy it with:\n    kubectl apply -f %s", deployKServeOutput, deployKServeOutput)
+	return nil
+}
+
+// nameFromImage returns a name for the model from the name of an image, without its registry
+// or tag, that can be used as the name of a Kubernetes resource
+func nameFromImage(imageName string) string {
+	name := path.Base(imageName)
+	if i := strings.LastIndex(name, ":"); i != -1 {
+		name = name[:i]
+	}
+	name = strings.ToLower(strings.NewReplacer("_", "-", ".", "-").Replace(name))
+	return strings.Trim(name, "-")
+}
@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/p2p"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var (
+	deployP2PSystem     string
+	deployP2PPreheatURL string
+	deployP2POutput     string
+)
+
+func newDeployP2PCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "p2p [IMAGE]",
+		Short: "Push the model and generate configuration to share its layers between nodes with P2P",
+		Long: `Push the model and generate configuration to share its layers between nodes with P2P.
+
+It builds and pushes the model in the current directory, then prints the
+Helm values that configure Spegel, or Dragonfly with --system dragonfly,
+to share the layers of images from the model's registry between the nodes
+of a cluster. Nodes then pull large weights layers from each other rather
+than from the registry.
+
+The weights are built in separate layers, as if you had passed
+--separate-weights, so they are only distributed again when they change.
+
+With --preheat-url, it also asks the Dragonfly manager to distribute the
+image to the cluster's peers before any node pulls it.`,
+		Example: `cog deploy p2p registry.example.com/hotdog-detector > spegel-values.yaml
+helm upgrade --install spegel oci://ghcr.io/spegel-org/helm-charts/spegel -f spegel-values.yaml`,
+		RunE:              interruptible(cmdDeployP2P),
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeImages,
+	}
+	addSecretsFlag(cmd)
+	addNoCacheFlag(cmd)
+	addSeparateWeightsFlag(cmd)
+	addSchemaFlag(cmd)
+	addUseCudaBaseImageFlag(cmd)
+	addProxyFlags(cmd)
+	addBuildArgFlag(cmd)
+	addDockerfileFlag(cmd)
+	addBuildProgressOutputFlag(cmd)
+
+	cmd.Flags().StringVar(&deployP2PSystem, "system", p2p.SystemSpegel, "P2P system to generate configuration for: "+strings.Join(p2p.Systems, ", "))
+	cmd.Flags().StringVar(&deployP2PPreheatURL, "preheat-url", "", "URL of a Dragonfly manager to preheat the image with, e.g. http://dragonfly-manager:8080")
+	cmd.Flags().StringVarP(&deployP2POutput, "output", "o", "", "Write the Helm values to this file instead of stdout")
+
+	return cmd
+}
+
+func cmdDeployP2P(cmd *cobra.Command, args []string) error {
+	cfg, projectDir, err := config.GetConfig(projectDirFlag)
+	if err != nil {
+		return err
+	}
+
+	imageName := cfg.Image
+	if len(args) > 0 {
+		imageName = args[0]
+	}
+	if imageName == "" {
+		return fmt.Errorf("To deploy with P2P, you must either set the 'image' option in cog.yaml or pass an image name as an argument. For example, 'cog deploy p2p registry.example.com/hotdog-detector'")
+	}
+	if deployP2PPreheatURL != "" && deployP2PSystem != p2p.SystemDragonfly {
+		return fmt.Errorf("--preheat-url only works with --system %s", p2p.SystemDragonfly)
+	}
+
+	// Check the system before spending time on a build
+	values, err := p2p.HelmValues(deployP2PSystem, []string{imageName})
+	if err != nil {
+		return err
+	}
+
+	if !cmd.Flags().Changed("separate-weights") {
+		buildSeparateWeights = true
+	}
+	if err := buildAndPush(cmd.Context(), cfg, projectDir, imageName); err != nil {
+		return err
+	}
+
+	if deployP2PPreheatURL != "" {
+		console.Infof("\nPreheating %s with Dragonfly...", imageName)
+		if err := p2p.Preheat(deployP2PPreheatURL, imageName); err != nil {
+			return err
+		}
+	}
+
+	if deployP2POutput == "" {
+		_, err = os.Stdout.Write(values)
+		return err
+	}
+	if err := os.WriteFile(deployP2POutput, values, 0o644); err != nil {
+		return fmt.Errorf("Failed to write Helm values: %w", err)
+	}
+	console.Infof("\nWrote Helm values for %s to %s", deployP2PSystem, deployP2POutput)
+	return nil
+}
@@ -0,0 +1,145 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/replicate"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var (
+	deployReplicateDeployment   string
+	deployReplicateHardware     string
+	deployReplicateVisibility   string
+	deployReplicateMinInstances int
+	deployReplicateMaxInstances int
+)
+
+func newDeployReplicateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "replicate [IMAGE]",
+		Short: "Push the model to Replicate and deploy the new version",
+		Long: `Push the model to Replicate and deploy the new version.
+
+It builds and pushes the model in the current directory, creating the model
+on Replicate if it doesn't exist yet, and prints the ID of the new version.
+With --deployment, it also creates or updates that deployment to run the
+new version.
+
+The Replicate API token is read from the ` + replicate.TokenEnvVar + ` environment variable.`,
+		Example:           `cog deploy replicate r8.im/your-username/hotdog-detector --deployment hotdog-detector`,
+		RunE:              interruptible(cmdDeployReplicate),
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeImages,
+	}
+	addSecretsFlag(cmd)
+	addNoCacheFlag(cmd)
+	addSeparateWeightsFlag(cmd)
+	addSchemaFlag(cmd)
+	addUseCudaBaseImageFlag(cmd)
+	addProxyFlags(cmd)
+	addBuildArgFlag(cmd)
+	addDockerfileFlag(cmd)
+	addBuildProgressOutputFlag(cmd)
+
+	cmd.Flags().StringVar(&deployReplicateDeployment, "deployment", "", "Name of the deployment to create or update with the new version")
+	cmd.Flags().StringVar(&deployReplicateHardware, "hardware", "", "Hardware SKU to run on, e.g. gpu-a40-large. Required when creating a model or deployment")
+	cmd.Flags().StringVar(&deployReplicateVisibility, "visibility", "private", "Visibility of the model if it is created: public or private")
+	cmd.Flags().IntVar(&deployReplicateMinInstances, "min-instances", -1, "Minimum number of instances of the deployment")
+	cmd.Flags().IntVar(&deployReplicateMaxInstances, "max-instances", -1, "Maximum number of instances of the deployment")
+
+	return cmd
+}
+
+func cmdDeployReplicate(cmd *cobra.Command, args []string) error {
+	cfg, projectDir, err := config.GetConfig(projectDirFlag)
+	if err != nil {
+		return err
+	}
+
+	imageName := cfg.Image
+	if len(args) > 0 {
+		imageName = args[0]
+	}
+	if imageName == "" {
+		return fmt.Errorf("To deploy to Replicate, you must either set the 'image' option in cog.yaml or pass an image name as an argument. For example, 'cog deploy replicate %s/your-username/hotdog-detector'", global.ReplicateRegistryHost)
+	}
+	owner, name, err := replicate.ParseImageName(imageName)
+	if err != nil {
+		return err
+	}
+
+	client, err := replicate.NewClientFromEnv()
+	if err != nil {
+		return err
+	}
+
+	// Check everything we can before spending time on a build
+	if _, err := client.GetModel(owner, name); errors.Is(err, replicate.ErrNotFound) {
+		if deployReplicateHardware == "" {
+			return fmt.Errorf("Model %s/%s doesn't exist on Replicate. Pass --hardware to create it", owner, name)
+		}
+		console.Infof("Creating %s model %s/%s...", deployReplicateVisibility, owner, name)
+		if _, err := client.CreateModel(owner, name, deployReplicateVisibility, deployReplicateHardware); err != nil {
+			return fmt.Errorf("Failed to create model: %w", err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("Failed to get model: %w", err)
+	}
+
+	var deployment *replicate.Deployment
+	if deployReplicateDeployment != "" {
+		deployment, err = client.GetDeployment(owner, deployReplicateDeployment)
+		if errors.Is(err, replicate.ErrNotFound) {
+			deployment = nil
+			if deployReplicateHardware == "" {
+				return fmt.Errorf("Deployment %s/%s doesn't exist. Pass --hardware to create it", owner, deployReplicateDeployment)
+			}
+		} else if err != nil {
+			return fmt.Errorf("Failed to get deployment: %w", err)
+		}
+	}
+
+	if err := buildAndPush(cmd.Context(), cfg, projectDir, imageName); err != nil {
+		return err
+	}
+
+	version, err := client.LatestVersion(owner, name)
+	if err != nil {
+		return fmt.Errorf("Failed to get the version that was pushed: %w", err)
+	}
+	console.Infof("\nCreated version %s", version.ID)
+	console.Infof("    https://%s/%s/%s/versions/%s", global.ReplicateWebsiteHost, owner, name, version.ID)
+
+	if deployReplicateDeployment == "" {
+		return nil
+	}
+
+	configuration := replicate.DeploymentConfiguration{Hardware: deployReplicateHardware}
+	if deployReplicateMinInstances >= 0 {
+		configuration.MinInstances = &deployReplicateMinInstances
+	}
+	if deployReplicateMaxInstances >= 0 {
+		configuration.MaxInstances = &deployReplicateMaxInstances
+	}
+
+	if deployment == nil {
+		console.Infof("\nCreating deployment %s/%s...", owner, deployReplicateDeployment)
+		deployment, err = client.CreateDeployment(deployReplicateDeployment, owner+"/"+name, version.ID, configuration)
+	} else {
+		console.Infof("\nUpdating deployment %s/%s...", owner, deployReplicateDeployment)
+		deployment, err = client.UpdateDeployment(owner, deployReplicateDeployment, version.ID, configuration)
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to deploy version %s: %w", version.ID, err)
+	}
+
+	console.Infof("Deployment %s/%s is running version %s (release %d)", deployment.Owner, deployment.Name, deployment.CurrentRelease.Version, deployment.CurrentRelease.Number)
+	console.Infof("    https://%s/deployments/%s/%s", global.ReplicateWebsiteHost, deployment.Owner, deployment.Name)
+	return nil
+}
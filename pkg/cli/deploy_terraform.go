@@ -0,0 +1,99 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/terraform"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var (
+	deployTerraformProvider string
+	deployTerraformName     string
+	deployTerraformOutput   string
+)
+
+func newDeployTerraformCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "terraform [IMAGE]",
+		Short: "Push the model and generate Terraform configuration that runs it on AWS or Google Cloud",
+		Long: `Push the model and generate Terraform configuration that runs it on AWS or Google Cloud.
+
+It builds and pushes the model in the current directory, then prints
+Terraform configuration that runs the image:
+
+- aws: on Amazon ECS, with Fargate, or with an autoscaling group of GPU
+  instances if the model needs a GPU
+- gcp: on Cloud Run, or on a GKE cluster with a GPU node pool if the model
+  needs a GPU
+
+The vCPUs, memory and GPUs each replica gets, concurrency, the prediction
+timeout and the shutdown grace period are taken from cog.yaml. Sizes are
+Terraform variables, so they can be changed without editing the file.`,
+		Example:           `cog deploy terraform --provider aws -o main.tf 123456789012.dkr.ecr.us-east-1.amazonaws.com/hotdog-detector`,
+		RunE:              interruptible(cmdDeployTerraform),
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeImages,
+	}
+	addSecretsFlag(cmd)
+	addNoCacheFlag(cmd)
+	addSeparateWeightsFlag(cmd)
+	addSchemaFlag(cmd)
+	addUseCudaBaseImageFlag(cmd)
+	addProxyFlags(cmd)
+	addBuildArgFlag(cmd)
+	addDockerfileFlag(cmd)
+	addBuildProgressOutputFlag(cmd)
+
+	cmd.Flags().StringVar(&deployTerraformProvider, "provider", "", "Cloud provider to run the model on: "+strings.Join(terraform.Providers, ", "))
+	cmd.Flags().StringVar(&deployTerraformName, "name", "", "Name of the resources. Defaults to the name of the image")
+	cmd.Flags().StringVarP(&deployTerraformOutput, "output", "o", "", "Write the configuration to this file instead of stdout")
+	_ = cmd.MarkFlagRequired("provider")
+	_ = cmd.RegisterFlagCompletionFunc("provider", cobra.FixedCompletions(terraform.Providers, cobra.ShellCompDirectiveNoFileComp))
+
+	return cmd
+}
+
+func cmdDeployTerraform(cmd *cobra.Command, args []string) error {
+	cfg, projectDir, err := config.GetConfig(projectDirFlag)
+	if err != nil {
+		return err
+	}
+
+	imageName := cfg.Image
+	if len(args) > 0 {
+		imageName = args[0]
+	}
+	if imageName == "" {
+		return fmt.Errorf("To generate Terraform configuration, you must either set the 'image' option in cog.yaml or pass an image name as an argument. For example, 'cog deploy terraform --provider aws 123456789012.dkr.ecr.us-east-1.amazonaws.com/hotdog-detector'")
+	}
+
+	name := deployTerraformName
+	if name == "" {
+		name = nameFromImage(imageName)
+	}
+	// Check the provider before spending time on a build
+	configuration, err := terraform.Generate(deployTerraformProvider, terraform.OptionsFromConfig(cfg, name, imageName))
+	if err != nil {
+		return err
+	}
+
+	if err := buildAndPush(cmd.Context(), cfg, projectDir, imageName); err != nil {
+		return err
+	}
+
+	if deployTerraformOutput == "" {
+		_, err = os.Stdout.Write(configuration)
+		return err
+	}
+	if err := os.WriteFile(deployTerraformOutput, configuration, 0o644); err != nil {
+		return fmt.Errorf("Failed to write Terraform configuration: %w", err)
+	}
+	console.Infof("\nWrote Terraform configuration to %s. Deploy it with:\n    terraform init && terraform apply", deployTerraformOutput)
+	return nil
+}
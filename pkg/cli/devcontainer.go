@@ -0,0 +1,90 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/util/files"
+)
+
+// devcontainerPath is where the dev container configuration is, relative to the project directory
+var devcontainerPath = filepath.Join(".devcontainer", "devcontainer.json")
+
+// devcontainer is a devcontainer.json, as described at https://containers.dev/implementors/json_reference/
+type devcontainer struct {
+	Name             string                 `json:"name"`
+	Image            string                 `json:"image"`
+	WorkspaceMount   string                 `json:"workspaceMount"`
+	WorkspaceFolder  string                 `json:"workspaceFolder"`
+	RunArgs          []string               `json:"runArgs,omitempty"`
+	HostRequirements map[string]interface{} `json:"hostRequirements,omitempty"`
+	ForwardPorts     []int                  `json:"forwardPorts,omitempty"`
+	Customizations   map[string]interface{} `json:"customizations,omitempty"`
+}
+
+func initDevcontainerCommand(ctx context.Context) error {
+	cfg, projectDir, err := config.GetConfig(projectDirFlag)
+	if err != nil {
+		return err
+	}
+	p := filepath.Join(projectDir, devcontainerPath)
+	exists, err := files.Exists(p)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("Found an existing %s.\nExiting without overwriting (to be on the safe side!)", devcontainerPath)
+	}
+
+	dockerBuildArgs, err := buildArgs(cfg)
+	if err != nil {
+		return err
+	}
+	imageName, err := image.BuildBase(ctx, cfg, projectDir, dockerBuildArgs, buildUseCudaBaseImage, buildProgressOutput)
+	if err != nil {
+		return err
+	}
+
+	contents, err := json.MarshalIndent(newDevcontainer(cfg, projectDir, imageName), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return fmt.Errorf("Error creating %s: %w", filepath.Dir(p), err)
+	}
+	if err := os.WriteFile(p, append(contents, '\n'), 0o644); err != nil {
+		return fmt.Errorf("Error writing %s: %w", p, err)
+	}
+	console.Infof("✅ Created %s", p)
+	console.Info("\nOpen the project in VS Code and run 'Dev Containers: Reopen in Container' to work in the model's environment. After you change cog.yaml, 'cog run' and 'cog predict' rebuild the image, then run 'Dev Containers: Rebuild Container'.")
+	return nil
+}
+
+// newDevcontainer returns a dev container that runs imageName, the base image of the project in projectDir, the same
+// way `cog run` does: with the project mounted at /src, and with the GPUs if the model uses them
+func newDevcontainer(cfg *config.Config, projectDir string, imageName string) devcontainer {
+	d := devcontainer{
+		Name:            filepath.Base(projectDir),
+		Image:           imageName,
+		WorkspaceMount:  "source=${localWorkspaceFolder},target=/src,type=bind",
+		WorkspaceFolder: "/src",
+		// The port `python -m cog.server.http` listens on
+		ForwardPorts: []int{5000},
+		Customizations: map[string]interface{}{
+			"vscode": map[string]interface{}{
+				"extensions": []string{"ms-python.python"},
+			},
+		},
+	}
+	if cfg.Build.GPU {
+		d.RunArgs = []string{"--gpus=all"}
+		d.HostRequirements = map[string]interface{}{"gpu": true}
+	}
+	return d
+}
@@ -0,0 +1,24 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+func TestNewDevcontainer(t *testing.T) {
+	cfg := &config.Config{Build: &config.Build{GPU: false}}
+	d := newDevcontainer(cfg, "/src/my-model", "cog-my-model-base")
+	require.Equal(t, "my-model", d.Name)
+	require.Equal(t, "cog-my-model-base", d.Image)
+	require.Equal(t, "/src", d.WorkspaceFolder)
+	require.Empty(t, d.RunArgs)
+	require.Empty(t, d.HostRequirements)
+
+	cfg.Build.GPU = true
+	d = newDevcontainer(cfg, "/src/my-model", "cog-my-model-base")
+	require.Equal(t, []string{"--gpus=all"}, d.RunArgs)
+	require.Equal(t, map[string]interface{}{"gpu": true}, d.HostRequirements)
+}
@@ -0,0 +1,18 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+)
+
+func newExportCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export the model to run on other inference servers",
+	}
+
+	cmd.AddCommand(
+		newExportTritonCommand(),
+	)
+
+	return cmd
+}
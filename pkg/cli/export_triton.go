@@ -0,0 +1,116 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/triton"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var (
+	exportTritonOutput string
+	exportTritonName   string
+)
+
+func newExportTritonCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "triton [IMAGE]",
+		Short: "Export the model as a Triton Inference Server model repository",
+		Long: `Export the model as a Triton Inference Server model repository.
+
+If 'image' is passed, it exports that Docker image, which must have been
+built by Cog. Otherwise, it builds the model in the current directory and
+exports that.
+
+The model repository has a Python backend that runs the predictor, with the
+model's source code and weights copied from the image. Each input is a
+single value, and the output is the prediction's output encoded as JSON.
+Triton's Python environment must have cog and the model's Python packages
+installed.`,
+		Example:           `cog export triton -o model_repository`,
+		RunE:              interruptible(cmdExportTriton),
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeImages,
+	}
+	addSecretsFlag(cmd)
+	addNoCacheFlag(cmd)
+	addSchemaFlag(cmd)
+	addUseCudaBaseImageFlag(cmd)
+	addProxyFlags(cmd)
+	addBuildArgFlag(cmd)
+	addDockerfileFlag(cmd)
+	addBuildProgressOutputFlag(cmd)
+
+	cmd.Flags().StringVarP(&exportTritonOutput, "output", "o", "model_repository", "Directory of the model repository to export the model to")
+	cmd.Flags().StringVar(&exportTritonName, "name", "", "Name of the model in the repository. Defaults to the name of the image")
+
+	return cmd
+}
+
+func cmdExportTriton(cmd *cobra.Command, args []string) error {
+	imageName := ""
+	if len(args) > 0 {
+		imageName = args[0]
+	} else {
+		cfg, projectDir, err := config.GetConfig(projectDirFlag)
+		if err != nil {
+			return err
+		}
+		imageName = cfg.Image
+		if imageName == "" {
+			imageName = config.DockerImageName(projectDir)
+		}
+		dockerBuildArgs, err := buildArgs(cfg)
+		if err != nil {
+			return err
+		}
+		if err := image.Build(cmd.Context(), cfg, projectDir, imageName, image.BuildOptions{
+			Secrets:          buildSecrets,
+			BuildArgs:        dockerBuildArgs,
+			NoCache:          buildNoCache,
+			UseCudaBaseImage: buildUseCudaBaseImage,
+			ProgressOutput:   buildProgressOutput,
+			SchemaFile:       buildSchemaFile,
+			DockerfileFile:   buildDockerfileFile,
+		}); err != nil {
+			return err
+		}
+	}
+
+	conf, err := image.GetConfig(imageName)
+	if err != nil {
+		return err
+	}
+	schema, err := image.GetOpenAPISchema(imageName)
+	if err != nil {
+		return err
+	}
+
+	name := exportTritonName
+	if name == "" {
+		name = nameFromImage(imageName)
+	}
+	modelDir := triton.ModelDir(exportTritonOutput, name)
+	if _, err := os.Stat(modelDir); err == nil {
+		return fmt.Errorf("%s already exists. Remove it, or pass --name to export the model with a different name", modelDir)
+	}
+
+	console.Infof("Exporting %s to %s...", imageName, modelDir)
+	if err := triton.WriteModel(exportTritonOutput, name, schema, conf.Build.GPU); err != nil {
+		return err
+	}
+	srcDir := filepath.Join(modelDir, triton.ModelVersion, triton.SourceDir)
+	if err := docker.CopyFromImage(imageName, "/src", srcDir); err != nil {
+		return err
+	}
+
+	console.Infof("\nExported model %s. Serve it with:\n    tritonserver --model-repository=%s", name, exportTritonOutput)
+	return nil
+}
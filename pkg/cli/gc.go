@@ -0,0 +1,92 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/docker/go-units"
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var gcDryRun bool
+
+func newGCCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "gc",
+		Short: "Remove old images built by Cog",
+		Long: `Remove old images built by Cog.
+
+Each build of a model takes the image's name from the build before it, which
+is left behind without a name. This removes those images. Layers that are
+shared with other images are kept.`,
+		Example: `cog gc --dry-run
+cog gc --output-format json | jq .reclaimed_bytes`,
+		RunE: cmdGC,
+		Args: cobra.NoArgs,
+	}
+	cmd.Flags().BoolVar(&gcDryRun, "dry-run", false, "Show the images that would be removed, without removing them")
+	addOutputFormatFlag(cmd)
+	return cmd
+}
+
+// gcResult is what `cog gc --output-format json` prints
+type gcResult struct {
+	// Removed are the IDs of the images that were removed, or would be with --dry-run
+	Removed []string `json:"removed"`
+	// ReclaimedBytes is the total size of the removed images. Layers they shared with other images aren't freed,
+	// so the disk space reclaimed can be less.
+	ReclaimedBytes int64 `json:"reclaimed_bytes"`
+	DryRun         bool  `json:"dry_run"`
+}
+
+func cmdGC(cmd *cobra.Command, args []string) error {
+	if err := checkOutputFormat(); err != nil {
+		return err
+	}
+	ids, err := docker.ListDanglingImages(map[string]string{global.LabelNamespace + "version": ""})
+	if err != nil {
+		return fmt.Errorf("Failed to list images: %w", err)
+	}
+
+	result := gcResult{Removed: []string{}, DryRun: gcDryRun}
+	for _, id := range ids {
+		inspect, err := docker.ImageInspect(id)
+		if err != nil {
+			return fmt.Errorf("Failed to inspect %s: %w", id, err)
+		}
+		if gcDryRun {
+			console.Infof("Would remove %s (%s)", shortImageID(id), units.HumanSize(float64(inspect.Size)))
+		} else {
+			if err := docker.RemoveImage(id); err != nil {
+				// Images that are used by containers can't be removed, and are left for the next time
+				console.Warnf("%s", err)
+				continue
+			}
+			console.Infof("Removed %s (%s)", shortImageID(id), units.HumanSize(float64(inspect.Size)))
+		}
+		result.Removed = append(result.Removed, id)
+		result.ReclaimedBytes += inspect.Size
+	}
+
+	if jsonOutput() {
+		return printJSON(result)
+	}
+	switch {
+	case len(result.Removed) == 0:
+		console.Info("There are no old images to remove")
+	case gcDryRun:
+		console.Infof("Would remove %d images, up to %s", len(result.Removed), units.HumanSize(float64(result.ReclaimedBytes)))
+	default:
+		console.Infof("Removed %d images, up to %s", len(result.Removed), units.HumanSize(float64(result.ReclaimedBytes)))
+	}
+	return nil
+}
+
+// shortImageID returns the abbreviated form of an image ID that `docker images` shows
+func shortImageID(id string) string {
+	return shortContainerID(strings.TrimPrefix(id, "sha256:"))
+}
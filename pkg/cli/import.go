@@ -0,0 +1,98 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/importer"
+	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/util/files"
+)
+
+var importSource string
+
+func newImportCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import [PATH]",
+		Short: "Create a cog.yaml and predict.py from a BentoML, MLflow or Dockerfile project",
+		Long: `Create a cog.yaml and predict.py in the current directory from a project packaged with another tool.
+
+PATH is the directory with the project's bentofile.yaml, MLflow MLmodel, or Dockerfile
+and requirements.txt. It defaults to the current directory, and must be inside it.`,
+		Example: `  cog import
+  cog import mlruns/0/8a6f2c/artifacts/model`,
+		RunE: importCommand,
+		Args: cobra.MaximumNArgs(1),
+	}
+	cmd.Flags().StringVar(&importSource, "from", "", "What to import from: "+strings.Join(importer.Sources, ", ")+". Detected from the files in PATH by default")
+	return cmd
+}
+
+func importCommand(cmd *cobra.Command, args []string) error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	dir := cwd
+	if len(args) > 0 {
+		if dir, err = filepath.Abs(args[0]); err != nil {
+			return err
+		}
+	}
+	relDir, err := filepath.Rel(cwd, dir)
+	if err != nil || relDir == ".." || strings.HasPrefix(relDir, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%s must be inside the current directory, so it can be copied into the image", dir)
+	}
+
+	source := importSource
+	if source == "" {
+		if source, err = importer.Detect(dir); err != nil {
+			return err
+		}
+	}
+	project, err := importer.Import(source, dir, filepath.ToSlash(relDir))
+	if err != nil {
+		return err
+	}
+
+	cogYAML, err := project.CogYAML()
+	if err != nil {
+		return err
+	}
+	predictPy, err := project.PredictPy()
+	if err != nil {
+		return err
+	}
+
+	console.Infof("\nImporting %s project from %s...\n", project.Source, dir)
+	for _, file := range []struct {
+		name    string
+		content []byte
+	}{{"cog.yaml", cogYAML}, {"predict.py", predictPy}} {
+		filePath := filepath.Join(cwd, file.name)
+		exists, err := files.Exists(filePath)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return fmt.Errorf("Found an existing %s.\nExiting without overwriting (to be on the safe side!)", file.name)
+		}
+		if err := os.WriteFile(filePath, file.content, 0o644); err != nil {
+			return fmt.Errorf("Error writing %s: %w", filePath, err)
+		}
+		console.Infof("✅ Created %s", filePath)
+	}
+
+	if len(project.Notes) > 0 {
+		console.Infof("\nSome things couldn't be imported automatically. They are marked as TODOs in cog.yaml:")
+		for _, note := range project.Notes {
+			console.Infof("  - %s", note)
+		}
+	}
+	console.Infof("\nFinish the Predictor in predict.py, then run 'cog predict' to try it out.")
+	return nil
+}
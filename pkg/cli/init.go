@@ -22,17 +22,35 @@ var cogYamlContent []byte
 //go:embed init-templates/predict.py
 var predictPyContent []byte
 
+var (
+	initDevcontainer bool
+	initInteractive  bool
+)
+
 func newInitCommand() *cobra.Command {
 	var cmd = &cobra.Command{
 		Use:        "init",
 		SuggestFor: []string{"new", "start"},
 		Short:      "Configure your project for use with Cog",
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if initDevcontainer {
+				return initDevcontainerCommand(cmd.Context())
+			}
+			if initInteractive {
+				return initInteractiveCommand()
+			}
 			return initCommand(args)
 		},
 		Args: cobra.MaximumNArgs(0),
 	}
 
+	addUseCudaBaseImageFlag(cmd)
+	addProxyFlags(cmd)
+	addBuildArgFlag(cmd)
+	addBuildProgressOutputFlag(cmd)
+	cmd.Flags().BoolVarP(&initInteractive, "interactive", "i", false, "Ask about the model's framework, GPU, Python version and weights, and generate cog.yaml, predict.py, tests and an example for it")
+	cmd.Flags().BoolVar(&initDevcontainer, "devcontainer", false, "Build the model's environment and write a .devcontainer/devcontainer.json that opens it in VS Code or GitHub Codespaces")
+
 	return cmd
 }
 
@@ -0,0 +1,256 @@
+package cli
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/util/files"
+)
+
+//go:embed init-templates/interactive
+var interactiveTemplates embed.FS
+
+const (
+	frameworkPyTorch      = "pytorch"
+	frameworkTensorFlow   = "tensorflow"
+	frameworkTransformers = "transformers"
+	frameworkDiffusers    = "diffusers"
+	frameworkNone         = "none"
+
+	modelSourceHuggingFace = "huggingface"
+	modelSourceLocal       = "local"
+	modelSourceNone        = "none"
+)
+
+var frameworks = []string{frameworkPyTorch, frameworkTensorFlow, frameworkTransformers, frameworkDiffusers, frameworkNone}
+
+// frameworkPackages are the Python packages each framework needs
+var frameworkPackages = map[string][]string{
+	frameworkPyTorch:      {"torch==2.5.1", "torchvision==0.20.1"},
+	frameworkTensorFlow:   {"tensorflow==2.15.0"},
+	frameworkTransformers: {"torch==2.5.1", "transformers==4.46.3", "accelerate==1.1.1"},
+	frameworkDiffusers:    {"torch==2.5.1", "diffusers==0.31.0", "transformers==4.46.3", "accelerate==1.1.1"},
+}
+
+// defaultHuggingFaceModels are suggested for frameworks that load models by name
+var defaultHuggingFaceModels = map[string]string{
+	frameworkTransformers: "openai-community/gpt2",
+	frameworkDiffusers:    "stabilityai/sdxl-turbo",
+}
+
+// commentedPythonPackages is the example python_packages in the cog.yaml template, which is replaced by the real
+// ones so they end up under the comment that explains them
+var commentedPythonPackages = regexp.MustCompile(`(?m)^  # python_packages:\n(  #   - .*\n)*`)
+
+// huggingFaceHubPackage downloads models from Hugging Face for frameworks that can't do it themselves
+const huggingFaceHubPackage = "huggingface_hub==0.26.2"
+
+// scaffoldAnswers are the answers to the questions `cog init --interactive` asks
+type scaffoldAnswers struct {
+	Framework     string
+	GPU           bool
+	PythonVersion string
+	// ModelSource is where the weights come from: a Hugging Face repository, a local checkpoint, or nowhere yet
+	ModelSource string
+	// ModelPath is the Hugging Face repository or the path to the checkpoint
+	ModelPath string
+}
+
+func initInteractiveCommand() error {
+	if !console.IsTerminal() {
+		return fmt.Errorf("--interactive asks questions, so it needs to be run in a terminal. Run 'cog init' to generate a template instead")
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	console.Infof("\nSetting up the current directory for use with Cog...\n")
+
+	answers, err := askScaffoldQuestions()
+	if err != nil {
+		return err
+	}
+	if answers.ModelSource == modelSourceLocal {
+		if rel, err := filepath.Rel(cwd, answers.ModelPath); err != nil || strings.HasPrefix(rel, "..") {
+			console.Warnf("%s is outside this directory, so it won't be in the image. Move it into the directory and change the path in predict.py", answers.ModelPath)
+		}
+	}
+	scaffold, err := scaffoldFiles(answers)
+	if err != nil {
+		return err
+	}
+	return writeScaffold(cwd, scaffold)
+}
+
+func askScaffoldQuestions() (scaffoldAnswers, error) {
+	answers := scaffoldAnswers{}
+	var err error
+	if answers.Framework, err = (console.Interactive{Prompt: "Framework", Default: frameworkPyTorch, Options: frameworks, Required: true}).Read(); err != nil {
+		return answers, err
+	}
+	if answers.GPU, err = (console.InteractiveBool{Prompt: "Does the model need a GPU?", Default: answers.Framework == frameworkDiffusers, NonDefaultFlag: "cog init"}).Read(); err != nil {
+		return answers, err
+	}
+	if answers.PythonVersion, err = (console.Interactive{Prompt: "Python version", Default: "3.11", Required: true}).Read(); err != nil {
+		return answers, err
+	}
+
+	if answers.Framework == frameworkNone {
+		answers.ModelSource = modelSourceNone
+		return answers, nil
+	}
+	sources := []string{modelSourceHuggingFace, modelSourceLocal, modelSourceNone}
+	defaultSource := modelSourceNone
+	if _, ok := defaultHuggingFaceModels[answers.Framework]; ok {
+		// These load models by name, so there has to be one
+		sources = sources[:2]
+		defaultSource = modelSourceHuggingFace
+	}
+	if answers.ModelSource, err = (console.Interactive{Prompt: "Where are the model's weights", Default: defaultSource, Options: sources, Required: true}).Read(); err != nil {
+		return answers, err
+	}
+	switch answers.ModelSource {
+	case modelSourceHuggingFace:
+		answers.ModelPath, err = (console.Interactive{Prompt: "Hugging Face repository, e.g. org/model", Default: defaultHuggingFaceModels[answers.Framework], Required: true}).Read()
+	case modelSourceLocal:
+		answers.ModelPath, err = (console.Interactive{Prompt: "Path to the checkpoint, in this directory", Required: true}).Read()
+	}
+	return answers, err
+}
+
+// scaffoldFiles returns the files to generate for answers, by path
+func scaffoldFiles(answers scaffoldAnswers) (map[string][]byte, error) {
+	cogYAML, err := scaffoldConfig(answers)
+	if err != nil {
+		return nil, err
+	}
+
+	predictPy := predictPyContent
+	if answers.Framework != frameworkNone {
+		if predictPy, err = renderInteractiveTemplate("predict_"+answers.Framework+".py.tmpl", answers); err != nil {
+			return nil, err
+		}
+	}
+	testPy, err := renderInteractiveTemplate("test_predict.py.tmpl", answers)
+	if err != nil {
+		return nil, err
+	}
+	example, err := scaffoldExample(answers)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string][]byte{
+		"cog.yaml":              cogYAML,
+		"predict.py":            predictPy,
+		".dockerignore":         dockerignoreContent,
+		"tests/test_predict.py": testPy,
+		"examples/default.yaml": example,
+	}, nil
+}
+
+// scaffoldConfig fills in the cog.yaml template, so it keeps the comments that explain it
+func scaffoldConfig(answers scaffoldAnswers) ([]byte, error) {
+	packages := append([]string{}, frameworkPackages[answers.Framework]...)
+	if answers.ModelSource == modelSourceHuggingFace && (answers.Framework == frameworkPyTorch || answers.Framework == frameworkTensorFlow) {
+		packages = append(packages, huggingFaceHubPackage)
+	}
+
+	values := [][2]string{
+		{"build.gpu", fmt.Sprintf("%t", answers.GPU)},
+		{"build.python_version", answers.PythonVersion},
+	}
+	if len(packages) > 0 {
+		values = append(values, [2]string{"build.python_packages", "[" + strings.Join(packages, ", ") + "]"})
+	}
+	contents := cogYamlContent
+	if len(packages) > 0 {
+		contents = commentedPythonPackages.ReplaceAll(contents, []byte("  python_packages: []\n"))
+	}
+	for _, value := range values {
+		var err error
+		if contents, err = config.SetValue(contents, value[0], value[1]); err != nil {
+			return nil, err
+		}
+	}
+	return contents, nil
+}
+
+// scaffoldExample returns an example with a value for every input of the generated predict.py
+func scaffoldExample(answers scaffoldAnswers) ([]byte, error) {
+	input := map[string]interface{}{}
+	comment := ""
+	switch answers.Framework {
+	case frameworkTransformers:
+		input["prompt"] = "Once upon a time"
+		input["max_new_tokens"] = 128
+	case frameworkDiffusers:
+		input["prompt"] = "an astronaut riding a horse"
+		input["num_inference_steps"] = 4
+	default:
+		input["image"] = "@input.jpg"
+		input["scale"] = 1.5
+		comment = "# Put an image to try the model with at examples/input.jpg\n"
+	}
+	contents, err := yaml.Marshal(map[string]interface{}{"input": input})
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(comment), contents...), nil
+}
+
+func renderInteractiveTemplate(name string, answers scaffoldAnswers) ([]byte, error) {
+	tmpl, err := template.ParseFS(interactiveTemplates, path.Join("init-templates/interactive", name))
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, answers); err != nil {
+		return nil, fmt.Errorf("Failed to render %s: %w", name, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// writeScaffold writes the files in dir, without overwriting any that exist
+func writeScaffold(dir string, scaffold map[string][]byte) error {
+	filenames := []string{}
+	for filename := range scaffold {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+
+	for _, filename := range filenames {
+		exists, err := files.Exists(filepath.Join(dir, filename))
+		if err != nil {
+			return err
+		}
+		if exists {
+			return fmt.Errorf("Found an existing %s.\nExiting without overwriting (to be on the safe side!)", filename)
+		}
+	}
+	for _, filename := range filenames {
+		filePath := filepath.Join(dir, filename)
+		if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+			return fmt.Errorf("Error creating %s: %w", filepath.Dir(filePath), err)
+		}
+		if err := os.WriteFile(filePath, scaffold[filename], 0o644); err != nil {
+			return fmt.Errorf("Error writing %s: %w", filePath, err)
+		}
+		console.Infof("✅ Created %s", filePath)
+	}
+
+	console.Infof("\nDone! Try it out with 'cog predict --example default', and run the tests with 'cog run python -m unittest tests/test_predict.py'")
+	return nil
+}
@@ -6,6 +6,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
 )
 
 func TestInit(t *testing.T) {
@@ -20,3 +22,32 @@ func TestInit(t *testing.T) {
 	require.FileExists(t, path.Join(dir, "cog.yaml"))
 	require.FileExists(t, path.Join(dir, "predict.py"))
 }
+
+func TestScaffoldFiles(t *testing.T) {
+	for _, answers := range []scaffoldAnswers{
+		{Framework: frameworkPyTorch, GPU: true, PythonVersion: "3.11", ModelSource: modelSourceHuggingFace, ModelPath: "org/model"},
+		{Framework: frameworkTensorFlow, PythonVersion: "3.10", ModelSource: modelSourceLocal, ModelPath: "weights/model.keras"},
+		{Framework: frameworkTransformers, PythonVersion: "3.11", ModelSource: modelSourceHuggingFace, ModelPath: "openai-community/gpt2"},
+		{Framework: frameworkDiffusers, GPU: true, PythonVersion: "3.11", ModelSource: modelSourceLocal, ModelPath: "weights/sdxl"},
+		{Framework: frameworkNone, PythonVersion: "3.12", ModelSource: modelSourceNone},
+	} {
+		t.Run(answers.Framework, func(t *testing.T) {
+			scaffold, err := scaffoldFiles(answers)
+			require.NoError(t, err)
+			require.Contains(t, scaffold, "tests/test_predict.py")
+			require.Contains(t, scaffold, "examples/default.yaml")
+
+			cfg, err := config.FromYAML(scaffold["cog.yaml"])
+			require.NoError(t, err)
+			require.Equal(t, answers.GPU, cfg.Build.GPU)
+			require.Equal(t, answers.PythonVersion, cfg.Build.PythonVersion)
+			require.Equal(t, frameworkPackages[answers.Framework], cfg.Build.PythonPackages[:len(frameworkPackages[answers.Framework])])
+			// The comments from the template are kept
+			require.Contains(t, string(scaffold["cog.yaml"]), "# Configuration for Cog")
+
+			if answers.ModelPath != "" {
+				require.Contains(t, string(scaffold["predict.py"]), `"`+answers.ModelPath+`"`)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/docker/go-units"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+
+	"github.com/replicate/cog/pkg/client"
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+func newInspectCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "inspect [IMAGE]",
+		Short: "Show an image built by Cog, with its size, digests and config",
+		Long: `Show an image built by Cog, with its size, digests and config.
+
+If 'image' isn't passed, it shows the image of the model in the current
+directory, which must have been built with 'cog build'.`,
+		Example: `cog inspect r8.im/your-username/hotdog-detector
+cog inspect --output-format json | jq .size_bytes`,
+		RunE:              cmdInspect,
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeImages,
+	}
+	addOutputFormatFlag(cmd)
+	return cmd
+}
+
+func cmdInspect(cmd *cobra.Command, args []string) error {
+	if err := checkOutputFormat(); err != nil {
+		return err
+	}
+	imageName, err := builtImage(args)
+	if err != nil {
+		return err
+	}
+	result, err := client.Inspect(imageName)
+	if err != nil {
+		return err
+	}
+	if jsonOutput() {
+		return printJSON(result)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Image:\t%s\n", result.Image)
+	fmt.Fprintf(w, "ID:\t%s\n", result.ID)
+	fmt.Fprintf(w, "Created:\t%s\n", result.Created)
+	fmt.Fprintf(w, "Size:\t%s\n", units.HumanSize(float64(result.SizeBytes)))
+	if result.CogVersion != "" {
+		fmt.Fprintf(w, "Cog version:\t%s\n", result.CogVersion)
+	}
+	if len(result.RepoDigests) > 0 {
+		fmt.Fprintf(w, "Digests:\t%s\n", strings.Join(result.RepoDigests, "\n\t"))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(result.Config)
+	if err != nil {
+		return fmt.Errorf("Failed to encode the config as YAML: %w", err)
+	}
+	console.Output("\nConfig:\n" + strings.TrimRight(string(data), "\n"))
+	return nil
+}
+
+// builtImage returns the image in args, or the image of the model in the current directory if there isn't one,
+// and checks that it has been built
+func builtImage(args []string) (string, error) {
+	imageName := ""
+	if len(args) > 0 {
+		imageName = args[0]
+	} else {
+		cfg, projectDir, err := config.GetConfig(projectDirFlag)
+		if err != nil {
+			return "", err
+		}
+		imageName = cfg.Image
+		if imageName == "" {
+			imageName = config.DockerImageName(projectDir)
+		}
+	}
+	exists, err := docker.ImageExists(imageName)
+	if err != nil {
+		return "", fmt.Errorf("Failed to inspect %s: %w", imageName, err)
+	}
+	if !exists {
+		if len(args) > 0 {
+			return "", fmt.Errorf("Image %s doesn't exist. Pull it with 'docker pull %s'", imageName, imageName)
+		}
+		return "", fmt.Errorf("Image %s doesn't exist. Build it with 'cog build'", imageName)
+	}
+	return imageName, nil
+}
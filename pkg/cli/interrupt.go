@@ -0,0 +1,25 @@
+package cli
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+)
+
+// interruptible returns run with a context that's canceled when Cog is interrupted with Ctrl+C or SIGTERM,
+// instead of Cog exiting straight away, so the build or push it's running stops and cleans up after itself.
+// Interrupting it again exits straight away.
+func interruptible(run func(cmd *cobra.Command, args []string) error) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		go func() {
+			<-ctx.Done()
+			stop()
+		}()
+		cmd.SetContext(ctx)
+		return run(cmd, args)
+	}
+}
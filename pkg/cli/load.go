@@ -0,0 +1,38 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var loadExtract string
+
+func newLoadCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "load <archive>",
+		Short: "Load a model from an archive saved by `cog save`",
+		Long: `Load a model from an archive saved by 'cog save'.
+
+The model's Docker image is loaded into Docker, so it can be run with
+'cog predict <image>' without access to a registry.`,
+		Example: `cog load hotdog-detector.tar.gz`,
+		RunE:    cmdLoad,
+		Args:    cobra.ExactArgs(1),
+	}
+
+	cmd.Flags().StringVar(&loadExtract, "extract", "", "Also write the model's cog.yaml, OpenAPI schema and weights manifest to this directory")
+
+	return cmd
+}
+
+func cmdLoad(cmd *cobra.Command, args []string) error {
+	console.Infof("Loading %s...", args[0])
+	metadata, err := image.LoadArchive(args[0], loadExtract)
+	if err != nil {
+		return err
+	}
+	console.Infof("\nLoaded %s. Run it with:\n    cog predict %s", metadata.Image, metadata.Image)
+	return nil
+}
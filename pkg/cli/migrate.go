@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var migrateDryRun bool
+
+func newMigrateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Upgrade " + global.ConfigFilename + " to the current schema version",
+		Long: `Upgrade ` + global.ConfigFilename + ` to the current schema version.
+
+Deprecated keys are replaced with the keys that replace them, and schema_version
+is set. Only the lines that need to change are changed, so comments are kept. The
+changes are printed as a diff.`,
+		RunE: cmdMigrate,
+		Args: cobra.NoArgs,
+	}
+	cmd.Flags().BoolVar(&migrateDryRun, "dry-run", false, "Print the changes without writing "+global.ConfigFilename)
+	return cmd
+}
+
+func cmdMigrate(cmd *cobra.Command, args []string) error {
+	configPath, contents, err := readConfigFile()
+	if err != nil {
+		return err
+	}
+	migrated, applied, err := config.Migrate(contents)
+	if err != nil {
+		return err
+	}
+	if string(migrated) == string(contents) {
+		console.Infof("%s is already at schema version %d", configPath, config.CurrentSchemaVersion)
+		return nil
+	}
+
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(contents)),
+		B:        difflib.SplitLines(string(migrated)),
+		FromFile: configPath,
+		ToFile:   configPath,
+		Context:  3,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Print(diff)
+	for _, description := range applied {
+		console.Infof("%s", description)
+	}
+
+	if migrateDryRun {
+		console.Infof("Not writing %s, because --dry-run was passed", configPath)
+		return nil
+	}
+	info, err := os.Stat(configPath)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(configPath, migrated, info.Mode()); err != nil {
+		return fmt.Errorf("Failed to write %s: %w", configPath, err)
+	}
+	console.Infof("Upgraded %s to schema version %d", configPath, config.CurrentSchemaVersion)
+	return nil
+}
@@ -0,0 +1,171 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/outdated"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var updateApply bool
+
+func newOutdatedCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "outdated",
+		Short: "Show Python packages and CUDA versions in cog.yaml that have compatible updates",
+		Long: `Show Python packages and CUDA versions in cog.yaml that have compatible updates.
+
+Each package is checked against the latest release on PyPI that works with the
+model's Python version, and its pinned version against the vulnerabilities
+known to OSV (https://osv.dev). torch, torchvision and torchaudio are only
+updated together, to versions that are built for the model's CUDA version.`,
+		Args: cobra.NoArgs,
+		RunE: cmdOutdated,
+	}
+}
+
+func newUpdateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "update",
+		Short: "Update the versions Python packages are pinned to in cog.yaml",
+		Long: `Update the versions Python packages are pinned to in cog.yaml, and the file in
+python_requirements, to the latest compatible releases that 'cog outdated'
+shows. Only packages pinned with == are updated.
+
+Without --apply, it shows what would change.`,
+		Args: cobra.NoArgs,
+		RunE: cmdUpdate,
+	}
+	cmd.Flags().BoolVar(&updateApply, "apply", false, "Write the updated versions to cog.yaml and the requirements file")
+	return cmd
+}
+
+func cmdOutdated(cmd *cobra.Command, args []string) error {
+	cfg, projectDir, err := config.GetConfig(projectDirFlag)
+	if err != nil {
+		return err
+	}
+	console.Info("Checking for updates...")
+	report, err := outdated.Check(context.Background(), cfg, projectDir)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "PACKAGE\tCURRENT\tLATEST\tURGENCY\tNOTES")
+	upToDate := true
+	for _, p := range report.Packages {
+		if !p.Outdated() && len(p.Vulnerabilities) == 0 {
+			continue
+		}
+		upToDate = false
+		current := p.Current
+		if current == "" {
+			current = "(not pinned)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", p.Name, current, p.Latest, p.Urgency(), packageNotes(p))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if report.CUDA != nil {
+		upToDate = false
+		console.Infof("\nCUDA %s can be updated to %s, the latest version torch %s is built for. Set build.cuda in cog.yaml to \"%s\" to use it.", report.CUDA.Current, report.CUDA.Latest, report.CUDA.Torch, report.CUDA.Latest)
+	}
+	if upToDate {
+		console.Info("Everything is up to date.")
+	} else if len(outdated.Updates(report)) > 0 {
+		console.Info("\nRun 'cog update --apply' to update the pinned versions.")
+	}
+	return nil
+}
+
+// packageNotes returns the vulnerabilities in a package's pinned version, and why its latest version is held back
+func packageNotes(p *outdated.Package) string {
+	notes := []string{}
+	for _, v := range p.Vulnerabilities {
+		note := v.ID
+		if len(v.Aliases) > 0 {
+			note += " (" + strings.Join(v.Aliases, ", ") + ")"
+		}
+		if v.Fixed != "" {
+			note += " fixed in " + v.Fixed
+		}
+		notes = append(notes, note)
+	}
+	if p.Note != "" {
+		notes = append(notes, p.Note)
+	}
+	return strings.Join(notes, "; ")
+}
+
+func cmdUpdate(cmd *cobra.Command, args []string) error {
+	cfg, projectDir, err := config.GetConfig(projectDirFlag)
+	if err != nil {
+		return err
+	}
+	console.Info("Checking for updates...")
+	report, err := outdated.Check(context.Background(), cfg, projectDir)
+	if err != nil {
+		return err
+	}
+	updates := outdated.Updates(report)
+	if len(updates) == 0 {
+		console.Info("The pinned versions are up to date.")
+		return nil
+	}
+	for _, u := range updates {
+		console.Infof("%s %s -> %s", u.Name, u.From, u.To)
+	}
+	if !updateApply {
+		console.Info("\nRun 'cog update --apply' to write these versions.")
+		return nil
+	}
+
+	originals, err := readFiles(projectDir, outdated.Files(cfg))
+	if err != nil {
+		return err
+	}
+	changed, err := outdated.Apply(cfg, projectDir, updates)
+	if err != nil {
+		return err
+	}
+	// The updated versions must still be compatible with the rest of cog.yaml, e.g. its CUDA version
+	if _, _, err := config.GetConfig(projectDir); err != nil {
+		if restoreErr := writeFiles(projectDir, originals); restoreErr != nil {
+			console.Warnf("Failed to restore %s: %s", strings.Join(changed, " and "), restoreErr)
+		}
+		return fmt.Errorf("The updated versions aren't compatible with cog.yaml, so nothing was changed: %w", err)
+	}
+	console.Infof("\nUpdated %s", strings.Join(changed, " and "))
+	return nil
+}
+
+func readFiles(dir string, names []string) (map[string][]byte, error) {
+	files := map[string][]byte{}
+	for _, name := range names {
+		contents, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read %s: %w", name, err)
+		}
+		files[name] = contents
+	}
+	return files, nil
+}
+
+func writeFiles(dir string, files map[string][]byte) error {
+	for name, contents := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), contents, 0o644); err != nil {
+			return fmt.Errorf("Failed to write %s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+const (
+	outputFormatText = "text"
+	outputFormatJSON = "json"
+)
+
+var outputFormatFlag string
+
+// addOutputFormatFlag adds --output-format, which makes a command print its result as JSON, so it can be used by
+// scripts and other tools. It isn't called --format, because `cog build --format` is the format of the image.
+func addOutputFormatFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&outputFormatFlag, "output-format", outputFormatText, "Format to print the result in: 'text', or 'json' to print it as a JSON object on stdout")
+}
+
+func checkOutputFormat() error {
+	if outputFormatFlag != outputFormatText && outputFormatFlag != outputFormatJSON {
+		return fmt.Errorf("Unknown output format '%s', it must be '%s' or '%s'", outputFormatFlag, outputFormatText, outputFormatJSON)
+	}
+	return nil
+}
+
+// jsonOutput returns whether --output-format json is set. Commands still log to stderr, so stdout only has the JSON.
+func jsonOutput() bool {
+	return outputFormatFlag == outputFormatJSON
+}
+
+// printJSON prints the result of a command as indented JSON on stdout
+func printJSON(result interface{}) error {
+	out, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Failed to encode result as JSON: %w", err)
+	}
+	console.Output(string(out))
+	return nil
+}
+
+// seconds returns d in seconds, to the millisecond, for JSON results
+func seconds(d time.Duration) float64 {
+	return d.Round(time.Millisecond).Seconds()
+}
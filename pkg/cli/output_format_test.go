@@ -0,0 +1,32 @@
+package cli
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/image"
+)
+
+func TestCheckOutputFormat(t *testing.T) {
+	t.Cleanup(func() { outputFormatFlag = outputFormatText })
+
+	for _, format := range []string{outputFormatText, outputFormatJSON} {
+		outputFormatFlag = format
+		require.NoError(t, checkOutputFormat())
+	}
+	outputFormatFlag = "yaml"
+	require.ErrorContains(t, checkOutputFormat(), "Unknown output format 'yaml'")
+}
+
+func TestBuildResultJSON(t *testing.T) {
+	result := buildResult{
+		Summary:         image.Summary{Image: "hotdog", ID: "sha256:abc", SizeBytes: 1024, CogVersion: "0.9.0"},
+		DurationSeconds: seconds(1500 * time.Millisecond),
+	}
+	out, err := json.Marshal(result)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"image": "hotdog", "id": "sha256:abc", "size_bytes": 1024, "cog_version": "0.9.0", "cached": false, "duration_seconds": 1.5}`, string(out))
+}
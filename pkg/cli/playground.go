@@ -0,0 +1,138 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/playground"
+	"github.com/replicate/cog/pkg/predict"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var (
+	playgroundHost string
+	playgroundPort int
+)
+
+func newPlaygroundCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "playground [IMAGE]",
+		Short: "Try the model in a web page",
+		Long: `Try the model in a web page.
+
+It starts the model and serves a page with a form for its inputs, made from
+its schema, that runs predictions and previews their outputs. Files, like
+images and audio, can be uploaded and previewed.
+
+If 'image' is passed, it runs that Docker image, which must have been built
+by Cog. Otherwise, it builds the model in the current directory and runs
+that.`,
+		Example:           `cog playground --port 8080`,
+		RunE:              interruptible(cmdPlayground),
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeImages,
+	}
+	addUseCudaBaseImageFlag(cmd)
+	addProxyFlags(cmd)
+	addBuildArgFlag(cmd)
+	addBuildProgressOutputFlag(cmd)
+	addDockerfileFlag(cmd)
+	addGpusFlag(cmd)
+	cmd.Flags().StringArrayVarP(&envFlags, "env", "e", []string{}, "Environment variables, in the form name=value")
+	cmd.Flags().StringVar(&playgroundHost, "host", "127.0.0.1", "Host to serve the playground on")
+	cmd.Flags().IntVar(&playgroundPort, "port", 8080, "Port to serve the playground on")
+	return cmd
+}
+
+func cmdPlayground(cmd *cobra.Command, args []string) error {
+	gpus, err := parseGpusFlag()
+	if err != nil {
+		return err
+	}
+
+	imageName := ""
+	name := ""
+	volumes := []docker.Volume{}
+	var cfg *config.Config
+	if len(args) == 0 {
+		var projectDir string
+		if cfg, projectDir, err = config.GetConfig(projectDirFlag); err != nil {
+			return err
+		}
+		dockerBuildArgs, err := buildArgs(cfg)
+		if err != nil {
+			return err
+		}
+		if imageName, err = image.BuildBase(cmd.Context(), cfg, projectDir, dockerBuildArgs, buildUseCudaBaseImage, buildProgressOutput); err != nil {
+			return err
+		}
+		// Base image doesn't have /src in it, so mount as volume
+		volumes = append(volumes, docker.Volume{Source: projectDir, Destination: "/src"})
+		name = filepath.Base(projectDir)
+	} else {
+		imageName = args[0]
+		if err := pullIfMissing(imageName); err != nil {
+			return err
+		}
+		if cfg, err = image.GetConfig(imageName); err != nil {
+			return err
+		}
+		name = nameFromImage(imageName)
+	}
+	if gpus == "" && cfg.Build.GPU {
+		gpus = "all"
+	}
+	if err := checkResources(cfg, gpus); err != nil {
+		return err
+	}
+
+	console.Info("")
+	console.Infof("Starting Docker image %s and running setup()...", imageName)
+	predictor := predict.NewPredictor(docker.RunOptions{
+		GPUs:    gpus,
+		Image:   imageName,
+		Volumes: volumes,
+		Env:     envFlags,
+	})
+	if err := configureServer(&predictor, cfg); err != nil {
+		return err
+	}
+	if err := predictor.Start(os.Stderr); err != nil {
+		_ = predictor.Stop()
+		return err
+	}
+	defer func() {
+		console.Info("Stopping container...")
+		if err := predictor.Stop(); err != nil {
+			console.Warnf("Failed to stop container: %s", err)
+		}
+	}()
+
+	addr := net.JoinHostPort(playgroundHost, strconv.Itoa(playgroundPort))
+	server := &http.Server{Addr: addr, Handler: playground.New(name, &predictor), ReadHeaderTimeout: 10 * time.Second}
+	ctx := cmd.Context()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	console.Infof("\nThe playground is at http://%s\nPress Ctrl+C to stop it.", addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("Failed to serve the playground: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package cli
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/dockerfile"
+	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// pluginPrefix is the start of the names of executables on the PATH that add commands to cog, so an executable
+// called cog-publish adds `cog publish`
+const pluginPrefix = "cog-"
+
+// defaultPluginsDir is where the Go plugins that add hooks to the Dockerfile generator are, if
+// COG_PLUGINS_DIR isn't set
+const defaultPluginsDir = "~/.config/cog/plugins"
+
+// commandPlugin is an executable on the PATH that adds a command to cog
+type commandPlugin struct {
+	name string
+	path string
+}
+
+func newPluginsCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "plugins",
+		Short: "List the plugins that add commands and Dockerfile hooks to cog",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			plugins := findCommandPlugins(cmd.Root())
+			if len(plugins) == 0 {
+				console.Infof("There aren't any plugins that add commands. To add one, put an executable called %s<command> on your PATH.", pluginPrefix)
+			} else {
+				console.Info("Commands:")
+				for _, p := range plugins {
+					console.Infof("  %-20s %s", p.name, p.path)
+				}
+			}
+			if hooks := dockerfile.Hooks(); len(hooks) > 0 {
+				console.Info("\nDockerfile hooks:")
+				for _, hook := range hooks {
+					console.Infof("  %s", hook.Name())
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// RunPlugin runs the plugin that adds the command in args[0] to cog, with the rest of args, if cog doesn't have
+// the command itself. It returns false if there isn't a plugin for args[0].
+func RunPlugin(root *cobra.Command, args []string) (bool, error) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return false, nil
+	}
+	if _, _, err := root.Find(args); err == nil {
+		return false, nil
+	}
+	path, err := exec.LookPath(pluginPrefix + args[0])
+	if err != nil {
+		return false, nil
+	}
+
+	cmd := exec.Command(path, args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), "COG_VERSION="+global.Version)
+	if executable, err := os.Executable(); err == nil {
+		// So the plugin can run cog commands with the same cog
+		cmd.Env = append(cmd.Env, "COG_EXECUTABLE="+executable)
+	}
+	return true, cmd.Run()
+}
+
+// findCommandPlugins returns the plugins on the PATH, apart from ones for commands that cog already has
+func findCommandPlugins(root *cobra.Command) []commandPlugin {
+	seen := map[string]bool{}
+	plugins := []commandPlugin{}
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := strings.TrimSuffix(strings.TrimPrefix(entry.Name(), pluginPrefix), ".exe")
+			if !strings.HasPrefix(entry.Name(), pluginPrefix) || name == "" || seen[name] || entry.IsDir() {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			if _, err := exec.LookPath(path); err != nil {
+				continue
+			}
+			// Only the first plugin on the PATH with a name runs, like any other executable
+			seen[name] = true
+			if cmd, _, err := root.Find([]string{name}); err == nil && cmd != root {
+				console.Debugf("%s isn't used, because cog already has a %s command", path, name)
+				continue
+			}
+			plugins = append(plugins, commandPlugin{name: name, path: path})
+		}
+	}
+	sort.Slice(plugins, func(i, j int) bool { return plugins[i].name < plugins[j].name })
+	return plugins
+}
+
+// loadHookPlugins loads the Go plugins in COG_PLUGINS_DIR, or ~/.config/cog/plugins, that add hooks to the
+// Dockerfile generator
+func loadHookPlugins() error {
+	dir := os.Getenv("COG_PLUGINS_DIR")
+	if dir == "" {
+		var err error
+		dir, err = homedir.Expand(defaultPluginsDir)
+		if err != nil {
+			return err
+		}
+	}
+	return dockerfile.LoadPlugins(dir)
+}
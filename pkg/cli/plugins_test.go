@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunPlugin(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+	script := "#!/bin/sh\necho \"$@ $COG_VERSION\" > " + out + "\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cog-publish"), []byte(script), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cog-build"), []byte(script), 0o755))
+	t.Setenv("PATH", dir)
+
+	root, err := NewRootCommand()
+	require.NoError(t, err)
+
+	ran, err := RunPlugin(root, []string{"publish", "--registry", "internal"})
+	require.NoError(t, err)
+	require.True(t, ran)
+	contents, err := os.ReadFile(out)
+	require.NoError(t, err)
+	require.Equal(t, "--registry internal dev\n", string(contents))
+
+	// Commands cog has aren't replaced by plugins
+	ran, err = RunPlugin(root, []string{"build"})
+	require.NoError(t, err)
+	require.False(t, ran)
+
+	ran, err = RunPlugin(root, []string{"missing"})
+	require.NoError(t, err)
+	require.False(t, ran)
+
+	require.Equal(t, []commandPlugin{{name: "publish", path: filepath.Join(dir, "cog-publish")}}, findCommandPlugins(root))
+}
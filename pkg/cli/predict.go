@@ -1,32 +1,61 @@
 package cli
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
 	"github.com/vincent-petithory/dataurl"
 
+	"github.com/replicate/cog/pkg/card"
 	"github.com/replicate/cog/pkg/config"
 	"github.com/replicate/cog/pkg/docker"
+	cogerrors "github.com/replicate/cog/pkg/errors"
 	"github.com/replicate/cog/pkg/image"
 	"github.com/replicate/cog/pkg/predict"
+	"github.com/replicate/cog/pkg/storage"
 	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/util/files"
 	"github.com/replicate/cog/pkg/util/mime"
 )
 
 var (
-	envFlags   []string
-	inputFlags []string
-	outPath    string
+	envFlags        []string
+	inputFlags      []string
+	outPath         string
+	parallelFlag    int
+	exampleFlag     string
+	stdinFlag       bool
+	timeoutFlag     time.Duration
+	openaiFlag      string
+	localMetalFlag  bool
+	urlFlag         string
+	headerFlags     []string
+	tokenFlag       string
+	caCertFlag      string
+	outputURLExpiry time.Duration
+	seedFlag        int64
+	profileFlag     bool
+	profileDirFlag  string
+	profileTorch    bool
+	helpInputsFlag  bool
+
+	ignoreResourcesFlag bool
 )
 
 func newPredictCommand() *cobra.Command {
@@ -39,20 +68,47 @@ If 'image' is passed, it will run the prediction on that Docker image.
 It must be an image that has been built by Cog.
 
 Otherwise, it will build the model in the current directory and run
-the prediction on that.`,
-		RunE:       cmdPredict,
-		Args:       cobra.MaximumNArgs(1),
-		SuggestFor: []string{"infer"},
+the prediction on that.
+
+With --url, it runs the prediction on a model that's already running
+somewhere else, such as a deployment, without building anything.`,
+		RunE:              cmdPredict,
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeImages,
+		SuggestFor:        []string{"infer"},
+		// The model's inputs can also be passed as flags, e.g. --num-steps 20
+		Annotations: map[string]string{inputFlagsAnnotation: "true"},
 	}
 
 	addUseCudaBaseImageFlag(cmd)
+	addProxyFlags(cmd)
+	addBuildArgFlag(cmd)
 	addBuildProgressOutputFlag(cmd)
 	addDockerfileFlag(cmd)
 	addGpusFlag(cmd)
 
-	cmd.Flags().StringArrayVarP(&inputFlags, "input", "i", []string{}, "Inputs, in the form name=value. if value is prefixed with @, then it is read from a file on disk. E.g. -i path=@image.jpg")
-	cmd.Flags().StringVarP(&outPath, "output", "o", "", "Output path")
+	cmd.Flags().StringArrayVarP(&inputFlags, "input", "i", []string{}, "Inputs, in the form name=value. if value is prefixed with @, then it is read from a file on disk. E.g. -i path=@image.jpg. Directories are sent as tar archives")
+	cmd.Flags().StringVarP(&outPath, "output", "o", "", "Output path. If it is a directory, or ends with /, output files are written into it. It can also be an s3:// or gs:// URL to upload outputs to")
+	cmd.Flags().DurationVar(&outputURLExpiry, "output-url-expiry", time.Hour, "How long the signed URLs printed for outputs uploaded to s3:// or gs:// are valid for")
 	cmd.Flags().StringArrayVarP(&envFlags, "env", "e", []string{}, "Environment variables, in the form name=value")
+	cmd.Flags().StringVar(&exampleFlag, "example", "", "Name of an example in the examples/ directory to use as inputs. Inputs passed with -i override the example's")
+	cmd.Flags().BoolVar(&stdinFlag, "stdin", false, "Read inputs from stdin, either as a JSON object or as the raw contents of the model's only file input, and write raw output to stdout")
+	cmd.Flags().Int64Var(&seedFlag, "seed", noSeed, "Seed for the model's random number generators, to make outputs reproducible. It's passed as the model's 'seed' input, if it has one, and seeds Python, NumPy and PyTorch")
+	cmd.Flags().BoolVar(&profileFlag, "profile", false, "Profile the prediction with py-spy, and write a flamegraph to --profile-dir. py-spy is installed in the container if the image doesn't have it")
+	cmd.Flags().StringVar(&profileDirFlag, "profile-dir", "profile", "Directory to write profiles to")
+	cmd.Flags().BoolVar(&profileTorch, "profile-torch", false, "Also profile the prediction with the PyTorch profiler, and write a trace to --profile-dir. Implies --profile")
+	cmd.Flags().DurationVar(&timeoutFlag, "timeout", 0, "Cancel the prediction if it hasn't finished after this long, e.g. 30s or 5m")
+	cmd.Flags().StringVar(&openaiFlag, "openai", "", "Send this message to the model's OpenAI-compatible chat completions route instead of running a prediction with inputs, and print the reply")
+	cmd.Flags().IntVar(&parallelFlag, "parallel", 1, "Number of predictions to run in parallel, limited by 'concurrency.max' in cog.yaml")
+	_ = cmd.RegisterFlagCompletionFunc("input", completeInputs)
+	cmd.Flags().BoolVar(&helpInputsFlag, "help-inputs", false, "Show the model's inputs, with their types, defaults, allowed values and descriptions, instead of running a prediction. The model must have been built with 'cog build'")
+	addOutputFormatFlag(cmd)
+	cmd.Flags().BoolVar(&ignoreResourcesFlag, "ignore-resources", false, "Run the model even if this machine has less CPU, memory, GPU memory or disk space than 'resources' in cog.yaml says it needs")
+	cmd.Flags().StringVar(&urlFlag, "url", "", "Run the prediction on a model that's already running at this URL, e.g. a deployment, instead of building and running it here")
+	cmd.Flags().StringArrayVar(&headerFlags, "header", []string{}, "Headers to send to the model at --url, in the form 'Name: value'")
+	cmd.Flags().StringVar(&tokenFlag, "token", "", "Token to send to the model at --url as 'Authorization: Bearer <token>'. Defaults to COG_PREDICT_TOKEN")
+	cmd.Flags().StringVar(&caCertFlag, "ca-cert", "", "PEM file with the certificate to trust when the model at --url serves HTTPS with a self-signed certificate")
+	cmd.Flags().BoolVar(&localMetalFlag, "local-metal", false, "Experimental: on Apple Silicon, run the model outside Docker in a virtualenv, so PyTorch can use the GPU with Metal (MPS)")
 
 	return cmd
 }
@@ -60,7 +116,49 @@ the prediction on that.`,
 func cmdPredict(cmd *cobra.Command, args []string) error {
 	imageName := ""
 	volumes := []docker.Volume{}
-	gpus := gpusFlag
+	maxConcurrency := 1
+	hasWarmup := false
+	var serverConf *config.Config
+	// builtProjectDir is set if the model is built from a project, for crash diagnostics
+	builtProjectDir := ""
+
+	if inputFlagsErr != nil {
+		return cogerrors.Usage(inputFlagsErr)
+	}
+	if helpInputsFlag {
+		return printInputsHelp(cmd, args)
+	}
+	if outputFormatFlag != outputFormatText {
+		return fmt.Errorf("--output-format can only be used with --help-inputs. Use -o to write the prediction's output to a file")
+	}
+
+	gpus, err := parseGpusFlag()
+	if err != nil {
+		return err
+	}
+
+	inputs, err := parsePredictInputs()
+	if err != nil {
+		return err
+	}
+
+	if profiling() && (urlFlag != "" || localMetalFlag) {
+		return fmt.Errorf("--profile runs a profiler in the model's container, so it can't be used with --url or --local-metal")
+	}
+
+	if urlFlag != "" {
+		if len(args) > 0 || localMetalFlag {
+			return fmt.Errorf("--url runs the prediction on a model that's already running, so it can't be used with an image or --local-metal")
+		}
+		return predictRemote(inputs)
+	}
+
+	if localMetalFlag {
+		if len(args) > 0 {
+			return fmt.Errorf("--local-metal runs the model in the current directory, so it can't be used with an image")
+		}
+		return predictLocalMetal(inputs)
+	}
 
 	if len(args) == 0 {
 		// Build image
@@ -70,7 +168,48 @@ func cmdPredict(cmd *cobra.Command, args []string) error {
 			return err
 		}
 
-		if imageName, err = image.BuildBase(cfg, projectDir, buildUseCudaBaseImage, buildProgressOutput); err != nil {
+		// Check the flags are for the predictor's inputs before building it, if they can be read from predict.py
+		if err := checkPredictorInputFlags(cfg, projectDir); err != nil {
+			return err
+		}
+
+		// Reuse the model started by `cog start`, so setup() doesn't have to run again
+		runner, err := predict.FindRunner(projectDir)
+		if err != nil {
+			return err
+		}
+		// Profiling needs a container started with it enabled
+		if runner != nil && !profiling() {
+			hash, err := image.ProjectHash(cfg, projectDir)
+			if err != nil {
+				return err
+			}
+			if !runner.UpToDate(hash) {
+				if err := stopOutdatedRunner(runner); err != nil {
+					return err
+				}
+				if runner, err = startRunner(cmd, cfg, projectDir, hash, gpus); err != nil {
+					return err
+				}
+			}
+			console.Infof("Using the model started by `cog start` in container %s", shortContainerID(runner.ContainerID))
+			predictor, err := runner.Connect()
+			if err != nil {
+				return err
+			}
+			maxRequestSize, err := cfg.MaxRequestSizeBytes()
+			if err != nil {
+				return err
+			}
+			predictor.SetMaxRequestSize(maxRequestSize)
+			return runPredictions(predictor, inputs, cfg.MaxConcurrency())
+		}
+
+		dockerBuildArgs, err := buildArgs(cfg)
+		if err != nil {
+			return err
+		}
+		if imageName, err = image.BuildBase(cmd.Context(), cfg, projectDir, dockerBuildArgs, buildUseCudaBaseImage, buildProgressOutput); err != nil {
 			return err
 		}
 
@@ -79,10 +218,17 @@ func cmdPredict(cmd *cobra.Command, args []string) error {
 			Source:      projectDir,
 			Destination: "/src",
 		})
+		builtProjectDir = projectDir
 
 		if gpus == "" && cfg.Build.GPU {
 			gpus = "all"
 		}
+		if err := checkResources(cfg, gpus); err != nil {
+			return err
+		}
+		maxConcurrency = cfg.MaxConcurrency()
+		hasWarmup = len(cfg.Warmup) > 0
+		serverConf = cfg
 
 	} else {
 		// Use existing image
@@ -93,34 +239,57 @@ func cmdPredict(cmd *cobra.Command, args []string) error {
 			return fmt.Errorf("Invalid image name '%s'. Did you forget `-i`?", imageName)
 		}
 
-		exists, err := docker.ImageExists(imageName)
-		if err != nil {
-			return fmt.Errorf("Failed to determine if %s exists: %w", imageName, err)
-		}
-		if !exists {
-			console.Infof("Pulling image: %s", imageName)
-			if err := docker.Pull(imageName); err != nil {
-				return fmt.Errorf("Failed to pull %s: %w", imageName, err)
-			}
+		if err := pullIfMissing(imageName); err != nil {
+			return err
 		}
 		conf, err := image.GetConfig(imageName)
 		if err != nil {
 			return err
 		}
+		// Check the inputs passed as flags before waiting for the model to start
+		if len(schemaInputFlags) > 0 || len(ownLongFlags) > 0 {
+			if schema, err := image.GetOpenAPISchema(imageName); err == nil {
+				if _, err := parseSchemaInputFlags(schema, schemaInputFlags, ownLongFlags); err != nil {
+					return err
+				}
+			}
+		}
 		if gpus == "" && conf.Build.GPU {
 			gpus = "all"
 		}
+		if err := checkResources(conf, gpus); err != nil {
+			return err
+		}
+		maxConcurrency = conf.MaxConcurrency()
+		hasWarmup = len(conf.Warmup) > 0
+		serverConf = conf
 	}
 
 	console.Info("")
-	console.Infof("Starting Docker image %s and running setup()...", imageName)
+	if hasWarmup {
+		console.Infof("Starting Docker image %s and running setup() and warm-up predictions...", imageName)
+	} else {
+		console.Infof("Starting Docker image %s and running setup()...", imageName)
+	}
+
+	env := append(envFlags, seedEnvs()...)
+	if openaiFlag != "" {
+		// Serve the OpenAI-compatible routes, even if cog.yaml doesn't enable them
+		env = append(env, "COG_OPENAI=true")
+	}
 
 	predictor := predict.NewPredictor(docker.RunOptions{
 		GPUs:    gpus,
 		Image:   imageName,
 		Volumes: volumes,
-		Env:     envFlags,
+		Env:     env,
 	})
+	if err := configureServer(&predictor, serverConf); err != nil {
+		return err
+	}
+	if err := configureProfiling(&predictor); err != nil {
+		return err
+	}
 
 	go func() {
 		captureSignal := make(chan os.Signal, 1)
@@ -144,13 +313,20 @@ func cmdPredict(cmd *cobra.Command, args []string) error {
 			predictor = predict.NewPredictor(docker.RunOptions{
 				Image:   imageName,
 				Volumes: volumes,
+				Env:     env,
 			})
+			if err := configureServer(&predictor, serverConf); err != nil {
+				return err
+			}
+			if err := configureProfiling(&predictor); err != nil {
+				return err
+			}
 
 			if err := predictor.Start(os.Stderr); err != nil {
-				return err
+				return reportCrash(predictor, serverConf, builtProjectDir, err)
 			}
 		} else {
-			return err
+			return reportCrash(predictor, serverConf, builtProjectDir, err)
 		}
 	}
 
@@ -162,45 +338,191 @@ func cmdPredict(cmd *cobra.Command, args []string) error {
 		}
 	}()
 
-	return predictIndividualInputs(predictor, inputFlags, outPath)
+	if err := runPredictions(predictor, inputs, maxConcurrency); err != nil {
+		return reportCrash(predictor, serverConf, builtProjectDir, err)
+	}
+	return nil
+}
+
+// runPredictions runs the predictions requested on the command line against a model that is ready
+func runPredictions(predictor predict.Predictor, inputs predict.Inputs, maxConcurrency int) error {
+	if openaiFlag != "" {
+		return predictChatCompletion(predictor, openaiFlag)
+	}
+
+	inputs, err := applyInputFlags(predictor, inputs)
+	if err != nil {
+		return err
+	}
+
+	if stdinFlag {
+		stdinInputs, stdinPath, err := parseStdinInputs(predictor)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(stdinPath)
+		// Inputs passed with -i take precedence
+		for name, input := range inputs {
+			stdinInputs[name] = input
+		}
+		inputs = stdinInputs
+	} else if console.IsTerminal() {
+		var err error
+		if inputs, err = promptMissingInputs(predictor, inputs); err != nil {
+			return err
+		}
+	}
+
+	// A model that's already running somewhere else downloads URLs itself
+	if urlFlag == "" {
+		var err error
+		if inputs, err = fetchURLInputs(predictor, inputs); err != nil {
+			return err
+		}
+	}
+
+	inputs, err = applySeed(predictor, inputs)
+	if err != nil {
+		return err
+	}
+
+	var stopProfiler func() error
+	if profiling() {
+		if stopProfiler, err = startProfiler(predictor); err != nil {
+			return err
+		}
+	}
+
+	if parallelFlag > 1 {
+		err = predictParallel(predictor, inputs, outPath, parallelFlag, maxConcurrency)
+	} else {
+		err = predictIndividualInputs(predictor, inputs, outPath)
+	}
+	if stopProfiler != nil {
+		if stopErr := stopProfiler(); stopErr != nil {
+			console.Warnf("%s", stopErr)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return writeSeedMetadata(strings.TrimPrefix(outPath, "@"))
+}
+
+func predictChatCompletion(predictor predict.Predictor, message string) error {
+	console.Info("Running chat completion...")
+	reply, err := predictor.ChatCompletion([]predict.ChatMessage{{Role: "user", Content: message}})
+	if err != nil {
+		return err
+	}
+	fmt.Println(reply.Content)
+	return nil
 }
 
-func predictIndividualInputs(predictor predict.Predictor, inputFlags []string, outputPath string) error {
+func predictIndividualInputs(predictor predict.Predictor, inputs predict.Inputs, outputPath string) error {
 	console.Info("Running prediction...")
 	schema, err := predictor.GetSchema()
 	if err != nil {
 		return err
 	}
 
-	inputs, err := parseInputFlags(inputFlags)
+	prediction, err := predictor.PredictWithTimeout(inputs, timeoutFlag)
 	if err != nil {
+		return cogerrors.PredictionFailed(err)
+	}
+	if err := checkPredictionStatus(prediction); err != nil {
+		return err
+	}
+	if err := recordFixture(inputs, prediction); err != nil {
 		return err
 	}
 
-	prediction, err := predictor.Predict(inputs)
+	return handlePredictionOutput(prediction, schema, outputPath, -1)
+}
+
+// predictParallel runs the same prediction several times at once, never sending more
+// requests at the same time than the model's concurrency allows
+func predictParallel(predictor predict.Predictor, inputs predict.Inputs, outputPath string, count int, maxConcurrency int) error {
+	console.Infof("Running %d predictions, sending %d at a time...", count, maxConcurrency)
+	schema, err := predictor.GetSchema()
 	if err != nil {
 		return err
 	}
 
+	predictions := make([]*predict.Response, count)
+	errs := make([]error, count)
+	slots := make(chan struct{}, maxConcurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			predictions[i], errs[i] = predictor.PredictWithTimeout(inputs, timeoutFlag)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, prediction := range predictions {
+		if errs[i] != nil {
+			return cogerrors.PredictionFailed(fmt.Errorf("Prediction %d failed: %w", i, errs[i]))
+		}
+		if err := checkPredictionStatus(prediction); err != nil {
+			return fmt.Errorf("Prediction %d failed: %w", i, err)
+		}
+		if err := handlePredictionOutput(prediction, schema, outputPath, i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkPredictionStatus returns an error if the prediction didn't succeed
+func checkPredictionStatus(prediction *predict.Response) error {
+	switch prediction.Status {
+	case "failed":
+		return cogerrors.PredictionFailed(fmt.Errorf("The prediction failed: %s", prediction.Error))
+	case "canceled":
+		return cogerrors.PredictionFailed(fmt.Errorf("The prediction was canceled"))
+	}
+	return nil
+}
+
+// handlePredictionOutput writes the output of a prediction to stdout or a file, depending on the type in the schema.
+// If index is not negative, it is added to the names of output files so parallel predictions don't overwrite each other.
+func handlePredictionOutput(prediction *predict.Response, schema *openapi3.T, outputPath string, index int) error {
 	// Generate output depending on type in schema
 	var out []byte
 	responseSchema := schema.Paths["/predictions"].Post.Responses["200"].Value.Content["application/json"].Schema.Value
 	outputSchema := responseSchema.Properties["output"].Value
 
+	// Ignore @, to make it behave the same as -i
+	outputPath = strings.TrimPrefix(outputPath, "@")
+
+	outputDir, err := outputDirectory(outputPath)
+	if err != nil {
+		return err
+	}
+
 	// Multiple outputs!
 	if outputSchema.Type == "array" && outputSchema.Items.Value != nil && outputSchema.Items.Value.Type == "string" && outputSchema.Items.Value.Format == "uri" {
-		return handleMultipleFileOutput(prediction, outputSchema)
+		if storage.IsURL(outputPath) && outputDir == "" {
+			return fmt.Errorf("The model outputs several files, so --output must be a prefix that ends with /, like %s/", outputPath)
+		}
+		return handleMultipleFileOutput(prediction, outputSchema, outputDir, index)
 	}
 
 	if outputSchema.Type == "string" && outputSchema.Format == "uri" {
-		dataurlObj, err := dataurl.DecodeString((*prediction.Output).(string))
+		data, contentType, err := decodeFileOutput((*prediction.Output).(string))
 		if err != nil {
-			return fmt.Errorf("Failed to decode dataurl: %w", err)
+			return err
 		}
-		out = dataurlObj.Data
-		if outputPath == "" {
-			outputPath = "output"
-			extension := mime.ExtensionByType(dataurlObj.ContentType())
+		out = data
+		// When piping, file outputs go to stdout unless an output path is set
+		if (outputPath == "" && !stdinFlag) || outputDir != "" {
+			outputPath = joinOutputPath(outputDir, "output")
+			extension := mime.ExtensionByType(contentType)
 			if extension != "" {
 				outputPath += extension
 			}
@@ -209,6 +531,9 @@ func predictIndividualInputs(predictor predict.Predictor, inputFlags []string, o
 		// Handle strings separately because if we encode it to JSON it will be surrounded by quotes.
 		s := (*prediction.Output).(string)
 		out = []byte(s)
+		if outputDir != "" {
+			outputPath = joinOutputPath(outputDir, "output.txt")
+		}
 	} else {
 		// Treat everything else as JSON -- ints, floats, bools will all convert correctly.
 		rawJSON, err := json.Marshal(prediction.Output)
@@ -220,6 +545,9 @@ func predictIndividualInputs(predictor predict.Predictor, inputFlags []string, o
 			return err
 		}
 		out = indentedJSON.Bytes()
+		if outputDir != "" {
+			outputPath = joinOutputPath(outputDir, "output.json")
+		}
 
 		// FIXME: this stopped working
 		// f := colorjson.NewFormatter()
@@ -230,19 +558,76 @@ func predictIndividualInputs(predictor predict.Predictor, inputFlags []string, o
 
 	// Write to stdout
 	if outputPath == "" {
+		if stdinFlag {
+			// Write exactly what the model returned, so it can be piped to another command
+			_, err := os.Stdout.Write(out)
+			return err
+		}
 		console.Output(string(out))
 		return nil
 	}
 
 	// Fall back to writing file
+	return writeOutput(indexedOutputPath(outputPath, index), out)
+}
 
-	// Ignore @, to make it behave the same as -i
-	outputPath = strings.TrimPrefix(outputPath, "@")
+// outputDirectory returns outputPath if it is a directory, creating it if it ends with a path separator.
+// It returns an empty string if outputPath is a file. An s3:// or gs:// URL is a directory if it ends with /.
+func outputDirectory(outputPath string) (string, error) {
+	if outputPath == "" {
+		return "", nil
+	}
+	if storage.IsURL(outputPath) {
+		if strings.HasSuffix(outputPath, "/") {
+			return outputPath, nil
+		}
+		return "", nil
+	}
+	outputPath, err := homedir.Expand(outputPath)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasSuffix(outputPath, "/") || strings.HasSuffix(outputPath, string(filepath.Separator)) {
+		if err := os.MkdirAll(outputPath, 0o755); err != nil {
+			return "", fmt.Errorf("Failed to create output directory %s: %w", outputPath, err)
+		}
+		return outputPath, nil
+	}
+	exists, err := files.Exists(outputPath)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", nil
+	}
+	isDir, err := files.IsDir(outputPath)
+	if err != nil || !isDir {
+		return "", err
+	}
+	return outputPath, nil
+}
+
+// indexedOutputPath adds index to a path before its extension, e.g. output.png -> output.1.png
+func indexedOutputPath(outputPath string, index int) string {
+	if index < 0 {
+		return outputPath
+	}
+	ext := filepath.Ext(outputPath)
+	return fmt.Sprintf("%s.%d%s", strings.TrimSuffix(outputPath, ext), index, ext)
+}
 
-	return writeOutput(outputPath, out)
+// joinOutputPath returns the path of the file name in the output directory dir, which can be an s3:// or gs:// URL
+func joinOutputPath(dir string, name string) string {
+	if storage.IsURL(dir) {
+		return dir + name
+	}
+	return filepath.Join(dir, name)
 }
 
 func writeOutput(outputPath string, output []byte) error {
+	if storage.IsURL(outputPath) {
+		return uploadOutput(outputPath, output)
+	}
 	outputPath, err := homedir.Expand(outputPath)
 	if err != nil {
 		return err
@@ -264,21 +649,36 @@ func writeOutput(outputPath string, output []byte) error {
 	return nil
 }
 
-func handleMultipleFileOutput(prediction *predict.Response, outputSchema *openapi3.Schema) error {
+// uploadOutput uploads output to url in object storage, and prints a signed URL it can be downloaded from
+func uploadOutput(url string, output []byte) error {
+	ctx := context.Background()
+	if err := storage.Upload(ctx, bytes.NewReader(output), url, mime.TypeByExtension(filepath.Ext(url))); err != nil {
+		return err
+	}
+	console.Infof("Uploaded output to %s", url)
+	signedURL, err := storage.SignURL(ctx, url, outputURLExpiry)
+	if err != nil {
+		// It's uploaded, so the output isn't lost
+		console.Warnf("%s", err)
+		return nil
+	}
+	console.Output(signedURL)
+	return nil
+}
+
+func handleMultipleFileOutput(prediction *predict.Response, outputSchema *openapi3.Schema, outputDir string, index int) error {
 	outputs, ok := (*prediction.Output).([]interface{})
 	if !ok {
 		return fmt.Errorf("Failed to decode output")
 	}
 
 	for i, output := range outputs {
-		outputString := output.(string)
-		dataurlObj, err := dataurl.DecodeString(outputString)
+		out, contentType, err := decodeFileOutput(output.(string))
 		if err != nil {
-			return fmt.Errorf("Failed to decode dataurl: %w", err)
+			return err
 		}
-		out := dataurlObj.Data
-		extension := mime.ExtensionByType(dataurlObj.ContentType())
-		outputPath := fmt.Sprintf("output.%d%s", i, extension)
+		extension := mime.ExtensionByType(contentType)
+		outputPath := indexedOutputPath(joinOutputPath(outputDir, fmt.Sprintf("output.%d%s", i, extension)), index)
 		if err := writeOutput(outputPath, out); err != nil {
 			return err
 		}
@@ -287,6 +687,47 @@ func handleMultipleFileOutput(prediction *predict.Response, outputSchema *openap
 	return nil
 }
 
+// decodeFileOutput returns the contents and content type of a file output, which is a data URL, or the URL the
+// model uploaded it to if it's running somewhere else and is set up to
+func decodeFileOutput(output string) ([]byte, string, error) {
+	if strings.HasPrefix(output, "http://") || strings.HasPrefix(output, "https://") {
+		resp, err := http.Get(output) //#nosec G107
+		if err != nil {
+			return nil, "", fmt.Errorf("Failed to download output from %s: %w", output, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, "", fmt.Errorf("Failed to download output from %s: status %d", output, resp.StatusCode)
+		}
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, "", fmt.Errorf("Failed to download output from %s: %w", output, err)
+		}
+		contentType, _, _ := strings.Cut(resp.Header.Get("Content-Type"), ";")
+		return data, contentType, nil
+	}
+	dataurlObj, err := dataurl.DecodeString(output)
+	if err != nil {
+		return nil, "", fmt.Errorf("Failed to decode dataurl: %w", err)
+	}
+	return dataurlObj.Data, dataurlObj.ContentType(), nil
+}
+
+// pullIfMissing pulls an image if it isn't on this machine already
+func pullIfMissing(imageName string) error {
+	exists, err := docker.ImageExists(imageName)
+	if err != nil {
+		return fmt.Errorf("Failed to determine if %s exists: %w", imageName, err)
+	}
+	if !exists {
+		console.Infof("Pulling image: %s", imageName)
+		if err := docker.Pull(imageName); err != nil {
+			return fmt.Errorf("Failed to pull %s: %w", imageName, err)
+		}
+	}
+	return nil
+}
+
 func parseInputFlags(inputs []string) (predict.Inputs, error) {
 	keyVals := map[string]string{}
 	for _, input := range inputs {
@@ -310,3 +751,159 @@ func parseInputFlags(inputs []string) (predict.Inputs, error) {
 
 	return predict.NewInputs(keyVals), nil
 }
+
+// parsePredictInputs combines the inputs from --example, if any, with the inputs passed with -i
+func parsePredictInputs() (predict.Inputs, error) {
+	inputs, err := parseInputFlags(inputFlags)
+	if err != nil {
+		return nil, err
+	}
+	if exampleFlag == "" {
+		return inputs, nil
+	}
+
+	projectDir, err := config.GetProjectDir(projectDirFlag)
+	if err != nil {
+		return nil, err
+	}
+	exampleInputs, err := predict.LoadExample(projectDir, exampleFlag)
+	if err != nil {
+		return nil, err
+	}
+	for name, input := range inputs {
+		exampleInputs[name] = input
+	}
+	return exampleInputs, nil
+}
+
+// fetchURLInputs downloads the http:// and https:// URLs passed to file inputs into the input cache, and passes the
+// cached files to the model instead, so the same URL isn't downloaded for every prediction
+func fetchURLInputs(predictor predict.Predictor, inputs predict.Inputs) (predict.Inputs, error) {
+	schema, err := predictor.GetSchema()
+	if err != nil {
+		return nil, err
+	}
+	var cache *predict.URLCache
+	for _, input := range card.Inputs(schema) {
+		value, ok := inputs[input.Name]
+		if !ok || input.Type != "file" || value.String == nil {
+			continue
+		}
+		if !strings.HasPrefix(*value.String, "http://") && !strings.HasPrefix(*value.String, "https://") {
+			continue
+		}
+		if cache == nil {
+			if cache, err = predict.NewURLCache(); err != nil {
+				return nil, err
+			}
+		}
+		path, err := cache.Fetch(context.Background(), *value.String)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to fetch input '%s': %w", input.Name, err)
+		}
+		inputs[input.Name] = predict.Input{File: &path}
+	}
+	return inputs, nil
+}
+
+// parseStdinInputs reads inputs from stdin. If stdin is a JSON object, it is used as the inputs,
+// otherwise it is passed as the model's only file input. It returns the path of the temporary
+// file holding stdin, which the caller must remove once the prediction has run.
+func parseStdinInputs(predictor predict.Predictor) (predict.Inputs, string, error) {
+	// Buffer stdin on disk so large inputs don't have to fit in memory
+	f, err := os.CreateTemp("", "cog-stdin-")
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, os.Stdin); err != nil {
+		return nil, f.Name(), fmt.Errorf("Failed to read stdin: %w", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, f.Name(), err
+	}
+
+	// Peek returns whatever is available if stdin is shorter than the buffer
+	start, _ := bufio.NewReader(f).Peek(512)
+	if bytes.HasPrefix(bytes.TrimSpace(start), []byte("{")) {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, f.Name(), err
+		}
+		if inputs, err := predict.NewInputsFromJSON(f); err == nil {
+			return inputs, f.Name(), nil
+		}
+		// Not JSON after all, so fall through and treat it as a file
+	}
+
+	schema, err := predictor.GetSchema()
+	if err != nil {
+		return nil, f.Name(), err
+	}
+	name, err := onlyFileInput(schema)
+	if err != nil {
+		return nil, f.Name(), err
+	}
+	path := f.Name()
+	return predict.Inputs{name: predict.Input{File: &path}}, path, nil
+}
+
+// onlyFileInput returns the name of the model's file input, if it has exactly one
+func onlyFileInput(schema *openapi3.T) (string, error) {
+	names := []string{}
+	if inputSchema, ok := schema.Components.Schemas["Input"]; ok && inputSchema.Value != nil {
+		for name, property := range inputSchema.Value.Properties {
+			if property.Value != nil && property.Value.Type == "string" && property.Value.Format == "uri" {
+				names = append(names, name)
+			}
+		}
+	}
+	if len(names) != 1 {
+		return "", fmt.Errorf("Raw data on stdin can only be used with models that have exactly one file input, but this model has %d. Pass a JSON object of inputs instead", len(names))
+	}
+	return names[0], nil
+}
+
+// configureServer makes the model's HTTP server require a token and serve HTTPS, if cfg configures it to, and
+// checks requests to it aren't larger than it accepts
+func configureServer(predictor *predict.Predictor, cfg *config.Config) error {
+	maxRequestSize, err := cfg.MaxRequestSizeBytes()
+	if err != nil {
+		return err
+	}
+	predictor.SetMaxRequestSize(maxRequestSize)
+	if cfg.Auth {
+		if err := predictor.RequireAuth(); err != nil {
+			return err
+		}
+	}
+	if cfg.TLSEnabled() {
+		if err := predictor.RequireTLS(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkResources checks the Docker host has the resources in cfg, so a model that needs more memory than the
+// machine has fails straight away instead of being killed during setup()
+func checkResources(cfg *config.Config, gpus string) error {
+	req, err := cfg.ResourceRequirements()
+	if err != nil || req.IsZero() {
+		return err
+	}
+	host, err := docker.DetectHostResources()
+	if err != nil {
+		console.Warnf("Not checking this machine has the resources the model needs: %s", err)
+		return nil
+	}
+	problems := host.Check(req, gpus != "")
+	if len(problems) == 0 {
+		return nil
+	}
+	message := "The model needs " + strings.Join(problems, ", and ")
+	if ignoreResourcesFlag {
+		console.Warn(message)
+		return nil
+	}
+	return fmt.Errorf("%s. Run it on a bigger machine, give Docker more resources, or pass --ignore-resources to run it anyway", message)
+}
@@ -0,0 +1,430 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/mitchellh/go-homedir"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/replicate/cog/pkg/card"
+	"github.com/replicate/cog/pkg/config"
+	cogerrors "github.com/replicate/cog/pkg/errors"
+	"github.com/replicate/cog/pkg/predict"
+	"github.com/replicate/cog/pkg/predictor"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// inputFlagsAnnotation marks the commands that take the model's inputs as flags, e.g. --num-steps 20
+const inputFlagsAnnotation = "cog_input_flags"
+
+// inputFlag is a flag that isn't one of the command's, so it's one of the model's inputs
+type inputFlag struct {
+	Name  string
+	Value string
+}
+
+// schemaInputFlags are the flags for the model's inputs, which are checked against its schema once it's known
+var schemaInputFlags []inputFlag
+
+// ownLongFlags are the command's own flags that were passed by their long name, e.g. output for --output, which
+// can't be told apart from flags for inputs with the same name
+var ownLongFlags []string
+
+// inputFlagsErr is why the flags for the model's inputs couldn't be split out of the arguments, which the command
+// returns before it does anything else
+var inputFlagsErr error
+
+// SplitInputFlags takes the flags for the model's inputs out of args, for commands that take them, because they
+// depend on the model's schema, which isn't known until the model is built. It returns the rest of args, for
+// cobra to parse. When args are a request for shell completions, it adds the inputs in the schema to the command
+// as flags instead, so they're completed like the command's own flags.
+func SplitInputFlags(root *cobra.Command, args []string) []string {
+	completing := len(args) > 0 && (args[0] == cobra.ShellCompRequestCmd || args[0] == cobra.ShellCompNoDescRequestCmd)
+	findArgs := args
+	if completing {
+		findArgs = args[1:]
+	}
+	cmd, cmdArgs, err := root.Find(findArgs)
+	if err != nil || cmd.Annotations[inputFlagsAnnotation] == "" {
+		return args
+	}
+	cmd.InitDefaultHelpFlag()
+
+	if completing {
+		if len(cmdArgs) == 0 {
+			return args
+		}
+		// The last argument is the one being completed
+		split, _ := splitInputFlags(cmd, cmdArgs[:len(cmdArgs)-1])
+		if schema, err := completionSchema(split.positional); err == nil {
+			addInputFlags(cmd, schema)
+		}
+		return args
+	}
+
+	split, err := splitInputFlags(cmd, args)
+	schemaInputFlags = split.inputs
+	ownLongFlags = split.ownLong
+	inputFlagsErr = err
+	return split.rest
+}
+
+// splitArgs are the arguments of a command that takes the model's inputs as flags, split up
+type splitArgs struct {
+	// rest are the arguments and flags the command has, and positional are the arguments in them
+	rest       []string
+	positional []string
+	// inputs are the flags for the model's inputs
+	inputs []inputFlag
+	// ownLong are the command's own flags that were passed by their long name
+	ownLong []string
+}
+
+// splitInputFlags splits args into the arguments and flags cmd has, and the flags for the model's inputs. Like
+// the command's own flags that aren't booleans, flags for inputs always take a value, either as --name=value or
+// --name value, whatever the input's type, because the types aren't known yet. So --fast my-image is --fast set
+// to my-image, and booleans are passed as --fast=true.
+func splitInputFlags(cmd *cobra.Command, args []string) (splitArgs, error) {
+	lookup := func(name string, shorthand bool) *pflag.Flag {
+		if shorthand {
+			if f := cmd.Flags().ShorthandLookup(name); f != nil {
+				return f
+			}
+			return cmd.InheritedFlags().ShorthandLookup(name)
+		}
+		if f := cmd.Flags().Lookup(name); f != nil {
+			return f
+		}
+		return cmd.InheritedFlags().Lookup(name)
+	}
+	// Flags that aren't booleans take the next argument as their value, unless it's passed as --flag=value
+	takesValue := func(name string, shorthand bool) bool {
+		f := lookup(name, shorthand)
+		return f != nil && f.NoOptDefVal == ""
+	}
+
+	split := splitArgs{}
+	var err error
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			split.rest = append(split.rest, args[i:]...)
+			split.positional = append(split.positional, args[i+1:]...)
+			return split, err
+
+		case strings.HasPrefix(arg, "--"):
+			name, value, hasValue := strings.Cut(arg[2:], "=")
+			if lookup(name, false) != nil {
+				split.rest = append(split.rest, arg)
+				split.ownLong = append(split.ownLong, name)
+				if !hasValue && takesValue(name, false) && i+1 < len(args) {
+					i++
+					split.rest = append(split.rest, args[i])
+				}
+				continue
+			}
+			if !hasValue {
+				if i+1 == len(args) {
+					if err == nil {
+						err = fmt.Errorf("--%s needs a value, e.g. --%[1]s=value. Flags for the model's inputs always take one, including booleans, e.g. --%[1]s=true", name)
+					}
+					continue
+				}
+				i++
+				value = args[i]
+			}
+			split.inputs = append(split.inputs, inputFlag{Name: name, Value: value})
+
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			split.rest = append(split.rest, arg)
+			// The value of a shorthand flag is either the rest of the argument, e.g. -iprompt=cat, or the next one
+			if len(arg) == 2 && takesValue(arg[1:], true) && i+1 < len(args) {
+				i++
+				split.rest = append(split.rest, args[i])
+			}
+
+		default:
+			split.rest = append(split.rest, arg)
+			split.positional = append(split.positional, arg)
+		}
+	}
+	return split, err
+}
+
+// inputFlagName is the flag for the input name, e.g. --num-steps for num_steps
+func inputFlagName(name string) string {
+	return strings.ReplaceAll(name, "_", "-")
+}
+
+// applyInputFlags adds the inputs passed as flags to inputs, once they're checked against the model's schema
+func applyInputFlags(predictor predict.Predictor, inputs predict.Inputs) (predict.Inputs, error) {
+	if len(schemaInputFlags) == 0 && len(ownLongFlags) == 0 {
+		return inputs, nil
+	}
+	schema, err := predictor.GetSchema()
+	if err != nil {
+		return nil, err
+	}
+	flagInputs, err := parseSchemaInputFlags(schema, schemaInputFlags, ownLongFlags)
+	if err != nil {
+		return nil, err
+	}
+	for name, input := range flagInputs {
+		for _, flag := range inputFlags {
+			if strings.HasPrefix(flag, name+"=") {
+				return nil, cogerrors.Usage(fmt.Errorf("The input '%s' was passed with both --%s and -i %s. Only pass it once", name, inputFlagName(name), name))
+			}
+		}
+		inputs[name] = input
+	}
+	return inputs, nil
+}
+
+// parseSchemaInputFlags checks the flags for inputs are inputs in schema, with valid values, and returns them as
+// inputs. ownLong are the command's own flags that were passed by their long name, which mustn't be the flags of
+// inputs.
+func parseSchemaInputFlags(schema *openapi3.T, flags []inputFlag, ownLong []string) (predict.Inputs, error) {
+	names := []string{}
+	for _, input := range card.Inputs(schema) {
+		names = append(names, input.Name)
+	}
+	if err := checkInputFlagNames(names, flags, ownLong); err != nil {
+		return nil, err
+	}
+	properties := openapi3.Schemas{}
+	if inputSchema, ok := schema.Components.Schemas["Input"]; ok && inputSchema.Value != nil {
+		properties = inputSchema.Value.Properties
+	}
+
+	inputs := predict.Inputs{}
+	for _, flag := range flags {
+		name := inputNameForFlag(names, flag.Name)
+		if _, ok := inputs[name]; ok {
+			return nil, cogerrors.Usage(fmt.Errorf("--%s was passed more than once", inputFlagName(name)))
+		}
+		input, err := parseInputFlagValue(name, properties[name].Value, flag.Value)
+		if err != nil {
+			return nil, cogerrors.Usage(err)
+		}
+		inputs[name] = input
+	}
+	return inputs, nil
+}
+
+// checkInputFlagNames checks the flags for inputs are for one of the inputs called names, and that none of the
+// command's own flags in ownLong are also the flag of an input, unless the input is passed with -i, so it's clear
+// the flag is the command's
+func checkInputFlagNames(names []string, flags []inputFlag, ownLong []string) error {
+	for _, flag := range flags {
+		if inputNameForFlag(names, flag.Name) == "" {
+			return cogerrors.Usage(unknownInputFlagError(flag.Name, names))
+		}
+	}
+	for _, flag := range ownLong {
+		name := inputNameForFlag(names, flag)
+		if name == "" {
+			continue
+		}
+		passedWithI := false
+		for _, input := range inputFlags {
+			if strings.HasPrefix(input, name+"=") {
+				passedWithI = true
+			}
+		}
+		if !passedWithI {
+			return cogerrors.Usage(fmt.Errorf("--%s is a flag of cog predict, but the model also has an input called %s, so it's unclear which you meant. Pass the input with -i %[2]s=value, which makes --%[1]s the flag of cog predict", flag, name))
+		}
+	}
+	return nil
+}
+
+// checkPredictorInputFlags checks the flags for inputs against the inputs of the project's predictor, which are
+// read from its source, so mistakes are found before the model is built. Their values are checked once it's built.
+func checkPredictorInputFlags(cfg *config.Config, projectDir string) error {
+	if (len(schemaInputFlags) == 0 && len(ownLongFlags) == 0) || cfg.Predict == "" {
+		return nil
+	}
+	names, err := predictor.Inputs(projectDir, cfg.Predict)
+	if err != nil {
+		console.Debugf("Failed to read the inputs of %s: %s", cfg.Predict, err)
+		return nil
+	}
+	if names == nil {
+		return nil
+	}
+	return checkInputFlagNames(names, schemaInputFlags, ownLongFlags)
+}
+
+// inputNameForFlag returns the input in names that flag is for, e.g. num_steps for num-steps, or "" if there
+// isn't one
+func inputNameForFlag(names []string, flag string) string {
+	for _, name := range names {
+		if flag == name || flag == inputFlagName(name) {
+			return name
+		}
+	}
+	return ""
+}
+
+func unknownInputFlagError(name string, inputs []string) error {
+	flags := []string{}
+	for _, input := range inputs {
+		flags = append(flags, "--"+inputFlagName(input))
+	}
+	if len(flags) == 0 {
+		return fmt.Errorf("Unknown flag: --%s. The model doesn't have any inputs", name)
+	}
+	return fmt.Errorf("Unknown flag: --%s. It isn't a flag of this command, or one of the model's inputs, which are %s", name, strings.Join(flags, ", "))
+}
+
+// parseInputFlagValue checks value is valid for the input name, which is described by property. Values of file
+// inputs are paths, or URLs.
+func parseInputFlagValue(name string, property *openapi3.Schema, value string) (predict.Input, error) {
+	flag := "--" + inputFlagName(name)
+	s := inputValueSchema(property)
+
+	var number *float64
+	switch s.Type {
+	case "integer":
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return predict.Input{}, fmt.Errorf("%s must be an integer, not '%s'", flag, value)
+		}
+		f := float64(n)
+		number = &f
+	case "number":
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return predict.Input{}, fmt.Errorf("%s must be a number, not '%s'", flag, value)
+		}
+		number = &f
+	case "boolean":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return predict.Input{}, fmt.Errorf("%s must be true or false, not '%s'. Flags for inputs always take a value, e.g. %[1]s=true", flag, value)
+		}
+		value = strconv.FormatBool(b)
+	case "string":
+		if s.Format == "uri" && !strings.HasPrefix(value, "http://") && !strings.HasPrefix(value, "https://") {
+			path, err := homedir.Expand(value)
+			if err != nil {
+				return predict.Input{}, fmt.Errorf("Failed to expand %s: %w", value, err)
+			}
+			if _, err := os.Stat(path); err != nil {
+				return predict.Input{}, fmt.Errorf("%s must be a file or a URL, but %s doesn't exist", flag, value)
+			}
+			return predict.Input{File: &path}, nil
+		}
+	}
+
+	if choices := inputChoices(s); len(choices) > 0 {
+		found := false
+		for _, choice := range choices {
+			if choice == value || (number != nil && choice == formatNumber(*number)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return predict.Input{}, fmt.Errorf("%s must be one of %s, not '%s'", flag, strings.Join(choices, ", "), value)
+		}
+	}
+	if number != nil {
+		if min := inputMinimum(property, s); min != nil && *number < *min {
+			return predict.Input{}, fmt.Errorf("%s must be at least %s, not %s", flag, formatNumber(*min), value)
+		}
+		if max := inputMaximum(property, s); max != nil && *number > *max {
+			return predict.Input{}, fmt.Errorf("%s must be at most %s, not %s", flag, formatNumber(*max), value)
+		}
+	}
+	return predict.Input{String: &value}, nil
+}
+
+// inputValueSchema returns the schema of an input's values. Inputs with choices refer to an enum schema.
+func inputValueSchema(property *openapi3.Schema) *openapi3.Schema {
+	if property.Type == "" && len(property.AllOf) > 0 && property.AllOf[0].Value != nil {
+		return property.AllOf[0].Value
+	}
+	return property
+}
+
+// inputChoices returns the values an input can have, as they'd be passed on the command line
+func inputChoices(s *openapi3.Schema) []string {
+	choices := []string{}
+	for _, choice := range s.Enum {
+		choices = append(choices, compactValue(choice))
+	}
+	return choices
+}
+
+func inputMinimum(property *openapi3.Schema, s *openapi3.Schema) *float64 {
+	if property.Min != nil {
+		return property.Min
+	}
+	return s.Min
+}
+
+func inputMaximum(property *openapi3.Schema, s *openapi3.Schema) *float64 {
+	if property.Max != nil {
+		return property.Max
+	}
+	return s.Max
+}
+
+// compactValue formats a value from the schema as it would be passed on the command line
+func compactValue(v interface{}) string {
+	if f, ok := v.(float64); ok {
+		return formatNumber(f)
+	}
+	return fmt.Sprint(v)
+}
+
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// addInputFlags adds the inputs in schema to cmd as flags, with their descriptions, and completions of their
+// choices. Inputs with the same name as one of cmd's flags can only be passed with -i.
+func addInputFlags(cmd *cobra.Command, schema *openapi3.T) {
+	inputSchema, ok := schema.Components.Schemas["Input"]
+	if !ok || inputSchema.Value == nil {
+		return
+	}
+	for _, input := range card.Inputs(schema) {
+		name := inputFlagName(input.Name)
+		if cmd.Flags().Lookup(name) != nil || cmd.InheritedFlags().Lookup(name) != nil {
+			continue
+		}
+		usage := input.Type
+		if input.Description != "" {
+			usage = input.Description + " (" + input.Type + ")"
+		}
+		s := inputValueSchema(inputSchema.Value.Properties[input.Name].Value)
+		// Booleans take a value too, like every flag for an input
+		cmd.Flags().String(name, "", usage)
+
+		choices := inputChoices(s)
+		if s.Type == "boolean" {
+			choices = []string{"true", "false"}
+		}
+		isFile := s.Type == "string" && s.Format == "uri"
+		_ = cmd.RegisterFlagCompletionFunc(name, func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if isFile {
+				return nil, cobra.ShellCompDirectiveDefault
+			}
+			completions := []string{}
+			for _, choice := range choices {
+				if strings.HasPrefix(choice, toComplete) {
+					completions = append(completions, choice)
+				}
+			}
+			return completions, cobra.ShellCompDirectiveNoFileComp
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/require"
+
+	cogerrors "github.com/replicate/cog/pkg/errors"
+)
+
+const inputFlagsSchema = `{
+  "openapi": "3.0.2",
+  "info": {"title": "Cog", "version": "0.1.0"},
+  "paths": {},
+  "components": {
+    "schemas": {
+      "Input": {
+        "type": "object",
+        "required": ["prompt"],
+        "properties": {
+          "prompt": {"type": "string", "description": "What to generate", "x-order": 0},
+          "num_steps": {"type": "integer", "minimum": 1, "maximum": 50, "default": 20, "x-order": 1},
+          "guidance": {"type": "number", "minimum": 0, "x-order": 2},
+          "fast": {"type": "boolean", "default": false, "x-order": 3},
+          "image": {"type": "string", "format": "uri", "x-order": 4},
+          "scheduler": {"allOf": [{"$ref": "#/components/schemas/scheduler"}], "default": "DDIM", "x-order": 5}
+        }
+      },
+      "scheduler": {"type": "string", "enum": ["DDIM", "K_EULER"]}
+    }
+  }
+}`
+
+func TestSplitInputFlags(t *testing.T) {
+	root, err := NewRootCommand()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		schemaInputFlags = nil
+		ownLongFlags = nil
+		inputFlagsErr = nil
+	})
+
+	args := SplitInputFlags(root, []string{"predict", "r8.im/me/model", "--prompt", "a cat", "-i", "seed=1", "--num-steps=20", "--fast=true", "--debug", "-o", "out.png"})
+	require.NoError(t, inputFlagsErr)
+	require.Equal(t, []string{"predict", "r8.im/me/model", "-i", "seed=1", "--debug", "-o", "out.png"}, args)
+	require.Equal(t, []inputFlag{
+		{Name: "prompt", Value: "a cat"},
+		{Name: "num-steps", Value: "20"},
+		{Name: "fast", Value: "true"},
+	}, schemaInputFlags)
+	require.Equal(t, []string{"debug"}, ownLongFlags)
+
+	// Commands that don't take inputs as flags are left to cobra
+	args = SplitInputFlags(root, []string{"build", "--prompt", "a cat"})
+	require.Equal(t, []string{"build", "--prompt", "a cat"}, args)
+
+	// A flag for an input at the end, without a value, is an error
+	SplitInputFlags(root, []string{"predict", "--prompt", "a cat", "--fast"})
+	require.EqualError(t, inputFlagsErr, "--fast needs a value, e.g. --fast=value. Flags for the model's inputs always take one, including booleans, e.g. --fast=true")
+}
+
+func TestSplitInputFlagsValues(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		args       []string
+		positional []string
+		inputs     []inputFlag
+		ownLong    []string
+	}{
+		{
+			name:       "bool input before the image",
+			args:       []string{"--fast", "true", "r8.im/me/model"},
+			positional: []string{"r8.im/me/model"},
+			inputs:     []inputFlag{{Name: "fast", Value: "true"}},
+		},
+		{
+			// Flags for inputs always take a value, so this is rejected once the input is known to be a boolean
+			name:   "bool input without a value before the image",
+			args:   []string{"--fast", "r8.im/me/model"},
+			inputs: []inputFlag{{Name: "fast", Value: "r8.im/me/model"}},
+		},
+		{
+			name:       "negative number",
+			args:       []string{"--guidance", "-1.5", "--num-steps=-2", "r8.im/me/model"},
+			positional: []string{"r8.im/me/model"},
+			inputs:     []inputFlag{{Name: "guidance", Value: "-1.5"}, {Name: "num-steps", Value: "-2"}},
+		},
+		{
+			name:       "predict flag with the name of an input",
+			args:       []string{"--output", "out.png", "-o", "other.png", "r8.im/me/model"},
+			positional: []string{"r8.im/me/model"},
+			ownLong:    []string{"output"},
+		},
+		{
+			name:       "everything after -- is positional",
+			args:       []string{"--prompt", "a cat", "--", "--fast"},
+			positional: []string{"--fast"},
+			inputs:     []inputFlag{{Name: "prompt", Value: "a cat"}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			split, err := splitInputFlags(newPredictCommand(), tc.args)
+			require.NoError(t, err)
+			require.Equal(t, tc.positional, split.positional)
+			require.Equal(t, tc.inputs, split.inputs)
+			require.Equal(t, tc.ownLong, split.ownLong)
+		})
+	}
+}
+
+func TestParseSchemaInputFlags(t *testing.T) {
+	schema, err := openapi3.NewLoader().LoadFromData([]byte(inputFlagsSchema))
+	require.NoError(t, err)
+	dir := t.TempDir()
+	imagePath := filepath.Join(dir, "cat.png")
+	require.NoError(t, os.WriteFile(imagePath, []byte("png"), 0o644))
+
+	inputs, err := parseSchemaInputFlags(schema, []inputFlag{
+		{Name: "prompt", Value: "a cat"},
+		{Name: "num-steps", Value: "20"},
+		{Name: "guidance", Value: "7.5"},
+		{Name: "fast", Value: "1"},
+		{Name: "image", Value: imagePath},
+		{Name: "scheduler", Value: "K_EULER"},
+	}, nil)
+	require.NoError(t, err)
+	require.Equal(t, "a cat", *inputs["prompt"].String)
+	require.Equal(t, "20", *inputs["num_steps"].String)
+	require.Equal(t, "7.5", *inputs["guidance"].String)
+	require.Equal(t, "true", *inputs["fast"].String)
+	require.Equal(t, imagePath, *inputs["image"].File)
+	require.Equal(t, "K_EULER", *inputs["scheduler"].String)
+
+	inputs, err = parseSchemaInputFlags(schema, []inputFlag{{Name: "image", Value: "https://example.com/cat.png"}}, nil)
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com/cat.png", *inputs["image"].String)
+
+	for _, tc := range []struct {
+		flag inputFlag
+		err  string
+	}{
+		{inputFlag{Name: "steps", Value: "20"}, "Unknown flag: --steps. It isn't a flag of this command, or one of the model's inputs, which are --prompt, --num-steps, --guidance, --fast, --image, --scheduler"},
+		{inputFlag{Name: "num-steps", Value: "many"}, "--num-steps must be an integer, not 'many'"},
+		{inputFlag{Name: "num-steps", Value: "0"}, "--num-steps must be at least 1, not 0"},
+		{inputFlag{Name: "num_steps", Value: "51"}, "--num-steps must be at most 50, not 51"},
+		{inputFlag{Name: "guidance", Value: "lots"}, "--guidance must be a number, not 'lots'"},
+		{inputFlag{Name: "fast", Value: "maybe"}, "--fast must be true or false, not 'maybe'"},
+		{inputFlag{Name: "fast", Value: "r8.im/me/model"}, "--fast must be true or false, not 'r8.im/me/model'. Flags for inputs always take a value, e.g. --fast=true"},
+		{inputFlag{Name: "guidance", Value: "-1.5"}, "--guidance must be at least 0, not -1.5"},
+		{inputFlag{Name: "scheduler", Value: "PNDM"}, "--scheduler must be one of DDIM, K_EULER, not 'PNDM'"},
+		{inputFlag{Name: "image", Value: filepath.Join(dir, "dog.png")}, "--image must be a file or a URL"},
+	} {
+		_, err := parseSchemaInputFlags(schema, []inputFlag{tc.flag}, nil)
+		require.ErrorContains(t, err, tc.err)
+		require.Equal(t, cogerrors.CodeUsage, cogerrors.Code(err))
+	}
+
+	_, err = parseSchemaInputFlags(schema, []inputFlag{{Name: "prompt", Value: "a"}, {Name: "prompt", Value: "b"}}, nil)
+	require.ErrorContains(t, err, "--prompt was passed more than once")
+}
+
+func TestInputFlagCollidesWithPredictFlag(t *testing.T) {
+	schema, err := openapi3.NewLoader().LoadFromData([]byte(inputFlagsSchema))
+	require.NoError(t, err)
+	schema.Components.Schemas["Input"].Value.Properties["output"] = openapi3.NewStringSchema().NewRef()
+	t.Cleanup(func() { inputFlags = nil })
+
+	// --output could be cog predict's flag, or the model's input
+	_, err = parseSchemaInputFlags(schema, nil, []string{"output"})
+	require.EqualError(t, err, "--output is a flag of cog predict, but the model also has an input called output, so it's unclear which you meant. Pass the input with -i output=value, which makes --output the flag of cog predict")
+	require.Equal(t, cogerrors.CodeUsage, cogerrors.Code(err))
+
+	// Flags that aren't inputs are fine
+	_, err = parseSchemaInputFlags(schema, nil, []string{"debug"})
+	require.NoError(t, err)
+
+	// Once the input is passed with -i, --output is cog predict's flag
+	inputFlags = []string{"output=cat.txt"}
+	_, err = parseSchemaInputFlags(schema, nil, []string{"output"})
+	require.NoError(t, err)
+}
+
+func TestCheckInputFlagNames(t *testing.T) {
+	require.NoError(t, checkInputFlagNames([]string{"prompt", "num_steps"}, []inputFlag{{Name: "num-steps", Value: "many"}}, nil))
+	err := checkInputFlagNames([]string{"prompt", "num_steps"}, []inputFlag{{Name: "steps", Value: "20"}}, nil)
+	require.EqualError(t, err, "Unknown flag: --steps. It isn't a flag of this command, or one of the model's inputs, which are --prompt, --num-steps")
+	require.Equal(t, cogerrors.CodeUsage, cogerrors.Code(err))
+}
+
+func TestAddInputFlags(t *testing.T) {
+	schema, err := openapi3.NewLoader().LoadFromData([]byte(inputFlagsSchema))
+	require.NoError(t, err)
+	cmd := newPredictCommand()
+	addInputFlags(cmd, schema)
+
+	require.Equal(t, "What to generate (string)", cmd.Flags().Lookup("prompt").Usage)
+	require.Equal(t, "string", cmd.Flags().Lookup("fast").Value.Type())
+	require.NotNil(t, cmd.Flags().Lookup("num-steps"))
+
+	complete, ok := cmd.GetFlagCompletionFunc("scheduler")
+	require.True(t, ok)
+	completions, _ := complete(cmd, nil, "K")
+	require.Equal(t, []string{"K_EULER"}, completions)
+
+	complete, ok = cmd.GetFlagCompletionFunc("fast")
+	require.True(t, ok)
+	completions, _ = complete(cmd, nil, "")
+	require.Equal(t, []string{"true", "false"}, completions)
+}
@@ -0,0 +1,156 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/card"
+	"github.com/replicate/cog/pkg/image"
+)
+
+// inputHelp describes an input of the model, for --help-inputs. Flag is empty if one of cog predict's flags has the
+// same name, so the input can only be passed with -i.
+type inputHelp struct {
+	Name        string        `json:"name"`
+	Flag        string        `json:"flag,omitempty"`
+	Type        string        `json:"type"`
+	Required    bool          `json:"required"`
+	Default     interface{}   `json:"default,omitempty"`
+	Minimum     *float64      `json:"minimum,omitempty"`
+	Maximum     *float64      `json:"maximum,omitempty"`
+	Choices     []interface{} `json:"choices,omitempty"`
+	Description string        `json:"description,omitempty"`
+}
+
+type inputsHelp struct {
+	Inputs []inputHelp `json:"inputs"`
+	Output string      `json:"output,omitempty"`
+}
+
+// printInputsHelp prints the inputs of the model that `cog predict` would run, without running it
+func printInputsHelp(cmd *cobra.Command, args []string) error {
+	if err := checkOutputFormat(); err != nil {
+		return err
+	}
+	schema, err := inputsHelpSchema(args)
+	if err != nil {
+		return err
+	}
+	help := newInputsHelp(cmd, schema)
+	if jsonOutput() {
+		return printJSON(help)
+	}
+	return writeInputsHelp(os.Stdout, help)
+}
+
+// inputsHelpSchema returns the schema of the model at --url, the image in args, or the image built from the
+// project, which is only read from the image, so the model doesn't have to be started
+func inputsHelpSchema(args []string) (*openapi3.T, error) {
+	if urlFlag != "" {
+		predictor, err := newRemotePredictor()
+		if err != nil {
+			return nil, err
+		}
+		return predictor.GetSchema()
+	}
+	if len(args) > 0 {
+		if err := pullIfMissing(args[0]); err != nil {
+			return nil, err
+		}
+	}
+	imageName, err := builtImage(args)
+	if err != nil {
+		return nil, err
+	}
+	return image.GetOpenAPISchema(imageName)
+}
+
+// newInputsHelp describes the model's inputs and output from its schema, in the order they're in the predictor, and
+// the flags of cmd they can be passed with
+func newInputsHelp(cmd *cobra.Command, schema *openapi3.T) inputsHelp {
+	help := inputsHelp{Inputs: []inputHelp{}, Output: card.OutputType(schema)}
+	inputSchema, ok := schema.Components.Schemas["Input"]
+	if !ok || inputSchema.Value == nil {
+		return help
+	}
+	for _, input := range card.Inputs(schema) {
+		property := inputSchema.Value.Properties[input.Name].Value
+		s := inputValueSchema(property)
+		h := inputHelp{
+			Name:        input.Name,
+			Type:        input.Type,
+			Required:    input.Required,
+			Default:     property.Default,
+			Minimum:     inputMinimum(property, s),
+			Maximum:     inputMaximum(property, s),
+			Choices:     s.Enum,
+			Description: input.Description,
+		}
+		if name := inputFlagName(input.Name); cmd.Flags().Lookup(name) == nil && cmd.InheritedFlags().Lookup(name) == nil {
+			h.Flag = "--" + name
+		}
+		// The choices are listed on their own, rather than in the type
+		if len(s.Enum) > 0 {
+			h.Type = s.Type
+		}
+		help.Inputs = append(help.Inputs, h)
+	}
+	return help
+}
+
+// writeInputsHelp writes the inputs as a table, with how to pass them
+func writeInputsHelp(out io.Writer, help inputsHelp) error {
+	if len(help.Inputs) == 0 {
+		fmt.Fprintln(out, "The model has no inputs")
+	} else {
+		w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "INPUT\tFLAG\tTYPE\tDEFAULT\tALLOWED\tDESCRIPTION")
+		for _, input := range help.Inputs {
+			flag := input.Flag
+			if flag == "" {
+				flag = "-i " + input.Name + "=..."
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", input.Name, flag, input.Type, input.defaultText(), input.allowedText(), input.Description)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		fmt.Fprintln(out, "\nInputs can be passed with their flags, or with -i name=value.")
+	}
+	if help.Output != "" {
+		fmt.Fprintf(out, "\nOutput: %s\n", help.Output)
+	}
+	return nil
+}
+
+// defaultText is the input's default, or whether it must be passed
+func (h inputHelp) defaultText() string {
+	if h.Default != nil {
+		return compactValue(h.Default)
+	}
+	if h.Required {
+		return "(required)"
+	}
+	return ""
+}
+
+// allowedText describes the values the input can have, e.g. "1 to 50", ">= 0" or "DDIM, K_EULER"
+func (h inputHelp) allowedText() string {
+	switch {
+	case len(h.Choices) > 0:
+		return strings.Join(inputChoices(&openapi3.Schema{Enum: h.Choices}), ", ")
+	case h.Minimum != nil && h.Maximum != nil:
+		return formatNumber(*h.Minimum) + " to " + formatNumber(*h.Maximum)
+	case h.Minimum != nil:
+		return ">= " + formatNumber(*h.Minimum)
+	case h.Maximum != nil:
+		return "<= " + formatNumber(*h.Maximum)
+	}
+	return ""
+}
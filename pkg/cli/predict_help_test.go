@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInputsHelp(t *testing.T) {
+	schema, err := openapi3.NewLoader().LoadFromData([]byte(inputFlagsSchema))
+	require.NoError(t, err)
+	help := newInputsHelp(newPredictCommand(), schema)
+
+	var buf bytes.Buffer
+	require.NoError(t, writeInputsHelp(&buf, help))
+	lines := strings.Split(buf.String(), "\n")
+	for i, line := range lines {
+		// The table's columns are padded with spaces
+		lines[i] = strings.TrimRight(line, " ")
+	}
+	require.Equal(t, `INPUT       FLAG          TYPE      DEFAULT      ALLOWED         DESCRIPTION
+prompt      --prompt      string    (required)                   What to generate
+num_steps   --num-steps   integer   20           1 to 50
+guidance    --guidance    number                 >= 0
+fast        --fast        boolean   false
+image       --image       file
+scheduler   --scheduler   string    DDIM         DDIM, K_EULER
+
+Inputs can be passed with their flags, or with -i name=value.
+`, strings.Join(lines, "\n"))
+
+	out, err := json.Marshal(help.Inputs[1])
+	require.NoError(t, err)
+	require.JSONEq(t, `{"name": "num_steps", "flag": "--num-steps", "type": "integer", "required": false, "default": 20, "minimum": 1, "maximum": 50}`, string(out))
+	out, err = json.Marshal(help.Inputs[5])
+	require.NoError(t, err)
+	require.JSONEq(t, `{"name": "scheduler", "flag": "--scheduler", "type": "string", "required": false, "default": "DDIM", "choices": ["DDIM", "K_EULER"]}`, string(out))
+
+	// Inputs with the same name as one of cog predict's flags can only be passed with -i
+	schema.Components.Schemas["Input"].Value.Properties["output"] = openapi3.NewStringSchema().NewRef()
+	help = newInputsHelp(newPredictCommand(), schema)
+	require.Equal(t, "output", help.Inputs[0].Name)
+	require.Empty(t, help.Inputs[0].Flag)
+}
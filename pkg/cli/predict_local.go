@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/predict"
+	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/venv"
+)
+
+// predictLocalMetal runs predictions with the model in the current directory running on the host, in a virtualenv,
+// because containers on macOS can't use the GPU
+func predictLocalMetal(inputs predict.Inputs) error {
+	if runtime.GOOS != "darwin" || runtime.GOARCH != "arm64" {
+		return fmt.Errorf("--local-metal only works on Macs with Apple Silicon")
+	}
+	console.Warn("--local-metal is experimental. The model runs outside Docker, so it may behave differently to how it does in its image")
+
+	cfg, projectDir, err := config.GetConfig(projectDirFlag)
+	if err != nil {
+		return err
+	}
+	python, err := venv.Ensure(cfg, projectDir)
+	if err != nil {
+		return err
+	}
+
+	console.Info("")
+	console.Infof("Starting model with %s and running setup()...", python)
+
+	env := append(envFlags, seedEnvs()...)
+	// Run operations that MPS doesn't support yet on the CPU, instead of failing
+	env = append(env, "PYTORCH_ENABLE_MPS_FALLBACK=1")
+	if openaiFlag != "" {
+		env = append(env, "COG_OPENAI=true")
+	}
+	predictor := predict.NewLocalPredictor(predict.LocalOptions{
+		Python: python,
+		Dir:    projectDir,
+		Env:    env,
+	})
+
+	go func() {
+		captureSignal := make(chan os.Signal, 1)
+		signal.Notify(captureSignal, syscall.SIGINT)
+
+		<-captureSignal
+
+		console.Info("Stopping model...")
+		if err := predictor.Stop(); err != nil {
+			console.Warnf("Failed to stop model: %s", err)
+		}
+	}()
+
+	if err := predictor.Start(os.Stderr); err != nil {
+		return err
+	}
+	defer func() {
+		if err := predictor.Stop(); err != nil {
+			console.Warnf("Failed to stop model: %s", err)
+		}
+	}()
+
+	return runPredictions(predictor, inputs, cfg.MaxConcurrency())
+}
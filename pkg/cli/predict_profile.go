@@ -0,0 +1,42 @@
+package cli
+
+import (
+	"path/filepath"
+
+	"github.com/replicate/cog/pkg/predict"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// profiling returns whether --profile or --profile-torch are set
+func profiling() bool {
+	return profileFlag || profileTorch
+}
+
+// configureProfiling lets the predictor be profiled, if --profile is set. It must be called before the predictor
+// is started.
+func configureProfiling(predictor *predict.Predictor) error {
+	if !profiling() {
+		return nil
+	}
+	return predictor.EnableProfiling(profileDirFlag, profileTorch)
+}
+
+// startProfiler starts py-spy in the model's container, and returns a function that stops it and says where the
+// profiles were written
+func startProfiler(predictor predict.Predictor) (func() error, error) {
+	console.Info("Starting py-spy...")
+	stop, err := predictor.StartProfiler()
+	if err != nil {
+		return nil, err
+	}
+	return func() error {
+		if err := stop(); err != nil {
+			return err
+		}
+		console.Infof("Wrote flamegraph to %s", filepath.Join(profileDirFlag, "flamegraph.svg"))
+		if profileTorch {
+			console.Infof("Wrote PyTorch traces, which can be opened in chrome://tracing or https://ui.perfetto.dev, to %s", profileDirFlag)
+		}
+		return nil
+	}, nil
+}
@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/replicate/cog/pkg/card"
+	"github.com/replicate/cog/pkg/predict"
+)
+
+// promptMissingInputs asks for the model's required inputs that weren't passed with -i or --example
+func promptMissingInputs(predictor predict.Predictor, inputs predict.Inputs) (predict.Inputs, error) {
+	schema, err := predictor.GetSchema()
+	if err != nil {
+		return nil, err
+	}
+	return promptInputs(missingInputs(card.Inputs(schema), inputs), inputs, os.Stdin, os.Stderr)
+}
+
+// missingInputs returns the required inputs that aren't in inputs
+func missingInputs(schemaInputs []card.Input, inputs predict.Inputs) []card.Input {
+	missing := []card.Input{}
+	for _, input := range schemaInputs {
+		if _, ok := inputs[input.Name]; input.Required && !ok {
+			missing = append(missing, input)
+		}
+	}
+	return missing
+}
+
+// promptInputs reads a value for each of missing from r, asking for them on w, and adds them to inputs. Values of
+// file inputs are paths.
+func promptInputs(missing []card.Input, inputs predict.Inputs, r io.Reader, w io.Writer) (predict.Inputs, error) {
+	reader := bufio.NewReader(r)
+	for _, input := range missing {
+		prompt := fmt.Sprintf("%s (%s)", input.Name, input.Type)
+		if input.Description != "" {
+			prompt += " " + input.Description
+		}
+		value := ""
+		for value == "" {
+			fmt.Fprintf(w, "%s: ", prompt)
+			line, err := reader.ReadString('\n')
+			value = strings.TrimSpace(line)
+			if err == io.EOF && value == "" {
+				return nil, fmt.Errorf("Missing required input '%s'. Pass it with -i %s=...", input.Name, input.Name)
+			}
+			if err != nil && err != io.EOF {
+				return nil, fmt.Errorf("Failed to read input '%s': %w", input.Name, err)
+			}
+		}
+		if input.Type == "file" && !strings.HasPrefix(value, "@") {
+			value = "@" + value
+		}
+		for name, parsed := range predict.NewInputs(map[string]string{input.Name: value}) {
+			inputs[name] = parsed
+		}
+	}
+	return inputs, nil
+}
@@ -0,0 +1,37 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/card"
+	"github.com/replicate/cog/pkg/predict"
+)
+
+func TestPromptMissingInputs(t *testing.T) {
+	schemaInputs := []card.Input{
+		{Name: "prompt", Type: "string", Required: true, Description: "What to draw"},
+		{Name: "image", Type: "file", Required: true},
+		{Name: "steps", Type: "integer", Default: "50"},
+		{Name: "seed", Type: "integer", Required: true},
+	}
+	seed := "42"
+	inputs := predict.Inputs{"seed": predict.Input{String: &seed}}
+
+	missing := missingInputs(schemaInputs, inputs)
+	require.Len(t, missing, 2)
+
+	out := &bytes.Buffer{}
+	inputs, err := promptInputs(missing, inputs, strings.NewReader("\na cat\ninput.jpg\n"), out)
+	require.NoError(t, err)
+	require.Equal(t, "a cat", *inputs["prompt"].String)
+	require.Equal(t, "input.jpg", *inputs["image"].File)
+	require.Equal(t, "42", *inputs["seed"].String)
+	require.Equal(t, "prompt (string) What to draw: prompt (string) What to draw: image (file): ", out.String())
+
+	_, err = promptInputs(missing, predict.Inputs{}, strings.NewReader(""), out)
+	require.ErrorContains(t, err, "Missing required input 'prompt'")
+}
@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/replicate/cog/pkg/predict"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// predictRemote runs predictions with a model that is already running at urlFlag, e.g. a deployment, instead of
+// building and running one
+func predictRemote(inputs predict.Inputs) error {
+	predictor, err := newRemotePredictor()
+	if err != nil {
+		return err
+	}
+	console.Infof("Waiting for the model at %s to be ready...", urlFlag)
+	if err := predictor.Start(os.Stderr); err != nil {
+		return err
+	}
+	// The model limits how many predictions it runs at once itself
+	return runPredictions(predictor, inputs, parallelFlag)
+}
+
+// newRemotePredictor returns a predictor for the model at urlFlag, with the headers and certificates the flags set
+func newRemotePredictor() (predict.Predictor, error) {
+	header, err := remoteHeader()
+	if err != nil {
+		return predict.Predictor{}, err
+	}
+	predictor, err := predict.NewRemotePredictor(urlFlag, header)
+	if err != nil {
+		return predict.Predictor{}, err
+	}
+	if caCertFlag != "" {
+		certs, err := os.ReadFile(caCertFlag)
+		if err != nil {
+			return predict.Predictor{}, fmt.Errorf("Failed to read %s: %w", caCertFlag, err)
+		}
+		if err := predictor.TrustCertificates(certs); err != nil {
+			return predict.Predictor{}, fmt.Errorf("Failed to read %s: %w", caCertFlag, err)
+		}
+	}
+	return predictor, nil
+}
+
+// remoteHeader returns the headers in --header, and the token in --token or COG_PREDICT_TOKEN as a bearer token
+func remoteHeader() (http.Header, error) {
+	header := http.Header{}
+	for _, h := range headerFlags {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("Failed to parse header '%s', expected format is 'Name: value'", h)
+		}
+		header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	token := tokenFlag
+	if token == "" {
+		token = os.Getenv("COG_PREDICT_TOKEN")
+	}
+	if token != "" && header.Get("Authorization") == "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+	return header, nil
+}
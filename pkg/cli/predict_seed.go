@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/replicate/cog/pkg/card"
+	"github.com/replicate/cog/pkg/predict"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+const (
+	// seedEnv makes the worker seed Python's, NumPy's and PyTorch's random number generators before every
+	// prediction, see python/cog/server/seed.py
+	seedEnv = "COG_SEED"
+	// seedInput is the name of the input models conventionally take a seed in
+	seedInput = "seed"
+	// noSeed is the default of --seed, which doesn't set a seed
+	noSeed = -1
+)
+
+// seedEnvs returns the environment variables that pass --seed to the model's container
+func seedEnvs() []string {
+	if seedFlag == noSeed {
+		return nil
+	}
+	return []string{fmt.Sprintf("%s=%d", seedEnv, seedFlag)}
+}
+
+// applySeed passes --seed to the model as its seed input, if it has one
+func applySeed(predictor predict.Predictor, inputs predict.Inputs) (predict.Inputs, error) {
+	if seedFlag == noSeed {
+		return inputs, nil
+	}
+	schema, err := predictor.GetSchema()
+	if err != nil {
+		return nil, err
+	}
+	inputs, ok, err := seedInputs(card.Inputs(schema), inputs, seedFlag)
+	if err != nil {
+		return nil, err
+	}
+	if !ok && urlFlag != "" {
+		console.Warnf("The model doesn't have an integer '%s' input, so --seed has no effect on a model at --url", seedInput)
+	}
+	console.Infof("Using seed %d", seedFlag)
+	return inputs, nil
+}
+
+// seedInputs sets the seed input to seed, if the model has an integer seed input. It returns whether it did.
+func seedInputs(schemaInputs []card.Input, inputs predict.Inputs, seed int64) (predict.Inputs, bool, error) {
+	for _, input := range schemaInputs {
+		if input.Name != seedInput || input.Type != "integer" {
+			continue
+		}
+		if _, ok := inputs[seedInput]; ok {
+			return nil, false, fmt.Errorf("The seed is set with both --seed and -i %s, so pass only one of them", seedInput)
+		}
+		value := strconv.FormatInt(seed, 10)
+		inputs[seedInput] = predict.Input{String: &value}
+		return inputs, true, nil
+	}
+	return inputs, false, nil
+}
+
+// writeSeedMetadata records --seed in metadata.json next to the outputs, if they are written to a directory, so
+// the outputs can be reproduced
+func writeSeedMetadata(outputPath string) error {
+	if seedFlag == noSeed {
+		return nil
+	}
+	outputDir, err := outputDirectory(outputPath)
+	if err != nil || outputDir == "" {
+		return err
+	}
+	metadata, err := json.MarshalIndent(map[string]interface{}{"seed": seedFlag}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeOutput(joinOutputPath(outputDir, "metadata.json"), append(metadata, '\n'))
+}
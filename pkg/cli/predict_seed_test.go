@@ -0,0 +1,31 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/card"
+	"github.com/replicate/cog/pkg/predict"
+)
+
+func TestSeedInputs(t *testing.T) {
+	schemaInputs := []card.Input{
+		{Name: "prompt", Type: "string", Required: true},
+		{Name: "seed", Type: "integer"},
+	}
+	inputs, ok, err := seedInputs(schemaInputs, predict.Inputs{}, 42)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "42", *inputs["seed"].String)
+
+	seed := "7"
+	_, _, err = seedInputs(schemaInputs, predict.Inputs{"seed": predict.Input{String: &seed}}, 42)
+	require.ErrorContains(t, err, "both --seed and -i seed")
+
+	// Models without an integer seed input are only seeded with COG_SEED
+	inputs, ok, err = seedInputs([]card.Input{{Name: "seed", Type: "string"}}, predict.Inputs{}, 42)
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.Empty(t, inputs)
+}
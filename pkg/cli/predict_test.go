@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutputDirectory(t *testing.T) {
+	dir := t.TempDir()
+
+	outputDir, err := outputDirectory(dir)
+	require.NoError(t, err)
+	require.Equal(t, dir, outputDir)
+
+	outputDir, err = outputDirectory(filepath.Join(dir, "output.png"))
+	require.NoError(t, err)
+	require.Equal(t, "", outputDir)
+
+	outputDir, err = outputDirectory("s3://bucket/outputs/")
+	require.NoError(t, err)
+	require.Equal(t, "s3://bucket/outputs/", outputDir)
+	require.Equal(t, "s3://bucket/outputs/output.png", joinOutputPath(outputDir, "output.png"))
+
+	outputDir, err = outputDirectory("gs://bucket/output.png")
+	require.NoError(t, err)
+	require.Equal(t, "", outputDir)
+	require.Equal(t, "output.png", joinOutputPath(outputDir, "output.png"))
+}
+
+func TestProfileFlag(t *testing.T) {
+	root, err := NewRootCommand()
+	require.NoError(t, err)
+	t.Cleanup(func() { profileFlag = false })
+	predict, _, err := root.Find([]string{"predict"})
+	require.NoError(t, err)
+
+	// --profile is cog predict's own flag, not one every command has
+	require.Nil(t, root.PersistentFlags().Lookup("profile"))
+	require.NoError(t, predict.ParseFlags([]string{"--profile"}))
+	require.True(t, profileFlag)
+}
@@ -0,0 +1,125 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/predict"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var (
+	prefetchWeights      bool
+	prefetchWeightsCache string
+	prefetchWarmup       bool
+)
+
+// defaultWeightsCache is where weights are downloaded to in the container, see python/cog/weights.py
+const defaultWeightsCache = "/var/cache/cog/weights"
+
+func newPrefetchCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "prefetch <image>",
+		Short: "Get a machine ready to run a model, so it starts quickly",
+		Long: `Get a machine ready to run a model, so it starts quickly.
+
+It pulls all the layers of the image. With --weights, it also downloads
+the model's lazy weights into a cache on the machine, which containers
+share by mounting it at ` + defaultWeightsCache + `. With --warmup, it starts
+the model, waits for setup() and the warm-up predictions in cog.yaml to
+finish, and then stops it, so files the model reads are in the page cache.
+
+It exits when the machine is ready, so it can be run by the bootstrap
+scripts of the machines you deploy to.`,
+		Example: `cog prefetch --weights --warmup r8.im/your-username/hotdog-detector`,
+		RunE:    cmdPrefetch,
+		Args:    cobra.ExactArgs(1),
+	}
+
+	addGpusFlag(cmd)
+
+	cmd.Flags().BoolVar(&prefetchWeights, "weights", false, "Download the model's lazy weights and weights profiles into the weights cache")
+	cmd.Flags().StringVar(&prefetchWeightsCache, "weights-cache", defaultWeightsCache, "Directory on this machine to download weights into")
+	cmd.Flags().BoolVar(&prefetchWarmup, "warmup", false, "Start the model and wait for setup() and its warm-up predictions to finish")
+	cmd.Flags().StringArrayVarP(&envFlags, "env", "e", []string{}, "Environment variables, in the form name=value, e.g. COG_WEIGHTS_PROFILE=int8")
+
+	return cmd
+}
+
+func cmdPrefetch(cmd *cobra.Command, args []string) error {
+	imageName := args[0]
+
+	gpus, err := parseGpusFlag()
+	if err != nil {
+		return err
+	}
+
+	console.Infof("Pulling %s...", imageName)
+	if err := docker.Pull(imageName); err != nil {
+		return fmt.Errorf("Failed to pull %s: %w", imageName, err)
+	}
+
+	conf, err := image.GetConfig(imageName)
+	if err != nil {
+		return err
+	}
+
+	volumes := []docker.Volume{}
+	if prefetchWeights || prefetchWarmup {
+		if err := os.MkdirAll(prefetchWeightsCache, 0o755); err != nil {
+			return fmt.Errorf("Failed to create weights cache %s: %w", prefetchWeightsCache, err)
+		}
+		volumes = append(volumes, docker.Volume{Source: prefetchWeightsCache, Destination: defaultWeightsCache})
+	}
+
+	if prefetchWeights {
+		if conf.Weights == nil {
+			console.Infof("%s doesn't have lazy weights or weights profiles, so there are no weights to download", imageName)
+		} else {
+			console.Infof("Downloading weights into %s...", prefetchWeightsCache)
+			if err := docker.Run(docker.RunOptions{
+				Image:   imageName,
+				Env:     envFlags,
+				Volumes: volumes,
+				Args:    []string{"python", "-m", "cog.command.prefetch_weights"},
+			}); err != nil {
+				return fmt.Errorf("Failed to download weights: %w", err)
+			}
+		}
+	}
+
+	if prefetchWarmup {
+		if gpus == "" && conf.Build.GPU {
+			gpus = "all"
+		}
+		console.Infof("Starting %s and running setup() and warm-up predictions...", imageName)
+		predictor := predict.NewPredictor(docker.RunOptions{
+			GPUs:    gpus,
+			Image:   imageName,
+			Volumes: volumes,
+			Env:     envFlags,
+		})
+		// The image's HTTP server doesn't start without a token, if it requires one
+		if err := configureServer(&predictor, conf); err != nil {
+			return err
+		}
+		err := predictor.Start(os.Stderr)
+		if stopErr := predictor.Stop(); stopErr != nil {
+			console.Warnf("Failed to stop container: %s", stopErr)
+		}
+		if err != nil {
+			if errors.Is(err, docker.ErrMissingDeviceDriver) {
+				return fmt.Errorf("Failed to warm up %s, because Docker can't access a GPU: %w", imageName, err)
+			}
+			return fmt.Errorf("Failed to warm up %s: %w", imageName, err)
+		}
+	}
+
+	console.Infof("%s is ready to run on this machine", imageName)
+	return nil
+}
@@ -0,0 +1,136 @@
+package cli
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakePrefetchScript makes the fake docker act as if it has the image of a GPU model with lazy weights, whose
+// container serves on MODEL_PORT. The step in FAIL fails.
+const fakePrefetchScript = `case "$*" in
+"pull "*)
+  if [ "$FAIL" = pull ]; then echo "Error: pull access denied" >&2; exit 1; fi ;;
+"image inspect "*)
+  echo '[{"Config": {"Labels": {"run.cog.config": "{\"build\": {\"gpu\": true}, \"weights\": {\"lazy\": true}}"}}}]' ;;
+*"--detach"*)
+  echo abc123 ;;
+"run "*)
+  if [ "$FAIL" = weights ]; then echo "Error: connection reset" >&2; exit 1; fi ;;
+"port "*)
+  echo "0.0.0.0:$MODEL_PORT" ;;
+"container inspect "*)
+  echo '[{"State": {"Status": "running"}}]' ;;
+"container wait "*)
+  echo 0 ;;
+esac
+exit 0
+`
+
+// fakeModelServer serves the health check of a model whose setup() finishes with status, and points the fake
+// docker's container at it
+func fakeModelServer(t *testing.T, status string) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/health-check", r.URL.Path)
+		_, _ = w.Write([]byte(`{"status": "` + status + `"}`))
+	}))
+	t.Cleanup(server.Close)
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	t.Setenv("MODEL_PORT", u.Port())
+}
+
+func runPrefetch(args ...string) error {
+	cmd := newPrefetchCommand()
+	cmd.SetArgs(args)
+	cmd.SilenceUsage = true
+	cmd.SilenceErrors = true
+	return cmd.Execute()
+}
+
+// callIndex returns the index of the first call that contains s, or -1
+func callIndex(calls []string, s string) int {
+	for i, call := range calls {
+		if strings.Contains(call, s) {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestPrefetch(t *testing.T) {
+	fake := fakeDocker(t, fakePrefetchScript)
+	fakeModelServer(t, "READY")
+	cache := filepath.Join(t.TempDir(), "weights")
+
+	require.NoError(t, runPrefetch("--weights", "--warmup", "--weights-cache", cache, "r8.im/your-username/hotdog-detector"))
+	calls := dockerCalls(t, fake)
+
+	// The image is pulled, then the weights are downloaded, then the model is started to warm it up
+	pull := callIndex(calls, "pull r8.im/your-username/hotdog-detector")
+	weights := callIndex(calls, "cog.command.prefetch_weights")
+	warmup := callIndex(calls, "--detach")
+	stop := callIndex(calls, "container stop")
+	require.Equal(t, 0, pull, calls)
+	require.Greater(t, weights, pull, calls)
+	require.Greater(t, warmup, weights, calls)
+	require.Greater(t, stop, warmup, calls)
+
+	// Both share the weights cache on this machine, and the GPU is attached to warm up a GPU model
+	mount := "--mount type=bind,source=" + cache + ",destination=" + defaultWeightsCache
+	require.Contains(t, calls[weights], mount)
+	require.True(t, strings.HasSuffix(calls[weights], " r8.im/your-username/hotdog-detector python -m cog.command.prefetch_weights"), calls[weights])
+	require.Contains(t, calls[warmup], mount)
+	require.Contains(t, calls[warmup], "--gpus all")
+	require.DirExists(t, cache)
+}
+
+func TestPrefetchOnlyPulls(t *testing.T) {
+	fake := fakeDocker(t, fakePrefetchScript)
+
+	require.NoError(t, runPrefetch("r8.im/your-username/hotdog-detector"))
+	calls := dockerCalls(t, fake)
+	require.Equal(t, []string{
+		"pull r8.im/your-username/hotdog-detector",
+		"image inspect r8.im/your-username/hotdog-detector",
+	}, calls)
+}
+
+func TestPrefetchFailures(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		fail string
+		// status is the status of the model's health check once setup() finishes
+		status string
+		err    string
+		// notRun are parts of calls that mustn't be made after the step fails
+		notRun []string
+	}{
+		{name: "pull", fail: "pull", status: "READY", err: "Failed to pull r8.im/your-username/hotdog-detector", notRun: []string{"run "}},
+		{name: "weights", fail: "weights", status: "READY", err: "Failed to download weights", notRun: []string{"--detach"}},
+		{name: "warmup", status: "SETUP_FAILED", err: "Failed to warm up r8.im/your-username/hotdog-detector: Model setup failed"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := fakeDocker(t, fakePrefetchScript)
+			fakeModelServer(t, tt.status)
+			t.Setenv("FAIL", tt.fail)
+
+			err := runPrefetch("--weights", "--warmup", "--weights-cache", t.TempDir(), "r8.im/your-username/hotdog-detector")
+			require.ErrorContains(t, err, tt.err)
+			calls := dockerCalls(t, fake)
+			for _, s := range tt.notRun {
+				require.Equal(t, -1, callIndex(calls, s), calls)
+			}
+			if tt.name == "warmup" {
+				// The model is stopped even though it failed to start
+				require.NotEqual(t, -1, callIndex(calls, "container stop"))
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/predict"
+)
+
+func newPsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ps",
+		Short: "List models started with 'cog start'",
+		RunE:  cmdPs,
+		Args:  cobra.NoArgs,
+	}
+
+	return cmd
+}
+
+func cmdPs(cmd *cobra.Command, args []string) error {
+	runners, err := predict.ListRunners("")
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "CONTAINER\tPROJECT\tIMAGE\tPORT\tSTATUS")
+	for _, runner := range runners {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", shortContainerID(runner.ContainerID), runner.ProjectDir, runner.Image, runner.Port, runner.Status)
+	}
+	return w.Flush()
+}
+
+// shortContainerID returns the abbreviated form of a container ID that `docker ps` shows
+func shortContainerID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
@@ -1,33 +1,58 @@
 package cli
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/replicate/cog/pkg/config"
 	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/dockerfile"
 	"github.com/replicate/cog/pkg/global"
 	"github.com/replicate/cog/pkg/image"
 	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/util/version"
+)
+
+var (
+	pushAttest bool
+	pushBump   string
 )
 
 func newPushCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use: "push [IMAGE]",
 
-		Short:   "Build and push model in current directory to a Docker registry",
-		Example: `cog push r8.im/your-username/hotdog-detector`,
-		RunE:    push,
-		Args:    cobra.MaximumNArgs(1),
+		Short:             "Build and push model in current directory to a Docker registry",
+		Example:           `cog push r8.im/your-username/hotdog-detector`,
+		RunE:              interruptible(push),
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeImages,
 	}
 	addSecretsFlag(cmd)
 	addNoCacheFlag(cmd)
 	addSeparateWeightsFlag(cmd)
 	addSchemaFlag(cmd)
 	addUseCudaBaseImageFlag(cmd)
+	addProxyFlags(cmd)
+	addBuildArgFlag(cmd)
 	addDockerfileFlag(cmd)
+	addFormatFlag(cmd)
+	addSBOMFlag(cmd)
+	addProvenanceFlag(cmd)
+	addDebugOnFailureFlag(cmd)
+	addTimingsFlag(cmd)
+	addSignWeightsFlag(cmd)
+	addResumeFlag(cmd)
+	addTagStrategyFlag(cmd)
+	addFlattenFlag(cmd)
+	addOutputFormatFlag(cmd)
+	cmd.Flags().StringVar(&pushBump, "bump", "", "Increment the major, minor or patch part of the version in the VERSION file, and tag the image with it. The file is only updated if the push succeeds")
+	cmd.Flags().BoolVar(&pushAttest, "attest", false, "Sign the image's SLSA provenance and attach it to the pushed image with cosign")
 	addBuildProgressOutputFlag(cmd)
 
 	return cmd
@@ -48,20 +73,158 @@ func push(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("To push images, you must either set the 'image' option in cog.yaml or pass an image name as an argument. For example, 'cog push r8.im/your-username/hotdog-detector'")
 	}
 
-	if err := image.Build(cfg, projectDir, imageName, buildSecrets, buildNoCache, buildSeparateWeights, buildUseCudaBaseImage, buildProgressOutput, buildSchemaFile, buildDockerfileFile); err != nil {
+	if err := checkTagStrategy(); err != nil {
+		return err
+	}
+	if err := checkOutputFormat(); err != nil {
 		return err
 	}
+	if buildTagStrategy == tagStrategyContent {
+		if imageName, err = contentTaggedImage(cfg, projectDir, imageName); err != nil {
+			return err
+		}
+	}
 
-	console.Infof("\nPushing image '%s'...", imageName)
+	newVersion := ""
+	if pushBump != "" {
+		if buildTagStrategy == tagStrategyContent {
+			return fmt.Errorf("--bump can't be used with --tag-strategy %s", tagStrategyContent)
+		}
+		if newVersion, err = bumpedVersion(projectDir, pushBump); err != nil {
+			return err
+		}
+		if cfg.ImageTagTemplate == "" {
+			cfg.ImageTagTemplate = image.DefaultTagTemplate
+		}
+		if imageName, err = image.TemplatedImageName(cfg, projectDir, imageName, newVersion); err != nil {
+			return err
+		}
+	} else if buildTagStrategy != tagStrategyContent {
+		if imageName, err = templatedImageName(cfg, projectDir, imageName); err != nil {
+			return err
+		}
+	}
 
-	exitStatus := docker.Push(imageName)
+	startedOn := time.Now()
+	exitStatus := buildAndPush(cmd.Context(), cfg, projectDir, imageName)
+	if exitStatus == nil && newVersion != "" {
+		if err := config.WriteVersion(projectDir, newVersion); err != nil {
+			return err
+		}
+		console.Infof("Bumped the version in %s to %s", config.VersionFilename, newVersion)
+	}
 	if exitStatus == nil {
-		console.Infof("Image '%s' pushed", imageName)
 		replicatePrefix := fmt.Sprintf("%s/", global.ReplicateRegistryHost)
 		if strings.HasPrefix(imageName, replicatePrefix) {
 			replicatePage := fmt.Sprintf("https://%s", strings.Replace(imageName, global.ReplicateRegistryHost, global.ReplicateWebsiteHost, 1))
 			console.Infof("\nRun your model on Replicate:\n    %s", replicatePage)
 		}
+		if buildFormat == dockerfile.FormatVertex {
+			console.Infof("\nUpload your model to Vertex AI:\n    %s", vertexUploadCommand(imageName))
+		}
+		if jsonOutput() {
+			return printPushResult(imageName, startedOn)
+		}
 	}
 	return exitStatus
 }
+
+// pushResult is what `cog push --output-format json` prints
+type pushResult struct {
+	image.Summary
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+// printPushResult prints the image that was pushed as JSON, with its digest in the registry
+func printPushResult(imageName string, startedOn time.Time) error {
+	summary, err := image.Summarize(imageName, true)
+	if err != nil {
+		return err
+	}
+	return printJSON(pushResult{Summary: *summary, DurationSeconds: seconds(time.Since(startedOn))})
+}
+
+// bumpedVersion returns the version in the VERSION file in projectDir with part incremented. If there isn't a
+// VERSION file, the version is 0.0.0. A leading v is kept.
+func bumpedVersion(projectDir string, part string) (string, error) {
+	current, err := config.ReadVersion(projectDir)
+	if err != nil {
+		return "", err
+	}
+	if current == "" {
+		current = "0.0.0"
+	}
+	prefix := ""
+	if strings.HasPrefix(current, "v") {
+		prefix = "v"
+	}
+	v, err := version.NewVersion(strings.TrimPrefix(current, prefix))
+	if err != nil {
+		return "", fmt.Errorf("%s must have a semantic version, like 1.2.3: %w", config.VersionFilename, err)
+	}
+	bumped, err := v.Bump(part)
+	if err != nil {
+		return "", err
+	}
+	return prefix + bumped.String(), nil
+}
+
+func buildAndPush(ctx context.Context, cfg *config.Config, projectDir string, imageName string) error {
+	startedOn := time.Now()
+	dockerBuildArgs, err := buildArgs(cfg)
+	if err != nil {
+		return err
+	}
+	if alreadyBuilt(imageName) {
+		console.Infof("%s was already built from the same inputs, so it isn't built again", imageName)
+	} else if err := image.Build(ctx, cfg, projectDir, imageName, image.BuildOptions{
+		Secrets:           buildSecrets,
+		BuildArgs:         dockerBuildArgs,
+		NoCache:           buildNoCache,
+		SeparateWeights:   buildSeparateWeights,
+		UseCudaBaseImage:  buildUseCudaBaseImage,
+		ProgressOutput:    buildProgressOutput,
+		SchemaFile:        buildSchemaFile,
+		DockerfileFile:    buildDockerfileFile,
+		Format:            buildFormat,
+		SBOMFile:          buildSBOMFile,
+		DebugOnFailure:    buildDebugOnFailure,
+		Timings:           buildTimings,
+		WeightsSigningKey: weightsSigningKey(),
+		Resume:            buildResume,
+		Flatten:           buildFlatten,
+	}); err != nil {
+		return err
+	}
+
+	console.Infof("\nPushing image '%s'...", imageName)
+
+	if err := docker.Push(ctx, imageName); err != nil {
+		if errors.Is(err, context.Canceled) {
+			console.Info("The push was canceled. The registry keeps the layers that were pushed, so pushing again only sends the rest.")
+		}
+		return err
+	}
+	console.Infof("Image '%s' pushed", imageName)
+
+	if buildProvenanceFile == "" && !pushAttest {
+		return nil
+	}
+	statement, err := image.Provenance(projectDir, imageName, true, buildFormat, startedOn, time.Now())
+	if err != nil {
+		return err
+	}
+	if buildProvenanceFile != "" {
+		if err := writeProvenance(statement, buildProvenanceFile); err != nil {
+			return err
+		}
+	}
+	if pushAttest {
+		ref := statement.Subject[0].Name + "@sha256:" + statement.Subject[0].Digest["sha256"]
+		console.Infof("Attaching provenance to %s...", ref)
+		if err := image.AttachProvenance(ref, statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
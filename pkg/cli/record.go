@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/predict"
+	"github.com/replicate/cog/pkg/replay"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var (
+	recordName      string
+	fixturesDirFlag string
+)
+
+func newRecordCommand() *cobra.Command {
+	// It runs a prediction the same way as `cog predict`, so it has the same flags
+	cmd := newPredictCommand()
+	cmd.Use = "record [image]"
+	cmd.Short = "Run a prediction and record it as a fixture for `cog replay`"
+	cmd.Long = `Run a prediction and record it as a fixture for 'cog replay'.
+
+It runs the prediction like 'cog predict', and writes its inputs and
+output to the fixtures directory, with copies of the files in them.
+'cog replay' runs the fixtures again and checks the model still returns
+the same outputs, so they make a regression suite for new builds.`
+	cmd.Example = `cog record --name hotdog -i image=@hotdog.jpg`
+	cmd.SuggestFor = nil
+	cmd.RunE = cmdRecord
+
+	cmd.Flags().StringVar(&recordName, "name", "", "Name of the fixture, which replaces a fixture with the same name")
+	addFixturesDirFlag(cmd)
+	_ = cmd.MarkFlagRequired("name")
+	for _, name := range []string{"url", "header", "token", "ca-cert", "openai", "parallel", "stdin", "help-inputs", "output-format"} {
+		_ = cmd.Flags().MarkHidden(name)
+	}
+	return cmd
+}
+
+func addFixturesDirFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&fixturesDirFlag, "fixtures-dir", "", "Directory of fixtures. Defaults to "+replay.DefaultDir+"/ in the project")
+}
+
+func cmdRecord(cmd *cobra.Command, args []string) error {
+	if urlFlag != "" || openaiFlag != "" || parallelFlag > 1 || stdinFlag {
+		return fmt.Errorf("cog record records a single prediction on a model it runs, so it can't be used with --url, --openai, --parallel or --stdin")
+	}
+	return cmdPredict(cmd, args)
+}
+
+// fixturesDir returns the directory of fixtures in --fixtures-dir, or the project's fixtures directory
+func fixturesDir() (string, error) {
+	if fixturesDirFlag != "" {
+		return fixturesDirFlag, nil
+	}
+	projectDir, err := config.GetProjectDir(projectDirFlag)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(projectDir, replay.DefaultDir), nil
+}
+
+// recordFixture writes the prediction to the fixture in --name, if this is `cog record`
+func recordFixture(inputs predict.Inputs, prediction *predict.Response) error {
+	if recordName == "" {
+		return nil
+	}
+	if prediction.Status != "succeeded" {
+		return fmt.Errorf("The prediction %s, so it wasn't recorded: %s", prediction.Status, prediction.Error)
+	}
+	dir, err := fixturesDir()
+	if err != nil {
+		return err
+	}
+	var output interface{}
+	if prediction.Output != nil {
+		output = *prediction.Output
+	}
+	if err := replay.Record(dir, recordName, inputs, output); err != nil {
+		return fmt.Errorf("Failed to record fixture: %w", err)
+	}
+	console.Infof("Recorded fixture %s in %s", recordName, dir)
+	return nil
+}
@@ -0,0 +1,171 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/predict"
+	"github.com/replicate/cog/pkg/replay"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var (
+	replayFixtures      []string
+	replayTolerance     float64
+	replayImageDistance int
+)
+
+func newReplayCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "replay [image]",
+		Short: "Run the fixtures recorded by `cog record` and check the outputs haven't changed",
+		Long: `Run the fixtures recorded by 'cog record' and check the outputs haven't changed.
+
+If 'image' is passed, it runs the fixtures on that Docker image. Otherwise,
+it builds the model in the current directory and runs them on that.
+
+Outputs must be the same as the recorded ones, except that numbers can
+differ by --tolerance, and images by --image-distance bits of their
+perceptual hashes, so models that aren't bit-for-bit deterministic still
+pass. It exits with an error if any fixture fails.`,
+		Example:           `cog replay --tolerance 0.001`,
+		RunE:              cmdReplay,
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeImages,
+	}
+
+	addUseCudaBaseImageFlag(cmd)
+	addProxyFlags(cmd)
+	addBuildArgFlag(cmd)
+	addBuildProgressOutputFlag(cmd)
+	addDockerfileFlag(cmd)
+	addGpusFlag(cmd)
+	addFixturesDirFlag(cmd)
+
+	cmd.Flags().StringArrayVar(&replayFixtures, "fixture", []string{}, "Name of a fixture to run. Defaults to all of them")
+	cmd.Flags().Float64Var(&replayTolerance, "tolerance", replay.DefaultOptions.Tolerance, "How much numbers in outputs can differ from the recorded ones")
+	cmd.Flags().IntVar(&replayImageDistance, "image-distance", replay.DefaultOptions.ImageDistance, "How many bits of their 64-bit perceptual hashes images in outputs can differ by from the recorded ones")
+	cmd.Flags().DurationVar(&timeoutFlag, "timeout", 0, "Cancel each prediction if it hasn't finished after this long, e.g. 30s or 5m")
+	cmd.Flags().StringArrayVarP(&envFlags, "env", "e", []string{}, "Environment variables, in the form name=value")
+
+	return cmd
+}
+
+func cmdReplay(cmd *cobra.Command, args []string) error {
+	dir, err := fixturesDir()
+	if err != nil {
+		return err
+	}
+	names := replayFixtures
+	if len(names) == 0 {
+		if names, err = replay.List(dir); err != nil {
+			return fmt.Errorf("Failed to list fixtures in %s: %w", dir, err)
+		}
+		if len(names) == 0 {
+			return fmt.Errorf("There are no fixtures in %s. Record some with `cog record`", dir)
+		}
+	}
+
+	gpus, err := parseGpusFlag()
+	if err != nil {
+		return err
+	}
+
+	imageName := ""
+	volumes := []docker.Volume{}
+	var cfg *config.Config
+	if len(args) == 0 {
+		var projectDir string
+		cfg, projectDir, err = config.GetConfig(projectDirFlag)
+		if err != nil {
+			return err
+		}
+		dockerBuildArgs, err := buildArgs(cfg)
+		if err != nil {
+			return err
+		}
+		if imageName, err = image.BuildBase(cmd.Context(), cfg, projectDir, dockerBuildArgs, buildUseCudaBaseImage, buildProgressOutput); err != nil {
+			return err
+		}
+		// Base image doesn't have /src in it, so mount as volume
+		volumes = append(volumes, docker.Volume{
+			Source:      projectDir,
+			Destination: "/src",
+		})
+	} else {
+		imageName = args[0]
+		if cfg, err = image.GetConfig(imageName); err != nil {
+			return err
+		}
+	}
+	if gpus == "" && cfg.Build.GPU {
+		gpus = "all"
+	}
+
+	console.Info("")
+	console.Infof("Starting Docker image %s and running setup()...", imageName)
+	predictor := predict.NewPredictor(docker.RunOptions{
+		GPUs:    gpus,
+		Image:   imageName,
+		Volumes: volumes,
+		Env:     envFlags,
+	})
+	if err := configureServer(&predictor, cfg); err != nil {
+		return err
+	}
+	if err := predictor.Start(os.Stderr); err != nil {
+		return err
+	}
+	defer func() {
+		console.Debugf("Stopping container...")
+		if err := predictor.Stop(); err != nil {
+			console.Warnf("Failed to stop container: %s", err)
+		}
+	}()
+
+	opts := replay.Options{Tolerance: replayTolerance, ImageDistance: replayImageDistance}
+	failed := 0
+	for _, name := range names {
+		differences, err := replayFixture(predictor, dir, name, opts)
+		if err != nil {
+			differences = []string{err.Error()}
+		}
+		if len(differences) == 0 {
+			console.Infof("PASS %s", name)
+			continue
+		}
+		failed++
+		console.Errorf("FAIL %s\n  %s", name, strings.Join(differences, "\n  "))
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d fixtures failed", failed, len(names))
+	}
+	console.Infof("All %d fixtures passed", len(names))
+	return nil
+}
+
+// replayFixture runs the prediction in a fixture and returns how its output differs from the recorded one
+func replayFixture(predictor predict.Predictor, dir string, name string, opts replay.Options) ([]string, error) {
+	fixture, inputs, err := replay.Load(dir, name)
+	if err != nil {
+		return nil, err
+	}
+	prediction, err := predictor.PredictWithTimeout(inputs, timeoutFlag)
+	if err != nil {
+		return nil, err
+	}
+	if prediction.Status != "succeeded" {
+		return nil, fmt.Errorf("The prediction %s: %s", prediction.Status, prediction.Error)
+	}
+	var output interface{}
+	if prediction.Output != nil {
+		output = *prediction.Output
+	}
+	return replay.Compare(fixture, dir, name, output, opts), nil
+}
@@ -5,6 +5,9 @@ import (
 
 	"github.com/spf13/cobra"
 
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/errors"
 	"github.com/replicate/cog/pkg/global"
 	"github.com/replicate/cog/pkg/update"
 	"github.com/replicate/cog/pkg/util/console"
@@ -24,7 +27,11 @@ https://github.com/replicate/cog`,
       $ cog run echo hello world`,
 		Version: fmt.Sprintf("%s (built %s)", global.Version, global.BuildTime),
 		// This stops errors being printed because we print them in cmd/cog/cog.go
-		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			// Completions are run on every tab, so they shouldn't check for updates or load plugins
+			if cmd.Name() == cobra.ShellCompRequestCmd || cmd.Name() == cobra.ShellCompNoDescRequestCmd {
+				return nil
+			}
 			if global.Debug {
 				console.SetLevel(console.DebugLevel)
 			}
@@ -32,28 +39,76 @@ https://github.com/replicate/cog`,
 			if err := update.DisplayAndCheckForRelease(); err != nil {
 				console.Debugf("%s", err)
 			}
+			if err := applyDefaults(); err != nil {
+				return err
+			}
+			return loadHookPlugins()
 		},
 		SilenceErrors: true,
 	}
 	setPersistentFlags(&rootCmd)
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return errors.Usage(err)
+	})
 
 	rootCmd.AddCommand(
 		newBuildCommand(),
+		newCardCommand(),
+		newCICommand(),
+		newCompareCommand(),
+		newConfigCommand(),
+		newDaemonCommand(),
+		newDemoCommand(),
 		newDebugCommand(),
+		newDeployCommand(),
+		newExportCommand(),
+		newGCCommand(),
+		newImportCommand(),
 		newInitCommand(),
+		newInspectCommand(),
+		newLoadCommand(),
 		newLoginCommand(),
+		newMigrateCommand(),
+		newOutdatedCommand(),
+		newPlaygroundCommand(),
+		newPluginsCommand(),
 		newPredictCommand(),
+		newPrefetchCommand(),
+		newPsCommand(),
 		newPushCommand(),
+		newRecordCommand(),
+		newReplayCommand(),
 		newRunCommand(),
+		newSaveCommand(),
+		newSchemaCommand(),
+		newShellCommand(),
+		newStartCommand(),
+		newStopCommand(),
+		newTelemetryCommand(),
 		newTrainCommand(),
+		newUpdateCommand(),
 	)
 
 	return &rootCmd, nil
 }
 
+// applyDefaults applies the build settings in the defaults file. The cog.yaml keys in it are applied when
+// cog.yaml is loaded.
+func applyDefaults() error {
+	defaults, err := config.LoadDefaults()
+	if err != nil {
+		return err
+	}
+	docker.SetBuildOptions(docker.BuildOptions{
+		Builder:   defaults.Builder,
+		CacheFrom: defaults.Cache.From,
+		CacheTo:   defaults.Cache.To,
+	})
+	return nil
+}
+
 func setPersistentFlags(cmd *cobra.Command) {
 	cmd.PersistentFlags().BoolVar(&global.Debug, "debug", false, "Show debugging output")
-	cmd.PersistentFlags().BoolVar(&global.ProfilingEnabled, "profile", false, "Enable profiling")
+	cmd.PersistentFlags().BoolVar(&global.ErrorJSON, "error-json", false, "If the command fails, write the error to stderr as a JSON object with its code, message and exit code")
 	cmd.PersistentFlags().Bool("version", false, "Show version of Cog")
-	_ = cmd.PersistentFlags().MarkHidden("profile")
 }
@@ -1,6 +1,8 @@
 package cli
 
 import (
+	"errors"
+	"fmt"
 	"strconv"
 	"strings"
 
@@ -18,7 +20,30 @@ var (
 )
 
 func addGpusFlag(cmd *cobra.Command) {
-	cmd.Flags().StringVar(&gpusFlag, "gpus", "", "GPU devices to add to the container, in the same format as `docker run --gpus`.")
+	cmd.Flags().StringVar(&gpusFlag, "gpus", "", "GPU devices to add to the container, in the same format as `docker run --gpus`, e.g. all, 2, device=1, device=0,1 or device=MIG-<uuid>.")
+}
+
+// parseGpusFlag checks the GPUs selected with --gpus exist on this machine, and returns
+// them in the form `docker run --gpus` expects
+func parseGpusFlag() (string, error) {
+	if gpusFlag == "" {
+		return "", nil
+	}
+	req, err := docker.ParseGPURequest(gpusFlag)
+	if err != nil {
+		return "", fmt.Errorf("Invalid --gpus: %w", err)
+	}
+
+	devices, err := docker.ListGPUDevices()
+	if errors.Is(err, docker.ErrNvidiaSMINotFound) {
+		// Docker may be running on another machine, so let it report any errors
+		console.Debug("nvidia-smi not found, so not checking the GPUs passed to --gpus exist")
+	} else if err != nil {
+		console.Warnf("Failed to check the GPUs passed to --gpus exist: %s", err)
+	} else if err := req.Validate(devices); err != nil {
+		return "", err
+	}
+	return req.String(), nil
 }
 
 func newRunCommand() *cobra.Command {
@@ -31,6 +56,8 @@ func newRunCommand() *cobra.Command {
 	addBuildProgressOutputFlag(cmd)
 	addDockerfileFlag(cmd)
 	addUseCudaBaseImageFlag(cmd)
+	addProxyFlags(cmd)
+	addBuildArgFlag(cmd)
 	addGpusFlag(cmd)
 
 	flags := cmd.Flags()
@@ -51,15 +78,20 @@ func run(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	imageName, err := image.BuildBase(cfg, projectDir, buildUseCudaBaseImage, buildProgressOutput)
+	dockerBuildArgs, err := buildArgs(cfg)
+	if err != nil {
+		return err
+	}
+	imageName, err := image.BuildBase(cmd.Context(), cfg, projectDir, dockerBuildArgs, buildUseCudaBaseImage, buildProgressOutput)
 	if err != nil {
 		return err
 	}
 
-	gpus := ""
-	if gpusFlag != "" {
-		gpus = gpusFlag
-	} else if cfg.Build.GPU {
+	gpus, err := parseGpusFlag()
+	if err != nil {
+		return err
+	}
+	if gpus == "" && cfg.Build.GPU {
 		gpus = "all"
 	}
 
@@ -0,0 +1,108 @@
+package cli
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/weights"
+)
+
+var saveOutput string
+
+func newSaveCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "save [IMAGE]",
+		Short: "Save the model to a single archive that can be loaded with `cog load`",
+		Long: `Save the model to a single archive that can be loaded with 'cog load'.
+
+The archive contains the Docker image, in the format 'docker save' writes,
+along with the model's cog.yaml, OpenAPI schema and weights manifest. Copy
+it to a machine without access to a registry, such as an air-gapped one,
+and load it there with 'cog load'.
+
+If 'image' is passed, it saves that Docker image, which must have been
+built by Cog. Otherwise, it builds the model in the current directory and
+saves that.`,
+		Example:           `cog save -o hotdog-detector.tar.gz`,
+		RunE:              interruptible(cmdSave),
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeImages,
+	}
+	addSecretsFlag(cmd)
+	addNoCacheFlag(cmd)
+	addSchemaFlag(cmd)
+	addUseCudaBaseImageFlag(cmd)
+	addProxyFlags(cmd)
+	addBuildArgFlag(cmd)
+	addDockerfileFlag(cmd)
+	addBuildProgressOutputFlag(cmd)
+
+	cmd.Flags().StringVarP(&saveOutput, "output", "o", "", "Path of the archive. If it ends with .gz or .tgz, it is compressed. Defaults to the name of the image with .tar")
+
+	return cmd
+}
+
+func cmdSave(cmd *cobra.Command, args []string) error {
+	imageName := ""
+	var weightsManifest *weights.Manifest
+	if len(args) > 0 {
+		imageName = args[0]
+
+		// The weights are only in the image, so copy them out to find them
+		srcDir, err := os.MkdirTemp("", "cog-save-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(srcDir)
+		if err := docker.CopyFromImage(imageName, "/src/.", srcDir); err != nil {
+			return err
+		}
+		if weightsManifest, err = weights.ManifestForDir(srcDir); err != nil {
+			return err
+		}
+	} else {
+		cfg, projectDir, err := config.GetConfig(projectDirFlag)
+		if err != nil {
+			return err
+		}
+		imageName = cfg.Image
+		if imageName == "" {
+			imageName = config.DockerImageName(projectDir)
+		}
+		dockerBuildArgs, err := buildArgs(cfg)
+		if err != nil {
+			return err
+		}
+		if err := image.Build(cmd.Context(), cfg, projectDir, imageName, image.BuildOptions{
+			Secrets:          buildSecrets,
+			BuildArgs:        dockerBuildArgs,
+			NoCache:          buildNoCache,
+			UseCudaBaseImage: buildUseCudaBaseImage,
+			ProgressOutput:   buildProgressOutput,
+			SchemaFile:       buildSchemaFile,
+			DockerfileFile:   buildDockerfileFile,
+		}); err != nil {
+			return err
+		}
+		if weightsManifest, err = weights.ManifestForDir(projectDir); err != nil {
+			return err
+		}
+	}
+
+	archivePath := saveOutput
+	if archivePath == "" {
+		archivePath = nameFromImage(imageName) + ".tar"
+	}
+
+	console.Infof("Saving %s to %s...", imageName, archivePath)
+	if err := image.SaveArchive(imageName, archivePath, weightsManifest); err != nil {
+		return err
+	}
+	console.Infof("\nSaved %s to %s. Load it with:\n    cog load %s", imageName, archivePath, archivePath)
+	return nil
+}
@@ -0,0 +1,69 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/card"
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+func newSchemaCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "schema [IMAGE]",
+		Short: "Show the inputs and output of a model built by Cog",
+		Long: `Show the inputs and output of a model built by Cog.
+
+With --output-format json, it prints the model's OpenAPI schema.
+
+If 'image' isn't passed, it shows the image of the model in the current
+directory, which must have been built with 'cog build'.`,
+		Example: `cog schema
+cog schema r8.im/your-username/hotdog-detector --output-format json > openapi.json`,
+		RunE:              cmdSchema,
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeImages,
+	}
+	addOutputFormatFlag(cmd)
+	return cmd
+}
+
+func cmdSchema(cmd *cobra.Command, args []string) error {
+	if err := checkOutputFormat(); err != nil {
+		return err
+	}
+	imageName, err := builtImage(args)
+	if err != nil {
+		return err
+	}
+	schema, err := image.GetOpenAPISchema(imageName)
+	if err != nil {
+		return err
+	}
+	if jsonOutput() {
+		// The schema is printed as it is, rather than wrapped, so it can be used by OpenAPI tools
+		return printJSON(schema)
+	}
+
+	inputs := card.Inputs(schema)
+	if len(inputs) == 0 {
+		console.Output("The model has no inputs")
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "INPUT\tTYPE\tREQUIRED\tDEFAULT\tDESCRIPTION")
+		for _, input := range inputs {
+			fmt.Fprintf(w, "%s\t%s\t%t\t%s\t%s\n", input.Name, input.Type, input.Required, input.Default, input.Description)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	if output := card.OutputType(schema); output != "" {
+		console.Output("\nOutput: " + output)
+	}
+	return nil
+}
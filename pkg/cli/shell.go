@@ -0,0 +1,113 @@
+package cli
+
+import (
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// shellArgs opens bash, or sh in images that don't have bash
+var shellArgs = []string{"/bin/sh", "-c", "if command -v bash > /dev/null; then exec bash; else exec sh; fi"}
+
+func newShellCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "shell [IMAGE]",
+		Short: "Open a shell inside a Docker environment",
+		Long: `Open a shell inside a Docker environment.
+
+If IMAGE is passed, it opens a shell in that image. Otherwise, it builds the
+environment in cog.yaml and opens a shell in it with the current directory
+mounted at /src. The GPU is attached if the model uses one, and the environment
+variables the model's server runs with are set.`,
+		Example: `  cog shell
+  cog shell r8.im/your-username/hotdog-detector`,
+		RunE:              shell,
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeImages,
+	}
+	addBuildProgressOutputFlag(cmd)
+	addUseCudaBaseImageFlag(cmd)
+	addProxyFlags(cmd)
+	addBuildArgFlag(cmd)
+	addGpusFlag(cmd)
+	cmd.Flags().StringArrayVarP(&runPorts, "publish", "p", []string{}, "Publish a container's port to the host, e.g. -p 8000")
+	cmd.Flags().StringArrayVarP(&envFlags, "env", "e", []string{}, "Environment variables, in the form name=value")
+
+	return cmd
+}
+
+func shell(cmd *cobra.Command, args []string) error {
+	gpus, err := parseGpusFlag()
+	if err != nil {
+		return err
+	}
+
+	runOptions := docker.RunOptions{
+		Args: shellArgs,
+		Env:  envFlags,
+	}
+
+	if len(args) == 0 {
+		cfg, projectDir, err := config.GetConfig(projectDirFlag)
+		if err != nil {
+			return err
+		}
+		dockerBuildArgs, err := buildArgs(cfg)
+		if err != nil {
+			return err
+		}
+		if runOptions.Image, err = image.BuildBase(cmd.Context(), cfg, projectDir, dockerBuildArgs, buildUseCudaBaseImage, buildProgressOutput); err != nil {
+			return err
+		}
+		// Base image doesn't have /src in it, so mount as volume
+		runOptions.Volumes = []docker.Volume{{Source: projectDir, Destination: "/src"}}
+		runOptions.Workdir = "/src"
+		if gpus == "" && cfg.Build.GPU {
+			gpus = "all"
+		}
+	} else {
+		runOptions.Image = args[0]
+		if err := pullIfMissing(runOptions.Image); err != nil {
+			return err
+		}
+		conf, err := image.GetConfig(runOptions.Image)
+		if err != nil {
+			return err
+		}
+		if gpus == "" && conf.Build.GPU {
+			gpus = "all"
+		}
+	}
+	runOptions.GPUs = gpus
+
+	for _, portString := range runPorts {
+		port, err := strconv.Atoi(portString)
+		if err != nil {
+			return err
+		}
+		runOptions.Ports = append(runOptions.Ports, docker.Port{HostPort: port, ContainerPort: port})
+	}
+
+	console.Info("")
+	if len(args) == 0 {
+		console.Info("Opening a shell in Docker with the current directory mounted as a volume...")
+	} else {
+		console.Infof("Opening a shell in %s...", runOptions.Image)
+	}
+
+	err = docker.Run(runOptions)
+	// Only retry if the user didn't explicitly select a GPU with --gpus
+	if runOptions.GPUs == "all" && err == docker.ErrMissingDeviceDriver {
+		console.Info("Missing device driver, re-trying without GPU")
+
+		runOptions.GPUs = ""
+		err = docker.Run(runOptions)
+	}
+
+	return err
+}
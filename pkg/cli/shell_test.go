@@ -0,0 +1,129 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+// fakeDocker puts a docker command on PATH that records its arguments in the file calls next to it, one line per
+// call, and then runs script. It returns the directory it's in.
+func fakeDocker(t *testing.T, script string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("The fake docker command is a shell script")
+	}
+	dir := t.TempDir()
+	contents := "#!/bin/sh\ndir=\"$(dirname \"$0\")\"\necho \"$@\" >> \"$dir/calls\"\n" + script
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "docker"), []byte(contents), 0o755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return dir
+}
+
+// dockerCalls returns the arguments of each call to the fake docker in dir
+func dockerCalls(t *testing.T, dir string) []string {
+	t.Helper()
+	contents, err := os.ReadFile(filepath.Join(dir, "calls"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	require.NoError(t, err)
+	return strings.Split(strings.TrimSuffix(string(contents), "\n"), "\n")
+}
+
+// fakeImageScript makes the fake docker act as if it has the image of a GPU model, once it's been pulled
+const fakeImageScript = `case "$1 $2" in
+"image inspect")
+  if [ ! -f "$dir/pulled" ]; then echo "Error: No such image: $3" >&2; exit 1; fi
+  echo '[{"Config": {"Labels": {"run.cog.config": "{\"build\": {\"gpu\": true}}"}}}]' ;;
+"pull "*) touch "$dir/pulled" ;;
+esac
+`
+
+func projectWithConfig(t *testing.T, yaml string) string {
+	t.Helper()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cog.yaml"), []byte(yaml), 0o644))
+	projectDirFlag = dir
+	t.Cleanup(func() { projectDirFlag = "" })
+	return dir
+}
+
+func runShell(args ...string) error {
+	cmd := newShellCommand()
+	cmd.SetArgs(args)
+	cmd.SilenceUsage = true
+	cmd.SilenceErrors = true
+	return cmd.Execute()
+}
+
+func TestShellInProject(t *testing.T) {
+	fake := fakeDocker(t, "")
+	dir := projectWithConfig(t, "build:\n  gpu: true\n  python_version: \"3.11\"\n")
+
+	require.NoError(t, runShell("-e", "HF_HOME=/src/.cache", "-p", "8888"))
+	calls := dockerCalls(t, fake)
+	run := calls[len(calls)-1]
+	require.True(t, strings.HasPrefix(run, "run "), run)
+	// The environment is built without the project's files, so they're mounted at /src, where the shell starts
+	require.Contains(t, run, " --mount type=bind,source="+dir+",destination=/src ")
+	require.Contains(t, run, " --workdir /src ")
+	require.Contains(t, run, " --gpus all ")
+	require.Contains(t, run, " --env HF_HOME=/src/.cache ")
+	require.Contains(t, run, " --publish 8888:8888 ")
+	require.True(t, strings.HasSuffix(run, " "+config.BaseDockerImageName(dir)+" "+strings.Join(shellArgs, " ")), run)
+}
+
+func TestShellInCPUProject(t *testing.T) {
+	fake := fakeDocker(t, "")
+	projectWithConfig(t, "build:\n  python_version: \"3.11\"\n")
+
+	require.NoError(t, runShell())
+	calls := dockerCalls(t, fake)
+	require.NotContains(t, calls[len(calls)-1], "--gpus")
+}
+
+func TestShellInImage(t *testing.T) {
+	fake := fakeDocker(t, fakeImageScript)
+	projectWithConfig(t, "build:\n  python_version: \"3.11\"\n")
+
+	require.NoError(t, runShell("r8.im/your-username/hotdog-detector"))
+	calls := dockerCalls(t, fake)
+	// It's pulled because it isn't on this machine, and the GPU is attached because the model uses one
+	require.Equal(t, []string{
+		"image inspect r8.im/your-username/hotdog-detector",
+		"pull r8.im/your-username/hotdog-detector",
+		"image inspect r8.im/your-username/hotdog-detector",
+	}, calls[:3])
+	require.Len(t, calls, 4)
+	run := calls[3]
+	require.Contains(t, run, " --gpus all ")
+	// The project isn't mounted, because the image has its own code
+	require.NotContains(t, run, "/src")
+	require.NotContains(t, run, "--workdir")
+	require.True(t, strings.HasSuffix(run, " r8.im/your-username/hotdog-detector "+strings.Join(shellArgs, " ")), run)
+
+	// It's only pulled once
+	require.NoError(t, os.Remove(filepath.Join(fake, "calls")))
+	require.NoError(t, runShell("r8.im/your-username/hotdog-detector"))
+	calls = dockerCalls(t, fake)
+	require.Len(t, calls, 3)
+	require.Equal(t, "image inspect r8.im/your-username/hotdog-detector", calls[0])
+}
+
+func TestShellArgs(t *testing.T) {
+	fake := fakeDocker(t, fakeImageScript)
+	projectWithConfig(t, "build:\n  python_version: \"3.11\"\n")
+
+	require.Error(t, runShell("r8.im/your-username/hotdog-detector", "bash"))
+	require.Error(t, runShell("-p", "http", "r8.im/your-username/hotdog-detector"))
+	for _, call := range dockerCalls(t, fake) {
+		require.False(t, strings.HasPrefix(call, "run "), call)
+	}
+}
@@ -0,0 +1,146 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/predict"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+func newStartCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "start",
+		Short: "Start the model in the background",
+		Long: `Start the model in the background.
+
+It will build the model in the current directory and start it in a
+long-lived container. Later runs of 'cog predict' in this directory use
+the running model instead of starting a new container, so setup() only
+runs once.
+
+Run 'cog stop' to stop it.`,
+		RunE: cmdStart,
+		Args: cobra.NoArgs,
+	}
+
+	addUseCudaBaseImageFlag(cmd)
+	addProxyFlags(cmd)
+	addBuildArgFlag(cmd)
+	addBuildProgressOutputFlag(cmd)
+	addDockerfileFlag(cmd)
+	addGpusFlag(cmd)
+
+	cmd.Flags().StringArrayVarP(&envFlags, "env", "e", []string{}, "Environment variables, in the form name=value")
+
+	return cmd
+}
+
+func cmdStart(cmd *cobra.Command, args []string) error {
+	cfg, projectDir, err := config.GetConfig(projectDirFlag)
+	if err != nil {
+		return err
+	}
+
+	gpus, err := parseGpusFlag()
+	if err != nil {
+		return err
+	}
+
+	hash, err := image.ProjectHash(cfg, projectDir)
+	if err != nil {
+		return err
+	}
+	runner, err := predict.FindRunner(projectDir)
+	if err != nil {
+		return err
+	}
+	if runner != nil {
+		if runner.UpToDate(hash) {
+			console.Infof("The model is already running in container %s on port %d", shortContainerID(runner.ContainerID), runner.Port)
+			return nil
+		}
+		if err := stopOutdatedRunner(runner); err != nil {
+			return err
+		}
+	}
+
+	runner, err = startRunner(cmd, cfg, projectDir, hash, gpus)
+	if err != nil {
+		return err
+	}
+
+	console.Infof("The model is running in container %s on port %d", shortContainerID(runner.ContainerID), runner.Port)
+	if runner.TLSCert != "" {
+		console.Info("It serves HTTPS with a self-signed certificate for localhost, which 'cog predict' trusts.")
+	}
+	if runner.AuthToken != "" {
+		console.Infof("Requests to it need the header 'Authorization: Bearer %s'", runner.AuthToken)
+	}
+	console.Info("Run 'cog predict' to run predictions on it, and 'cog stop' to stop it.")
+	return nil
+}
+
+// startRunner builds the model in projectDir and starts it in a long-lived container, labelled with the hash of
+// its cog.yaml and code, so it can be restarted when they change
+func startRunner(cmd *cobra.Command, cfg *config.Config, projectDir string, hash string, gpus string) (*predict.Runner, error) {
+	dockerBuildArgs, err := buildArgs(cfg)
+	if err != nil {
+		return nil, err
+	}
+	imageName, err := image.BuildBase(cmd.Context(), cfg, projectDir, dockerBuildArgs, buildUseCudaBaseImage, buildProgressOutput)
+	if err != nil {
+		return nil, err
+	}
+
+	if gpus == "" && cfg.Build.GPU {
+		gpus = "all"
+	}
+
+	labels, err := predict.RunnerLabels(projectDir, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	console.Info("")
+	console.Infof("Starting Docker image %s and running setup()...", imageName)
+
+	predictor := predict.NewPredictor(docker.RunOptions{
+		GPUs:   gpus,
+		Image:  imageName,
+		Labels: labels,
+		// Base image doesn't have /src in it, so mount as volume
+		Volumes: []docker.Volume{{Source: projectDir, Destination: "/src"}},
+		Env:     envFlags,
+	})
+	if err := configureServer(&predictor, cfg); err != nil {
+		return nil, err
+	}
+	if err := predictor.Start(os.Stderr); err != nil {
+		_ = predictor.Stop()
+		return nil, err
+	}
+
+	runner, err := predict.FindRunner(projectDir)
+	if err != nil {
+		return nil, err
+	}
+	if runner == nil {
+		return nil, fmt.Errorf("The model stopped unexpectedly after it started")
+	}
+	return runner, nil
+}
+
+// stopOutdatedRunner stops a runner that was started before the project's cog.yaml or code changed
+func stopOutdatedRunner(runner *predict.Runner) error {
+	console.Infof("cog.yaml or the model's code has changed since it was started in container %s, so restarting it...", shortContainerID(runner.ContainerID))
+	if err := docker.StopWithTimeout(runner.ContainerID, stopTimeout(runner.ProjectDir)); err != nil {
+		return fmt.Errorf("Failed to stop container %s: %w", shortContainerID(runner.ContainerID), err)
+	}
+	return nil
+}
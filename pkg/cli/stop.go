@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/predict"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var stopAllFlag bool
+
+func newStopCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "stop",
+		Short: "Stop the model started with 'cog start'",
+		RunE:  cmdStop,
+		Args:  cobra.NoArgs,
+	}
+
+	cmd.Flags().BoolVar(&stopAllFlag, "all", false, "Stop the models started with 'cog start' in every project")
+
+	return cmd
+}
+
+func cmdStop(cmd *cobra.Command, args []string) error {
+	projectDir := ""
+	if !stopAllFlag {
+		var err error
+		if projectDir, err = config.GetProjectDir(projectDirFlag); err != nil {
+			return err
+		}
+	}
+
+	runners, err := predict.ListRunners(projectDir)
+	if err != nil {
+		return err
+	}
+	if len(runners) == 0 {
+		console.Info("No models are running")
+		return nil
+	}
+
+	for _, runner := range runners {
+		console.Infof("Stopping container %s for %s...", shortContainerID(runner.ContainerID), runner.ProjectDir)
+		if err := docker.StopWithTimeout(runner.ContainerID, stopTimeout(runner.ProjectDir)); err != nil {
+			return fmt.Errorf("Failed to stop container %s: %w", shortContainerID(runner.ContainerID), err)
+		}
+	}
+	return nil
+}
+
+// stopTimeout returns how long to give the model in projectDir to stop before it is killed,
+// allowing for the shutdown grace period in its cog.yaml
+func stopTimeout(projectDir string) time.Duration {
+	timeout := 3 * time.Second
+	cfg, _, err := config.GetConfig(projectDir)
+	if err != nil {
+		console.Debugf("Failed to read cog.yaml in %s: %s", projectDir, err)
+		return timeout
+	}
+	return time.Duration(cfg.ShutdownGracePeriod())*time.Second + timeout
+}
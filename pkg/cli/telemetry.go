@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/telemetry"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+func newTelemetryCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "telemetry",
+		Short: "Turn anonymized build statistics on or off",
+		Long: `Turn anonymized build statistics on or off.
+
+When telemetry is enabled, each build reports how long it took, how big the
+image is, and the category of error it failed with, if it did. Nothing that
+identifies you or your model is sent: no image names, paths, packages or error
+messages. It's off until you enable it, and every event is written to a local
+log before it's sent.`,
+	}
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   "status",
+			Short: "Show whether telemetry is enabled",
+			Args:  cobra.NoArgs,
+			RunE:  cmdTelemetryStatus,
+		},
+		&cobra.Command{
+			Use:   "enable",
+			Short: "Report anonymized build statistics",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				if err := telemetry.Enable(); err != nil {
+					return err
+				}
+				console.Info("Telemetry is enabled. Thank you!")
+				return cmdTelemetryStatus(cmd, args)
+			},
+		},
+		&cobra.Command{
+			Use:   "disable",
+			Short: "Stop reporting build statistics",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				if err := telemetry.Disable(); err != nil {
+					return err
+				}
+				console.Info("Telemetry is disabled.")
+				return nil
+			},
+		},
+	)
+	return cmd
+}
+
+func cmdTelemetryStatus(cmd *cobra.Command, args []string) error {
+	status, err := telemetry.GetStatus()
+	if err != nil {
+		return err
+	}
+	switch {
+	case status.Enabled:
+		console.Infof("Telemetry is enabled. Every event is written to %s before it's sent.", status.LogPath)
+	case status.DisabledBy != "":
+		console.Infof("Telemetry is enabled, but %s is set, so nothing is recorded.", status.DisabledBy)
+	default:
+		console.Info("Telemetry is disabled. Run 'cog telemetry enable' to report anonymized build statistics.")
+	}
+	return nil
+}
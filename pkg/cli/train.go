@@ -33,6 +33,8 @@ It will build the model in the current directory and train it.`,
 	addBuildProgressOutputFlag(cmd)
 	addDockerfileFlag(cmd)
 	addUseCudaBaseImageFlag(cmd)
+	addProxyFlags(cmd)
+	addBuildArgFlag(cmd)
 
 	cmd.Flags().StringArrayVarP(&trainInputFlags, "input", "i", []string{}, "Inputs, in the form name=value. if value is prefixed with @, then it is read from a file on disk. E.g. -i path=@image.jpg")
 
@@ -52,7 +54,11 @@ func cmdTrain(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	if imageName, err = image.BuildBase(cfg, projectDir, buildUseCudaBaseImage, buildProgressOutput); err != nil {
+	dockerBuildArgs, err := buildArgs(cfg)
+	if err != nil {
+		return err
+	}
+	if imageName, err = image.BuildBase(cmd.Context(), cfg, projectDir, dockerBuildArgs, buildUseCudaBaseImage, buildProgressOutput); err != nil {
 		return err
 	}
 
@@ -75,6 +81,9 @@ func cmdTrain(cmd *cobra.Command, args []string) error {
 		Volumes: volumes,
 		Args:    []string{"python", "-m", "cog.server.http", "--x-mode", "train"},
 	})
+	if err := configureServer(&predictor, cfg); err != nil {
+		return err
+	}
 
 	go func() {
 		captureSignal := make(chan os.Signal, 1)
@@ -100,5 +109,10 @@ func cmdTrain(cmd *cobra.Command, args []string) error {
 		}
 	}()
 
-	return predictIndividualInputs(predictor, trainInputFlags, weightsPath)
+	inputs, err := parseInputFlags(trainInputFlags)
+	if err != nil {
+		return err
+	}
+
+	return predictIndividualInputs(predictor, inputs, weightsPath)
 }
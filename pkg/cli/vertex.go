@@ -0,0 +1,26 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+)
+
+// vertexUploadCommand returns a gcloud command that uploads imageName as a Vertex AI model.
+// The region is taken from the Artifact Registry host if there is one.
+func vertexUploadCommand(imageName string) string {
+	region := "REGION"
+	host := strings.SplitN(imageName, "/", 2)[0]
+	if strings.HasSuffix(host, "-docker.pkg.dev") {
+		region = strings.TrimSuffix(host, "-docker.pkg.dev")
+	}
+
+	return strings.Join([]string{
+		"gcloud ai models upload",
+		fmt.Sprintf("--region=%s", region),
+		fmt.Sprintf("--display-name=%s", nameFromImage(imageName)),
+		fmt.Sprintf("--container-image-uri=%s", imageName),
+		"--container-ports=8080",
+		"--container-health-route=/health",
+		"--container-predict-route=/predict",
+	}, " \\\n        ")
+}
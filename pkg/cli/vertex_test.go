@@ -0,0 +1,19 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVertexUploadCommand(t *testing.T) {
+	require.Equal(t, `gcloud ai models upload \
+        --region=us-central1 \
+        --display-name=hotdog-detector \
+        --container-image-uri=us-central1-docker.pkg.dev/my-project/models/hotdog-detector:v1 \
+        --container-ports=8080 \
+        --container-health-route=/health \
+        --container-predict-route=/predict`, vertexUploadCommand("us-central1-docker.pkg.dev/my-project/models/hotdog-detector:v1"))
+
+	require.Contains(t, vertexUploadCommand("hotdog-detector"), "--region=REGION")
+}
@@ -0,0 +1,87 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/dockerfile"
+	"github.com/replicate/cog/pkg/image"
+)
+
+// BuildOptions configures Build. The zero value builds the model like `cog build` with no flags.
+type BuildOptions struct {
+	// Image is the name of the image to build. It defaults to the image in cog.yaml, or a name made from the
+	// model's directory.
+	Image string
+	// BuildArgs are extra build arguments, in the form 'name=value'
+	BuildArgs []string
+	// Secrets are passed to the build, in the form 'id=foo,src=/path/to/file'
+	Secrets []string
+	NoCache bool
+	// SeparateWeights puts the model's weights in their own layers
+	SeparateWeights bool
+	// UseCudaBaseImage is 'auto' if it's empty, 'true' or 'false'
+	UseCudaBaseImage string
+	// Format is how the image serves predictions, one of dockerfile.Formats. It defaults to Cog's HTTP API.
+	Format string
+	// ProgressOutput is Docker's progress output, 'plain' if it's empty, 'auto' or 'tty'
+	ProgressOutput string
+	Progress       Progress
+}
+
+// BuildResult is the image that Build built
+type BuildResult struct {
+	image.Summary
+	Duration time.Duration
+}
+
+// Build builds the model in dir, which has a cog.yaml
+func Build(ctx context.Context, dir string, opts BuildOptions) (*BuildResult, error) {
+	startedOn := time.Now()
+	cfg, projectDir, err := config.GetConfig(dir)
+	if err != nil {
+		return nil, err
+	}
+	imageName := opts.Image
+	if imageName == "" {
+		imageName = cfg.Image
+	}
+	if imageName == "" {
+		imageName = config.DockerImageName(projectDir)
+	}
+	buildArgs, err := cfg.BuildArgs(opts.BuildArgs)
+	if err != nil {
+		return nil, err
+	}
+	buildArgs = append(cfg.BuildProxy(config.Proxy{}).BuildArgs(), buildArgs...)
+	if opts.UseCudaBaseImage == "" {
+		opts.UseCudaBaseImage = "auto"
+	}
+	if opts.Format == "" {
+		opts.Format = dockerfile.FormatCog
+	}
+	if opts.ProgressOutput == "" {
+		opts.ProgressOutput = "plain"
+	}
+
+	opts.Progress.report(StageBuilding, imageName)
+	if err := image.Build(ctx, cfg, projectDir, imageName, image.BuildOptions{
+		Secrets:          opts.Secrets,
+		BuildArgs:        buildArgs,
+		NoCache:          opts.NoCache,
+		SeparateWeights:  opts.SeparateWeights,
+		UseCudaBaseImage: opts.UseCudaBaseImage,
+		ProgressOutput:   opts.ProgressOutput,
+		Format:           opts.Format,
+	}); err != nil {
+		return nil, err
+	}
+	opts.Progress.report(StageBuilt, imageName)
+
+	summary, err := image.Summarize(imageName, false)
+	if err != nil {
+		return nil, err
+	}
+	return &BuildResult{Summary: *summary, Duration: time.Since(startedOn)}, nil
+}
@@ -0,0 +1,42 @@
+// Package client is a Go API for building, pushing, running and inspecting Cog models, for services that embed
+// Cog's build pipeline instead of running the cog CLI.
+//
+// Each function takes options with a Progress callback, which is called as the operation moves through its stages.
+// Docker's own output, like the build log, still goes to stderr.
+package client
+
+import (
+	"time"
+)
+
+// Stage is a step of an operation, which is reported to Progress
+type Stage string
+
+const (
+	StageBuilding   Stage = "building"
+	StageBuilt      Stage = "built"
+	StagePushing    Stage = "pushing"
+	StagePushed     Stage = "pushed"
+	StageStarting   Stage = "starting"
+	StageStarted    Stage = "started"
+	StagePredicting Stage = "predicting"
+	StagePredicted  Stage = "predicted"
+	StageStopped    Stage = "stopped"
+)
+
+// Event is reported to Progress when an operation on an image moves to a new stage
+type Event struct {
+	Stage Stage     `json:"stage"`
+	Image string    `json:"image"`
+	Time  time.Time `json:"time"`
+}
+
+// Progress is called with each stage of an operation. It's called on the goroutine that runs the operation, so it
+// shouldn't block.
+type Progress func(Event)
+
+func (p Progress) report(stage Stage, imageName string) {
+	if p != nil {
+		p(Event{Stage: stage, Image: imageName, Time: time.Now()})
+	}
+}
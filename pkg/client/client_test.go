@@ -0,0 +1,33 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/errors"
+)
+
+func TestProgress(t *testing.T) {
+	var nilProgress Progress
+	nilProgress.report(StageBuilding, "hotdog")
+
+	events := []Event{}
+	progress := Progress(func(event Event) { events = append(events, event) })
+	progress.report(StageBuilding, "hotdog")
+	progress.report(StageBuilt, "hotdog")
+	require.Len(t, events, 2)
+	require.Equal(t, StageBuilding, events[0].Stage)
+	require.Equal(t, StageBuilt, events[1].Stage)
+	require.Equal(t, "hotdog", events[1].Image)
+	require.False(t, events[1].Time.IsZero())
+}
+
+func TestBuildWithoutConfig(t *testing.T) {
+	called := false
+	_, err := Build(context.Background(), t.TempDir(), BuildOptions{Progress: func(Event) { called = true }})
+	require.ErrorContains(t, err, "cog.yaml does not exist")
+	require.Equal(t, errors.CodeConfigInvalid, errors.Code(err))
+	require.False(t, called)
+}
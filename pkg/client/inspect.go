@@ -0,0 +1,51 @@
+package client
+
+import (
+	"fmt"
+
+	"github.com/getkin/kin-openapi/openapi3"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/image"
+)
+
+// Inspection describes an image built by Cog
+type Inspection struct {
+	image.Summary
+	// RepoDigests are the digests of the image in the registries it was pushed to or pulled from
+	RepoDigests []string       `json:"repo_digests"`
+	Created     string         `json:"created"`
+	Config      *config.Config `json:"config"`
+}
+
+// Inspect describes imageName, which must have been built by Cog
+func Inspect(imageName string) (*Inspection, error) {
+	summary, err := image.Summarize(imageName, false)
+	if err != nil {
+		return nil, err
+	}
+	inspect, err := docker.ImageInspect(imageName)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to inspect %s: %w", imageName, err)
+	}
+	cfg, err := image.GetConfig(imageName)
+	if err != nil {
+		return nil, err
+	}
+	inspection := &Inspection{
+		Summary:     *summary,
+		RepoDigests: inspect.RepoDigests,
+		Created:     inspect.Created,
+		Config:      cfg,
+	}
+	if inspection.RepoDigests == nil {
+		inspection.RepoDigests = []string{}
+	}
+	return inspection, nil
+}
+
+// Schema returns the OpenAPI schema of the model in imageName, which describes its inputs and output
+func Schema(imageName string) (*openapi3.T, error) {
+	return image.GetOpenAPISchema(imageName)
+}
@@ -0,0 +1,143 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/errors"
+	"github.com/replicate/cog/pkg/predict"
+)
+
+// RunOptions configures how Start runs a model
+type RunOptions struct {
+	// GPUs are the GPUs the model can use, in the form of docker run's --gpus, e.g. 'all'
+	GPUs string
+	// Env are extra environment variables, in the form 'NAME=value'
+	Env []string
+	// Logs is where the model's logs are written. They're discarded if it's nil.
+	Logs     io.Writer
+	Progress Progress
+}
+
+// Model is a model that's running in a container, which can run predictions until it's closed
+type Model struct {
+	image     string
+	predictor predict.Predictor
+	progress  Progress
+	closeOnce sync.Once
+	closeErr  error
+	closed    atomic.Bool
+}
+
+// Prediction is the result of a prediction that succeeded
+type Prediction struct {
+	Output   interface{}
+	Duration time.Duration
+}
+
+// Start runs imageName, which must have been built by Cog, and waits for the model to be ready for predictions
+func Start(imageName string, opts RunOptions) (*Model, error) {
+	logs := opts.Logs
+	if logs == nil {
+		logs = io.Discard
+	}
+	model := &Model{
+		image:     imageName,
+		predictor: predict.NewPredictor(docker.RunOptions{Image: imageName, GPUs: opts.GPUs, Env: opts.Env}),
+		progress:  opts.Progress,
+	}
+	model.progress.report(StageStarting, imageName)
+	if err := model.predictor.Start(logs); err != nil {
+		_ = model.Close()
+		return nil, err
+	}
+	model.progress.report(StageStarted, imageName)
+	return model, nil
+}
+
+// Predict runs a prediction. Inputs are strings, like `cog predict -i`, and values prefixed with @ are read from
+// files. If ctx has a deadline, the prediction is canceled when it passes. If ctx is canceled, the model is closed,
+// because that's the only way to stop a prediction that's running.
+func (m *Model) Predict(ctx context.Context, inputs map[string]string) (*Prediction, error) {
+	startedOn := time.Now()
+	timeout := time.Duration(0)
+	if deadline, ok := ctx.Deadline(); ok {
+		if timeout = time.Until(deadline); timeout <= 0 {
+			return nil, ctx.Err()
+		}
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			if ctx.Err() == context.Canceled {
+				_ = m.Close()
+			}
+		case <-done:
+		}
+	}()
+
+	m.progress.report(StagePredicting, m.image)
+	response, err := m.predictor.PredictWithTimeout(predict.NewInputs(inputs), timeout)
+	if err != nil {
+		if ctx.Err() == context.Canceled {
+			return nil, ctx.Err()
+		}
+		if crash := m.predictor.Crashed(); crash != nil {
+			_ = m.Close()
+			err = fmt.Errorf("The model's container crashed, because %s: %w", crash.Reason(), err)
+			if crash.OutOfMemory() {
+				return nil, errors.OutOfMemory(err)
+			}
+		}
+		return nil, errors.PredictionFailed(err)
+	}
+	switch response.Status {
+	case "failed":
+		return nil, errors.PredictionFailed(fmt.Errorf("The prediction failed: %s", response.Error))
+	case "canceled":
+		return nil, errors.PredictionFailed(fmt.Errorf("The prediction was canceled"))
+	}
+	m.progress.report(StagePredicted, m.image)
+
+	prediction := &Prediction{Duration: time.Since(startedOn)}
+	if response.Output != nil {
+		prediction.Output = *response.Output
+	}
+	return prediction, nil
+}
+
+// Close stops the model's container
+func (m *Model) Close() error {
+	m.closeOnce.Do(func() {
+		m.closed.Store(true)
+		if m.predictor.ContainerID() != "" {
+			m.closeErr = m.predictor.Stop()
+		}
+		m.progress.report(StageStopped, m.image)
+	})
+	return m.closeErr
+}
+
+// Running returns whether the model can run predictions, which it can't once it has been closed or its container
+// has crashed
+func (m *Model) Running() bool {
+	return !m.closed.Load()
+}
+
+// Predict runs imageName, runs a prediction with inputs, and stops it again. To run more than one prediction, use
+// Start, which only starts the model once.
+func Predict(ctx context.Context, imageName string, inputs map[string]string, opts RunOptions) (*Prediction, error) {
+	model, err := Start(imageName, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer model.Close()
+	return model.Predict(ctx, inputs)
+}
@@ -0,0 +1,37 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/image"
+)
+
+// PushOptions configures Push
+type PushOptions struct {
+	Progress Progress
+}
+
+// PushResult is the image that Push pushed, with its digest in the registry
+type PushResult struct {
+	image.Summary
+	Duration time.Duration
+}
+
+// Push pushes imageName, which has been built, to its registry. Docker must be logged in to the registry, e.g. with
+// `cog login`.
+func Push(ctx context.Context, imageName string, opts PushOptions) (*PushResult, error) {
+	startedOn := time.Now()
+	opts.Progress.report(StagePushing, imageName)
+	if err := docker.Push(ctx, imageName); err != nil {
+		return nil, err
+	}
+	opts.Progress.report(StagePushed, imageName)
+
+	summary, err := image.Summarize(imageName, true)
+	if err != nil {
+		return nil, err
+	}
+	return &PushResult{Summary: *summary, Duration: time.Since(startedOn)}, nil
+}
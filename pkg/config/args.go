@@ -0,0 +1,38 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/replicate/cog/pkg/secrets"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// BuildArgs returns the build args to pass to the build for values, which are KEY=VALUE, or KEY to take the value
+// from the environment variable of the same name. Each one must be declared in build.args, because the generated
+// Dockerfile only declares those, so Docker would ignore any others.
+func (c *Config) BuildArgs(values []string) ([]string, error) {
+	args := []string{}
+	for _, value := range values {
+		name, v, found := strings.Cut(value, "=")
+		if !found {
+			v, found = os.LookupEnv(name)
+			if !found {
+				return nil, fmt.Errorf("--build-arg %s doesn't have a value, and there isn't an environment variable called %s", name, name)
+			}
+		}
+		declared := false
+		if c.Build != nil {
+			_, declared = c.Build.Args[name]
+		}
+		if !declared {
+			return nil, fmt.Errorf("--build-arg %s isn't declared in build.args in cog.yaml. Add it there, with its default value", name)
+		}
+		if secrets.IsSecretName(name) || secrets.Find(v) != "" {
+			console.Warnf("--build-arg %s looks like a secret. Anyone who can pull the image can read build args in its history, so pass secrets with --secret instead", name)
+		}
+		args = append(args, name+"="+v)
+	}
+	return args, nil
+}
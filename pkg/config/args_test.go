@@ -0,0 +1,30 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildArgs(t *testing.T) {
+	t.Setenv("EXTRA_INDEX_URL", "https://pypi.example.com/simple")
+
+	config, err := FromYAML([]byte(`build:
+  args:
+    MODEL_REVISION: main
+    EXTRA_INDEX_URL:
+    BATCH: 8
+`))
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"MODEL_REVISION": "main", "EXTRA_INDEX_URL": "", "BATCH": "8"}, config.Build.Args)
+
+	args, err := config.BuildArgs([]string{"MODEL_REVISION=v2", "EXTRA_INDEX_URL"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"MODEL_REVISION=v2", "EXTRA_INDEX_URL=https://pypi.example.com/simple"}, args)
+
+	_, err = config.BuildArgs([]string{"MODEL_REVISON=v2"})
+	require.ErrorContains(t, err, "--build-arg MODEL_REVISON isn't declared in build.args in cog.yaml")
+
+	_, err = config.BuildArgs([]string{"BATCH"})
+	require.ErrorContains(t, err, "--build-arg BATCH doesn't have a value")
+}
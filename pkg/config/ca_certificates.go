@@ -0,0 +1,63 @@
+package config
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const pemCertificateHeader = "-----BEGIN CERTIFICATE-----"
+
+// CACertificates returns the certificates in build.ca_certificates as one PEM bundle. Each one is either a PEM
+// certificate, or the path of a file of them relative to projectDir. It returns nil if there aren't any.
+func (c *Config) CACertificates(projectDir string) ([]byte, error) {
+	if c.Build == nil || len(c.Build.CACertificates) == 0 {
+		return nil, nil
+	}
+	bundle := []byte{}
+	for _, certificate := range c.Build.CACertificates {
+		name := "inline certificate"
+		contents := []byte(certificate)
+		if !strings.Contains(certificate, pemCertificateHeader) {
+			name = certificate
+			var err error
+			if contents, err = os.ReadFile(filepath.Join(projectDir, certificate)); err != nil {
+				return nil, fmt.Errorf("Failed to read CA certificate in build.ca_certificates: %w", err)
+			}
+		}
+		if err := checkPEMCertificates(contents); err != nil {
+			return nil, fmt.Errorf("The %s in build.ca_certificates isn't valid: %w", name, err)
+		}
+		bundle = append(bundle, bytes.TrimSpace(contents)...)
+		bundle = append(bundle, '\n')
+	}
+	return bundle, nil
+}
+
+// checkPEMCertificates checks that contents has at least one PEM certificate, and nothing else, like a private key
+func checkPEMCertificates(contents []byte) error {
+	found := false
+	rest := contents
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return fmt.Errorf("it has a %s, but it should only have certificates", block.Type)
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			return err
+		}
+		found = true
+	}
+	if !found {
+		return fmt.Errorf("it doesn't have a PEM certificate, which starts with %s", pemCertificateHeader)
+	}
+	return nil
+}
@@ -346,3 +346,78 @@ func torchStripCPUSuffixForM1(version string, goos string, goarch string) string
 	}
 	return version
 }
+
+// latestTorchForCUDA returns the latest version of torch that has a build for cuda or an earlier version of CUDA
+func latestTorchForCUDA(cuda string) string {
+	latest := ""
+	for _, compat := range TorchCompatibilityMatrix {
+		if compat.CUDA == nil {
+			continue
+		}
+		if greater, err := versionGreater(*compat.CUDA, cuda); err != nil || greater {
+			continue
+		}
+		if greater, err := versionGreater(compat.TorchVersion(), latest); latest == "" || (err == nil && greater) {
+			latest = compat.TorchVersion()
+		}
+	}
+	return latest
+}
+
+// latestTFForCUDA returns the latest version of tensorflow that is built for the same major version of CUDA as
+// cuda, and not a later one
+func latestTFForCUDA(cuda string) string {
+	requested, err := version.NewVersion(cuda)
+	if err != nil {
+		return ""
+	}
+	latest := ""
+	for _, compat := range TFCompatibilityMatrix {
+		tfCUDA, err := version.NewVersion(compat.CUDA)
+		if err != nil || tfCUDA.Major != requested.Major || tfCUDA.Greater(requested) {
+			continue
+		}
+		if greater, err := versionGreater(compat.TF, latest); latest == "" || (err == nil && greater) {
+			latest = compat.TF
+		}
+	}
+	return latest
+}
+
+// sameMajorVersion returns whether two versions have the same major version, or true if either isn't a version
+func sameMajorVersion(a string, b string) bool {
+	aVer, err := version.NewVersion(a)
+	if err != nil {
+		return true
+	}
+	bVer, err := version.NewVersion(b)
+	if err != nil {
+		return true
+	}
+	return aVer.Major == bVer.Major
+}
+
+// cudaAtMost returns whether any of cudas is the same as or earlier than cuda
+func cudaAtMost(cudas []string, cuda string) bool {
+	for _, c := range cudas {
+		if greater, err := versionGreater(c, cuda); err == nil && !greater {
+			return true
+		}
+	}
+	return false
+}
+
+// incompatibleCUDAError is returned when a framework pinned in the Python packages isn't built for the version
+// of CUDA set in cog.yaml
+func incompatibleCUDAError(pkg, pkgVersion string, pkgCUDAs []string, cuda string, compatibleVersion string) error {
+	fixes := []string{
+		fmt.Sprintf("set 'cuda' in cog.yaml to \"%s\", or remove it so Cog picks a compatible version", latestCUDAFrom(pkgCUDAs)),
+	}
+	if compatibleVersion != "" {
+		fixes = append(fixes, fmt.Sprintf("use %s==%s, which works with CUDA %s", pkg, compatibleVersion, cuda))
+	}
+	return fmt.Errorf(`%s==%s isn't compatible with CUDA %s, which is set by 'cuda' in cog.yaml. It is built for CUDA %s.
+
+To fix this, either:
+- %s`, pkg, pkgVersion, cuda, strings.Join(pkgCUDAs, ", "), strings.Join(fixes, "\n- "))
+}
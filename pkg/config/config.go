@@ -28,18 +28,58 @@ type RunItem struct {
 		ID     string `json:"id,omitempty" yaml:"id"`
 		Target string `json:"target,omitempty" yaml:"target"`
 	} `json:"mounts,omitempty" yaml:"mounts"`
+	// GPU runs the command with access to the GPU, e.g. to compile TensorRT engines
+	GPU bool `json:"gpu,omitempty" yaml:"gpu"`
 }
 
 type Build struct {
-	GPU                bool      `json:"gpu,omitempty" yaml:"gpu"`
-	PythonVersion      string    `json:"python_version,omitempty" yaml:"python_version"`
-	PythonRequirements string    `json:"python_requirements,omitempty" yaml:"python_requirements"`
-	PythonPackages     []string  `json:"python_packages,omitempty" yaml:"python_packages"` // Deprecated, but included for backwards compatibility
-	Run                []RunItem `json:"run,omitempty" yaml:"run"`
-	SystemPackages     []string  `json:"system_packages,omitempty" yaml:"system_packages"`
-	PreInstall         []string  `json:"pre_install,omitempty" yaml:"pre_install"` // Deprecated, but included for backwards compatibility
-	CUDA               string    `json:"cuda,omitempty" yaml:"cuda"`
-	CuDNN              string    `json:"cudnn,omitempty" yaml:"cudnn"`
+	GPU                bool     `json:"gpu,omitempty" yaml:"gpu"`
+	PythonVersion      string   `json:"python_version,omitempty" yaml:"python_version"`
+	PythonRequirements string   `json:"python_requirements,omitempty" yaml:"python_requirements"`
+	PythonPackages     []string `json:"python_packages,omitempty" yaml:"python_packages"` // Deprecated, but included for backwards compatibility
+	// PythonPackagesStable are installed in their own layer, which is cached when the other Python packages change
+	PythonPackagesStable []string  `json:"python_packages_stable,omitempty" yaml:"python_packages_stable"`
+	Run                  []RunItem `json:"run,omitempty" yaml:"run"`
+	SystemPackages       []string  `json:"system_packages,omitempty" yaml:"system_packages"`
+	PreInstall           []string  `json:"pre_install,omitempty" yaml:"pre_install"` // Deprecated, but included for backwards compatibility
+	CUDA                 string    `json:"cuda,omitempty" yaml:"cuda"`
+	CuDNN                string    `json:"cudnn,omitempty" yaml:"cudnn"`
+	// CUDAFlavor is the runtime or devel variant of the CUDA base image, picked from the run commands if it isn't set
+	CUDAFlavor string `json:"cuda_flavor,omitempty" yaml:"cuda_flavor"`
+	// GPUArch are the compute capabilities to build CUDA extensions for, e.g. 86 for 8.6
+	GPUArch       []int          `json:"gpu_arch,omitempty" yaml:"gpu_arch"`
+	LicensePolicy *LicensePolicy `json:"license_policy,omitempty" yaml:"license_policy"`
+	// Presets are sets of system packages and Python packages for common needs, e.g. ffmpeg
+	Presets []string `json:"presets,omitempty" yaml:"presets"`
+	// Optimize configures steps that make the image smaller or faster, e.g. quantizing the weights
+	Optimize *Optimize `json:"optimize,omitempty" yaml:"optimize"`
+	// Verify imports the predictor and checks the HTTP server can load it at the end of the build
+	Verify bool `json:"verify,omitempty" yaml:"verify"`
+	// SharedLayers orders and timestamps the layers that don't depend on the model so they are the same in every
+	// model's image, and a registry only stores them once
+	SharedLayers bool `json:"shared_layers,omitempty" yaml:"shared_layers"`
+	// Ignore are globs of files that are left out of the image, as if they were in .dockerignore
+	Ignore []string `json:"ignore,omitempty" yaml:"ignore"`
+	// Source configures which of the project's files are copied into the image
+	Source *Source `json:"source,omitempty" yaml:"source"`
+	// MaxContextSize is how big the build context can be before the build fails, e.g. 20GB, or 0 for no limit
+	MaxContextSize string `json:"max_context_size,omitempty" yaml:"max_context_size"`
+	// Templates are Go templates that replace blocks of the generated Dockerfile, by the name of the block
+	Templates map[string]string `json:"templates,omitempty" yaml:"templates"`
+	// Proxy is the proxy the build reaches the internet through
+	Proxy *Proxy `json:"proxy,omitempty" yaml:"proxy"`
+	// CACertificates are PEM certificates, or paths to them, that are added to the image's trust store
+	CACertificates []string `json:"ca_certificates,omitempty" yaml:"ca_certificates"`
+	// Timezone is the IANA time zone the image is in, e.g. Europe/Berlin
+	Timezone string `json:"timezone,omitempty" yaml:"timezone"`
+	// Locale is the locale the image uses, e.g. en_US.UTF-8
+	Locale string `json:"locale,omitempty" yaml:"locale"`
+	// Env are environment variables that are set while the image is built, and kept in it
+	Env map[string]string `json:"env,omitempty" yaml:"env"`
+	// Args are build args that are declared in every stage, with their default values, and can be set with --build-arg
+	Args map[string]string `json:"args,omitempty" yaml:"args"`
+	// SecretScan is what to do when a secret would be built into the image: error, warn or off
+	SecretScan string `json:"secret_scan,omitempty" yaml:"secret_scan"`
 
 	pythonRequirementsContent []string
 }
@@ -49,11 +89,79 @@ type Example struct {
 	Output string            `json:"output" yaml:"output"`
 }
 
+// WarmupItem is a set of example inputs that is run once after setup, before the model reports itself as ready
+type WarmupItem map[string]interface{}
+
+// Runtime configures the environment the model runs in
+type Runtime struct {
+	// Env are environment variables that are set when the model runs, which can be overridden with -e
+	Env map[string]string `json:"env,omitempty" yaml:"env"`
+}
+
+type Concurrency struct {
+	Max       int `json:"max,omitempty" yaml:"max"`
+	QueueSize int `json:"queue_size,omitempty" yaml:"queue_size"`
+}
+
+// DefaultShutdownGracePeriod is how many seconds a draining model waits for running predictions if shutdown.grace_period isn't set
+const DefaultShutdownGracePeriod = 30
+
+// Shutdown configures what the model does when it is asked to stop
+type Shutdown struct {
+	GracePeriod int    `json:"grace_period,omitempty" yaml:"grace_period"`
+	Drain       bool   `json:"drain,omitempty" yaml:"drain"`
+	SIGTERM     string `json:"sigterm,omitempty" yaml:"sigterm"`
+}
+
+// Metadata describes the model for the people using it, e.g. in its model card
+type Metadata struct {
+	Name        string   `json:"name,omitempty" yaml:"name"`
+	Description string   `json:"description,omitempty" yaml:"description"`
+	Authors     []string `json:"authors,omitempty" yaml:"authors"`
+	Homepage    string   `json:"homepage,omitempty" yaml:"homepage"`
+}
+
+// License is the license the model and its weights are released under, as SPDX identifiers
+type License struct {
+	Model   string `json:"model,omitempty" yaml:"model"`
+	Weights string `json:"weights,omitempty" yaml:"weights"`
+	URL     string `json:"url,omitempty" yaml:"url"`
+}
+
+// LicensePolicy is checked against the licenses of the packages installed in the image when it is built
+type LicensePolicy struct {
+	// Deny is a list of license families (e.g. strong-copyleft) or SPDX identifiers (e.g. GPL-3.0) that fail the build
+	Deny []string `json:"deny,omitempty" yaml:"deny"`
+	// IgnorePackages are packages that are allowed whatever their license is
+	IgnorePackages []string `json:"ignore_packages,omitempty" yaml:"ignore_packages"`
+}
+
 type Config struct {
-	Build   *Build `json:"build" yaml:"build"`
-	Image   string `json:"image,omitempty" yaml:"image"`
-	Predict string `json:"predict,omitempty" yaml:"predict"`
-	Train   string `json:"train,omitempty" yaml:"train"`
+	// SchemaVersion is the version of the cog.yaml schema the file was written for, see CurrentSchemaVersion
+	SchemaVersion int    `json:"schema_version,omitempty" yaml:"schema_version"`
+	Build         *Build `json:"build" yaml:"build"`
+	// Image is the image's name. The image key in cog.yaml can also be a map with its name and tag_template, see
+	// UnmarshalYAML.
+	Image string `json:"image,omitempty" yaml:"-"`
+	// ImageTagTemplate is image.tag_template, a Go template the image is tagged with, see RenderTag
+	ImageTagTemplate string       `json:"-" yaml:"-"`
+	Predict          string       `json:"predict,omitempty" yaml:"predict"`
+	PredictTimeout   int          `json:"predict_timeout,omitempty" yaml:"predict_timeout"`
+	Train            string       `json:"train,omitempty" yaml:"train"`
+	Concurrency      *Concurrency `json:"concurrency,omitempty" yaml:"concurrency"`
+	Warmup           []WarmupItem `json:"warmup,omitempty" yaml:"warmup"`
+	Shutdown         *Shutdown    `json:"shutdown,omitempty" yaml:"shutdown"`
+	OpenAI           bool         `json:"openai,omitempty" yaml:"openai"`
+	// Auth makes the HTTP server require the token in COG_AUTH_TOKEN as a bearer token
+	Auth      bool       `json:"auth,omitempty" yaml:"auth"`
+	Serve     *Serve     `json:"serve,omitempty" yaml:"serve"`
+	Metadata  *Metadata  `json:"metadata,omitempty" yaml:"metadata"`
+	License   *License   `json:"license,omitempty" yaml:"license"`
+	Weights   *Weights   `json:"weights,omitempty" yaml:"weights"`
+	Runtime   *Runtime   `json:"runtime,omitempty" yaml:"runtime"`
+	Resources *Resources `json:"resources,omitempty" yaml:"resources"`
+	// Workspace is the cog-workspace.yaml the project is in, if it's in one, see FindWorkspace
+	Workspace *Workspace `json:"-" yaml:"-"`
 }
 
 func DefaultConfig() *Config {
@@ -89,6 +197,7 @@ func (r *RunItem) UnmarshalYAML(unmarshal func(interface{}) error) error {
 				ID     string `yaml:"id"`
 				Target string `yaml:"target"`
 			} `yaml:"mounts,omitempty"`
+			GPU bool `yaml:"gpu"`
 		}{}
 
 		if err := yaml.Unmarshal(data, &aux); err != nil {
@@ -120,6 +229,7 @@ func (r *RunItem) UnmarshalJSON(data []byte) error {
 				ID     string `json:"id"`
 				Target string `json:"target"`
 			} `json:"mounts,omitempty"`
+			GPU bool `json:"gpu"`
 		}{}
 
 		jsonData, err := json.Marshal(v)
@@ -156,10 +266,43 @@ func FromYAML(contents []byte) (*Config, error) {
 	return config, nil
 }
 
-func (c *Config) CUDABaseImageTag() (string, error) {
+// ShutdownGracePeriod returns the number of seconds the model waits for running predictions to finish
+// when it is asked to stop, or zero if it doesn't wait for them
+func (c *Config) ShutdownGracePeriod() int {
+	if c.Shutdown == nil {
+		return 0
+	}
+	if c.Shutdown.GracePeriod > 0 {
+		return c.Shutdown.GracePeriod
+	}
+	if c.Shutdown.Drain {
+		return DefaultShutdownGracePeriod
+	}
+	return 0
+}
+
+// MaxConcurrency returns the number of predictions the model accepts at the same time. It runs one of them, and the
+// rest wait in its queue.
+func (c *Config) MaxConcurrency() int {
+	if c.Concurrency == nil || c.Concurrency.Max < 1 {
+		return 1
+	}
+	return c.Concurrency.Max
+}
+
+// CUDADevelBaseImageTag returns the devel CUDA base image, whatever build.cuda_flavor is
+func (c *Config) CUDADevelBaseImageTag() (string, error) {
 	return CUDABaseImageFor(c.Build.CUDA, c.Build.CuDNN)
 }
 
+func (c *Config) CUDABaseImageTag() (string, error) {
+	tag, err := CUDABaseImageFor(c.Build.CUDA, c.Build.CuDNN)
+	if err != nil {
+		return "", err
+	}
+	return cudaBaseImageTagForFlavor(tag, c.CUDAFlavor()), nil
+}
+
 func (c *Config) cudasFromTorch() (torchVersion string, torchCUDAs []string, err error) {
 	if version, ok := c.pythonPackageVersion("torch"); ok {
 		cudas, err := cudasFromTorch(version)
@@ -183,7 +326,7 @@ func (c *Config) cudaFromTF() (tfVersion string, tfCUDA string, tfCuDNN string,
 }
 
 func (c *Config) pythonPackageVersion(name string) (version string, ok bool) {
-	for _, pkg := range c.Build.pythonRequirementsContent {
+	for _, pkg := range append(append([]string{}, c.Build.PythonPackagesStable...), c.Build.pythonRequirementsContent...) {
 		pkgName, version, err := splitPinnedPythonRequirement(pkg)
 		if err != nil {
 			return "", false
@@ -195,6 +338,20 @@ func (c *Config) pythonPackageVersion(name string) (version string, ok bool) {
 	return "", false
 }
 
+// HasPythonPackage returns whether name is one of the Python packages that are installed, pinned or not
+func (c *Config) HasPythonPackage(name string) bool {
+	for _, pkg := range append(append([]string{}, c.Build.PythonPackagesStable...), c.Build.pythonRequirementsContent...) {
+		pkgName := strings.TrimSpace(pkg)
+		if i := strings.IndexAny(pkgName, "=<>!~[;@ "); i >= 0 {
+			pkgName = pkgName[:i]
+		}
+		if strings.EqualFold(pkgName, name) {
+			return true
+		}
+	}
+	return false
+}
+
 func (c *Config) ValidateAndComplete(projectDir string) error {
 	// TODO(andreas): validate that torch/torchvision/torchaudio are compatible
 	// TODO(andreas): warn if user specifies tensorflow-gpu instead of tensorflow
@@ -235,12 +392,88 @@ func (c *Config) ValidateAndComplete(projectDir string) error {
 		c.Build.pythonRequirementsContent = c.Build.PythonPackages
 	}
 
+	if len(c.Build.PythonPackagesStable) > 0 {
+		stable := map[string]bool{}
+		for _, pkg := range c.Build.PythonPackagesStable {
+			stable[pythonRequirementName(pkg)] = true
+		}
+		for _, pkg := range c.Build.pythonRequirementsContent {
+			if name := pythonRequirementName(pkg); name != "" && stable[name] {
+				errs = append(errs, fmt.Errorf("%s is in python_packages_stable, so it can't also be in python_packages or python_requirements", name))
+			}
+		}
+	}
+
+	if err := c.validateGPUArch(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := c.validateQuantize(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := c.validateWeights(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := c.validateIgnore(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := c.validateSource(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := c.MaxContextSizeBytes(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := c.CACertificates(projectDir); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := c.validateLocale(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := c.validateEnv(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := c.validateImage(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := c.validateResources(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := c.validateServe(); err != nil {
+		errs = append(errs, err)
+	}
+
+	for _, run := range c.Build.Run {
+		if run.GPU && !c.Build.GPU {
+			errs = append(errs, fmt.Errorf("The run command '%s' has gpu: true, so build.gpu must be true in cog.yaml", run.Command))
+		}
+	}
+
 	if c.Build.GPU {
 		if err := c.validateAndCompleteCUDA(); err != nil {
 			errs = append(errs, err)
 		}
 	}
 
+	if err := c.validateWorkspace(); err != nil {
+		errs = append(errs, err)
+	}
+
+	for _, requirement := range c.Build.pythonRequirementsContent {
+		if _, err := c.resolveWheel(requirement, ""); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
 	if len(errs) > 0 {
 		return errors.Join(errs...)
 	}
@@ -250,10 +483,28 @@ func (c *Config) ValidateAndComplete(projectDir string) error {
 
 // PythonRequirementsForArch returns a requirements.txt file with all the GPU packages resolved for given OS and architecture.
 func (c *Config) PythonRequirementsForArch(goos string, goarch string) (string, error) {
+	requirements := c.Build.pythonRequirementsContent
+	return c.requirementsForArch(append(append([]string{}, requirements...), c.presetPythonRequirements(requirements)...), goos, goarch)
+}
+
+// StablePythonRequirementsForArch is PythonRequirementsForArch for python_packages_stable
+func (c *Config) StablePythonRequirementsForArch(goos string, goarch string) (string, error) {
+	return c.requirementsForArch(c.Build.PythonPackagesStable, goos, goarch)
+}
+
+func (c *Config) requirementsForArch(requirements []string, goos string, goarch string) (string, error) {
 	packages := []string{}
 	findLinksSet := map[string]bool{}
 	extraIndexURLSet := map[string]bool{}
-	for _, pkg := range c.Build.pythonRequirementsContent {
+	for _, pkg := range requirements {
+		resolved, err := c.resolveWheel(pkg, goarch)
+		if err != nil {
+			return "", err
+		}
+		if resolved != "" {
+			packages = append(packages, resolved)
+			continue
+		}
 		archPkg, findLinks, extraIndexURL, err := c.pythonPackageForArch(pkg, goos, goarch)
 		if err != nil {
 			return "", err
@@ -359,7 +610,10 @@ Compatible CuDNN versions are: %s`, c.Build.CUDA, c.Build.CuDNN, strings.Join(co
 			console.Debugf("Setting CUDA to version %s from Tensorflow version", tfCUDA)
 			c.Build.CUDA = tfCUDA
 		} else if tfCUDA != c.Build.CUDA {
-			// TODO: can we suggest a CUDA version known to be compatible?
+			// TensorFlow binaries only work with the major version of CUDA they are built for
+			if tfCUDA != "" && !sameMajorVersion(tfCUDA, c.Build.CUDA) {
+				return incompatibleCUDAError("tensorflow", tfVersion, []string{tfCUDA}, c.Build.CUDA, latestTFForCUDA(c.Build.CUDA))
+			}
 			console.Warnf("Cog doesn't know if CUDA %s is compatible with Tensorflow %s. This might cause CUDA problems.", c.Build.CUDA, tfVersion)
 		}
 		if c.Build.CuDNN == "" && tfCuDNN != "" {
@@ -389,7 +643,11 @@ Compatible cuDNN version is: %s`,
 			}
 			console.Debugf("Setting CUDA to version %s from Torch version", c.Build.CUDA)
 		} else if !slices.ContainsString(torchCUDAs, c.Build.CUDA) {
-			// TODO: can we suggest a CUDA version known to be compatible?
+			// torch is installed from the build for the latest CUDA that is no later than the CUDA of the image,
+			// so there has to be one
+			if len(torchCUDAs) > 0 && !cudaAtMost(torchCUDAs, c.Build.CUDA) {
+				return incompatibleCUDAError("torch", torchVersion, torchCUDAs, c.Build.CUDA, latestTorchForCUDA(c.Build.CUDA))
+			}
 			console.Warnf("Cog doesn't know if CUDA %s is compatible with PyTorch %s. This might cause CUDA problems.", c.Build.CUDA, torchVersion)
 		}
 
@@ -428,6 +686,15 @@ func splitPinnedPythonRequirement(requirement string) (name string, version stri
 	return match[1], match[2], nil
 }
 
+// pythonRequirementName returns the normalized name of the package in a requirements.txt line, or "" if the
+// line isn't a package, e.g. it is an option or a comment
+func pythonRequirementName(requirement string) string {
+	match := requirementNameRe.FindString(strings.TrimSpace(requirement))
+	return strings.ToLower(strings.NewReplacer("_", "-", ".", "-").Replace(match))
+}
+
+var requirementNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*`)
+
 func sliceContains(slice []string, s string) bool {
 	for _, el := range slice {
 		if el == s {
@@ -436,3 +703,14 @@ func sliceContains(slice []string, s string) bool {
 	}
 	return false
 }
+
+// GPURunCommands returns the run commands that need access to the GPU
+func (c *Config) GPURunCommands() []string {
+	commands := []string{}
+	for _, run := range c.Build.Run {
+		if run.GPU {
+			commands = append(commands, strings.TrimSpace(run.Command))
+		}
+	}
+	return commands
+}
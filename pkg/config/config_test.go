@@ -25,6 +25,44 @@ func TestPythonPackagesAndRequirementsCantBeUsedTogether(t *testing.T) {
 	require.Contains(t, err.Error(), "Only one of python_packages or python_requirements can be set in your cog.yaml, not both")
 }
 
+func TestStablePythonPackages(t *testing.T) {
+	config := &Config{
+		Build: &Build{
+			GPU:                  true,
+			PythonVersion:        "3.8",
+			PythonPackagesStable: []string{"torch==1.7.1", "transformers==4.30.0"},
+			PythonPackages:       []string{"foo==1.0.0"},
+		},
+	}
+	err := config.ValidateAndComplete("")
+	require.NoError(t, err)
+	// CUDA is picked from torch, even though it is in python_packages_stable
+	require.Equal(t, "11.0.3", config.Build.CUDA)
+
+	requirements, err := config.StablePythonRequirementsForArch("", "")
+	require.NoError(t, err)
+	require.Equal(t, `--find-links https://download.pytorch.org/whl/torch_stable.html
+torch==1.7.1+cu110
+transformers==4.30.0`, requirements)
+
+	requirements, err = config.PythonRequirementsForArch("", "")
+	require.NoError(t, err)
+	require.Equal(t, "foo==1.0.0", requirements)
+}
+
+func TestStablePythonPackagesCantBeInPythonPackages(t *testing.T) {
+	config := &Config{
+		Build: &Build{
+			PythonVersion:        "3.8",
+			PythonPackagesStable: []string{"torch==2.0.1"},
+			PythonPackages:       []string{"Torch>=2"},
+		},
+	}
+	err := config.ValidateAndComplete("")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "torch is in python_packages_stable")
+}
+
 func TestPythonRequirementsResolvesPythonPackagesAndCudaVersions(t *testing.T) {
 	tmpDir := t.TempDir()
 	err := os.WriteFile(path.Join(tmpDir, "requirements.txt"), []byte(`torch==1.7.1
@@ -227,6 +265,46 @@ func TestUnsupportedTorch(t *testing.T) {
 	require.Equal(t, "8", config.Build.CuDNN)
 }
 
+func TestIncompatibleTorchCUDA(t *testing.T) {
+	config := &Config{
+		Build: &Build{
+			GPU:           true,
+			CUDA:          "11.6",
+			PythonVersion: "3.10",
+			PythonPackages: []string{
+				"torch==2.1.1",
+			},
+		},
+	}
+	err := config.ValidateAndComplete("")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "torch==2.1.1 isn't compatible with CUDA 11.6, which is set by 'cuda' in cog.yaml. It is built for CUDA 11.8, 12.1.")
+	require.Contains(t, err.Error(), `set 'cuda' in cog.yaml to "12.1"`)
+	require.Contains(t, err.Error(), "use torch==1.13.1, which works with CUDA 11.6")
+
+	// An earlier build of torch for the same major version of CUDA is used
+	config.Build.CUDA = "12.2"
+	config.Build.CuDNN = ""
+	require.NoError(t, config.ValidateAndComplete(""))
+}
+
+func TestIncompatibleTensorflowCUDA(t *testing.T) {
+	config := &Config{
+		Build: &Build{
+			GPU:           true,
+			CUDA:          "11.8",
+			PythonVersion: "3.10",
+			PythonPackages: []string{
+				"tensorflow==2.15.0",
+			},
+		},
+	}
+	err := config.ValidateAndComplete("")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "tensorflow==2.15.0 isn't compatible with CUDA 11.8")
+	require.Contains(t, err.Error(), "use tensorflow==2.14.0, which works with CUDA 11.8")
+}
+
 func TestUnsupportedTensorflow(t *testing.T) {
 	// Ensure version is not known by Cog
 	cuda, cudnn, err := cudaFromTF("0.4.1")
@@ -349,6 +427,22 @@ foo==1.0.0`
 	require.NotContains(t, requirements, "tensorflow_gpu")
 }
 
+func TestHasPythonPackage(t *testing.T) {
+	config := &Config{
+		Build: &Build{
+			PythonVersion:        "3.11",
+			PythonPackages:       []string{"Torch>=2.0", "transformers[torch]==4.35.0"},
+			PythonPackagesStable: []string{"numpy"},
+		},
+	}
+	err := config.ValidateAndComplete("")
+	require.NoError(t, err)
+	require.True(t, config.HasPythonPackage("torch"))
+	require.True(t, config.HasPythonPackage("transformers"))
+	require.True(t, config.HasPythonPackage("numpy"))
+	require.False(t, config.HasPythonPackage("tensorflow"))
+}
+
 func TestCUDABaseImageTag(t *testing.T) {
 	config := &Config{
 		Build: &Build{
@@ -480,3 +574,113 @@ func TestBlankBuild(t *testing.T) {
 	require.NotNil(t, config.Build)
 	require.Equal(t, false, config.Build.GPU)
 }
+
+func TestWarmupInputs(t *testing.T) {
+	config, err := FromYAML([]byte(`
+build:
+  python_version: "3.8"
+predict: predict.py:Predictor
+warmup:
+  - prompt: "a photo of a cat"
+    steps: 4
+  - prompt: "a photo of a dog"
+`))
+	require.NoError(t, err)
+	require.Len(t, config.Warmup, 2)
+	require.Equal(t, "a photo of a cat", config.Warmup[0]["prompt"])
+	require.Equal(t, 4, config.Warmup[0]["steps"])
+
+	_, err = json.Marshal(config)
+	require.NoError(t, err)
+}
+
+func TestWarmupInputsMustBeScalars(t *testing.T) {
+	_, err := FromYAML([]byte(`
+build:
+  python_version: "3.8"
+warmup:
+  - prompt:
+      nested: value
+`))
+	require.Error(t, err)
+}
+
+func TestShutdownGracePeriod(t *testing.T) {
+	config, err := FromYAML([]byte(`
+build:
+  python_version: "3.8"
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.Equal(t, 0, config.ShutdownGracePeriod())
+
+	config, err = FromYAML([]byte(`
+build:
+  python_version: "3.8"
+predict: predict.py:Predictor
+shutdown:
+  drain: true
+`))
+	require.NoError(t, err)
+	require.Equal(t, DefaultShutdownGracePeriod, config.ShutdownGracePeriod())
+
+	config, err = FromYAML([]byte(`
+build:
+  python_version: "3.8"
+predict: predict.py:Predictor
+shutdown:
+  drain: true
+  grace_period: 120
+  sigterm: ignore
+`))
+	require.NoError(t, err)
+	require.Equal(t, 120, config.ShutdownGracePeriod())
+
+	_, err = FromYAML([]byte(`
+build:
+  python_version: "3.8"
+predict: predict.py:Predictor
+shutdown:
+  sigterm: explode
+`))
+	require.Error(t, err)
+}
+
+func TestQuantizeNeedsGPU(t *testing.T) {
+	config, err := FromYAML([]byte(`
+build:
+  optimize:
+    quantize:
+      method: awq
+`))
+	require.NoError(t, err)
+	err = config.ValidateAndComplete("")
+	require.ErrorContains(t, err, "Quantizing with awq needs a GPU")
+
+	config, err = FromYAML([]byte(`
+build:
+  optimize:
+    quantize:
+      method: gguf-q4
+`))
+	require.NoError(t, err)
+	require.NoError(t, config.ValidateAndComplete(""))
+	require.Equal(t, QuantizeGGUFQ4, config.QuantizeMethod())
+}
+
+func TestGPURunCommands(t *testing.T) {
+	config, err := FromYAML([]byte(`
+build:
+  gpu: true
+  run:
+    - pip install tensorrt
+    - command: python build_engine.py
+      gpu: true
+`))
+	require.NoError(t, err)
+	require.NoError(t, config.ValidateAndComplete(""))
+	require.Equal(t, []string{"python build_engine.py"}, config.GPURunCommands())
+
+	config.Build.GPU = false
+	require.ErrorContains(t, config.ValidateAndComplete(""), "has gpu: true, so build.gpu must be true")
+}
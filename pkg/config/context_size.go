@@ -0,0 +1,27 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/docker/go-units"
+)
+
+// DefaultMaxContextSize is how big the build context can be if build.max_context_size isn't set
+const DefaultMaxContextSize = "20GB"
+
+// MaxContextSizeBytes returns how big the build context can be in bytes before the build fails, or 0 if there
+// isn't a limit
+func (c *Config) MaxContextSizeBytes() (int64, error) {
+	size := DefaultMaxContextSize
+	if c.Build != nil && c.Build.MaxContextSize != "" {
+		size = c.Build.MaxContextSize
+	}
+	if size == "0" {
+		return 0, nil
+	}
+	bytes, err := units.FromHumanSize(size)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid build.max_context_size '%s' in cog.yaml. It must be a size like 20GB, or 0 for no limit", size)
+	}
+	return bytes, nil
+}
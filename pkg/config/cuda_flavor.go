@@ -0,0 +1,66 @@
+package config
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	// CUDAFlavorRuntime is the smaller CUDA base image, with the libraries needed to run CUDA code
+	CUDAFlavorRuntime = "runtime"
+	// CUDAFlavorDevel is the CUDA base image with the compiler and headers needed to build CUDA extensions
+	CUDAFlavorDevel = "devel"
+)
+
+// compilesExtensionsRe matches run commands that compile code, so need the devel CUDA base image
+var compilesExtensionsRe = regexp.MustCompile(`(^|[\s;&|/(])(nvcc|cmake|make|ninja|gcc|g\+\+|setup\.py)([\s;&|)]|$)|build_ext|--no-build-isolation|--no-binary|git\+|CUDA_HOME|TORCH_CUDA_ARCH_LIST`)
+
+// mightCompileExtensionsRe matches run commands that run code Cog can't see, like scripts and local Python packages,
+// which might compile code too
+var mightCompileExtensionsRe = regexp.MustCompile(`\.sh([\s;&|)]|$)|(^|[\s;&|(])(bash|sh|source)\s|pip3?\s+install(\s.*)?\s(-[er]\s|\.{1,2}(/|[\s;&|)]|$)|/)`)
+
+// sourceRequirementRe matches Python requirements that are built from source, rather than installed from a wheel
+var sourceRequirementRe = regexp.MustCompile(`^(git\+|-e\s|\.{1,2}/|/|file:)|\.(tar\.gz|zip)$`)
+
+// develPythonPackages are Python packages that compile CUDA code when they are installed or run
+var develPythonPackages = map[string]bool{
+	"apex":          true,
+	"causal-conv1d": true,
+	"deepspeed":     true,
+	"mamba-ssm":     true,
+	"pycuda":        true,
+	"tensorflow":    true,
+}
+
+// CUDAFlavor returns whether the model is built on the runtime or devel CUDA base image. If build.cuda_flavor
+// isn't set, it is devel if any run commands or Python packages compile CUDA code, or might, and runtime otherwise.
+func (c *Config) CUDAFlavor() string {
+	if c.Build.CUDAFlavor != "" {
+		return c.Build.CUDAFlavor
+	}
+	commands := append([]string{}, c.Build.PreInstall...)
+	for _, run := range c.Build.Run {
+		commands = append(commands, run.Command)
+	}
+	for _, command := range commands {
+		// devel is the safe guess if it isn't clear whether the command compiles anything
+		if compilesExtensionsRe.MatchString(command) || mightCompileExtensionsRe.MatchString(command) {
+			return CUDAFlavorDevel
+		}
+	}
+	requirements := append(append([]string{}, c.Build.PythonPackagesStable...), c.Build.pythonRequirementsContent...)
+	for _, requirement := range requirements {
+		if develPythonPackages[pythonRequirementName(requirement)] || sourceRequirementRe.MatchString(strings.TrimSpace(requirement)) {
+			return CUDAFlavorDevel
+		}
+	}
+	return CUDAFlavorRuntime
+}
+
+// cudaBaseImageTagForFlavor returns the runtime or devel variant of a devel CUDA base image tag
+func cudaBaseImageTagForFlavor(tag string, flavor string) string {
+	if flavor == CUDAFlavorRuntime {
+		return strings.Replace(tag, "-devel-", "-runtime-", 1)
+	}
+	return tag
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCUDAFlavor(t *testing.T) {
+	for _, tt := range []struct {
+		yaml     string
+		expected string
+	}{
+		{"build:\n  gpu: true\n  run:\n    - cowsay moo\n", "runtime"},
+		{"build:\n  gpu: true\n  run:\n    - cd /src/ext && python setup.py install\n", "devel"},
+		{"build:\n  gpu: true\n  run:\n    - TORCH_CUDA_ARCH_LIST=8.6 pip install ./kernels\n", "devel"},
+		{"build:\n  gpu: true\n  run:\n    - pip install flash-attn --no-build-isolation\n", "devel"},
+		{"build:\n  gpu: true\n  run:\n    - command: make -C /src/kernels\n", "devel"},
+		{"build:\n  gpu: true\n  run:\n    - echo makefile\n", "runtime"},
+		{"build:\n  gpu: true\n  python_packages:\n    - deepspeed==0.12.6\n", "devel"},
+		// Scripts and packages built from source might compile extensions, so they get devel
+		{"build:\n  gpu: true\n  run:\n    - bash /src/install.sh\n", "devel"},
+		{"build:\n  gpu: true\n  run:\n    - pip install -e /src/kernels\n", "devel"},
+		{"build:\n  gpu: true\n  run:\n    - pip install .\n", "devel"},
+		{"build:\n  gpu: true\n  python_packages:\n    - ./kernels\n", "devel"},
+		{"build:\n  gpu: true\n  python_packages:\n    - https://example.com/kernels-1.0.tar.gz\n", "devel"},
+		{"build:\n  gpu: true\n  run:\n    - pip install torchaudio --extra-index-url https://download.pytorch.org/whl/cu118\n", "runtime"},
+		{"build:\n  gpu: true\n  python_packages:\n    - torch==2.1.0\n", "runtime"},
+		{"build:\n  gpu: true\n  cuda_flavor: devel\n", "devel"},
+		{"build:\n  gpu: true\n  cuda_flavor: runtime\n  run:\n    - nvcc -o /bin/kernel kernel.cu\n", "runtime"},
+	} {
+		config, err := FromYAML([]byte(tt.yaml))
+		require.NoError(t, err)
+		require.NoError(t, config.ValidateAndComplete(""))
+		require.Equal(t, tt.expected, config.CUDAFlavor(), tt.yaml)
+	}
+}
+
+func TestCUDABaseImageTagCuDNN9(t *testing.T) {
+	config := &Config{
+		Build: &Build{
+			GPU:           true,
+			PythonVersion: "3.11",
+			PythonPackages: []string{
+				"torch==2.4.1",
+			},
+		},
+	}
+	require.NoError(t, config.ValidateAndComplete(""))
+	require.Equal(t, "12.4.1", config.Build.CUDA)
+	require.Equal(t, "9", config.Build.CuDNN)
+
+	imageTag, err := config.CUDABaseImageTag()
+	require.NoError(t, err)
+	require.Equal(t, "nvidia/cuda:12.4.1-cudnn-runtime-ubuntu22.04", imageTag)
+}
+
+func TestUnknownCUDAFlavor(t *testing.T) {
+	_, err := FromYAML([]byte("build:\n  gpu: true\n  cuda_flavor: slim\n"))
+	require.Error(t, err)
+}
@@ -0,0 +1,133 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+const defaultDefaultsPath = "~/.config/cog/defaults.yaml"
+
+// Defaults are the settings in ~/.config/cog/defaults.yaml, or the file in COG_DEFAULTS, which apply to every
+// project, so a team can set them once instead of in every model's cog.yaml
+type Defaults struct {
+	// Registry is prepended to the project's directory name to name its image, if cog.yaml doesn't set image,
+	// e.g. registry.example.com/team
+	Registry string `yaml:"registry"`
+	// Builder is the Docker Buildx builder to build with
+	Builder string       `yaml:"builder"`
+	Cache   CacheOptions `yaml:"cache"`
+	// Config is cog.yaml keys that projects get unless their cog.yaml sets them
+	Config map[string]interface{} `yaml:"config"`
+}
+
+// CacheOptions are where builds import and export their cache, as passed to docker buildx build
+type CacheOptions struct {
+	// From is the sources to import the cache from, e.g. type=registry,ref=registry.example.com/team/cache
+	From []string `yaml:"from"`
+	// To is where to export the cache to. It is exported inline in the image if it's empty.
+	To string `yaml:"to"`
+}
+
+// DefaultsPath returns the path of the defaults file: COG_DEFAULTS, or ~/.config/cog/defaults.yaml
+func DefaultsPath() (string, error) {
+	if path := os.Getenv("COG_DEFAULTS"); path != "" {
+		return path, nil
+	}
+	return homedir.Expand(defaultDefaultsPath)
+}
+
+// LoadDefaults reads the defaults file. It returns empty Defaults if there isn't one.
+func LoadDefaults() (*Defaults, error) {
+	path, err := DefaultsPath()
+	if err != nil {
+		return nil, err
+	}
+	contents, err := os.ReadFile(path)
+	if os.IsNotExist(err) && os.Getenv("COG_DEFAULTS") == "" {
+		return &Defaults{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read defaults file: %w", err)
+	}
+	defaults, err := parseDefaults(contents)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load %s: %w", path, err)
+	}
+	return defaults, nil
+}
+
+func parseDefaults(contents []byte) (*Defaults, error) {
+	defaults := &Defaults{}
+	decoder := yamlv3.NewDecoder(bytes.NewReader(contents))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(defaults); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("Failed to parse defaults yaml: %w", err)
+	}
+	defaults.Registry = strings.TrimSuffix(defaults.Registry, "/")
+	if len(defaults.Config) > 0 {
+		config, err := yamlv3.Marshal(defaults.Config)
+		if err != nil {
+			return nil, err
+		}
+		if err := Validate(string(config), ""); err != nil {
+			return nil, fmt.Errorf("config isn't valid cog.yaml: %w", err)
+		}
+	}
+	return defaults, nil
+}
+
+// MergeUnder returns the cog.yaml contents with the keys in Config that it doesn't set. Mappings are merged key by
+// key, and anything else in contents, including lists, replaces the default.
+func (d *Defaults) MergeUnder(contents []byte) ([]byte, error) {
+	if len(d.Config) == 0 {
+		return contents, nil
+	}
+	project := map[string]interface{}{}
+	if err := yamlv3.Unmarshal(contents, &project); err != nil {
+		return nil, fmt.Errorf("Failed to parse config yaml: %w", err)
+	}
+	merged, err := yamlv3.Marshal(mergeMaps(d.Config, project))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to merge defaults into config: %w", err)
+	}
+	return merged, nil
+}
+
+// ImageName returns the name of the image for the project in projectDir in Registry, or an empty string if
+// Registry isn't set
+func (d *Defaults) ImageName(projectDir string) string {
+	if d.Registry == "" {
+		return ""
+	}
+	return d.Registry + "/" + strings.TrimPrefix(DockerImageName(filepath.ToSlash(projectDir)), "cog-")
+}
+
+// mergeMaps returns base with the keys in override replacing or, for mappings, merged into its keys
+func mergeMaps(base map[string]interface{}, override map[string]interface{}) map[string]interface{} {
+	merged := map[string]interface{}{}
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range override {
+		if v == nil {
+			// An empty key, e.g. build: with nothing under it, doesn't unset the default
+			continue
+		}
+		baseMap, baseIsMap := merged[k].(map[string]interface{})
+		overrideMap, overrideIsMap := v.(map[string]interface{})
+		if baseIsMap && overrideIsMap {
+			merged[k] = mergeMaps(baseMap, overrideMap)
+		} else {
+			merged[k] = v
+		}
+	}
+	return merged
+}
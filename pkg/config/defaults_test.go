@@ -0,0 +1,90 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDefaults(t *testing.T) {
+	defaults, err := parseDefaults([]byte(`registry: registry.example.com/team/
+builder: remote
+cache:
+  from:
+    - type=registry,ref=registry.example.com/team/cache
+  to: type=registry,ref=registry.example.com/team/cache,mode=max
+config:
+  build:
+    python_version: "3.11"
+`))
+	require.NoError(t, err)
+	require.Equal(t, "registry.example.com/team", defaults.Registry)
+	require.Equal(t, "remote", defaults.Builder)
+	require.Equal(t, []string{"type=registry,ref=registry.example.com/team/cache"}, defaults.Cache.From)
+	require.Equal(t, "type=registry,ref=registry.example.com/team/cache,mode=max", defaults.Cache.To)
+
+	_, err = parseDefaults([]byte("regsitry: registry.example.com\n"))
+	require.ErrorContains(t, err, "regsitry")
+
+	_, err = parseDefaults([]byte("config:\n  build:\n    gpus: true\n"))
+	require.ErrorContains(t, err, "config isn't valid cog.yaml")
+
+	defaults, err = parseDefaults([]byte{})
+	require.NoError(t, err)
+	require.Equal(t, &Defaults{}, defaults)
+}
+
+func TestMergeUnder(t *testing.T) {
+	defaults, err := parseDefaults([]byte(`config:
+  build:
+    python_version: "3.10"
+    gpu: true
+    system_packages:
+      - ffmpeg
+  predict_timeout: 300
+`))
+	require.NoError(t, err)
+
+	merged, err := defaults.MergeUnder([]byte(`build:
+  python_version: "3.11"
+  system_packages:
+    - git
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	config, err := FromYAML(merged)
+	require.NoError(t, err)
+	require.Equal(t, "3.11", config.Build.PythonVersion)
+	require.True(t, config.Build.GPU)
+	require.Equal(t, []string{"git"}, config.Build.SystemPackages)
+	require.Equal(t, 300, config.PredictTimeout)
+	require.Equal(t, "predict.py:Predictor", config.Predict)
+
+	// An empty build doesn't unset the defaults under it
+	merged, err = defaults.MergeUnder([]byte("build:\n"))
+	require.NoError(t, err)
+	config, err = FromYAML(merged)
+	require.NoError(t, err)
+	require.Equal(t, "3.10", config.Build.PythonVersion)
+}
+
+func TestGetConfigWithDefaults(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "Hotdog Detector")
+	require.NoError(t, os.MkdirAll(dir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cog.yaml"), []byte("build:\n  python_version: \"3.11\"\n"), 0o644))
+	defaultsPath := filepath.Join(t.TempDir(), "defaults.yaml")
+	require.NoError(t, os.WriteFile(defaultsPath, []byte("registry: registry.example.com/team\nconfig:\n  build:\n    gpu: true\n    cuda: \"11.8\"\n"), 0o644))
+	t.Setenv("COG_DEFAULTS", defaultsPath)
+
+	config, _, err := GetConfig(dir)
+	require.NoError(t, err)
+	require.Equal(t, "registry.example.com/team/hotdog-detector", config.Image)
+	require.True(t, config.Build.GPU)
+	require.Equal(t, "3.11", config.Build.PythonVersion)
+
+	t.Setenv("COG_DEFAULTS", filepath.Join(t.TempDir(), "missing.yaml"))
+	_, _, err = GetConfig(dir)
+	require.ErrorContains(t, err, "Failed to read defaults file")
+}
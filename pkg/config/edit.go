@@ -0,0 +1,305 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// GetValue returns the value of key, e.g. build.gpu, in the cog.yaml contents. Scalars are returned as they are,
+// and lists and mappings as YAML. ok is false if the key isn't set.
+func GetValue(contents []byte, key string) (value string, ok bool, err error) {
+	root, err := parseYAMLNode(contents)
+	if err != nil {
+		return "", false, err
+	}
+	if root == nil {
+		return "", false, nil
+	}
+	node := root
+	for _, part := range strings.Split(key, ".") {
+		if node.Kind != yamlv3.MappingNode {
+			return "", false, nil
+		}
+		_, node = mappingValue(node, part)
+		if node == nil {
+			return "", false, nil
+		}
+	}
+	if node.Kind == yamlv3.ScalarNode {
+		return node.Value, true, nil
+	}
+	encoded, err := encodeYAMLNode(node)
+	if err != nil {
+		return "", false, err
+	}
+	return strings.TrimSuffix(encoded, "\n"), true, nil
+}
+
+// SetValue returns the cog.yaml contents with key, e.g. build.gpu, set to value, which is parsed as YAML, e.g. true
+// or [ffmpeg, libsndfile1]. Only the lines of the key are changed, so comments and the formatting of the rest of
+// the file are kept. The result is checked against the cog.yaml schema.
+func SetValue(contents []byte, key string, value string) ([]byte, error) {
+	k, err := lookupKey(key)
+	if err != nil {
+		return nil, err
+	}
+	newValue, err := parseValue(value, k.Type)
+	if err != nil {
+		return nil, err
+	}
+	root, err := parseYAMLNode(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	var result string
+	parts := strings.Split(key, ".")
+	if root == nil {
+		result, err = insertValue(string(contents), nil, nil, parts, newValue)
+	} else {
+		result, err = setValue(string(contents), root, parts, newValue)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := FromYAML([]byte(result)); err != nil {
+		return nil, fmt.Errorf("Failed to set %s to %s: %w", key, value, err)
+	}
+	return []byte(result), nil
+}
+
+func setValue(contents string, root *yamlv3.Node, parts []string, newValue *yamlv3.Node) (string, error) {
+	if root.Kind != yamlv3.MappingNode {
+		return "", fmt.Errorf("Failed to set %s, because cog.yaml isn't a mapping of keys to values", strings.Join(parts, "."))
+	}
+	var parentKey *yamlv3.Node
+	parent := root
+	for i, part := range parts {
+		if parentKey != nil && parent.Style&yamlv3.FlowStyle != 0 {
+			return "", fmt.Errorf("Failed to set %s, because %s is written on one line. Edit cog.yaml by hand instead", strings.Join(parts, "."), strings.Join(parts[:i], "."))
+		}
+		k, v := mappingValue(parent, part)
+		if k == nil {
+			return insertValue(contents, parentKey, parent, parts[i:], newValue)
+		}
+		if i == len(parts)-1 {
+			return replaceValue(contents, k, v, newValue)
+		}
+		if v.Kind == yamlv3.ScalarNode && v.Tag == "!!null" {
+			return insertValue(contents, k, v, parts[i+1:], newValue)
+		}
+		if v.Kind != yamlv3.MappingNode {
+			return "", fmt.Errorf("Failed to set %s, because %s is not a mapping", strings.Join(parts, "."), strings.Join(parts[:i+1], "."))
+		}
+		parentKey, parent = k, v
+	}
+	return contents, nil
+}
+
+// insertValue adds the keys in parts, nested in each other, to the mapping parent, which is the value of parentKey,
+// or the top level of the file if parentKey is nil
+func insertValue(contents string, parentKey *yamlv3.Node, parent *yamlv3.Node, parts []string, newValue *yamlv3.Node) (string, error) {
+	node := newValue
+	for i := len(parts) - 1; i >= 0; i-- {
+		node = &yamlv3.Node{Kind: yamlv3.MappingNode, Content: []*yamlv3.Node{{Kind: yamlv3.ScalarNode, Value: parts[i]}, node}}
+	}
+	encoded, err := encodeYAMLNode(node)
+	if err != nil {
+		return "", err
+	}
+
+	if parentKey == nil {
+		trimmed := strings.TrimRight(contents, "\n")
+		if trimmed == "" {
+			return encoded, nil
+		}
+		return trimmed + "\n" + encoded, nil
+	}
+
+	lines := strings.Split(contents, "\n")
+	indent := parentKey.Column - 1 + 2
+	if parent.Kind == yamlv3.MappingNode && len(parent.Content) > 0 {
+		indent = parent.Content[0].Column - 1
+	}
+	if parent.Kind == yamlv3.ScalarNode && parent.Line == parentKey.Line && parent.Value != "" {
+		// An explicit null, e.g. build: ~
+		line := lines[parent.Line-1]
+		lines[parent.Line-1] = strings.TrimRight(line[:parent.Column-1], " ")
+	}
+	end := blockEnd(lines, parentKey)
+	added := indentLines(encoded, strings.Repeat(" ", indent), strings.Repeat(" ", indent))
+	lines = append(lines[:end+1], append(added, lines[end+1:]...)...)
+	return strings.Join(lines, "\n"), nil
+}
+
+// replaceValue replaces the value v of the key k
+func replaceValue(contents string, k *yamlv3.Node, v *yamlv3.Node, newValue *yamlv3.Node) (string, error) {
+	lines := strings.Split(contents, "\n")
+
+	// Scalars on the same line as their key are replaced in place, so comments after them are kept
+	if v.Kind == yamlv3.ScalarNode && newValue.Kind == yamlv3.ScalarNode && v.Line == k.Line && v.Style&(yamlv3.LiteralStyle|yamlv3.FoldedStyle) == 0 {
+		encoded, err := encodeYAMLNode(newValue)
+		if err != nil {
+			return "", err
+		}
+		line := lines[v.Line-1]
+		rest := line[v.Column-1:]
+		comment := ""
+		for _, c := range []string{v.LineComment, k.LineComment} {
+			if i := strings.LastIndex(rest, c); c != "" && i != -1 {
+				comment = rest[i:]
+				rest = rest[:i]
+				break
+			}
+		}
+		space := rest[len(strings.TrimRight(rest, " \t")):]
+		lines[v.Line-1] = line[:v.Column-1] + strings.TrimSuffix(encoded, "\n") + space + comment
+		return strings.Join(lines, "\n"), nil
+	}
+
+	encoded, err := encodeYAMLNode(&yamlv3.Node{Kind: yamlv3.MappingNode, Content: []*yamlv3.Node{{Kind: yamlv3.ScalarNode, Value: k.Value}, newValue}})
+	if err != nil {
+		return "", err
+	}
+	start := k.Line - 1
+	end := blockEnd(lines, k)
+	// The key might be after the - of a list item
+	prefix := lines[start][:k.Column-1]
+	replaced := indentLines(encoded, prefix, strings.Repeat(" ", len(prefix)))
+	lines = append(lines[:start], append(replaced, lines[end+1:]...)...)
+	return strings.Join(lines, "\n"), nil
+}
+
+// blockEnd returns the index of the last line of the value of the key k: the lines after it that are indented
+// more than it, or that are items of a list at the same indentation. Comments and blank lines at the end are left
+// out, because they are usually about what comes next.
+func blockEnd(lines []string, k *yamlv3.Node) int {
+	indent := k.Column - 1
+	end := k.Line - 1
+	for i := k.Line; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		lineIndent := len(lines[i]) - len(strings.TrimLeft(lines[i], " "))
+		if lineIndent > indent || (lineIndent == indent && (trimmed == "-" || strings.HasPrefix(trimmed, "- "))) {
+			end = i
+			continue
+		}
+		break
+	}
+	return end
+}
+
+// indentLines splits YAML into lines, with first before the first line and rest before the others
+func indentLines(yaml string, first string, rest string) []string {
+	lines := strings.Split(strings.TrimSuffix(yaml, "\n"), "\n")
+	for i, line := range lines {
+		if i == 0 {
+			lines[i] = first + line
+		} else if line != "" {
+			lines[i] = rest + line
+		}
+	}
+	return lines
+}
+
+// parseValue parses a value passed on the command line as YAML. Numbers are kept as strings for keys that are
+// strings, so a CUDA version of 11.10 doesn't become 11.1.
+func parseValue(value string, keyType string) (*yamlv3.Node, error) {
+	doc := &yamlv3.Node{}
+	if err := yamlv3.Unmarshal([]byte(value), doc); err != nil {
+		return nil, fmt.Errorf("Failed to parse %s as YAML: %w", value, err)
+	}
+	if doc.Kind == 0 || len(doc.Content) == 0 {
+		return &yamlv3.Node{Kind: yamlv3.ScalarNode, Tag: "!!null", Value: "null"}, nil
+	}
+	node := doc.Content[0]
+	if node.Kind == yamlv3.ScalarNode && (node.Tag == "!!int" || node.Tag == "!!float") && strings.Contains(keyType, "string") {
+		node = &yamlv3.Node{Kind: yamlv3.ScalarNode, Tag: "!!str", Value: node.Value}
+	}
+	// The value is put somewhere else in the file, so its position and flow style from the command line don't apply
+	clearPosition(node)
+	return node, nil
+}
+
+func clearPosition(node *yamlv3.Node) {
+	node.Line, node.Column = 0, 0
+	node.Style &^= yamlv3.FlowStyle
+	for _, child := range node.Content {
+		clearPosition(child)
+	}
+}
+
+// lookupKey returns the key in the cog.yaml schema, or the mapping it's in if the keys in that aren't listed,
+// like build.templates
+func lookupKey(name string) (Key, error) {
+	keys, err := Keys()
+	if err != nil {
+		return Key{}, err
+	}
+	byName := map[string]Key{}
+	for _, k := range keys {
+		byName[k.Name] = k
+	}
+	if k, ok := byName[name]; ok {
+		return k, nil
+	}
+	parts := strings.Split(name, ".")
+	for i := len(parts) - 1; i > 0; i-- {
+		parent, ok := byName[strings.Join(parts[:i], ".")]
+		if !ok {
+			continue
+		}
+		hasChildren := false
+		for _, k := range keys {
+			if strings.HasPrefix(k.Name, parent.Name+".") {
+				hasChildren = true
+				break
+			}
+		}
+		if parent.Type == "object" && !hasChildren {
+			return Key{Name: name}, nil
+		}
+		break
+	}
+	return Key{}, fmt.Errorf("%s is not a key in cog.yaml. See https://cog.run/yaml for the keys it can have", name)
+}
+
+// parseYAMLNode returns the top-level node of a YAML document, or nil if it's empty
+func parseYAMLNode(contents []byte) (*yamlv3.Node, error) {
+	doc := &yamlv3.Node{}
+	if err := yamlv3.Unmarshal(contents, doc); err != nil {
+		return nil, fmt.Errorf("Failed to parse config yaml: %w", err)
+	}
+	if doc.Kind == 0 || len(doc.Content) == 0 {
+		return nil, nil
+	}
+	return doc.Content[0], nil
+}
+
+// mappingValue returns the key and value nodes of key in the mapping node, or nil if it isn't in it
+func mappingValue(node *yamlv3.Node, key string) (*yamlv3.Node, *yamlv3.Node) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i], node.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+func encodeYAMLNode(node *yamlv3.Node) (string, error) {
+	buf := &bytes.Buffer{}
+	encoder := yamlv3.NewEncoder(buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(node); err != nil {
+		return "", fmt.Errorf("Failed to encode YAML: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return "", fmt.Errorf("Failed to encode YAML: %w", err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,134 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const editYAML = `# Configuration for Cog
+build:
+  # Set to true for GPUs
+  gpu: false  # change me
+
+  python_version: "3.11"
+  python_packages:
+    - "torch==2.0.1"
+    - "numpy==1.24.0"
+
+  system_packages:
+  - ffmpeg
+
+# The predictor
+predict: "predict.py:Predictor"
+`
+
+func TestGetValue(t *testing.T) {
+	value, ok, err := GetValue([]byte(editYAML), "build.gpu")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "false", value)
+
+	value, ok, err = GetValue([]byte(editYAML), "build.python_version")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "3.11", value)
+
+	value, ok, err = GetValue([]byte(editYAML), "build.python_packages")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "- \"torch==2.0.1\"\n- \"numpy==1.24.0\"", value)
+
+	_, ok, err = GetValue([]byte(editYAML), "build.cuda")
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestSetValueScalarKeepsComments(t *testing.T) {
+	result, err := SetValue([]byte(editYAML), "build.gpu", "true")
+	require.NoError(t, err)
+	require.Equal(t, `# Configuration for Cog
+build:
+  # Set to true for GPUs
+  gpu: true  # change me
+
+  python_version: "3.11"
+  python_packages:
+    - "torch==2.0.1"
+    - "numpy==1.24.0"
+
+  system_packages:
+  - ffmpeg
+
+# The predictor
+predict: "predict.py:Predictor"
+`, string(result))
+}
+
+func TestSetValueStringKeysStayStrings(t *testing.T) {
+	result, err := SetValue([]byte(editYAML), "build.python_version", "3.10")
+	require.NoError(t, err)
+	require.Contains(t, string(result), `  python_version: "3.10"`+"\n")
+}
+
+func TestSetValueList(t *testing.T) {
+	result, err := SetValue([]byte(editYAML), "build.system_packages", "[ffmpeg, libsndfile1]")
+	require.NoError(t, err)
+	require.Equal(t, `# Configuration for Cog
+build:
+  # Set to true for GPUs
+  gpu: false  # change me
+
+  python_version: "3.11"
+  python_packages:
+    - "torch==2.0.1"
+    - "numpy==1.24.0"
+
+  system_packages:
+    - ffmpeg
+    - libsndfile1
+
+# The predictor
+predict: "predict.py:Predictor"
+`, string(result))
+}
+
+func TestSetValueNewKeys(t *testing.T) {
+	result, err := SetValue([]byte(editYAML), "build.cuda", "11.8")
+	require.NoError(t, err)
+	require.Contains(t, string(result), `  system_packages:
+  - ffmpeg
+  cuda: "11.8"
+
+# The predictor
+`)
+
+	result, err = SetValue([]byte(editYAML), "concurrency.max", "4")
+	require.NoError(t, err)
+	require.Equal(t, editYAML+"concurrency:\n  max: 4\n", string(result))
+
+	result, err = SetValue([]byte("build:\n"), "build.gpu", "true")
+	require.NoError(t, err)
+	require.Equal(t, "build:\n  gpu: true\n", string(result))
+
+	result, err = SetValue([]byte(""), "build.gpu", "true")
+	require.NoError(t, err)
+	require.Equal(t, "build:\n  gpu: true\n", string(result))
+}
+
+func TestSetValueUnmappedKeys(t *testing.T) {
+	result, err := SetValue([]byte(editYAML), "build.templates.run", "templates/run.tmpl")
+	require.NoError(t, err)
+	require.Contains(t, string(result), "  templates:\n    run: templates/run.tmpl\n")
+}
+
+func TestSetValueErrors(t *testing.T) {
+	_, err := SetValue([]byte(editYAML), "build.gpus", "true")
+	require.ErrorContains(t, err, "build.gpus is not a key in cog.yaml")
+
+	_, err = SetValue([]byte(editYAML), "build.gpu", "yes please")
+	require.ErrorContains(t, err, "Failed to set build.gpu")
+
+	_, err = SetValue([]byte("build: {gpu: true}\n"), "build.cuda", "11.8")
+	require.ErrorContains(t, err, "written on one line")
+}
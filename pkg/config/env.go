@@ -0,0 +1,55 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/replicate/cog/pkg/secrets"
+)
+
+// envNameRegexp matches the names of environment variables that can be set with ENV and in a shell
+var envNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// validateEnv checks build.env, build.args and runtime.env. They're kept in the image or its history, where anyone
+// who can pull it can read them, so names and values that look like secrets are errors.
+func (c *Config) validateEnv() error {
+	type envKey struct {
+		key   string
+		env   map[string]string
+		usage string
+	}
+	envs := []envKey{}
+	if c.Build != nil {
+		envs = append(envs, envKey{"build.env", c.Build.Env, "Pass it to the build with cog build --secret instead"})
+		envs = append(envs, envKey{"build.args", c.Build.Args, "Pass it to the build with cog build --secret instead"})
+	}
+	if c.Runtime != nil {
+		envs = append(envs, envKey{"runtime.env", c.Runtime.Env, "Set it when the model runs with -e instead"})
+	}
+
+	for _, e := range envs {
+		names := []string{}
+		for name := range e.env {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			value := e.env[name]
+			if !envNameRegexp.MatchString(name) {
+				return fmt.Errorf("%s.%s in cog.yaml isn't a valid environment variable name. It can only have letters, digits and underscores, and can't start with a digit", e.key, name)
+			}
+			if strings.ContainsAny(value, "\r\n") {
+				return fmt.Errorf("%s.%s in cog.yaml can't have a line break in it", e.key, name)
+			}
+			if secrets.IsSecretName(name) && value != "" {
+				return fmt.Errorf("%s.%s in cog.yaml looks like a secret, which would be kept in the image for anyone who can pull it to read. %s", e.key, name, e.usage)
+			}
+			if kind := secrets.Find(value); kind != "" {
+				return fmt.Errorf("%s.%s in cog.yaml looks like a %s, which would be kept in the image for anyone who can pull it to read. %s", e.key, name, kind, e.usage)
+			}
+		}
+	}
+	return nil
+}
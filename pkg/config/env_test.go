@@ -0,0 +1,35 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateEnv(t *testing.T) {
+	config, err := FromYAML([]byte(`build:
+  env:
+    HF_HOME: /src/.cache
+    TOKENIZERS_PARALLELISM: false
+runtime:
+  env:
+    HF_TOKEN: ""
+    MAX_BATCH: 8
+`))
+	require.NoError(t, err)
+	require.NoError(t, config.validateEnv())
+	require.Equal(t, map[string]string{"HF_TOKEN": "", "MAX_BATCH": "8"}, config.Runtime.Env)
+
+	for _, tt := range []struct {
+		config *Config
+		err    string
+	}{
+		{&Config{Build: &Build{Env: map[string]string{"1PATH": "x"}}}, "build.env.1PATH in cog.yaml isn't a valid environment variable name"},
+		{&Config{Build: &Build{Env: map[string]string{"GREETING": "a\nb"}}}, "build.env.GREETING in cog.yaml can't have a line break"},
+		{&Config{Build: &Build{Env: map[string]string{"HF_TOKEN": "abc"}}}, "build.env.HF_TOKEN in cog.yaml looks like a secret"},
+		{&Config{Build: &Build{Env: map[string]string{"AUTH": "hf_" + "abcdefghijklmnopqrstuvwxyzABCDEF"}}}, "build.env.AUTH in cog.yaml looks like a Hugging Face token"},
+		{&Config{Runtime: &Runtime{Env: map[string]string{"OPENAI_API_KEY": "abc"}}}, "runtime.env.OPENAI_API_KEY in cog.yaml looks like a secret, which would be kept in the image for anyone who can pull it to read. Set it when the model runs with -e instead"},
+	} {
+		require.ErrorContains(t, tt.config.validateEnv(), tt.err)
+	}
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// computeCapabilities are the NVIDIA GPU compute capabilities that CUDA 11 and 12 can build for, without the dot
+var computeCapabilities = []int{35, 37, 50, 52, 53, 60, 61, 62, 70, 72, 75, 80, 86, 87, 89, 90}
+
+func (c *Config) validateGPUArch() error {
+	if len(c.Build.GPUArch) == 0 {
+		return nil
+	}
+	if !c.Build.GPU {
+		return fmt.Errorf("gpu_arch is set in cog.yaml, but gpu isn't. Set gpu: true to build for GPUs")
+	}
+	known := []string{}
+	for _, arch := range computeCapabilities {
+		known = append(known, strconv.Itoa(arch))
+	}
+	for _, arch := range c.Build.GPUArch {
+		if i := sort.SearchInts(computeCapabilities, arch); i == len(computeCapabilities) || computeCapabilities[i] != arch {
+			return fmt.Errorf("%d in gpu_arch isn't a compute capability CUDA can build for. It must be one of: %s", arch, strings.Join(known, ", "))
+		}
+	}
+	return nil
+}
+
+// ComputeCapabilities returns the compute capabilities in build.gpu_arch in dotted form, e.g. 8.6, sorted and
+// without duplicates
+func (c *Config) ComputeCapabilities() []string {
+	archs := append([]int{}, c.Build.GPUArch...)
+	sort.Ints(archs)
+	capabilities := []string{}
+	for i, arch := range archs {
+		if i > 0 && archs[i-1] == arch {
+			continue
+		}
+		capabilities = append(capabilities, fmt.Sprintf("%d.%d", arch/10, arch%10))
+	}
+	return capabilities
+}
+
+// GPUArchEnv returns the environment variables that make PyTorch extensions, CMake and nvcc build for the
+// compute capabilities in build.gpu_arch
+func (c *Config) GPUArchEnv() []string {
+	capabilities := c.ComputeCapabilities()
+	if len(capabilities) == 0 {
+		return nil
+	}
+	archs := []string{}
+	gencodes := []string{}
+	for _, capability := range capabilities {
+		arch := strings.Replace(capability, ".", "", 1)
+		archs = append(archs, arch)
+		gencodes = append(gencodes, fmt.Sprintf("-gencode=arch=compute_%[1]s,code=sm_%[1]s", arch))
+	}
+	return []string{
+		fmt.Sprintf("TORCH_CUDA_ARCH_LIST=%q", strings.Join(capabilities, ";")),
+		fmt.Sprintf("CUDAARCHS=%q", strings.Join(archs, ";")),
+		fmt.Sprintf("NVCC_APPEND_FLAGS=%q", strings.Join(gencodes, " ")),
+	}
+}
@@ -0,0 +1,28 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestComputeCapabilities(t *testing.T) {
+	config, err := FromYAML([]byte("build:\n  gpu: true\n  gpu_arch: [90, 80, 86, 80]\n"))
+	require.NoError(t, err)
+	require.NoError(t, config.ValidateAndComplete(""))
+	require.Equal(t, []string{"8.0", "8.6", "9.0"}, config.ComputeCapabilities())
+}
+
+func TestGPUArchWithoutGPU(t *testing.T) {
+	config, err := FromYAML([]byte("build:\n  gpu_arch: [86]\n"))
+	require.NoError(t, err)
+	err = config.ValidateAndComplete("")
+	require.ErrorContains(t, err, "gpu isn't")
+}
+
+func TestUnknownGPUArch(t *testing.T) {
+	config, err := FromYAML([]byte("build:\n  gpu: true\n  gpu_arch: [81]\n"))
+	require.NoError(t, err)
+	err = config.ValidateAndComplete("")
+	require.ErrorContains(t, err, "81 in gpu_arch isn't a compute capability")
+}
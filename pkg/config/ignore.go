@@ -0,0 +1,86 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/replicate/cog/pkg/util/files"
+)
+
+// GlobRegexp converts a glob in cog.yaml or a .dockerignore to a regular expression. Globs are matched like in a
+// .dockerignore: * and ? don't match /, and ** matches any number of directories. On Windows, where paths are
+// case-insensitive, so are globs.
+func GlobRegexp(pattern string) (*regexp.Regexp, error) {
+	pattern = path.Clean(strings.TrimPrefix(strings.TrimSpace(filepath.ToSlash(pattern)), "/"))
+	re := "^"
+	if files.CaseInsensitive {
+		re = "(?i)" + re
+	}
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if strings.HasPrefix(pattern[i:], "**/") {
+				re += "(.*/)?"
+				i += 2
+			} else if strings.HasPrefix(pattern[i:], "**") {
+				re += ".*"
+				i++
+			} else {
+				re += "[^/]*"
+			}
+		case '?':
+			re += "[^/]"
+		case '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			if end == -1 {
+				return nil, fmt.Errorf("'%s' has a [ without a ]", pattern)
+			}
+			re += pattern[i : i+end+1]
+			i += end
+		default:
+			re += regexp.QuoteMeta(string(c))
+		}
+	}
+	return regexp.Compile(re + "$")
+}
+
+// IsIgnored returns whether the path p, relative to the project directory, matches a glob in build.ignore,
+// or is in a directory that does
+func (c *Config) IsIgnored(p string) bool {
+	if c.Build == nil {
+		return false
+	}
+	return matchesGlobs(c.Build.Ignore, p)
+}
+
+// matchesGlobs returns whether p, or a directory it is in, matches one of globs
+func matchesGlobs(globs []string, p string) bool {
+	p = path.Clean(filepath.ToSlash(p))
+	for _, pattern := range globs {
+		re, err := GlobRegexp(pattern)
+		if err != nil {
+			continue
+		}
+		for candidate := p; candidate != "." && candidate != "/"; candidate = path.Dir(candidate) {
+			if re.MatchString(candidate) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *Config) validateIgnore() error {
+	for _, pattern := range c.Build.Ignore {
+		if strings.HasPrefix(pattern, "!") {
+			return fmt.Errorf("'%s' in build.ignore can't start with !. To include files that build.ignore matches, add them to .dockerignore after the line '# cog:generated'", pattern)
+		}
+		if _, err := GlobRegexp(pattern); err != nil {
+			return fmt.Errorf("Invalid glob in build.ignore: %w", err)
+		}
+	}
+	return nil
+}
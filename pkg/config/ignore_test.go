@@ -0,0 +1,44 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsIgnored(t *testing.T) {
+	config, err := FromYAML([]byte(`
+build:
+  ignore:
+    - data
+    - "**/*.ckpt"
+    - notebooks/*.ipynb
+    - /logs/
+`))
+	require.NoError(t, err)
+	require.NoError(t, config.ValidateAndComplete(""))
+
+	for p, ignored := range map[string]bool{
+		"data":                          true,
+		"data/train/1.jpg":              true,
+		"src/data":                      false,
+		"model.ckpt":                    true,
+		"checkpoints/epoch-1/last.ckpt": true,
+		"notebooks/train.ipynb":         true,
+		"notebooks/old/train.ipynb":     false,
+		"logs/build.log":                true,
+		"predict.py":                    false,
+	} {
+		require.Equal(t, ignored, config.IsIgnored(p), p)
+	}
+}
+
+func TestInvalidIgnore(t *testing.T) {
+	config, err := FromYAML([]byte("build:\n  ignore:\n    - \"!data\"\n"))
+	require.NoError(t, err)
+	require.ErrorContains(t, config.ValidateAndComplete(""), "can't start with !")
+
+	config, err = FromYAML([]byte("build:\n  ignore:\n    - \"data[0-9\"\n"))
+	require.NoError(t, err)
+	require.ErrorContains(t, config.ValidateAndComplete(""), "has a [ without a ]")
+}
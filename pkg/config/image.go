@@ -0,0 +1,115 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v2"
+)
+
+// VersionFilename is the file in the project with the model's version, which image.tag_template can use, and
+// `cog push --bump` increments
+const VersionFilename = "VERSION"
+
+// TagData is what image.tag_template is rendered with
+type TagData struct {
+	// Version is the model's version, from the VERSION file
+	Version string
+	Python  string
+	CUDA    string
+	CuDNN   string
+	// Commit is the short hash of the Git commit the project is at
+	Commit string
+}
+
+// UnmarshalYAML reads the image key, which is either the image's name, or a map with its name and
+// tag_template, into Image and ImageTagTemplate
+func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain Config
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	image := struct {
+		Image interface{} `yaml:"image"`
+	}{}
+	if err := unmarshal(&image); err != nil {
+		return err
+	}
+	switch v := image.Image.(type) {
+	case nil:
+	case string:
+		c.Image = v
+	case map[interface{}]interface{}:
+		data, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		aux := struct {
+			Name        string `yaml:"name"`
+			TagTemplate string `yaml:"tag_template"`
+		}{}
+		if err := yaml.Unmarshal(data, &aux); err != nil {
+			return err
+		}
+		c.Image = aux.Name
+		c.ImageTagTemplate = aux.TagTemplate
+	default:
+		return fmt.Errorf("unexpected type %T for image", v)
+	}
+	return nil
+}
+
+func (c *Config) validateImage() error {
+	if c.ImageTagTemplate == "" {
+		return nil
+	}
+	if _, err := c.RenderTag(TagData{}); err != nil {
+		return err
+	}
+	return nil
+}
+
+// RenderTag returns the tag image.tag_template makes with data. Characters that can't be in a tag, like the +
+// in a version's build metadata, are replaced with dashes.
+func (c *Config) RenderTag(data TagData) (string, error) {
+	tmpl, err := template.New("tag_template").Option("missingkey=error").Parse(c.ImageTagTemplate)
+	if err != nil {
+		return "", fmt.Errorf("image.tag_template in cog.yaml isn't a valid template: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("image.tag_template in cog.yaml can only use .Version, .Python, .CUDA, .CuDNN and .Commit: %w", err)
+	}
+	tag := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '.' || r == '-' {
+			return r
+		}
+		return '-'
+	}, buf.String())
+	return strings.TrimLeft(tag, ".-"), nil
+}
+
+// ReadVersion returns the model's version from the VERSION file in projectDir, or an empty string if there
+// isn't one
+func ReadVersion(projectDir string) (string, error) {
+	contents, err := os.ReadFile(filepath.Join(projectDir, VersionFilename))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("Failed to read %s: %w", VersionFilename, err)
+	}
+	return strings.TrimSpace(string(contents)), nil
+}
+
+// WriteVersion writes the model's version to the VERSION file in projectDir
+func WriteVersion(projectDir string, version string) error {
+	if err := os.WriteFile(filepath.Join(projectDir, VersionFilename), []byte(version+"\n"), 0o644); err != nil {
+		return fmt.Errorf("Failed to write %s: %w", VersionFilename, err)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestImageName(t *testing.T) {
+	config, err := FromYAML([]byte(`
+build:
+  python_version: "3.11"
+image: r8.im/user/model
+`))
+	require.NoError(t, err)
+	require.Equal(t, "r8.im/user/model", config.Image)
+	require.Equal(t, "", config.ImageTagTemplate)
+}
+
+func TestImageTagTemplate(t *testing.T) {
+	config, err := FromYAML([]byte(`
+build:
+  python_version: "3.11"
+image:
+  name: r8.im/user/model
+  tag_template: "{{.Version}}-cuda{{.CUDA}}"
+`))
+	require.NoError(t, err)
+	require.Equal(t, "r8.im/user/model", config.Image)
+	tag, err := config.RenderTag(TagData{Version: "1.2.0+build.1", CUDA: "12.1"})
+	require.NoError(t, err)
+	require.Equal(t, "1.2.0-build.1-cuda12.1", tag)
+
+	_, err = FromYAML([]byte(`
+build:
+  python_version: "3.11"
+image:
+  name: r8.im/user/model
+  tags: latest
+`))
+	require.Error(t, err)
+}
+
+func TestImageTagTemplateValidation(t *testing.T) {
+	config := &Config{Build: &Build{PythonVersion: "3.11"}, ImageTagTemplate: "{{.Version"}
+	require.ErrorContains(t, config.validateImage(), "isn't a valid template")
+	config.ImageTagTemplate = "{{.Branch}}"
+	require.ErrorContains(t, config.validateImage(), "can only use")
+	config.ImageTagTemplate = "{{.Version}}-py{{.Python}}"
+	require.NoError(t, config.validateImage())
+}
+
+func TestReadWriteVersion(t *testing.T) {
+	dir := t.TempDir()
+	version, err := ReadVersion(dir)
+	require.NoError(t, err)
+	require.Equal(t, "", version)
+
+	require.NoError(t, WriteVersion(dir, "1.3.0"))
+	contents, err := os.ReadFile(filepath.Join(dir, VersionFilename))
+	require.NoError(t, err)
+	require.Equal(t, "1.3.0\n", string(contents))
+	version, err = ReadVersion(dir)
+	require.NoError(t, err)
+	require.Equal(t, "1.3.0", version)
+}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Key is a key that can be set in cog.yaml
+type Key struct {
+	// Name is the path to the key, with nested keys separated by dots, e.g. build.gpu
+	Name        string
+	Type        string
+	Description string
+}
+
+type schemaProperty struct {
+	Type        interface{}               `json:"type"`
+	Description string                    `json:"description"`
+	Properties  map[string]schemaProperty `json:"properties"`
+}
+
+// Keys returns every key that can be set in cog.yaml, from the schema of its latest version, sorted by name
+func Keys() ([]Key, error) {
+	root := schemaProperty{}
+	if err := json.Unmarshal(schemaV1, &root); err != nil {
+		return nil, fmt.Errorf("Failed to parse cog.yaml schema: %w", err)
+	}
+	keys := schemaKeys("", root)
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Name < keys[j].Name })
+	return keys, nil
+}
+
+func schemaKeys(prefix string, property schemaProperty) []Key {
+	keys := []Key{}
+	for name, child := range property.Properties {
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		keys = append(keys, Key{Name: name, Type: schemaTypeName(child.Type), Description: child.Description})
+		keys = append(keys, schemaKeys(name, child)...)
+	}
+	return keys
+}
+
+// schemaTypeName returns a JSON schema type, which is a string or a list of them, as a string, leaving out null
+func schemaTypeName(t interface{}) string {
+	switch t := t.(type) {
+	case string:
+		return t
+	case []interface{}:
+		types := []string{}
+		for _, item := range t {
+			if s, ok := item.(string); ok && s != "null" {
+				types = append(types, s)
+			}
+		}
+		return strings.Join(types, " or ")
+	}
+	return ""
+}
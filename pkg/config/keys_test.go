@@ -0,0 +1,23 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeys(t *testing.T) {
+	keys, err := Keys()
+	require.NoError(t, err)
+
+	byName := map[string]Key{}
+	for _, key := range keys {
+		byName[key.Name] = key
+	}
+	require.Equal(t, "boolean", byName["build.gpu"].Type)
+	require.Contains(t, byName["build.gpu"].Description, "Enable GPUs")
+	require.Equal(t, "object", byName["build"].Type)
+	require.Equal(t, "integer", byName["concurrency.max"].Type)
+	require.Equal(t, "array", byName["build.gpu_arch"].Type)
+	require.Equal(t, "auth", keys[0].Name)
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/replicate/cog/pkg/errors"
 	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/util/console"
 	"github.com/replicate/cog/pkg/util/files"
 )
 
@@ -36,19 +37,27 @@ func GetConfig(customDir string) (*Config, string, error) {
 	}
 	configPath := path.Join(rootDir, global.ConfigFilename)
 
-	// Then try to load the config file from there
-	config, err := loadConfigFromFile(configPath)
+	defaults, err := LoadDefaults()
 	if err != nil {
 		return nil, "", err
 	}
 
+	// Then try to load the config file from there
+	config, err := loadConfigFromFile(configPath, defaults)
+	if err != nil {
+		return nil, "", errors.ConfigInvalid(err)
+	}
+	if config.Image == "" {
+		config.Image = defaults.ImageName(rootDir)
+	}
+
 	err = config.ValidateAndComplete(rootDir)
 
-	return config, rootDir, err
+	return config, rootDir, errors.ConfigInvalid(err)
 }
 
-// Given a file path, attempt to load a config from that file
-func loadConfigFromFile(file string) (*Config, error) {
+// Given a file path, attempt to load a config from that file, with the cog.yaml keys in defaults under it
+func loadConfigFromFile(file string, defaults *Defaults) (*Config, error) {
 	exists, err := files.Exists(file)
 	if err != nil {
 		return nil, err
@@ -63,10 +72,29 @@ func loadConfigFromFile(file string) (*Config, error) {
 		return nil, err
 	}
 
-	config, err := FromYAML(contents)
+	// The project's cog.yaml comes first, then its workspace, then the defaults
+	workspace, err := FindWorkspace(filepath.Dir(file))
 	if err != nil {
 		return nil, err
 	}
+	merged := contents
+	if workspace != nil {
+		if merged, err = workspace.MergeUnder(merged); err != nil {
+			return nil, err
+		}
+	}
+	merged, err = defaults.MergeUnder(merged)
+	if err != nil {
+		return nil, err
+	}
+	config, err := FromYAML(merged)
+	if err != nil {
+		return nil, err
+	}
+	config.Workspace = workspace
+	if warning := SchemaWarning(contents); warning != "" {
+		console.Warn(warning)
+	}
 
 	return config, nil
 
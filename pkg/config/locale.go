@@ -0,0 +1,46 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// timezoneRegexp matches IANA time zone names, e.g. Europe/Berlin or UTC
+	timezoneRegexp = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_+\-]*(/[A-Za-z0-9_+\-]+)*$`)
+	// localeRegexp matches locale names with a character set, e.g. en_US.UTF-8, de_DE.UTF-8@euro or C.UTF-8
+	localeRegexp = regexp.MustCompile(`^([a-z]{2,3}(_[A-Z]{2})?|C)\.([A-Za-z0-9\-]+)(@[a-z]+)?$`)
+)
+
+func (c *Config) validateLocale() error {
+	if c.Build.Timezone != "" && !timezoneRegexp.MatchString(c.Build.Timezone) {
+		return fmt.Errorf("build.timezone in cog.yaml must be a time zone name like Europe/Berlin or UTC, not %s", c.Build.Timezone)
+	}
+	if c.Build.Locale != "" && !localeRegexp.MatchString(c.Build.Locale) {
+		return fmt.Errorf("build.locale in cog.yaml must be a locale with a character set like en_US.UTF-8, not %s", c.Build.Locale)
+	}
+	return nil
+}
+
+// localeSystemPackages returns the system packages that build.timezone and build.locale need
+func (c *Config) localeSystemPackages() []string {
+	packages := []string{}
+	if c.Build.Timezone != "" {
+		packages = append(packages, "tzdata")
+	}
+	if input, _ := c.LocaleDefinition(); input != "" {
+		packages = append(packages, "locales")
+	}
+	return packages
+}
+
+// LocaleDefinition returns the locale and character set that build.locale is compiled from with localedef, e.g.
+// en_US and UTF-8, or empty strings if it doesn't need compiling, like C.UTF-8, which every image has
+func (c *Config) LocaleDefinition() (input string, charmap string) {
+	match := localeRegexp.FindStringSubmatch(c.Build.Locale)
+	if match == nil || match[1] == "C" {
+		return "", ""
+	}
+	return match[1] + match[4], strings.ToUpper(match[3])
+}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateLocale(t *testing.T) {
+	for _, tt := range []struct {
+		timezone string
+		locale   string
+		err      string
+	}{
+		{timezone: "Europe/Berlin", locale: "en_US.UTF-8"},
+		{timezone: "UTC", locale: "C.UTF-8"},
+		{timezone: "America/Argentina/Buenos_Aires", locale: "de_DE.UTF-8@euro"},
+		{timezone: "Etc/GMT+3"},
+		{timezone: "Europe/Berlin; rm -rf /", err: "build.timezone"},
+		{timezone: "../etc/passwd", err: "build.timezone"},
+		{locale: "en_US", err: "build.locale"},
+		{locale: "en_US.UTF-8 && true", err: "build.locale"},
+	} {
+		config := &Config{Build: &Build{Timezone: tt.timezone, Locale: tt.locale}}
+		err := config.validateLocale()
+		if tt.err == "" {
+			require.NoError(t, err, tt)
+		} else {
+			require.ErrorContains(t, err, tt.err)
+		}
+	}
+}
+
+func TestLocaleSystemPackages(t *testing.T) {
+	config := &Config{Build: &Build{SystemPackages: []string{"ffmpeg", "tzdata"}, Timezone: "Europe/Berlin", Locale: "en_US.UTF-8"}}
+	require.Equal(t, []string{"ffmpeg", "tzdata", "locales"}, config.SystemPackages())
+
+	input, charmap := config.LocaleDefinition()
+	require.Equal(t, "en_US", input)
+	require.Equal(t, "UTF-8", charmap)
+
+	config.Build.Locale = "C.UTF-8"
+	require.Equal(t, []string{"ffmpeg", "tzdata"}, config.SystemPackages())
+
+	config.Build.Locale = "de_DE.utf-8@euro"
+	input, charmap = config.LocaleDefinition()
+	require.Equal(t, "de_DE@euro", input)
+	require.Equal(t, "UTF-8", charmap)
+}
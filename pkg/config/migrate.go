@@ -0,0 +1,217 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+
+	"github.com/replicate/cog/pkg/global"
+)
+
+// CurrentSchemaVersion is the version of the cog.yaml schema this version of Cog understands. cog.yaml files
+// without a schema_version are from before it was versioned, and are treated as version 0.
+const CurrentSchemaVersion = 1
+
+// Migration upgrades cog.yaml to Version from the version before it
+type Migration struct {
+	Version     int
+	Description string
+	// Apply returns the migrated cog.yaml contents, or the contents unchanged if there is nothing to migrate
+	Apply func(contents []byte) ([]byte, error)
+}
+
+// migrations are applied in order to cog.yaml files with an older schema version
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "Moved build.pre_install to the end of build.run",
+		Apply:       migratePreInstall,
+	},
+}
+
+// SchemaVersion returns the schema_version in the cog.yaml contents, or 0 if it isn't set
+func SchemaVersion(contents []byte) (int, error) {
+	value, ok, err := GetValue(contents, "schema_version")
+	if err != nil || !ok {
+		return 0, err
+	}
+	version, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("schema_version must be a number, not %s", value)
+	}
+	return version, nil
+}
+
+// Migrate upgrades the cog.yaml contents to CurrentSchemaVersion. Like SetValue, only the lines that need to
+// change are changed, so comments are kept. It returns the descriptions of the migrations that changed something.
+func Migrate(contents []byte) (migrated []byte, applied []string, err error) {
+	version, err := SchemaVersion(contents)
+	if err != nil {
+		return nil, nil, err
+	}
+	if version > CurrentSchemaVersion {
+		return nil, nil, fmt.Errorf("%s has schema version %d, which is newer than this version of Cog understands (%d). Upgrade Cog to use it", global.ConfigFilename, version, CurrentSchemaVersion)
+	}
+
+	migrated = contents
+	for _, migration := range migrations {
+		if migration.Version <= version {
+			continue
+		}
+		result, err := migration.Apply(migrated)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to migrate %s to schema version %d: %w", global.ConfigFilename, migration.Version, err)
+		}
+		if !bytes.Equal(result, migrated) {
+			applied = append(applied, migration.Description)
+		}
+		migrated = result
+	}
+
+	if version != CurrentSchemaVersion {
+		if migrated, err = setSchemaVersion(migrated); err != nil {
+			return nil, nil, err
+		}
+	}
+	if _, err := FromYAML(migrated); err != nil {
+		return nil, nil, fmt.Errorf("Failed to migrate %s: %w", global.ConfigFilename, err)
+	}
+	return migrated, applied, nil
+}
+
+// SchemaWarning returns a warning if the cog.yaml contents are for an older or newer schema version, or an empty
+// string if they're up to date. Files without a schema_version are only warned about if they need migrating, so
+// projects that don't use anything deprecated don't have to change.
+func SchemaWarning(contents []byte) string {
+	version, err := SchemaVersion(contents)
+	if err != nil {
+		// The schema validation reports this
+		return ""
+	}
+	if version > CurrentSchemaVersion {
+		return fmt.Sprintf("%s has schema version %d, which is newer than this version of Cog understands (%d). Upgrade Cog to use it", global.ConfigFilename, version, CurrentSchemaVersion)
+	}
+	if version == CurrentSchemaVersion {
+		return ""
+	}
+	_, applied, err := Migrate(contents)
+	if err != nil || (version == 0 && len(applied) == 0) {
+		return ""
+	}
+	if version == 0 {
+		return fmt.Sprintf("%s uses deprecated keys. Run 'cog migrate' to upgrade it to schema version %d", global.ConfigFilename, CurrentSchemaVersion)
+	}
+	return fmt.Sprintf("%s has schema version %d, but the current one is %d. Run 'cog migrate' to upgrade it", global.ConfigFilename, version, CurrentSchemaVersion)
+}
+
+// setSchemaVersion sets schema_version to CurrentSchemaVersion. If it isn't in the file, it's added before the
+// first key, so it's at the top like a version header.
+func setSchemaVersion(contents []byte) ([]byte, error) {
+	value := strconv.Itoa(CurrentSchemaVersion)
+	root, err := parseYAMLNode(contents)
+	if err != nil {
+		return nil, err
+	}
+	if root == nil || root.Kind != yamlv3.MappingNode || len(root.Content) == 0 || root.Style&yamlv3.FlowStyle != 0 {
+		return SetValue(contents, "schema_version", value)
+	}
+	if k, _ := mappingValue(root, "schema_version"); k != nil {
+		return SetValue(contents, "schema_version", value)
+	}
+
+	lines := strings.Split(string(contents), "\n")
+	first := root.Content[0].Line - 1
+	// Keep the comment above the first key with it, unless it's the comment at the top of the file
+	start := first
+	for start > 0 && strings.HasPrefix(strings.TrimSpace(lines[start-1]), "#") {
+		start--
+	}
+	if start == 0 {
+		start = first
+	}
+	lines = append(lines[:start], append([]string{"schema_version: " + value}, lines[start:]...)...)
+	return []byte(strings.Join(lines, "\n")), nil
+}
+
+// migratePreInstall moves the commands in build.pre_install to the end of build.run, which is where they were run
+func migratePreInstall(contents []byte) ([]byte, error) {
+	root, err := parseYAMLNode(contents)
+	if err != nil || root == nil || root.Kind != yamlv3.MappingNode {
+		return contents, err
+	}
+	buildKey, build := mappingValue(root, "build")
+	if build == nil || build.Kind != yamlv3.MappingNode {
+		return contents, nil
+	}
+	preInstallKey, preInstall := mappingValue(build, "pre_install")
+	if preInstallKey == nil {
+		return contents, nil
+	}
+	if build.Style&yamlv3.FlowStyle != 0 {
+		return nil, fmt.Errorf("build is written on one line. Move build.pre_install to build.run by hand instead")
+	}
+
+	result := string(contents)
+	if preInstall.Kind == yamlv3.SequenceNode && len(preInstall.Content) > 0 {
+		commands := &yamlv3.Node{Kind: yamlv3.SequenceNode}
+		for _, command := range preInstall.Content {
+			clearPosition(command)
+			commands.Content = append(commands.Content, command)
+		}
+		if result, err = appendToList(result, buildKey, build, "run", commands); err != nil {
+			return nil, err
+		}
+		// The lines have moved, so find pre_install again
+		if root, err = parseYAMLNode([]byte(result)); err != nil {
+			return nil, err
+		}
+		_, build = mappingValue(root, "build")
+		preInstallKey, _ = mappingValue(build, "pre_install")
+	}
+	return []byte(removeKey(result, preInstallKey)), nil
+}
+
+// appendToList adds the items to the end of the list key in the mapping parent, which is the value of parentKey.
+// If the list is written one item per line, the items are added after its last line, so its comments are kept.
+func appendToList(contents string, parentKey *yamlv3.Node, parent *yamlv3.Node, key string, items *yamlv3.Node) (string, error) {
+	k, v := mappingValue(parent, key)
+	if k == nil {
+		return insertValue(contents, parentKey, parent, []string{key}, items)
+	}
+	if v.Kind != yamlv3.SequenceNode || v.Style&yamlv3.FlowStyle != 0 || len(v.Content) == 0 {
+		list := &yamlv3.Node{Kind: yamlv3.SequenceNode}
+		if v.Kind == yamlv3.SequenceNode {
+			list.Content = append(list.Content, v.Content...)
+		}
+		list.Content = append(list.Content, items.Content...)
+		clearPosition(list)
+		return replaceValue(contents, k, v, list)
+	}
+
+	lines := strings.Split(contents, "\n")
+	first := v.Content[0]
+	dash := strings.LastIndex(lines[first.Line-1][:first.Column-1], "-")
+	if dash == -1 {
+		return "", fmt.Errorf("Failed to find the start of the first item of %s", key)
+	}
+	encoded, err := encodeYAMLNode(items)
+	if err != nil {
+		return "", err
+	}
+	end := blockEnd(lines, k)
+	prefix := strings.Repeat(" ", dash)
+	added := indentLines(encoded, prefix, prefix)
+	lines = append(lines[:end+1], append(added, lines[end+1:]...)...)
+	return strings.Join(lines, "\n"), nil
+}
+
+// removeKey removes the key k and its value
+func removeKey(contents string, k *yamlv3.Node) string {
+	lines := strings.Split(contents, "\n")
+	start := k.Line - 1
+	end := blockEnd(lines, k)
+	return strings.Join(append(lines[:start], lines[end+1:]...), "\n")
+}
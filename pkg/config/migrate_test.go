@@ -0,0 +1,153 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigratePreInstall(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		contents string
+		expected string
+	}{
+		{
+			name: "appended to run",
+			contents: `# Configuration for Cog
+
+build:
+  python_version: "3.11"
+  run:
+    # download the tokenizer
+    - curl -o tokenizer.json https://example.com/tokenizer.json
+  pre_install:
+    - pip install cython
+  system_packages:
+    - ffmpeg
+predict: predict.py:Predictor
+`,
+			expected: `# Configuration for Cog
+
+schema_version: 1
+build:
+  python_version: "3.11"
+  run:
+    # download the tokenizer
+    - curl -o tokenizer.json https://example.com/tokenizer.json
+    - pip install cython
+  system_packages:
+    - ffmpeg
+predict: predict.py:Predictor
+`,
+		},
+		{
+			name: "no run",
+			contents: `build:
+  pre_install:
+    - pip install cython
+    - echo hello
+  gpu: true # needs a GPU
+`,
+			expected: `schema_version: 1
+build:
+  gpu: true # needs a GPU
+  run:
+    - pip install cython
+    - echo hello
+`,
+		},
+		{
+			name: "run on one line",
+			contents: `build:
+  run: [echo hello]
+  pre_install: [pip install cython]
+`,
+			expected: `schema_version: 1
+build:
+  run:
+    - echo hello
+    - pip install cython
+`,
+		},
+		{
+			name: "nothing to migrate",
+			contents: `image: r8.im/example/model
+# the model
+build:
+  gpu: true
+`,
+			expected: `schema_version: 1
+image: r8.im/example/model
+# the model
+build:
+  gpu: true
+`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			migrated, applied, err := Migrate([]byte(tt.contents))
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, string(migrated))
+
+			version, err := SchemaVersion(migrated)
+			require.NoError(t, err)
+			require.Equal(t, CurrentSchemaVersion, version)
+
+			config, err := FromYAML(migrated)
+			require.NoError(t, err)
+			require.Empty(t, config.Build.PreInstall)
+			if tt.name == "nothing to migrate" {
+				require.Empty(t, applied)
+			} else {
+				require.Len(t, applied, 1)
+			}
+		})
+	}
+}
+
+func TestMigrateKeepsPreInstallOrder(t *testing.T) {
+	contents := []byte(`build:
+  run:
+    - command: echo first
+      mounts:
+        - type: secret
+          id: token
+          target: /token
+  pre_install:
+    - echo second
+`)
+	original, err := FromYAML(contents)
+	require.NoError(t, err)
+	migrated, _, err := Migrate(contents)
+	require.NoError(t, err)
+	config, err := FromYAML(migrated)
+	require.NoError(t, err)
+
+	commands := []string{}
+	for _, run := range config.Build.Run {
+		commands = append(commands, run.Command)
+	}
+	require.Equal(t, []string{"echo first", "echo second"}, commands)
+	require.Equal(t, original.Build.Run[0], config.Build.Run[0])
+}
+
+func TestMigrateUpToDate(t *testing.T) {
+	contents := []byte("schema_version: 1\nbuild:\n  gpu: true\n")
+	migrated, applied, err := Migrate(contents)
+	require.NoError(t, err)
+	require.Empty(t, applied)
+	require.Equal(t, string(contents), string(migrated))
+	require.Empty(t, SchemaWarning(contents))
+}
+
+func TestMigrateNewerSchema(t *testing.T) {
+	_, _, err := Migrate([]byte("schema_version: 99\n"))
+	require.ErrorContains(t, err, "newer than this version of Cog")
+}
+
+func TestSchemaWarning(t *testing.T) {
+	require.Empty(t, SchemaWarning([]byte("build:\n  gpu: true\n")))
+	require.Contains(t, SchemaWarning([]byte("build:\n  pre_install:\n    - echo hello\n")), "cog migrate")
+	require.Contains(t, SchemaWarning([]byte("schema_version: 99\n")), "Upgrade Cog")
+}
@@ -0,0 +1,74 @@
+package config
+
+// preset is a set of system packages and Python packages that are known to work together on Cog's base images
+type preset struct {
+	systemPackages []string
+	pythonPackages []presetPythonPackage
+}
+
+// presetPythonPackage is a Python package a preset installs, unless any of the packages in providedBy
+// are already in the model's Python packages
+type presetPythonPackage struct {
+	requirement string
+	providedBy  []string
+}
+
+// presets are the presets that can be used in build.presets
+var presets = map[string]preset{
+	"ffmpeg": {
+		systemPackages: []string{"ffmpeg"},
+	},
+	"opencv": {
+		systemPackages: []string{"libgl1", "libglib2.0-0"},
+		pythonPackages: []presetPythonPackage{
+			{"opencv-python-headless==4.8.1.78", []string{"opencv-python", "opencv-python-headless", "opencv-contrib-python", "opencv-contrib-python-headless"}},
+		},
+	},
+	"audio": {
+		systemPackages: []string{"ffmpeg", "libsndfile1"},
+		pythonPackages: []presetPythonPackage{
+			{"soundfile==0.12.1", []string{"soundfile"}},
+		},
+	},
+}
+
+// SystemPackages returns the system packages to install, which are system_packages and the system packages
+// of the presets
+func (c *Config) SystemPackages() []string {
+	packages := append([]string{}, c.Build.SystemPackages...)
+	for _, name := range c.Build.Presets {
+		for _, pkg := range presets[name].systemPackages {
+			if !sliceContains(packages, pkg) {
+				packages = append(packages, pkg)
+			}
+		}
+	}
+	for _, pkg := range append(c.localeSystemPackages(), c.serveSystemPackages()...) {
+		if !sliceContains(packages, pkg) {
+			packages = append(packages, pkg)
+		}
+	}
+	return packages
+}
+
+// presetPythonRequirements returns the Python packages of the presets that aren't in requirements already
+func (c *Config) presetPythonRequirements(requirements []string) []string {
+	names := map[string]bool{}
+	for _, requirement := range append(append([]string{}, c.Build.PythonPackagesStable...), requirements...) {
+		names[pythonRequirementName(requirement)] = true
+	}
+	added := []string{}
+	for _, name := range c.Build.Presets {
+		for _, pkg := range presets[name].pythonPackages {
+			provided := false
+			for _, p := range pkg.providedBy {
+				provided = provided || names[p]
+			}
+			if !provided {
+				added = append(added, pkg.requirement)
+				names[pythonRequirementName(pkg.requirement)] = true
+			}
+		}
+	}
+	return added
+}
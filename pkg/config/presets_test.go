@@ -0,0 +1,60 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPresets(t *testing.T) {
+	config, err := FromYAML([]byte(`
+build:
+  presets:
+    - opencv
+    - audio
+  system_packages:
+    - ffmpeg
+  python_packages:
+    - soundfile==0.12.0
+    - opencv_python_headless==4.7.0.72
+    - pydub==0.25.1
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, config.ValidateAndComplete(""))
+
+	require.Equal(t, []string{"ffmpeg", "libgl1", "libglib2.0-0", "libsndfile1"}, config.SystemPackages())
+
+	// The model's own versions of the presets' Python packages are used
+	requirements, err := config.PythonRequirementsForArch("", "")
+	require.NoError(t, err)
+	require.Equal(t, "soundfile==0.12.0\nopencv_python_headless==4.7.0.72\npydub==0.25.1", requirements)
+
+	require.Empty(t, config.SystemPackageAdvice())
+}
+
+func TestPresetPythonPackages(t *testing.T) {
+	config, err := FromYAML([]byte(`
+build:
+  presets:
+    - opencv
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, config.ValidateAndComplete(""))
+
+	requirements, err := config.PythonRequirementsForArch("", "")
+	require.NoError(t, err)
+	require.Equal(t, "opencv-python-headless==4.8.1.78", requirements)
+}
+
+func TestUnknownPreset(t *testing.T) {
+	_, err := FromYAML([]byte(`
+build:
+  presets:
+    - imagemagick
+predict: predict.py:Predictor
+`))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `build.presets.0 must be one of the following: "ffmpeg", "opencv", "audio"`)
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"os"
+	"strings"
+)
+
+// Proxy is the proxy the build reaches the internet through, e.g. on a corporate network
+type Proxy struct {
+	HTTP  string `json:"http,omitempty" yaml:"http"`
+	HTTPS string `json:"https,omitempty" yaml:"https"`
+	// NoProxy are the hosts and domains that are reached without the proxy
+	NoProxy []string `json:"no_proxy,omitempty" yaml:"no_proxy"`
+}
+
+// BuildProxy returns the proxy for the build: what's set in override, e.g. from command line flags, then what's
+// in build.proxy, then the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables
+func (c *Config) BuildProxy(override Proxy) Proxy {
+	proxy := Proxy{}
+	if c.Build != nil && c.Build.Proxy != nil {
+		proxy = *c.Build.Proxy
+	}
+	if override.HTTP != "" {
+		proxy.HTTP = override.HTTP
+	}
+	if override.HTTPS != "" {
+		proxy.HTTPS = override.HTTPS
+	}
+	if len(override.NoProxy) > 0 {
+		proxy.NoProxy = override.NoProxy
+	}
+
+	if proxy.HTTP == "" {
+		proxy.HTTP = proxyEnv("HTTP_PROXY")
+	}
+	if proxy.HTTPS == "" {
+		proxy.HTTPS = proxyEnv("HTTPS_PROXY")
+	}
+	if len(proxy.NoProxy) == 0 {
+		if noProxy := proxyEnv("NO_PROXY"); noProxy != "" {
+			proxy.NoProxy = strings.Split(noProxy, ",")
+		}
+	}
+	return proxy
+}
+
+// BuildArgs returns the proxy as Docker's predefined build args. Every RUN instruction in every stage gets them
+// as environment variables without an ARG instruction, and they aren't kept in the image or its history.
+// Both cases are set, because some tools only read the lowercase ones.
+func (p Proxy) BuildArgs() []string {
+	args := []string{}
+	for _, v := range []struct {
+		name  string
+		value string
+	}{
+		{"HTTP_PROXY", p.HTTP},
+		{"HTTPS_PROXY", p.HTTPS},
+		{"NO_PROXY", strings.Join(p.NoProxy, ",")},
+	} {
+		if v.value == "" {
+			continue
+		}
+		args = append(args, v.name+"="+v.value, strings.ToLower(v.name)+"="+v.value)
+	}
+	return args
+}
+
+// proxyEnv returns the environment variable name, or its lowercase version if it isn't set
+func proxyEnv(name string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return os.Getenv(strings.ToLower(name))
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildProxy(t *testing.T) {
+	t.Setenv("HTTP_PROXY", "")
+	t.Setenv("http_proxy", "http://env.example.com:3128")
+	t.Setenv("HTTPS_PROXY", "http://env.example.com:3129")
+	t.Setenv("NO_PROXY", "localhost,.internal")
+
+	config := &Config{Build: &Build{}}
+	require.Equal(t, Proxy{
+		HTTP:    "http://env.example.com:3128",
+		HTTPS:   "http://env.example.com:3129",
+		NoProxy: []string{"localhost", ".internal"},
+	}, config.BuildProxy(Proxy{}))
+
+	config.Build.Proxy = &Proxy{HTTPS: "http://config.example.com:3128", NoProxy: []string{"pypi.internal"}}
+	require.Equal(t, Proxy{
+		HTTP:    "http://env.example.com:3128",
+		HTTPS:   "http://flag.example.com:3128",
+		NoProxy: []string{"pypi.internal"},
+	}, config.BuildProxy(Proxy{HTTPS: "http://flag.example.com:3128"}))
+}
+
+func TestProxyBuildArgs(t *testing.T) {
+	require.Equal(t, []string{}, Proxy{}.BuildArgs())
+	require.Equal(t, []string{
+		"HTTPS_PROXY=http://proxy.example.com:3128",
+		"https_proxy=http://proxy.example.com:3128",
+		"NO_PROXY=localhost,.internal",
+		"no_proxy=localhost,.internal",
+	}, Proxy{HTTPS: "http://proxy.example.com:3128", NoProxy: []string{"localhost", ".internal"}}.BuildArgs())
+}
+
+func TestProxyConfig(t *testing.T) {
+	config, err := FromYAML([]byte(`build:
+  proxy:
+    http: http://proxy.example.com:3128
+    no_proxy: [localhost]
+`))
+	require.NoError(t, err)
+	require.Equal(t, &Proxy{HTTP: "http://proxy.example.com:3128", NoProxy: []string{"localhost"}}, config.Build.Proxy)
+
+	_, err = FromYAML([]byte("build:\n  proxy:\n    ftp: ftp://proxy.example.com\n"))
+	require.Error(t, err)
+}
@@ -0,0 +1,43 @@
+package config
+
+import "fmt"
+
+const (
+	// QuantizeAWQ quantizes Hugging Face models to 4 bits with AutoAWQ
+	QuantizeAWQ = "awq"
+	// QuantizeGPTQ quantizes Hugging Face models to 4 bits with GPTQ
+	QuantizeGPTQ = "gptq"
+	// QuantizeGGUFQ4 converts Hugging Face models to GGUF with llama.cpp and quantizes them to Q4_K_M
+	QuantizeGGUFQ4 = "gguf-q4"
+)
+
+// Optimize configures steps that make the built image smaller or faster
+type Optimize struct {
+	Quantize *Quantize `json:"quantize,omitempty" yaml:"quantize"`
+}
+
+// Quantize configures quantizing the model's weights during the build
+type Quantize struct {
+	Method string `json:"method,omitempty" yaml:"method"`
+}
+
+// QuantizeMethod returns the method in build.optimize.quantize, or "" if the weights aren't quantized
+func (c *Config) QuantizeMethod() string {
+	if c.Build.Optimize == nil || c.Build.Optimize.Quantize == nil {
+		return ""
+	}
+	return c.Build.Optimize.Quantize.Method
+}
+
+// QuantizeNeedsGPU returns whether quantizing with method needs a GPU
+func QuantizeNeedsGPU(method string) bool {
+	return method == QuantizeAWQ || method == QuantizeGPTQ
+}
+
+func (c *Config) validateQuantize() error {
+	method := c.QuantizeMethod()
+	if QuantizeNeedsGPU(method) && !c.Build.GPU {
+		return fmt.Errorf("Quantizing with %s needs a GPU, but gpu isn't set in cog.yaml. Set gpu: true, or use gguf-q4, which runs on the CPU", method)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/docker/go-units"
+)
+
+// Resources are the least the model needs from the machine it runs on
+type Resources struct {
+	// CPU is the number of CPUs, which can be fractional, e.g. 0.5
+	CPU float64 `json:"cpu,omitempty" yaml:"cpu"`
+	// Memory, GPUMemory and Disk are sizes like 16GB. GPUMemory is the memory of one GPU, and Disk is the free
+	// space the model needs to write to.
+	Memory    string `json:"memory,omitempty" yaml:"memory"`
+	GPUMemory string `json:"gpu_memory,omitempty" yaml:"gpu_memory"`
+	Disk      string `json:"disk,omitempty" yaml:"disk"`
+}
+
+// ResourceRequirements are Resources with the sizes in bytes. Anything that isn't set is 0.
+type ResourceRequirements struct {
+	CPU            float64
+	MemoryBytes    int64
+	GPUMemoryBytes int64
+	DiskBytes      int64
+}
+
+// IsZero returns whether nothing is required
+func (r ResourceRequirements) IsZero() bool {
+	return r == ResourceRequirements{}
+}
+
+// ResourceRequirements returns the resources in cog.yaml, with the sizes in bytes
+func (c *Config) ResourceRequirements() (ResourceRequirements, error) {
+	req := ResourceRequirements{}
+	if c.Resources == nil {
+		return req, nil
+	}
+	req.CPU = c.Resources.CPU
+	errs := []error{}
+	for _, size := range []struct {
+		key   string
+		value string
+		bytes *int64
+	}{
+		{"memory", c.Resources.Memory, &req.MemoryBytes},
+		{"gpu_memory", c.Resources.GPUMemory, &req.GPUMemoryBytes},
+		{"disk", c.Resources.Disk, &req.DiskBytes},
+	} {
+		if size.value == "" {
+			continue
+		}
+		bytes, err := units.FromHumanSize(size.value)
+		if err != nil || bytes <= 0 {
+			errs = append(errs, fmt.Errorf("Invalid resources.%s '%s' in cog.yaml. It must be a size like 16GB", size.key, size.value))
+			continue
+		}
+		*size.bytes = bytes
+	}
+	return req, errors.Join(errs...)
+}
+
+func (c *Config) validateResources() error {
+	if c.Resources == nil {
+		return nil
+	}
+	if c.Resources.CPU < 0 {
+		return fmt.Errorf("resources.cpu in cog.yaml must be a positive number of CPUs")
+	}
+	if c.Resources.GPUMemory != "" && (c.Build == nil || !c.Build.GPU) {
+		return fmt.Errorf("resources.gpu_memory is set in cog.yaml, so build.gpu must be true")
+	}
+	_, err := c.ResourceRequirements()
+	return err
+}
@@ -0,0 +1,47 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResourceRequirements(t *testing.T) {
+	config, err := FromYAML([]byte(`
+build:
+  gpu: true
+resources:
+  cpu: 0.5
+  memory: 16GB
+  gpu_memory: 24GB
+  disk: 500MB
+`))
+	require.NoError(t, err)
+	req, err := config.ResourceRequirements()
+	require.NoError(t, err)
+	require.Equal(t, ResourceRequirements{CPU: 0.5, MemoryBytes: 16_000_000_000, GPUMemoryBytes: 24_000_000_000, DiskBytes: 500_000_000}, req)
+	require.NoError(t, config.validateResources())
+
+	config, err = FromYAML([]byte(`
+build:
+  python_version: "3.11"
+`))
+	require.NoError(t, err)
+	req, err = config.ResourceRequirements()
+	require.NoError(t, err)
+	require.True(t, req.IsZero())
+}
+
+func TestValidateResources(t *testing.T) {
+	config := &Config{Build: &Build{}, Resources: &Resources{Memory: "lots"}}
+	require.ErrorContains(t, config.validateResources(), "Invalid resources.memory 'lots'")
+
+	config = &Config{Build: &Build{}, Resources: &Resources{GPUMemory: "24GB"}}
+	require.ErrorContains(t, config.validateResources(), "build.gpu must be true")
+
+	_, err := FromYAML([]byte(`
+resources:
+  gpus: 1
+`))
+	require.Error(t, err)
+}
@@ -0,0 +1,19 @@
+package config
+
+const (
+	// SecretScanError fails the build if a secret would be built into the image
+	SecretScanError = "error"
+	// SecretScanWarn warns if a secret would be built into the image
+	SecretScanWarn = "warn"
+	// SecretScanOff doesn't look for secrets
+	SecretScanOff = "off"
+)
+
+// SecretScan returns what build.secret_scan says to do when a secret would be built into the image, which is
+// SecretScanError if it isn't set
+func (c *Config) SecretScan() string {
+	if c.Build == nil || c.Build.SecretScan == "" {
+		return SecretScanError
+	}
+	return c.Build.SecretScan
+}
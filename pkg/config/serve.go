@@ -0,0 +1,112 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+
+	"github.com/docker/go-units"
+)
+
+// Serve configures the model's HTTP server
+type Serve struct {
+	TLS  *TLS  `json:"tls,omitempty" yaml:"tls"`
+	CORS *CORS `json:"cors,omitempty" yaml:"cors"`
+	// MaxRequestSize is the largest request the server accepts, as a size like 100MB
+	MaxRequestSize string `json:"max_request_size,omitempty" yaml:"max_request_size"`
+}
+
+// CORS lets web pages on other origins send requests to the HTTP server from browsers
+type CORS struct {
+	// Origins are the origins that are allowed, like https://example.com, or * for any
+	Origins []string `json:"origins,omitempty" yaml:"origins"`
+}
+
+// TLS makes the HTTP server serve HTTPS, with a certificate and key from the project or a self-signed certificate
+// generated when the container starts
+type TLS struct {
+	// Cert and Key are paths to PEM files, relative to the project, or absolute paths in the container if they're
+	// mounted into it
+	Cert string `json:"cert,omitempty" yaml:"cert"`
+	Key  string `json:"key,omitempty" yaml:"key"`
+	// Auto generates a self-signed certificate when the container starts
+	Auto bool `json:"auto,omitempty" yaml:"auto"`
+}
+
+// TLSEnabled returns whether the HTTP server serves HTTPS
+func (c *Config) TLSEnabled() bool {
+	return c.Serve != nil && c.Serve.TLS != nil && (c.Serve.TLS.Auto || c.Serve.TLS.Cert != "")
+}
+
+// TLSFiles returns the paths of serve.tls.cert and serve.tls.key in the container, or "" if they aren't set
+func (c *Config) TLSFiles() (cert string, key string) {
+	if c.Serve == nil || c.Serve.TLS == nil || c.Serve.TLS.Cert == "" {
+		return "", ""
+	}
+	inContainer := func(p string) string {
+		if path.IsAbs(p) {
+			return p
+		}
+		return path.Join("/src", p)
+	}
+	return inContainer(c.Serve.TLS.Cert), inContainer(c.Serve.TLS.Key)
+}
+
+// CORSOrigins returns serve.cors.origins, or nil if it isn't set
+func (c *Config) CORSOrigins() []string {
+	if c.Serve == nil || c.Serve.CORS == nil {
+		return nil
+	}
+	return c.Serve.CORS.Origins
+}
+
+// MaxRequestSizeBytes returns serve.max_request_size in bytes, or 0 if it isn't set
+func (c *Config) MaxRequestSizeBytes() (int64, error) {
+	if c.Serve == nil || c.Serve.MaxRequestSize == "" {
+		return 0, nil
+	}
+	bytes, err := units.FromHumanSize(c.Serve.MaxRequestSize)
+	if err != nil || bytes <= 0 {
+		return 0, fmt.Errorf("Invalid serve.max_request_size '%s' in cog.yaml. It must be a size like 100MB", c.Serve.MaxRequestSize)
+	}
+	return bytes, nil
+}
+
+// serveSystemPackages returns the system packages that serve needs. A self-signed certificate is generated with
+// openssl, which slim images don't have.
+func (c *Config) serveSystemPackages() []string {
+	if c.Serve != nil && c.Serve.TLS != nil && c.Serve.TLS.Auto {
+		return []string{"openssl"}
+	}
+	return []string{}
+}
+
+func (c *Config) validateServe() error {
+	if c.Serve == nil {
+		return nil
+	}
+	if _, err := c.MaxRequestSizeBytes(); err != nil {
+		return err
+	}
+	for _, origin := range c.CORSOrigins() {
+		if origin == "*" {
+			continue
+		}
+		// Browsers send the scheme, host and port, without a path
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			return fmt.Errorf("serve.cors.origins in cog.yaml has '%s', which isn't an origin like https://example.com or *", origin)
+		}
+	}
+	if c.Serve.TLS == nil {
+		return nil
+	}
+	tls := c.Serve.TLS
+	if tls.Auto && (tls.Cert != "" || tls.Key != "") {
+		return fmt.Errorf("serve.tls in cog.yaml can either set cert and key, or auto, but not both")
+	}
+	if !tls.Auto && (tls.Cert == "" || tls.Key == "") {
+		return fmt.Errorf("serve.tls in cog.yaml must set both cert and key, or set auto: true to generate a self-signed certificate")
+	}
+	return nil
+}
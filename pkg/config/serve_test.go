@@ -0,0 +1,83 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTLSFiles(t *testing.T) {
+	config, err := FromYAML([]byte(`
+serve:
+  tls:
+    cert: certs/server.crt
+    key: /run/secrets/server.key
+`))
+	require.NoError(t, err)
+	require.NoError(t, config.validateServe())
+	require.True(t, config.TLSEnabled())
+	cert, key := config.TLSFiles()
+	require.Equal(t, "/src/certs/server.crt", cert)
+	require.Equal(t, "/run/secrets/server.key", key)
+
+	config, err = FromYAML([]byte(`
+serve:
+  tls:
+    auto: true
+`))
+	require.NoError(t, err)
+	require.NoError(t, config.validateServe())
+	require.True(t, config.TLSEnabled())
+	cert, key = config.TLSFiles()
+	require.Equal(t, "", cert)
+	require.Equal(t, "", key)
+	require.Contains(t, config.SystemPackages(), "openssl")
+
+	config, err = FromYAML([]byte(`
+build:
+  gpu: false
+`))
+	require.NoError(t, err)
+	require.False(t, config.TLSEnabled())
+}
+
+func TestServeLimits(t *testing.T) {
+	config, err := FromYAML([]byte(`
+serve:
+  cors:
+    origins:
+      - https://example.com
+      - http://localhost:3000
+  max_request_size: 100MB
+`))
+	require.NoError(t, err)
+	require.NoError(t, config.validateServe())
+	require.Equal(t, []string{"https://example.com", "http://localhost:3000"}, config.CORSOrigins())
+	size, err := config.MaxRequestSizeBytes()
+	require.NoError(t, err)
+	require.Equal(t, int64(100_000_000), size)
+
+	config = &Config{}
+	require.Nil(t, config.CORSOrigins())
+	size, err = config.MaxRequestSizeBytes()
+	require.NoError(t, err)
+	require.Equal(t, int64(0), size)
+}
+
+func TestValidateServe(t *testing.T) {
+	config := &Config{Serve: &Serve{MaxRequestSize: "lots"}}
+	require.ErrorContains(t, config.validateServe(), "Invalid serve.max_request_size 'lots'")
+
+	for _, origin := range []string{"example.com", "https://example.com/demo", "ftp://example.com"} {
+		config = &Config{Serve: &Serve{CORS: &CORS{Origins: []string{origin}}}}
+		require.ErrorContains(t, config.validateServe(), "isn't an origin", origin)
+	}
+	config = &Config{Serve: &Serve{CORS: &CORS{Origins: []string{"*", "https://example.com/"}}}}
+	require.NoError(t, config.validateServe())
+
+	config = &Config{Serve: &Serve{TLS: &TLS{Cert: "server.crt"}}}
+	require.ErrorContains(t, config.validateServe(), "must set both cert and key")
+
+	config = &Config{Serve: &Serve{TLS: &TLS{Cert: "server.crt", Key: "server.key", Auto: true}}}
+	require.ErrorContains(t, config.validateServe(), "but not both")
+}
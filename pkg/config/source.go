@@ -0,0 +1,53 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Source configures which of the project's files are copied into the image
+type Source struct {
+	// OnlyImports copies only the predictor, the local modules it imports and Include, instead of the whole project
+	OnlyImports bool `json:"only_imports,omitempty" yaml:"only_imports"`
+	// Include are globs of other files the predictor needs, like configuration files it reads
+	Include []string `json:"include,omitempty" yaml:"include"`
+}
+
+// SourceOnlyImports returns whether only the files the predictor needs are copied into the image
+func (c *Config) SourceOnlyImports() bool {
+	return c.Build.Source != nil && c.Build.Source.OnlyImports
+}
+
+// IsIncludedSource returns whether p, relative to the project directory, matches a glob in build.source.include
+func (c *Config) IsIncludedSource(p string) bool {
+	return c.Build.Source != nil && matchesGlobs(c.Build.Source.Include, p)
+}
+
+// PredictorFiles returns the source files of the predictors in predict and train
+func (c *Config) PredictorFiles() []string {
+	files := []string{}
+	for _, ref := range []string{c.Predict, c.Train} {
+		if file, _, ok := strings.Cut(ref, ":"); ok {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+func (c *Config) validateSource() error {
+	if c.Build.Source == nil {
+		return nil
+	}
+	if len(c.Build.Source.Include) > 0 && !c.Build.Source.OnlyImports {
+		return fmt.Errorf("build.source.include is set in cog.yaml, but build.source.only_imports isn't, so the whole project is copied into the image anyway")
+	}
+	for _, pattern := range c.Build.Source.Include {
+		if strings.HasPrefix(pattern, "!") {
+			return fmt.Errorf("'%s' in build.source.include can't start with !", pattern)
+		}
+		if _, err := GlobRegexp(pattern); err != nil {
+			return fmt.Errorf("Invalid glob in build.source.include: %w", err)
+		}
+	}
+	return nil
+}
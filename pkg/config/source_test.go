@@ -0,0 +1,31 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSource(t *testing.T) {
+	config, err := FromYAML([]byte(`
+build:
+  source:
+    only_imports: true
+    include:
+      - configs/
+predict: predict.py:Predictor
+train: train.py:train
+`))
+	require.NoError(t, err)
+	require.NoError(t, config.ValidateAndComplete(""))
+	require.True(t, config.SourceOnlyImports())
+	require.True(t, config.IsIncludedSource("configs/base.json"))
+	require.False(t, config.IsIncludedSource("data/train.csv"))
+	require.Equal(t, []string{"predict.py", "train.py"}, config.PredictorFiles())
+}
+
+func TestSourceIncludeWithoutOnlyImports(t *testing.T) {
+	config, err := FromYAML([]byte("build:\n  source:\n    include:\n      - configs/\n"))
+	require.NoError(t, err)
+	require.ErrorContains(t, config.ValidateAndComplete(""), "build.source.only_imports isn't")
+}
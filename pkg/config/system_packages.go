@@ -0,0 +1,194 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/replicate/cog/pkg/global"
+)
+
+// SystemPackageAdvice says that a Python package needs system packages that aren't in system_packages
+type SystemPackageAdvice struct {
+	PythonPackage  string
+	SystemPackages []string
+}
+
+func (a SystemPackageAdvice) String() string {
+	return fmt.Sprintf("%s needs the system packages %s", a.PythonPackage, strings.Join(a.SystemPackages, ", "))
+}
+
+// systemPackageNeed is a system package a Python package needs, with other packages that provide the same thing
+type systemPackageNeed struct {
+	pkg          string
+	alternatives []string
+}
+
+// pythonSystemPackages are the system packages that Python packages need to be installed or imported,
+// which aren't in the python or CUDA base images
+var pythonSystemPackages = map[string][]systemPackageNeed{
+	"opencv-python":         {{"libgl1", []string{"libgl1-mesa-glx"}}, {"libglib2.0-0", nil}},
+	"opencv-contrib-python": {{"libgl1", []string{"libgl1-mesa-glx"}}, {"libglib2.0-0", nil}},
+	"mediapipe":             {{"libgl1", []string{"libgl1-mesa-glx"}}},
+	"pyaudio":               {{"portaudio19-dev", nil}},
+	"psycopg2":              {{"libpq-dev", nil}},
+	"mysqlclient":           {{"default-libmysqlclient-dev", []string{"libmysqlclient-dev"}}, {"pkg-config", nil}},
+	"pycairo":               {{"libcairo2-dev", nil}, {"pkg-config", nil}},
+	"python-magic":          {{"libmagic1", nil}},
+	"pygraphviz":            {{"graphviz", nil}, {"libgraphviz-dev", nil}},
+	"pyodbc":                {{"unixodbc-dev", nil}},
+	"python-ldap":           {{"libldap2-dev", nil}, {"libsasl2-dev", nil}},
+	"gdal":                  {{"libgdal-dev", nil}},
+	"dlib":                  {{"cmake", nil}},
+	"face-recognition":      {{"cmake", nil}},
+	"pytesseract":           {{"tesseract-ocr", nil}},
+	"pdf2image":             {{"poppler-utils", nil}},
+	"soundfile":             {{"libsndfile1", nil}},
+	"librosa":               {{"libsndfile1", nil}},
+	"pydub":                 {{"ffmpeg", nil}},
+	"ffmpeg-python":         {{"ffmpeg", nil}},
+	"moviepy":               {{"ffmpeg", nil}},
+	"openai-whisper":        {{"ffmpeg", nil}},
+}
+
+// SystemPackageAdvice returns the Python packages that need system packages which aren't in system_packages
+func (c *Config) SystemPackageAdvice() []SystemPackageAdvice {
+	installed := map[string]bool{}
+	for _, pkg := range c.SystemPackages() {
+		installed[pkg] = true
+	}
+
+	advice := []SystemPackageAdvice{}
+	seen := map[string]bool{}
+	requirements := append(append([]string{}, c.Build.PythonPackagesStable...), c.Build.pythonRequirementsContent...)
+	requirements = append(requirements, c.presetPythonRequirements(c.Build.pythonRequirementsContent)...)
+	for _, requirement := range requirements {
+		name := pythonRequirementName(requirement)
+		needs := pythonSystemPackages[name]
+		if strings.HasPrefix(strings.TrimSpace(requirement), "git+") {
+			name = strings.TrimSpace(requirement)
+			needs = []systemPackageNeed{{"git", nil}}
+		}
+		if len(needs) == 0 || seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		missing := []string{}
+		for _, need := range needs {
+			if !installed[need.pkg] && !anyInstalled(installed, need.alternatives) {
+				missing = append(missing, need.pkg)
+			}
+		}
+		if len(missing) > 0 {
+			advice = append(advice, SystemPackageAdvice{PythonPackage: name, SystemPackages: missing})
+		}
+	}
+	return advice
+}
+
+func anyInstalled(installed map[string]bool, packages []string) bool {
+	for _, pkg := range packages {
+		if installed[pkg] {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	yamlBuildKey          = regexp.MustCompile(`^build:\s*(#.*)?$`)
+	yamlSystemPackagesKey = regexp.MustCompile(`^(\s+)system_packages:\s*(.*)$`)
+	yamlListItem          = regexp.MustCompile(`^(\s*)- `)
+)
+
+// AddSystemPackages adds packages to build.system_packages in the contents of a cog.yaml file. It edits the
+// text of the file rather than reading and writing it as YAML, so its comments and formatting are kept.
+func AddSystemPackages(contents []byte, packages []string) ([]byte, error) {
+	if len(packages) == 0 {
+		return contents, nil
+	}
+	lines := strings.Split(strings.TrimRight(string(contents), "\n"), "\n")
+
+	buildLine := -1
+	for i, line := range lines {
+		if yamlBuildKey.MatchString(line) {
+			buildLine = i
+			break
+		}
+		if strings.HasPrefix(line, "build:") {
+			return nil, fmt.Errorf("Failed to add system packages to %s: build isn't a block mapping", global.ConfigFilename)
+		}
+	}
+
+	if buildLine < 0 {
+		lines = append(lines, "build:", "  system_packages:")
+		for _, pkg := range packages {
+			lines = append(lines, "    - "+pkg)
+		}
+		return []byte(strings.Join(lines, "\n") + "\n"), nil
+	}
+
+	// The build block is every line after build: that is indented, blank or a comment
+	end := buildLine + 1
+	indent := ""
+	for end < len(lines) {
+		line := lines[end]
+		trimmed := strings.TrimSpace(line)
+		if trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			if !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t") {
+				break
+			}
+			if indent == "" {
+				indent = line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+			}
+		}
+		end++
+	}
+	if indent == "" {
+		indent = "  "
+	}
+
+	for i := buildLine + 1; i < end; i++ {
+		match := yamlSystemPackagesKey.FindStringSubmatch(lines[i])
+		if match == nil || match[1] != indent {
+			continue
+		}
+		value := strings.TrimSpace(match[2])
+		if value != "" && !strings.HasPrefix(value, "#") {
+			return nil, fmt.Errorf("Failed to add system packages to %s: system_packages isn't a list with an item on each line", global.ConfigFilename)
+		}
+		// Add the packages after the last item of the list, with the same indentation
+		last := i
+		itemIndent := indent + "  "
+		for j := i + 1; j < end; j++ {
+			trimmed := strings.TrimSpace(lines[j])
+			if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+				continue
+			}
+			item := yamlListItem.FindStringSubmatch(lines[j])
+			if item == nil || len(item[1]) < len(indent) {
+				break
+			}
+			itemIndent = item[1]
+			last = j
+		}
+		return insertLines(lines, last+1, listItems(itemIndent, packages)), nil
+	}
+
+	added := append([]string{indent + "system_packages:"}, listItems(indent+"  ", packages)...)
+	return insertLines(lines, buildLine+1, added), nil
+}
+
+func listItems(indent string, packages []string) []string {
+	items := []string{}
+	for _, pkg := range packages {
+		items = append(items, indent+"- "+pkg)
+	}
+	return items
+}
+
+func insertLines(lines []string, at int, inserted []string) []byte {
+	result := append(append(append([]string{}, lines[:at]...), inserted...), lines[at:]...)
+	return []byte(strings.Join(result, "\n") + "\n")
+}
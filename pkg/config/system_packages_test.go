@@ -0,0 +1,111 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSystemPackageAdvice(t *testing.T) {
+	config := &Config{
+		Build: &Build{
+			PythonVersion:  "3.8",
+			SystemPackages: []string{"libgl1-mesa-glx", "ffmpeg"},
+			PythonPackages: []string{
+				"opencv_python==4.8.0.76",
+				"PyAudio==0.2.13",
+				"pydub==0.25.1",
+				"torch==2.0.1",
+				"git+https://github.com/m-bain/whisperX.git",
+			},
+		},
+	}
+	require.NoError(t, config.ValidateAndComplete(""))
+	require.Equal(t, []SystemPackageAdvice{
+		{PythonPackage: "opencv-python", SystemPackages: []string{"libglib2.0-0"}},
+		{PythonPackage: "pyaudio", SystemPackages: []string{"portaudio19-dev"}},
+		{PythonPackage: "git+https://github.com/m-bain/whisperX.git", SystemPackages: []string{"git"}},
+	}, config.SystemPackageAdvice())
+}
+
+func TestAddSystemPackages(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		contents string
+		expected string
+	}{
+		{
+			name: "existing list",
+			contents: `build:
+  # packages
+  system_packages:
+    - "ffmpeg"
+
+  python_version: "3.11"
+predict: predict.py:Predictor
+`,
+			expected: `build:
+  # packages
+  system_packages:
+    - "ffmpeg"
+    - libgl1
+    - portaudio19-dev
+
+  python_version: "3.11"
+predict: predict.py:Predictor
+`,
+		},
+		{
+			name: "list items not indented",
+			contents: `build:
+    system_packages:
+    - ffmpeg
+    gpu: true
+`,
+			expected: `build:
+    system_packages:
+    - ffmpeg
+    - libgl1
+    - portaudio19-dev
+    gpu: true
+`,
+		},
+		{
+			name: "no system_packages",
+			contents: `predict: predict.py:Predictor
+build:
+  python_version: "3.11"
+`,
+			expected: `predict: predict.py:Predictor
+build:
+  system_packages:
+    - libgl1
+    - portaudio19-dev
+  python_version: "3.11"
+`,
+		},
+		{
+			name:     "no build",
+			contents: "predict: predict.py:Predictor\n",
+			expected: `predict: predict.py:Predictor
+build:
+  system_packages:
+    - libgl1
+    - portaudio19-dev
+`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := AddSystemPackages([]byte(tt.contents), []string{"libgl1", "portaudio19-dev"})
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, string(actual))
+
+			config, err := FromYAML(actual)
+			require.NoError(t, err)
+			require.Contains(t, config.Build.SystemPackages, "portaudio19-dev")
+		})
+	}
+
+	_, err := AddSystemPackages([]byte("build:\n  system_packages: [ffmpeg]\n"), []string{"libgl1"})
+	require.Error(t, err)
+}
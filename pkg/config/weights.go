@@ -0,0 +1,141 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Weights configures the model's weights
+type Weights struct {
+	// Profiles are sets of weights, e.g. fp16 and int8, one of which is picked when the container starts
+	Profiles []WeightsProfile `json:"profiles,omitempty" yaml:"profiles"`
+	// Files are weights that are downloaded when the container starts if they aren't in the image
+	Files []WeightsFile `json:"files,omitempty" yaml:"files"`
+	// Lazy leaves Files out of the image, so they are always downloaded when the container starts
+	Lazy bool `json:"lazy,omitempty" yaml:"lazy"`
+}
+
+// WeightsFile is a weights file that is downloaded when the container starts if it isn't in the image
+type WeightsFile struct {
+	URL string `json:"url" yaml:"url"`
+	// Path is where the file is in the project, and in the container
+	Path   string `json:"path" yaml:"path"`
+	SHA256 string `json:"sha256" yaml:"sha256"`
+}
+
+// WeightsProfile is a set of weights that can be picked with COG_WEIGHTS_PROFILE when the container starts
+type WeightsProfile struct {
+	Name string `json:"name" yaml:"name"`
+	// Path is the file or directory in the project that has the weights
+	Path string `json:"path" yaml:"path"`
+	// URL is where the weights are downloaded from if they aren't in the image
+	URL string `json:"url,omitempty" yaml:"url"`
+	// SHA256 is the checksum of what is downloaded from URL
+	SHA256 string `json:"sha256,omitempty" yaml:"sha256"`
+	// Default profiles are built into the image, and used if COG_WEIGHTS_PROFILE isn't set
+	Default bool `json:"default,omitempty" yaml:"default"`
+}
+
+var (
+	weightsProfileNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+	sha256Re             = regexp.MustCompile(`^[0-9a-f]{64}$`)
+)
+
+// WeightsProfiles returns the weights profiles in cog.yaml
+func (c *Config) WeightsProfiles() []WeightsProfile {
+	if c.Weights == nil {
+		return nil
+	}
+	return c.Weights.Profiles
+}
+
+// WeightsFiles returns the weights files in cog.yaml
+func (c *Config) WeightsFiles() []WeightsFile {
+	if c.Weights == nil {
+		return nil
+	}
+	return c.Weights.Files
+}
+
+// DefaultWeightsProfile returns the profile that is built into the image, which is the one marked as default,
+// or the first one
+func (c *Config) DefaultWeightsProfile() *WeightsProfile {
+	profiles := c.WeightsProfiles()
+	for i, profile := range profiles {
+		if profile.Default {
+			return &profiles[i]
+		}
+	}
+	if len(profiles) > 0 {
+		return &profiles[0]
+	}
+	return nil
+}
+
+// LazyWeightsPaths returns the paths of the weights that aren't built into the image, because they are
+// downloaded when the container starts
+func (c *Config) LazyWeightsPaths() []string {
+	paths := []string{}
+	defaultProfile := c.DefaultWeightsProfile()
+	for _, profile := range c.WeightsProfiles() {
+		if profile.Name != defaultProfile.Name {
+			paths = append(paths, path.Clean(profile.Path))
+		}
+	}
+	if c.Weights != nil && c.Weights.Lazy {
+		for _, file := range c.Weights.Files {
+			paths = append(paths, path.Clean(file.Path))
+		}
+	}
+	return paths
+}
+
+func (c *Config) validateWeights() error {
+	names := map[string]bool{}
+	defaults := 0
+	for _, profile := range c.WeightsProfiles() {
+		if !weightsProfileNameRe.MatchString(profile.Name) {
+			return fmt.Errorf("The weights profile name '%s' must be lowercase letters, numbers, - and _", profile.Name)
+		}
+		if names[profile.Name] {
+			return fmt.Errorf("There is more than one weights profile called '%s'", profile.Name)
+		}
+		names[profile.Name] = true
+		if profile.Path == "" || path.IsAbs(profile.Path) || strings.HasPrefix(path.Clean(profile.Path), "..") {
+			return fmt.Errorf("The path of the weights profile '%s' must be a path in the project directory", profile.Name)
+		}
+		if profile.SHA256 != "" && !sha256Re.MatchString(profile.SHA256) {
+			return fmt.Errorf("The sha256 of the weights profile '%s' must be 64 lowercase hexadecimal characters", profile.Name)
+		}
+		if profile.Default {
+			defaults++
+		}
+	}
+	if defaults > 1 {
+		return fmt.Errorf("Only one weights profile can be the default")
+	}
+	defaultProfile := c.DefaultWeightsProfile()
+	for _, profile := range c.WeightsProfiles() {
+		if profile.Name != defaultProfile.Name && profile.URL == "" {
+			return fmt.Errorf("The weights profile '%s' isn't the default, so it needs a url to download it from when the container starts", profile.Name)
+		}
+	}
+
+	for _, file := range c.WeightsFiles() {
+		if file.URL == "" || file.Path == "" {
+			return fmt.Errorf("Every file in weights.files needs a url and a path")
+		}
+		if path.IsAbs(file.Path) || strings.HasPrefix(path.Clean(file.Path), "..") {
+			return fmt.Errorf("The path of the weights file %s must be a path in the project directory", file.Path)
+		}
+		if !sha256Re.MatchString(file.SHA256) {
+			return fmt.Errorf("The weights file %s needs a sha256, which is 64 lowercase hexadecimal characters, so it can be checked after it is downloaded", file.Path)
+		}
+	}
+	if c.Weights != nil && c.Weights.Lazy && len(c.Weights.Files) == 0 {
+		return fmt.Errorf("weights.lazy is set in cog.yaml, but there are no weights.files to download")
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWeightsProfiles(t *testing.T) {
+	config, err := FromYAML([]byte(`
+weights:
+  profiles:
+    - name: fp16
+      path: weights/fp16/
+    - name: int8
+      path: weights/int8
+      url: https://example.com/int8.tar
+`))
+	require.NoError(t, err)
+	require.NoError(t, config.ValidateAndComplete(""))
+	require.Equal(t, "fp16", config.DefaultWeightsProfile().Name)
+	require.Equal(t, []string{"weights/int8"}, config.LazyWeightsPaths())
+}
+
+func TestInvalidWeightsProfiles(t *testing.T) {
+	for _, tt := range []struct {
+		yaml string
+		err  string
+	}{
+		{"  - {name: fp16, path: a, default: true}\n  - {name: int8, path: b, default: true, url: https://example.com}", "Only one weights profile can be the default"},
+		{"  - {name: fp16, path: a}\n  - {name: fp16, path: b, url: https://example.com}", "more than one weights profile called 'fp16'"},
+		{"  - {name: FP16, path: a}", "must be lowercase letters"},
+		{"  - {name: fp16, path: ../a}", "must be a path in the project directory"},
+		{"  - {name: fp16, path: a}\n  - {name: int8, path: b}", "'int8' isn't the default, so it needs a url"},
+	} {
+		config, err := FromYAML([]byte("weights:\n  profiles:\n" + tt.yaml + "\n"))
+		require.NoError(t, err)
+		require.ErrorContains(t, config.ValidateAndComplete(""), tt.err)
+	}
+}
+
+func TestLazyWeightsFiles(t *testing.T) {
+	config, err := FromYAML([]byte(`
+weights:
+  lazy: true
+  files:
+    - url: https://example.com/model.safetensors
+      path: weights/model.safetensors
+      sha256: 5d41402abc4b2a76b9719d911017c592ae8f1c0a1fdbb1ca3c1e4e2e7d6f6c57
+`))
+	require.NoError(t, err)
+	require.NoError(t, config.ValidateAndComplete(""))
+	require.Equal(t, []string{"weights/model.safetensors"}, config.LazyWeightsPaths())
+
+	config.Weights.Lazy = false
+	require.Empty(t, config.LazyWeightsPaths())
+}
+
+func TestInvalidWeightsFiles(t *testing.T) {
+	for _, tt := range []struct {
+		yaml string
+		err  string
+	}{
+		{"lazy: true", "there are no weights.files to download"},
+		{"files:\n  - {url: https://example.com/a, path: ../a, sha256: 5d41402abc4b2a76b9719d911017c592ae8f1c0a1fdbb1ca3c1e4e2e7d6f6c57}", "must be a path in the project directory"},
+		{"files:\n  - {url: https://example.com/a, path: a, sha256: abc}", "needs a sha256"},
+	} {
+		config, err := FromYAML([]byte("weights:\n  " + strings.ReplaceAll(tt.yaml, "\n", "\n  ") + "\n"))
+		require.NoError(t, err)
+		require.ErrorContains(t, config.ValidateAndComplete(""), tt.err)
+	}
+}
@@ -0,0 +1,172 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/replicate/cog/pkg/util/version"
+)
+
+// Some Python packages have CUDA extensions that take a long time to compile, and pip compiles them if it can't
+// find a wheel that matches the model's versions of torch, CUDA and Python. These resolve them to prebuilt
+// wheels, or to versions that are built for the model's version of torch.
+
+// flashAttnRelease is a release of flash-attn with prebuilt wheels on GitHub
+type flashAttnRelease struct {
+	version string
+	// cudas maps the major version of CUDA to the CUDA version the wheels are built with
+	cudas   map[string]string
+	torches []string
+	pythons []string
+}
+
+var flashAttnReleases = []flashAttnRelease{
+	{"2.6.3", map[string]string{"11": "118", "12": "123"}, []string{"2.2", "2.3", "2.4"}, []string{"3.8", "3.9", "3.10", "3.11", "3.12"}},
+	{"2.5.8", map[string]string{"11": "118", "12": "122"}, []string{"2.0", "2.1", "2.2", "2.3"}, []string{"3.8", "3.9", "3.10", "3.11", "3.12"}},
+}
+
+// xformersForTorch maps versions of torch to the version of xformers that is built for it
+var xformersForTorch = map[string]string{
+	"2.0.1": "0.0.22",
+	"2.1.0": "0.0.22.post7",
+	"2.1.1": "0.0.23",
+	"2.1.2": "0.0.23.post1",
+	"2.2.0": "0.0.24",
+	"2.2.1": "0.0.25",
+	"2.2.2": "0.0.25.post1",
+	"2.3.0": "0.0.26.post1",
+	"2.3.1": "0.0.27",
+	"2.4.0": "0.0.27.post2",
+	"2.4.1": "0.0.28.post1",
+	"2.5.1": "0.0.28.post3",
+}
+
+// torchForVLLM maps versions of vllm to the version of torch it requires
+var torchForVLLM = map[string]string{
+	"0.4.3": "2.3.0",
+	"0.5.0": "2.3.0",
+	"0.5.1": "2.3.0",
+	"0.5.2": "2.3.1",
+	"0.5.3": "2.3.1",
+	"0.5.4": "2.4.0",
+	"0.6.0": "2.4.0",
+	"0.6.1": "2.4.0",
+	"0.6.2": "2.4.0",
+	"0.6.3": "2.4.0",
+	"0.6.4": "2.5.1",
+}
+
+var pinnedRequirementRe = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9._-]*)\s*==\s*([^\s;#]+)\s*$`)
+
+// resolveWheel returns the requirement to install instead of a flash-attn, xformers or vllm requirement, or ""
+// if it should be installed as it is
+func (c *Config) resolveWheel(requirement string, goarch string) (string, error) {
+	name := pythonRequirementName(requirement)
+	if name != "flash-attn" && name != "xformers" && name != "vllm" {
+		return "", nil
+	}
+	torch, ok := c.pythonPackageVersion("torch")
+	if !ok {
+		return "", nil
+	}
+	torch = strings.Split(torch, "+")[0]
+	pinned := ""
+	if match := pinnedRequirementRe.FindStringSubmatch(strings.TrimSpace(requirement)); match != nil {
+		pinned = match[2]
+	}
+
+	switch name {
+	case "flash-attn":
+		if url := c.flashAttnWheelURL(pinned, torch, goarch); url != "" {
+			return "flash-attn @ " + url, nil
+		}
+	case "xformers":
+		expected, ok := xformersForTorch[torch]
+		if !ok {
+			return "", nil
+		}
+		if pinned == "" {
+			return "xformers==" + expected, nil
+		}
+		for torchVersion, xformers := range xformersForTorch {
+			if xformers == pinned && torchVersion != torch {
+				return "", fmt.Errorf("xformers==%s is built for torch %s, but torch==%s is in your Python packages, so pip would compile it. Use xformers==%s, which is built for torch %s", pinned, torchVersion, torch, expected, torch)
+			}
+		}
+	case "vllm":
+		if pinned == "" {
+			latest := ""
+			for vllm, torchVersion := range torchForVLLM {
+				if torchVersion == torch && (latest == "" || version.Greater(vllm, latest)) {
+					latest = vllm
+				}
+			}
+			if latest != "" {
+				return "vllm==" + latest, nil
+			}
+		} else if expected, ok := torchForVLLM[pinned]; ok && expected != torch {
+			return "", fmt.Errorf("vllm==%s requires torch %s, but torch==%s is in your Python packages. Pin torch==%s, or use a version of vllm that requires torch %s", pinned, expected, torch, expected, torch)
+		}
+	}
+	return "", nil
+}
+
+// flashAttnWheelURL returns the URL of the prebuilt flash-attn wheel for the model, or "" if there isn't one
+func (c *Config) flashAttnWheelURL(flashAttn string, torch string, goarch string) string {
+	if !c.Build.GPU || c.Build.CUDA == "" || (goarch != "" && goarch != "amd64") {
+		return ""
+	}
+	torchMinor := strings.Join(strings.Split(torch, ".")[:2], ".")
+	pythonMinor := strings.Join(strings.SplitN(c.Build.PythonVersion, ".", 3)[:2], ".")
+	for _, release := range flashAttnReleases {
+		if release.version != flashAttn {
+			continue
+		}
+		cuda, ok := release.cudas[strings.Split(c.Build.CUDA, ".")[0]]
+		if !ok || !sliceContains(release.torches, torchMinor) || !sliceContains(release.pythons, pythonMinor) {
+			return ""
+		}
+		python := "cp" + strings.Replace(pythonMinor, ".", "", 1)
+		return fmt.Sprintf("https://github.com/Dao-AILab/flash-attention/releases/download/v%[1]s/flash_attn-%[1]s+cu%[2]storch%[3]scxx11abiFALSE-%[4]s-%[4]s-linux_x86_64.whl", release.version, cuda, torchMinor, python)
+	}
+	return ""
+}
+
+// CompiledPythonPackages returns the flash-attn requirements that don't have a prebuilt wheel, so are compiled
+// in their own stage on the CUDA devel image, where they are cached while torch and CUDA don't change
+func (c *Config) CompiledPythonPackages(goarch string) []string {
+	if _, ok := c.pythonPackageVersion("torch"); !ok || !c.Build.GPU {
+		return nil
+	}
+	compiled := []string{}
+	for _, requirement := range c.Build.pythonRequirementsContent {
+		if pythonRequirementName(requirement) != "flash-attn" {
+			continue
+		}
+		if resolved, err := c.resolveWheel(requirement, goarch); err == nil && resolved == "" {
+			compiled = append(compiled, strings.TrimSpace(requirement))
+		}
+	}
+	return compiled
+}
+
+// TorchRequirementForArch returns the pip arguments to install the model's version of torch, which compiled
+// packages are built against
+func (c *Config) TorchRequirementForArch(goos string, goarch string) (string, error) {
+	torch, ok := c.pythonPackageVersion("torch")
+	if !ok {
+		return "", nil
+	}
+	requirement, findLinks, extraIndexURL, err := c.pythonPackageForArch("torch=="+torch, goos, goarch)
+	if err != nil {
+		return "", err
+	}
+	if findLinks != "" {
+		requirement += " --find-links " + findLinks
+	}
+	if extraIndexURL != "" {
+		requirement += " --extra-index-url " + extraIndexURL
+	}
+	return requirement, nil
+}
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlashAttnPrebuiltWheel(t *testing.T) {
+	config := &Config{
+		Build: &Build{
+			GPU:            true,
+			PythonVersion:  "3.11",
+			PythonPackages: []string{"torch==2.3.1", "flash-attn==2.5.8"},
+		},
+	}
+	require.NoError(t, config.ValidateAndComplete(""))
+	require.Equal(t, "12.1.1", config.Build.CUDA)
+
+	requirements, err := config.PythonRequirementsForArch("", "")
+	require.NoError(t, err)
+	require.Contains(t, requirements, "\nflash-attn @ https://github.com/Dao-AILab/flash-attention/releases/download/v2.5.8/flash_attn-2.5.8+cu122torch2.3cxx11abiFALSE-cp311-cp311-linux_x86_64.whl")
+	require.Empty(t, config.CompiledPythonPackages(""))
+	// There are only prebuilt wheels for amd64
+	require.Equal(t, []string{"flash-attn==2.5.8"}, config.CompiledPythonPackages("arm64"))
+}
+
+func TestFlashAttnWithoutPrebuiltWheel(t *testing.T) {
+	config := &Config{
+		Build: &Build{
+			GPU:            true,
+			PythonVersion:  "3.11",
+			PythonPackages: []string{"torch==2.3.1", "flash-attn==2.3.3"},
+		},
+	}
+	require.NoError(t, config.ValidateAndComplete(""))
+	require.Equal(t, []string{"flash-attn==2.3.3"}, config.CompiledPythonPackages(""))
+
+	torch, err := config.TorchRequirementForArch("", "")
+	require.NoError(t, err)
+	require.Equal(t, "torch==2.3.1 --extra-index-url https://download.pytorch.org/whl/cu121", torch)
+}
+
+func TestXformersForTorch(t *testing.T) {
+	config := &Config{
+		Build: &Build{
+			GPU:            true,
+			PythonVersion:  "3.10",
+			PythonPackages: []string{"torch==2.1.0", "xformers"},
+		},
+	}
+	require.NoError(t, config.ValidateAndComplete(""))
+	requirements, err := config.PythonRequirementsForArch("", "")
+	require.NoError(t, err)
+	require.Contains(t, requirements, "\nxformers==0.0.22.post7")
+
+	config = &Config{
+		Build: &Build{
+			GPU:            true,
+			PythonVersion:  "3.10",
+			PythonPackages: []string{"torch==2.1.0", "xformers==0.0.24"},
+		},
+	}
+	err = config.ValidateAndComplete("")
+	require.ErrorContains(t, err, "xformers==0.0.24 is built for torch 2.2.0, but torch==2.1.0 is in your Python packages, so pip would compile it. Use xformers==0.0.22.post7")
+}
+
+func TestVLLMForTorch(t *testing.T) {
+	config := &Config{
+		Build: &Build{
+			GPU:            true,
+			PythonVersion:  "3.11",
+			PythonPackages: []string{"torch==2.4.0", "vllm"},
+		},
+	}
+	require.NoError(t, config.ValidateAndComplete(""))
+	requirements, err := config.PythonRequirementsForArch("", "")
+	require.NoError(t, err)
+	require.Contains(t, requirements, "\nvllm==0.6.3")
+
+	config = &Config{
+		Build: &Build{
+			GPU:            true,
+			PythonVersion:  "3.11",
+			PythonPackages: []string{"torch==2.3.0", "vllm==0.6.4"},
+		},
+	}
+	err = config.ValidateAndComplete("")
+	require.ErrorContains(t, err, "vllm==0.6.4 requires torch 2.5.1, but torch==2.3.0 is in your Python packages")
+}
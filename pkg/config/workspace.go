@@ -0,0 +1,164 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// WorkspaceFilename is the file at the root of a repository with several models that declares the Python, CUDA,
+// system packages and Python packages they share
+const WorkspaceFilename = "cog-workspace.yaml"
+
+// Workspace is a cog-workspace.yaml. The shared environment in its build is built as one base image, which the
+// models in the directory it's in, and its subdirectories, start from, so its layers are only in the registry and
+// on disk once.
+type Workspace struct {
+	// Dir is the directory the workspace file is in
+	Dir string `yaml:"-"`
+	// Image is the name of the base image, or cog-<directory>-base if it isn't set
+	Image string `yaml:"image"`
+	Build *Build `yaml:"build"`
+
+	config *Config
+}
+
+// FindWorkspace returns the workspace that dir is in, from the nearest cog-workspace.yaml in it or the directories
+// above it, or nil if there isn't one
+func FindWorkspace(dir string) (*Workspace, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p := filepath.Join(dir, WorkspaceFilename)
+		contents, err := os.ReadFile(p)
+		if err == nil {
+			workspace, err := parseWorkspace(contents, dir)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to load %s: %w", p, err)
+			}
+			return workspace, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("Failed to read %s: %w", p, err)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+func parseWorkspace(contents []byte, dir string) (*Workspace, error) {
+	workspace := &Workspace{Dir: dir}
+	decoder := yamlv3.NewDecoder(bytes.NewReader(contents))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(workspace); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("Failed to parse workspace yaml: %w", err)
+	}
+	if workspace.Build == nil {
+		return nil, fmt.Errorf("The workspace must have a build with the environment its models share")
+	}
+	if workspace.Image == "" {
+		workspace.Image = DockerImageName(dir) + "-base"
+	}
+	config := DefaultConfig()
+	if workspace.Build.PythonVersion == "" {
+		workspace.Build.PythonVersion = config.Build.PythonVersion
+	}
+	config.Build = workspace.Build
+	if err := config.ValidateAndComplete(dir); err != nil {
+		return nil, err
+	}
+	workspace.config = config
+	return workspace, nil
+}
+
+// Config returns the config the base image is built from
+func (w *Workspace) Config() *Config {
+	return w.config
+}
+
+// MergeUnder returns the cog.yaml contents with the workspace's GPU, Python, CUDA and CuDNN versions, if it doesn't
+// set them, so the model builds on the base image without repeating them
+func (w *Workspace) MergeUnder(contents []byte) ([]byte, error) {
+	project := map[string]interface{}{}
+	if err := yamlv3.Unmarshal(contents, &project); err != nil {
+		return nil, fmt.Errorf("Failed to parse config yaml: %w", err)
+	}
+	build := map[string]interface{}{
+		"gpu":            w.Build.GPU,
+		"python_version": w.Build.PythonVersion,
+	}
+	if w.Build.GPU {
+		build["cuda"] = w.Build.CUDA
+		build["cudnn"] = w.Build.CuDNN
+	}
+	merged, err := yamlv3.Marshal(mergeMaps(map[string]interface{}{"build": build}, project))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to merge workspace into config: %w", err)
+	}
+	return merged, nil
+}
+
+// validateWorkspace checks the model has the same GPU, Python, CUDA and CuDNN versions as the base image of its
+// workspace, which it can't change
+func (c *Config) validateWorkspace() error {
+	if c.Workspace == nil {
+		return nil
+	}
+	base := c.Workspace.Build
+	mismatches := []string{}
+	if c.Build.GPU != base.GPU {
+		mismatches = append(mismatches, fmt.Sprintf("gpu is %t", base.GPU))
+	}
+	if c.Build.PythonVersion != base.PythonVersion {
+		mismatches = append(mismatches, "python_version is "+base.PythonVersion)
+	}
+	if base.GPU && c.Build.CUDA != base.CUDA {
+		mismatches = append(mismatches, "cuda is "+base.CUDA)
+	}
+	if base.GPU && c.Build.CuDNN != base.CuDNN {
+		mismatches = append(mismatches, "cudnn is "+base.CuDNN)
+	}
+	if len(mismatches) > 0 {
+		return fmt.Errorf("The model is in the workspace in %s, where build.%s, so it must be the same in cog.yaml, or left out", c.Workspace.Dir, strings.Join(mismatches, ", build."))
+	}
+	return nil
+}
+
+// WorkspacePythonRequirements returns the lines of the requirements.txt of the workspace's base image, which
+// models in the workspace don't install again
+func (c *Config) WorkspacePythonRequirements(goos string, goarch string) ([]string, error) {
+	if c.Workspace == nil {
+		return nil, nil
+	}
+	requirements, err := c.Workspace.config.PythonRequirementsForArch(goos, goarch)
+	if err != nil {
+		return nil, err
+	}
+	lines := []string{}
+	for _, line := range strings.Split(requirements, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
+// WorkspaceSystemPackages returns the system packages in the workspace's base image, which models in the
+// workspace don't install again
+func (c *Config) WorkspaceSystemPackages() []string {
+	if c.Workspace == nil {
+		return nil
+	}
+	return c.Workspace.config.SystemPackages()
+}
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkspace(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("COG_DEFAULTS", "")
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, WorkspaceFilename), []byte(`
+build:
+  python_version: "3.11"
+  system_packages:
+    - ffmpeg
+  python_packages:
+    - requests==2.31.0
+`), 0o644))
+	modelDir := filepath.Join(root, "models", "captioner")
+	require.NoError(t, os.MkdirAll(modelDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(modelDir, "cog.yaml"), []byte(`
+build:
+  python_packages:
+    - requests==2.31.0
+    - pillow==10.3.0
+predict: predict.py:Predictor
+`), 0o644))
+
+	config, _, err := GetConfig(modelDir)
+	require.NoError(t, err)
+	require.NotNil(t, config.Workspace)
+	require.Equal(t, root, config.Workspace.Dir)
+	require.Equal(t, DockerImageName(root)+"-base", config.Workspace.Image)
+	// The model gets the workspace's Python version
+	require.Equal(t, "3.11", config.Build.PythonVersion)
+	requirements, err := config.WorkspacePythonRequirements("linux", "amd64")
+	require.NoError(t, err)
+	require.Equal(t, []string{"requests==2.31.0"}, requirements)
+	require.Equal(t, []string{"ffmpeg"}, config.WorkspaceSystemPackages())
+
+	// It can't have a different one
+	require.NoError(t, os.WriteFile(filepath.Join(modelDir, "cog.yaml"), []byte(`
+build:
+  python_version: "3.10"
+predict: predict.py:Predictor
+`), 0o644))
+	_, _, err = GetConfig(modelDir)
+	require.ErrorContains(t, err, "build.python_version is 3.11")
+}
+
+func TestNoWorkspace(t *testing.T) {
+	workspace, err := FindWorkspace(t.TempDir())
+	require.NoError(t, err)
+	require.Nil(t, workspace)
+}
@@ -0,0 +1,171 @@
+// Package crash collects what's needed to debug a model's container crashing into a diagnostics bundle, with
+// secrets redacted so it can be shared
+package crash
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/replicate/cog/pkg/predict"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// Bundle is the diagnostics collected when a model's container crashed
+type Bundle struct {
+	Time  time.Time
+	Crash *predict.Crash
+	// Err is what failed because of the crash
+	Err error
+	// Config is the model's cog.yaml, and Dockerfile is the Dockerfile generated from it, if the model was built
+	// from a project
+	Config     string
+	Dockerfile string
+	// Dmesg are the kernel's out of memory records, and NvidiaSMI is the state of the GPUs
+	Dmesg     string
+	NvidiaSMI string
+}
+
+// oomPattern matches the kernel's log lines about running out of memory and killing processes
+var oomPattern = regexp.MustCompile(`(?i)out of memory|oom[-_ ]kill|killed process|memory cgroup`)
+
+// Collect adds the state of the machine to the bundle: the kernel's records of processes it killed because it ran
+// out of memory, and the state of the GPUs. Anything that can't be read is left out.
+func (b *Bundle) Collect() {
+	if out, err := command("dmesg"); err == nil {
+		b.Dmesg = oomRecords(out)
+	} else {
+		b.Dmesg = fmt.Sprintf("Failed to read the kernel's logs, which may need root or be in Docker Desktop's VM: %s\n", err)
+	}
+	if _, err := exec.LookPath("nvidia-smi"); err == nil {
+		if out, err := command("nvidia-smi"); err == nil {
+			b.NvidiaSMI = string(out)
+		} else {
+			b.NvidiaSMI = fmt.Sprintf("Failed to run nvidia-smi: %s\n", err)
+		}
+	}
+}
+
+func command(name string, args ...string) ([]byte, error) {
+	cmd := exec.Command(name, args...)
+	console.Debug("$ " + strings.Join(cmd.Args, " "))
+	return cmd.Output()
+}
+
+// oomRecords returns the lines of the kernel's logs about running out of memory
+func oomRecords(dmesg []byte) string {
+	var records strings.Builder
+	scanner := bufio.NewScanner(bytes.NewReader(dmesg))
+	for scanner.Scan() {
+		if oomPattern.MatchString(scanner.Text()) {
+			records.WriteString(scanner.Text() + "\n")
+		}
+	}
+	if records.Len() == 0 {
+		return "The kernel didn't log that anything ran out of memory\n"
+	}
+	return records.String()
+}
+
+// Summary describes the crash
+func (b *Bundle) Summary() string {
+	var summary strings.Builder
+	fmt.Fprintf(&summary, "Time: %s\n", b.Time.Format(time.RFC3339))
+	fmt.Fprintf(&summary, "Image: %s\n", b.Crash.Image)
+	fmt.Fprintf(&summary, "Container: %s\n", b.Crash.ContainerID)
+	if b.Crash.GPUs != "" {
+		fmt.Fprintf(&summary, "GPUs: %s\n", b.Crash.GPUs)
+	}
+	fmt.Fprintf(&summary, "Exit code: %d, %s\n", b.Crash.ExitCode, b.Crash.Reason())
+	if b.Err != nil {
+		fmt.Fprintf(&summary, "Error: %s\n", b.Err)
+	}
+	if len(b.Crash.Env) > 0 {
+		summary.WriteString("Environment:\n")
+		for _, env := range b.Crash.Env {
+			fmt.Fprintf(&summary, "  %s\n", env)
+		}
+	}
+	return summary.String()
+}
+
+// Write writes the bundle to a cog-crash-<time>.tar.gz file in dir, redacting secrets in it, and returns its path
+func (b *Bundle) Write(dir string) (string, error) {
+	path := filepath.Join(dir, "cog-crash-"+b.Time.Format("20060102-150405")+".tar.gz")
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	files := []struct {
+		name     string
+		contents string
+	}{
+		{"summary.txt", b.Summary()},
+		{"container.log", string(b.Crash.Logs)},
+		{"dmesg.txt", b.Dmesg},
+		{"nvidia-smi.txt", b.NvidiaSMI},
+		{"cog.yaml", b.Config},
+		{"Dockerfile", b.Dockerfile},
+	}
+	for _, file := range files {
+		if file.contents == "" {
+			continue
+		}
+		contents := []byte(Redact(file.contents))
+		if err := tw.WriteHeader(&tar.Header{Name: file.name, Mode: 0o644, Size: int64(len(contents)), ModTime: b.Time}); err != nil {
+			return "", err
+		}
+		if _, err := tw.Write(contents); err != nil {
+			return "", err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return "", err
+	}
+	if err := gz.Close(); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		return "", fmt.Errorf("Failed to write crash diagnostics to %s: %w", path, err)
+	}
+	return path, nil
+}
+
+// redacted replaces secrets in bundles
+const redacted = "REDACTED"
+
+var (
+	// secretAssignmentPattern matches environment variables and options with secret-sounding names, like
+	// AWS_SECRET_ACCESS_KEY=... or "password": "..."
+	secretAssignmentPattern = regexp.MustCompile(`(?i)(\b[\w.-]*(?:token|secret|password|passwd|api[_-]?key|access[_-]?key|private[_-]?key|credentials?)[\w.-]*["']?\s*[=:]\s*["']?)[^\s"',]+`)
+	// authorizationPattern matches the credentials in Authorization headers
+	authorizationPattern = regexp.MustCompile(`(?i)\b(bearer|basic)\s+[\w.~+/=-]+`)
+	// secretValuePatterns match secrets that are recognizable on their own, like API tokens and private keys
+	secretValuePatterns = []*regexp.Regexp{
+		regexp.MustCompile(`\br8_[A-Za-z0-9]{20,}`),
+		regexp.MustCompile(`\bhf_[A-Za-z0-9]{20,}`),
+		regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+		regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{20,}`),
+		regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{20,}`),
+		regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`),
+	}
+	// urlCredentialsPattern matches the user and password in URLs
+	urlCredentialsPattern = regexp.MustCompile(`(\w+://)[^/\s:@]+:[^/\s@]+@`)
+)
+
+// Redact replaces what look like secrets in s, such as tokens, passwords and keys, with REDACTED
+func Redact(s string) string {
+	s = secretAssignmentPattern.ReplaceAllString(s, "${1}"+redacted)
+	s = authorizationPattern.ReplaceAllString(s, "${1} "+redacted)
+	for _, pattern := range secretValuePatterns {
+		s = pattern.ReplaceAllString(s, redacted)
+	}
+	return urlCredentialsPattern.ReplaceAllString(s, "${1}"+redacted+"@")
+}
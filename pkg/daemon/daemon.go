@@ -0,0 +1,423 @@
+// Package daemon serves a REST API to build models and run predictions with them, so programs like GUIs and internal
+// platforms can drive Cog without running the CLI and parsing its output
+package daemon
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/replicate/cog/pkg/client"
+	cogerrors "github.com/replicate/cog/pkg/errors"
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/predict"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+type BuildStatus string
+
+const (
+	BuildQueued    BuildStatus = "queued"
+	BuildRunning   BuildStatus = "running"
+	BuildSucceeded BuildStatus = "succeeded"
+	BuildFailed    BuildStatus = "failed"
+	BuildCanceled  BuildStatus = "canceled"
+)
+
+// BuildRequest is the body of POST /builds
+type BuildRequest struct {
+	// Dir is the absolute path of the model's directory, which has a cog.yaml
+	Dir             string   `json:"dir"`
+	Image           string   `json:"image,omitempty"`
+	BuildArgs       []string `json:"build_args,omitempty"`
+	NoCache         bool     `json:"no_cache,omitempty"`
+	SeparateWeights bool     `json:"separate_weights,omitempty"`
+}
+
+// Build is a build that the daemon has queued, is running, or has run
+type Build struct {
+	ID     string      `json:"id"`
+	Dir    string      `json:"dir"`
+	Status BuildStatus `json:"status"`
+	// Events are the stages the build has been through
+	Events []client.Event `json:"events"`
+	// Image is the image that was built, once it has been
+	Image           *image.Summary    `json:"image,omitempty"`
+	DurationSeconds float64           `json:"duration_seconds,omitempty"`
+	Error           *cogerrors.Object `json:"error,omitempty"`
+	CreatedAt       time.Time         `json:"created_at"`
+
+	cancel context.CancelFunc
+}
+
+// PredictionRequest is the body of POST /predictions
+type PredictionRequest struct {
+	// Image is the model to run. It's started on its first prediction, and kept running for the next ones.
+	Image string `json:"image"`
+	// Input are the model's inputs. Strings prefixed with @ are read from files on the daemon's machine.
+	Input map[string]interface{} `json:"input"`
+	// GPUs are the GPUs the model can use when it's started, in the form of docker run's --gpus
+	GPUs           string  `json:"gpus,omitempty"`
+	TimeoutSeconds float64 `json:"timeout_seconds,omitempty"`
+}
+
+// PredictionResponse is the response to POST /predictions, when the prediction succeeded
+type PredictionResponse struct {
+	Output          interface{} `json:"output"`
+	DurationSeconds float64     `json:"duration_seconds"`
+}
+
+// Model is a model that the daemon is running
+type Model struct {
+	Image string `json:"image"`
+}
+
+// Server is the daemon's API. Builds are run one at a time, in the order they were requested, because builds of
+// the same model can't run at the same time.
+type Server struct {
+	token string
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu         sync.Mutex
+	builds     map[string]*Build
+	buildOrder []string
+	buildLock  sync.Mutex
+
+	modelsMu sync.Mutex
+	models   map[string]*client.Model
+}
+
+// New returns the daemon's API. If token isn't empty, requests must have it as a bearer token. If it's empty, only
+// requests to localhost are accepted, so web pages can't reach the API through DNS rebinding.
+func New(token string) *Server {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Server{
+		token:  token,
+		ctx:    ctx,
+		cancel: cancel,
+		builds: map[string]*Build{},
+		models: map[string]*client.Model{},
+	}
+}
+
+// Close cancels the builds that are running and stops the models
+func (s *Server) Close() error {
+	s.cancel()
+	s.modelsMu.Lock()
+	defer s.modelsMu.Unlock()
+	var firstErr error
+	for imageName, model := range s.models {
+		if err := model.Close(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("Failed to stop %s: %w", imageName, err)
+		}
+		delete(s.models, imageName)
+	}
+	return firstErr
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := s.authorize(r); err != nil {
+		writeError(w, http.StatusUnauthorized, err)
+		return
+	}
+	if r.Method == http.MethodPost {
+		// Browsers can't send JSON to other sites without CORS, which the daemon doesn't allow
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+			writeError(w, http.StatusUnsupportedMediaType, fmt.Errorf("The request body must be JSON, with Content-Type: application/json"))
+			return
+		}
+	}
+
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	switch {
+	case path == "/health" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	case path == "/builds" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, s.listBuilds())
+	case path == "/builds" && r.Method == http.MethodPost:
+		s.createBuild(w, r)
+	case strings.HasPrefix(path, "/builds/") && r.Method == http.MethodGet:
+		if build := s.getBuild(strings.TrimPrefix(path, "/builds/")); build != nil {
+			writeJSON(w, http.StatusOK, build)
+		} else {
+			writeError(w, http.StatusNotFound, fmt.Errorf("There isn't a build with ID %s", strings.TrimPrefix(path, "/builds/")))
+		}
+	case strings.HasPrefix(path, "/builds/") && r.Method == http.MethodDelete:
+		s.cancelBuild(w, strings.TrimPrefix(path, "/builds/"))
+	case path == "/predictions" && r.Method == http.MethodPost:
+		s.createPrediction(w, r)
+	case path == "/models" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, s.listModels())
+	case path == "/models" && r.Method == http.MethodDelete:
+		s.stopModel(w, r.URL.Query().Get("image"))
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("%s %s isn't part of the API", r.Method, r.URL.Path))
+	}
+}
+
+func (s *Server) authorize(r *http.Request) error {
+	if s.token == "" {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if !IsLoopback(host) {
+			return fmt.Errorf("The daemon only accepts requests to localhost, unless it's run with a token")
+		}
+		return nil
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+		return fmt.Errorf("The request must have the daemon's token, in an Authorization: Bearer header")
+	}
+	return nil
+}
+
+// IsLoopback returns whether host is a name or address of this machine that other machines can't reach
+func IsLoopback(host string) bool {
+	host = strings.Trim(host, "[]")
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func (s *Server) createBuild(w http.ResponseWriter, r *http.Request) {
+	var req BuildRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, cogerrors.Usage(fmt.Errorf("Failed to parse the build request: %w", err)))
+		return
+	}
+	if !filepath.IsAbs(req.Dir) {
+		writeError(w, http.StatusBadRequest, cogerrors.Usage(fmt.Errorf("dir must be the absolute path of the model's directory")))
+		return
+	}
+	id, err := newID()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	build := &Build{ID: id, Dir: req.Dir, Status: BuildQueued, Events: []client.Event{}, CreatedAt: time.Now(), cancel: cancel}
+	s.mu.Lock()
+	s.builds[id] = build
+	s.buildOrder = append(s.buildOrder, id)
+	snapshot := *build
+	s.mu.Unlock()
+
+	go s.runBuild(ctx, build, req)
+	writeJSON(w, http.StatusAccepted, snapshot)
+}
+
+func (s *Server) runBuild(ctx context.Context, build *Build, req BuildRequest) {
+	defer build.cancel()
+	s.buildLock.Lock()
+	defer s.buildLock.Unlock()
+	if ctx.Err() != nil {
+		s.finishBuild(build, nil, ctx.Err())
+		return
+	}
+	s.updateBuild(build, func() { build.Status = BuildRunning })
+
+	console.Infof("Building %s...", req.Dir)
+	result, err := client.Build(ctx, req.Dir, client.BuildOptions{
+		Image:           req.Image,
+		BuildArgs:       req.BuildArgs,
+		NoCache:         req.NoCache,
+		SeparateWeights: req.SeparateWeights,
+		Progress: func(event client.Event) {
+			s.updateBuild(build, func() { build.Events = append(build.Events, event) })
+		},
+	})
+	s.finishBuild(build, result, err)
+}
+
+func (s *Server) finishBuild(build *Build, result *client.BuildResult, err error) {
+	s.updateBuild(build, func() {
+		switch {
+		case err == nil:
+			build.Status = BuildSucceeded
+			build.Image = &result.Summary
+			build.DurationSeconds = result.Duration.Round(time.Millisecond).Seconds()
+		case errors.Is(err, context.Canceled):
+			build.Status = BuildCanceled
+		default:
+			build.Status = BuildFailed
+			object := cogerrors.ToObject(err)
+			build.Error = &object
+		}
+	})
+	if err != nil {
+		console.Warnf("The build of %s failed: %s", build.Dir, err)
+	}
+}
+
+func (s *Server) updateBuild(build *Build, update func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	update()
+}
+
+func (s *Server) getBuild(id string) *Build {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	build, ok := s.builds[id]
+	if !ok {
+		return nil
+	}
+	snapshot := *build
+	snapshot.Events = append([]client.Event{}, build.Events...)
+	return &snapshot
+}
+
+func (s *Server) listBuilds() []Build {
+	builds := []Build{}
+	for _, id := range s.buildIDs() {
+		builds = append(builds, *s.getBuild(id))
+	}
+	return builds
+}
+
+func (s *Server) buildIDs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.buildOrder...)
+}
+
+func (s *Server) cancelBuild(w http.ResponseWriter, id string) {
+	s.mu.Lock()
+	build, ok := s.builds[id]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("There isn't a build with ID %s", id))
+		return
+	}
+	build.cancel()
+	writeJSON(w, http.StatusAccepted, s.getBuild(id))
+}
+
+func (s *Server) createPrediction(w http.ResponseWriter, r *http.Request) {
+	var req PredictionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, cogerrors.Usage(fmt.Errorf("Failed to parse the prediction request: %w", err)))
+		return
+	}
+	if req.Image == "" {
+		writeError(w, http.StatusBadRequest, cogerrors.Usage(fmt.Errorf("The prediction request must have an image")))
+		return
+	}
+	inputs, err := predict.JSONInputsToStrings(req.Input)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, cogerrors.Usage(err))
+		return
+	}
+	model, err := s.model(req.Image, req.GPUs)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// The model is kept running after the request, so the prediction isn't tied to the request's context, which
+	// would stop the model if the client went away
+	ctx := s.ctx
+	if req.TimeoutSeconds > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(req.TimeoutSeconds*float64(time.Second)))
+		defer cancel()
+	}
+	prediction, err := model.Predict(ctx, inputs)
+	if !model.Running() {
+		s.forgetModel(req.Image, model)
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, PredictionResponse{Output: prediction.Output, DurationSeconds: prediction.Duration.Round(time.Millisecond).Seconds()})
+}
+
+// model returns the running model for imageName, starting it if it isn't running
+func (s *Server) model(imageName string, gpus string) (*client.Model, error) {
+	s.modelsMu.Lock()
+	defer s.modelsMu.Unlock()
+	if model, ok := s.models[imageName]; ok {
+		return model, nil
+	}
+	console.Infof("Starting %s...", imageName)
+	model, err := client.Start(imageName, client.RunOptions{GPUs: gpus})
+	if err != nil {
+		return nil, err
+	}
+	s.models[imageName] = model
+	return model, nil
+}
+
+func (s *Server) forgetModel(imageName string, model *client.Model) {
+	s.modelsMu.Lock()
+	defer s.modelsMu.Unlock()
+	if s.models[imageName] == model {
+		delete(s.models, imageName)
+	}
+}
+
+func (s *Server) listModels() []Model {
+	s.modelsMu.Lock()
+	defer s.modelsMu.Unlock()
+	models := []Model{}
+	for imageName := range s.models {
+		models = append(models, Model{Image: imageName})
+	}
+	return models
+}
+
+func (s *Server) stopModel(w http.ResponseWriter, imageName string) {
+	s.modelsMu.Lock()
+	model, ok := s.models[imageName]
+	delete(s.models, imageName)
+	s.modelsMu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("%s isn't running", imageName))
+		return
+	}
+	if err := model.Close(); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func newID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("Failed to generate an ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		console.Debugf("Failed to write response: %s", err)
+	}
+}
+
+// writeError writes err as the same JSON object as --error-json
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]cogerrors.Object{"error": cogerrors.ToObject(err)})
+}
@@ -0,0 +1,110 @@
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	cogerrors "github.com/replicate/cog/pkg/errors"
+)
+
+func request(t *testing.T, server *Server, method string, path string, body string, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, "http://localhost:8393"+path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAuthorize(t *testing.T) {
+	server := New("")
+	t.Cleanup(func() { _ = server.Close() })
+	require.Equal(t, http.StatusOK, request(t, server, http.MethodGet, "/health", "", nil).Code)
+
+	req := httptest.NewRequest(http.MethodGet, "http://attacker.example.com/health", nil)
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	server = New("secret")
+	require.Equal(t, http.StatusUnauthorized, request(t, server, http.MethodGet, "/health", "", nil).Code)
+	require.Equal(t, http.StatusUnauthorized, request(t, server, http.MethodGet, "/health", "", http.Header{"Authorization": {"Bearer wrong"}}).Code)
+	require.Equal(t, http.StatusOK, request(t, server, http.MethodGet, "/health", "", http.Header{"Authorization": {"Bearer secret"}}).Code)
+}
+
+func TestIsLoopback(t *testing.T) {
+	for _, host := range []string{"localhost", "127.0.0.1", "::1", "[::1]"} {
+		require.True(t, IsLoopback(host), host)
+	}
+	for _, host := range []string{"0.0.0.0", "192.168.1.5", "example.com"} {
+		require.False(t, IsLoopback(host), host)
+	}
+}
+
+func TestRequiresJSON(t *testing.T) {
+	server := New("")
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/builds", strings.NewReader(`{"dir": "/src"}`))
+	req.Header.Set("Content-Type", "text/plain")
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+}
+
+func TestBuild(t *testing.T) {
+	server := New("")
+	t.Cleanup(func() { _ = server.Close() })
+
+	rec := request(t, server, http.MethodPost, "/builds", `{"dir": "relative"}`, nil)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Contains(t, rec.Body.String(), cogerrors.CodeUsage)
+
+	// There isn't a cog.yaml, so it fails without needing Docker
+	rec = request(t, server, http.MethodPost, "/builds", `{"dir": "`+t.TempDir()+`"}`, nil)
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	var build Build
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &build))
+	require.NotEmpty(t, build.ID)
+
+	require.Eventually(t, func() bool {
+		rec := request(t, server, http.MethodGet, "/builds/"+build.ID, "", nil)
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &build))
+		return build.Status == BuildFailed
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, cogerrors.CodeConfigInvalid, build.Error.Code)
+
+	rec = request(t, server, http.MethodGet, "/builds", "", nil)
+	var builds []Build
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &builds))
+	require.Len(t, builds, 1)
+
+	require.Equal(t, http.StatusNotFound, request(t, server, http.MethodGet, "/builds/nope", "", nil).Code)
+	require.Equal(t, http.StatusNotFound, request(t, server, http.MethodDelete, "/builds/nope", "", nil).Code)
+}
+
+func TestPredictionRequest(t *testing.T) {
+	server := New("")
+	t.Cleanup(func() { _ = server.Close() })
+
+	rec := request(t, server, http.MethodPost, "/predictions", `{"input": {"prompt": "a hot dog"}}`, nil)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Contains(t, rec.Body.String(), "must have an image")
+
+	rec = request(t, server, http.MethodPost, "/predictions", `{"image": "hotdog", "input": {"prompt": ["a", "list"]}}`, nil)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Contains(t, rec.Body.String(), "must be a string, number or boolean")
+
+	require.Equal(t, http.StatusNotFound, request(t, server, http.MethodDelete, "/models?image=hotdog", "", nil).Code)
+	require.Equal(t, "[]\n", request(t, server, http.MethodGet, "/models", "", nil).Body.String())
+}
@@ -0,0 +1,181 @@
+package demo
+
+import (
+	"fmt"
+	"strings"
+)
+
+// fileExtensions are the extensions Streamlit's file uploader accepts for each kind of file input
+var fileExtensions = map[string][]string{
+	KindImage: {"png", "jpg", "jpeg", "webp", "gif"},
+	KindAudio: {"wav", "mp3", "ogg", "flac", "m4a"},
+	KindVideo: {"mp4", "webm", "mov"},
+}
+
+// IsFile returns whether the input is a file, which is sent to the model as a data URL
+func (i Input) IsFile() bool {
+	return i.Kind == KindImage || i.Kind == KindAudio || i.Kind == KindVideo || i.Kind == KindFile
+}
+
+// HasRange returns whether the input is a number with a minimum and a maximum, so it can be a slider
+func (i Input) HasRange() bool {
+	return (i.Kind == KindInteger || i.Kind == KindNumber) && i.Minimum != "" && i.Maximum != ""
+}
+
+// literal returns a number for the input as a Python literal of the input's type, because Streamlit requires the
+// value, minimum and maximum of a number input to all be ints or all be floats
+func (i Input) literal(s string) string {
+	if i.Kind == KindNumber && s != "" && !strings.ContainsAny(s, ".eE") {
+		return s + ".0"
+	}
+	return s
+}
+
+// kwargs formats Python keyword arguments, leaving out those without a value
+func kwargs(args ...string) string {
+	out := []string{}
+	for j := 0; j < len(args); j += 2 {
+		if args[j+1] != "" {
+			out = append(out, args[j]+"="+args[j+1])
+		}
+	}
+	return strings.Join(out, ", ")
+}
+
+// GradioComponent returns the Gradio component for the input
+func (i Input) GradioComponent() string {
+	label := pythonLiteral(i.Name)
+	info := ""
+	if i.Description != "" {
+		info = pythonLiteral(i.Description)
+	}
+	switch i.Kind {
+	case KindInteger, KindNumber:
+		step := ""
+		precision := ""
+		if i.Kind == KindInteger {
+			step, precision = "1", "0"
+		}
+		if i.HasRange() {
+			return "gr.Slider(" + kwargs("label", label, "minimum", i.literal(i.Minimum), "maximum", i.literal(i.Maximum), "step", step, "value", i.literal(i.Default), "info", info) + ")"
+		}
+		return "gr.Number(" + kwargs("label", label, "value", i.literal(i.Default), "minimum", i.literal(i.Minimum), "maximum", i.literal(i.Maximum), "precision", precision, "info", info) + ")"
+	case KindBoolean:
+		return "gr.Checkbox(" + kwargs("label", label, "value", i.Default, "info", info) + ")"
+	case KindChoice:
+		return "gr.Dropdown(" + kwargs("label", label, "choices", "["+strings.Join(i.Choices, ", ")+"]", "value", i.Default, "info", info) + ")"
+	case KindImage:
+		return "gr.Image(" + kwargs("label", label, "type", `"filepath"`) + ")"
+	case KindAudio:
+		return "gr.Audio(" + kwargs("label", label, "type", `"filepath"`) + ")"
+	case KindVideo:
+		return "gr.Video(" + kwargs("label", label) + ")"
+	case KindFile:
+		return "gr.File(" + kwargs("label", label, "type", `"filepath"`) + ")"
+	}
+	lines := ""
+	if i.Multiline {
+		lines = "3"
+	}
+	return "gr.Textbox(" + kwargs("label", label, "value", i.Default, "lines", lines, "info", info) + ")"
+}
+
+// GradioOutput returns the Gradio component for the model's output
+func (o *Options) GradioOutput() string {
+	switch o.Output {
+	case OutputText:
+		return `gr.Textbox(label="Output")`
+	case OutputFile:
+		return `gr.File(label="Output")`
+	case OutputFiles:
+		return `gr.Files(label="Output")`
+	}
+	return `gr.JSON(label="Output")`
+}
+
+// StreamlitWidget returns the Streamlit widget for the input
+func (i Input) StreamlitWidget() string {
+	label := pythonLiteral(i.Name)
+	help := ""
+	if i.Description != "" {
+		help = pythonLiteral(i.Description)
+	}
+	switch i.Kind {
+	case KindInteger, KindNumber:
+		step := ""
+		if i.Kind == KindInteger {
+			step = "1"
+		}
+		value := i.literal(i.Default)
+		if i.HasRange() {
+			if value == "" {
+				value = i.literal(i.Minimum)
+			}
+			return "st.slider(" + kwargs("label", label, "min_value", i.literal(i.Minimum), "max_value", i.literal(i.Maximum), "value", value, "step", step, "help", help) + ")"
+		}
+		if value == "" {
+			value = "None"
+		}
+		return "st.number_input(" + kwargs("label", label, "min_value", i.literal(i.Minimum), "max_value", i.literal(i.Maximum), "value", value, "step", step, "help", help) + ")"
+	case KindBoolean:
+		value := i.Default
+		if value == "" {
+			value = "False"
+		}
+		return "st.checkbox(" + kwargs("label", label, "value", value, "help", help) + ")"
+	case KindChoice:
+		index := "None"
+		for j, choice := range i.Choices {
+			if choice == i.Default {
+				index = fmt.Sprint(j)
+			}
+		}
+		return "st.selectbox(" + kwargs("label", label, "options", "["+strings.Join(i.Choices, ", ")+"]", "index", index, "help", help) + ")"
+	case KindImage, KindAudio, KindVideo, KindFile:
+		types := ""
+		if extensions, ok := fileExtensions[i.Kind]; ok {
+			types = pythonLiteral(stringsToInterfaces(extensions))
+		}
+		return "st.file_uploader(" + kwargs("label", label, "type", types, "help", help) + ")"
+	}
+	widget := "st.text_input"
+	if i.Multiline {
+		widget = "st.text_area"
+	}
+	value := i.Default
+	if value == "None" {
+		value = ""
+	}
+	return widget + "(" + kwargs("label", label, "value", value, "help", help) + ")"
+}
+
+func stringsToInterfaces(strs []string) []interface{} {
+	out := make([]interface{}, len(strs))
+	for j, s := range strs {
+		out[j] = s
+	}
+	return out
+}
+
+// FileInputs returns the names of the file inputs, as a Python set
+func (o *Options) FileInputs() string {
+	return o.inputSet(Input.IsFile)
+}
+
+// IntegerInputs returns the names of the integer inputs, as a Python set
+func (o *Options) IntegerInputs() string {
+	return o.inputSet(func(i Input) bool { return i.Kind == KindInteger })
+}
+
+func (o *Options) inputSet(include func(Input) bool) string {
+	names := []string{}
+	for _, input := range o.Inputs {
+		if include(input) {
+			names = append(names, pythonLiteral(input.Name))
+		}
+	}
+	if len(names) == 0 {
+		return "set()"
+	}
+	return "{" + strings.Join(names, ", ") + "}"
+}
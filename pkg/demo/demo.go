@@ -0,0 +1,314 @@
+// Package demo generates demo apps, with Gradio or Streamlit, that run predictions with a model through its HTTP
+// API, with components for its inputs and output that are inferred from its schema
+package demo
+
+import (
+	"bytes"
+	// blank import for embeds
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// Frameworks that demos can be generated with
+const (
+	FrameworkGradio    = "gradio"
+	FrameworkStreamlit = "streamlit"
+)
+
+// Frameworks are all of the frameworks that demos can be generated with
+var Frameworks = []string{FrameworkGradio, FrameworkStreamlit}
+
+// Port is the port the demo app serves on, in the image that bundles it
+const Port = 7860
+
+//go:embed templates/gradio.py
+var gradioTemplate string
+
+//go:embed templates/streamlit.py
+var streamlitTemplate string
+
+// Kinds of inputs, which decide their components
+const (
+	KindText    = "text"
+	KindInteger = "integer"
+	KindNumber  = "number"
+	KindBoolean = "boolean"
+	KindChoice  = "choice"
+	KindImage   = "image"
+	KindAudio   = "audio"
+	KindVideo   = "video"
+	KindFile    = "file"
+)
+
+// Kinds of outputs
+const (
+	OutputText  = "text"
+	OutputFile  = "file"
+	OutputFiles = "files"
+	OutputJSON  = "json"
+)
+
+// Input is an input of the model, with what's needed to make a component for it
+type Input struct {
+	Name        string
+	Kind        string
+	Description string
+	Required    bool
+	// Default, Minimum, Maximum and Choices are Python literals, or empty if the input doesn't have them
+	Default   string
+	Minimum   string
+	Maximum   string
+	Choices   []string
+	Multiline bool
+}
+
+// Options describe the demo to generate
+type Options struct {
+	// Title is the demo's title, e.g. the model's name
+	Title string
+	// Image is the model's image, which the image that bundles the demo is built from
+	Image     string
+	Inputs    []Input
+	Output    string
+	Framework string
+}
+
+// NewOptions returns the options for a demo of the model in imageName, with the inputs and output in its schema
+func NewOptions(framework string, title string, imageName string, schema *openapi3.T) (*Options, error) {
+	if framework != FrameworkGradio && framework != FrameworkStreamlit {
+		return nil, fmt.Errorf("Unknown framework '%s', it must be one of %s", framework, strings.Join(Frameworks, ", "))
+	}
+	return &Options{
+		Title:     title,
+		Image:     imageName,
+		Inputs:    Inputs(schema),
+		Output:    OutputKind(schema),
+		Framework: framework,
+	}, nil
+}
+
+// Inputs returns the model's inputs, in the order they're defined in predict()
+func Inputs(schema *openapi3.T) []Input {
+	inputSchema, ok := schema.Components.Schemas["Input"]
+	if !ok || inputSchema.Value == nil {
+		return nil
+	}
+	required := map[string]bool{}
+	for _, name := range inputSchema.Value.Required {
+		required[name] = true
+	}
+	names := make([]string, 0, len(inputSchema.Value.Properties))
+	for name, property := range inputSchema.Value.Properties {
+		if property.Value != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	sort.SliceStable(names, func(i, j int) bool {
+		return order(inputSchema.Value.Properties[names[i]]) < order(inputSchema.Value.Properties[names[j]])
+	})
+
+	inputs := []Input{}
+	for _, name := range names {
+		property := inputSchema.Value.Properties[name].Value
+		input := Input{Name: name, Description: property.Description, Required: required[name]}
+		s := property
+		// Inputs with choices refer to an enum schema
+		if s.Type == "" && len(s.AllOf) > 0 && s.AllOf[0].Value != nil {
+			s = s.AllOf[0].Value
+		}
+		switch {
+		case len(s.Enum) > 0:
+			input.Kind = KindChoice
+			for _, choice := range s.Enum {
+				input.Choices = append(input.Choices, pythonLiteral(choice))
+			}
+		case s.Type == "string" && s.Format == "uri":
+			input.Kind = fileKind(name)
+		case s.Type == "integer":
+			input.Kind = KindInteger
+		case s.Type == "number":
+			input.Kind = KindNumber
+		case s.Type == "boolean":
+			input.Kind = KindBoolean
+		default:
+			input.Kind = KindText
+			input.Multiline = s.MaxLength == nil || *s.MaxLength > 200
+		}
+		if property.Default != nil {
+			input.Default = pythonLiteral(property.Default)
+		}
+		if s.Min != nil {
+			input.Minimum = pythonLiteral(*s.Min)
+		}
+		if s.Max != nil {
+			input.Maximum = pythonLiteral(*s.Max)
+		}
+		inputs = append(inputs, input)
+	}
+	return inputs
+}
+
+// fileKind guesses what kind of file an input is from its name, because the schema only says it's a file
+func fileKind(name string) string {
+	name = strings.ToLower(name)
+	for _, kind := range []struct {
+		kind  string
+		words []string
+	}{
+		{KindImage, []string{"image", "img", "photo", "picture", "mask"}},
+		{KindAudio, []string{"audio", "speech", "voice", "sound", "music"}},
+		{KindVideo, []string{"video", "movie", "clip"}},
+	} {
+		for _, word := range kind.words {
+			if strings.Contains(name, word) {
+				return kind.kind
+			}
+		}
+	}
+	return KindFile
+}
+
+// OutputKind returns what kind of output the model has
+func OutputKind(schema *openapi3.T) string {
+	outputSchema, ok := schema.Components.Schemas["Output"]
+	if !ok || outputSchema.Value == nil {
+		return OutputJSON
+	}
+	s := outputSchema.Value
+	switch {
+	case s.Type == "string" && s.Format == "uri":
+		return OutputFile
+	case s.Type == "string":
+		return OutputText
+	case s.Type == "array" && s.Items != nil && s.Items.Value != nil:
+		items := s.Items.Value
+		if items.Type == "string" && items.Format == "uri" {
+			return OutputFiles
+		}
+		// Iterators of strings are usually text generated a token at a time
+		if items.Type == "string" && s.Extensions["x-cog-array-type"] == "iterator" {
+			return OutputText
+		}
+	}
+	return OutputJSON
+}
+
+func order(property *openapi3.SchemaRef) float64 {
+	if o, ok := property.Value.Extensions["x-order"].(float64); ok {
+		return o
+	}
+	return 0
+}
+
+// pythonLiteral returns v, a value decoded from JSON, as a Python literal
+func pythonLiteral(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "None"
+	case bool:
+		if v {
+			return "True"
+		}
+		return "False"
+	case []interface{}:
+		items := []string{}
+		for _, item := range v {
+			items = append(items, pythonLiteral(item))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	}
+	// JSON strings and numbers are valid Python literals
+	out, err := json.Marshal(v)
+	if err != nil {
+		return "None"
+	}
+	return string(out)
+}
+
+// App returns the demo app's Python code
+func App(opts *Options) ([]byte, error) {
+	text := gradioTemplate
+	if opts.Framework == FrameworkStreamlit {
+		text = streamlitTemplate
+	}
+	tmpl, err := template.New(opts.Framework).Delims("[[", "]]").Funcs(template.FuncMap{
+		"py": pythonLiteral,
+	}).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, opts); err != nil {
+		return nil, fmt.Errorf("Failed to generate the demo: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Requirements returns the demo app's requirements.txt
+func Requirements(framework string) string {
+	if framework == FrameworkStreamlit {
+		return "requests>=2.28\nstreamlit>=1.28\n"
+	}
+	return "gradio>=4.0\nrequests>=2.28\n"
+}
+
+// Dockerfile returns a Dockerfile that builds an image that bundles the demo with the model, built from the
+// directory the demo is written to. It runs the model's HTTP API, and serves the demo on Port.
+func Dockerfile(opts *Options) string {
+	return fmt.Sprintf(`FROM %s
+COPY requirements.txt /demo/requirements.txt
+RUN pip install --no-cache-dir -r /demo/requirements.txt
+COPY . /demo
+ENV COG_URL=http://localhost:5000
+EXPOSE %d
+CMD ["/bin/sh", "/demo/start.sh"]
+`, opts.Image, Port)
+}
+
+// startScript runs the model's HTTP API in the background, and the demo in the foreground
+func startScript(framework string) string {
+	demo := fmt.Sprintf("exec python /demo/app.py --port %d", Port)
+	if framework == FrameworkStreamlit {
+		demo = fmt.Sprintf("exec streamlit run /demo/app.py --server.address 0.0.0.0 --server.port %d", Port)
+	}
+	return "#!/bin/sh\n# Generated by `cog demo`. Runs the model's HTTP API, and the demo that uses it.\npython -m cog.server.http &\n" + demo + "\n"
+}
+
+// Write writes the demo to dir: app.py, requirements.txt, and a Dockerfile and start.sh to bundle it with the model
+// in an image. It returns the paths of the files.
+func Write(dir string, opts *Options) ([]string, error) {
+	app, err := App(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("Failed to create %s: %w", dir, err)
+	}
+	files := []struct {
+		name     string
+		contents []byte
+	}{
+		{"app.py", app},
+		{"requirements.txt", []byte(Requirements(opts.Framework))},
+		{"Dockerfile", []byte(Dockerfile(opts))},
+		{"start.sh", []byte(startScript(opts.Framework))},
+	}
+	paths := []string{}
+	for _, file := range files {
+		path := filepath.Join(dir, file.name)
+		if err := os.WriteFile(path, file.contents, 0o644); err != nil {
+			return nil, fmt.Errorf("Failed to write %s: %w", path, err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
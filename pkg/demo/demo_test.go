@@ -0,0 +1,86 @@
+package demo
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/require"
+)
+
+const testSchema = `{
+  "openapi": "3.0.2",
+  "info": {"title": "Cog", "version": "0.1.0"},
+  "paths": {},
+  "components": {
+    "schemas": {
+      "Input": {
+        "type": "object",
+        "required": ["image"],
+        "properties": {
+          "image": {"type": "string", "format": "uri", "description": "A photo", "x-order": 0},
+          "prompt": {"type": "string", "default": "a hot dog", "x-order": 1},
+          "steps": {"type": "integer", "default": 20, "minimum": 1, "maximum": 100, "x-order": 2},
+          "guidance": {"type": "number", "default": 7.5, "minimum": 1, "x-order": 3},
+          "safe": {"type": "boolean", "default": true, "x-order": 4},
+          "scheduler": {"allOf": [{"$ref": "#/components/schemas/scheduler"}], "default": "DDIM", "x-order": 5}
+        }
+      },
+      "scheduler": {"type": "string", "enum": ["DDIM", "K_EULER"]},
+      "Output": {"type": "array", "items": {"type": "string", "format": "uri"}}
+    }
+  }
+}`
+
+func loadSchema(t *testing.T) *openapi3.T {
+	t.Helper()
+	schema, err := openapi3.NewLoader().LoadFromData([]byte(testSchema))
+	require.NoError(t, err)
+	return schema
+}
+
+func TestInputs(t *testing.T) {
+	inputs := Inputs(loadSchema(t))
+	require.Len(t, inputs, 6)
+	require.Equal(t, Input{Name: "image", Kind: KindImage, Description: "A photo", Required: true}, inputs[0])
+	require.Equal(t, Input{Name: "prompt", Kind: KindText, Default: `"a hot dog"`, Multiline: true}, inputs[1])
+	require.Equal(t, Input{Name: "steps", Kind: KindInteger, Default: "20", Minimum: "1", Maximum: "100"}, inputs[2])
+	require.Equal(t, "True", inputs[4].Default)
+	require.Equal(t, Input{Name: "scheduler", Kind: KindChoice, Default: `"DDIM"`, Choices: []string{`"DDIM"`, `"K_EULER"`}}, inputs[5])
+	require.Equal(t, OutputFiles, OutputKind(loadSchema(t)))
+}
+
+func TestComponents(t *testing.T) {
+	inputs := Inputs(loadSchema(t))
+	require.Equal(t, `gr.Image(label="image", type="filepath")`, inputs[0].GradioComponent())
+	require.Equal(t, `gr.Slider(label="steps", minimum=1, maximum=100, step=1, value=20)`, inputs[2].GradioComponent())
+	require.Equal(t, `gr.Number(label="guidance", value=7.5, minimum=1.0)`, inputs[3].GradioComponent())
+	require.Equal(t, `gr.Dropdown(label="scheduler", choices=["DDIM", "K_EULER"], value="DDIM")`, inputs[5].GradioComponent())
+
+	require.Equal(t, `st.file_uploader(label="image", type=["png", "jpg", "jpeg", "webp", "gif"], help="A photo")`, inputs[0].StreamlitWidget())
+	// Streamlit needs the value and bounds of a number to be the same type
+	require.Equal(t, `st.number_input(label="guidance", min_value=1.0, value=7.5)`, inputs[3].StreamlitWidget())
+	require.Equal(t, `st.selectbox(label="scheduler", options=["DDIM", "K_EULER"], index=0)`, inputs[5].StreamlitWidget())
+}
+
+func TestWrite(t *testing.T) {
+	for _, framework := range Frameworks {
+		opts, err := NewOptions(framework, "hotdog-detector", "hotdog-detector:latest", loadSchema(t))
+		require.NoError(t, err)
+		dir := t.TempDir()
+		paths, err := Write(dir, opts)
+		require.NoError(t, err)
+		require.Len(t, paths, 4)
+
+		app, err := os.ReadFile(filepath.Join(dir, "app.py"))
+		require.NoError(t, err)
+		require.Contains(t, string(app), `FILE_INPUTS = {"image"}`)
+		dockerfile, err := os.ReadFile(filepath.Join(dir, "Dockerfile"))
+		require.NoError(t, err)
+		require.Contains(t, string(dockerfile), "FROM hotdog-detector:latest")
+	}
+
+	_, err := NewOptions("flask", "hotdog-detector", "hotdog-detector", loadSchema(t))
+	require.ErrorContains(t, err, "Unknown framework 'flask'")
+}
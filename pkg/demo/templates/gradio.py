@@ -0,0 +1,93 @@
+# A Gradio demo of [[.Title]], which runs predictions with the model's HTTP API.
+# Generated by `cog demo gradio`. It's yours to change, and isn't generated again.
+#
+# Start the model, e.g. with `docker run -p 5000:5000 [[.Image]]`, then run:
+#
+#   pip install -r requirements.txt
+#   COG_URL=http://localhost:5000 python app.py
+import argparse
+import base64
+import mimetypes
+import os
+import tempfile
+
+import gradio as gr
+import requests
+
+COG_URL = os.environ.get("COG_URL", "http://localhost:5000")
+
+# The names of the model's inputs, in the order of the components
+INPUTS = [
+[[- range .Inputs]]
+    [[py .Name]],
+[[- end]]
+]
+# Inputs that are files, which are sent to the model as data URLs
+FILE_INPUTS = [[.FileInputs]]
+# Inputs that are integers, which Gradio's sliders return as floats
+INTEGER_INPUTS = [[.IntegerInputs]]
+
+
+def to_data_url(path):
+    mime_type = mimetypes.guess_type(path)[0] or "application/octet-stream"
+    with open(path, "rb") as f:
+        return f"data:{mime_type};base64,{base64.b64encode(f.read()).decode()}"
+
+
+def to_file(url):
+    """Returns the path of an output file, which is a data URL unless the model uploads its outputs"""
+    if not url.startswith("data:"):
+        return url
+    header, data = url.split(",", 1)
+    mime_type = header[len("data:") :].split(";")[0]
+    suffix = mimetypes.guess_extension(mime_type) or ""
+    with tempfile.NamedTemporaryFile(delete=False, suffix=suffix) as f:
+        f.write(base64.b64decode(data))
+    return f.name
+
+
+def predict(*values):
+    payload = {}
+    for name, value in zip(INPUTS, values):
+        if value is None or value == "":
+            continue
+        if name in FILE_INPUTS:
+            value = to_data_url(value)
+        elif name in INTEGER_INPUTS:
+            value = int(value)
+        payload[name] = value
+
+    response = requests.post(f"{COG_URL}/predictions", json={"input": payload})
+    body = response.json()
+    if response.status_code != 200 or body.get("status") != "succeeded":
+        error = body.get("error") or body.get("detail")
+        raise gr.Error(str(error or f"The model responded with {response.status_code}"))
+    output = body["output"]
+[[- if eq .Output "file"]]
+    return to_file(output)
+[[- else if eq .Output "files"]]
+    return [to_file(url) for url in output]
+[[- else if eq .Output "text"]]
+    return "".join(output) if isinstance(output, list) else output
+[[- else]]
+    return output
+[[- end]]
+
+
+demo = gr.Interface(
+    fn=predict,
+    inputs=[
+[[- range .Inputs]]
+        [[.GradioComponent]],
+[[- end]]
+    ],
+    outputs=[[.GradioOutput]],
+    title=[[py .Title]],
+    allow_flagging="never",
+)
+
+if __name__ == "__main__":
+    parser = argparse.ArgumentParser()
+    parser.add_argument("--port", type=int, default=7860)
+    args = parser.parse_args()
+    demo.launch(server_name="0.0.0.0", server_port=args.port)
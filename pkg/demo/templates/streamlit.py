@@ -0,0 +1,80 @@
+# A Streamlit demo of [[.Title]], which runs predictions with the model's HTTP API.
+# Generated by `cog demo streamlit`. It's yours to change, and isn't generated again.
+#
+# Start the model, e.g. with `docker run -p 5000:5000 [[.Image]]`, then run:
+#
+#   pip install -r requirements.txt
+#   COG_URL=http://localhost:5000 streamlit run app.py
+import base64
+import mimetypes
+import os
+
+import requests
+import streamlit as st
+
+COG_URL = os.environ.get("COG_URL", "http://localhost:5000")
+
+# Inputs that are files, which are sent to the model as data URLs
+FILE_INPUTS = [[.FileInputs]]
+
+
+def to_data_url(uploaded):
+    mime_type = uploaded.type or mimetypes.guess_type(uploaded.name)[0] or "application/octet-stream"
+    return f"data:{mime_type};base64,{base64.b64encode(uploaded.getvalue()).decode()}"
+
+
+def show_file(url):
+    """Shows an output file, which is a data URL unless the model uploads its outputs"""
+    if url.startswith("data:"):
+        header, data = url.split(",", 1)
+        mime_type = header[len("data:") :].split(";")[0]
+        content = base64.b64decode(data)
+    else:
+        mime_type = mimetypes.guess_type(url.split("?")[0])[0] or ""
+        content = requests.get(url).content
+    if mime_type.startswith("image/"):
+        st.image(content)
+    elif mime_type.startswith("audio/"):
+        st.audio(content, format=mime_type)
+    elif mime_type.startswith("video/"):
+        st.video(content, format=mime_type)
+    else:
+        extension = mimetypes.guess_extension(mime_type) or ""
+        st.download_button("Download the output", content, file_name="output" + extension, mime=mime_type or None)
+
+
+st.title([[py .Title]])
+
+with st.form("inputs"):
+    values = {
+[[- range .Inputs]]
+        [[py .Name]]: [[.StreamlitWidget]],
+[[- end]]
+    }
+    submitted = st.form_submit_button("Run")
+
+if submitted:
+    payload = {}
+    for name, value in values.items():
+        if value is None or value == "":
+            continue
+        payload[name] = to_data_url(value) if name in FILE_INPUTS else value
+
+    with st.spinner("Running the model..."):
+        response = requests.post(f"{COG_URL}/predictions", json={"input": payload})
+    body = response.json()
+    if response.status_code != 200 or body.get("status") != "succeeded":
+        error = body.get("error") or body.get("detail")
+        st.error(str(error or f"The model responded with {response.status_code}"))
+        st.stop()
+    output = body["output"]
+[[- if eq .Output "file"]]
+    show_file(output)
+[[- else if eq .Output "files"]]
+    for url in output:
+        show_file(url)
+[[- else if eq .Output "text"]]
+    st.write("".join(output) if isinstance(output, list) else output)
+[[- else]]
+    st.json(output)
+[[- end]]
@@ -1,60 +1,333 @@
 package docker
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/replicate/cog/pkg/util"
 	"github.com/replicate/cog/pkg/util/console"
 )
 
-func Build(dir, dockerfile, imageName string, secrets []string, noCache bool, progressOutput string) error {
+// BuildError is returned by Build when a RUN instruction fails
+type BuildError struct {
+	// Command is the shell command of the RUN instruction that failed
+	Command string
+	Err     error
+}
+
+func (e *BuildError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *BuildError) Unwrap() error {
+	return e.Err
+}
+
+// failedProcess matches BuildKit's error for a RUN instruction that failed, which has the command quoted
+var failedProcess = regexp.MustCompile(`process ("(?:[^"\\]|\\.)*") did not complete successfully`)
+
+// buildOutputTailSize is how much of the end of the build output is kept to find out why it failed
+const buildOutputTailSize = 64 * 1024
+
+// BuildStep is a step of a build, as shown in BuildKit's plain progress output
+type BuildStep struct {
+	// Name is how BuildKit describes the step, e.g. "[stage-1 4/9] RUN pip install torch"
+	Name     string
+	Duration time.Duration
+	Cached   bool
+}
+
+// Stage returns the stage of a step that runs a Dockerfile instruction, e.g. "stage-1 4/9"
+func (s BuildStep) Stage() string {
+	if stage, _, ok := splitStepName(s.Name); ok {
+		return stage
+	}
+	return ""
+}
+
+// Instruction returns the Dockerfile instruction a step runs, or "" if it is one of BuildKit's own steps
+func (s BuildStep) Instruction() string {
+	if _, instruction, ok := splitStepName(s.Name); ok {
+		return instruction
+	}
+	return ""
+}
+
+func splitStepName(name string) (stage string, instruction string, ok bool) {
+	if !strings.HasPrefix(name, "[") || strings.HasPrefix(name, "[internal]") {
+		return "", "", false
+	}
+	end := strings.Index(name, "] ")
+	if end < 0 {
+		return "", "", false
+	}
+	return name[1:end], name[end+2:], true
+}
+
+// BuildOptions are settings for every build, e.g. from the defaults file
+type BuildOptions struct {
+	// Builder is the Buildx builder to build with, or the current one if it's empty
+	Builder string
+	// CacheFrom are the sources to import the build cache from, as passed to --cache-from
+	CacheFrom []string
+	// CacheTo is where to export the build cache to, as passed to --cache-to, or inline in the image if it's empty
+	CacheTo string
+}
+
+var buildOptions BuildOptions
+
+// SetBuildOptions sets the options every build uses
+func SetBuildOptions(options BuildOptions) {
+	buildOptions = options
+}
+
+// builderArgs returns the arguments to docker buildx build that select the builder in buildOptions
+func builderArgs() []string {
+	if buildOptions.Builder == "" {
+		return nil
+	}
+	// Builders other than Docker's own keep what they build in their cache, unless it's loaded into Docker
+	return []string{"--builder", buildOptions.Builder, "--load"}
+}
+
+// SourceDateEpochArg is the build arg that BuildKit sets the timestamps in the image to, so building the same
+// files twice gives the same layers
+const SourceDateEpochArg = "SOURCE_DATE_EPOCH"
+
+// hasBuildArg returns whether buildArgs, in the form name=value, set name
+func hasBuildArg(buildArgs []string, name string) bool {
+	for _, buildArg := range buildArgs {
+		if strings.HasPrefix(buildArg, name+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+// withTimestampsRewritten returns args with the output set to load the image into Docker with the timestamps of the
+// files in its layers set to SOURCE_DATE_EPOCH, instead of when they were written. This replaces --load, which is
+// the same output without the option.
+func withTimestampsRewritten(args []string) []string {
+	rewritten := []string{}
+	for _, arg := range args {
+		if arg != "--load" {
+			rewritten = append(rewritten, arg)
+		}
+	}
+	return append(rewritten, "--output", "type=docker,rewrite-timestamp=true")
+}
+
+// Build builds the image from dockerfile with dir as the build context. If dockerignore isn't empty, it's used
+// instead of the .dockerignore in dir.
+func Build(ctx context.Context, dir, dockerfile, dockerignore, imageName string, secrets []string, buildArgs []string, noCache bool, progressOutput string) error {
+	_, err := BuildWithSteps(ctx, dir, dockerfile, dockerignore, imageName, secrets, buildArgs, noCache, progressOutput)
+	return err
+}
+
+// BuildWithSteps builds an image like Build, and returns the steps of the build and how long they took.
+// Steps can only be read from the plain progress output, so they are empty for other progress outputs. If ctx is
+// canceled, the build is interrupted, and ctx's error is returned.
+func BuildWithSteps(ctx context.Context, dir, dockerfile, dockerignore, imageName string, secrets []string, buildArgs []string, noCache bool, progressOutput string) ([]BuildStep, error) {
+	return BuildWithOutput(ctx, os.Stderr, dir, dockerfile, dockerignore, imageName, secrets, buildArgs, noCache, progressOutput)
+}
+
+// BuildWithOutput builds an image like BuildWithSteps, writing the build's output to out instead of stderr, e.g. so
+// it isn't mixed up with the output of another build that runs at the same time
+func BuildWithOutput(ctx context.Context, out io.Writer, dir, dockerfile, dockerignore, imageName string, secrets []string, buildArgs []string, noCache bool, progressOutput string) ([]BuildStep, error) {
+	dockerfilePath := "-"
+	if dockerignore != "" {
+		// BuildKit uses the ignore file next to the Dockerfile, called Dockerfile.dockerignore, instead of the
+		// .dockerignore in the build context. Both are written outside the project, so its files aren't changed.
+		tmpDir, err := os.MkdirTemp("", "cog-build")
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create temporary directory for Dockerfile: %w", err)
+		}
+		defer os.RemoveAll(tmpDir)
+		dockerfilePath = filepath.Join(tmpDir, "Dockerfile")
+		if err := os.WriteFile(dockerfilePath, []byte(dockerfile), 0o644); err != nil {
+			return nil, fmt.Errorf("Failed to write Dockerfile: %w", err)
+		}
+		if err := os.WriteFile(dockerfilePath+".dockerignore", []byte(dockerignore), 0o644); err != nil {
+			return nil, fmt.Errorf("Failed to write Dockerfile.dockerignore: %w", err)
+		}
+	}
+
 	var args []string
 
 	args = append(args,
 		"buildx", "build",
 	)
+	args = append(args, builderArgs()...)
 
 	if util.IsAppleSiliconMac(runtime.GOOS, runtime.GOARCH) {
 		// Fixes "WARNING: The requested image's platform (linux/amd64) does not match the detected host platform (linux/arm64/v8) and no specific platform was requested"
 		args = append(args, "--platform", "linux/amd64", "--load")
 	}
+	if hasBuildArg(buildArgs, SourceDateEpochArg) {
+		args = withTimestampsRewritten(args)
+	}
 
 	for _, secret := range secrets {
 		args = append(args, "--secret", secret)
 	}
+	for _, buildArg := range buildArgs {
+		args = append(args, "--build-arg", buildArg)
+	}
 
 	if noCache {
 		args = append(args, "--no-cache")
 	}
+	for _, from := range buildOptions.CacheFrom {
+		args = append(args, "--cache-from", from)
+	}
+	cacheTo := "type=inline"
+	if buildOptions.CacheTo != "" {
+		cacheTo = buildOptions.CacheTo
+	}
 
 	args = append(args,
-		"--file", "-",
-		"--cache-to", "type=inline",
+		"--file", dockerfilePath,
+		"--cache-to", cacheTo,
 		"--tag", imageName,
 		"--progress", progressOutput,
 		".",
 	)
 
-	cmd := exec.Command("docker", args...)
+	output := &tailBuffer{size: buildOutputTailSize}
+	steps := &stepRecorder{}
+	cmd := commandContext(ctx, args...)
 	cmd.Dir = dir
-	cmd.Stdout = os.Stderr // redirect stdout to stderr - build output is all messaging
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = strings.NewReader(dockerfile)
+	cmd.Stdout = out // redirect stdout to out - build output is all messaging
+	cmd.Stderr = io.MultiWriter(out, output, steps)
+	if dockerfilePath == "-" {
+		cmd.Stdin = strings.NewReader(dockerfile)
+	}
 
 	console.Debug("$ " + strings.Join(cmd.Args, " "))
-	return cmd.Run()
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return steps.Steps(), ctx.Err()
+		}
+		if command := failedCommand(output.String()); command != "" {
+			return steps.Steps(), &BuildError{Command: command, Err: err}
+		}
+		return steps.Steps(), err
+	}
+	return steps.Steps(), nil
+}
+
+// stepLine matches a line of plain progress output, e.g. "#5 [stage-1 4/9] RUN pip install torch" or "#5 DONE 12.3s"
+var stepLine = regexp.MustCompile(`^#(\d+) (.*)$`)
+
+// stepDone matches the line of plain progress output that says a step has finished and how long it took
+var stepDone = regexp.MustCompile(`^DONE ([0-9.]+)s$`)
+
+// stepRecorder reads the steps of a build from BuildKit's plain progress output as it is written
+type stepRecorder struct {
+	partial []byte
+	ids     []string
+	steps   map[string]*BuildStep
+}
+
+func (r *stepRecorder) Write(p []byte) (int, error) {
+	r.partial = append(r.partial, p...)
+	for {
+		i := bytes.IndexByte(r.partial, '\n')
+		if i < 0 {
+			break
+		}
+		r.line(strings.TrimRight(string(r.partial[:i]), "\r"))
+		r.partial = r.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+func (r *stepRecorder) line(line string) {
+	match := stepLine.FindStringSubmatch(line)
+	if match == nil {
+		return
+	}
+	id, text := match[1], match[2]
+	if r.steps == nil {
+		r.steps = map[string]*BuildStep{}
+	}
+	step, ok := r.steps[id]
+	if !ok {
+		// The first line of a step is its name, which is repeated when output of other steps comes in between
+		r.ids = append(r.ids, id)
+		r.steps[id] = &BuildStep{Name: text}
+		return
+	}
+	if text == "CACHED" {
+		step.Cached = true
+	} else if done := stepDone.FindStringSubmatch(text); done != nil {
+		if seconds, err := strconv.ParseFloat(done[1], 64); err == nil {
+			step.Duration = time.Duration(seconds * float64(time.Second))
+		}
+	}
+}
+
+// Steps returns the steps recorded so far, in the order they started
+func (r *stepRecorder) Steps() []BuildStep {
+	steps := make([]BuildStep, 0, len(r.ids))
+	for _, id := range r.ids {
+		steps = append(steps, *r.steps[id])
+	}
+	return steps
+}
+
+// failedCommand returns the shell command of the RUN instruction that failed in a build's output, if there is one
+func failedCommand(output string) string {
+	matches := failedProcess.FindAllStringSubmatch(output, -1)
+	if len(matches) == 0 {
+		return ""
+	}
+	process, err := strconv.Unquote(matches[len(matches)-1][1])
+	if err != nil {
+		return ""
+	}
+	for _, shell := range []string{"/bin/sh -c ", "/bin/bash -c "} {
+		if strings.HasPrefix(process, shell) {
+			return strings.TrimPrefix(process, shell)
+		}
+	}
+	return process
+}
+
+// tailBuffer keeps the last size bytes written to it
+type tailBuffer struct {
+	size int
+	buf  []byte
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > t.size {
+		t.buf = t.buf[len(t.buf)-t.size:]
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string {
+	return string(t.buf)
 }
 
-func BuildAddLabelsToImage(image string, labels map[string]string) error {
+func BuildAddLabelsToImage(ctx context.Context, image string, labels map[string]string) error {
 	var args []string
 
 	args = append(args,
 		"buildx", "build",
 	)
+	args = append(args, builderArgs()...)
 
 	if util.IsAppleSiliconMac(runtime.GOOS, runtime.GOARCH) {
 		// Fixes "WARNING: The requested image's platform (linux/amd64) does not match the detected host platform (linux/arm64/v8) and no specific platform was requested"
@@ -72,7 +345,7 @@ func BuildAddLabelsToImage(image string, labels map[string]string) error {
 	}
 	// We're not using context, but Docker requires we pass a context
 	args = append(args, ".")
-	cmd := exec.Command("docker", args...)
+	cmd := commandContext(ctx, args...)
 
 	dockerfile := "FROM " + image
 	cmd.Stdin = strings.NewReader(dockerfile)
@@ -80,6 +353,9 @@ func BuildAddLabelsToImage(image string, labels map[string]string) error {
 	console.Debug("$ " + strings.Join(cmd.Args, " "))
 
 	if combinedOutput, err := cmd.CombinedOutput(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		console.Info(string(combinedOutput))
 		return err
 	}
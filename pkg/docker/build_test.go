@@ -0,0 +1,150 @@
+package docker
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFailedCommand(t *testing.T) {
+	output := `#8 [stage-1 4/9] RUN --mount=type=cache,target=/var/cache/apt apt-get install -y libfoo
+#8 ERROR: process "/bin/sh -c apt-get install -y libfoo" did not complete successfully: exit code: 100
+------
+ > [stage-1 4/9] RUN --mount=type=cache,target=/var/cache/apt apt-get install -y libfoo:
+------
+ERROR: failed to solve: process "/bin/sh -c apt-get install -y libfoo" did not complete successfully: exit code: 100
+`
+	require.Equal(t, "apt-get install -y libfoo", failedCommand(output))
+	require.Equal(t, `echo "hello \"world\""`, failedCommand(`ERROR: failed to solve: process "/bin/sh -c echo \"hello \\\"world\\\"\"" did not complete successfully: exit code: 1`))
+	require.Equal(t, "", failedCommand("ERROR: failed to solve: failed to read dockerfile"))
+}
+
+func TestTailBuffer(t *testing.T) {
+	buf := &tailBuffer{size: 5}
+	_, _ = buf.Write([]byte("hello "))
+	_, _ = buf.Write([]byte("world"))
+	require.Equal(t, "world", buf.String())
+}
+
+func TestStepRecorder(t *testing.T) {
+	output := `#1 [internal] load build definition from Dockerfile
+#1 transferring dockerfile: 1.2kB done
+#1 DONE 0.0s
+
+#5 [deps 2/4] RUN --mount=type=cache,target=/root/.cache/pip pip install -t /dep -r /tmp/requirements.txt
+#6 [stage-1 1/9] FROM docker.io/library/python:3.11-slim@sha256:abc
+#6 CACHED
+
+#5 [deps 2/4] RUN --mount=type=cache,target=/root/.cache/pip pip install -t /dep -r /tmp/requirements.txt
+#5 0.512 Collecting torch
+#5 DONE 12.3s
+
+#9 [stage-1 4/9] RUN apt-get install -y libfoo
+#9 ERROR: process "/bin/sh -c apt-get install -y libfoo" did not complete successfully: exit code: 100
+`
+	recorder := &stepRecorder{}
+	// Write in pieces to check lines split across writes are handled
+	_, _ = recorder.Write([]byte(output[:100]))
+	_, _ = recorder.Write([]byte(output[100:]))
+
+	steps := recorder.Steps()
+	require.Len(t, steps, 4)
+	require.Equal(t, BuildStep{Name: "[internal] load build definition from Dockerfile"}, steps[0])
+	require.Equal(t, "", steps[0].Instruction())
+	require.Equal(t, "deps 2/4", steps[1].Stage())
+	require.Equal(t, "RUN --mount=type=cache,target=/root/.cache/pip pip install -t /dep -r /tmp/requirements.txt", steps[1].Instruction())
+	require.Equal(t, 12300*time.Millisecond, steps[1].Duration)
+	require.True(t, steps[2].Cached)
+	require.Equal(t, "FROM docker.io/library/python:3.11-slim@sha256:abc", steps[2].Instruction())
+	require.Equal(t, time.Duration(0), steps[3].Duration)
+}
+
+func TestWithTimestampsRewritten(t *testing.T) {
+	require.True(t, hasBuildArg([]string{"FOO=bar", "SOURCE_DATE_EPOCH=0"}, SourceDateEpochArg))
+	require.False(t, hasBuildArg([]string{"SOURCE_DATE_EPOCHS=0"}, SourceDateEpochArg))
+	require.Equal(t,
+		[]string{"buildx", "build", "--builder", "remote", "--output", "type=docker,rewrite-timestamp=true"},
+		withTimestampsRewritten([]string{"buildx", "build", "--builder", "remote", "--load"}))
+}
+
+// fakeDocker puts a docker command on PATH that runs script, and returns the directory it's in
+func fakeDocker(t *testing.T, script string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("The fake docker command is a shell script")
+	}
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "docker"), []byte("#!/bin/sh\n"+script), 0o755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return dir
+}
+
+func TestBuildWithSteps(t *testing.T) {
+	// The fake docker records its arguments and working directory, and copies the Dockerfile it's given, with the
+	// ignore file next to it, because they're removed when the build finishes
+	fake := fakeDocker(t, `
+printf '%s\n' "$@" > "$(dirname "$0")/args"
+pwd > "$(dirname "$0")/pwd"
+previous=""
+for arg in "$@"; do
+	if [ "$previous" = "--file" ]; then
+		if [ "$arg" = "-" ]; then
+			cat > "$(dirname "$0")/Dockerfile"
+		else
+			echo "$arg" > "$(dirname "$0")/file"
+			cp "$arg" "$(dirname "$0")/Dockerfile"
+			cp "$arg.dockerignore" "$(dirname "$0")/Dockerfile.dockerignore"
+		fi
+	fi
+	previous="$arg"
+done
+`)
+	dir := t.TempDir()
+	projectDockerignore := []byte("# the project's own\n*.ckpt\n")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".dockerignore"), projectDockerignore, 0o644))
+
+	_, err := BuildWithSteps(context.Background(), dir, "FROM python:3.11\n", ".cog\n*.ckpt\n", "my-model", nil, []string{"FOO=bar"}, false, "plain")
+	require.NoError(t, err)
+
+	readFake := func(name string) string {
+		contents, err := os.ReadFile(filepath.Join(fake, name))
+		require.NoError(t, err)
+		return string(contents)
+	}
+	// The Dockerfile and its ignore file are written to a temporary directory outside the project, which is
+	// removed after the build, and the build context is the project
+	file := strings.TrimSpace(readFake("file"))
+	require.Equal(t, "Dockerfile", filepath.Base(file))
+	require.False(t, strings.HasPrefix(file, dir), file)
+	require.NoDirExists(t, filepath.Dir(file))
+	require.Equal(t, "FROM python:3.11\n", readFake("Dockerfile"))
+	require.Equal(t, ".cog\n*.ckpt\n", readFake("Dockerfile.dockerignore"))
+	resolvedDir, err := filepath.EvalSymlinks(dir)
+	require.NoError(t, err)
+	require.Equal(t, resolvedDir, strings.TrimSpace(readFake("pwd")))
+
+	args := strings.Split(strings.TrimSpace(readFake("args")), "\n")
+	require.Equal(t, []string{"buildx", "build"}, args[:2])
+	require.Subset(t, args, []string{"--build-arg", "FOO=bar", "--file", file, "--tag", "my-model", "--progress", "plain"})
+	require.Equal(t, ".", args[len(args)-1])
+
+	// The project's .dockerignore isn't touched
+	contents, err := os.ReadFile(filepath.Join(dir, ".dockerignore"))
+	require.NoError(t, err)
+	require.Equal(t, projectDockerignore, contents)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	// Without an ignore file, the Dockerfile is passed on stdin, and Docker uses the project's .dockerignore
+	_, err = BuildWithSteps(context.Background(), dir, "FROM python:3.12\n", "", "my-model", nil, nil, false, "plain")
+	require.NoError(t, err)
+	require.Contains(t, readFake("args"), "--file\n-\n")
+	require.Equal(t, "FROM python:3.12\n", readFake("Dockerfile"))
+}
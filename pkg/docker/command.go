@@ -0,0 +1,35 @@
+package docker
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"runtime"
+	"time"
+)
+
+// interruptWaitDelay is how long a docker command has to stop once it's been interrupted, before it's killed
+const interruptWaitDelay = 10 * time.Second
+
+// commandContext returns a docker command that's interrupted when ctx is done, so it stops what it's doing and
+// cleans up, like it does when Ctrl-C is pressed in a terminal
+func commandContext(ctx context.Context, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "docker", args...)
+	cmd.Cancel = func() error {
+		// Windows processes can't be sent an interrupt
+		if runtime.GOOS == "windows" {
+			return cmd.Process.Kill()
+		}
+		return cmd.Process.Signal(os.Interrupt)
+	}
+	cmd.WaitDelay = interruptWaitDelay
+	return cmd
+}
+
+// canceled returns ctx's error if it's done, which is why a command that was interrupted failed, or err otherwise
+func canceled(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
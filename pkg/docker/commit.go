@@ -0,0 +1,103 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// BuilderHasGPU returns whether the current BuildKit builder has an NVIDIA GPU as a device, so RUN --device
+// can give build steps access to it
+func BuilderHasGPU() bool {
+	args := []string{"buildx", "inspect"}
+	if buildOptions.Builder != "" {
+		args = append(args, buildOptions.Builder)
+	}
+	cmd := exec.Command("docker", args...)
+	cmd.Env = os.Environ()
+	console.Debug("$ " + strings.Join(cmd.Args, " "))
+	out, err := cmd.Output()
+	if err != nil {
+		return false
+	}
+	return strings.Contains(string(out), "nvidia.com/gpu")
+}
+
+// RunAndCommit runs command in a container started from image with access to gpus, then replaces image with
+// the container's filesystem. The image keeps its entrypoint and command. If ctx is canceled, the container is
+// stopped and removed, and ctx's error is returned.
+func RunAndCommit(ctx context.Context, image string, command string, gpus string) error {
+	inspect, err := ImageInspect(image)
+	if err != nil {
+		return fmt.Errorf("Failed to inspect %s: %w", image, err)
+	}
+	changes := []string{}
+	for _, change := range []struct {
+		instruction string
+		value       []string
+	}{{"ENTRYPOINT", inspect.Config.Entrypoint}, {"CMD", inspect.Config.Cmd}} {
+		if change.value == nil {
+			continue
+		}
+		data, err := json.Marshal(change.value)
+		if err != nil {
+			return err
+		}
+		changes = append(changes, "--change", change.instruction+" "+string(data))
+	}
+
+	// The container isn't removed when it exits, so it can be committed. Its ID is written to a file,
+	// because stdout is the output of the command.
+	idFile, err := os.CreateTemp("", "cog-run-*.cid")
+	if err != nil {
+		return fmt.Errorf("Failed to create temporary file: %w", err)
+	}
+	idFile.Close()
+	// docker run refuses to overwrite the file
+	os.Remove(idFile.Name())
+	defer os.Remove(idFile.Name())
+
+	args := []string{"run", "--cidfile", idFile.Name(), "--gpus", gpus, "--entrypoint", "/bin/sh"}
+	if inspect.Config.WorkingDir != "" {
+		args = append(args, "--workdir", inspect.Config.WorkingDir)
+	}
+	args = append(args, image, "-c", command)
+	cmd := commandContext(ctx, args...)
+	cmd.Env = os.Environ()
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	console.Debug("$ " + strings.Join(cmd.Args, " "))
+
+	runErr := cmd.Run()
+	containerID, err := os.ReadFile(idFile.Name())
+	if err != nil {
+		return fmt.Errorf("Failed to start container from %s: %w", image, canceled(ctx, runErr))
+	}
+	defer func() {
+		// The container may still be running if the command was interrupted
+		cmd := exec.Command("docker", "rm", "--force", strings.TrimSpace(string(containerID))) //#nosec G204
+		if err := cmd.Run(); err != nil {
+			console.Warnf("Failed to remove container %s: %s", containerID, err)
+		}
+	}()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if runErr != nil {
+		return &BuildError{Command: command, Err: fmt.Errorf("Failed to run '%s' with the GPU: %w", command, runErr)}
+	}
+
+	cmd = commandContext(ctx, append(append([]string{"commit"}, changes...), strings.TrimSpace(string(containerID)), image)...) //#nosec G204
+	cmd.Env = os.Environ()
+	cmd.Stderr = os.Stderr
+	console.Debug("$ " + strings.Join(cmd.Args, " "))
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("Failed to commit the container to %s: %w", image, canceled(ctx, err))
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// ContainerdLoad loads the images in the tar archive read from r, as written by Save, into containerd's namespace,
+// with nerdctl if it's installed, or otherwise ctr, which comes with containerd
+func ContainerdLoad(ctx context.Context, r io.Reader, namespace string) error {
+	var cmd *exec.Cmd
+	if _, err := exec.LookPath("nerdctl"); err == nil {
+		cmd = exec.CommandContext(ctx, "nerdctl", "--namespace", namespace, "load")
+	} else if _, err := exec.LookPath("ctr"); err == nil {
+		cmd = exec.CommandContext(ctx, "ctr", "--namespace", namespace, "images", "import", "-")
+	} else {
+		return fmt.Errorf("Loading the image into containerd needs nerdctl or ctr, but neither is installed")
+	}
+	cmd.Env = os.Environ()
+	cmd.Stdin = r
+	cmd.Stdout = os.Stderr // redirect stdout to stderr - load output is all messaging
+	cmd.Stderr = os.Stderr
+	console.Debug("$ " + strings.Join(cmd.Args, " "))
+	if err := cmd.Run(); err != nil {
+		return canceled(ctx, fmt.Errorf("Failed to load image into containerd: %w", err))
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package docker
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// CopyFromImage copies srcPath in image to destPath on the host, without running the image
+func CopyFromImage(image string, srcPath string, destPath string) error {
+	cmd := exec.Command("docker", "create", image)
+	cmd.Env = os.Environ()
+	cmd.Stderr = os.Stderr
+	console.Debug("$ " + strings.Join(cmd.Args, " "))
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("Failed to create container from %s: %w", image, err)
+	}
+	containerID := strings.TrimSpace(string(out))
+	defer func() {
+		cmd := exec.Command("docker", "rm", containerID) //#nosec G204
+		if err := cmd.Run(); err != nil {
+			console.Warnf("Failed to remove container %s: %s", containerID, err)
+		}
+	}()
+
+	cmd = exec.Command("docker", "cp", containerID+":"+srcPath, destPath) //#nosec G204
+	cmd.Env = os.Environ()
+	cmd.Stderr = os.Stderr
+	console.Debug("$ " + strings.Join(cmd.Args, " "))
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("Failed to copy %s from %s: %w", srcPath, image, err)
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+package docker
+
+import (
+	"io"
+	"os/exec"
+	"strings"
+
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// Exec runs a command in a running container
+func Exec(containerID string, args []string, stdout io.Writer, stderr io.Writer) error {
+	cmd := exec.Command("docker", append([]string{"exec", containerID}, args...)...) //#nosec G204
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	console.Debug("$ " + strings.Join(cmd.Args, " "))
+	return cmd.Run()
+}
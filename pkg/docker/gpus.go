@@ -0,0 +1,225 @@
+package docker
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/docker/go-units"
+
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// GPUDevice is a GPU, or a MIG instance of a GPU, on the host
+type GPUDevice struct {
+	// Index is the device index, e.g. "1" for a GPU or "0:1" for a MIG instance
+	Index string
+	UUID  string
+	Name  string
+}
+
+var ErrNvidiaSMINotFound = errors.New("nvidia-smi not found")
+
+var (
+	gpuLineRegexp = regexp.MustCompile(`^GPU (\d+): (.*) \(UUID: (\S+)\)$`)
+	migLineRegexp = regexp.MustCompile(`^\s+MIG (.*) Device\s+(\d+): \(UUID: (\S+)\)$`)
+)
+
+// ListGPUDevices returns the GPUs and MIG instances on the host, as listed by nvidia-smi
+func ListGPUDevices() ([]GPUDevice, error) {
+	if _, err := exec.LookPath("nvidia-smi"); err != nil {
+		return nil, ErrNvidiaSMINotFound
+	}
+	cmd := exec.Command("nvidia-smi", "--list-gpus")
+	console.Debug("$ " + strings.Join(cmd.Args, " "))
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list GPUs: %w", err)
+	}
+	return parseNvidiaSMIList(out), nil
+}
+
+func parseNvidiaSMIList(out []byte) []GPUDevice {
+	devices := []GPUDevice{}
+	gpuIndex := ""
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if match := gpuLineRegexp.FindStringSubmatch(line); match != nil {
+			gpuIndex = match[1]
+			devices = append(devices, GPUDevice{Index: gpuIndex, Name: match[2], UUID: match[3]})
+		} else if match := migLineRegexp.FindStringSubmatch(line); match != nil && gpuIndex != "" {
+			devices = append(devices, GPUDevice{Index: gpuIndex + ":" + match[2], Name: "MIG " + strings.TrimSpace(match[1]), UUID: match[3]})
+		}
+	}
+	return devices
+}
+
+// GPURequest is the value of `docker run --gpus`, split into its parts
+type GPURequest struct {
+	All     bool
+	Count   int
+	Devices []string
+	// Options are any other options, like capabilities=utility
+	Options []string
+}
+
+// ParseGPURequest parses a value for `docker run --gpus`, e.g. "all", "2", "device=1" or "device=0,1"
+func ParseGPURequest(gpus string) (GPURequest, error) {
+	req := GPURequest{}
+	gpus = strings.Trim(strings.TrimSpace(gpus), `"'`)
+	if gpus == "" {
+		return req, nil
+	}
+	if gpus == "all" {
+		req.All = true
+		return req, nil
+	}
+	if count, err := strconv.Atoi(gpus); err == nil {
+		if count < 1 {
+			return req, fmt.Errorf("Invalid GPU count %d, it must be at least 1", count)
+		}
+		req.Count = count
+		return req, nil
+	}
+
+	inDevices := false
+	for _, field := range strings.Split(gpus, ",") {
+		field = strings.TrimSpace(field)
+		key, value, hasValue := strings.Cut(field, "=")
+		switch {
+		case hasValue && key == "device":
+			inDevices = true
+			req.Devices = append(req.Devices, value)
+		case hasValue && key == "count":
+			inDevices = false
+			if value == "all" {
+				req.All = true
+				continue
+			}
+			count, err := strconv.Atoi(value)
+			if err != nil || count < 1 {
+				return req, fmt.Errorf("Invalid GPU count '%s'", value)
+			}
+			req.Count = count
+		case hasValue:
+			inDevices = false
+			req.Options = append(req.Options, field)
+		case inDevices:
+			// device=0,1 is a list of devices, not two options
+			req.Devices = append(req.Devices, field)
+		default:
+			return req, fmt.Errorf("Invalid GPU option '%s'", field)
+		}
+	}
+	return req, nil
+}
+
+// String returns the request in the form `docker run --gpus` expects. Lists of devices
+// are quoted, because otherwise docker reads the commas as separating options.
+func (r GPURequest) String() string {
+	if r.All && len(r.Options) == 0 {
+		return "all"
+	}
+	if r.Count > 0 && len(r.Devices) == 0 && len(r.Options) == 0 {
+		return strconv.Itoa(r.Count)
+	}
+	fields := []string{}
+	if r.All {
+		fields = append(fields, "count=all")
+	} else if r.Count > 0 {
+		fields = append(fields, fmt.Sprintf("count=%d", r.Count))
+	}
+	if len(r.Devices) > 0 {
+		device := "device=" + strings.Join(r.Devices, ",")
+		if len(r.Devices) > 1 {
+			device = `"` + device + `"`
+		}
+		fields = append(fields, device)
+	}
+	fields = append(fields, r.Options...)
+	return strings.Join(fields, ",")
+}
+
+// Validate checks the requested GPUs exist in devices
+func (r GPURequest) Validate(devices []GPUDevice) error {
+	gpuCount := 0
+	for _, device := range devices {
+		if !strings.Contains(device.Index, ":") {
+			gpuCount++
+		}
+	}
+	if r.Count > gpuCount {
+		return fmt.Errorf("%d GPUs were requested, but this machine only has %d", r.Count, gpuCount)
+	}
+
+	for _, requested := range r.Devices {
+		found := false
+		for _, device := range devices {
+			if requested == device.Index || requested == device.UUID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			available := []string{}
+			for _, device := range devices {
+				available = append(available, fmt.Sprintf("  %s: %s (%s)", device.Index, device.Name, device.UUID))
+			}
+			if len(available) == 0 {
+				return fmt.Errorf("GPU device '%s' was requested, but this machine has no GPUs", requested)
+			}
+			return fmt.Errorf("GPU device '%s' was requested, but it doesn't exist. The GPUs on this machine are:\n%s", requested, strings.Join(available, "\n"))
+		}
+	}
+	return nil
+}
+
+// ContainerGPUMemory returns how much GPU memory the processes in a container are using, in bytes, as listed by
+// nvidia-smi
+func ContainerGPUMemory(containerID string) (int64, error) {
+	if _, err := exec.LookPath("nvidia-smi"); err != nil {
+		return 0, ErrNvidiaSMINotFound
+	}
+	// docker top lists the host's PIDs of the processes, which are the PIDs nvidia-smi lists
+	cmd := exec.Command("docker", "top", containerID, "-eo", "pid")
+	console.Debug("$ " + strings.Join(cmd.Args, " "))
+	out, err := cmd.Output()
+	if err != nil {
+		return 0, fmt.Errorf("Failed to list the processes in container %s: %w", containerID, err)
+	}
+	pids := map[string]bool{}
+	for _, field := range strings.Fields(string(out)) {
+		pids[field] = true
+	}
+
+	cmd = exec.Command("nvidia-smi", "--query-compute-apps=pid,used_memory", "--format=csv,noheader,nounits")
+	console.Debug("$ " + strings.Join(cmd.Args, " "))
+	out, err = cmd.Output()
+	if err != nil {
+		return 0, fmt.Errorf("Failed to get GPU memory: %w", err)
+	}
+	return parseNvidiaSMIApps(out, pids), nil
+}
+
+// parseNvidiaSMIApps returns the memory, in bytes, used by the processes in pids, from nvidia-smi's list of the
+// PIDs of processes using GPUs and the memory they use in MiB
+func parseNvidiaSMIApps(out []byte, pids map[string]bool) int64 {
+	var total int64
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		pid, memory, ok := strings.Cut(scanner.Text(), ",")
+		if !ok || !pids[strings.TrimSpace(pid)] {
+			continue
+		}
+		if mib, err := strconv.ParseInt(strings.TrimSpace(memory), 10, 64); err == nil {
+			total += mib * units.MiB
+		}
+	}
+	return total
+}
@@ -0,0 +1,73 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const nvidiaSMIList = `GPU 0: NVIDIA A100-SXM4-40GB (UUID: GPU-5d5ba0d6-d33d-2b2c-524d-9e3d8d2b8a77)
+  MIG 1g.5gb      Device  0: (UUID: MIG-c6d4f1ef-42e4-5de3-91c7-45d71c87eb3f)
+  MIG 1g.5gb      Device  1: (UUID: MIG-cba663e8-9bed-5b25-b243-5985ef7c9beb)
+GPU 1: NVIDIA GeForce RTX 3090 (UUID: GPU-8e0e3a3f-5c1d-4e4c-2c3b-9f2a7d3c1b2a)
+`
+
+func TestParseNvidiaSMIList(t *testing.T) {
+	devices := parseNvidiaSMIList([]byte(nvidiaSMIList))
+	require.Equal(t, []GPUDevice{
+		{Index: "0", Name: "NVIDIA A100-SXM4-40GB", UUID: "GPU-5d5ba0d6-d33d-2b2c-524d-9e3d8d2b8a77"},
+		{Index: "0:0", Name: "MIG 1g.5gb", UUID: "MIG-c6d4f1ef-42e4-5de3-91c7-45d71c87eb3f"},
+		{Index: "0:1", Name: "MIG 1g.5gb", UUID: "MIG-cba663e8-9bed-5b25-b243-5985ef7c9beb"},
+		{Index: "1", Name: "NVIDIA GeForce RTX 3090", UUID: "GPU-8e0e3a3f-5c1d-4e4c-2c3b-9f2a7d3c1b2a"},
+	}, devices)
+}
+
+func TestParseNvidiaSMIApps(t *testing.T) {
+	out := []byte("1234, 2048\n5678, 512\n91011, 1024\n")
+	require.Equal(t, int64(2560*1024*1024), parseNvidiaSMIApps(out, map[string]bool{"1234": true, "5678": true}))
+	require.Equal(t, int64(0), parseNvidiaSMIApps(out, map[string]bool{"42": true}))
+}
+
+func TestParseGPURequest(t *testing.T) {
+	for _, tt := range []struct {
+		flag     string
+		expected GPURequest
+		str      string
+	}{
+		{"all", GPURequest{All: true}, "all"},
+		{"2", GPURequest{Count: 2}, "2"},
+		{"device=1", GPURequest{Devices: []string{"1"}}, "device=1"},
+		{"device=0,1", GPURequest{Devices: []string{"0", "1"}}, `"device=0,1"`},
+		{`"device=0,1"`, GPURequest{Devices: []string{"0", "1"}}, `"device=0,1"`},
+		{"device=MIG-c6d4f1ef-42e4-5de3-91c7-45d71c87eb3f", GPURequest{Devices: []string{"MIG-c6d4f1ef-42e4-5de3-91c7-45d71c87eb3f"}}, "device=MIG-c6d4f1ef-42e4-5de3-91c7-45d71c87eb3f"},
+		{"count=2,capabilities=utility", GPURequest{Count: 2, Options: []string{"capabilities=utility"}}, "count=2,capabilities=utility"},
+	} {
+		req, err := ParseGPURequest(tt.flag)
+		require.NoError(t, err, tt.flag)
+		require.Equal(t, tt.expected, req, tt.flag)
+		require.Equal(t, tt.str, req.String(), tt.flag)
+	}
+
+	_, err := ParseGPURequest("0")
+	require.Error(t, err)
+	_, err = ParseGPURequest("nonsense")
+	require.Error(t, err)
+}
+
+func TestValidateGPURequest(t *testing.T) {
+	devices := parseNvidiaSMIList([]byte(nvidiaSMIList))
+
+	for _, flag := range []string{"all", "2", "device=1", "device=0:1", "device=0,1", "device=MIG-c6d4f1ef-42e4-5de3-91c7-45d71c87eb3f"} {
+		req, err := ParseGPURequest(flag)
+		require.NoError(t, err)
+		require.NoError(t, req.Validate(devices), flag)
+	}
+
+	req, err := ParseGPURequest("3")
+	require.NoError(t, err)
+	require.ErrorContains(t, req.Validate(devices), "only has 2")
+
+	req, err = ParseGPURequest("device=2")
+	require.NoError(t, err)
+	require.ErrorContains(t, req.Validate(devices), "GPU device '2' was requested, but it doesn't exist")
+}
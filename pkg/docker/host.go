@@ -0,0 +1,95 @@
+package docker
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// Host is what Cog knows about the machine it runs Docker on
+type Host struct {
+	GOOS string
+	// WSL is whether Cog is running in a WSL distro on Windows
+	WSL bool
+	// DockerFound is whether the docker command is on the PATH
+	DockerFound bool
+	// OSType is the kind of containers the Docker daemon runs, "linux" or "windows", or "" if it couldn't be reached
+	OSType string
+	// KernelVersion is the kernel version of the Docker daemon, which has "microsoft" in it for the WSL 2 backend
+	KernelVersion string
+}
+
+// DetectHost looks at the machine Cog is running on. Docker is only asked about itself on Windows and in WSL,
+// where Docker Desktop can be set up in ways that don't work with Cog.
+func DetectHost() Host {
+	host := Host{GOOS: runtime.GOOS, WSL: IsWSL()}
+	if _, err := exec.LookPath("docker"); err == nil {
+		host.DockerFound = true
+	}
+	if host.DockerFound && (host.GOOS == "windows" || host.WSL) {
+		cmd := exec.Command("docker", "info", "--format", "{{.OSType}}|{{.KernelVersion}}")
+		console.Debug("$ " + strings.Join(cmd.Args, " "))
+		if out, err := cmd.Output(); err == nil {
+			host.OSType, host.KernelVersion, _ = strings.Cut(strings.TrimSpace(string(out)), "|")
+		}
+	}
+	return host
+}
+
+// IsWSL returns whether Cog is running in a WSL distro
+func IsWSL() bool {
+	if runtime.GOOS != "linux" {
+		return false
+	}
+	osRelease, err := os.ReadFile("/proc/sys/kernel/osrelease")
+	if err != nil {
+		return false
+	}
+	return strings.Contains(strings.ToLower(string(osRelease)), "microsoft")
+}
+
+// CheckHost checks that Docker on this machine can build the project in dir, so Windows users get told how to
+// fix Docker Desktop instead of getting an obscure error from the build
+func CheckHost(dir string, gpu bool) error {
+	warnings, err := DetectHost().Check(dir, gpu)
+	for _, warning := range warnings {
+		console.Warn(warning)
+	}
+	return err
+}
+
+// Check returns warnings about things that will make building the project in dir slow or broken, and an error if
+// it can't be built at all
+func (h Host) Check(dir string, gpu bool) ([]string, error) {
+	if h.GOOS != "windows" && !h.WSL {
+		return nil, nil
+	}
+	if !h.DockerFound {
+		if h.WSL {
+			return nil, fmt.Errorf("The docker command wasn't found in this WSL distro. In Docker Desktop, turn on the integration for it in Settings > Resources > WSL integration")
+		}
+		return nil, fmt.Errorf("The docker command wasn't found. Install Docker Desktop with the WSL 2 based engine: https://docs.docker.com/desktop/install/windows-install/")
+	}
+	switch h.OSType {
+	case "":
+		return nil, fmt.Errorf("Failed to connect to Docker. Make sure Docker Desktop is running, with the WSL 2 based engine")
+	case "windows":
+		return nil, fmt.Errorf("Docker is running Windows containers, but Cog needs Linux containers. Right-click Docker Desktop in the system tray and choose 'Switch to Linux containers...'")
+	}
+
+	warnings := []string{}
+	if gpu && !strings.Contains(strings.ToLower(h.KernelVersion), "microsoft") {
+		warnings = append(warnings, "GPUs are only available to Docker Desktop with the WSL 2 based engine. Turn it on in Settings > General")
+	}
+	if h.WSL {
+		if abs, err := filepath.Abs(dir); err == nil && strings.HasPrefix(abs, "/mnt/") {
+			warnings = append(warnings, fmt.Sprintf("%s is on the Windows filesystem, which is slow to build from in WSL. Move it to the Linux filesystem, e.g. your home directory, for faster builds", abs))
+		}
+	}
+	return warnings, nil
+}
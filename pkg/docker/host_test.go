@@ -0,0 +1,39 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostCheck(t *testing.T) {
+	warnings, err := Host{GOOS: "linux"}.Check("/mnt/c/model", true)
+	require.NoError(t, err)
+	require.Empty(t, warnings)
+
+	_, err = Host{GOOS: "windows"}.Check(`C:\model`, false)
+	require.ErrorContains(t, err, "Install Docker Desktop")
+
+	_, err = Host{GOOS: "linux", WSL: true}.Check("/home/user/model", false)
+	require.ErrorContains(t, err, "WSL integration")
+
+	_, err = Host{GOOS: "windows", DockerFound: true}.Check(`C:\model`, false)
+	require.ErrorContains(t, err, "Make sure Docker Desktop is running")
+
+	_, err = Host{GOOS: "windows", DockerFound: true, OSType: "windows"}.Check(`C:\model`, false)
+	require.ErrorContains(t, err, "Switch to Linux containers")
+
+	warnings, err = Host{GOOS: "windows", DockerFound: true, OSType: "linux", KernelVersion: "5.15.133.1-microsoft-standard-WSL2"}.Check(`C:\model`, true)
+	require.NoError(t, err)
+	require.Empty(t, warnings)
+
+	warnings, err = Host{GOOS: "windows", DockerFound: true, OSType: "linux", KernelVersion: "5.10.25-linuxkit"}.Check(`C:\model`, true)
+	require.NoError(t, err)
+	require.Len(t, warnings, 1)
+	require.Contains(t, warnings[0], "WSL 2 based engine")
+
+	warnings, err = Host{GOOS: "linux", WSL: true, DockerFound: true, OSType: "linux", KernelVersion: "5.15.133.1-microsoft-standard-WSL2"}.Check("/mnt/c/model", false)
+	require.NoError(t, err)
+	require.Len(t, warnings, 1)
+	require.Contains(t, warnings[0], "Windows filesystem")
+}
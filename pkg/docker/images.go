@@ -0,0 +1,79 @@
+package docker
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/util/slices"
+)
+
+// ListImages returns the names of local images that have all of the given labels, in the form repository:tag.
+// An empty label value matches any value. Images without a name are left out.
+func ListImages(labels map[string]string) ([]string, error) {
+	args := []string{"images", "--format", "{{.Repository}}:{{.Tag}}"}
+	for key, value := range labels {
+		if value == "" {
+			args = append(args, "--filter", "label="+key)
+		} else {
+			args = append(args, "--filter", "label="+key+"="+value)
+		}
+	}
+	cmd := exec.Command("docker", args...)
+	cmd.Env = os.Environ()
+	console.Debug("$ " + strings.Join(cmd.Args, " "))
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	images := []string{}
+	for _, image := range strings.Fields(string(out)) {
+		if strings.Contains(image, "<none>") {
+			continue
+		}
+		images = append(images, strings.TrimSuffix(image, ":latest"))
+	}
+	return images, nil
+}
+
+// RemoveImage removes the name image from Docker. The layers it shares with other images are kept.
+func RemoveImage(image string) error {
+	cmd := exec.Command("docker", "image", "rm", image)
+	cmd.Env = os.Environ()
+	console.Debug("$ " + strings.Join(cmd.Args, " "))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("Failed to remove %s: %w\n%s", image, err, out)
+	}
+	return nil
+}
+
+// ListDanglingImages returns the IDs of local images that have all of the given labels, but no name, because the
+// name was given to a newer build
+func ListDanglingImages(labels map[string]string) ([]string, error) {
+	args := []string{"images", "--quiet", "--no-trunc", "--filter", "dangling=true"}
+	for key, value := range labels {
+		if value == "" {
+			args = append(args, "--filter", "label="+key)
+		} else {
+			args = append(args, "--filter", "label="+key+"="+value)
+		}
+	}
+	cmd := exec.Command("docker", args...)
+	cmd.Env = os.Environ()
+	console.Debug("$ " + strings.Join(cmd.Args, " "))
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for _, id := range strings.Fields(string(out)) {
+		if !slices.ContainsString(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,32 @@
+package docker
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// ListContainers returns the IDs of running containers that have all of the given labels.
+// An empty label value matches any value.
+func ListContainers(labels map[string]string) ([]string, error) {
+	args := []string{"ps", "--quiet", "--no-trunc"}
+	for key, value := range labels {
+		if value == "" {
+			args = append(args, "--filter", "label="+key)
+		} else {
+			args = append(args, "--filter", "label="+key+"="+value)
+		}
+	}
+	cmd := exec.Command("docker", args...)
+	cmd.Env = os.Environ()
+	cmd.Stderr = os.Stderr
+	console.Debug("$ " + strings.Join(cmd.Args, " "))
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(out)), nil
+}
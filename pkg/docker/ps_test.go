@@ -0,0 +1,30 @@
+package docker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestListContainers(t *testing.T) {
+	dir := fakeDocker(t, "echo \"$@\" > \"$(dirname \"$0\")/args\"\necho abc123\necho def456\n")
+	argsPath := filepath.Join(dir, "args")
+
+	for _, tc := range []struct {
+		labels map[string]string
+		args   string
+	}{
+		// An empty value matches containers with the label, whatever its value
+		{map[string]string{"run.cog.runner.project": ""}, "ps --quiet --no-trunc --filter label=run.cog.runner.project\n"},
+		{map[string]string{"run.cog.runner.project": "/src"}, "ps --quiet --no-trunc --filter label=run.cog.runner.project=/src\n"},
+	} {
+		ids, err := ListContainers(tc.labels)
+		require.NoError(t, err)
+		require.Equal(t, []string{"abc123", "def456"}, ids)
+		args, err := os.ReadFile(argsPath)
+		require.NoError(t, err)
+		require.Equal(t, tc.args, string(args))
+	}
+}
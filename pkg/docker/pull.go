@@ -10,7 +10,7 @@ import (
 
 func Pull(image string) error {
 	cmd := exec.Command("docker", "pull", image)
-	cmd.Stdout = os.Stdout
+	cmd.Stdout = os.Stderr // redirect stdout to stderr - pull output is all messaging, and stdout may be piped
 	cmd.Stderr = os.Stderr
 
 	console.Debug("$ " + strings.Join(cmd.Args, " "))
@@ -1,19 +1,50 @@
 package docker
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"os"
-	"os/exec"
 	"strings"
 
+	"github.com/replicate/cog/pkg/errors"
 	"github.com/replicate/cog/pkg/util/console"
 )
 
-func Push(image string) error {
-	cmd := exec.Command(
-		"docker", "push", image)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+// pushOutputTailSize is how much of the end of docker push's output is kept to tell why it failed
+const pushOutputTailSize = 4096
+
+// pushAuthErrors are what docker push says when the registry doesn't let it push, because the user isn't logged in
+// or can't push to the repository
+var pushAuthErrors = []string{
+	"unauthorized",
+	"authentication required",
+	"denied",
+	"access forbidden",
+	"insufficient_scope",
+}
+
+// Push pushes image to its registry. If ctx is canceled, the push is interrupted, and ctx's error is returned.
+func Push(ctx context.Context, image string) error {
+	output := &tailBuffer{size: pushOutputTailSize}
+	cmd := commandContext(ctx, "push", image)
+	cmd.Stdout = os.Stderr // redirect stdout to stderr - push output is all messaging
+	cmd.Stderr = io.MultiWriter(os.Stderr, output)
 
 	console.Debug("$ " + strings.Join(cmd.Args, " "))
-	return cmd.Run()
+	err := canceled(ctx, cmd.Run())
+	if err != nil && ctx.Err() == nil && isPushAuthError(output.String()) {
+		return errors.PushAuthFailed(fmt.Errorf("The registry didn't let you push %s. Check you're logged in with `cog login` and can push to it: %w", image, err))
+	}
+	return err
+}
+
+func isPushAuthError(output string) bool {
+	output = strings.ToLower(output)
+	for _, msg := range pushAuthErrors {
+		if strings.Contains(output, msg) {
+			return true
+		}
+	}
+	return false
 }
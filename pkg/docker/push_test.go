@@ -0,0 +1,13 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsPushAuthError(t *testing.T) {
+	require.True(t, isPushAuthError("unauthorized: authentication required"))
+	require.True(t, isPushAuthError("denied: requested access to the resource is denied"))
+	require.False(t, isPushAuthError("received unexpected HTTP status: 500 Internal Server Error"))
+}
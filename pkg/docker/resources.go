@@ -0,0 +1,97 @@
+package docker
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/docker/go-units"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/util/files"
+)
+
+// HostResources are the resources containers get on the Docker host. Anything that isn't known is 0.
+type HostResources struct {
+	CPUs        int
+	MemoryBytes int64
+	// GPUMemoryBytes is the memory of the GPU with the most memory
+	GPUMemoryBytes int64
+	// DiskBytes is the free space in Docker's data root, where containers write to
+	DiskBytes int64
+	// DataRoot is the directory Docker keeps images and containers in
+	DataRoot string
+}
+
+// DetectHostResources asks Docker how many CPUs and how much memory it has, which on macOS and Windows is what's
+// given to Docker Desktop's VM. GPU memory is read with nvidia-smi, and free disk space only if Docker's data root
+// is on this machine.
+func DetectHostResources() (HostResources, error) {
+	resources := HostResources{}
+	cmd := exec.Command("docker", "info", "--format", "{{.NCPU}}|{{.MemTotal}}|{{.DockerRootDir}}")
+	console.Debug("$ " + strings.Join(cmd.Args, " "))
+	out, err := cmd.Output()
+	if err != nil {
+		return resources, fmt.Errorf("Failed to get the resources Docker has: %w", err)
+	}
+	fields := strings.SplitN(strings.TrimSpace(string(out)), "|", 3)
+	if len(fields) != 3 {
+		return resources, fmt.Errorf("Failed to parse the resources Docker has from %q", out)
+	}
+	resources.CPUs, _ = strconv.Atoi(fields[0])
+	resources.MemoryBytes, _ = strconv.ParseInt(fields[1], 10, 64)
+	resources.DataRoot = fields[2]
+
+	if free, err := files.FreeSpace(resources.DataRoot); err == nil {
+		resources.DiskBytes = free
+	} else {
+		console.Debugf("Failed to check the free space in %s, which may be in a VM: %s", resources.DataRoot, err)
+	}
+
+	if _, err := exec.LookPath("nvidia-smi"); err == nil {
+		cmd := exec.Command("nvidia-smi", "--query-gpu=memory.total", "--format=csv,noheader,nounits")
+		console.Debug("$ " + strings.Join(cmd.Args, " "))
+		if out, err := cmd.Output(); err == nil {
+			resources.GPUMemoryBytes = parseNvidiaSMIMemory(out)
+		} else {
+			console.Debugf("Failed to get GPU memory: %s", err)
+		}
+	}
+	return resources, nil
+}
+
+// parseNvidiaSMIMemory returns the most memory of any GPU, in bytes, from nvidia-smi's list of their memory in MiB
+func parseNvidiaSMIMemory(out []byte) int64 {
+	var most int64
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		mib, err := strconv.ParseInt(strings.TrimSpace(scanner.Text()), 10, 64)
+		if err == nil && mib*units.MiB > most {
+			most = mib * units.MiB
+		}
+	}
+	return most
+}
+
+// Check returns what the model needs that the host doesn't have. Resources the host's amount of isn't known aren't
+// checked. GPU memory is only checked if gpu is set, because the model runs on the CPU otherwise.
+func (h HostResources) Check(req config.ResourceRequirements, gpu bool) []string {
+	problems := []string{}
+	if req.CPU > 0 && h.CPUs > 0 && req.CPU > float64(h.CPUs) {
+		problems = append(problems, fmt.Sprintf("%s CPUs, but Docker has %d", strconv.FormatFloat(req.CPU, 'f', -1, 64), h.CPUs))
+	}
+	if req.MemoryBytes > 0 && h.MemoryBytes > 0 && req.MemoryBytes > h.MemoryBytes {
+		problems = append(problems, fmt.Sprintf("%s of memory, but Docker has %s", units.BytesSize(float64(req.MemoryBytes)), units.BytesSize(float64(h.MemoryBytes))))
+	}
+	if gpu && req.GPUMemoryBytes > 0 && h.GPUMemoryBytes > 0 && req.GPUMemoryBytes > h.GPUMemoryBytes {
+		problems = append(problems, fmt.Sprintf("a GPU with %s of memory, but the biggest GPU has %s", units.BytesSize(float64(req.GPUMemoryBytes)), units.BytesSize(float64(h.GPUMemoryBytes))))
+	}
+	if req.DiskBytes > 0 && h.DiskBytes > 0 && req.DiskBytes > h.DiskBytes {
+		problems = append(problems, fmt.Sprintf("%s of free disk space, but %s only has %s", units.BytesSize(float64(req.DiskBytes)), h.DataRoot, units.BytesSize(float64(h.DiskBytes))))
+	}
+	return problems
+}
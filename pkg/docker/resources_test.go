@@ -0,0 +1,32 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/docker/go-units"
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+func TestParseNvidiaSMIMemory(t *testing.T) {
+	require.Equal(t, int64(81559*units.MiB), parseNvidiaSMIMemory([]byte("23028\n81559\n")))
+	require.Equal(t, int64(0), parseNvidiaSMIMemory([]byte("[N/A]\n")))
+}
+
+func TestHostResourcesCheck(t *testing.T) {
+	host := HostResources{CPUs: 8, MemoryBytes: 16 * units.GiB, GPUMemoryBytes: 23028 * units.MiB, DiskBytes: 20 * units.GiB, DataRoot: "/var/lib/docker"}
+	require.Empty(t, host.Check(config.ResourceRequirements{CPU: 8, MemoryBytes: 16 * units.GiB, GPUMemoryBytes: 22 * units.GiB, DiskBytes: 20 * units.GiB}, true))
+
+	problems := host.Check(config.ResourceRequirements{CPU: 8.5, MemoryBytes: 32 * units.GiB, GPUMemoryBytes: 40 * units.GiB, DiskBytes: 100 * units.GiB}, true)
+	require.Equal(t, []string{
+		"8.5 CPUs, but Docker has 8",
+		"32GiB of memory, but Docker has 16GiB",
+		"a GPU with 40GiB of memory, but the biggest GPU has 22.49GiB",
+		"100GiB of free disk space, but /var/lib/docker only has 20GiB",
+	}, problems)
+
+	// GPU memory isn't needed if the model runs without a GPU, and what isn't known about the host isn't checked
+	require.Len(t, host.Check(config.ResourceRequirements{GPUMemoryBytes: 40 * units.GiB}, false), 0)
+	require.Empty(t, HostResources{}.Check(config.ResourceRequirements{CPU: 64, MemoryBytes: units.TiB, DiskBytes: units.TiB}, true))
+}
@@ -10,6 +10,7 @@ import (
 	"os"
 	"os/exec"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -30,10 +31,13 @@ type Volume struct {
 }
 
 type RunOptions struct {
-	Args    []string
+	Args []string
+	// CapAdd are Linux capabilities to add to the container, e.g. SYS_PTRACE
+	CapAdd  []string
 	Env     []string
 	GPUs    string
 	Image   string
+	Labels  map[string]string
 	Ports   []Port
 	Volumes []Volume
 	Workdir string
@@ -58,6 +62,9 @@ func generateDockerArgs(options internalRunOptions) []string {
 		// TODO: relative to pwd and cog.yaml
 	}
 
+	for _, capability := range options.CapAdd {
+		dockerArgs = append(dockerArgs, "--cap-add", capability)
+	}
 	if options.Detach {
 		dockerArgs = append(dockerArgs, "--detach")
 	}
@@ -70,6 +77,14 @@ func generateDockerArgs(options internalRunOptions) []string {
 	if options.Interactive {
 		dockerArgs = append(dockerArgs, "--interactive")
 	}
+	labelKeys := make([]string, 0, len(options.Labels))
+	for key := range options.Labels {
+		labelKeys = append(labelKeys, key)
+	}
+	sort.Strings(labelKeys)
+	for _, key := range labelKeys {
+		dockerArgs = append(dockerArgs, "--label", key+"="+options.Labels[key])
+	}
 	for _, port := range options.Ports {
 		dockerArgs = append(dockerArgs, "--publish", fmt.Sprintf("%d:%d", port.HostPort, port.ContainerPort))
 	}
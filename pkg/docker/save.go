@@ -0,0 +1,50 @@
+package docker
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// Save writes image to path as a tar archive, in the format `docker load` reads
+func Save(image string, path string) error {
+	cmd := exec.Command("docker", "save", "--output", path, image)
+	cmd.Env = os.Environ()
+	cmd.Stderr = os.Stderr
+	console.Debug("$ " + strings.Join(cmd.Args, " "))
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("Failed to save %s: %w", image, err)
+	}
+	return nil
+}
+
+// Load loads the images in the tar archive read from r, as written by Save
+func Load(r io.Reader) error {
+	cmd := exec.Command("docker", "load")
+	cmd.Env = os.Environ()
+	cmd.Stdin = r
+	cmd.Stdout = os.Stderr // redirect stdout to stderr - load output is all messaging
+	cmd.Stderr = os.Stderr
+	console.Debug("$ " + strings.Join(cmd.Args, " "))
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("Failed to load image: %w", err)
+	}
+	return nil
+}
+
+// SaveTo writes image to w as a tar archive, in the format `docker load` reads
+func SaveTo(image string, w io.Writer) error {
+	cmd := exec.Command("docker", "save", image)
+	cmd.Env = os.Environ()
+	cmd.Stdout = w
+	cmd.Stderr = os.Stderr
+	console.Debug("$ " + strings.Join(cmd.Args, " "))
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("Failed to save %s: %w", image, err)
+	}
+	return nil
+}
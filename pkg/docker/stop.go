@@ -1,12 +1,19 @@
 package docker
 
 import (
+	"fmt"
 	"os"
 	"os/exec"
+	"time"
 )
 
 func Stop(id string) error {
-	cmd := exec.Command("docker", "container", "stop", "--time", "3", id)
+	return StopWithTimeout(id, 3*time.Second)
+}
+
+// StopWithTimeout sends the container SIGTERM, and SIGKILL if it is still running after timeout
+func StopWithTimeout(id string, timeout time.Duration) error {
+	cmd := exec.Command("docker", "container", "stop", "--time", fmt.Sprintf("%d", int(timeout.Seconds())), id) //#nosec G204
 	cmd.Env = os.Environ()
 	cmd.Stderr = os.Stderr
 
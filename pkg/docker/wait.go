@@ -0,0 +1,24 @@
+package docker
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// ContainerWait waits for a container to exit, and returns its exit code
+func ContainerWait(id string) (int, error) {
+	cmd := exec.Command("docker", "container", "wait", id) //#nosec G204
+	cmd.Env = os.Environ()
+	out, err := cmd.Output()
+	if err != nil {
+		return 0, fmt.Errorf("Failed to wait for container %s: %w", id, err)
+	}
+	code, err := strconv.Atoi(strings.TrimSpace(string(out)))
+	if err != nil {
+		return 0, fmt.Errorf("Failed to parse the exit code of container %s from %q", id, out)
+	}
+	return code, nil
+}
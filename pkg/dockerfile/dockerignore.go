@@ -0,0 +1,129 @@
+package dockerfile
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+// DockerignoreMarker is a line in a .dockerignore that marks where the lines Cog generates go. Lines after it
+// come after Cog's, so they can include files that Cog leaves out with !. Without it, Cog's lines go at the end.
+const DockerignoreMarker = "# cog:generated"
+
+// MergeDockerignore merges the lines Cog generates into the contents of the project's .dockerignore, leaving
+// out lines that are already in it
+func MergeDockerignore(existing string, generated string) string {
+	if strings.TrimSpace(existing) == "" {
+		return generated
+	}
+	seen := map[string]bool{}
+	for _, line := range strings.Split(existing, "\n") {
+		seen[strings.TrimSpace(line)] = true
+	}
+	lines := []string{}
+	for _, line := range strings.Split(strings.TrimRight(generated, "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || !seen[trimmed] {
+			lines = append(lines, line)
+			seen[trimmed] = true
+		}
+	}
+	merged := strings.Join(lines, "\n") + "\n"
+
+	existingLines := strings.Split(existing, "\n")
+	for i, line := range existingLines {
+		if strings.TrimSpace(line) == DockerignoreMarker {
+			before := strings.Join(existingLines[:i+1], "\n")
+			after := strings.Join(existingLines[i+1:], "\n")
+			return before + "\n" + merged + after
+		}
+	}
+	return strings.TrimRight(existing, "\n") + "\n" + merged
+}
+
+// ReadDockerignore returns the contents of the project's .dockerignore, or "" if it doesn't have one
+func ReadDockerignore(dir string) (string, error) {
+	contents, err := os.ReadFile(filepath.Join(dir, ".dockerignore"))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("Failed to read .dockerignore: %w", err)
+	}
+	return string(contents), nil
+}
+
+// ignoreLines returns the .dockerignore lines for the globs in build.ignore
+func (g *Generator) ignoreLines() string {
+	contents := ""
+	for _, pattern := range g.Config.Build.Ignore {
+		contents += pattern + "\n"
+	}
+	return contents
+}
+
+// Dockerignore returns the .dockerignore lines for the image generated by
+// GenerateDockerfileWithoutSeparateWeights, or "" if there aren't any
+func (g *Generator) Dockerignore() string {
+	return g.sourceDockerignore + g.ignoreLines()
+}
+
+type dockerignorePattern struct {
+	re        *regexp.Regexp
+	exception bool
+}
+
+// DockerignoreMatcher matches paths against the lines of a .dockerignore, to find which files are sent to Docker
+type DockerignoreMatcher struct {
+	patterns []dockerignorePattern
+}
+
+// NewDockerignoreMatcher parses the contents of a .dockerignore
+func NewDockerignoreMatcher(contents string) (*DockerignoreMatcher, error) {
+	m := &DockerignoreMatcher{}
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		exception := strings.HasPrefix(line, "!")
+		re, err := config.GlobRegexp(strings.TrimPrefix(line, "!"))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid line in .dockerignore: %w", err)
+		}
+		m.patterns = append(m.patterns, dockerignorePattern{re: re, exception: exception})
+	}
+	return m, scanner.Err()
+}
+
+// Excludes returns whether the path p, relative to the build context, is left out of it. Like Docker, the last
+// line that matches p, or a directory it is in, decides.
+func (m *DockerignoreMatcher) Excludes(p string) bool {
+	p = filepath.ToSlash(filepath.Clean(p))
+	excluded := false
+	for _, pattern := range m.patterns {
+		for candidate := p; candidate != "." && candidate != "/"; candidate = filepath.ToSlash(filepath.Dir(candidate)) {
+			if pattern.re.MatchString(candidate) {
+				excluded = !pattern.exception
+				break
+			}
+		}
+	}
+	return excluded
+}
+
+// HasExceptions returns whether any lines start with !, so files in excluded directories can still be sent
+func (m *DockerignoreMatcher) HasExceptions() bool {
+	for _, pattern := range m.patterns {
+		if pattern.exception {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package dockerfile
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeDockerignore(t *testing.T) {
+	generated := "# generated by replicate/cog\n.git\nweights\n"
+
+	require.Equal(t, generated, MergeDockerignore("", generated))
+
+	// Lines that are already there aren't repeated
+	require.Equal(t, "data\n.git\n# generated by replicate/cog\nweights\n", MergeDockerignore("data\n.git\n", generated))
+
+	// The generated lines go after the marker, so lines after it can include files again
+	require.Equal(t, "data\n# cog:generated\n# generated by replicate/cog\n.git\nweights\n!weights/config.json\n",
+		MergeDockerignore("data\n# cog:generated\n!weights/config.json\n", generated))
+}
+
+func TestDockerignoreMatcher(t *testing.T) {
+	m, err := NewDockerignoreMatcher("# comment\ndata\n*.ckpt\n**/__pycache__\n!data/README.md\n")
+	require.NoError(t, err)
+	require.True(t, m.HasExceptions())
+
+	require.True(t, m.Excludes("data"))
+	require.True(t, m.Excludes("data/train.csv"))
+	require.False(t, m.Excludes("data/README.md"))
+	require.True(t, m.Excludes("model.ckpt"))
+	require.False(t, m.Excludes("weights/model.ckpt"))
+	require.True(t, m.Excludes("src/__pycache__/predict.pyc"))
+	require.False(t, m.Excludes("predict.py"))
+
+	m, err = NewDockerignoreMatcher("*\n!predict.py\n!lib/utils.py\n")
+	require.NoError(t, err)
+	require.False(t, m.Excludes("predict.py"))
+	require.False(t, m.Excludes("lib/utils.py"))
+	require.True(t, m.Excludes("lib/other.py"))
+	require.True(t, m.Excludes("cog.yaml"))
+}
@@ -0,0 +1,55 @@
+package dockerfile
+
+import (
+	"strings"
+)
+
+// weightsStages are the stages of the runner's Dockerfile that read the weights image
+var weightsStages = []string{"weights", "quantize"}
+
+// EnvironmentDockerfile returns the part of a runner Dockerfile from Generate that doesn't need the weights image:
+// the stages that build the environment the model runs in, up to where the weights are copied into it. It can be
+// built while the weights image is, and then the runner's build reuses its layers. If the runner doesn't copy
+// anything from the weights image, it's the whole Dockerfile, without the weights stages, and needsWeights is false.
+func EnvironmentDockerfile(dockerfile string) (environment string, needsWeights bool) {
+	lines := []string{}
+	skipStage := false
+	for _, line := range strings.Split(dockerfile, "\n") {
+		instruction := strings.TrimSpace(line)
+		if keyword, _, _ := strings.Cut(instruction, " "); strings.EqualFold(keyword, "FROM") {
+			skipStage = isWeightsStage(instruction)
+		}
+		if skipStage {
+			continue
+		}
+		if copiesFromWeights(instruction) {
+			return strings.Join(lines, "\n"), true
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n"), false
+}
+
+// isWeightsStage returns whether a FROM instruction starts one of the weightsStages
+func isWeightsStage(from string) bool {
+	fields := strings.Fields(from)
+	if len(fields) < 4 || !strings.EqualFold(fields[len(fields)-2], "AS") {
+		return false
+	}
+	for _, stage := range weightsStages {
+		if fields[len(fields)-1] == stage {
+			return true
+		}
+	}
+	return false
+}
+
+// copiesFromWeights returns whether an instruction copies files from one of the weightsStages
+func copiesFromWeights(instruction string) bool {
+	for _, stage := range weightsStages {
+		if strings.Contains(instruction, "--from="+stage+" ") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package dockerfile
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+func TestEnvironmentDockerfile(t *testing.T) {
+	runner := `#syntax=docker/dockerfile:1.4
+FROM python:3.11 AS deps
+RUN pip install -t /dep torch
+FROM r8.im/user/model-weights AS weights
+FROM python:3.11-slim
+COPY --from=deps --link /dep /usr/local/lib/python3.11/site-packages
+RUN echo hello
+COPY --from=weights --link /src/models /src/models
+WORKDIR /src
+COPY . /src`
+
+	environment, needsWeights := EnvironmentDockerfile(runner)
+	require.True(t, needsWeights)
+	require.Equal(t, `#syntax=docker/dockerfile:1.4
+FROM python:3.11 AS deps
+RUN pip install -t /dep torch
+FROM python:3.11-slim
+COPY --from=deps --link /dep /usr/local/lib/python3.11/site-packages
+RUN echo hello`, environment)
+
+	// Without weights, the runner doesn't need the weights image at all
+	withoutWeights := `FROM r8.im/user/model-weights AS weights
+FROM python:3.11-slim
+RUN echo hello
+COPY . /src`
+	environment, needsWeights = EnvironmentDockerfile(withoutWeights)
+	require.False(t, needsWeights)
+	require.Equal(t, `FROM python:3.11-slim
+RUN echo hello
+COPY . /src`, environment)
+}
+
+func TestEnvironmentDockerfileFromGenerate(t *testing.T) {
+	conf, err := config.FromYAML([]byte(`
+build:
+  python_packages:
+    - pandas==2.0.3
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(""))
+	gen, err := NewGenerator(conf, t.TempDir())
+	require.NoError(t, err)
+	gen.fileWalker = func(root string, walkFn filepath.WalkFunc) error {
+		return walkFn("models/large", mockFileInfo{size: sizeThreshold}, nil)
+	}
+
+	_, runner, _, err := gen.Generate("r8.im/replicate/cog-test")
+	require.NoError(t, err)
+	environment, needsWeights := EnvironmentDockerfile(runner)
+	require.True(t, needsWeights)
+	require.NotContains(t, environment, "cog-test-weights")
+	require.Contains(t, environment, "pip install -t /dep -r /tmp/requirements.txt")
+	require.NotContains(t, environment, "--from=weights")
+	require.Contains(t, runner, "COPY --from=weights --link /src/models /src/models")
+}
@@ -1,6 +1,9 @@
 package dockerfile
 
 import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
 	// blank import for embeds
 	_ "embed"
 	"fmt"
@@ -8,15 +11,33 @@ import (
 	"path"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 
 	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/util/slices"
 	"github.com/replicate/cog/pkg/weights"
 )
 
 //go:embed embed/cog.whl
 var cogWheelEmbed []byte
 
+// CogWheelFilename is what the cog wheel is installed as. It needs to be the full format, otherwise pip refuses to
+// install it.
+const CogWheelFilename = "cog-0.0.1.dev-py3-none-any.whl"
+
+// CogWheel returns the cog Python package that is installed in models
+func CogWheel() []byte {
+	return cogWheelEmbed
+}
+
+const (
+	// caCertificatesFilename is what the certificates in build.ca_certificates are written to
+	caCertificatesFilename = "cog-ca-certificates.crt"
+	// caBundlePath is the trust store of Debian and Ubuntu, which the base images are
+	caBundlePath = "/etc/ssl/certs/ca-certificates.crt"
+)
+
 const DockerignoreHeader = `# generated by replicate/cog
 __pycache__
 *.pyc
@@ -40,6 +61,20 @@ coverage.xml
 .hypothesis
 `
 
+// Formats of image that can be generated, which differ in how the HTTP server is run
+const (
+	// FormatCog is Cog's own HTTP API
+	FormatCog = "cog"
+	// FormatSageMaker follows the conventions of SageMaker inference endpoints: port 8080, GET /ping and POST /invocations
+	FormatSageMaker = "sagemaker"
+	// FormatVertex follows the requirements of Vertex AI custom containers: the port, health route and
+	// predict route are set by AIP_HTTP_PORT, AIP_HEALTH_ROUTE and AIP_PREDICT_ROUTE
+	FormatVertex = "vertex"
+)
+
+// Formats are all of the formats that can be generated
+var Formats = []string{FormatCog, FormatSageMaker, FormatVertex}
+
 type Generator struct {
 	Config *config.Config
 	Dir    string
@@ -49,20 +84,54 @@ type Generator struct {
 	GOARCH string
 
 	useCudaBaseImage bool
+	format           string
+	quantize         bool
+	gpuRunDevice     bool
+
+	// quantizeImage has the quantized weights, see SetQuantizeImage, and quantizeOnly stops the Dockerfile after
+	// the stage that quantizes the weights, see GenerateQuantize
+	quantizeImage string
+	quantizeOnly  bool
+
+	// weightsSigningKey signs the manifest of the weights in the image, which is checked when the container starts
+	weightsSigningKey ed25519.PrivateKey
+
+	// sourceDockerignore are the .dockerignore lines that leave out the files that aren't copied into the image
+	sourceDockerignore string
 
 	// absolute path to tmpDir, a directory that will be cleaned up
 	tmpDir string
 	// tmpDir relative to Dir
 	relativeTmpDir string
+	// keepTmpDir is set if tmpDir is part of a standalone build context, or is kept to resume a build that
+	// failed, so it isn't cleaned up
+	keepTmpDir bool
+
+	// stageSetup are the instructions at the start of every stage, which add build.ca_certificates to the trust
+	// store and set build.env, see prepareStageSetup
+	stageSetup string
+
+	// sections maps the instructions in the Dockerfile to the section they are in
+	sections map[string]string
 
 	fileWalker weights.FileWalker
 
+	// ctx stops the weights being hashed if the build is canceled
+	ctx context.Context
+
 	modelDirs  []string
 	modelFiles []string
+	// tempFiles are the checksums of the files written to tmpDir, by name
+	tempFiles map[string]string
 }
 
 func NewGenerator(config *config.Config, dir string) (*Generator, error) {
-	rootTmp := path.Join(dir, ".cog/tmp")
+	// Go only handles Windows paths longer than MAX_PATH when they are absolute
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get absolute path of %s: %w", dir, err)
+	}
+	rootTmp := filepath.Join(dir, ".cog", "tmp")
 	if err := os.MkdirAll(rootTmp, 0o755); err != nil {
 		return nil, err
 	}
@@ -71,11 +140,13 @@ func NewGenerator(config *config.Config, dir string) (*Generator, error) {
 	if err != nil {
 		return nil, err
 	}
-	// tmpDir, but without dir prefix. This is the path used in the Dockerfile.
+	// tmpDir, but without dir prefix. This is the path used in the Dockerfile, so it's separated by forward slashes
+	// on every OS.
 	relativeTmpDir, err := filepath.Rel(dir, tmpDir)
 	if err != nil {
 		return nil, err
 	}
+	relativeTmpDir = filepath.ToSlash(relativeTmpDir)
 
 	return &Generator{
 		Config:           config,
@@ -85,16 +156,54 @@ func NewGenerator(config *config.Config, dir string) (*Generator, error) {
 		tmpDir:           tmpDir,
 		relativeTmpDir:   relativeTmpDir,
 		fileWalker:       filepath.Walk,
+		ctx:              context.Background(),
 		useCudaBaseImage: true,
+		format:           FormatCog,
 	}, nil
 }
 
+// SetContext stops the generator hashing the weights, which can take a while, when ctx is canceled
+func (g *Generator) SetContext(ctx context.Context) {
+	g.ctx = ctx
+}
+
+// SetWeightsSigningKey signs the manifest of the weights in the image with key, so the container checks its
+// weights haven't been tampered with when it starts
+func (g *Generator) SetWeightsSigningKey(key ed25519.PrivateKey) {
+	g.weightsSigningKey = key
+}
+
 func (g *Generator) SetUseCudaBaseImage(argumentValue string) {
 	// "false" -> false, "true" -> true, "auto" -> true, "asdf" -> true
 	g.useCudaBaseImage = argumentValue != "false"
 }
 
+// SetFormat sets the format of the image, which must be one of Formats
+func (g *Generator) SetFormat(format string) error {
+	if format == "" {
+		format = FormatCog
+	}
+	for _, f := range Formats {
+		if f == format {
+			g.format = format
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown image format '%s', it must be one of: %s", format, strings.Join(Formats, ", "))
+}
+
 func (g *Generator) GenerateBase() (string, error) {
+	base, err := g.generateBase()
+	if err != nil {
+		return "", err
+	}
+	return g.applyHooks(base)
+}
+
+func (g *Generator) generateBase() (string, error) {
+	if err := g.prepareStageSetup(); err != nil {
+		return "", err
+	}
 	pipInstallStage, err := g.pipInstallStage()
 	if err != nil {
 		return "", err
@@ -103,12 +212,10 @@ func (g *Generator) GenerateBase() (string, error) {
 	if err != nil {
 		return "", err
 	}
-	installPython := ""
-	if g.Config.Build.GPU && g.useCudaBaseImage {
-		installPython, err = g.installPythonCUDA()
-		if err != nil {
-			return "", err
-		}
+	pythonStage, installPython, copyPython := g.pythonCUDA(baseImage)
+	wheelsStage, installWheels, err := g.wheelsStage()
+	if err != nil {
+		return "", err
 	}
 	aptInstalls, err := g.aptInstalls()
 	if err != nil {
@@ -118,33 +225,66 @@ func (g *Generator) GenerateBase() (string, error) {
 	if err != nil {
 		return "", err
 	}
+	weightsConfig, err := g.weightsConfig()
+	if err != nil {
+		return "", err
+	}
 
-	return strings.Join(filterEmpty([]string{
-		"#syntax=docker/dockerfile:1.4",
-		pipInstallStage,
-		"FROM " + baseImage,
-		g.preamble(),
-		g.installTini(),
-		installPython,
-		aptInstalls,
-		g.pipInstalls(),
-		run,
-		`WORKDIR /src`,
-		`EXPOSE 5000`,
-		`CMD ["python", "-m", "cog.server.http"]`,
-	}), "\n"), nil
+	blocks, err := g.render(baseImage, g.ordered(
+		block{TemplatePipInstallStage, SectionPythonPackages, pipInstallStage},
+		block{TemplatePythonStage, SectionPython, pythonStage},
+		block{TemplateWheelsStage, SectionPythonPackages, wheelsStage},
+		block{TemplateBaseImage, SectionBaseImage, "FROM " + baseImage},
+		block{TemplatePreamble, SectionSetup, g.preamble()},
+		block{TemplateInstallPython, SectionPython, installPython},
+		block{TemplateTini, SectionSetup, g.installTini()},
+		block{TemplateCog, SectionPythonPackages, g.copyCog()},
+		block{TemplateSystemPackages, SectionSystemPackages, aptInstalls},
+		block{TemplateCopyPython, SectionPython, copyPython},
+		block{TemplatePythonPackages, SectionPythonPackages, g.pipInstalls()},
+		block{TemplateInstallWheels, SectionPythonPackages, installWheels},
+		block{TemplateRun, SectionRun, run},
+		block{TemplateServer, SectionServer, strings.Join(filterEmpty(g.server()), "\n")},
+		block{TemplateWeightsConfig, SectionWeights, weightsConfig},
+	)...)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(filterEmpty(append([]string{g.syntax()}, blocks...)), "\n"), nil
 }
 
 // GenerateDockerfileWithoutSeparateWeights generates a Dockerfile that doesn't write model weights to a separate layer.
 func (g *Generator) GenerateDockerfileWithoutSeparateWeights() (string, error) {
-	base, err := g.GenerateBase()
+	base, err := g.generateBase()
+	if err != nil {
+		return "", err
+	}
+	weightsPaths := []string{}
+	if g.Config.SourceOnlyImports() {
+		// The weights are copied with the source, so they have to be copied too
+		_, modelDirs, modelFiles, err := g.generateForWeights()
+		if err != nil {
+			return "", err
+		}
+		weightsPaths = append(modelDirs, modelFiles...)
+	}
+	copySource, dockerignore, err := g.copySource(weightsPaths)
+	if err != nil {
+		return "", err
+	}
+	g.sourceDockerignore = dockerignore
+	baseImage, err := g.baseImage()
 	if err != nil {
 		return "", err
 	}
-	return strings.Join(filterEmpty([]string{
-		base,
-		`COPY . /src`,
-	}), "\n"), nil
+	blocks, err := g.render(baseImage,
+		block{TemplateSource, SectionSource, copySource},
+		block{TemplateVerify, SectionVerify, g.verify()},
+	)
+	if err != nil {
+		return "", err
+	}
+	return g.applyHooks(strings.Join(filterEmpty(append([]string{base}, blocks...)), "\n"))
 }
 
 // Generate creates the Dockerfile and .dockerignore file contents for model weights
@@ -158,6 +298,9 @@ func (g *Generator) Generate(imageName string) (weightsBase string, dockerfile s
 	if err != nil {
 		return "", "", "", fmt.Errorf("Failed to generate Dockerfile for model weights files: %w", err)
 	}
+	if err := g.prepareStageSetup(); err != nil {
+		return "", "", "", err
+	}
 	pipInstallStage, err := g.pipInstallStage()
 	if err != nil {
 		return "", "", "", err
@@ -166,12 +309,10 @@ func (g *Generator) Generate(imageName string) (weightsBase string, dockerfile s
 	if err != nil {
 		return "", "", "", err
 	}
-	installPython := ""
-	if g.Config.Build.GPU && g.useCudaBaseImage {
-		installPython, err = g.installPythonCUDA()
-		if err != nil {
-			return "", "", "", err
-		}
+	pythonStage, installPython, copyPython := g.pythonCUDA(baseImage)
+	wheelsStage, installWheels, err := g.wheelsStage()
+	if err != nil {
+		return "", "", "", err
 	}
 	aptInstalls, err := g.aptInstalls()
 	if err != nil {
@@ -182,36 +323,102 @@ func (g *Generator) Generate(imageName string) (weightsBase string, dockerfile s
 		return "", "", "", err
 	}
 
-	base := []string{
-		"#syntax=docker/dockerfile:1.4",
-		pipInstallStage,
-		fmt.Sprintf("FROM %s AS %s", imageName+"-weights", "weights"),
-		"FROM " + baseImage,
-		g.preamble(),
-		g.installTini(),
-		installPython,
-		aptInstalls,
-		g.pipInstalls(),
-		runCommands,
+	weightsStage := "weights"
+	quantizeStage := ""
+	if g.quantize {
+		weightsStage = "quantize"
+		if quantizeStage, err = g.quantizeStage(baseImage, installPython, copyPython); err != nil {
+			return "", "", "", err
+		}
 	}
 
+	copyWeights := []string{}
 	for _, p := range append(g.modelDirs, g.modelFiles...) {
-		base = append(base, "", fmt.Sprintf("COPY --from=%s --link %[2]s %[2]s", "weights", path.Join("/src", p)))
+		copyWeights = append(copyWeights, fmt.Sprintf("COPY --from=%s --link %[2]s %[2]s", weightsStage, path.Join("/src", p)))
+	}
+
+	weightsConfig, err := g.weightsConfig()
+	if err != nil {
+		return "", "", "", err
+	}
+	copySource, sourceDockerignore, err := g.copySource(nil)
+	if err != nil {
+		return "", "", "", err
 	}
 
-	base = append(base,
-		`WORKDIR /src`,
-		`EXPOSE 5000`,
-		`CMD ["python", "-m", "cog.server.http"]`,
-		`COPY . /src`,
+	stages := g.ordered(
+		block{TemplatePipInstallStage, SectionPythonPackages, pipInstallStage},
+		block{TemplatePythonStage, SectionPython, pythonStage},
+		block{TemplateWheelsStage, SectionPythonPackages, wheelsStage},
+		block{TemplateWeightsStage, SectionWeights, fmt.Sprintf("FROM %s AS %s", imageName+"-weights", "weights")},
+		block{TemplateQuantizeStage, SectionWeights, quantizeStage},
+		block{TemplateBaseImage, SectionBaseImage, "FROM " + baseImage},
+		block{TemplatePreamble, SectionSetup, g.preamble()},
+		block{TemplateInstallPython, SectionPython, installPython},
+		block{TemplateTini, SectionSetup, g.installTini()},
+		block{TemplateCog, SectionPythonPackages, g.copyCog()},
+		block{TemplateSystemPackages, SectionSystemPackages, aptInstalls},
+		block{TemplateCopyPython, SectionPython, copyPython},
+		block{TemplatePythonPackages, SectionPythonPackages, g.pipInstalls()},
+		block{TemplateInstallWheels, SectionPythonPackages, installWheels},
+		block{TemplateRun, SectionRun, runCommands},
+		block{TemplateCopyWeights, SectionWeights, strings.Join(copyWeights, "\n")},
+		block{TemplateServer, SectionServer, strings.Join(filterEmpty(g.server()), "\n")},
+		block{TemplateWeightsConfig, SectionWeights, weightsConfig},
+		block{TemplateSource, SectionSource, copySource},
+		block{TemplateVerify, SectionVerify, g.verify()},
 	)
+	if g.quantizeOnly {
+		for i, b := range stages {
+			if b.name == TemplateQuantizeStage {
+				stages = stages[:i+1]
+				break
+			}
+		}
+	}
+	blocks, err := g.render(baseImage, stages...)
+	if err != nil {
+		return "", "", "", err
+	}
+	base := append([]string{g.syntax()}, blocks...)
 
-	dockerignoreContents = makeDockerignoreForWeights(g.modelDirs, g.modelFiles)
-	return weightsBase, strings.Join(filterEmpty(base), "\n"), dockerignoreContents, nil
+	dockerignoreContents = makeDockerignoreForWeights(append(g.modelDirs, g.Config.LazyWeightsPaths()...), g.modelFiles) + sourceDockerignore + g.ignoreLines()
+	dockerfile, err = g.applyHooks(strings.Join(filterEmpty(base), "\n"))
+	if err != nil {
+		return "", "", "", err
+	}
+	return weightsBase, dockerfile, dockerignoreContents, nil
+}
+
+// WeightsPaths returns the directories and files in the project that Cog treats as weights, relative to the
+// project directory
+func (g *Generator) WeightsPaths() ([]string, error) {
+	_, modelDirs, modelFiles, err := g.generateForWeights()
+	if err != nil {
+		return nil, err
+	}
+	return append(modelDirs, modelFiles...), nil
 }
 
 func (g *Generator) generateForWeights() (string, []string, []string, error) {
-	modelDirs, modelFiles, err := weights.FindWeights(g.fileWalker)
+	// Weights that are downloaded when the container starts aren't built into the image
+	lazyPaths := g.Config.LazyWeightsPaths()
+	walker := func(root string, walkFn filepath.WalkFunc) error {
+		return g.fileWalker(root, func(p string, info os.FileInfo, err error) error {
+			p = filepath.ToSlash(p)
+			if len(withoutPaths([]string{p}, lazyPaths)) == 0 {
+				return nil
+			}
+			if g.Config.IsIgnored(p) {
+				if info != nil && info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			return walkFn(p, info, err)
+		})
+	}
+	modelDirs, modelFiles, err := weights.FindWeights(walker)
 	if err != nil {
 		return "", nil, nil, err
 	}
@@ -237,14 +444,54 @@ func makeDockerignoreForWeights(dirs, files []string) string {
 	return DockerignoreHeader + contents
 }
 
+// RelativeTmpDir returns the directory the generated files are written to, relative to the project directory
+func (g *Generator) RelativeTmpDir() string {
+	return g.relativeTmpDir
+}
+
+// ReuseTmpDir writes the generated files to relativeTmpDir, the directory of an earlier build of the project,
+// instead of a new one. The files are then copied from the same paths as before, so Docker can reuse the layers
+// that build cached.
+func (g *Generator) ReuseTmpDir(relativeTmpDir string) error {
+	if path.Dir(relativeTmpDir) != ".cog/tmp" || !strings.HasPrefix(path.Base(relativeTmpDir), "build") {
+		return fmt.Errorf("%s isn't a build directory in .cog/tmp", relativeTmpDir)
+	}
+	tmpDir := filepath.Join(g.Dir, filepath.FromSlash(relativeTmpDir))
+	if _, err := os.Stat(tmpDir); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(g.tmpDir); err != nil {
+		return fmt.Errorf("Failed to clean up %s: %w", g.tmpDir, err)
+	}
+	g.tmpDir = tmpDir
+	g.relativeTmpDir = relativeTmpDir
+	return nil
+}
+
+// KeepTmpDir stops Cleanup removing the generated files, so a build that failed can be resumed with them
+func (g *Generator) KeepTmpDir() {
+	g.keepTmpDir = true
+}
+
 func (g *Generator) Cleanup() error {
+	if g.keepTmpDir {
+		return nil
+	}
 	if err := os.RemoveAll(g.tmpDir); err != nil {
 		return fmt.Errorf("Failed to clean up %s: %w", g.tmpDir, err)
 	}
 	return nil
 }
 
+// BaseImage returns the image the model is built from
+func (g *Generator) BaseImage() (string, error) {
+	return g.baseImage()
+}
+
 func (g *Generator) baseImage() (string, error) {
+	if g.Config.Workspace != nil {
+		return g.Config.Workspace.Image, nil
+	}
 	if g.Config.Build.GPU && g.useCudaBaseImage {
 		return g.Config.CUDABaseImageTag()
 	}
@@ -252,13 +499,89 @@ func (g *Generator) baseImage() (string, error) {
 }
 
 func (g *Generator) preamble() string {
-	return `ENV DEBIAN_FRONTEND=noninteractive
+	return strings.Join(filterEmpty([]string{`ENV DEBIAN_FRONTEND=noninteractive
 ENV PYTHONUNBUFFERED=1
 ENV LD_LIBRARY_PATH=$LD_LIBRARY_PATH:/usr/lib/x86_64-linux-gnu:/usr/local/nvidia/lib64:/usr/local/nvidia/bin
-ENV NVIDIA_DRIVER_CAPABILITIES=all`
+ENV NVIDIA_DRIVER_CAPABILITIES=all`, g.stageSetup}), "\n")
+}
+
+// prepareStageSetup sets the instructions at the start of every stage, so the packages and run commands in every
+// stage are installed and run with build.args, build.ca_certificates and build.env. ARGs only last until the end of
+// the stage they're declared in, so they're declared again in each one.
+func (g *Generator) prepareStageSetup() error {
+	caCertificates, err := g.caCertificates()
+	if err != nil {
+		return err
+	}
+	lines := append(argInstructions(g.Config.Build.Args), caCertificates...)
+	g.stageSetup = strings.Join(filterEmpty(append(lines, envInstruction(g.Config.Build.Env))), "\n")
+	return nil
+}
+
+// caCertificates writes the certificates in build.ca_certificates to the build context, and returns the
+// instructions that add them to the trust store, so apt-get, curl and pip trust a proxy that intercepts TLS.
+// update-ca-certificates keeps them if it's run again, because they're in /usr/local/share/ca-certificates.
+// pip and requests have their own certificates, so they're pointed at the trust store too.
+func (g *Generator) caCertificates() ([]string, error) {
+	bundle, err := g.Config.CACertificates(g.Dir)
+	if err != nil || len(bundle) == 0 {
+		return nil, err
+	}
+	if _, _, err := g.writeTemp(caCertificatesFilename, bundle); err != nil {
+		return nil, err
+	}
+	return []string{
+		"COPY " + path.Join(g.relativeTmpDir, caCertificatesFilename) + " /usr/local/share/ca-certificates/" + caCertificatesFilename,
+		"RUN mkdir -p /etc/ssl/certs && cat /usr/local/share/ca-certificates/" + caCertificatesFilename + " >> " + caBundlePath,
+		"ENV SSL_CERT_FILE=" + caBundlePath + " REQUESTS_CA_BUNDLE=" + caBundlePath + " PIP_CERT=" + caBundlePath,
+	}, nil
+}
+
+// argInstructions returns ARG instructions that declare args, with their default values
+func argInstructions(args map[string]string) []string {
+	lines := []string{}
+	for _, name := range sortedKeys(args) {
+		if args[name] == "" {
+			lines = append(lines, "ARG "+name)
+		} else {
+			lines = append(lines, "ARG "+name+"="+quote(args[name]))
+		}
+	}
+	return lines
+}
+
+// envInstruction returns an ENV instruction that sets env, or an empty string if it's empty. The values are
+// quoted, but variables in them are still expanded, so PATH can be added to.
+func envInstruction(env map[string]string) string {
+	if len(env) == 0 {
+		return ""
+	}
+	vars := []string{}
+	for _, name := range sortedKeys(env) {
+		vars = append(vars, name+"="+quote(env[name]))
+	}
+	return "ENV " + strings.Join(vars, " ")
+}
+
+// quote returns s in double quotes for an ARG or ENV instruction
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := []string{}
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
 }
 
 func (g *Generator) installTini() string {
+	if g.Config.Workspace != nil {
+		// The workspace's base image has it, and its entrypoint is inherited
+		return ""
+	}
 	// Install tini as the image entrypoint to provide signal handling and process
 	// reaping appropriate for PID 1.
 	//
@@ -278,21 +601,149 @@ chmod +x /sbin/tini`,
 	return strings.Join(lines, "\n")
 }
 
+// server returns the instructions that set up how the image runs the HTTP server
+func (g *Generator) server() []string {
+	switch g.format {
+	case FormatSageMaker:
+		// SageMaker starts the container with `docker run <image> serve`
+		return []string{
+			g.serverEnv(),
+			`ENV COG_API_FORMAT=sagemaker PORT=8080`,
+			`RUN printf '#!/bin/sh\nexec python -m cog.server.http "$@"\n' > /usr/local/bin/serve && chmod +x /usr/local/bin/serve`,
+			`WORKDIR /src`,
+			`EXPOSE 8080`,
+			`CMD ["serve"]`,
+		}
+	case FormatVertex:
+		// Vertex AI sets AIP_HTTP_PORT and the routes when it runs the container, these are the defaults
+		return []string{
+			g.serverEnv(),
+			`ENV COG_API_FORMAT=vertex AIP_HTTP_PORT=8080 AIP_HEALTH_ROUTE=/health AIP_PREDICT_ROUTE=/predict`,
+			`WORKDIR /src`,
+			`EXPOSE 8080`,
+			`CMD ["python", "-m", "cog.server.http"]`,
+		}
+	default:
+		return []string{
+			g.serverEnv(),
+			`WORKDIR /src`,
+			`EXPOSE 5000`,
+			`CMD ["python", "-m", "cog.server.http"]`,
+		}
+	}
+}
+
+// serverEnv returns the environment variables that configure the HTTP server from cog.yaml
+func (g *Generator) serverEnv() string {
+	lines := []string{}
+	if runtime := g.Config.Runtime; runtime != nil {
+		lines = append(lines, filterEmpty([]string{envInstruction(runtime.Env)})...)
+	}
+	if concurrency := g.Config.Concurrency; concurrency != nil {
+		if concurrency.Max > 0 {
+			lines = append(lines, fmt.Sprintf("ENV COG_MAX_CONCURRENCY=%d", concurrency.Max))
+		}
+		if concurrency.QueueSize > 0 {
+			lines = append(lines, fmt.Sprintf("ENV COG_QUEUE_SIZE=%d", concurrency.QueueSize))
+		}
+	}
+	if g.Config.PredictTimeout > 0 {
+		lines = append(lines, fmt.Sprintf("ENV COG_PREDICT_TIMEOUT=%d", g.Config.PredictTimeout))
+	}
+	if shutdown := g.Config.Shutdown; shutdown != nil {
+		if gracePeriod := g.Config.ShutdownGracePeriod(); gracePeriod > 0 {
+			lines = append(lines, fmt.Sprintf("ENV COG_SHUTDOWN_GRACE_PERIOD=%d", gracePeriod))
+		}
+		if shutdown.Drain {
+			lines = append(lines, "ENV COG_SHUTDOWN_DRAIN=true")
+		}
+		if shutdown.SIGTERM != "" {
+			lines = append(lines, "ENV COG_SHUTDOWN_SIGTERM="+shutdown.SIGTERM)
+		}
+	}
+	if g.Config.OpenAI {
+		lines = append(lines, "ENV COG_OPENAI=true")
+	}
+	if g.Config.Auth {
+		// The token itself is only set when the container runs, so it isn't in the image
+		lines = append(lines, "ENV COG_AUTH_REQUIRED=true")
+	}
+	if cert, key := g.Config.TLSFiles(); cert != "" {
+		lines = append(lines, "ENV COG_TLS_CERT_FILE="+cert+" COG_TLS_KEY_FILE="+key)
+	} else if g.Config.TLSEnabled() {
+		lines = append(lines, "ENV COG_TLS_AUTO=true")
+	}
+	if origins := g.Config.CORSOrigins(); len(origins) > 0 {
+		lines = append(lines, "ENV COG_CORS_ORIGINS="+strings.Join(origins, ","))
+	}
+	// It's checked when cog.yaml is validated
+	if size, err := g.Config.MaxRequestSizeBytes(); err == nil && size > 0 {
+		lines = append(lines, fmt.Sprintf("ENV COG_MAX_REQUEST_SIZE=%d", size))
+	}
+	return strings.Join(lines, "\n")
+}
+
 func (g *Generator) aptInstalls() (string, error) {
-	packages := g.Config.Build.SystemPackages
-	if len(packages) == 0 {
-		return "", nil
+	lines := []string{}
+	// The workspace's base image already has its system packages
+	if packages := withoutStrings(g.Config.SystemPackages(), g.Config.WorkspaceSystemPackages()); len(packages) > 0 {
+		if g.Config.Build.SharedLayers {
+			sort.Strings(packages)
+		}
+		lines = append(lines, "RUN --mount=type=cache,target=/var/cache/apt apt-get update -qq && apt-get install -qqy "+
+			strings.Join(packages, " ")+
+			" && rm -rf /var/lib/apt/lists/*")
 	}
-	return "RUN --mount=type=cache,target=/var/cache/apt apt-get update -qq && apt-get install -qqy " +
-		strings.Join(packages, " ") +
-		" && rm -rf /var/lib/apt/lists/*", nil
+	lines = append(lines, g.timezoneAndLocale()...)
+	return strings.Join(lines, "\n"), nil
 }
 
-func (g *Generator) installPythonCUDA() (string, error) {
-	// TODO: check that python version is valid
+// timezoneAndLocale returns the instructions that set build.timezone and build.locale, after tzdata and locales
+// are installed with the system packages
+func (g *Generator) timezoneAndLocale() []string {
+	lines := []string{}
+	if tz := g.Config.Build.Timezone; tz != "" {
+		lines = append(lines,
+			fmt.Sprintf("RUN ln -snf /usr/share/zoneinfo/%s /etc/localtime && echo %s > /etc/timezone", tz, tz),
+			"ENV TZ="+tz,
+		)
+	}
+	if locale := g.Config.Build.Locale; locale != "" {
+		if input, charmap := g.Config.LocaleDefinition(); input != "" {
+			lines = append(lines, fmt.Sprintf("RUN localedef -i %s -c -f %s -A /usr/share/locale/locale.alias %s", input, charmap, locale))
+		}
+		lines = append(lines, fmt.Sprintf("ENV LANG=%s LC_ALL=%s", locale, locale))
+	}
+	return lines
+}
 
-	py := g.Config.Build.PythonVersion
+// pythonCUDA returns the instructions that install Python on a CUDA base image, which doesn't come with it.
+//
+// Python is compiled with pyenv in its own stage, so it is built in parallel with the system packages and the
+// rest of the image, and is copied into the image with --link, so changing the system packages doesn't
+// rebuild it. The final stage installs the same build dependencies, which also makes them available to
+// `run` commands, and starts with the same instructions as the Python stage so BuildKit only installs them once.
+//
+// It returns the Python stage, the instructions to install the build dependencies at the start of the image,
+// and the instruction that copies Python into the image, which are all empty if the image doesn't need them.
+func (g *Generator) pythonCUDA(baseImage string) (stage string, deps string, copyPython string) {
+	if !g.Config.Build.GPU || !g.useCudaBaseImage {
+		return "", "", ""
+	}
+	if g.Config.Workspace != nil {
+		// The workspace's base image already has Python, so it's only a stage for the wheels stage to copy it from
+		return "FROM " + baseImage + " AS python", "", ""
+	}
+	stage = strings.Join([]string{
+		"FROM " + baseImage + " AS python",
+		g.preamble(),
+		g.installPythonDeps(),
+		g.buildPython(),
+	}, "\n")
+	return stage, g.installPythonDeps(), "COPY --from=python --link /root/.pyenv /root/.pyenv"
+}
 
+func (g *Generator) installPythonDeps() string {
 	return `ENV PATH="/root/.pyenv/shims:/root/.pyenv/bin:$PATH"
 RUN --mount=type=cache,target=/var/cache/apt apt-get update -qq && apt-get install -qqy --no-install-recommends \
 	make \
@@ -313,28 +764,62 @@ RUN --mount=type=cache,target=/var/cache/apt apt-get update -qq && apt-get insta
 	liblzma-dev \
 	git \
 	ca-certificates \
-	&& rm -rf /var/lib/apt/lists/*
-` + fmt.Sprintf(`RUN curl -s -S -L https://raw.githubusercontent.com/pyenv/pyenv-installer/master/bin/pyenv-installer | bash && \
+	&& rm -rf /var/lib/apt/lists/*`
+}
+
+func (g *Generator) buildPython() string {
+	// TODO: check that python version is valid
+
+	py := g.Config.Build.PythonVersion
+
+	return fmt.Sprintf(`RUN curl -s -S -L https://raw.githubusercontent.com/pyenv/pyenv-installer/master/bin/pyenv-installer | bash && \
 	git clone https://github.com/momo-lab/pyenv-install-latest.git "$(pyenv root)"/plugins/pyenv-install-latest && \
 	pyenv install-latest "%s" && \
 	pyenv global $(pyenv install-latest --print "%s") && \
-	pip install "wheel<1"`, py, py), nil
+	pip install "wheel<1"`, py, py)
 	// for sitePackagesLocation, kind of need to determine which specific version latest is (3.8 -> 3.8.17 or 3.8.18)
 	// install-latest essentially does pyenv install --list | grep $py | tail -1
 	// there are many bad options, but a symlink to $(pyenv prefix) is the least bad one
 }
 
 func (g *Generator) installCog() (string, error) {
-	// Wheel name needs to be full format otherwise pip refuses to install it
-	cogFilename := "cog-0.0.1.dev-py3-none-any.whl"
-	lines, containerPath, err := g.writeTemp(cogFilename, cogWheelEmbed)
+	lines, containerPath, err := g.writeTemp(CogWheelFilename, cogWheelEmbed)
 	if err != nil {
 		return "", err
 	}
-	lines = append(lines, fmt.Sprintf("RUN --mount=type=cache,target=/root/.cache/pip pip install -t /dep %s", containerPath))
+	lines = append(lines, fmt.Sprintf("RUN --mount=type=cache,target=/root/.cache/pip pip install -t /dep%s %s", g.stableConstraints(), containerPath))
 	return strings.Join(lines, "\n"), nil
 }
 
+// stableConstraints returns the pip option that keeps packages at the versions installed by python_packages_stable
+func (g *Generator) stableConstraints() string {
+	if len(g.Config.Build.PythonPackagesStable) == 0 {
+		return ""
+	}
+	return " -c /tmp/constraints-stable.txt"
+}
+
+// stablePipInstallStage returns a stage that installs python_packages_stable into /dep-stable.
+//
+// It is its own stage so that copying the packages into the image only depends on them, and stays cached
+// when the other Python packages change. It also writes the versions it installed as constraints, so the
+// other packages are installed at the same versions.
+func (g *Generator) stablePipInstallStage(from string) (string, error) {
+	requirements, err := g.Config.StablePythonRequirementsForArch(g.GOOS, g.GOARCH)
+	if err != nil {
+		return "", err
+	}
+	copyLine, containerPath, err := g.writeTemp("requirements-stable.txt", []byte(requirements))
+	if err != nil {
+		return "", err
+	}
+	return strings.Join([]string{
+		from,
+		copyLine[0],
+		"RUN --mount=type=cache,target=/root/.cache/pip pip install -t /dep-stable -r " + containerPath + " && pip freeze --path /dep-stable > /tmp/constraints-stable.txt",
+	}, "\n"), nil
+}
+
 func (g *Generator) pipInstallStage() (string, error) {
 	installCog, err := g.installCog()
 	if err != nil {
@@ -344,46 +829,232 @@ func (g *Generator) pipInstallStage() (string, error) {
 	if err != nil {
 		return "", err
 	}
-	if strings.Trim(requirements, "") == "" {
-		return `FROM python:` + g.Config.Build.PythonVersion + ` as deps
-` + installCog, nil
-	}
-
-	copyLine, containerPath, err := g.writeTemp("requirements.txt", []byte(requirements))
+	workspaceRequirements, err := g.Config.WorkspacePythonRequirements(g.GOOS, g.GOARCH)
 	if err != nil {
 		return "", err
 	}
+	requirements = withoutRequirements(requirements, append(g.compiledPythonPackages(), workspaceRequirements...))
+	if g.Config.Build.SharedLayers {
+		requirements = sortRequirements(requirements)
+	}
 	// Not slim, so that we can compile wheels
-	fromLine := `FROM python:` + g.Config.Build.PythonVersion + ` as deps`
+	fromLine := `FROM python:` + g.Config.Build.PythonVersion
 	// Sometimes, in order to run `pip install` successfully, some system packages need to be installed
 	// or some other change needs to happen
 	// this is a bodge to support that
 	// it will be reverted when we add custom dockerfiles
 	buildStageDeps := os.Getenv("COG_EXPERIMENTAL_BUILD_STAGE_DEPS")
-	if buildStageDeps != "" {
-		fromLine = fromLine + "\nRUN " + buildStageDeps
+	from := func(stage string) string {
+		lines := []string{fromLine + " as " + stage, g.stageSetup}
+		if buildStageDeps != "" {
+			lines = append(lines, "RUN "+buildStageDeps)
+		}
+		return strings.Join(filterEmpty(lines), "\n")
 	}
-	lines := []string{
-		fromLine,
-		installCog,
-		copyLine[0],
-		"RUN --mount=type=cache,target=/root/.cache/pip pip install -t /dep -r " + containerPath,
+
+	lines := []string{}
+	if g.Config.Build.SharedLayers {
+		cogStage, err := g.cogStage()
+		if err != nil {
+			return "", err
+		}
+		lines = append(lines, cogStage)
+	}
+	if len(g.Config.Build.PythonPackagesStable) > 0 {
+		stableStage, err := g.stablePipInstallStage(from("deps-stable"))
+		if err != nil {
+			return "", err
+		}
+		// The deps stage inherits ENV from deps-stable, but not ARGs
+		lines = append(lines, stableStage, strings.Join(append([]string{"FROM deps-stable as deps"}, argInstructions(g.Config.Build.Args)...), "\n"))
+	} else if strings.Trim(requirements, "") != "" {
+		lines = append(lines, from("deps"))
+	} else {
+		lines = append(lines, strings.Join(filterEmpty([]string{fromLine + " as deps", g.stageSetup}), "\n"))
+	}
+	lines = append(lines, installCog)
+
+	if strings.Trim(requirements, "") != "" {
+		copyLine, containerPath, err := g.writeTemp("requirements.txt", []byte(requirements))
+		if err != nil {
+			return "", err
+		}
+		lines = append(lines,
+			copyLine[0],
+			"RUN --mount=type=cache,target=/root/.cache/pip pip install -t /dep"+g.stableConstraints()+" -r "+containerPath,
+		)
+	}
+	if len(g.Config.Build.PythonPackagesStable) > 0 {
+		// Packages that are also dependencies of the stable packages are already in /dep-stable
+		lines = append(lines, `RUN cd /dep-stable && for f in *; do if [ "$f" != bin ]; then rm -rf "/dep/$f"; fi; done`)
+	}
+	if g.Config.Workspace != nil {
+		// Packages that are also dependencies of the workspace's packages are already in its base image, wherever
+		// Python is installed in it
+		lines = append(lines, "RUN --mount=type=bind,from="+g.Config.Workspace.Image+`,target=/workspace-base for d in /workspace-base/root/.pyenv/versions/*/lib/python*/site-packages /workspace-base/usr/local/lib/python*/site-packages; do if [ -d "$d" ]; then cd "$d" && for f in *; do if [ "$f" != bin ]; then rm -rf "/dep/$f"; fi; done; fi; done`)
+	}
+	if g.Config.Build.SharedLayers {
+		// cog is copied from the cog stage, in a layer of its own, and its dependencies are copied from here
+		lines = append(lines, "RUN rm -rf /dep/cog /dep/cog-*.dist-info")
 	}
 	return strings.Join(lines, "\n"), nil
 }
 
+// cogStage returns a stage that installs the cog package without its dependencies. It's the same for every
+// model with the same version of Python, so it's copied into the image as a layer that registries can share
+// between models' images. Python files aren't compiled, because the compiled files record when they were built.
+func (g *Generator) cogStage() (string, error) {
+	copyLine, containerPath, err := g.writeTemp(CogWheelFilename, cogWheelEmbed)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join([]string{
+		"FROM python:" + g.Config.Build.PythonVersion + " as cog",
+		copyLine[0],
+		"RUN pip install --no-deps --no-compile -t /cog " + containerPath,
+	}, "\n"), nil
+}
+
+// copyCog returns the instruction that copies the cog package from the cog stage into the image, or an empty
+// string if the layers aren't shared, and cog is installed with the other Python packages
+func (g *Generator) copyCog() string {
+	if !g.Config.Build.SharedLayers {
+		return ""
+	}
+	if g.Config.Build.GPU && g.useCudaBaseImage {
+		return "RUN --mount=type=bind,from=cog,source=/cog,target=/cog cp -rf /cog/* $(pyenv prefix)/lib/python*/site-packages"
+	}
+	return "COPY --from=cog --link /cog /usr/local/lib/python" + g.Config.Build.PythonVersion + "/site-packages"
+}
+
+// ordered returns the blocks in the order they are in the Dockerfile. If the layers are shared, Python is copied
+// in before cog, so the layers that are the same for every model come before the system packages, which aren't.
+func (g *Generator) ordered(blocks ...block) []block {
+	if !g.Config.Build.SharedLayers {
+		return blocks
+	}
+	moved := []block{}
+	rest := []block{}
+	for _, b := range blocks {
+		if b.name == TemplateCopyPython {
+			moved = append(moved, b)
+		} else {
+			rest = append(rest, b)
+		}
+	}
+	ordered := []block{}
+	for _, b := range rest {
+		if b.name == TemplateCog {
+			ordered = append(ordered, moved...)
+		}
+		ordered = append(ordered, b)
+	}
+	return ordered
+}
+
+// sortRequirements sorts the packages in the contents of a requirements.txt file, so the same packages are
+// installed with the same instruction. Options, e.g. --extra-index-url, stay at the start in the same order.
+func sortRequirements(requirements string) string {
+	options := []string{}
+	packages := []string{}
+	for _, line := range strings.Split(requirements, "\n") {
+		switch trimmed := strings.TrimSpace(line); {
+		case trimmed == "":
+		case strings.HasPrefix(trimmed, "-"):
+			options = append(options, line)
+		default:
+			packages = append(packages, line)
+		}
+	}
+	sort.Strings(packages)
+	return strings.Join(append(options, packages...), "\n")
+}
+
+// compiledPythonPackages returns the Python packages that are compiled in the wheels stage
+func (g *Generator) compiledPythonPackages() []string {
+	if !g.Config.Build.GPU || !g.useCudaBaseImage {
+		return nil
+	}
+	return g.Config.CompiledPythonPackages(g.GOARCH)
+}
+
+// wheelsStage compiles Python packages that don't have prebuilt wheels on the CUDA devel image, in a stage of
+// its own so the wheels stay cached while torch and CUDA don't change. It returns the stage, and the line that
+// installs the wheels in the final image.
+func (g *Generator) wheelsStage() (stage string, install string, err error) {
+	compiled := g.compiledPythonPackages()
+	if len(compiled) == 0 {
+		return "", "", nil
+	}
+	develImage, err := g.Config.CUDADevelBaseImageTag()
+	if err != nil {
+		return "", "", err
+	}
+	torch, err := g.Config.TorchRequirementForArch(g.GOOS, g.GOARCH)
+	if err != nil {
+		return "", "", err
+	}
+	quoted := []string{}
+	for _, requirement := range compiled {
+		quoted = append(quoted, "'"+requirement+"'")
+	}
+	stage = strings.Join([]string{
+		"FROM " + develImage + " AS wheels",
+		g.preamble(),
+		g.installPythonDeps(),
+		"COPY --from=python --link /root/.pyenv /root/.pyenv",
+		"RUN --mount=type=cache,target=/root/.cache/pip pip install " + torch + " packaging ninja && " +
+			"MAX_JOBS=4 pip wheel --no-deps --no-build-isolation -w /wheels " + strings.Join(quoted, " "),
+	}, "\n")
+	return stage, "RUN --mount=type=bind,from=wheels,source=/wheels,target=/wheels pip install --no-deps /wheels/*.whl", nil
+}
+
+// withoutRequirements removes lines from the contents of a requirements.txt file
+func withoutRequirements(requirements string, remove []string) string {
+	if len(remove) == 0 {
+		return requirements
+	}
+	lines := []string{}
+	for _, line := range strings.Split(requirements, "\n") {
+		if !slices.ContainsString(remove, strings.TrimSpace(line)) {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// withoutStrings returns the strings in values that aren't in remove
+func withoutStrings(values []string, remove []string) []string {
+	kept := []string{}
+	for _, v := range values {
+		if !slices.ContainsString(remove, v) {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
+
 func (g *Generator) pipInstalls() string {
 	// placing packages in workdir makes imports faster but seems to break integration tests
 	// return "COPY --from=deps --link /dep COPY --from=deps /src"
 	// ...except it's actually /root/.pyenv/versions/3.8.17/lib/python3.8/site-packages
 	py := g.Config.Build.PythonVersion
+	lines := []string{}
 	if g.Config.Build.GPU && g.useCudaBaseImage {
 		// this requires buildkit!
 		// we should check for buildkit and otherwise revert to symlinks or copying into /src
 		// we mount to avoid copying, which avoids having two copies in this layer
-		return "RUN --mount=type=bind,from=deps,source=/dep,target=/dep cp -rf /dep/* $(pyenv prefix)/lib/python*/site-packages || true"
+		if len(g.Config.Build.PythonPackagesStable) > 0 {
+			lines = append(lines, "RUN --mount=type=bind,from=deps-stable,source=/dep-stable,target=/dep-stable cp -rf /dep-stable/* $(pyenv prefix)/lib/python*/site-packages || true")
+		}
+		lines = append(lines, "RUN --mount=type=bind,from=deps,source=/dep,target=/dep cp -rf /dep/* $(pyenv prefix)/lib/python*/site-packages || true")
+		return strings.Join(lines, "\n")
 	}
-	return "COPY --from=deps --link /dep /usr/local/lib/python" + py + "/site-packages"
+	if len(g.Config.Build.PythonPackagesStable) > 0 {
+		lines = append(lines, "COPY --from=deps-stable --link /dep-stable /usr/local/lib/python"+py+"/site-packages")
+	}
+	lines = append(lines, "COPY --from=deps --link /dep /usr/local/lib/python"+py+"/site-packages")
+	return strings.Join(lines, "\n")
 }
 
 func (g *Generator) runCommands() (string, error) {
@@ -395,7 +1066,15 @@ func (g *Generator) runCommands() (string, error) {
 	}
 
 	lines := []string{}
+	if env := g.Config.GPUArchEnv(); len(env) > 0 && g.Config.Build.GPU {
+		// Set before the run commands, so any CUDA extensions they compile are built for these GPUs
+		lines = append(lines, "ENV "+strings.Join(env, " "))
+	}
 	for _, run := range runCommands {
+		if run.GPU && !g.gpuRunDevice {
+			// Run in a container started from the built image, see SetGPURunDevice
+			continue
+		}
 		command := strings.TrimSpace(run.Command)
 		if strings.Contains(command, "\n") {
 			return "", fmt.Errorf(`One of the commands in 'run' contains a new line, which won't work. You need to create a new list item in YAML prefixed with '-' for each command.
@@ -403,14 +1082,17 @@ func (g *Generator) runCommands() (string, error) {
 This is the offending line: %s`, command)
 		}
 
-		if len(run.Mounts) > 0 {
-			mounts := []string{}
-			for _, mount := range run.Mounts {
-				if mount.Type == "secret" {
-					secretMount := fmt.Sprintf("--mount=type=secret,id=%s,target=%s", mount.ID, mount.Target)
-					mounts = append(mounts, secretMount)
-				}
+		mounts := []string{}
+		if run.GPU {
+			mounts = append(mounts, "--device=nvidia.com/gpu=all")
+		}
+		for _, mount := range run.Mounts {
+			if mount.Type == "secret" {
+				secretMount := fmt.Sprintf("--mount=type=secret,id=%s,target=%s", mount.ID, mount.Target)
+				mounts = append(mounts, secretMount)
 			}
+		}
+		if len(mounts) > 0 {
 			lines = append(lines, fmt.Sprintf("RUN %s %s", strings.Join(mounts, " "), command))
 		} else {
 			lines = append(lines, "RUN "+command)
@@ -419,17 +1101,31 @@ This is the offending line: %s`, command)
 	return strings.Join(lines, "\n"), nil
 }
 
+// verify returns the instruction that checks the predictor can be loaded, if build.verify is set. It runs after
+// the source is copied, so the build fails if predict.py or its dependencies can't be imported.
+func (g *Generator) verify() string {
+	if !g.Config.Build.Verify {
+		return ""
+	}
+	// Don't write bytecode, so the layer is empty
+	return "RUN PYTHONDONTWRITEBYTECODE=1 python -m cog.command.verify"
+}
+
 // writeTemp writes a temporary file that can be used as part of the build process
 // It returns the lines to add to Dockerfile to make it available and the filename it ends up as inside the container
 func (g *Generator) writeTemp(filename string, contents []byte) ([]string, string, error) {
-	path := filepath.Join(g.tmpDir, filename)
-	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+	tempPath := filepath.Join(g.tmpDir, filename)
+	if err := os.MkdirAll(filepath.Dir(tempPath), 0o755); err != nil {
 		return []string{}, "", fmt.Errorf("Failed to write %s: %w", filename, err)
 	}
-	if err := os.WriteFile(path, contents, 0o644); err != nil {
+	if err := os.WriteFile(tempPath, contents, 0o644); err != nil {
 		return []string{}, "", fmt.Errorf("Failed to write %s: %w", filename, err)
 	}
-	return []string{fmt.Sprintf("COPY %s /tmp/%s", filepath.Join(g.relativeTmpDir, filename), filename)}, "/tmp/" + filename, nil
+	if g.tempFiles == nil {
+		g.tempFiles = map[string]string{}
+	}
+	g.tempFiles[filename] = fmt.Sprintf("%x", sha256.Sum256(contents))
+	return []string{fmt.Sprintf("COPY %s /tmp/%s", path.Join(g.relativeTmpDir, filename), filename)}, "/tmp/" + filename, nil
 }
 
 func filterEmpty(list []string) []string {
@@ -450,9 +1146,16 @@ func (g *Generator) GenerateWeightsManifest() (*weights.Manifest, error) {
 			if err != nil {
 				return err
 			}
+			if err := g.ctx.Err(); err != nil {
+				return err
+			}
 			if info.IsDir() {
 				return nil
 			}
+			// These aren't in the weights image, so they don't change it
+			if len(withoutPaths([]string{filepath.ToSlash(path)}, g.Config.LazyWeightsPaths())) == 0 {
+				return nil
+			}
 
 			return m.AddFile(path)
 		})
@@ -462,6 +1165,9 @@ func (g *Generator) GenerateWeightsManifest() (*weights.Manifest, error) {
 	}
 
 	for _, path := range g.modelFiles {
+		if err := g.ctx.Err(); err != nil {
+			return nil, err
+		}
 		err := m.AddFile(path)
 		if err != nil {
 			return nil, err
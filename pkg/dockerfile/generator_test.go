@@ -1,10 +1,14 @@
 package dockerfile
 
 import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
 	"fmt"
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -36,8 +40,8 @@ func testPipInstallStage(relativeTmpDir string) string {
 ` + testInstallCog(relativeTmpDir)
 }
 
-func testInstallPython(version string) string {
-	return fmt.Sprintf(`ENV PATH="/root/.pyenv/shims:/root/.pyenv/bin:$PATH"
+func testInstallPythonDeps() string {
+	return `ENV PATH="/root/.pyenv/shims:/root/.pyenv/bin:$PATH"
 RUN --mount=type=cache,target=/var/cache/apt apt-get update -qq && apt-get install -qqy --no-install-recommends \
 	make \
 	build-essential \
@@ -58,7 +62,16 @@ RUN --mount=type=cache,target=/var/cache/apt apt-get update -qq && apt-get insta
 	git \
 	ca-certificates \
 	&& rm -rf /var/lib/apt/lists/*
-RUN curl -s -S -L https://raw.githubusercontent.com/pyenv/pyenv-installer/master/bin/pyenv-installer | bash && \
+`
+}
+
+func testPythonStage(version string) string {
+	return `FROM nvidia/cuda:11.8.0-cudnn8-runtime-ubuntu22.04 AS python
+ENV DEBIAN_FRONTEND=noninteractive
+ENV PYTHONUNBUFFERED=1
+ENV LD_LIBRARY_PATH=$LD_LIBRARY_PATH:/usr/lib/x86_64-linux-gnu:/usr/local/nvidia/lib64:/usr/local/nvidia/bin
+ENV NVIDIA_DRIVER_CAPABILITIES=all
+` + testInstallPythonDeps() + fmt.Sprintf(`RUN curl -s -S -L https://raw.githubusercontent.com/pyenv/pyenv-installer/master/bin/pyenv-installer | bash && \
 	git clone https://github.com/momo-lab/pyenv-install-latest.git "$(pyenv root)"/plugins/pyenv-install-latest && \
 	pyenv install-latest "%s" && \
 	pyenv global $(pyenv install-latest --print "%s") && \
@@ -116,13 +129,14 @@ predict: predict.py:Predictor
 
 	expected := `#syntax=docker/dockerfile:1.4
 ` + testPipInstallStage(gen.relativeTmpDir) + `
-FROM r8.im/replicate/cog-test-weights AS weights
-FROM nvidia/cuda:11.8.0-cudnn8-devel-ubuntu22.04
+` + testPythonStage("3.8") + `FROM r8.im/replicate/cog-test-weights AS weights
+FROM nvidia/cuda:11.8.0-cudnn8-runtime-ubuntu22.04
 ENV DEBIAN_FRONTEND=noninteractive
 ENV PYTHONUNBUFFERED=1
 ENV LD_LIBRARY_PATH=$LD_LIBRARY_PATH:/usr/lib/x86_64-linux-gnu:/usr/local/nvidia/lib64:/usr/local/nvidia/bin
 ENV NVIDIA_DRIVER_CAPABILITIES=all
-` + testTini() + testInstallPython("3.8") + `RUN --mount=type=bind,from=deps,source=/dep,target=/dep cp -rf /dep/* $(pyenv prefix)/lib/python*/site-packages || true
+` + testInstallPythonDeps() + testTini() + `COPY --from=python --link /root/.pyenv /root/.pyenv
+RUN --mount=type=bind,from=deps,source=/dep,target=/dep cp -rf /dep/* $(pyenv prefix)/lib/python*/site-packages || true
 WORKDIR /src
 EXPOSE 5000
 CMD ["python", "-m", "cog.server.http"]
@@ -181,6 +195,55 @@ COPY . /src`
 pandas==1.2.0.12`, string(requirements))
 }
 
+func TestGenerateWithStablePythonPackages(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  gpu: false
+  python_packages_stable:
+    - pandas==1.2.0.12
+  python_packages:
+    - requests==2.31.0
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(""))
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	actual, err := gen.GenerateDockerfileWithoutSeparateWeights()
+	require.NoError(t, err)
+
+	expected := `#syntax=docker/dockerfile:1.4
+FROM python:3.8 as deps-stable
+COPY ` + gen.relativeTmpDir + `/requirements-stable.txt /tmp/requirements-stable.txt
+RUN --mount=type=cache,target=/root/.cache/pip pip install -t /dep-stable -r /tmp/requirements-stable.txt && pip freeze --path /dep-stable > /tmp/constraints-stable.txt
+FROM deps-stable as deps
+COPY ` + gen.relativeTmpDir + `/cog-0.0.1.dev-py3-none-any.whl /tmp/cog-0.0.1.dev-py3-none-any.whl
+RUN --mount=type=cache,target=/root/.cache/pip pip install -t /dep -c /tmp/constraints-stable.txt /tmp/cog-0.0.1.dev-py3-none-any.whl
+COPY ` + gen.relativeTmpDir + `/requirements.txt /tmp/requirements.txt
+RUN --mount=type=cache,target=/root/.cache/pip pip install -t /dep -c /tmp/constraints-stable.txt -r /tmp/requirements.txt
+RUN cd /dep-stable && for f in *; do if [ "$f" != bin ]; then rm -rf "/dep/$f"; fi; done
+FROM python:3.8-slim
+ENV DEBIAN_FRONTEND=noninteractive
+ENV PYTHONUNBUFFERED=1
+ENV LD_LIBRARY_PATH=$LD_LIBRARY_PATH:/usr/lib/x86_64-linux-gnu:/usr/local/nvidia/lib64:/usr/local/nvidia/bin
+ENV NVIDIA_DRIVER_CAPABILITIES=all
+` + testTini() + `COPY --from=deps-stable --link /dep-stable /usr/local/lib/python3.8/site-packages
+COPY --from=deps --link /dep /usr/local/lib/python3.8/site-packages
+WORKDIR /src
+EXPOSE 5000
+CMD ["python", "-m", "cog.server.http"]
+COPY . /src`
+
+	require.Equal(t, expected, actual)
+
+	requirements, err := os.ReadFile(path.Join(gen.tmpDir, "requirements-stable.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "pandas==1.2.0.12", string(requirements))
+}
+
 func TestGenerateFullGPU(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -209,14 +272,14 @@ predict: predict.py:Predictor
 ` + testPipInstallStage(gen.relativeTmpDir) + `
 COPY ` + gen.relativeTmpDir + `/requirements.txt /tmp/requirements.txt
 RUN --mount=type=cache,target=/root/.cache/pip pip install -t /dep -r /tmp/requirements.txt
-FROM r8.im/replicate/cog-test-weights AS weights
-FROM nvidia/cuda:11.8.0-cudnn8-devel-ubuntu22.04
+` + testPythonStage("3.8") + `FROM r8.im/replicate/cog-test-weights AS weights
+FROM nvidia/cuda:11.8.0-cudnn8-runtime-ubuntu22.04
 ENV DEBIAN_FRONTEND=noninteractive
 ENV PYTHONUNBUFFERED=1
 ENV LD_LIBRARY_PATH=$LD_LIBRARY_PATH:/usr/lib/x86_64-linux-gnu:/usr/local/nvidia/lib64:/usr/local/nvidia/bin
 ENV NVIDIA_DRIVER_CAPABILITIES=all
-` + testTini() +
-		testInstallPython("3.8") + `RUN --mount=type=cache,target=/var/cache/apt apt-get update -qq && apt-get install -qqy ffmpeg cowsay && rm -rf /var/lib/apt/lists/*
+` + testInstallPythonDeps() + testTini() + `RUN --mount=type=cache,target=/var/cache/apt apt-get update -qq && apt-get install -qqy ffmpeg cowsay && rm -rf /var/lib/apt/lists/*
+COPY --from=python --link /root/.pyenv /root/.pyenv
 RUN --mount=type=bind,from=deps,source=/dep,target=/dep cp -rf /dep/* $(pyenv prefix)/lib/python*/site-packages || true
 RUN cowsay moo
 WORKDIR /src
@@ -362,14 +425,14 @@ COPY root-large /src/root-large`
 ` + testPipInstallStage(gen.relativeTmpDir) + `
 COPY ` + gen.relativeTmpDir + `/requirements.txt /tmp/requirements.txt
 RUN --mount=type=cache,target=/root/.cache/pip pip install -t /dep -r /tmp/requirements.txt
-FROM r8.im/replicate/cog-test-weights AS weights
-FROM nvidia/cuda:11.8.0-cudnn8-devel-ubuntu22.04
+` + testPythonStage("3.8") + `FROM r8.im/replicate/cog-test-weights AS weights
+FROM nvidia/cuda:11.8.0-cudnn8-runtime-ubuntu22.04
 ENV DEBIAN_FRONTEND=noninteractive
 ENV PYTHONUNBUFFERED=1
 ENV LD_LIBRARY_PATH=$LD_LIBRARY_PATH:/usr/lib/x86_64-linux-gnu:/usr/local/nvidia/lib64:/usr/local/nvidia/bin
 ENV NVIDIA_DRIVER_CAPABILITIES=all
-` + testTini() +
-		testInstallPython("3.8") + `RUN --mount=type=cache,target=/var/cache/apt apt-get update -qq && apt-get install -qqy ffmpeg cowsay && rm -rf /var/lib/apt/lists/*
+` + testInstallPythonDeps() + testTini() + `RUN --mount=type=cache,target=/var/cache/apt apt-get update -qq && apt-get install -qqy ffmpeg cowsay && rm -rf /var/lib/apt/lists/*
+COPY --from=python --link /root/.pyenv /root/.pyenv
 RUN --mount=type=bind,from=deps,source=/dep,target=/dep cp -rf /dep/* $(pyenv prefix)/lib/python*/site-packages || true
 RUN cowsay moo
 COPY --from=weights --link /src/checkpoints /src/checkpoints
@@ -449,3 +512,1021 @@ COPY . /src`
 
 	require.Equal(t, expected, actual)
 }
+
+func TestGenerateWithConcurrency(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  gpu: false
+predict: predict.py:Predictor
+concurrency:
+  max: 4
+  queue_size: 16
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(""))
+	require.Equal(t, 4, conf.MaxConcurrency())
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	actual, err := gen.GenerateDockerfileWithoutSeparateWeights()
+	require.NoError(t, err)
+
+	require.Contains(t, actual, `ENV COG_MAX_CONCURRENCY=4
+ENV COG_QUEUE_SIZE=16
+WORKDIR /src`)
+}
+
+func TestGenerateWithPredictTimeout(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  gpu: false
+predict: predict.py:Predictor
+predict_timeout: 300
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(""))
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	actual, err := gen.GenerateDockerfileWithoutSeparateWeights()
+	require.NoError(t, err)
+
+	require.Contains(t, actual, `ENV COG_PREDICT_TIMEOUT=300
+WORKDIR /src`)
+}
+
+func TestGenerateWithOpenAI(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  gpu: false
+predict: predict.py:Predictor
+openai: true
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(""))
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	actual, err := gen.GenerateDockerfileWithoutSeparateWeights()
+	require.NoError(t, err)
+
+	require.Contains(t, actual, `ENV COG_OPENAI=true
+WORKDIR /src`)
+}
+
+func TestGenerateWithAuth(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  gpu: false
+predict: predict.py:Predictor
+auth: true
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(""))
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	actual, err := gen.GenerateDockerfileWithoutSeparateWeights()
+	require.NoError(t, err)
+
+	require.Contains(t, actual, `ENV COG_AUTH_REQUIRED=true
+WORKDIR /src`)
+	require.NotContains(t, actual, "COG_AUTH_TOKEN")
+}
+
+func TestGenerateWithTLS(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  gpu: false
+predict: predict.py:Predictor
+serve:
+  tls:
+    cert: certs/server.crt
+    key: certs/server.key
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(""))
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	actual, err := gen.GenerateDockerfileWithoutSeparateWeights()
+	require.NoError(t, err)
+	require.Contains(t, actual, `ENV COG_TLS_CERT_FILE=/src/certs/server.crt COG_TLS_KEY_FILE=/src/certs/server.key
+WORKDIR /src`)
+
+	conf, err = config.FromYAML([]byte(`
+build:
+  gpu: false
+predict: predict.py:Predictor
+serve:
+  tls:
+    auto: true
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(""))
+
+	gen, err = NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	actual, err = gen.GenerateDockerfileWithoutSeparateWeights()
+	require.NoError(t, err)
+	require.Contains(t, actual, `ENV COG_TLS_AUTO=true
+WORKDIR /src`)
+	require.Contains(t, actual, "apt-get install -qqy openssl")
+}
+
+func TestGenerateWithServeLimits(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  gpu: false
+predict: predict.py:Predictor
+serve:
+  cors:
+    origins:
+      - https://example.com
+      - http://localhost:3000
+  max_request_size: 1GB
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(""))
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	actual, err := gen.GenerateDockerfileWithoutSeparateWeights()
+	require.NoError(t, err)
+	require.Contains(t, actual, `ENV COG_CORS_ORIGINS=https://example.com,http://localhost:3000
+ENV COG_MAX_REQUEST_SIZE=1000000000
+WORKDIR /src`)
+}
+
+func TestGenerateSageMakerFormat(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  gpu: false
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(""))
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	require.Error(t, gen.SetFormat("unknown"))
+	require.NoError(t, gen.SetFormat(FormatSageMaker))
+	actual, err := gen.GenerateDockerfileWithoutSeparateWeights()
+	require.NoError(t, err)
+
+	require.Contains(t, actual, `ENV COG_API_FORMAT=sagemaker PORT=8080`)
+	require.Contains(t, actual, `EXPOSE 8080
+CMD ["serve"]`)
+	require.NotContains(t, actual, "EXPOSE 5000")
+}
+
+func TestGenerateVertexFormat(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  gpu: false
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(""))
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	require.NoError(t, gen.SetFormat(FormatVertex))
+	actual, err := gen.GenerateDockerfileWithoutSeparateWeights()
+	require.NoError(t, err)
+
+	require.Contains(t, actual, `ENV COG_API_FORMAT=vertex AIP_HTTP_PORT=8080 AIP_HEALTH_ROUTE=/health AIP_PREDICT_ROUTE=/predict
+WORKDIR /src
+EXPOSE 8080
+CMD ["python", "-m", "cog.server.http"]`)
+}
+
+func TestWriteStandalone(t *testing.T) {
+	tmpDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "predict.py"), []byte("# predictor\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "Dockerfile"), []byte("FROM scratch\n"), 0o644))
+	require.NoError(t, os.MkdirAll(filepath.Join(tmpDir, "weights"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "weights", "model.bin"), []byte("weights"), 0o644))
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  gpu: false
+  python_packages:
+    - torch==2.0.1
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(""))
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	gen.SetUseCudaBaseImage("true")
+	contextDir := filepath.Join(tmpDir, "context")
+	require.NoError(t, gen.WriteStandalone(contextDir))
+	require.NoError(t, gen.Cleanup())
+
+	dockerfile, err := os.ReadFile(filepath.Join(contextDir, "Dockerfile"))
+	require.NoError(t, err)
+	require.Contains(t, string(dockerfile), "COPY .cog/build/cog-0.0.1.dev-py3-none-any.whl /tmp/cog-0.0.1.dev-py3-none-any.whl\n")
+	require.Contains(t, string(dockerfile), "COPY .cog/build/requirements.txt /tmp/requirements.txt\n")
+	require.Contains(t, string(dockerfile), "COPY . /src\n")
+
+	require.FileExists(t, filepath.Join(contextDir, ".cog", "build", "cog-0.0.1.dev-py3-none-any.whl"))
+	requirements, err := os.ReadFile(filepath.Join(contextDir, ".cog", "build", "requirements.txt"))
+	require.NoError(t, err)
+	require.Contains(t, string(requirements), "torch==2.0.1")
+	require.FileExists(t, filepath.Join(contextDir, "predict.py"))
+	require.FileExists(t, filepath.Join(contextDir, "weights", "model.bin"))
+	require.NoDirExists(t, filepath.Join(contextDir, "context"))
+
+	// The project's own Dockerfile is left alone
+	original, err := os.ReadFile(filepath.Join(tmpDir, "Dockerfile"))
+	require.NoError(t, err)
+	require.Equal(t, "FROM scratch\n", string(original))
+
+	require.Error(t, gen.WriteStandalone(contextDir))
+}
+
+func TestSection(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  gpu: true
+  system_packages:
+    - ffmpeg
+  python_packages:
+    - torch==2.0.1
+  run:
+    - "cowsay moo"
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(""))
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	_, _, _, err = gen.Generate("r8.im/replicate/cog-test")
+	require.NoError(t, err)
+
+	require.Equal(t, SectionBaseImage, gen.Section("FROM docker.io/nvidia/cuda:11.8.0-cudnn8-devel-ubuntu22.04@sha256:abc"))
+	require.Equal(t, SectionWeights, gen.Section("FROM r8.im/replicate/cog-test-weights:latest"))
+	require.Equal(t, SectionSystemPackages, gen.Section("RUN --mount=type=cache,target=/var/cache/apt apt-get update -qq && apt-get install -qqy ffmpeg && rm -rf /var/lib/apt/lists/*"))
+	require.Equal(t, SectionPythonPackages, gen.Section("RUN --mount=type=cache,target=/root/.cache/pip pip install -t /dep -r /tmp/requirements.txt"))
+	require.Equal(t, SectionRun, gen.Section("RUN cowsay moo"))
+	require.Equal(t, SectionSource, gen.Section("COPY . /src"))
+	require.Equal(t, SectionServer, gen.Section("EXPOSE 5000"))
+	// BuildKit joins lines that are continued with a backslash
+	require.Equal(t, SectionSetup, gen.Section(`RUN --mount=type=cache,target=/var/cache/apt set -eux; apt-get update -qq; apt-get install -qqy --no-install-recommends curl; rm -rf /var/lib/apt/lists/*; TINI_VERSION=v0.19.0; TINI_ARCH="$(dpkg --print-architecture)"; curl -sSL -o /sbin/tini "https://github.com/krallin/tini/releases/download/${TINI_VERSION}/tini-${TINI_ARCH}"; chmod +x /sbin/tini`))
+	require.Equal(t, SectionPython, gen.Section(`RUN curl -s -S -L https://raw.githubusercontent.com/pyenv/pyenv-installer/master/bin/pyenv-installer | bash &&	git clone https://github.com/momo-lab/pyenv-install-latest.git "$(pyenv root)"/plugins/pyenv-install-latest &&	pyenv install-latest "3.8" &&	pyenv global $(pyenv install-latest --print "3.8") &&	pip install "wheel<1"`))
+	require.Equal(t, "label", gen.Section("LABEL foo=bar"))
+}
+
+func TestGenerateGPUArch(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  gpu: true
+  gpu_arch: [86, 80, 90]
+  run:
+    - "TORCH_CUDA_ARCH_LIST= pip install ./kernels"
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(""))
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	actual, err := gen.GenerateDockerfileWithoutSeparateWeights()
+	require.NoError(t, err)
+
+	require.Contains(t, actual, `ENV TORCH_CUDA_ARCH_LIST="8.0;8.6;9.0" CUDAARCHS="80;86;90" NVCC_APPEND_FLAGS="-gencode=arch=compute_80,code=sm_80 -gencode=arch=compute_86,code=sm_86 -gencode=arch=compute_90,code=sm_90"
+RUN TORCH_CUDA_ARCH_LIST= pip install ./kernels`)
+}
+
+func TestGenerateCompiledWheels(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  gpu: true
+  python_version: "3.11"
+  python_packages:
+    - torch==2.3.1
+    - flash-attn==2.3.3
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(""))
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	actual, err := gen.GenerateDockerfileWithoutSeparateWeights()
+	require.NoError(t, err)
+
+	require.Contains(t, actual, `FROM nvidia/cuda:12.1.1-cudnn8-devel-ubuntu22.04 AS wheels
+`)
+	require.Contains(t, actual, `COPY --from=python --link /root/.pyenv /root/.pyenv
+RUN --mount=type=cache,target=/root/.cache/pip pip install torch==2.3.1 --extra-index-url https://download.pytorch.org/whl/cu121 packaging ninja && MAX_JOBS=4 pip wheel --no-deps --no-build-isolation -w /wheels 'flash-attn==2.3.3'
+`)
+	require.Contains(t, actual, `RUN --mount=type=bind,from=deps,source=/dep,target=/dep cp -rf /dep/* $(pyenv prefix)/lib/python*/site-packages || true
+RUN --mount=type=bind,from=wheels,source=/wheels,target=/wheels pip install --no-deps /wheels/*.whl
+`)
+
+	requirements, err := os.ReadFile(path.Join(gen.tmpDir, "requirements.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "--extra-index-url https://download.pytorch.org/whl/cu121\ntorch==2.3.1", string(requirements))
+}
+
+func TestGenerateQuantized(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  python_packages:
+    - transformers==4.44.2
+  optimize:
+    quantize:
+      method: gguf-q4
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(""))
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	gen.fileWalker = func(root string, walkFn filepath.WalkFunc) error {
+		for _, path := range []string{"models/large-a", "root-large"} {
+			walkFn(path, mockFileInfo{size: sizeThreshold}, nil)
+		}
+		return nil
+	}
+	gen.SetQuantize(true)
+
+	_, runnerDockerfile, _, err := gen.Generate("r8.im/replicate/cog-test")
+	require.NoError(t, err)
+
+	require.Contains(t, runnerDockerfile, `FROM r8.im/replicate/cog-test-weights AS weights
+FROM python:3.8-slim AS quantize
+ENV DEBIAN_FRONTEND=noninteractive
+`)
+	require.Contains(t, runnerDockerfile, `COPY --from=deps --link /dep /usr/local/lib/python3.8/site-packages
+RUN --mount=type=cache,target=/var/cache/apt apt-get update -qq && apt-get install -qqy --no-install-recommends git build-essential cmake && rm -rf /var/lib/apt/lists/*
+RUN --mount=type=cache,target=/root/.cache/pip git clone --depth 1 --branch b4000 https://github.com/ggerganov/llama.cpp /llama.cpp && \
+`)
+	require.Contains(t, runnerDockerfile, `ENV LLAMA_CPP=/llama.cpp
+COPY --from=weights --link /src /src
+RUN python -m cog.command.quantize --method gguf-q4 /src/models /src/root-large
+FROM python:3.8-slim
+`)
+	require.Contains(t, runnerDockerfile, "COPY --from=quantize --link /src/models /src/models")
+	require.Contains(t, runnerDockerfile, "COPY --from=quantize --link /src/root-large /src/root-large")
+}
+
+func TestGenerateQuantizedOnGPU(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  gpu: true
+  python_packages:
+    - transformers==4.44.2
+  optimize:
+    quantize:
+      method: awq
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(""))
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	gen.fileWalker = func(root string, walkFn filepath.WalkFunc) error {
+		return walkFn("models/large-a", mockFileInfo{size: sizeThreshold}, nil)
+	}
+	gen.SetQuantize(true)
+
+	// AWQ can't run in a build without a GPU
+	_, _, _, err = gen.Generate("r8.im/replicate/cog-test")
+	require.ErrorContains(t, err, "Quantizing with awq needs a GPU, but the Docker builder doesn't have one")
+
+	// So it's quantized in a container started from the quantize stage instead
+	quantizeDockerfile, _, err := gen.GenerateQuantize("r8.im/replicate/cog-test")
+	require.NoError(t, err)
+	require.True(t, strings.HasSuffix(quantizeDockerfile, `RUN --mount=type=cache,target=/root/.cache/pip pip install autoawq==0.2.6
+COPY --from=weights --link /src /src`), quantizeDockerfile)
+	require.Equal(t, "python -m cog.command.quantize --method awq /src/models", gen.QuantizeCommand())
+
+	gen.SetQuantizeImage("r8.im/replicate/cog-test:awq-quantize")
+	_, runnerDockerfile, _, err := gen.Generate("r8.im/replicate/cog-test")
+	require.NoError(t, err)
+	require.Contains(t, runnerDockerfile, "FROM r8.im/replicate/cog-test-weights AS weights\nFROM r8.im/replicate/cog-test:awq-quantize AS quantize\n")
+	require.Contains(t, runnerDockerfile, "COPY --from=quantize --link /src/models /src/models")
+	require.NotContains(t, runnerDockerfile, "cog.command.quantize")
+
+	// If the builder has a GPU, it's quantized in the build
+	gen.SetQuantizeImage("")
+	gen.SetGPURunDevice(true)
+	_, runnerDockerfile, _, err = gen.Generate("r8.im/replicate/cog-test")
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(runnerDockerfile, "#syntax=docker/dockerfile:1-labs\n"))
+	require.Contains(t, runnerDockerfile, "RUN --device=nvidia.com/gpu=all python -m cog.command.quantize --method awq /src/models\n")
+}
+
+func TestGenerateWeightsProfiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(path.Join(tmpDir, "weights", "int8"), 0o755))
+	require.NoError(t, os.WriteFile(path.Join(tmpDir, "weights", "int8", "model.safetensors"), []byte("weights"), 0o644))
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  python_version: "3.11"
+weights:
+  profiles:
+    - name: fp16
+      path: weights/fp16
+      default: true
+    - name: int8
+      path: weights/int8
+      url: https://example.com/int8.tar
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(""))
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	gen.fileWalker = func(root string, walkFn filepath.WalkFunc) error {
+		for _, path := range []string{"weights/fp16/model.safetensors", "weights/int8/model.safetensors"} {
+			walkFn(path, mockFileInfo{size: sizeThreshold}, nil)
+		}
+		return nil
+	}
+
+	weightsDockerfile, runnerDockerfile, dockerignore, err := gen.Generate("r8.im/replicate/cog-test")
+	require.NoError(t, err)
+
+	require.Contains(t, weightsDockerfile, "COPY weights/fp16 /src/weights/fp16")
+	require.NotContains(t, weightsDockerfile, "weights/int8")
+	require.Contains(t, dockerignore, "weights/int8\nweights/int8/**/*\n")
+	require.Contains(t, runnerDockerfile, "COPY --from=weights --link /src/weights/fp16 /src/weights/fp16")
+	require.Contains(t, runnerDockerfile, "COPY "+gen.relativeTmpDir+"/weights.json /etc/cog/weights.json\nCOPY . /src")
+
+	profiles, err := os.ReadFile(path.Join(gen.tmpDir, "weights.json"))
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+  "default": "fp16",
+  "profiles": [
+    {"name": "fp16", "path": "weights/fp16"},
+    {"name": "int8", "path": "weights/int8", "url": "https://example.com/int8.tar", "files": {"weights/int8/model.safetensors": {"crc32": "5873d21a"}}}
+  ]
+}`, string(profiles))
+}
+
+func TestGenerateLazyWeights(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	conf, err := config.FromYAML([]byte(`
+weights:
+  lazy: true
+  files:
+    - url: https://example.com/model.safetensors
+      path: weights/model.safetensors
+      sha256: 9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(""))
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	gen.fileWalker = func(root string, walkFn filepath.WalkFunc) error {
+		walkFn("weights/model.safetensors", mockFileInfo{size: sizeThreshold}, nil)
+		return nil
+	}
+
+	weightsDockerfile, runnerDockerfile, dockerignore, err := gen.Generate("r8.im/replicate/cog-test")
+	require.NoError(t, err)
+
+	require.NotContains(t, weightsDockerfile, "COPY weights")
+	require.Contains(t, dockerignore, "weights/model.safetensors\n")
+	require.NotContains(t, runnerDockerfile, "COPY --from=weights")
+	require.Contains(t, runnerDockerfile, "COPY "+gen.relativeTmpDir+"/weights.json /etc/cog/weights.json\n")
+
+	weightsConfig, err := os.ReadFile(path.Join(gen.tmpDir, "weights.json"))
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+  "files": [
+    {"url": "https://example.com/model.safetensors", "path": "weights/model.safetensors", "sha256": "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"}
+  ]
+}`, string(weightsConfig))
+}
+
+func TestGenerateGPURunCommands(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  gpu: true
+  run:
+    - pip install tensorrt
+    - command: python build_engine.py
+      gpu: true
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(""))
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	actual, err := gen.GenerateDockerfileWithoutSeparateWeights()
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(actual, "#syntax=docker/dockerfile:1.4\n"))
+	require.Contains(t, actual, "RUN pip install tensorrt\n")
+	require.NotContains(t, actual, "build_engine.py")
+
+	gen.SetGPURunDevice(true)
+	actual, err = gen.GenerateDockerfileWithoutSeparateWeights()
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(actual, "#syntax=docker/dockerfile:1-labs\n"))
+	require.Contains(t, actual, "RUN pip install tensorrt\nRUN --device=nvidia.com/gpu=all python build_engine.py\n")
+}
+
+func TestGenerateVerify(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  verify: true
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(""))
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	actual, err := gen.GenerateDockerfileWithoutSeparateWeights()
+	require.NoError(t, err)
+	require.True(t, strings.HasSuffix(actual, "COPY . /src\nRUN PYTHONDONTWRITEBYTECODE=1 python -m cog.command.verify"))
+	require.Equal(t, SectionVerify, gen.Section("RUN PYTHONDONTWRITEBYTECODE=1 python -m cog.command.verify"))
+
+	base, err := gen.GenerateBase()
+	require.NoError(t, err)
+	require.NotContains(t, base, "cog.command.verify")
+}
+
+func TestGenerateIgnore(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  ignore:
+    - data/
+    - "**/*.ckpt"
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(""))
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	gen.fileWalker = func(root string, walkFn filepath.WalkFunc) error {
+		for _, p := range []string{"data/train.bin", "checkpoints/old.ckpt", "weights/model.bin"} {
+			walkFn(p, mockFileInfo{size: sizeThreshold}, nil)
+		}
+		return nil
+	}
+
+	weightsDockerfile, _, dockerignore, err := gen.Generate("r8.im/replicate/cog-test")
+	require.NoError(t, err)
+	require.Contains(t, weightsDockerfile, "COPY weights /src/weights")
+	require.NotContains(t, weightsDockerfile, "data")
+	require.NotContains(t, weightsDockerfile, "checkpoints")
+	require.True(t, strings.HasSuffix(dockerignore, "data/\n**/*.ckpt\n"))
+	require.Equal(t, "data/\n**/*.ckpt\n", gen.Dockerignore())
+}
+
+func TestGenerateSourceOnlyImports(t *testing.T) {
+	tmpDir := t.TempDir()
+	for name, contents := range map[string]string{
+		"predict.py":         "from models import unet\n",
+		"models/__init__.py": "",
+		"models/unet.py":     "",
+		"configs/base.json":  "",
+		"notebooks/a.ipynb":  "",
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(tmpDir, name)), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, name), []byte(contents), 0o644))
+	}
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  source:
+    only_imports: true
+    include:
+      - configs/*.json
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(""))
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	gen.fileWalker = func(root string, walkFn filepath.WalkFunc) error {
+		for _, p := range []string{"predict.py", "models/unet.py", "configs/base.json", "notebooks/a.ipynb"} {
+			walkFn(p, mockFileInfo{size: 100}, nil)
+		}
+		walkFn("weights/model.bin", mockFileInfo{size: sizeThreshold}, nil)
+		return nil
+	}
+
+	actual, err := gen.GenerateDockerfileWithoutSeparateWeights()
+	require.NoError(t, err)
+	require.NotContains(t, actual, "COPY . /src")
+	require.Contains(t, actual, `COPY cog.yaml /src/cog.yaml
+COPY configs /src/configs
+COPY models /src/models
+COPY predict.py /src/predict.py
+COPY weights /src/weights`)
+	require.Equal(t, `# only the files the predictor needs, because build.source.only_imports is set
+*
+!cog.yaml
+!configs/base.json
+!models/__init__.py
+!models/unet.py
+!predict.py
+!weights
+!`+gen.relativeTmpDir+"\n", gen.Dockerignore())
+
+	_, runner, dockerignore, err := gen.Generate("r8.im/replicate/cog-test")
+	require.NoError(t, err)
+	require.NotContains(t, runner, "COPY weights /src/weights")
+	require.Contains(t, runner, "COPY --from=weights --link /src/weights /src/weights")
+	require.NotContains(t, dockerignore, "!weights\n")
+}
+
+func TestGenerateTemplates(t *testing.T) {
+	tmpDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(path.Join(tmpDir, "templates"), 0o755))
+	require.NoError(t, os.WriteFile(path.Join(tmpDir, "templates", "system_packages.tmpl"), []byte(`RUN --mount=type=cache,target=/var/cache/apt apt-get update && apt-get install -y{{range .Config.Build.SystemPackages}} {{.}}{{end}} && /usr/local/bin/scan-packages
+`), 0o644))
+	require.NoError(t, os.WriteFile(path.Join(tmpDir, "templates", "tini.tmpl"), []byte("{{.Default}}\nRUN echo {{.BaseImage}} > /etc/base-image\n"), 0o644))
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  system_packages:
+    - ffmpeg
+  templates:
+    system_packages: templates/system_packages.tmpl
+    tini: templates/tini.tmpl
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(""))
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	actual, err := gen.GenerateDockerfileWithoutSeparateWeights()
+	require.NoError(t, err)
+
+	require.Contains(t, actual, `ENTRYPOINT ["/sbin/tini", "--"]
+RUN echo python:3.8-slim > /etc/base-image
+RUN --mount=type=cache,target=/var/cache/apt apt-get update && apt-get install -y ffmpeg && /usr/local/bin/scan-packages
+COPY --from=deps`)
+	require.Equal(t, SectionSystemPackages, gen.Section("RUN --mount=type=cache,target=/var/cache/apt apt-get update && apt-get install -y ffmpeg && /usr/local/bin/scan-packages"))
+
+	conf.Build.Templates = map[string]string{"python": "templates/tini.tmpl"}
+	_, err = gen.GenerateDockerfileWithoutSeparateWeights()
+	require.ErrorContains(t, err, "Unknown template 'python' in build.templates")
+}
+
+func TestGenerateCACertificates(t *testing.T) {
+	tmpDir := t.TempDir()
+	certificate := `-----BEGIN CERTIFICATE-----
+MIIBizCCATGgAwIBAgIUHs7iawhXUj8kTXpoStdQczn9pNIwCgYIKoZIzj0EAwIw
+GzEZMBcGA1UEAwwQRXhhbXBsZSBQcm94eSBDQTAeFw0yNjEwMTcwMzQyMjZaFw0z
+NjEwMTQwMzQyMjZaMBsxGTAXBgNVBAMMEEV4YW1wbGUgUHJveHkgQ0EwWTATBgcq
+hkjOPQIBBggqhkjOPQMBBwNCAASDZJg369kuBIjMsZ/gRlS4PzI52YCpcpQ9OTk9
+basfQSuEdh1ccDIFcTy4FTBvOp6VBW6L16nH9SQxX+nkQy0ro1MwUTAdBgNVHQ4E
+FgQUUGY2zIVNVkuGd9I3wueobDTI+g8wHwYDVR0jBBgwFoAUUGY2zIVNVkuGd9I3
+wueobDTI+g8wDwYDVR0TAQH/BAUwAwEB/zAKBggqhkjOPQQDAgNIADBFAiEAoLsl
+czidgN5awLkCZOtpndQeV8fIZbEPVVufO2QuoVwCIHgyOLr86CdrcdZKQ/ePCPYN
+GDv6hzofMqKevTLqeXs1
+-----END CERTIFICATE-----
+`
+	require.NoError(t, os.WriteFile(path.Join(tmpDir, "proxy.crt"), []byte(certificate), 0o644))
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  gpu: true
+  cuda: "11.8"
+  python_packages_stable:
+    - numpy==1.26.4
+  ca_certificates:
+    - proxy.crt
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(tmpDir))
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	actual, err := gen.GenerateDockerfileWithoutSeparateWeights()
+	require.NoError(t, err)
+
+	caCertificates := `COPY ` + gen.relativeTmpDir + `/cog-ca-certificates.crt /usr/local/share/ca-certificates/cog-ca-certificates.crt
+RUN mkdir -p /etc/ssl/certs && cat /usr/local/share/ca-certificates/cog-ca-certificates.crt >> /etc/ssl/certs/ca-certificates.crt
+ENV SSL_CERT_FILE=/etc/ssl/certs/ca-certificates.crt REQUESTS_CA_BUNDLE=/etc/ssl/certs/ca-certificates.crt PIP_CERT=/etc/ssl/certs/ca-certificates.crt`
+	// Every stage that reaches the internet trusts the certificates before it does
+	require.Equal(t, 3, strings.Count(actual, caCertificates))
+	require.Contains(t, actual, "FROM python:3.8 as deps-stable\n"+caCertificates+"\n")
+	require.Contains(t, actual, " AS python\n"+gen.preamble()+"\n")
+	require.Less(t, strings.Index(actual, "ENV NVIDIA_DRIVER_CAPABILITIES=all\n"+caCertificates), strings.Index(actual, "/sbin/tini"))
+
+	written, err := os.ReadFile(path.Join(gen.tmpDir, "cog-ca-certificates.crt"))
+	require.NoError(t, err)
+	require.Equal(t, certificate, string(written))
+}
+
+func TestGenerateTimezoneAndLocale(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  timezone: Europe/Berlin
+  locale: en_US.UTF-8
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(""))
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	actual, err := gen.GenerateBase()
+	require.NoError(t, err)
+	require.Contains(t, actual, `RUN --mount=type=cache,target=/var/cache/apt apt-get update -qq && apt-get install -qqy tzdata locales && rm -rf /var/lib/apt/lists/*
+RUN ln -snf /usr/share/zoneinfo/Europe/Berlin /etc/localtime && echo Europe/Berlin > /etc/timezone
+ENV TZ=Europe/Berlin
+RUN localedef -i en_US -c -f UTF-8 -A /usr/share/locale/locale.alias en_US.UTF-8
+ENV LANG=en_US.UTF-8 LC_ALL=en_US.UTF-8
+`)
+}
+
+func TestGenerateEnv(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  python_packages_stable:
+    - numpy==1.26.4
+  env:
+    HF_HOME: /src/.cache/huggingface
+    PATH: /opt/tools/bin:$PATH
+    GREETING: say "hi"
+runtime:
+  env:
+    TOKENIZERS_PARALLELISM: false
+    MAX_BATCH: 8
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(""))
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	actual, err := gen.GenerateDockerfileWithoutSeparateWeights()
+	require.NoError(t, err)
+
+	buildEnv := `ENV GREETING="say \"hi\"" HF_HOME="/src/.cache/huggingface" PATH="/opt/tools/bin:$PATH"`
+	// The run commands and Python packages in every stage are installed with build.env
+	require.Equal(t, 2, strings.Count(actual, buildEnv))
+	require.Contains(t, actual, "FROM python:3.8 as deps-stable\n"+buildEnv+"\n")
+	require.Contains(t, actual, "FROM python:3.8-slim\n"+gen.preamble()+"\n")
+	// runtime.env is set late, so changing it doesn't rebuild the layers before it
+	require.Contains(t, actual, `ENV MAX_BATCH="8" TOKENIZERS_PARALLELISM="false"`)
+	require.Less(t, strings.Index(actual, "pip install"), strings.Index(actual, "ENV MAX_BATCH"))
+}
+
+func TestGenerateArgs(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  python_packages_stable:
+    - numpy==1.26.4
+  args:
+    MODEL_REVISION: main
+    EXTRA_INDEX_URL:
+  env:
+    MODEL_REVISION: $MODEL_REVISION
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(""))
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	actual, err := gen.GenerateDockerfileWithoutSeparateWeights()
+	require.NoError(t, err)
+
+	// ARGs only last until the end of a stage, so every stage declares them, before build.env can use them
+	args := "ARG EXTRA_INDEX_URL\nARG MODEL_REVISION=\"main\"\nENV MODEL_REVISION=\"$MODEL_REVISION\""
+	require.Equal(t, 2, strings.Count(actual, args))
+	require.Contains(t, actual, "FROM python:3.8 as deps-stable\n"+args+"\n")
+	require.Contains(t, actual, "FROM deps-stable as deps\nARG EXTRA_INDEX_URL\nARG MODEL_REVISION=\"main\"\n")
+	require.Contains(t, actual, "FROM python:3.8-slim\n"+gen.preamble()+"\n")
+}
+
+func TestGenerateSignedWeightsManifest(t *testing.T) {
+	tmpDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(path.Join(tmpDir, "weights"), 0o755))
+	require.NoError(t, os.WriteFile(path.Join(tmpDir, "weights", "model.safetensors"), []byte("weights"), 0o644))
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  python_version: "3.11"
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(""))
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	gen.fileWalker = func(root string, walkFn filepath.WalkFunc) error {
+		return walkFn("weights/model.safetensors", mockFileInfo{size: sizeThreshold}, nil)
+	}
+	key := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	gen.SetWeightsSigningKey(key)
+
+	_, runnerDockerfile, _, err := gen.Generate("r8.im/replicate/cog-test")
+	require.NoError(t, err)
+	require.Contains(t, runnerDockerfile, "COPY "+gen.relativeTmpDir+"/weights-manifest.json /etc/cog/weights-manifest.json\n"+
+		"COPY "+gen.relativeTmpDir+"/weights-manifest.json.sig /etc/cog/weights-manifest.json.sig\n")
+	require.NotContains(t, runnerDockerfile, "weights-manifest.pub")
+
+	manifest, err := os.ReadFile(path.Join(gen.tmpDir, "weights-manifest.json"))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"files": {"weights/model.safetensors": {"crc32": "5873d21a", "sha256": "9a129038d9a00aed0cf6a7ea059ca50a813449061ab87848cf1a13eafdf33b2c"}}}`, string(manifest))
+	signature, err := os.ReadFile(path.Join(gen.tmpDir, "weights-manifest.json.sig"))
+	require.NoError(t, err)
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	require.NoError(t, err)
+	require.True(t, ed25519.Verify(key.Public().(ed25519.PublicKey), manifest, decoded))
+
+	gen.SetQuantize(true)
+	_, _, _, err = gen.Generate("r8.im/replicate/cog-test")
+	require.ErrorContains(t, err, "can't be signed when the weights are quantized")
+}
+
+func TestGenerateInWorkspace(t *testing.T) {
+	workspaceDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(workspaceDir, config.WorkspaceFilename), []byte(`
+image: r8.im/team/base
+build:
+  python_version: "3.11"
+  system_packages:
+    - ffmpeg
+  python_packages:
+    - torch==2.3.1
+`), 0o644))
+	tmpDir := filepath.Join(workspaceDir, "models", "captioner")
+	require.NoError(t, os.MkdirAll(tmpDir, 0o755))
+	workspace, err := config.FindWorkspace(tmpDir)
+	require.NoError(t, err)
+	require.Equal(t, workspaceDir, workspace.Dir)
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  python_version: "3.11"
+  system_packages:
+    - ffmpeg
+    - libgl1
+  python_packages:
+    - torch==2.3.1
+    - transformers==4.41.2
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	conf.Workspace = workspace
+	require.NoError(t, conf.ValidateAndComplete(""))
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	actual, err := gen.GenerateDockerfileWithoutSeparateWeights()
+	require.NoError(t, err)
+
+	require.Contains(t, actual, "\nFROM r8.im/team/base\n")
+	require.NotContains(t, actual, "tini")
+	require.Contains(t, actual, "apt-get install -qqy libgl1 &&")
+	require.Contains(t, actual, "RUN --mount=type=bind,from=r8.im/team/base,target=/workspace-base for d in")
+	requirements, err := os.ReadFile(path.Join(gen.tmpDir, "requirements.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "transformers==4.41.2", string(requirements))
+}
+
+func TestGenerateWeightsManifestCanceled(t *testing.T) {
+	tmpDir := t.TempDir()
+	require.NoError(t, os.WriteFile(path.Join(tmpDir, "weights.bin"), []byte("weights"), 0o644))
+	conf := &config.Config{Build: &config.Build{PythonVersion: "3.11"}}
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	gen.modelFiles = []string{path.Join(tmpDir, "weights.bin")}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	gen.SetContext(ctx)
+	_, err = gen.GenerateWeightsManifest()
+	require.NoError(t, err)
+
+	cancel()
+	_, err = gen.GenerateWeightsManifest()
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestGenerateSharedLayers(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  shared_layers: true
+  python_version: "3.11"
+  system_packages:
+    - libgl1
+    - ffmpeg
+  python_packages:
+    - torch==2.0.1
+    - pandas==2.0.3
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(""))
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	actual, err := gen.GenerateDockerfileWithoutSeparateWeights()
+	require.NoError(t, err)
+
+	require.Contains(t, actual, `FROM python:3.11 as cog
+COPY `+gen.relativeTmpDir+`/cog-0.0.1.dev-py3-none-any.whl /tmp/cog-0.0.1.dev-py3-none-any.whl
+RUN pip install --no-deps --no-compile -t /cog /tmp/cog-0.0.1.dev-py3-none-any.whl
+FROM python:3.11 as deps`)
+	require.Contains(t, actual, "RUN rm -rf /dep/cog /dep/cog-*.dist-info\n")
+	require.Contains(t, actual, "apt-get install -qqy ffmpeg libgl1 &&")
+
+	// cog, which is the same for every model, is copied in before the system packages
+	copyCog := strings.Index(actual, "COPY --from=cog --link /cog /usr/local/lib/python3.11/site-packages")
+	require.Greater(t, copyCog, strings.Index(actual, `ENTRYPOINT ["/sbin/tini", "--"]`))
+	require.Less(t, copyCog, strings.Index(actual, "apt-get install -qqy ffmpeg"))
+
+	requirements, err := os.ReadFile(path.Join(gen.tmpDir, "requirements.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "pandas==2.0.3\ntorch==2.0.1", string(requirements))
+}
+
+func TestGenerateSharedLayersGPU(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  gpu: true
+  shared_layers: true
+  cuda: "11.8"
+  python_version: "3.11"
+  system_packages:
+    - ffmpeg
+  python_packages:
+    - torch==2.0.1
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(""))
+
+	gen, err := NewGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	actual, err := gen.GenerateDockerfileWithoutSeparateWeights()
+	require.NoError(t, err)
+
+	// Python and cog are copied in before the system packages, which are different for each model
+	copyPython := strings.Index(actual, "COPY --from=python --link /root/.pyenv /root/.pyenv")
+	copyCog := strings.Index(actual, "RUN --mount=type=bind,from=cog,source=/cog,target=/cog cp -rf /cog/* $(pyenv prefix)/lib/python*/site-packages")
+	systemPackages := strings.Index(actual, "apt-get install -qqy ffmpeg")
+	require.Greater(t, copyPython, 0)
+	require.Greater(t, copyCog, copyPython)
+	require.Greater(t, systemPackages, copyCog)
+}
@@ -0,0 +1,22 @@
+package dockerfile
+
+// dockerfileSyntax is the version of the Dockerfile frontend that generated Dockerfiles use
+const dockerfileSyntax = "#syntax=docker/dockerfile:1.4"
+
+// dockerfileLabsSyntax is the Dockerfile frontend with RUN --device, which gives run commands the GPU
+const dockerfileLabsSyntax = "#syntax=docker/dockerfile:1-labs"
+
+// SetGPURunDevice makes the run commands that have gpu: true run in the build with access to the GPU, with
+// RUN --device. It needs a BuildKit builder that has the GPU as a device. Otherwise, those commands are left out
+// of the Dockerfile, and are run in a container started from the built image, which is then committed.
+func (g *Generator) SetGPURunDevice(device bool) {
+	g.gpuRunDevice = device
+}
+
+// syntax returns the syntax line of the Dockerfile
+func (g *Generator) syntax() string {
+	if g.gpuRunDevice && (len(g.Config.GPURunCommands()) > 0 || g.quantizeOnDevice()) {
+		return dockerfileLabsSyntax
+	}
+	return dockerfileSyntax
+}
@@ -0,0 +1,86 @@
+package dockerfile
+
+import (
+	"fmt"
+	"path/filepath"
+	"plugin"
+	"strings"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+// Hook changes the Dockerfiles Cog generates, e.g. to add an organization's CA certificates, or a compliance
+// check, to every image
+type Hook interface {
+	// Name identifies the hook in errors
+	Name() string
+	// Dockerfile is called with each Dockerfile Cog generates from cfg, and returns it changed
+	Dockerfile(cfg *config.Config, dockerfile string) (string, error)
+}
+
+// HookSymbol is the name of the variable a Go plugin exports its Hook as
+const HookSymbol = "Hook"
+
+var hooks []Hook
+
+// RegisterHook adds a hook that is run on every Dockerfile Cog generates. Programs that build Cog with their own
+// hooks call it from an init function, and LoadPlugins calls it for the hooks in Go plugins.
+func RegisterHook(hook Hook) {
+	hooks = append(hooks, hook)
+}
+
+// Hooks returns the hooks that are registered, in the order they run
+func Hooks() []Hook {
+	return hooks
+}
+
+// LoadPlugins registers the hooks in the Go plugins in dir, which are the files ending in .so. Each plugin
+// exports its Hook as a variable called Hook. It does nothing if dir doesn't exist.
+func LoadPlugins(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.so"))
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		hook, err := loadPlugin(p)
+		if err != nil {
+			return fmt.Errorf("Failed to load plugin %s: %w", p, err)
+		}
+		RegisterHook(hook)
+	}
+	return nil
+}
+
+func loadPlugin(p string) (Hook, error) {
+	plug, err := plugin.Open(p)
+	if err != nil {
+		if strings.Contains(err.Error(), "not implemented") {
+			return nil, fmt.Errorf("this build of Cog can't load Go plugins, because it was built with CGO_ENABLED=0")
+		}
+		return nil, err
+	}
+	symbol, err := plug.Lookup(HookSymbol)
+	if err != nil {
+		return nil, err
+	}
+	switch hook := symbol.(type) {
+	case *Hook:
+		return *hook, nil
+	case Hook:
+		return hook, nil
+	default:
+		return nil, fmt.Errorf("%s is a %T, but it must implement dockerfile.Hook", HookSymbol, symbol)
+	}
+}
+
+// applyHooks runs the registered hooks on a Dockerfile that g generated
+func (g *Generator) applyHooks(dockerfile string) (string, error) {
+	for _, hook := range hooks {
+		changed, err := hook.Dockerfile(g.Config, dockerfile)
+		if err != nil {
+			return "", fmt.Errorf("The %s hook failed: %w", hook.Name(), err)
+		}
+		dockerfile = changed
+	}
+	return dockerfile, nil
+}
@@ -0,0 +1,45 @@
+package dockerfile
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+type testHook struct {
+	err error
+}
+
+func (h testHook) Name() string {
+	return "test"
+}
+
+func (h testHook) Dockerfile(cfg *config.Config, dockerfile string) (string, error) {
+	return dockerfile + "\nRUN compliance-check " + cfg.Build.PythonVersion, h.err
+}
+
+func TestHooks(t *testing.T) {
+	defer func() { hooks = nil }()
+	RegisterHook(testHook{})
+
+	conf, err := config.FromYAML([]byte("build:\n  python_version: \"3.11\"\npredict: predict.py:Predictor\n"))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(""))
+	gen, err := NewGenerator(conf, t.TempDir())
+	require.NoError(t, err)
+
+	actual, err := gen.GenerateDockerfileWithoutSeparateWeights()
+	require.NoError(t, err)
+	require.Contains(t, actual, "COPY . /src\nRUN compliance-check 3.11")
+
+	_, actual, _, err = gen.Generate("r8.im/replicate/cog-test")
+	require.NoError(t, err)
+	require.Contains(t, actual, "RUN compliance-check 3.11")
+
+	hooks = []Hook{testHook{err: fmt.Errorf("denied")}}
+	_, err = gen.GenerateBase()
+	require.EqualError(t, err, "The test hook failed: denied")
+}
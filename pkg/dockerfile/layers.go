@@ -0,0 +1,107 @@
+package dockerfile
+
+import (
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/replicate/cog/pkg/util/slices"
+)
+
+// tmpDirRe matches the temporary directory of a generator in a Dockerfile, which is different for each build
+var tmpDirRe = regexp.MustCompile(`\.cog/tmp/build[0-9]+`)
+
+// Layer is an instruction in a generated Dockerfile, and the section it's in
+type Layer struct {
+	// Instruction is the instruction, with the checksum of the file it copies if Cog generated it, so it's only
+	// the same as an instruction from another build if Docker would use the cached layer for it
+	Instruction string
+	Section     string
+}
+
+// Layers returns the instructions in a Dockerfile that g generated, so they can be compared with another build's
+func (g *Generator) Layers(dockerfile string) []Layer {
+	layers := []Layer{}
+	for _, instruction := range splitInstructions(dockerfile) {
+		key := tmpDirRe.ReplaceAllString(normalizeInstruction(instruction), ".cog/tmp/build")
+		if fields := strings.Fields(key); len(fields) == 3 && fields[0] == "COPY" {
+			if checksum, ok := g.tempFiles[strings.TrimPrefix(path.Clean(fields[2]), "/tmp/")]; ok {
+				key += " # sha256:" + checksum
+			}
+		}
+		layers = append(layers, Layer{Instruction: key, Section: g.Section(instruction)})
+	}
+	return layers
+}
+
+// InvalidatedSections returns the sections of after that are rebuilt when it's built after before. In each stage,
+// Docker reuses the layers up to the first instruction that is different, copies files that changed, which are
+// the files in changedSections, or copies from a stage that was rebuilt, and rebuilds the rest.
+func InvalidatedSections(before []Layer, after []Layer, changedSections ...string) []string {
+	beforeStages := stages(before)
+	rebuiltStages := []string{}
+	sections := []string{}
+	for i, stage := range stages(after) {
+		previous := []Layer{}
+		if i < len(beforeStages) {
+			previous = beforeStages[i]
+		}
+		invalidated := false
+		for j, layer := range stage {
+			if !invalidated {
+				invalidated = j >= len(previous) || previous[j].Instruction != layer.Instruction || copiesChangedFiles(layer, changedSections) || usesStage(layer, rebuiltStages)
+			}
+			if invalidated && !slices.ContainsString(sections, layer.Section) {
+				sections = append(sections, layer.Section)
+			}
+		}
+		if invalidated {
+			rebuiltStages = append(rebuiltStages, stageName(stage))
+		}
+	}
+	return sections
+}
+
+// stages splits layers into the stages of the Dockerfile, each starting with a FROM instruction
+func stages(layers []Layer) [][]Layer {
+	stages := [][]Layer{}
+	for _, layer := range layers {
+		if strings.HasPrefix(layer.Instruction, "FROM ") || len(stages) == 0 {
+			stages = append(stages, []Layer{})
+		}
+		stages[len(stages)-1] = append(stages[len(stages)-1], layer)
+	}
+	return stages
+}
+
+// stageName returns the name a stage is given with FROM ... AS <name>, or "" if it isn't named
+func stageName(stage []Layer) string {
+	fields := strings.Fields(stage[0].Instruction)
+	if len(fields) == 4 && strings.EqualFold(fields[2], "as") {
+		return fields[3]
+	}
+	return ""
+}
+
+func copiesChangedFiles(layer Layer, changedSections []string) bool {
+	return strings.HasPrefix(layer.Instruction, "COPY ") && slices.ContainsString(changedSections, layer.Section)
+}
+
+// usesStage returns whether the layer is built from, or copies from, one of the stages
+func usesStage(layer Layer, stages []string) bool {
+	fields := strings.Fields(layer.Instruction)
+	for _, name := range stages {
+		if name == "" {
+			continue
+		}
+		if fields[0] == "FROM" && len(fields) > 1 && fields[1] == name {
+			return true
+		}
+		for _, field := range fields {
+			if field == "--from="+name {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package dockerfile
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+func generateLayers(t *testing.T, dir string, yaml string) []Layer {
+	t.Helper()
+	conf, err := config.FromYAML([]byte(yaml))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(""))
+	gen, err := NewGenerator(conf, dir)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, gen.Cleanup()) }()
+	dockerfile, err := gen.GenerateDockerfileWithoutSeparateWeights()
+	require.NoError(t, err)
+	return gen.Layers(dockerfile)
+}
+
+func TestInvalidatedSections(t *testing.T) {
+	dir := t.TempDir()
+	before := generateLayers(t, dir, `
+build:
+  python_packages:
+    - pandas==2.0.3
+predict: predict.py:Predictor
+`)
+
+	// Another build of the same cog.yaml only rebuilds the layers that copy files that changed
+	same := generateLayers(t, dir, `
+build:
+  python_packages:
+    - pandas==2.0.3
+predict: predict.py:Predictor
+`)
+	require.Empty(t, InvalidatedSections(before, same))
+	require.Equal(t, []string{SectionSource}, InvalidatedSections(before, same, SectionSource))
+
+	// The Python packages are in a file Cog writes, so the Dockerfile is the same but the file's checksum isn't
+	changed := generateLayers(t, dir, `
+build:
+  python_packages:
+    - pandas==2.0.3
+    - numpy==1.26.0
+predict: predict.py:Predictor
+`)
+	require.Equal(t, []string{SectionPythonPackages, SectionServer, SectionSource}, InvalidatedSections(before, changed))
+
+	changed = generateLayers(t, dir, `
+build:
+  python_packages:
+    - pandas==2.0.3
+  system_packages:
+    - ffmpeg
+predict: predict.py:Predictor
+`)
+	require.Equal(t, SectionSystemPackages, InvalidatedSections(before, changed)[0])
+}
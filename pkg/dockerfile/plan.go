@@ -0,0 +1,169 @@
+package dockerfile
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/replicate/cog/pkg/global"
+)
+
+// Plan is what a build of the model is made from, resolved before Docker runs, so other tools can audit the
+// build, or build the image themselves
+type Plan struct {
+	CogVersion      string `json:"cog_version"`
+	BaseImage       string `json:"base_image"`
+	PythonVersion   string `json:"python_version"`
+	GPU             bool   `json:"gpu"`
+	CUDA            string `json:"cuda,omitempty"`
+	CuDNN           string `json:"cudnn,omitempty"`
+	SeparateWeights bool   `json:"separate_weights"`
+	// Dockerfiles are the Dockerfiles that are built, in the order they are built
+	Dockerfiles []PlanDockerfile `json:"dockerfiles"`
+	// Inputs are the files the build reads apart from the source, including the ones Cog generates
+	Inputs       []PlanInput `json:"inputs"`
+	Weights      PlanWeights `json:"weights"`
+	Dockerignore string      `json:"dockerignore"`
+}
+
+// PlanDockerfile is a Dockerfile in a Plan, and the sections of it. Cog's temporary directory is .cog/tmp/build
+// in it, rather than the directory of a particular build, so plans of the same model are the same.
+type PlanDockerfile struct {
+	// Name is "weights" for the image with the weights, and "model" for the model's image
+	Name     string        `json:"name"`
+	SHA256   string        `json:"sha256"`
+	Contents string        `json:"contents"`
+	Sections []PlanSection `json:"sections,omitempty"`
+}
+
+// PlanSection is a run of instructions in the same section of a Dockerfile. Its checksum includes the checksums
+// of the files Cog generates that it copies, so it only changes if the layers do.
+type PlanSection struct {
+	Name         string   `json:"name"`
+	SHA256       string   `json:"sha256"`
+	Instructions []string `json:"instructions"`
+}
+
+// PlanInput is a file the build reads
+type PlanInput struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	// Generated is set for files Cog writes for the build, whose path is in Cog's temporary directory
+	Generated bool `json:"generated,omitempty"`
+}
+
+// PlanWeights is which of the project's files Cog decided are weights
+type PlanWeights struct {
+	Dirs  []string `json:"dirs"`
+	Files []string `json:"files"`
+	// Lazy are the weights that are downloaded when the container starts, rather than built into the image
+	Lazy []string `json:"lazy"`
+	// CRC32 are the checksums of the files in the weights image, by path
+	CRC32 map[string]string `json:"crc32,omitempty"`
+}
+
+// Plan generates the Dockerfiles for the model, with its weights in a separate image if separateWeights is
+// set, and returns what the build is made from
+func (g *Generator) Plan(imageName string, separateWeights bool) (*Plan, error) {
+	baseImage, err := g.baseImage()
+	if err != nil {
+		return nil, err
+	}
+	plan := &Plan{
+		CogVersion:      global.Version,
+		BaseImage:       baseImage,
+		PythonVersion:   g.Config.Build.PythonVersion,
+		GPU:             g.Config.Build.GPU,
+		CUDA:            g.Config.Build.CUDA,
+		CuDNN:           g.Config.Build.CuDNN,
+		SeparateWeights: separateWeights,
+		Inputs:          []PlanInput{},
+	}
+
+	if separateWeights {
+		weightsDockerfile, modelDockerfile, dockerignore, err := g.Generate(imageName)
+		if err != nil {
+			return nil, err
+		}
+		plan.Dockerfiles = []PlanDockerfile{
+			g.planDockerfile("weights", weightsDockerfile),
+			g.planDockerfile("model", modelDockerfile),
+		}
+		plan.Dockerignore = dockerignore
+	} else {
+		modelDockerfile, err := g.GenerateDockerfileWithoutSeparateWeights()
+		if err != nil {
+			return nil, err
+		}
+		plan.Dockerfiles = []PlanDockerfile{g.planDockerfile("model", modelDockerfile)}
+		plan.Dockerignore = g.Dockerignore()
+		if _, g.modelDirs, g.modelFiles, err = g.generateForWeights(); err != nil {
+			return nil, err
+		}
+	}
+
+	manifest, err := g.GenerateWeightsManifest()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to generate weights manifest: %w", err)
+	}
+	plan.Weights = PlanWeights{
+		Dirs:  append([]string{}, g.modelDirs...),
+		Files: append([]string{}, g.modelFiles...),
+		Lazy:  append([]string{}, g.Config.LazyWeightsPaths()...),
+		CRC32: map[string]string{},
+	}
+	for p, metadata := range manifest.Files {
+		plan.Weights.CRC32[p] = metadata.CRC32
+	}
+
+	for _, name := range []string{global.ConfigFilename, g.Config.Build.PythonRequirements} {
+		if name == "" {
+			continue
+		}
+		contents, err := os.ReadFile(filepath.Join(g.Dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read %s: %w", name, err)
+		}
+		plan.Inputs = append(plan.Inputs, PlanInput{Path: name, SHA256: checksum(string(contents))})
+	}
+	names := []string{}
+	for name := range g.tempFiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		plan.Inputs = append(plan.Inputs, PlanInput{Path: ".cog/tmp/build/" + name, SHA256: g.tempFiles[name], Generated: true})
+	}
+	return plan, nil
+}
+
+// planDockerfile splits a Dockerfile g generated into its sections
+func (g *Generator) planDockerfile(name string, dockerfile string) PlanDockerfile {
+	layers := g.Layers(dockerfile)
+	dockerfile = tmpDirRe.ReplaceAllString(dockerfile, ".cog/tmp/build")
+	d := PlanDockerfile{Name: name, SHA256: checksum(dockerfile), Contents: dockerfile}
+	if name == "weights" {
+		// The weights image is built from its own Dockerfile, which is all weights
+		for i := range layers {
+			layers[i].Section = SectionWeights
+		}
+	}
+	for i := 0; i < len(layers); {
+		section := PlanSection{Name: layers[i].Section}
+		keys := []string{}
+		for ; i < len(layers) && layers[i].Section == section.Name; i++ {
+			section.Instructions = append(section.Instructions, strings.SplitN(layers[i].Instruction, " # sha256:", 2)[0])
+			keys = append(keys, layers[i].Instruction)
+		}
+		section.SHA256 = checksum(strings.Join(keys, "\n"))
+		d.Sections = append(d.Sections, section)
+	}
+	return d
+}
+
+func checksum(s string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(s)))
+}
@@ -0,0 +1,56 @@
+package dockerfile
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+func TestPlan(t *testing.T) {
+	tmpDir := t.TempDir()
+	yaml := `
+build:
+  python_version: "3.11"
+  python_packages:
+    - pandas==2.0.3
+predict: predict.py:Predictor
+`
+	require.NoError(t, os.WriteFile(path.Join(tmpDir, "cog.yaml"), []byte(yaml), 0o644))
+
+	plan := func() *Plan {
+		conf, err := config.FromYAML([]byte(yaml))
+		require.NoError(t, err)
+		require.NoError(t, conf.ValidateAndComplete(""))
+		gen, err := NewGenerator(conf, tmpDir)
+		require.NoError(t, err)
+		defer func() { require.NoError(t, gen.Cleanup()) }()
+		plan, err := gen.Plan("cog-test", false)
+		require.NoError(t, err)
+		return plan
+	}
+
+	first := plan()
+	require.Equal(t, "python:3.11-slim", first.BaseImage)
+	require.False(t, first.SeparateWeights)
+	require.Len(t, first.Dockerfiles, 1)
+	require.Equal(t, "model", first.Dockerfiles[0].Name)
+	require.Contains(t, first.Dockerfiles[0].Contents, "COPY .cog/tmp/build/requirements.txt /tmp/requirements.txt")
+
+	sections := []string{}
+	for _, section := range first.Dockerfiles[0].Sections {
+		sections = append(sections, section.Name)
+	}
+	require.Equal(t, []string{SectionPythonPackages, SectionBaseImage, SectionSetup, SectionPythonPackages, SectionServer, SectionSource}, sections)
+
+	require.Equal(t, "cog.yaml", first.Inputs[0].Path)
+	require.False(t, first.Inputs[0].Generated)
+	require.Contains(t, first.Inputs, PlanInput{Path: ".cog/tmp/build/requirements.txt", SHA256: checksum("pandas==2.0.3"), Generated: true})
+	require.Empty(t, first.Weights.Dirs)
+
+	// Plans don't depend on the temporary directory of the build
+	require.Equal(t, first, plan())
+}
@@ -0,0 +1,92 @@
+package dockerfile
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+// llamaCppVersion is the release of llama.cpp that converts and quantizes weights to GGUF
+const llamaCppVersion = "b4000"
+
+// quantizeTools are the commands that install the tools each quantization method needs
+var quantizeTools = map[string]string{
+	config.QuantizeAWQ:  "RUN --mount=type=cache,target=/root/.cache/pip pip install autoawq==0.2.6",
+	config.QuantizeGPTQ: "RUN --mount=type=cache,target=/root/.cache/pip pip install optimum==1.21.4 auto-gptq==0.7.1",
+	config.QuantizeGGUFQ4: `RUN --mount=type=cache,target=/var/cache/apt apt-get update -qq && apt-get install -qqy --no-install-recommends git build-essential cmake && rm -rf /var/lib/apt/lists/*
+RUN --mount=type=cache,target=/root/.cache/pip git clone --depth 1 --branch ` + llamaCppVersion + ` https://github.com/ggerganov/llama.cpp /llama.cpp && \
+	pip install -r /llama.cpp/requirements/requirements-convert_hf_to_gguf.txt && \
+	cmake -S /llama.cpp -B /llama.cpp/build -DBUILD_SHARED_LIBS=OFF -DGGML_NATIVE=OFF && \
+	cmake --build /llama.cpp/build --config Release --target llama-quantize -j && \
+	cp /llama.cpp/build/bin/llama-quantize /llama.cpp/llama-quantize
+ENV LLAMA_CPP=/llama.cpp`,
+}
+
+// SetQuantize makes Generate quantize the model's weights with the method in build.optimize.quantize, so the
+// image it generates has the quantized weights instead of the original ones
+func (g *Generator) SetQuantize(quantize bool) {
+	g.quantize = quantize
+}
+
+// SetQuantizeImage makes Generate copy the quantized weights from imageName, instead of quantizing them in the
+// build. It's for methods that need a GPU when the builder doesn't have one: imageName is built from
+// GenerateQuantize, and the weights are quantized in a container started from it with QuantizeCommand.
+func (g *Generator) SetQuantizeImage(imageName string) {
+	g.quantizeImage = imageName
+}
+
+// GenerateQuantize generates a Dockerfile that builds the stage that quantizes the weights, with the tools and
+// the weights but without quantizing them, so they can be quantized in a container that has the GPU
+func (g *Generator) GenerateQuantize(imageName string) (dockerfile string, dockerignoreContents string, err error) {
+	g.quantizeOnly = true
+	defer func() { g.quantizeOnly = false }()
+	_, dockerfile, dockerignoreContents, err = g.Generate(imageName)
+	return dockerfile, dockerignoreContents, err
+}
+
+// QuantizeCommand returns the command that quantizes the weights in place, once Generate or GenerateQuantize has
+// found them
+func (g *Generator) QuantizeCommand() string {
+	dirs := []string{}
+	for _, p := range append(g.modelDirs, g.modelFiles...) {
+		dirs = append(dirs, path.Join("/src", p))
+	}
+	return "python -m cog.command.quantize --method " + g.Config.QuantizeMethod() + " " + strings.Join(dirs, " ")
+}
+
+// quantizeOnDevice returns whether the weights are quantized in the build with the GPU, with RUN --device
+func (g *Generator) quantizeOnDevice() bool {
+	return g.quantize && g.gpuRunDevice && config.QuantizeNeedsGPU(g.Config.QuantizeMethod())
+}
+
+// quantizeStage returns a stage that quantizes the weights from the weights image in place. It has the model's
+// Python and Python packages, because the quantization tools load the model with them. Methods that need a GPU
+// run with it as a device if the builder has one, or else in a container, see SetQuantizeImage.
+func (g *Generator) quantizeStage(baseImage string, installPython string, copyPython string) (string, error) {
+	if g.quantizeImage != "" {
+		return "FROM " + g.quantizeImage + " AS quantize", nil
+	}
+	method := g.Config.QuantizeMethod()
+	quantize := "RUN " + g.QuantizeCommand()
+	switch {
+	case !config.QuantizeNeedsGPU(method):
+	case g.gpuRunDevice:
+		quantize = "RUN --device=nvidia.com/gpu=all " + g.QuantizeCommand()
+	case g.quantizeOnly:
+		quantize = ""
+	default:
+		return "", fmt.Errorf("Quantizing with %s needs a GPU, but the Docker builder doesn't have one", method)
+	}
+	return strings.Join(filterEmpty([]string{
+		"FROM " + baseImage + " AS quantize",
+		g.preamble(),
+		installPython,
+		copyPython,
+		g.pipInstalls(),
+		quantizeTools[method],
+		"COPY --from=weights --link /src /src",
+		quantize,
+	}), "\n"), nil
+}
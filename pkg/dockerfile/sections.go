@@ -0,0 +1,89 @@
+package dockerfile
+
+import (
+	"strings"
+)
+
+// Sections of a generated Dockerfile, which `cog build --timings` groups the time a build took by
+const (
+	SectionBaseImage      = "base image"
+	SectionSetup          = "setup"
+	SectionPython         = "python"
+	SectionSystemPackages = "system packages"
+	SectionPythonPackages = "python packages"
+	SectionRun            = "run commands"
+	SectionWeights        = "weights"
+	SectionServer         = "server"
+	SectionSource         = "source"
+	SectionVerify         = "verify"
+	SectionOther          = "other"
+)
+
+// label records that the instructions are in a section of the Dockerfile, and returns them unchanged
+func (g *Generator) label(section string, instructions string) string {
+	if g.sections == nil {
+		g.sections = map[string]string{}
+	}
+	for _, instruction := range splitInstructions(instructions) {
+		g.sections[normalizeInstruction(instruction)] = section
+	}
+	return instructions
+}
+
+// Section returns the section of the generated Dockerfile an instruction is in, as BuildKit names it in its
+// build output
+func (g *Generator) Section(instruction string) string {
+	instruction = normalizeInstruction(instruction)
+	if section, ok := g.sections[instruction]; ok {
+		return section
+	}
+	// BuildKit shows base images by their resolved name, e.g. docker.io/library/python:3.11-slim@sha256:...
+	if strings.HasPrefix(instruction, "FROM ") {
+		if strings.Contains(instruction, "-weights") {
+			return SectionWeights
+		}
+		return SectionBaseImage
+	}
+	return InstructionSection(instruction)
+}
+
+// InstructionSection returns the section for an instruction of a Dockerfile that wasn't generated by Cog,
+// which is the kind of instruction it is
+func InstructionSection(instruction string) string {
+	keyword, _, _ := strings.Cut(strings.TrimSpace(instruction), " ")
+	switch strings.ToUpper(keyword) {
+	case "":
+		return SectionOther
+	case "FROM":
+		return SectionBaseImage
+	default:
+		return strings.ToLower(keyword)
+	}
+}
+
+// splitInstructions splits lines of a Dockerfile into instructions, joining lines that are continued with a backslash
+func splitInstructions(lines string) []string {
+	instructions := []string{}
+	current := ""
+	for _, line := range strings.Split(lines, "\n") {
+		if current == "" && (strings.TrimSpace(line) == "" || strings.HasPrefix(strings.TrimSpace(line), "#")) {
+			continue
+		}
+		if strings.HasSuffix(line, "\\") {
+			current += strings.TrimSuffix(line, "\\")
+			continue
+		}
+		instructions = append(instructions, current+line)
+		current = ""
+	}
+	if current != "" {
+		instructions = append(instructions, current)
+	}
+	return instructions
+}
+
+// normalizeInstruction makes instructions from the Dockerfile and from BuildKit's output comparable
+func normalizeInstruction(instruction string) string {
+	instruction = strings.ReplaceAll(instruction, "\\\n", "")
+	return strings.Join(strings.Fields(instruction), " ")
+}
@@ -0,0 +1,78 @@
+package dockerfile
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/predictor"
+	"github.com/replicate/cog/pkg/util/slices"
+)
+
+// sourceFiles returns the files that are copied into the image if build.source.only_imports is set: cog.yaml,
+// the predictors and the local modules they import, and the files that match build.source.include
+func (g *Generator) sourceFiles() ([]string, error) {
+	files, err := predictor.LocalImports(g.Dir, g.Config.PredictorFiles())
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find the modules the predictor imports: %w", err)
+	}
+	files = append(files, global.ConfigFilename)
+	if g.Config.Build.Source != nil && len(g.Config.Build.Source.Include) > 0 {
+		err := g.fileWalker(".", func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			p = filepath.ToSlash(p)
+			if g.Config.IsIncludedSource(p) && !slices.ContainsString(files, p) {
+				files = append(files, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// copySource returns the instructions that copy the project into the image, and the lines to add to
+// .dockerignore so only the files that are copied are sent to Docker. weights are the weights that are
+// copied with the source rather than from the weights image.
+func (g *Generator) copySource(weights []string) (string, string, error) {
+	if !g.Config.SourceOnlyImports() {
+		return "COPY . /src", "", nil
+	}
+	files, err := g.sourceFiles()
+	if err != nil {
+		return "", "", err
+	}
+	files = append(files, weights...)
+
+	// Copy each top-level file and directory, so the files keep their paths without a layer for every file
+	entries := []string{}
+	for _, f := range files {
+		entry := strings.Split(path.Clean(f), "/")[0]
+		if !slices.ContainsString(entries, entry) {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Strings(entries)
+	instructions := []string{}
+	for _, entry := range entries {
+		instructions = append(instructions, fmt.Sprintf("COPY %s %s", entry, path.Join("/src", entry)))
+	}
+
+	dockerignore := "# only the files the predictor needs, because build.source.only_imports is set\n*\n"
+	for _, f := range append(files, g.relativeTmpDir) {
+		dockerignore += "!" + f + "\n"
+	}
+	return strings.Join(instructions, "\n"), dockerignore, nil
+}
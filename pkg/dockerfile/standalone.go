@@ -0,0 +1,94 @@
+package dockerfile
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/replicate/cog/pkg/util/files"
+)
+
+// StandaloneTmpDir is where a standalone build context keeps the files Cog generates for the build,
+// like the Cog wheel and requirements.txt, relative to the context
+const StandaloneTmpDir = ".cog/build"
+
+// WriteStandalone writes a build context to contextDir that can be built with plain `docker build`,
+// without Cog. It has a Dockerfile, a copy of the project, and the files Cog generates for the build.
+func (g *Generator) WriteStandalone(contextDir string) error {
+	contextDir, err := filepath.Abs(contextDir)
+	if err != nil {
+		return err
+	}
+	if entries, err := os.ReadDir(contextDir); err == nil && len(entries) > 0 {
+		return fmt.Errorf("%s already exists and isn't empty", contextDir)
+	}
+
+	// Write the generated files into the context instead of a temporary directory in the project.
+	// They're part of the context, so they're kept when the generator is cleaned up.
+	if err := g.Cleanup(); err != nil {
+		return err
+	}
+	g.tmpDir = filepath.Join(contextDir, StandaloneTmpDir)
+	g.relativeTmpDir = StandaloneTmpDir
+	g.keepTmpDir = true
+
+	dockerfile, err := g.GenerateDockerfileWithoutSeparateWeights()
+	if err != nil {
+		return fmt.Errorf("Failed to generate Dockerfile: %w", err)
+	}
+	if err := copyProject(g.Dir, contextDir); err != nil {
+		return fmt.Errorf("Failed to copy project to %s: %w", contextDir, err)
+	}
+	if err := os.WriteFile(filepath.Join(contextDir, "Dockerfile"), []byte(dockerfile+"\n"), 0o644); err != nil {
+		return fmt.Errorf("Failed to write Dockerfile: %w", err)
+	}
+	return nil
+}
+
+// copyProject copies the project in dir to contextDir, leaving out Cog's own files in .cog, and any
+// Dockerfile, which is replaced by the generated one
+func copyProject(dir string, contextDir string) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && (rel == ".cog" || path == contextDir) {
+			return filepath.SkipDir
+		}
+		if rel == "Dockerfile" {
+			return nil
+		}
+		dest := filepath.Join(contextDir, rel)
+
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(dest, 0o755)
+		case d.Type()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(target, dest)
+		case d.Type().IsRegular():
+			if err := files.CopyFile(path, dest); err != nil {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			return os.Chmod(dest, info.Mode().Perm())
+		}
+		// Sockets, devices, etc. can't be part of a build context
+		return nil
+	})
+}
@@ -0,0 +1,137 @@
+package dockerfile
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+// Names of the blocks of a generated Dockerfile, which build.templates in cog.yaml can replace with a Go template
+const (
+	TemplatePipInstallStage = "pip_install_stage"
+	TemplatePythonStage     = "python_stage"
+	TemplateWheelsStage     = "wheels_stage"
+	TemplateWeightsStage    = "weights_stage"
+	TemplateQuantizeStage   = "quantize_stage"
+	TemplateBaseImage       = "base_image"
+	TemplatePreamble        = "preamble"
+	TemplateInstallPython   = "install_python"
+	TemplateTini            = "tini"
+	TemplateCog             = "cog"
+	TemplateSystemPackages  = "system_packages"
+	TemplateCopyPython      = "copy_python"
+	TemplatePythonPackages  = "python_packages"
+	TemplateInstallWheels   = "install_wheels"
+	TemplateRun             = "run"
+	TemplateCopyWeights     = "copy_weights"
+	TemplateServer          = "server"
+	TemplateWeightsConfig   = "weights_config"
+	TemplateSource          = "source"
+	TemplateVerify          = "verify"
+)
+
+// TemplateNames are the blocks of a generated Dockerfile, in the order they are in it
+var TemplateNames = []string{
+	TemplatePipInstallStage,
+	TemplatePythonStage,
+	TemplateWheelsStage,
+	TemplateWeightsStage,
+	TemplateQuantizeStage,
+	TemplateBaseImage,
+	TemplatePreamble,
+	TemplateInstallPython,
+	TemplateTini,
+	TemplateCog,
+	TemplateSystemPackages,
+	TemplateCopyPython,
+	TemplatePythonPackages,
+	TemplateInstallWheels,
+	TemplateRun,
+	TemplateCopyWeights,
+	TemplateServer,
+	TemplateWeightsConfig,
+	TemplateSource,
+	TemplateVerify,
+}
+
+// block is a part of a generated Dockerfile, which is replaced by the template in build.templates with its name
+// if there is one
+type block struct {
+	name     string
+	section  string
+	contents string
+}
+
+// TemplateData is what the templates in build.templates are executed with
+type TemplateData struct {
+	// Default is what Cog generates for the block, so a template can add to it rather than replace it
+	Default string
+	// BaseImage is the image the model is built on
+	BaseImage string
+	Config    *config.Config
+}
+
+// render returns the blocks, replaced by the templates in build.templates, and labels them with their sections
+func (g *Generator) render(baseImage string, blocks ...block) ([]string, error) {
+	templates, err := g.loadTemplates()
+	if err != nil {
+		return nil, err
+	}
+	rendered := []string{}
+	for _, b := range blocks {
+		contents := b.contents
+		if tmpl, ok := templates[b.name]; ok {
+			var buf bytes.Buffer
+			if err := tmpl.Execute(&buf, TemplateData{Default: b.contents, BaseImage: baseImage, Config: g.Config}); err != nil {
+				return nil, fmt.Errorf("Failed to execute the %s template in build.templates: %w", b.name, err)
+			}
+			contents = strings.TrimRight(buf.String(), "\n")
+		}
+		rendered = append(rendered, g.label(b.section, contents))
+	}
+	return rendered, nil
+}
+
+// loadTemplates parses the templates in build.templates, by the name of the block they replace
+func (g *Generator) loadTemplates() (map[string]*template.Template, error) {
+	templates := map[string]*template.Template{}
+	names := []string{}
+	for name := range g.Config.Build.Templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !isTemplateName(name) {
+			return nil, fmt.Errorf("Unknown template '%s' in build.templates. It must be one of: %s", name, strings.Join(TemplateNames, ", "))
+		}
+		p := g.Config.Build.Templates[name]
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(g.Dir, p)
+		}
+		contents, err := os.ReadFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read the %s template in build.templates: %w", name, err)
+		}
+		tmpl, err := template.New(name).Option("missingkey=error").Parse(string(contents))
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse the %s template in build.templates: %w", name, err)
+		}
+		templates[name] = tmpl
+	}
+	return templates, nil
+}
+
+func isTemplateName(name string) bool {
+	for _, n := range TemplateNames {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
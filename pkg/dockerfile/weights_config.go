@@ -0,0 +1,162 @@
+package dockerfile
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/replicate/cog/pkg/util/files"
+	"github.com/replicate/cog/pkg/weights"
+)
+
+// WeightsConfigPath is where the weights profiles and the weights that are downloaded when the container
+// starts are in the image
+const WeightsConfigPath = "/etc/cog/weights.json"
+
+const (
+	// WeightsManifestPath is where the signed manifest of the weights is in the image
+	WeightsManifestPath = "/etc/cog/weights-manifest.json"
+	// WeightsManifestSignaturePath is where the base64 Ed25519 signature of the manifest is in the image
+	WeightsManifestSignaturePath = WeightsManifestPath + ".sig"
+)
+
+type weightsConfigFile struct {
+	Default  string                `json:"default,omitempty"`
+	Profiles []weightsProfileEntry `json:"profiles,omitempty"`
+	Files    []weightsFileEntry    `json:"files,omitempty"`
+}
+
+type weightsProfileEntry struct {
+	Name   string `json:"name"`
+	Path   string `json:"path"`
+	URL    string `json:"url,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+	// Files are the checksums of the weights, so they can be checked after they are downloaded
+	Files map[string]weights.Metadata `json:"files,omitempty"`
+}
+
+type weightsFileEntry struct {
+	URL    string `json:"url"`
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+}
+
+// weightsConfig returns the lines that add the weights profiles, the weights that are downloaded when the
+// container starts, and the signed weights manifest to the image
+func (g *Generator) weightsConfig() (string, error) {
+	signedManifest, err := g.signedWeightsManifest()
+	if err != nil {
+		return "", err
+	}
+	defaultProfile := g.Config.DefaultWeightsProfile()
+	weightsFiles := g.Config.WeightsFiles()
+	if defaultProfile == nil && len(weightsFiles) == 0 {
+		return signedManifest, nil
+	}
+	file := weightsConfigFile{}
+	if defaultProfile != nil {
+		file.Default = defaultProfile.Name
+	}
+	for _, profile := range g.Config.WeightsProfiles() {
+		entry := weightsProfileEntry{Name: profile.Name, Path: path.Clean(profile.Path), URL: profile.URL, SHA256: profile.SHA256}
+		// Checksums of weights that aren't built into the image, if they are in the project
+		if profile.Name != defaultProfile.Name {
+			if _, err := os.Stat(filepath.Join(g.Dir, profile.Path)); err == nil {
+				manifest, err := weights.ManifestForPath(g.Dir, profile.Path)
+				if err != nil {
+					return "", fmt.Errorf("Failed to generate manifest for weights profile %s: %w", profile.Name, err)
+				}
+				entry.Files = manifest.Files
+			}
+		}
+		file.Profiles = append(file.Profiles, entry)
+	}
+	for _, weightsFile := range weightsFiles {
+		file.Files = append(file.Files, weightsFileEntry{URL: weightsFile.URL, Path: path.Clean(weightsFile.Path), SHA256: weightsFile.SHA256})
+	}
+	contents, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("Failed to convert weights config to JSON: %w", err)
+	}
+	if _, _, err := g.writeTemp("weights.json", contents); err != nil {
+		return "", err
+	}
+	return strings.Join(filterEmpty([]string{
+		fmt.Sprintf("COPY %s %s", path.Join(g.relativeTmpDir, "weights.json"), WeightsConfigPath),
+		signedManifest,
+	}), "\n"), nil
+}
+
+// signedWeightsManifest returns the lines that add the manifest of the weights in the image to it, with the
+// SHA-256 checksums of the weights, and its signature. The public key it's checked with isn't in the image, so
+// whoever changes the weights can't replace it too. It returns an empty string if there isn't a weights signing key.
+func (g *Generator) signedWeightsManifest() (string, error) {
+	if g.weightsSigningKey == nil {
+		return "", nil
+	}
+	if g.quantize {
+		return "", fmt.Errorf("The weights manifest can't be signed when the weights are quantized, because they're changed after they're signed")
+	}
+	_, modelDirs, modelFiles, err := g.generateForWeights()
+	if err != nil {
+		return "", err
+	}
+	manifest := weights.NewManifest()
+	for _, p := range append(modelDirs, modelFiles...) {
+		m, err := weights.ManifestForPath(g.Dir, p)
+		if err != nil {
+			return "", fmt.Errorf("Failed to generate weights manifest: %w", err)
+		}
+		for name, metadata := range m.Files {
+			if manifest.Files == nil {
+				manifest.Files = map[string]weights.Metadata{}
+			}
+			manifest.Files[name] = metadata
+		}
+	}
+	if err := manifest.AddSHA256(g.Dir); err != nil {
+		return "", fmt.Errorf("Failed to generate weights manifest: %w", err)
+	}
+	contents, signature, err := manifest.Sign(g.weightsSigningKey)
+	if err != nil {
+		return "", fmt.Errorf("Failed to sign weights manifest: %w", err)
+	}
+
+	lines := []string{}
+	for _, f := range []struct {
+		name     string
+		contents []byte
+		dest     string
+	}{
+		{"weights-manifest.json", contents, WeightsManifestPath},
+		{"weights-manifest.json.sig", []byte(base64.StdEncoding.EncodeToString(signature) + "\n"), WeightsManifestSignaturePath},
+	} {
+		if _, _, err := g.writeTemp(f.name, f.contents); err != nil {
+			return "", err
+		}
+		lines = append(lines, fmt.Sprintf("COPY %s %s", path.Join(g.relativeTmpDir, f.name), f.dest))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// withoutPaths removes the paths that are in, or are, any of remove
+func withoutPaths(paths []string, remove []string) []string {
+	kept := []string{}
+	for _, p := range paths {
+		removed := false
+		for _, r := range remove {
+			if files.InDir(p, r) {
+				removed = true
+				break
+			}
+		}
+		if !removed {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
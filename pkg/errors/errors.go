@@ -1,9 +1,43 @@
 package errors
 
+import (
+	"errors"
+)
+
+const (
+	CodeConfigNotFound   = "CONFIG_NOT_FOUND"
+	CodeConfigInvalid    = "CONFIG_INVALID"
+	CodeBuildFailed      = "BUILD_FAILED"
+	CodePushAuthFailed   = "PUSH_AUTH_FAILED"
+	CodePredictionFailed = "PREDICTION_FAILED"
+	CodeOutOfMemory      = "OUT_OF_MEMORY"
+	CodeUsage            = "USAGE"
+	// CodeUnknown is the code of errors that don't have one, in JSON errors
+	CodeUnknown = "ERROR"
+)
+
+// Exit codes that cog exits with, depending on the code of the error it failed with. They're part of the CLI's
+// interface, so scripts can tell failures apart, and mustn't change.
 const (
-	CodeConfigNotFound = "CONFIG_NOT_FOUND"
+	ExitError            = 1
+	ExitUsage            = 2
+	ExitConfig           = 3
+	ExitBuildFailed      = 4
+	ExitPushAuthFailed   = 5
+	ExitPredictionFailed = 6
+	ExitOutOfMemory      = 7
 )
 
+var exitCodes = map[string]int{
+	CodeConfigNotFound:   ExitConfig,
+	CodeConfigInvalid:    ExitConfig,
+	CodeBuildFailed:      ExitBuildFailed,
+	CodePushAuthFailed:   ExitPushAuthFailed,
+	CodePredictionFailed: ExitPredictionFailed,
+	CodeOutOfMemory:      ExitOutOfMemory,
+	CodeUsage:            ExitUsage,
+}
+
 // Types ////////////////////////////////////////
 
 type CodedError interface {
@@ -13,9 +47,13 @@ type CodedError interface {
 type codedError struct {
 	code string
 	msg  string
+	err  error
 }
 
 func (e *codedError) Error() string {
+	if e.err != nil {
+		return e.err.Error()
+	}
 	return e.msg
 }
 
@@ -23,6 +61,17 @@ func (e *codedError) Code() string {
 	return e.code
 }
 
+func (e *codedError) Unwrap() error {
+	return e.err
+}
+
+// Object is an error as a JSON object, which is what --error-json writes
+type Object struct {
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+	ExitCode int    `json:"exit_code"`
+}
+
 // Error Creators ///////////////////////////////
 
 // The Cog config was not found
@@ -33,6 +82,45 @@ func ConfigNotFound(msg string) error {
 	}
 }
 
+// The Cog config couldn't be parsed or isn't valid
+func ConfigInvalid(err error) error {
+	return wrap(CodeConfigInvalid, err)
+}
+
+// The image failed to build
+func BuildFailed(err error) error {
+	return wrap(CodeBuildFailed, err)
+}
+
+// The registry refused to let the image be pushed, because the user isn't logged in or doesn't have access
+func PushAuthFailed(err error) error {
+	return wrap(CodePushAuthFailed, err)
+}
+
+// A prediction failed, or couldn't be run
+func PredictionFailed(err error) error {
+	return wrap(CodePredictionFailed, err)
+}
+
+// The model's container ran out of memory
+func OutOfMemory(err error) error {
+	return wrap(CodeOutOfMemory, err)
+}
+
+// The command was run with invalid flags or arguments
+func Usage(err error) error {
+	return wrap(CodeUsage, err)
+}
+
+// wrap gives err a code. If err already has one, the new code replaces it, because it's given by code that knows
+// more about why err happened, e.g. a prediction failing because the model ran out of memory.
+func wrap(code string, err error) error {
+	if err == nil || Code(err) == code {
+		return err
+	}
+	return &codedError{code: code, err: err}
+}
+
 // Helpers //////////////////////////////////////
 
 func IsConfigNotFound(err error) bool {
@@ -41,9 +129,27 @@ func IsConfigNotFound(err error) bool {
 
 // Return the error code, or the empty string
 func Code(err error) string {
-	if cerr, ok := err.(CodedError); ok {
+	var cerr CodedError
+	if errors.As(err, &cerr) {
 		return cerr.Code()
 	}
 
 	return ""
 }
+
+// ExitCode returns the code cog exits with when it fails with err
+func ExitCode(err error) int {
+	if code, ok := exitCodes[Code(err)]; ok {
+		return code
+	}
+	return ExitError
+}
+
+// ToObject returns err as a JSON object, with its code and the code cog exits with
+func ToObject(err error) Object {
+	code := Code(err)
+	if code == "" {
+		code = CodeUnknown
+	}
+	return Object{Code: code, Message: err.Error(), ExitCode: ExitCode(err)}
+}
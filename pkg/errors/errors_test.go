@@ -0,0 +1,28 @@
+package errors
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExitCode(t *testing.T) {
+	require.Equal(t, ExitError, ExitCode(errors.New("something went wrong")))
+	require.Equal(t, ExitConfig, ExitCode(ConfigNotFound("cog.yaml not found")))
+	require.Equal(t, ExitBuildFailed, ExitCode(BuildFailed(errors.New("pip install failed"))))
+
+	// Codes are found through wrapped errors, and the outermost code wins
+	err := fmt.Errorf("The container crashed: %w", PredictionFailed(errors.New("connection reset")))
+	require.Equal(t, ExitPredictionFailed, ExitCode(err))
+	require.Equal(t, ExitOutOfMemory, ExitCode(OutOfMemory(err)))
+	require.Equal(t, "The container crashed: connection reset", OutOfMemory(err).Error())
+
+	require.Nil(t, BuildFailed(nil))
+}
+
+func TestToObject(t *testing.T) {
+	require.Equal(t, Object{Code: "PUSH_AUTH_FAILED", Message: "unauthorized", ExitCode: 5}, ToObject(PushAuthFailed(errors.New("unauthorized"))))
+	require.Equal(t, Object{Code: "ERROR", Message: "oops", ExitCode: 1}, ToObject(errors.New("oops")))
+}
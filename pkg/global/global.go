@@ -9,10 +9,11 @@ var (
 	Commit                = ""
 	BuildTime             = "none"
 	Debug                 = false
-	ProfilingEnabled      = false
+	ErrorJSON             = false
 	StartupTimeout        = 5 * time.Minute
 	ConfigFilename        = "cog.yaml"
 	ReplicateRegistryHost = "r8.im"
 	ReplicateWebsiteHost  = "replicate.com"
+	ReplicateAPIHost      = "api.replicate.com"
 	LabelNamespace        = "run.cog."
 )
@@ -0,0 +1,28 @@
+package image
+
+import (
+	"errors"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/predictor"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// analyzePredictors checks the predictors in cog.yaml without running them, so mistakes in them fail before
+// the image is built rather than after
+func analyzePredictors(cfg *config.Config, dir string) error {
+	for _, ref := range []string{cfg.Predict, cfg.Train} {
+		if ref == "" {
+			continue
+		}
+		err := predictor.Analyze(dir, ref)
+		if errors.Is(err, predictor.ErrPythonNotFound) {
+			console.Debug("Python isn't installed, so the predictor can't be checked before the build")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
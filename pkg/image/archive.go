@@ -0,0 +1,231 @@
+package image
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/weights"
+)
+
+// Files in an archive written by SaveArchive. The image comes last, so the rest can be read
+// before it is loaded.
+const (
+	archiveMetadataFile        = "cog_archive.json"
+	archiveConfigFile          = "cog.yaml"
+	archiveSchemaFile          = "openapi_schema.json"
+	archiveWeightsManifestFile = "weights_manifest.json"
+	archiveImageFile           = "image.tar"
+)
+
+// ArchiveMetadata describes an archive written by SaveArchive
+type ArchiveMetadata struct {
+	Image      string `json:"image"`
+	CogVersion string `json:"cog_version"`
+}
+
+// SaveArchive writes imageName to a single archive at archivePath, along with its cog.yaml,
+// OpenAPI schema and weights manifest, so it can be loaded with LoadArchive on a machine
+// without access to a registry. If archivePath ends with .gz or .tgz, it is compressed.
+func SaveArchive(imageName string, archivePath string, weightsManifest *weights.Manifest) error {
+	inspect, err := docker.ImageInspect(imageName)
+	if err != nil {
+		return fmt.Errorf("Failed to inspect %s: %w", imageName, err)
+	}
+	configJSON := inspect.Config.Labels[global.LabelNamespace+"config"]
+	schemaJSON := inspect.Config.Labels[global.LabelNamespace+"openapi_schema"]
+	if configJSON == "" || schemaJSON == "" {
+		return fmt.Errorf("Image %s does not appear to be a Cog model", imageName)
+	}
+	configYAML, err := yaml.JSONToYAML([]byte(configJSON))
+	if err != nil {
+		return fmt.Errorf("Failed to convert config to YAML: %w", err)
+	}
+	metadataJSON, err := json.MarshalIndent(ArchiveMetadata{Image: imageName, CogVersion: global.Version}, "", "  ")
+	if err != nil {
+		return err
+	}
+	manifestJSON, err := json.MarshalIndent(weightsManifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// docker save needs somewhere to write to, so save the image next to the archive first
+	imageFile, err := os.CreateTemp(filepath.Dir(archivePath), ".cog-image-*.tar")
+	if err != nil {
+		return fmt.Errorf("Failed to create temporary file: %w", err)
+	}
+	imageFile.Close()
+	defer os.Remove(imageFile.Name())
+	if err := docker.Save(imageName, imageFile.Name()); err != nil {
+		return err
+	}
+
+	out, err := os.Create(archivePath)
+	if err != nil {
+		return fmt.Errorf("Failed to create %s: %w", archivePath, err)
+	}
+	defer out.Close()
+	var w io.Writer = out
+	if strings.HasSuffix(archivePath, ".gz") || strings.HasSuffix(archivePath, ".tgz") {
+		gz := gzip.NewWriter(out)
+		defer gz.Close()
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+	defer tw.Close()
+
+	for _, f := range []struct {
+		name     string
+		contents []byte
+	}{
+		{archiveMetadataFile, metadataJSON},
+		{archiveConfigFile, configYAML},
+		{archiveSchemaFile, []byte(schemaJSON)},
+		{archiveWeightsManifestFile, manifestJSON},
+	} {
+		if err := writeTarFile(tw, f.name, f.contents); err != nil {
+			return err
+		}
+	}
+	if err := copyFileToTar(tw, archiveImageFile, imageFile.Name()); err != nil {
+		return err
+	}
+
+	// Close explicitly to catch errors writing the end of the archive
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if gz, ok := w.(*gzip.Writer); ok {
+		if err := gz.Close(); err != nil {
+			return err
+		}
+	}
+	return out.Close()
+}
+
+// LoadArchive loads the image in an archive written by SaveArchive into Docker. If extractDir
+// isn't empty, the rest of the archive's files are written to it.
+func LoadArchive(archivePath string, extractDir string) (*ArchiveMetadata, error) {
+	in, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	var r io.Reader = bufio.NewReader(in)
+	if magic, _ := r.(*bufio.Reader).Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to decompress %s: %w", archivePath, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	var metadata *ArchiveMetadata
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read %s: %w", archivePath, err)
+		}
+
+		switch header.Name {
+		case archiveMetadataFile:
+			metadata = &ArchiveMetadata{}
+			if err := json.NewDecoder(tr).Decode(metadata); err != nil {
+				return nil, fmt.Errorf("Failed to read %s: %w", archiveMetadataFile, err)
+			}
+		case archiveImageFile:
+			if metadata == nil {
+				return nil, fmt.Errorf("%s is not an archive saved by Cog", archivePath)
+			}
+			if err := docker.Load(tr); err != nil {
+				return nil, err
+			}
+		case archiveConfigFile, archiveSchemaFile, archiveWeightsManifestFile:
+			if extractDir == "" {
+				continue
+			}
+			if err := extractTarFile(tr, filepath.Join(extractDir, header.Name)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if metadata == nil {
+		return nil, fmt.Errorf("%s is not an archive saved by Cog", archivePath)
+	}
+	return metadata, nil
+}
+
+func writeTarFile(tw *tar.Writer, name string, contents []byte) error {
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0o644,
+		Size:    int64(len(contents)),
+		ModTime: time.Now(),
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("Failed to write %s to archive: %w", name, err)
+	}
+	if _, err := tw.Write(contents); err != nil {
+		return fmt.Errorf("Failed to write %s to archive: %w", name, err)
+	}
+	return nil
+}
+
+func copyFileToTar(tw *tar.Writer, name string, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0o644,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("Failed to write %s to archive: %w", name, err)
+	}
+	if _, err := io.Copy(tw, f); err != nil {
+		return fmt.Errorf("Failed to write %s to archive: %w", name, err)
+	}
+	return nil
+}
+
+func extractTarFile(r io.Reader, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("Failed to create %s: %w", path, err)
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, r); err != nil { //#nosec G110
+		return fmt.Errorf("Failed to write %s: %w", path, err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,45 @@
+package image
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadArchiveExtractsFiles(t *testing.T) {
+	dir := t.TempDir()
+	archivePath := filepath.Join(dir, "model.tar")
+	f, err := os.Create(archivePath)
+	require.NoError(t, err)
+	tw := tar.NewWriter(f)
+	require.NoError(t, writeTarFile(tw, archiveMetadataFile, []byte(`{"image": "hotdog-detector", "cog_version": "dev"}`)))
+	require.NoError(t, writeTarFile(tw, archiveConfigFile, []byte("predict: predict.py:Predictor\n")))
+	require.NoError(t, tw.Close())
+	require.NoError(t, f.Close())
+
+	extractDir := filepath.Join(dir, "extracted")
+	metadata, err := LoadArchive(archivePath, extractDir)
+	require.NoError(t, err)
+	require.Equal(t, &ArchiveMetadata{Image: "hotdog-detector", CogVersion: "dev"}, metadata)
+
+	config, err := os.ReadFile(filepath.Join(extractDir, archiveConfigFile))
+	require.NoError(t, err)
+	require.Equal(t, "predict: predict.py:Predictor\n", string(config))
+}
+
+func TestLoadArchiveRejectsOtherArchives(t *testing.T) {
+	dir := t.TempDir()
+	archivePath := filepath.Join(dir, "other.tar")
+	f, err := os.Create(archivePath)
+	require.NoError(t, err)
+	tw := tar.NewWriter(f)
+	require.NoError(t, writeTarFile(tw, "hello.txt", []byte("hello")))
+	require.NoError(t, tw.Close())
+	require.NoError(t, f.Close())
+
+	_, err = LoadArchive(archivePath, "")
+	require.ErrorContains(t, err, "not an archive saved by Cog")
+}
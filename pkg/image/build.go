@@ -2,40 +2,137 @@ package image
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/getkin/kin-openapi/openapi3"
 
 	"github.com/replicate/cog/pkg/config"
 	"github.com/replicate/cog/pkg/docker"
 	"github.com/replicate/cog/pkg/dockerfile"
+	cogerrors "github.com/replicate/cog/pkg/errors"
 	"github.com/replicate/cog/pkg/global"
 	"github.com/replicate/cog/pkg/util/console"
 	"github.com/replicate/cog/pkg/weights"
 )
 
+// dockerignoreBackupPath is where older versions of Cog moved the project's .dockerignore while they replaced it
 const dockerignoreBackupPath = ".dockerignore.cog.bak"
+
 const weightsManifestPath = ".cog/cache/weights_manifest.json"
 
+// BuildOptions are the options for Build, which mostly come from the flags of cog build
+type BuildOptions struct {
+	Secrets   []string
+	BuildArgs []string
+	NoCache   bool
+	// SeparateWeights builds the weights in their own image, whose layers the image shares
+	SeparateWeights  bool
+	UseCudaBaseImage string
+	ProgressOutput   string
+	// SchemaFile is a file with the model's schema, which is used instead of reading it from the built model
+	SchemaFile string
+	// DockerfileFile is a Dockerfile to build instead of the one generated from cog.yaml
+	DockerfileFile string
+	// Format is how the HTTP server is run, e.g. sagemaker, or Cog's own API if it's empty
+	Format string
+	// SBOMFile is where to write the software bill of materials, with the licenses of the packages in the image
+	SBOMFile       string
+	DebugOnFailure bool
+	// Timings prints how long each part of the build took
+	Timings bool
+	// WeightsSigningKey is the path of the key to sign the weights manifest with, if it's set
+	WeightsSigningKey string
+	// Resume continues the last build if it failed or was interrupted
+	Resume bool
+	// Flatten puts everything but the weights in one layer, and each of the weights in a layer of its own
+	Flatten bool
+}
+
 // Build a Cog model from a config
 //
 // This is separated out from docker.Build(), so that can be as close as possible to the behavior of 'docker build'.
-func Build(cfg *config.Config, dir, imageName string, secrets []string, noCache, separateWeights bool, useCudaBaseImage string, progressOutput string, schemaFile string, dockerfileFile string) error {
+func Build(ctx context.Context, cfg *config.Config, dir, imageName string, opts BuildOptions) (buildErr error) {
+	unlock, err := lockProject(dir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := restoreDockerignoreBackup(dir); err != nil {
+		return err
+	}
+
+	started := time.Now()
+	defer func() { recordBuild(cfg, imageName, started, buildErr) }()
+	defer func() { buildErr = buildFailed(buildErr) }()
+
 	console.Infof("Building Docker image from environment in cog.yaml as %s...", imageName)
+	if err := docker.CheckHost(dir, cfg.Build.GPU); err != nil {
+		return err
+	}
 
-	if dockerfileFile != "" {
-		dockerfileContents, err := os.ReadFile(dockerfileFile)
+	var t *buildTimings
+	if opts.Timings {
+		t = newBuildTimings()
+		// Steps and how long they took can only be read from plain progress output
+		opts.ProgressOutput = "plain"
+	}
+
+	projectDockerignore, err := dockerfile.ReadDockerignore(dir)
+	if err != nil {
+		return err
+	}
+
+	if opts.WeightsSigningKey != "" && (opts.DockerfileFile != "" || cfg.QuantizeMethod() != "") {
+		return fmt.Errorf("The weights manifest can only be signed in images built from cog.yaml whose weights aren't quantized")
+	}
+	if opts.Flatten && opts.DockerfileFile != "" {
+		return fmt.Errorf("Only images built from cog.yaml can be flattened, because Cog doesn't know which files in a Dockerfile's image are weights")
+	}
+
+	if opts.DockerfileFile != "" {
+		dockerfileContents, err := os.ReadFile(opts.DockerfileFile)
 		if err != nil {
-			return fmt.Errorf("Failed to read Dockerfile at %s: %w", dockerfileFile, err)
+			return fmt.Errorf("Failed to read Dockerfile at %s: %w", opts.DockerfileFile, err)
 		}
-		if err := docker.Build(dir, string(dockerfileContents), imageName, secrets, noCache, progressOutput); err != nil {
+		context, err := checkBuildContext(cfg, dir, projectDockerignore)
+		if err != nil {
+			return err
+		}
+		if err := checkContextSecrets(cfg, dir, context); err != nil {
+			return err
+		}
+		if err := checkDiskSpace(cfg, dir, "", context.size); err != nil {
+			return err
+		}
+		if err := buildWithTimings(ctx, dir, string(dockerfileContents), "", imageName, opts.Secrets, opts.BuildArgs, opts.NoCache, opts.ProgressOutput, t, dockerfile.InstructionSection); err != nil {
+			if opts.DebugOnFailure && ctx.Err() == nil {
+				debugBuildFailure(ctx, dir, string(dockerfileContents), "", imageName, opts.Secrets, opts.BuildArgs, opts.ProgressOutput, err)
+			}
 			return fmt.Errorf("Failed to build Docker image: %w", err)
 		}
 	} else {
+		if cfg.Build.SharedLayers {
+			// The files in the layers that are the same for every model need the same timestamps too, for their
+			// layers to be identical
+			opts.BuildArgs = append(append([]string{}, opts.BuildArgs...), docker.SourceDateEpochArg+"=0")
+		}
+		warnSystemPackages(cfg)
+		if err := analyzePredictors(cfg, dir); err != nil {
+			return err
+		}
+		if err := buildWorkspaceBase(ctx, cfg, opts.Secrets, opts.BuildArgs, opts.NoCache, opts.UseCudaBaseImage, opts.ProgressOutput); err != nil {
+			return err
+		}
 		generator, err := dockerfile.NewGenerator(cfg, dir)
 		if err != nil {
 			return fmt.Errorf("Error creating Dockerfile generator: %w", err)
@@ -45,54 +142,226 @@ func Build(cfg *config.Config, dir, imageName string, secrets []string, noCache,
 				console.Warnf("Error cleaning up Dockerfile generator: %s", err)
 			}
 		}()
-		generator.SetUseCudaBaseImage(useCudaBaseImage)
+		state, err := prepareBuildState(dir, imageName, generator, opts.Resume)
+		if err != nil {
+			return err
+		}
+		// This runs before the generator is cleaned up, so the generated files are kept if the build failed
+		defer func() {
+			if buildErr != nil {
+				generator.KeepTmpDir()
+				if errors.Is(buildErr, context.Canceled) {
+					console.Infof("The build was canceled. %s.", state.progress())
+					t.print()
+				}
+				console.Info("To continue the build where it stopped, run it again with --resume.")
+			} else if err := state.remove(); err != nil {
+				console.Warnf("%s", err)
+			}
+		}()
+		generator.SetContext(ctx)
+		generator.SetUseCudaBaseImage(opts.UseCudaBaseImage)
+		if err := generator.SetFormat(opts.Format); err != nil {
+			return err
+		}
+		gpuRunAfterBuild := setGPURunDevice(generator, cfg)
+		baseImage, err := generator.BaseImage()
+		if err != nil {
+			return err
+		}
+		if opts.WeightsSigningKey != "" {
+			key, err := weights.LoadSigningKey(opts.WeightsSigningKey)
+			if err != nil {
+				return err
+			}
+			generator.SetWeightsSigningKey(key)
+			publicKey, err := weights.EncodePublicKey(key)
+			if err != nil {
+				return err
+			}
+			// The public key isn't in the image, so it has to be passed to the container for it to start
+			console.Infof("Signing the weights manifest. Run the image with COG_WEIGHTS_PUBLIC_KEY set to its public key:\n%s", publicKey)
+		}
 
-		if separateWeights {
+		if cfg.QuantizeMethod() != "" && !opts.SeparateWeights {
+			// The quantized weights replace the weights from the weights image
+			console.Info("Building weights in a separate image, so they can be quantized...")
+			opts.SeparateWeights = true
+		}
+		if len(cfg.LazyWeightsPaths()) > 0 && !opts.SeparateWeights {
+			// Only the weights image can leave out the weights that are downloaded when the container starts
+			console.Info("Building weights in a separate image, so the weights profiles that aren't the default are left out...")
+			opts.SeparateWeights = true
+		}
+
+		if opts.SeparateWeights {
 			weightsDockerfile, runnerDockerfile, dockerignore, err := generator.Generate(imageName)
 			if err != nil {
 				return fmt.Errorf("Failed to generate Dockerfile: %w", err)
 			}
 
-			if err := backupDockerignore(); err != nil {
-				return fmt.Errorf("Failed to backup .dockerignore file: %w", err)
-			}
-
 			weightsManifest, err := generator.GenerateWeightsManifest()
 			if err != nil {
 				return fmt.Errorf("Failed to generate weights manifest: %w", err)
 			}
-			cachedManifest, _ := weights.LoadManifest(weightsManifestPath)
+			cachedManifest, _ := weights.LoadManifest(filepath.Join(dir, weightsManifestPath))
 			changed := cachedManifest == nil || !weightsManifest.Equal(cachedManifest)
+			weightsIgnore := append(cfg.LazyWeightsPaths(), cfg.Build.Ignore...)
+
+			runnerDockerignore := dockerfile.MergeDockerignore(projectDockerignore, dockerignore)
+			weightsImageDockerignore := dockerfile.MergeDockerignore(projectDockerignore, weightsDockerignore(weightsIgnore))
+			contexts := []string{runnerDockerignore}
 			if changed {
-				if err := buildWeightsImage(dir, weightsDockerfile, imageName+"-weights", secrets, noCache, progressOutput); err != nil {
+				contexts = append(contexts, weightsImageDockerignore)
+			}
+			context, err := checkBuildContext(cfg, dir, contexts...)
+			if err != nil {
+				return err
+			}
+			if err := checkContextSecrets(cfg, dir, context); err != nil {
+				return err
+			}
+			if err := checkDiskSpace(cfg, dir, baseImage, context.size); err != nil {
+				return err
+			}
+			if err := state.start(cfg, runnerDockerignore, weightsDockerfile, runnerDockerfile); err != nil {
+				return err
+			}
+
+			runnerCompleted := state.completed(stageImage, imageName)
+			builtEnvironment := false
+			if changed && !runnerCompleted {
+				// The runner only needs the weights image where it copies the weights in, so what comes before that
+				// is built at the same time
+				environmentDockerfile, _ := dockerfile.EnvironmentDockerfile(runnerDockerfile)
+				weightsErr, environmentErr := buildWeightsAndEnvironment(ctx, dir, weightsDockerfile, weightsImageDockerignore, environmentDockerfile, runnerDockerignore, imageName, opts.Secrets, opts.BuildArgs, opts.NoCache, opts.ProgressOutput, t, generator.Section)
+				if weightsErr != nil {
+					return fmt.Errorf("Failed to build model weights Docker image: %w", weightsErr)
+				}
+				if environmentErr != nil {
+					if opts.DebugOnFailure && ctx.Err() == nil {
+						debugBuildFailure(ctx, dir, environmentDockerfile, runnerDockerignore, imageName, opts.Secrets, opts.BuildArgs, opts.ProgressOutput, environmentErr)
+					}
+					return fmt.Errorf("Failed to build runner Docker image: %w", environmentErr)
+				}
+				builtEnvironment = true
+			} else if changed {
+				if err := buildWeightsImage(ctx, dir, weightsDockerfile, weightsImageDockerignore, imageName+"-weights", opts.Secrets, opts.BuildArgs, opts.NoCache, opts.ProgressOutput, t); err != nil {
 					return fmt.Errorf("Failed to build model weights Docker image: %w", err)
 				}
-				err := weightsManifest.Save(weightsManifestPath)
+			} else {
+				console.Info("Weights unchanged, skip rebuilding and use cached image...")
+			}
+			if changed {
+				err := weightsManifest.Save(filepath.Join(dir, weightsManifestPath))
 				if err != nil {
 					return fmt.Errorf("Failed to save weights hash: %w", err)
 				}
-			} else {
-				console.Info("Weights unchanged, skip rebuilding and use cached image...")
 			}
 
-			if err := buildRunnerImage(dir, runnerDockerfile, dockerignore, imageName, secrets, noCache, progressOutput); err != nil {
-				return fmt.Errorf("Failed to build runner Docker image: %w", err)
+			if !runnerCompleted {
+				err := buildRunnerImage(ctx, dir, runnerDockerfile, runnerDockerignore, imageName, opts.Secrets, opts.BuildArgs, opts.NoCache, opts.ProgressOutput, t, generator.Section)
+				if builtEnvironment {
+					removeEnvironmentImage(imageName)
+				}
+				if err != nil {
+					if opts.DebugOnFailure && ctx.Err() == nil {
+						debugBuildFailure(ctx, dir, runnerDockerfile, runnerDockerignore, imageName, opts.Secrets, opts.BuildArgs, opts.ProgressOutput, err)
+					}
+					return fmt.Errorf("Failed to build runner Docker image: %w", err)
+				}
+				if gpuRunAfterBuild {
+					if err := runGPUCommands(ctx, cfg, imageName); err != nil {
+						return fmt.Errorf("Failed to build runner Docker image: %w", err)
+					}
+				}
+				if err := state.complete(stageImage); err != nil {
+					return err
+				}
+			}
+
+			if method := cfg.QuantizeMethod(); method != "" && !state.completed(stageQuantized, QuantizedImageName(imageName, method)) {
+				if err := buildQuantizedImage(ctx, generator, dir, projectDockerignore, imageName, opts.Secrets, opts.BuildArgs, opts.NoCache, opts.ProgressOutput, t); err != nil {
+					return err
+				}
+				if gpuRunAfterBuild {
+					if err := runGPUCommands(ctx, cfg, QuantizedImageName(imageName, method)); err != nil {
+						return fmt.Errorf("Failed to build Docker image with quantized weights: %w", err)
+					}
+				}
+				if err := state.complete(stageQuantized); err != nil {
+					return err
+				}
 			}
 		} else {
 			dockerfileContents, err := generator.GenerateDockerfileWithoutSeparateWeights()
 			if err != nil {
 				return fmt.Errorf("Failed to generate Dockerfile: %w", err)
 			}
-			if err := docker.Build(dir, dockerfileContents, imageName, secrets, noCache, progressOutput); err != nil {
-				return fmt.Errorf("Failed to build Docker image: %w", err)
+			contextDockerignore := dockerfile.MergeDockerignore(projectDockerignore, generator.Dockerignore())
+			context, err := checkBuildContext(cfg, dir, contextDockerignore)
+			if err != nil {
+				return err
+			}
+			if err := checkContextSecrets(cfg, dir, context); err != nil {
+				return err
+			}
+			if err := checkDiskSpace(cfg, dir, baseImage, context.size); err != nil {
+				return err
+			}
+			if err := state.start(cfg, contextDockerignore, dockerfileContents); err != nil {
+				return err
+			}
+			if !state.completed(stageImage, imageName) {
+				if err := buildWithTimings(ctx, dir, dockerfileContents, contextDockerignore, imageName, opts.Secrets, opts.BuildArgs, opts.NoCache, opts.ProgressOutput, t, generator.Section); err != nil {
+					if opts.DebugOnFailure && ctx.Err() == nil {
+						debugBuildFailure(ctx, dir, dockerfileContents, contextDockerignore, imageName, opts.Secrets, opts.BuildArgs, opts.ProgressOutput, err)
+					}
+					return fmt.Errorf("Failed to build Docker image: %w", err)
+				}
+				if gpuRunAfterBuild {
+					if err := runGPUCommands(ctx, cfg, imageName); err != nil {
+						return fmt.Errorf("Failed to build Docker image: %w", err)
+					}
+				}
+				if err := state.complete(stageImage); err != nil {
+					return err
+				}
+			}
+		}
+
+		if opts.Flatten {
+			flattenStart := time.Now()
+			weightsPaths, err := generator.WeightsPaths()
+			if err != nil {
+				return err
+			}
+			images := []string{imageName}
+			if method := cfg.QuantizeMethod(); method != "" {
+				images = append(images, QuantizedImageName(imageName, method))
 			}
+			for _, image := range images {
+				if err := flattenImage(ctx, image, weightsPaths, opts.ProgressOutput); err != nil {
+					return err
+				}
+			}
+			t.since(timingFlatten, flattenStart)
 		}
 	}
 
+	// Docker stops when the build is canceled, but the rest of the build doesn't run Docker for long
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := checkImageSecrets(cfg, imageName, opts.Secrets); err != nil {
+		return err
+	}
+
+	schemaStart := time.Now()
 	var schemaJSON []byte
-	if schemaFile != "" {
-		console.Infof("Validating model schema from %s...", schemaFile)
-		data, err := os.ReadFile(schemaFile)
+	if opts.SchemaFile != "" {
+		console.Infof("Validating model schema from %s...", opts.SchemaFile)
+		data, err := os.ReadFile(opts.SchemaFile)
 		if err != nil {
 			return fmt.Errorf("Failed to read schema file: %w", err)
 		}
@@ -123,8 +392,21 @@ func Build(cfg *config.Config, dir, imageName string, secrets []string, noCache,
 	if err != nil {
 		return fmt.Errorf("Model schema is invalid: %w\n\n%s", err, string(schemaJSON))
 	}
+	t.since(timingSchema, schemaStart)
+
+	if cfg.Build.LicensePolicy != nil || opts.SBOMFile != "" {
+		licensesStart := time.Now()
+		if err := checkLicenses(cfg, imageName, opts.SBOMFile); err != nil {
+			return err
+		}
+		t.since(timingLicenses, licensesStart)
+	}
 
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	console.Info("Adding labels to image...")
+	labelsStart := time.Now()
 
 	// We used to set the cog_version and config labels in Dockerfile, because we didn't require running the
 	// built image to get those. But, the escaping of JSON inside a label inside a Dockerfile was gnarly, and
@@ -149,6 +431,37 @@ func Build(cfg *config.Config, dir, imageName string, secrets []string, noCache,
 		"org.cogmodel.openapi_schema": string(schemaJSON),
 	}
 
+	if cfg.License != nil && cfg.License.Model != "" {
+		labels["org.opencontainers.image.licenses"] = cfg.License.Model
+	}
+
+	if opts.Format != "" && opts.Format != dockerfile.FormatCog {
+		labels[global.LabelNamespace+"format"] = opts.Format
+	}
+
+	// Orchestrators can use these to decide how long to wait for the model to stop
+	if shutdown := cfg.Shutdown; shutdown != nil {
+		labels[global.LabelNamespace+"shutdown.grace_period"] = strconv.Itoa(cfg.ShutdownGracePeriod())
+		labels[global.LabelNamespace+"shutdown.drain"] = strconv.FormatBool(shutdown.Drain)
+		if shutdown.SIGTERM != "" {
+			labels[global.LabelNamespace+"shutdown.sigterm"] = shutdown.SIGTERM
+		}
+	}
+
+	// Orchestrators can use these to schedule the image onto a machine that's big enough
+	resources, err := cfg.ResourceRequirements()
+	if err != nil {
+		return err
+	}
+	for key, value := range resourceLabels(resources) {
+		labels[key] = value
+	}
+
+	// Orchestrators can use this to schedule the image onto GPUs its CUDA extensions were built for
+	if capabilities := cfg.ComputeCapabilities(); len(capabilities) > 0 {
+		labels[global.LabelNamespace+"gpu.compute_capabilities"] = strings.Join(capabilities, ",")
+	}
+
 	if isGitRepo(dir) {
 		if commit, err := gitHead(dir); commit != "" && err == nil {
 			labels["org.opencontainers.image.revision"] = commit
@@ -163,18 +476,47 @@ func Build(cfg *config.Config, dir, imageName string, secrets []string, noCache,
 		}
 	}
 
-	if err := docker.BuildAddLabelsToImage(imageName, labels); err != nil {
+	if err := docker.BuildAddLabelsToImage(ctx, imageName, labels); err != nil {
 		return fmt.Errorf("Failed to add labels to image: %w", err)
 	}
+	if method := cfg.QuantizeMethod(); method != "" && opts.DockerfileFile == "" {
+		labels[global.LabelNamespace+"quantize.method"] = method
+		if err := docker.BuildAddLabelsToImage(ctx, QuantizedImageName(imageName, method), labels); err != nil {
+			return fmt.Errorf("Failed to add labels to quantized image: %w", err)
+		}
+	}
+	t.since(timingLabels, labelsStart)
+
+	t.print()
 	return nil
 }
 
-func BuildBase(cfg *config.Config, dir string, useCudaBaseImage string, progressOutput string) (string, error) {
+func BuildBase(ctx context.Context, cfg *config.Config, dir string, buildArgs []string, useCudaBaseImage string, progressOutput string) (_ string, buildErr error) {
+	defer func() { buildErr = buildFailed(buildErr) }()
 	// TODO: better image management so we don't eat up disk space
 	// https://github.com/replicate/cog/issues/80
 	imageName := config.BaseDockerImageName(dir)
 
+	unlock, err := lockProject(dir)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+	if err := restoreDockerignoreBackup(dir); err != nil {
+		return "", err
+	}
+
 	console.Info("Building Docker image from environment in cog.yaml...")
+	if err := docker.CheckHost(dir, cfg.Build.GPU); err != nil {
+		return "", err
+	}
+	warnSystemPackages(cfg)
+	if err := analyzePredictors(cfg, dir); err != nil {
+		return "", err
+	}
+	if err := buildWorkspaceBase(ctx, cfg, []string{}, buildArgs, false, useCudaBaseImage, progressOutput); err != nil {
+		return "", err
+	}
 	generator, err := dockerfile.NewGenerator(cfg, dir)
 	if err != nil {
 		return "", fmt.Errorf("Error creating Dockerfile generator: %w", err)
@@ -186,17 +528,47 @@ func BuildBase(cfg *config.Config, dir string, useCudaBaseImage string, progress
 	}()
 
 	generator.SetUseCudaBaseImage(useCudaBaseImage)
+	gpuRunAfterBuild := setGPURunDevice(generator, cfg)
 
 	dockerfileContents, err := generator.GenerateBase()
 	if err != nil {
 		return "", fmt.Errorf("Failed to generate Dockerfile: %w", err)
 	}
-	if err := docker.Build(dir, dockerfileContents, imageName, []string{}, false, progressOutput); err != nil {
+	projectDockerignore, err := dockerfile.ReadDockerignore(dir)
+	if err != nil {
+		return "", err
+	}
+	// The base image doesn't have the project's files in it, so they aren't checked for secrets
+	if _, err := checkBuildContext(cfg, dir, projectDockerignore); err != nil {
+		return "", err
+	}
+	if err := docker.Build(ctx, dir, dockerfileContents, "", imageName, []string{}, buildArgs, false, progressOutput); err != nil {
 		return "", fmt.Errorf("Failed to build Docker image: %w", err)
 	}
+	if gpuRunAfterBuild {
+		if err := runGPUCommands(ctx, cfg, imageName); err != nil {
+			return "", fmt.Errorf("Failed to build Docker image: %w", err)
+		}
+	}
 	return imageName, nil
 }
 
+// buildFailed gives err the code of failed builds, unless the build was interrupted
+func buildFailed(err error) error {
+	if errors.Is(err, context.Canceled) {
+		return err
+	}
+	return cogerrors.BuildFailed(err)
+}
+
+// warnSystemPackages warns about Python packages that need system packages which aren't in system_packages,
+// because they often install fine but then fail to import
+func warnSystemPackages(cfg *config.Config) {
+	for _, advice := range cfg.SystemPackageAdvice() {
+		console.Warnf("%s. Add them to system_packages in cog.yaml, or run 'cog build --fix' to add them.", advice)
+	}
+}
+
 func isGitRepo(dir string) bool {
 	if _, err := os.Stat(path.Join(dir, ".git")); os.IsNotExist(err) {
 		return false
@@ -231,78 +603,90 @@ func gitTag(dir string) (string, error) {
 	return tag, nil
 }
 
-func buildWeightsImage(dir, dockerfileContents, imageName string, secrets []string, noCache bool, progressOutput string) error {
-	if err := makeDockerignoreForWeightsImage(); err != nil {
-		return fmt.Errorf("Failed to create .dockerignore file: %w", err)
+// buildQuantizedImage builds a variant of the image with the weights quantized with the method in
+// build.optimize.quantize. It shares every layer but the weights with the image that was just built.
+func buildQuantizedImage(ctx context.Context, generator *dockerfile.Generator, dir, projectDockerignore, imageName string, secrets []string, buildArgs []string, noCache bool, progressOutput string, timings *buildTimings) error {
+	quantizedImage := QuantizedImageName(imageName, generator.Config.QuantizeMethod())
+	console.Infof("Building image with quantized weights as %s...", quantizedImage)
+
+	generator.SetQuantize(true)
+	if config.QuantizeNeedsGPU(generator.Config.QuantizeMethod()) {
+		if docker.BuilderHasGPU() {
+			generator.SetGPURunDevice(true)
+		} else if err := quantizeInContainer(ctx, generator, dir, projectDockerignore, imageName, quantizedImage+"-quantize", secrets, buildArgs, noCache, progressOutput, timings); err != nil {
+			return err
+		}
 	}
-	if err := docker.Build(dir, dockerfileContents, imageName, secrets, noCache, progressOutput); err != nil {
-		return fmt.Errorf("Failed to build Docker image for model weights: %w", err)
+	_, dockerfileContents, dockerignore, err := generator.Generate(imageName)
+	if err != nil {
+		return fmt.Errorf("Failed to generate Dockerfile with quantized weights: %w", err)
+	}
+	if err := buildRunnerImage(ctx, dir, dockerfileContents, dockerfile.MergeDockerignore(projectDockerignore, dockerignore), quantizedImage, secrets, buildArgs, noCache, progressOutput, timings, generator.Section); err != nil {
+		return fmt.Errorf("Failed to build Docker image with quantized weights: %w", err)
 	}
 	return nil
 }
 
-func buildRunnerImage(dir, dockerfileContents, dockerignoreContents, imageName string, secrets []string, noCache bool, progressOutput string) error {
-	if err := writeDockerignore(dockerignoreContents); err != nil {
-		return fmt.Errorf("Failed to write .dockerignore file with weights included: %w", err)
+// quantizeInContainer quantizes the weights with a method that needs a GPU, when the Docker builder doesn't have
+// one. It builds quantizeImage with the tools and the weights, quantizes them in a container started from it with
+// the GPU, and makes the generator copy them from it.
+func quantizeInContainer(ctx context.Context, generator *dockerfile.Generator, dir, projectDockerignore, imageName, quantizeImage string, secrets []string, buildArgs []string, noCache bool, progressOutput string, timings *buildTimings) error {
+	console.Info("The Docker builder doesn't have a GPU, so the weights will be quantized in a container after the build...")
+	dockerfileContents, dockerignore, err := generator.GenerateQuantize(imageName)
+	if err != nil {
+		return fmt.Errorf("Failed to generate Dockerfile to quantize weights: %w", err)
 	}
-	if err := docker.Build(dir, dockerfileContents, imageName, secrets, noCache, progressOutput); err != nil {
-		return fmt.Errorf("Failed to build Docker image: %w", err)
+	if err := buildWithTimings(ctx, dir, dockerfileContents, dockerfile.MergeDockerignore(projectDockerignore, dockerignore), quantizeImage, secrets, buildArgs, noCache, progressOutput, timings, generator.Section); err != nil {
+		return fmt.Errorf("Failed to build Docker image to quantize weights: %w", err)
 	}
-	if err := restoreDockerignore(); err != nil {
-		return fmt.Errorf("Failed to restore backup .dockerignore file: %w", err)
+	command := generator.QuantizeCommand()
+	console.Infof("Running '%s' with the GPU...", command)
+	if err := docker.RunAndCommit(ctx, quantizeImage, command, "all"); err != nil {
+		return fmt.Errorf("Failed to quantize weights: %w", err)
 	}
+	generator.SetQuantizeImage(quantizeImage)
 	return nil
 }
 
-func makeDockerignoreForWeightsImage() error {
-	if err := backupDockerignore(); err != nil {
-		return fmt.Errorf("Failed to backup .dockerignore file: %w", err)
-	}
-
-	if err := writeDockerignore(dockerfile.DockerignoreHeader); err != nil {
-		return fmt.Errorf("Failed to write .dockerignore file: %w", err)
+// buildWeightsImage builds the image with the weights, sending Docker the files that dockerignore doesn't exclude
+func buildWeightsImage(ctx context.Context, dir, dockerfileContents, dockerignore, imageName string, secrets []string, buildArgs []string, noCache bool, progressOutput string, timings *buildTimings) error {
+	weightsSection := func(string) string { return dockerfile.SectionWeights }
+	if err := buildWithTimings(ctx, dir, dockerfileContents, dockerignore, imageName, secrets, buildArgs, noCache, progressOutput, timings, weightsSection); err != nil {
+		return fmt.Errorf("Failed to build Docker image for model weights: %w", err)
 	}
 	return nil
 }
 
-func writeDockerignore(contents string) error {
-	// read existing file contents from .dockerignore.cog.bak if it exists, and append to the new contents
-	if _, err := os.Stat(dockerignoreBackupPath); err == nil {
-		existingContents, err := os.ReadFile(dockerignoreBackupPath)
-		if err != nil {
-			return err
-		}
-		contents = string(existingContents) + "\n" + contents
+func buildRunnerImage(ctx context.Context, dir, dockerfileContents, dockerignore, imageName string, secrets []string, buildArgs []string, noCache bool, progressOutput string, timings *buildTimings, section func(string) string) error {
+	if err := buildWithTimings(ctx, dir, dockerfileContents, dockerignore, imageName, secrets, buildArgs, noCache, progressOutput, timings, section); err != nil {
+		return fmt.Errorf("Failed to build Docker image: %w", err)
 	}
-
-	return os.WriteFile(".dockerignore", []byte(contents), 0o644)
+	return nil
 }
 
-func backupDockerignore() error {
-	if _, err := os.Stat(".dockerignore"); err != nil {
-		if os.IsNotExist(err) {
-			// .dockerignore file does not exist, nothing to backup
-			return nil
-		}
-		return err
+// weightsDockerignore returns the .dockerignore lines for the weights image, which also ignores the weights
+// that are downloaded when the container starts, and the globs in build.ignore
+func weightsDockerignore(ignore []string) string {
+	contents := dockerfile.DockerignoreHeader
+	for _, p := range ignore {
+		contents += fmt.Sprintf("%[1]s\n%[1]s/**/*\n", p)
 	}
-
-	// rename the .dockerignore file to a new name
-	return os.Rename(".dockerignore", dockerignoreBackupPath)
+	return contents
 }
 
-func restoreDockerignore() error {
-	if err := os.Remove(".dockerignore"); err != nil {
-		return err
-	}
-
-	if _, err := os.Stat(dockerignoreBackupPath); err != nil {
+// restoreDockerignoreBackup puts the project's .dockerignore back, if an older version of Cog, which replaced it
+// while it built, was stopped before it could
+func restoreDockerignoreBackup(dir string) error {
+	backup := filepath.Join(dir, dockerignoreBackupPath)
+	if _, err := os.Stat(backup); err != nil {
 		if os.IsNotExist(err) {
-			// .dockerignore backup file does not exist, nothing to restore
 			return nil
 		}
 		return err
 	}
-
-	return os.Rename(dockerignoreBackupPath, ".dockerignore")
+	console.Warnf("Restoring .dockerignore from %s, which was left by a build that was stopped", dockerignoreBackupPath)
+	if err := os.Rename(backup, filepath.Join(dir, ".dockerignore")); err != nil {
+		return fmt.Errorf("Failed to restore .dockerignore: %w", err)
+	}
+	return nil
 }
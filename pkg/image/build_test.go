@@ -0,0 +1,59 @@
+package image
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/dockerfile"
+)
+
+func TestRestoreDockerignoreBackup(t *testing.T) {
+	dir := t.TempDir()
+	original := []byte("# the project's own\n*.ckpt\n")
+
+	// Without a backup, the .dockerignore is left as it is
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".dockerignore"), original, 0o644))
+	require.NoError(t, restoreDockerignoreBackup(dir))
+	contents, err := os.ReadFile(filepath.Join(dir, ".dockerignore"))
+	require.NoError(t, err)
+	require.Equal(t, original, contents)
+
+	// A build by an older version of Cog that was stopped left its own .dockerignore, and the project's in the backup
+	require.NoError(t, os.WriteFile(filepath.Join(dir, dockerignoreBackupPath), original, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".dockerignore"), []byte(dockerfile.DockerignoreHeader+"models\n"), 0o644))
+	require.NoError(t, restoreDockerignoreBackup(dir))
+	contents, err = os.ReadFile(filepath.Join(dir, ".dockerignore"))
+	require.NoError(t, err)
+	require.Equal(t, original, contents)
+	require.NoFileExists(t, filepath.Join(dir, dockerignoreBackupPath))
+}
+
+func TestBuildLeavesDockerignore(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The fake docker command is a shell script")
+	}
+	fake := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(fake, "docker"), []byte("#!/bin/sh\n"), 0o755))
+	t.Setenv("PATH", fake+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	dir := t.TempDir()
+	original := []byte("# the project's own\n*.ckpt\n")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".dockerignore"), original, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, dockerignoreBackupPath), original, 0o644))
+
+	require.NoError(t, restoreDockerignoreBackup(dir))
+	dockerignore := dockerfile.MergeDockerignore(string(original), "models\n")
+	require.NoError(t, buildWithTimings(context.Background(), dir, "FROM python:3.11", dockerignore, "my-model", nil, nil, false, "plain", newBuildTimings(), func(string) string { return "" }))
+
+	contents, err := os.ReadFile(filepath.Join(dir, ".dockerignore"))
+	require.NoError(t, err)
+	require.Equal(t, original, contents)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
@@ -0,0 +1,128 @@
+package image
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/dockerfile"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// contentTagLength is how many characters of the content digest are in a content tag
+const contentTagLength = 16
+
+// ContentDigest returns a hash of what the image is built from: the plan of the build, which has the version of
+// Cog, the base image, the Dockerfiles, the files Cog generates and the checksums of the weights, the workspace the
+// model is in, the build args, and the contents of the rest of the files that are sent to Docker. Builds from the
+// same inputs have the same digest, wherever they run.
+func ContentDigest(cfg *config.Config, dir string, imageName string, separateWeights bool, useCudaBaseImage string, format string, buildArgs []string) (string, error) {
+	generator, err := dockerfile.NewGenerator(cfg, dir)
+	if err != nil {
+		return "", fmt.Errorf("Error creating Dockerfile generator: %w", err)
+	}
+	defer func() {
+		if err := generator.Cleanup(); err != nil {
+			console.Warnf("Error cleaning up Dockerfile generator: %s", err)
+		}
+	}()
+	generator.SetUseCudaBaseImage(useCudaBaseImage)
+	if err := generator.SetFormat(format); err != nil {
+		return "", err
+	}
+	// The tag isn't an input, and the runner's Dockerfile refers to the weights image by name
+	plan, err := generator.Plan(ImageRepository(imageName), separateWeights)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	planJSON, err := json.Marshal(plan)
+	if err != nil {
+		return "", err
+	}
+	hash.Write(planJSON)
+	if cfg.Workspace != nil {
+		// The model starts from the workspace's base image, which the plan only has the name of
+		workspaceJSON, err := json.Marshal(cfg.Workspace.Config())
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(hash, "\nworkspace %s", workspaceJSON)
+	}
+	args := append([]string{}, buildArgs...)
+	sort.Strings(args)
+	for _, arg := range args {
+		fmt.Fprintf(hash, "\narg %s", arg)
+	}
+
+	projectDockerignore, err := dockerfile.ReadDockerignore(dir)
+	if err != nil {
+		return "", err
+	}
+	context, err := measureContext(dir, []string{dockerfile.MergeDockerignore(projectDockerignore, plan.Dockerignore)})
+	if err != nil {
+		return "", err
+	}
+	for _, p := range context.paths {
+		// Cog's own files are in the plan, and the weights are in it by their checksums
+		if strings.HasPrefix(p, ".cog/") || isWeight(p, plan.Weights.Dirs, plan.Weights.Files) {
+			continue
+		}
+		sum, err := fileSHA256(filepath.Join(dir, filepath.FromSlash(p)))
+		if err != nil {
+			return "", fmt.Errorf("Failed to hash %s: %w", p, err)
+		}
+		fmt.Fprintf(hash, "\nfile %s %s", p, sum)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// ContentTag returns imageName with its tag replaced by the start of digest
+func ContentTag(imageName string, digest string) string {
+	return ImageRepository(imageName) + ":" + digest[:contentTagLength]
+}
+
+// ImageRepository returns imageName without its tag, e.g. r8.im/user/model for r8.im/user/model:v1
+func ImageRepository(imageName string) string {
+	if i := strings.LastIndex(imageName, ":"); i > strings.LastIndex(imageName, "/") {
+		return imageName[:i]
+	}
+	return imageName
+}
+
+// isWeight returns whether the slash-separated path p is one of the weights files, or in one of the weights
+// directories
+func isWeight(p string, dirs []string, files []string) bool {
+	for _, f := range files {
+		if p == filepath.ToSlash(f) {
+			return true
+		}
+	}
+	for _, d := range dirs {
+		if strings.HasPrefix(p, filepath.ToSlash(d)+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func fileSHA256(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,41 @@
+package image
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+func TestContentDigest(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cog.yaml"), []byte("build:\n  python_version: \"3.11\"\npredict: predict.py:Predictor\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "predict.py"), []byte("print('hello')"), 0o644))
+	cfg, err := config.FromYAML([]byte("build:\n  python_version: \"3.11\"\npredict: predict.py:Predictor\n"))
+	require.NoError(t, err)
+	require.NoError(t, cfg.ValidateAndComplete(dir))
+
+	digest := func(imageName string, buildArgs ...string) string {
+		d, err := ContentDigest(cfg, dir, imageName, false, "auto", "", buildArgs)
+		require.NoError(t, err)
+		return d
+	}
+	first := digest("cog-model")
+	require.Len(t, first, 64)
+	// The tag isn't an input
+	require.Equal(t, first, digest("cog-model:v1"))
+	require.NotEqual(t, first, digest("cog-model", "VERSION=2"))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "predict.py"), []byte("print('hello, world')"), 0o644))
+	require.NotEqual(t, first, digest("cog-model"))
+}
+
+func TestContentTag(t *testing.T) {
+	digest := "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	require.Equal(t, "cog-model:0123456789abcdef", ContentTag("cog-model", digest))
+	require.Equal(t, "r8.im/user/model:0123456789abcdef", ContentTag("r8.im/user/model:v1", digest))
+	require.Equal(t, "localhost:5000/model:0123456789abcdef", ContentTag("localhost:5000/model", digest))
+}
@@ -0,0 +1,149 @@
+package image
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/docker/go-units"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/dockerfile"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// contextBreakdownSize is how big the build context is before the largest entries in it are printed
+const contextBreakdownSize = 1000 * 1000 * 1000
+
+// contextBreakdownEntries is how many of the largest entries are printed
+const contextBreakdownEntries = 10
+
+// contextEntry is a file or directory at the top of the build context, and how much of it is sent to Docker
+type contextEntry struct {
+	name  string
+	size  int64
+	files int
+}
+
+// buildContext is what is sent to Docker from the project directory
+type buildContext struct {
+	size    int64
+	files   int
+	entries []contextEntry
+	// paths are the slash-separated paths of the files, relative to the project directory
+	paths []string
+}
+
+// measureContext adds up the files in dir that are sent to Docker by builds with each of the .dockerignore
+// contents. Files that are sent by more than one build are counted once.
+func measureContext(dir string, dockerignores []string) (*buildContext, error) {
+	matchers := []*dockerfile.DockerignoreMatcher{}
+	hasExceptions := false
+	for _, contents := range dockerignores {
+		m, err := dockerfile.NewDockerignoreMatcher(contents)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, m)
+		hasExceptions = hasExceptions || m.HasExceptions()
+	}
+	excluded := func(p string) bool {
+		for _, m := range matchers {
+			if !m.Excludes(p) {
+				return false
+			}
+		}
+		return true
+	}
+
+	context := &buildContext{}
+	byName := map[string]*contextEntry{}
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		if info.IsDir() {
+			// Files in an excluded directory can only be sent if a line starting with ! includes them again
+			if !hasExceptions && excluded(rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if excluded(rel) {
+			return nil
+		}
+		name := strings.SplitN(filepath.ToSlash(rel), "/", 2)[0]
+		entry, ok := byName[name]
+		if !ok {
+			entry = &contextEntry{name: name}
+			byName[name] = entry
+		}
+		entry.size += info.Size()
+		entry.files++
+		context.size += info.Size()
+		context.files++
+		context.paths = append(context.paths, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to measure the build context: %w", err)
+	}
+
+	for _, entry := range byName {
+		context.entries = append(context.entries, *entry)
+	}
+	sort.Slice(context.entries, func(i, j int) bool {
+		if context.entries[i].size != context.entries[j].size {
+			return context.entries[i].size > context.entries[j].size
+		}
+		return context.entries[i].name < context.entries[j].name
+	})
+	return context, nil
+}
+
+// largest returns a table of the largest entries in the build context
+func (c *buildContext) largest() string {
+	s := ""
+	for i, entry := range c.entries {
+		if i == contextBreakdownEntries {
+			break
+		}
+		s += fmt.Sprintf("  %-10s %s (%d files)\n", units.HumanSize(float64(entry.size)), entry.name, entry.files)
+	}
+	return s
+}
+
+// checkBuildContext prints how much is sent to Docker by builds with each of the .dockerignore contents, and
+// fails if it's more than build.max_context_size, so a dataset that was left in the project by mistake isn't
+// sent to Docker. It returns what's sent.
+func checkBuildContext(cfg *config.Config, dir string, dockerignores ...string) (*buildContext, error) {
+	context, err := measureContext(dir, dockerignores)
+	if err != nil {
+		return nil, err
+	}
+	limit, err := cfg.MaxContextSizeBytes()
+	if err != nil {
+		return nil, err
+	}
+	size := units.HumanSize(float64(context.size))
+	if limit > 0 && context.size > limit {
+		return nil, fmt.Errorf(`The build context is %s, which is more than build.max_context_size (%s). The largest files and directories in it are:
+
+%s
+Add the ones the model doesn't need to .dockerignore, or to build.ignore in cog.yaml. If the model needs them, set build.max_context_size in cog.yaml to a bigger size, or to 0 for no limit.`, size, units.HumanSize(float64(limit)), context.largest())
+	}
+	console.Infof("Sending %s build context to Docker (%d files)...", size, context.files)
+	if context.size > contextBreakdownSize {
+		console.Infof("The largest files and directories in it are:\n%s", strings.TrimRight(context.largest(), "\n"))
+	}
+	return context, nil
+}
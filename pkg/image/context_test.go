@@ -0,0 +1,65 @@
+package image
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+func writeContextFile(t *testing.T, dir string, name string, size int) {
+	t.Helper()
+	p := filepath.Join(dir, name)
+	require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+	require.NoError(t, os.WriteFile(p, make([]byte, size), 0o644))
+}
+
+func TestMeasureContext(t *testing.T) {
+	dir := t.TempDir()
+	writeContextFile(t, dir, "predict.py", 10)
+	writeContextFile(t, dir, "weights/model.bin", 1000)
+	writeContextFile(t, dir, "data/train.csv", 5000)
+	writeContextFile(t, dir, "data/README.md", 20)
+
+	context, err := measureContext(dir, []string{"data\n!data/README.md\n"})
+	require.NoError(t, err)
+	require.Equal(t, int64(1030), context.size)
+	require.Equal(t, 3, context.files)
+	require.Equal(t, []contextEntry{
+		{name: "weights", size: 1000, files: 1},
+		{name: "data", size: 20, files: 1},
+		{name: "predict.py", size: 10, files: 1},
+	}, context.entries)
+
+	// Files that are sent by either build are counted once
+	context, err = measureContext(dir, []string{"data\nweights\n", "*\n!weights\n"})
+	require.NoError(t, err)
+	require.Equal(t, int64(1010), context.size)
+}
+
+func TestCheckBuildContext(t *testing.T) {
+	dir := t.TempDir()
+	writeContextFile(t, dir, "predict.py", 10)
+	writeContextFile(t, dir, "data/train.csv", 5000)
+
+	cfg, err := config.FromYAML([]byte("build:\n  max_context_size: 1kB\n"))
+	require.NoError(t, err)
+	require.NoError(t, cfg.ValidateAndComplete(""))
+
+	_, err = checkBuildContext(cfg, dir, "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "The build context is 5.01kB, which is more than build.max_context_size (1kB)")
+	require.Contains(t, err.Error(), "data (1 files)")
+
+	_, err = checkBuildContext(cfg, dir, "data\n")
+	require.NoError(t, err)
+
+	cfg, err = config.FromYAML([]byte("build:\n  max_context_size: 0\n"))
+	require.NoError(t, err)
+	require.NoError(t, cfg.ValidateAndComplete(""))
+	_, err = checkBuildContext(cfg, dir, "")
+	require.NoError(t, err)
+}
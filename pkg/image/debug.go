@@ -0,0 +1,78 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// runFlags matches the flags of a RUN instruction, e.g. --mount=type=cache,target=/root/.cache/pip
+var runFlags = regexp.MustCompile(`^(?:--[a-z]+=\S+\s+)*`)
+
+// debugBuildFailure builds the Dockerfile up to the RUN instruction that made the build fail, then opens
+// a shell in the resulting image so the user can run the failing command themselves
+func debugBuildFailure(ctx context.Context, dir, dockerfileContents, dockerignore, imageName string, secrets []string, buildArgs []string, progressOutput string, buildErr error) {
+	var runErr *docker.BuildError
+	if !errors.As(buildErr, &runErr) {
+		console.Warn("Couldn't find the instruction that made the build fail, so there is nothing to debug")
+		return
+	}
+	truncated, err := dockerfileBefore(dockerfileContents, runErr.Command)
+	if err != nil {
+		console.Warnf("Can't debug the build failure: %s", err)
+		return
+	}
+
+	debugImage := imageName + "-debug"
+	console.Infof("\nBuilding the image up to the failing instruction as %s...", debugImage)
+	if err := docker.Build(ctx, dir, truncated, dockerignore, debugImage, secrets, buildArgs, false, progressOutput); err != nil {
+		console.Warnf("Failed to build the image up to the failing instruction: %s", err)
+		return
+	}
+
+	console.Infof("\nOpening a shell in the image just before the failing instruction. Your project is mounted at /src. The command that failed was:\n\n    %s\n\nExit the shell to finish.", runErr.Command)
+	err = docker.Run(docker.RunOptions{
+		Image:   debugImage,
+		Args:    []string{"/bin/sh", "-c", "if command -v bash > /dev/null; then exec bash; else exec sh; fi"},
+		Volumes: []docker.Volume{{Source: dir, Destination: "/src"}},
+	})
+	if err != nil {
+		console.Debugf("Shell exited with %s", err)
+	}
+}
+
+// dockerfileBefore returns the Dockerfile up to, but not including, the RUN instruction that runs command
+func dockerfileBefore(dockerfile string, command string) (string, error) {
+	lines := strings.Split(dockerfile, "\n")
+	for start := 0; start < len(lines); start++ {
+		// Join lines continued with a backslash, which BuildKit does before it runs the command
+		end := start
+		instruction := lines[start]
+		for strings.HasSuffix(instruction, "\\") && end+1 < len(lines) {
+			end++
+			instruction = strings.TrimSuffix(instruction, "\\") + lines[end]
+		}
+
+		keyword, args, _ := strings.Cut(strings.TrimSpace(instruction), " ")
+		if strings.EqualFold(keyword, "RUN") {
+			args = runFlags.ReplaceAllString(strings.TrimSpace(args), "")
+			if collapseSpace(args) == collapseSpace(command) {
+				if start == 0 {
+					return "", fmt.Errorf("The failing instruction is the first one in the Dockerfile")
+				}
+				return strings.Join(lines[:start], "\n"), nil
+			}
+		}
+		start = end
+	}
+	return "", fmt.Errorf("Couldn't find the instruction that runs '%s' in the Dockerfile", command)
+}
+
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
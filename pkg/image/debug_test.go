@@ -0,0 +1,32 @@
+package image
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDockerfileBefore(t *testing.T) {
+	dockerfile := `#syntax=docker/dockerfile:1.4
+FROM python:3.11 as deps
+RUN --mount=type=cache,target=/root/.cache/pip pip install -t /dep -r /tmp/requirements.txt
+FROM python:3.11-slim
+RUN --mount=type=cache,target=/var/cache/apt apt-get update -qq && apt-get install -qqy \
+	ffmpeg \
+	libsm6
+RUN echo done`
+
+	truncated, err := dockerfileBefore(dockerfile, "apt-get update -qq && apt-get install -qqy 	ffmpeg 	libsm6")
+	require.NoError(t, err)
+	require.Equal(t, `#syntax=docker/dockerfile:1.4
+FROM python:3.11 as deps
+RUN --mount=type=cache,target=/root/.cache/pip pip install -t /dep -r /tmp/requirements.txt
+FROM python:3.11-slim`, truncated)
+
+	truncated, err = dockerfileBefore(dockerfile, "pip install -t /dep -r /tmp/requirements.txt")
+	require.NoError(t, err)
+	require.Equal(t, "#syntax=docker/dockerfile:1.4\nFROM python:3.11 as deps", truncated)
+
+	_, err = dockerfileBefore(dockerfile, "make")
+	require.Error(t, err)
+}
@@ -0,0 +1,134 @@
+package image
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/go-units"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/util/files"
+)
+
+// Rough sizes of what a build downloads and unpacks, which are on the generous side, so builds that would run out
+// of space fail before they start
+const (
+	cudaBaseImageSize   int64 = 10 * units.GB
+	pythonBaseImageSize int64 = 1 * units.GB
+	pythonPackagesSize  int64 = 1 * units.GB
+	torchSize           int64 = 6 * units.GB
+	tensorflowSize      int64 = 3 * units.GB
+	// buildHeadroom is for BuildKit's caches and the layers it writes while it exports the image
+	buildHeadroom int64 = 2 * units.GB
+	// tmpDirSize is how much space the files Cog writes to .cog/tmp need
+	tmpDirSize int64 = 500 * units.MB
+)
+
+// diskEstimate is how much space a build needs in Docker's data root
+type diskEstimate struct {
+	baseImage int64
+	packages  int64
+	// context is the build context, which is sent to Docker, then copied into the image
+	context  int64
+	headroom int64
+}
+
+func (e diskEstimate) total() int64 {
+	return e.baseImage + e.packages + e.context + e.headroom
+}
+
+func (e diskEstimate) String() string {
+	parts := []string{}
+	for _, part := range []struct {
+		name string
+		size int64
+	}{
+		{"base image", e.baseImage},
+		{"Python packages", e.packages},
+		{"build context", e.context},
+		{"caches", e.headroom},
+	} {
+		if part.size > 0 {
+			parts = append(parts, fmt.Sprintf("%s %s", part.name, units.HumanSize(float64(part.size))))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// estimateBuildDisk returns how much space building cfg needs. baseImage is the image it's built from, which is
+// empty if it's built from a Dockerfile, and doesn't need space if it's already been pulled.
+func estimateBuildDisk(cfg *config.Config, baseImage string, baseImagePulled bool, contextSize int64) diskEstimate {
+	estimate := diskEstimate{context: 2 * contextSize, headroom: buildHeadroom}
+	if baseImage == "" {
+		return estimate
+	}
+	if !baseImagePulled {
+		if cfg.Build.GPU && !strings.HasPrefix(baseImage, "python:") {
+			estimate.baseImage = cudaBaseImageSize
+		} else {
+			estimate.baseImage = pythonBaseImageSize
+		}
+	}
+	estimate.packages = pythonPackagesSize
+	if cfg.HasPythonPackage("torch") {
+		estimate.packages += torchSize
+	}
+	if cfg.HasPythonPackage("tensorflow") {
+		estimate.packages += tensorflowSize
+	}
+	return estimate
+}
+
+// diskProblems returns why there isn't enough space for a build that needs estimate in Docker's data root, and
+// tmpDirSize in tmpDir. Free space that isn't known is 0, and isn't checked.
+func diskProblems(estimate diskEstimate, dataRoot string, dataRootFree int64, tmpDir string, tmpDirFree int64) []string {
+	problems := []string{}
+	if dataRootFree > 0 && estimate.total() > dataRootFree {
+		problems = append(problems, fmt.Sprintf("The build needs about %s of free space in Docker's data root %s (%s), but it only has %s", units.HumanSize(float64(estimate.total())), dataRoot, estimate, units.HumanSize(float64(dataRootFree))))
+	}
+	if tmpDirFree > 0 && tmpDirSize > tmpDirFree {
+		problems = append(problems, fmt.Sprintf("The build needs about %s of free space in %s, but it only has %s", units.HumanSize(float64(tmpDirSize)), tmpDir, units.HumanSize(float64(tmpDirFree))))
+	}
+	return problems
+}
+
+// checkDiskSpace fails if Docker's data root, or the filesystem .cog/tmp is on, doesn't have the space a build
+// needs, so it doesn't run out of space partway through. It's skipped if COG_NO_DISK_CHECK is set, and for data
+// roots in a VM, like Docker Desktop's.
+func checkDiskSpace(cfg *config.Config, dir string, baseImage string, contextSize int64) error {
+	if os.Getenv("COG_NO_DISK_CHECK") != "" {
+		return nil
+	}
+	baseImagePulled := false
+	if baseImage != "" {
+		if exists, err := docker.ImageExists(baseImage); err == nil {
+			baseImagePulled = exists
+		}
+	}
+	estimate := estimateBuildDisk(cfg, baseImage, baseImagePulled, contextSize)
+	console.Debugf("Estimated disk space for the build: %s (%s)", units.HumanSize(float64(estimate.total())), estimate)
+
+	host, err := docker.DetectHostResources()
+	if err != nil {
+		console.Debugf("Skipping the disk space check: %s", err)
+		return nil
+	}
+	tmpDir := filepath.Join(dir, ".cog", "tmp")
+	// .cog/tmp is created by the generator, so its parent is checked if it doesn't exist yet
+	tmpDirFree, err := files.FreeSpace(tmpDir)
+	if err != nil {
+		tmpDirFree, err = files.FreeSpace(dir)
+		if err != nil {
+			console.Debugf("Failed to check the free space in %s: %s", tmpDir, err)
+		}
+	}
+	problems := diskProblems(estimate, host.DataRoot, host.DiskBytes, tmpDir, tmpDirFree)
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s.\n\nFree up space with 'docker system prune' and 'docker builder prune', or set COG_NO_DISK_CHECK=1 to build anyway", strings.Join(problems, ".\n"))
+}
@@ -0,0 +1,45 @@
+package image
+
+import (
+	"testing"
+
+	"github.com/docker/go-units"
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+func TestEstimateBuildDisk(t *testing.T) {
+	cfg := &config.Config{Build: &config.Build{GPU: true, PythonVersion: "3.11", PythonPackagesStable: []string{"torch==2.1.0", "numpy"}}}
+
+	estimate := estimateBuildDisk(cfg, "r8.im/cog-base:cuda11.8-python3.11", false, 3*units.GB)
+	require.Equal(t, diskEstimate{baseImage: cudaBaseImageSize, packages: pythonPackagesSize + torchSize, context: 6 * units.GB, headroom: buildHeadroom}, estimate)
+
+	// A base image that's been pulled doesn't need more space
+	estimate = estimateBuildDisk(cfg, "r8.im/cog-base:cuda11.8-python3.11", true, 0)
+	require.Equal(t, int64(0), estimate.baseImage)
+
+	cpu := &config.Config{Build: &config.Build{PythonVersion: "3.11"}}
+	estimate = estimateBuildDisk(cpu, "python:3.11-slim", false, 0)
+	require.Equal(t, pythonBaseImageSize, estimate.baseImage)
+	require.Equal(t, pythonPackagesSize, estimate.packages)
+
+	// What a Dockerfile installs isn't known
+	estimate = estimateBuildDisk(cfg, "", false, units.GB)
+	require.Equal(t, diskEstimate{context: 2 * units.GB, headroom: buildHeadroom}, estimate)
+}
+
+func TestDiskProblems(t *testing.T) {
+	estimate := diskEstimate{baseImage: 10 * units.GB, context: 4 * units.GB, headroom: buildHeadroom}
+
+	require.Empty(t, diskProblems(estimate, "/var/lib/docker", 100*units.GB, ".cog/tmp", 10*units.GB))
+	// Free space that isn't known isn't checked
+	require.Empty(t, diskProblems(estimate, "/var/lib/docker", 0, ".cog/tmp", 0))
+
+	problems := diskProblems(estimate, "/var/lib/docker", 5*units.GB, ".cog/tmp", 100*units.MB)
+	require.Len(t, problems, 2)
+	require.Contains(t, problems[0], "about 16GB of free space in Docker's data root /var/lib/docker")
+	require.Contains(t, problems[0], "base image 10GB, build context 4GB, caches 2GB")
+	require.Contains(t, problems[0], "only has 5GB")
+	require.Contains(t, problems[1], "about 500MB of free space in .cog/tmp")
+}
@@ -0,0 +1,286 @@
+package image
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// Where a built image can be exported to with cog build --output, besides Docker
+const (
+	// OutputOCI is an OCI image layout in a directory, which tools like skopeo, crane and nerdctl can read
+	OutputOCI = "oci"
+	// OutputContainerd is the image store of containerd, which is what Kubernetes nodes like k3s's run images from
+	OutputContainerd = "containerd"
+)
+
+// DefaultContainerdNamespace is the containerd namespace images are loaded into, which is where Kubernetes looks
+// for them
+const DefaultContainerdNamespace = "k8s.io"
+
+// Media types of the files in an OCI image layout
+const (
+	ociManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	ociConfigMediaType   = "application/vnd.oci.image.config.v1+json"
+	ociLayerMediaType    = "application/vnd.oci.image.layer.v1.tar"
+)
+
+// Output is where a built image is exported to
+type Output struct {
+	// Kind is OutputOCI or OutputContainerd
+	Kind string
+	// Dest is the directory of the OCI image layout, or the containerd namespace
+	Dest string
+}
+
+// ParseOutput parses the value of --output: oci:<directory>, containerd, or containerd:<namespace>
+func ParseOutput(s string) (*Output, error) {
+	kind, dest, _ := strings.Cut(s, ":")
+	switch kind {
+	case OutputOCI:
+		if dest == "" {
+			return nil, fmt.Errorf("--output oci needs the directory to write the image to, e.g. oci:./dist")
+		}
+		return &Output{Kind: OutputOCI, Dest: dest}, nil
+	case OutputContainerd:
+		if dest == "" {
+			dest = DefaultContainerdNamespace
+		}
+		return &Output{Kind: OutputContainerd, Dest: dest}, nil
+	default:
+		return nil, fmt.Errorf("Unknown output '%s'. It must be oci:<directory>, containerd, or containerd:<namespace>", s)
+	}
+}
+
+// Export writes imageName, which has been built with Docker, to output
+func Export(ctx context.Context, imageName string, output *Output) error {
+	r, w := io.Pipe()
+	go func() {
+		w.CloseWithError(docker.SaveTo(imageName, w))
+	}()
+	defer r.Close()
+
+	switch output.Kind {
+	case OutputOCI:
+		console.Infof("Writing %s to %s as an OCI image layout...", imageName, output.Dest)
+		return writeOCILayout(r, output.Dest, imageName)
+	case OutputContainerd:
+		console.Infof("Loading %s into containerd's %s namespace...", imageName, output.Dest)
+		return docker.ContainerdLoad(ctx, r, output.Dest)
+	}
+	return fmt.Errorf("Unknown output '%s'", output.Kind)
+}
+
+// dockerSaveManifest is an image in the manifest.json of an archive written by docker save
+type dockerSaveManifest struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type ociManifest struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType"`
+	Config        ociDescriptor   `json:"config"`
+	Layers        []ociDescriptor `json:"layers"`
+}
+
+type ociIndex struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType,omitempty"`
+	Manifests     []ociDescriptor `json:"manifests"`
+}
+
+// writeOCILayout writes the image in r, an archive written by docker save, to dir as an OCI image layout. Docker 25
+// and later already write one, and earlier versions write their own format, which is converted.
+func writeOCILayout(r io.Reader, dir string, imageName string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("Failed to create %s: %w", dir, err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("%s isn't empty, so the image can't be written to it", dir)
+	}
+	saved, err := os.MkdirTemp(dir, ".cog-save-")
+	if err != nil {
+		return fmt.Errorf("Failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(saved)
+	if err := extractTar(r, saved); err != nil {
+		return fmt.Errorf("Failed to read the image: %w", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(saved, "oci-layout")); err == nil {
+		for _, name := range []string{"oci-layout", "index.json", "blobs"} {
+			if err := os.Rename(filepath.Join(saved, name), filepath.Join(dir, name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return convertDockerSave(saved, dir, imageName)
+}
+
+// convertDockerSave writes the image extracted from an archive in Docker's own format in saved to dir as an OCI
+// image layout. The layers stay uncompressed, so they keep the digests in the image's configuration.
+func convertDockerSave(saved string, dir string, imageName string) error {
+	contents, err := os.ReadFile(filepath.Join(saved, "manifest.json"))
+	if err != nil {
+		return fmt.Errorf("Failed to read the image's manifest: %w", err)
+	}
+	manifests := []dockerSaveManifest{}
+	if err := json.Unmarshal(contents, &manifests); err != nil {
+		return fmt.Errorf("Failed to parse the image's manifest: %w", err)
+	}
+	if len(manifests) != 1 {
+		return fmt.Errorf("Expected one image in the archive of %s, but there are %d", imageName, len(manifests))
+	}
+	saveManifest := manifests[0]
+
+	config, err := moveBlob(filepath.Join(saved, saveManifest.Config), dir, ociConfigMediaType)
+	if err != nil {
+		return err
+	}
+	manifest := ociManifest{SchemaVersion: 2, MediaType: ociManifestMediaType, Config: config, Layers: []ociDescriptor{}}
+	// Layers that are in the image more than once are links to the first one, so the links are followed before
+	// any of them are moved
+	layerPaths := []string{}
+	for _, layer := range saveManifest.Layers {
+		p, err := filepath.EvalSymlinks(filepath.Join(saved, layer))
+		if err != nil {
+			return fmt.Errorf("Failed to read layer %s: %w", layer, err)
+		}
+		layerPaths = append(layerPaths, p)
+	}
+	moved := map[string]ociDescriptor{}
+	for _, p := range layerPaths {
+		descriptor, ok := moved[p]
+		if !ok {
+			if descriptor, err = moveBlob(p, dir, ociLayerMediaType); err != nil {
+				return err
+			}
+			moved[p] = descriptor
+		}
+		manifest.Layers = append(manifest.Layers, descriptor)
+	}
+	manifestJSON, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	manifestDescriptor, err := writeBlob(manifestJSON, dir, ociManifestMediaType)
+	if err != nil {
+		return err
+	}
+	manifestDescriptor.Annotations = map[string]string{
+		// containerd names the image with this when it's imported, and other tools use the tag
+		"io.containerd.image.name":          imageName,
+		"org.opencontainers.image.ref.name": imageTag(imageName),
+	}
+	indexJSON, err := json.MarshalIndent(ociIndex{SchemaVersion: 2, MediaType: "application/vnd.oci.image.index.v1+json", Manifests: []ociDescriptor{manifestDescriptor}}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "index.json"), indexJSON, 0o644); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "oci-layout"), []byte(`{"imageLayoutVersion":"1.0.0"}`), 0o644)
+}
+
+// moveBlob moves the file at p into the blobs of the OCI image layout in dir, named by its digest
+func moveBlob(p string, dir string, mediaType string) (ociDescriptor, error) {
+	digest, err := fileSHA256(p)
+	if err != nil {
+		return ociDescriptor{}, err
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		return ociDescriptor{}, err
+	}
+	blobPath := filepath.Join(dir, "blobs", "sha256", digest)
+	if err := os.MkdirAll(filepath.Dir(blobPath), 0o755); err != nil {
+		return ociDescriptor{}, err
+	}
+	if err := os.Rename(p, blobPath); err != nil {
+		return ociDescriptor{}, err
+	}
+	return ociDescriptor{MediaType: mediaType, Digest: "sha256:" + digest, Size: info.Size()}, nil
+}
+
+// writeBlob writes contents to the blobs of the OCI image layout in dir, named by its digest
+func writeBlob(contents []byte, dir string, mediaType string) (ociDescriptor, error) {
+	digest := fmt.Sprintf("%x", sha256.Sum256(contents))
+	blobPath := filepath.Join(dir, "blobs", "sha256", digest)
+	if err := os.MkdirAll(filepath.Dir(blobPath), 0o755); err != nil {
+		return ociDescriptor{}, err
+	}
+	if err := os.WriteFile(blobPath, contents, 0o644); err != nil {
+		return ociDescriptor{}, err
+	}
+	return ociDescriptor{MediaType: mediaType, Digest: "sha256:" + digest, Size: int64(len(contents))}, nil
+}
+
+// imageTag returns the tag of imageName, or latest if it doesn't have one
+func imageTag(imageName string) string {
+	if i := strings.LastIndex(imageName, ":"); i > strings.LastIndex(imageName, "/") {
+		return imageName[i+1:]
+	}
+	return "latest"
+}
+
+// extractTar extracts the files in the tar archive read from r into dir
+func extractTar(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !filepath.IsLocal(header.Name) {
+			return fmt.Errorf("%s is outside of the archive", header.Name)
+		}
+		p := filepath.Join(dir, header.Name)
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(p, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := extractTarFile(tr, p); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if !filepath.IsLocal(filepath.Join(filepath.Dir(header.Name), header.Linkname)) {
+				return fmt.Errorf("%s links outside of the archive", header.Name)
+			}
+			if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+				return err
+			}
+			if err := os.Symlink(header.Linkname, p); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseOutput(t *testing.T) {
+	output, err := ParseOutput("oci:./dist")
+	require.NoError(t, err)
+	require.Equal(t, &Output{Kind: OutputOCI, Dest: "./dist"}, output)
+
+	output, err = ParseOutput("containerd")
+	require.NoError(t, err)
+	require.Equal(t, &Output{Kind: OutputContainerd, Dest: DefaultContainerdNamespace}, output)
+
+	output, err = ParseOutput("containerd:default")
+	require.NoError(t, err)
+	require.Equal(t, &Output{Kind: OutputContainerd, Dest: "default"}, output)
+
+	_, err = ParseOutput("oci")
+	require.ErrorContains(t, err, "needs the directory")
+	_, err = ParseOutput("docker")
+	require.ErrorContains(t, err, "Unknown output 'docker'")
+}
+
+func TestWriteOCILayoutFromDockerSave(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	require.NoError(t, writeTarFile(tw, "manifest.json", []byte(`[{"Config":"abc.json","RepoTags":["hotdog-detector:v1"],"Layers":["l1/layer.tar","l2/layer.tar"]}]`)))
+	require.NoError(t, writeTarFile(tw, "abc.json", []byte(`{"architecture":"amd64"}`)))
+	require.NoError(t, writeTarFile(tw, "l1/layer.tar", []byte("layer one")))
+	// docker save links layers that are in the image twice to the first one
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "l2/layer.tar", Typeflag: tar.TypeSymlink, Linkname: "../l1/layer.tar"}))
+	require.NoError(t, tw.Close())
+
+	dir := filepath.Join(t.TempDir(), "dist")
+	require.NoError(t, writeOCILayout(&buf, dir, "hotdog-detector:v1"))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	require.Equal(t, []string{"blobs", "index.json", "oci-layout"}, names)
+
+	index := ociIndex{}
+	contents, err := os.ReadFile(filepath.Join(dir, "index.json"))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(contents, &index))
+	require.Len(t, index.Manifests, 1)
+	require.Equal(t, "hotdog-detector:v1", index.Manifests[0].Annotations["io.containerd.image.name"])
+	require.Equal(t, "v1", index.Manifests[0].Annotations["org.opencontainers.image.ref.name"])
+
+	manifest := ociManifest{}
+	contents, err = os.ReadFile(filepath.Join(dir, "blobs", "sha256", index.Manifests[0].Digest[len("sha256:"):]))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(contents, &manifest))
+	require.Equal(t, ociConfigMediaType, manifest.Config.MediaType)
+	require.Len(t, manifest.Layers, 2)
+	require.Equal(t, manifest.Layers[0], manifest.Layers[1])
+	require.Equal(t, int64(len("layer one")), manifest.Layers[0].Size)
+
+	layer, err := os.ReadFile(filepath.Join(dir, "blobs", "sha256", manifest.Layers[0].Digest[len("sha256:"):]))
+	require.NoError(t, err)
+	require.Equal(t, "layer one", string(layer))
+
+	require.ErrorContains(t, writeOCILayout(&bytes.Buffer{}, dir, "hotdog-detector:v1"), "isn't empty")
+}
+
+func TestImageTag(t *testing.T) {
+	require.Equal(t, "v1", imageTag("registry.example.com:5000/hotdog-detector:v1"))
+	require.Equal(t, "latest", imageTag("registry.example.com:5000/hotdog-detector"))
+}
@@ -0,0 +1,138 @@
+package image
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// flattenImage replaces imageName with an image with the same files and configuration, that has everything but the
+// weights in one layer, and each of the weights in a layer of its own, so the weights' layers are the same in every
+// build and registries don't need them again. weightsPaths are relative to the project directory, which is /src.
+func flattenImage(ctx context.Context, imageName string, weightsPaths []string, progressOutput string) error {
+	console.Infof("Flattening %s...", imageName)
+	inspect, err := docker.ImageInspect(imageName)
+	if err != nil {
+		return fmt.Errorf("Failed to inspect %s: %w", imageName, err)
+	}
+	if inspect.Config == nil {
+		return fmt.Errorf("%s doesn't have a configuration", imageName)
+	}
+	contents, err := flattenDockerfile(imageName, inspect.Config, weightsPaths)
+	if err != nil {
+		return err
+	}
+	// Everything comes from the image, so the build context is empty
+	dir, err := os.MkdirTemp("", "cog-flatten")
+	if err != nil {
+		return fmt.Errorf("Failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := docker.Build(ctx, dir, contents, "", imageName, nil, nil, false, progressOutput); err != nil {
+		return fmt.Errorf("Failed to flatten %s: %w", imageName, err)
+	}
+	return nil
+}
+
+// flattenDockerfile returns a Dockerfile that copies the files of imageName but the weights into an empty image in one
+// layer, then each of the weights in its own layer, and sets the configuration of imageName again, because an image
+// built from scratch doesn't have any
+func flattenDockerfile(imageName string, config *container.Config, weightsPaths []string) (string, error) {
+	weights := []string{}
+	for _, p := range weightsPaths {
+		weights = append(weights, path.Join("/src", p))
+	}
+	lines := []string{
+		"#syntax=docker/dockerfile:1.4",
+		"FROM " + imageName + " AS image",
+	}
+	source := "image"
+	if len(weights) > 0 {
+		source = "withoutweights"
+		lines = append(lines,
+			"FROM image AS withoutweights",
+			"RUN rm -rf "+strings.Join(weights, " "),
+		)
+	}
+	lines = append(lines,
+		"FROM scratch",
+		"COPY --from="+source+" / /",
+	)
+	for _, p := range weights {
+		lines = append(lines, fmt.Sprintf("COPY --from=image --link %[1]s %[1]s", p))
+	}
+
+	for _, env := range config.Env {
+		key, value, _ := strings.Cut(env, "=")
+		if strings.Contains(value, "\n") {
+			return "", fmt.Errorf("The image can't be flattened, because the environment variable %s has a line break in it", key)
+		}
+		lines = append(lines, fmt.Sprintf("ENV %s=%s", key, dockerfileQuote(value)))
+	}
+	labels := []string{}
+	for key, value := range config.Labels {
+		if strings.Contains(value, "\n") {
+			return "", fmt.Errorf("The image can't be flattened, because the label %s has a line break in it", key)
+		}
+		labels = append(labels, fmt.Sprintf("LABEL %s=%s", dockerfileQuote(key), dockerfileQuote(value)))
+	}
+	sort.Strings(labels)
+	lines = append(lines, labels...)
+	ports := []string{}
+	for port := range config.ExposedPorts {
+		ports = append(ports, string(port))
+	}
+	if len(ports) > 0 {
+		sort.Strings(ports)
+		lines = append(lines, "EXPOSE "+strings.Join(ports, " "))
+	}
+	volumes := []string{}
+	for volume := range config.Volumes {
+		volumes = append(volumes, volume)
+	}
+	if len(volumes) > 0 {
+		sort.Strings(volumes)
+		data, err := json.Marshal(volumes)
+		if err != nil {
+			return "", err
+		}
+		lines = append(lines, "VOLUME "+string(data))
+	}
+	if config.User != "" {
+		lines = append(lines, "USER "+config.User)
+	}
+	if config.WorkingDir != "" {
+		lines = append(lines, "WORKDIR "+config.WorkingDir)
+	}
+	if config.StopSignal != "" {
+		lines = append(lines, "STOPSIGNAL "+config.StopSignal)
+	}
+	for _, instruction := range []struct {
+		name  string
+		value []string
+	}{{"ENTRYPOINT", config.Entrypoint}, {"CMD", config.Cmd}} {
+		if instruction.value == nil {
+			continue
+		}
+		data, err := json.Marshal(instruction.value)
+		if err != nil {
+			return "", err
+		}
+		lines = append(lines, instruction.name+" "+string(data))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// dockerfileQuote quotes s for ENV and LABEL instructions, so it's used as it is, without variables in it expanded
+func dockerfileQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`).Replace(s) + `"`
+}
@@ -0,0 +1,51 @@
+package image
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlattenDockerfile(t *testing.T) {
+	config := &container.Config{}
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"Env": ["PATH=/usr/local/bin:/usr/bin", "GREETING=say \"hi\" for $5"],
+		"Labels": {"b": "2", "a": "1"},
+		"ExposedPorts": {"5000/tcp": {}},
+		"WorkingDir": "/src",
+		"Entrypoint": ["/sbin/tini", "--"],
+		"Cmd": ["python", "-m", "cog.server.http"]
+	}`), config))
+
+	actual, err := flattenDockerfile("my-model", config, []string{"models", "weights.bin"})
+	require.NoError(t, err)
+	require.Equal(t, `#syntax=docker/dockerfile:1.4
+FROM my-model AS image
+FROM image AS withoutweights
+RUN rm -rf /src/models /src/weights.bin
+FROM scratch
+COPY --from=withoutweights / /
+COPY --from=image --link /src/models /src/models
+COPY --from=image --link /src/weights.bin /src/weights.bin
+ENV PATH="/usr/local/bin:/usr/bin"
+ENV GREETING="say \"hi\" for \$5"
+LABEL "a"="1"
+LABEL "b"="2"
+EXPOSE 5000/tcp
+WORKDIR /src
+ENTRYPOINT ["/sbin/tini","--"]
+CMD ["python","-m","cog.server.http"]`, actual)
+
+	// Without weights, everything is in one layer
+	actual, err = flattenDockerfile("my-model", &container.Config{}, nil)
+	require.NoError(t, err)
+	require.Equal(t, `#syntax=docker/dockerfile:1.4
+FROM my-model AS image
+FROM scratch
+COPY --from=image / /`, actual)
+
+	_, err = flattenDockerfile("my-model", &container.Config{Env: []string{"A=line\nbreak"}}, nil)
+	require.ErrorContains(t, err, "A has a line break")
+}
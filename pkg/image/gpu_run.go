@@ -0,0 +1,35 @@
+package image
+
+import (
+	"context"
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/dockerfile"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// setGPURunDevice makes the run commands with gpu: true run in the build if the builder has a GPU. It returns
+// whether they have to be run after the build with runGPUCommands instead.
+func setGPURunDevice(generator *dockerfile.Generator, cfg *config.Config) bool {
+	if len(cfg.GPURunCommands()) == 0 {
+		return false
+	}
+	if docker.BuilderHasGPU() {
+		generator.SetGPURunDevice(true)
+		return false
+	}
+	console.Info("The Docker builder doesn't have a GPU, so the run commands with gpu: true will run in a container after the build...")
+	return true
+}
+
+// runGPUCommands runs the run commands with gpu: true in containers started from imageName, and commits them
+// to imageName
+func runGPUCommands(ctx context.Context, cfg *config.Config, imageName string) error {
+	for _, command := range cfg.GPURunCommands() {
+		console.Infof("Running '%s' with the GPU...", command)
+		if err := docker.RunAndCommit(ctx, imageName, command, "all"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
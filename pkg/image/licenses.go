@@ -0,0 +1,100 @@
+package image
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/licenses"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// ScanLicenses runs the image to list the Python packages installed in it, and the given
+// system packages, with their licenses
+func ScanLicenses(imageName string, systemPackages []string, enableGPU bool) ([]licenses.Package, error) {
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+
+	gpus := ""
+	if enableGPU {
+		gpus = "all"
+	}
+
+	err := docker.RunWithIO(docker.RunOptions{
+		Image: imageName,
+		Args:  append([]string{"python", "-m", "cog.command.licenses"}, systemPackages...),
+		GPUs:  gpus,
+	}, nil, &stdout, &stderr)
+
+	if enableGPU && err == docker.ErrMissingDeviceDriver {
+		console.Debug("Missing device driver, re-trying without GPU")
+		return ScanLicenses(imageName, systemPackages, false)
+	}
+	if err != nil {
+		console.Info(stderr.String())
+		return nil, err
+	}
+
+	packages := []licenses.Package{}
+	if err := json.Unmarshal(stdout.Bytes(), &packages); err != nil {
+		console.Info(stdout.String())
+		console.Info(stderr.String())
+		return nil, err
+	}
+	return packages, nil
+}
+
+// checkLicenses scans the licenses of the packages in the image, writes them to an SBOM at
+// sbomFile if it is set, and returns an error if any of them are denied by the license policy
+func checkLicenses(cfg *config.Config, imageName string, sbomFile string) error {
+	console.Info("Checking package licenses...")
+	packages, err := ScanLicenses(imageName, systemPackageNames(cfg.SystemPackages()), cfg.Build.GPU)
+	if err != nil {
+		return fmt.Errorf("Failed to scan package licenses: %w", err)
+	}
+
+	if sbomFile != "" {
+		modelLicense, weightsLicense := "", ""
+		if cfg.License != nil {
+			modelLicense, weightsLicense = cfg.License.Model, cfg.License.Weights
+		}
+		sbom := licenses.NewSBOM(imageName, modelLicense, weightsLicense, packages, time.Now())
+		data, err := json.MarshalIndent(sbom, "", "  ")
+		if err != nil {
+			return fmt.Errorf("Failed to convert SBOM to JSON: %w", err)
+		}
+		if err := os.WriteFile(sbomFile, append(data, '\n'), 0o644); err != nil {
+			return fmt.Errorf("Failed to write SBOM: %w", err)
+		}
+		console.Infof("Wrote SBOM to %s", sbomFile)
+	}
+
+	policy := cfg.Build.LicensePolicy
+	if policy == nil || len(policy.Deny) == 0 {
+		return nil
+	}
+	violations := licenses.Check(packages, policy.Deny, policy.IgnorePackages)
+	if len(violations) == 0 {
+		return nil
+	}
+	lines := []string{}
+	for _, v := range violations {
+		lines = append(lines, "  "+v.String())
+	}
+	return fmt.Errorf("%d package(s) have licenses denied by build.license_policy in cog.yaml:\n%s\n\nRemove them, or add them to build.license_policy.ignore_packages if you are allowed to use them.", len(violations), strings.Join(lines, "\n"))
+}
+
+// systemPackageNames returns the names of apt packages, without versions, e.g. "ffmpeg=7:4.2.7" is "ffmpeg"
+func systemPackageNames(systemPackages []string) []string {
+	names := []string{}
+	for _, pkg := range systemPackages {
+		name := strings.SplitN(pkg, "=", 2)[0]
+		names = append(names, strings.TrimSpace(name))
+	}
+	return names
+}
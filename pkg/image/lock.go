@@ -0,0 +1,107 @@
+package image
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/util/files"
+)
+
+// buildLockPath is the lock a build holds on its project, relative to the project directory, so two builds of the
+// same project, e.g. one from CI and one from a developer, don't write the weights manifest or the build state at
+// once
+const buildLockPath = ".cog/build.lock"
+
+// buildQueueDir has a file for each build of the project that's waiting for the lock or holding it, named so they
+// sort in the order the builds started. Each build locks its own file, so files left by builds that were killed
+// can be told apart and removed.
+const buildQueueDir = ".cog/build-queue"
+
+// lockPollInterval is how often a waiting build checks whether it's its turn
+var lockPollInterval = 500 * time.Millisecond
+
+// lockProject waits for the builds of the project in dir that started before this one to finish, then locks it.
+// It returns a function that unlocks it.
+func lockProject(dir string) (func(), error) {
+	queueDir := filepath.Join(dir, buildQueueDir)
+	if err := os.MkdirAll(queueDir, 0o755); err != nil {
+		return nil, fmt.Errorf("Failed to lock the project: %w", err)
+	}
+	name := fmt.Sprintf("%020d-%d", time.Now().UnixNano(), os.Getpid())
+	ticketPath := filepath.Join(queueDir, name)
+	ticket, err := files.TryLock(ticketPath)
+	if err != nil || ticket == nil {
+		return nil, fmt.Errorf("Failed to lock the project: %w", err)
+	}
+	leave := func() {
+		if err := ticket.Unlock(); err != nil {
+			console.Debugf("Failed to unlock %s: %s", ticketPath, err)
+		}
+		_ = os.Remove(ticketPath)
+	}
+
+	waiting := -1
+	for {
+		ahead, err := buildsAhead(queueDir, name)
+		if err != nil {
+			leave()
+			return nil, fmt.Errorf("Failed to lock the project: %w", err)
+		}
+		if ahead == 0 {
+			lock, err := files.TryLock(filepath.Join(dir, buildLockPath))
+			if err != nil {
+				leave()
+				return nil, fmt.Errorf("Failed to lock the project: %w", err)
+			}
+			if lock != nil {
+				return func() {
+					if err := lock.Unlock(); err != nil {
+						console.Debugf("Failed to unlock %s: %s", buildLockPath, err)
+					}
+					leave()
+				}, nil
+			}
+			// A build that didn't queue, e.g. from an older version of Cog, has the lock
+			ahead = 1
+		}
+		if ahead != waiting {
+			if ahead == 1 {
+				console.Info("Waiting for another build of this project to finish...")
+			} else {
+				console.Infof("Waiting for %d other builds of this project to finish...", ahead)
+			}
+			waiting = ahead
+		}
+		time.Sleep(lockPollInterval)
+	}
+}
+
+// buildsAhead counts the builds in queueDir that started before the one whose file is called name. Files left by
+// builds that were killed, which nothing has locked, are removed.
+func buildsAhead(queueDir string, name string) (int, error) {
+	entries, err := os.ReadDir(queueDir)
+	if err != nil {
+		return 0, err
+	}
+	ahead := 0
+	for _, entry := range entries {
+		if entry.Name() >= name {
+			continue
+		}
+		p := filepath.Join(queueDir, entry.Name())
+		lock, err := files.TryLock(p)
+		if err != nil {
+			return 0, err
+		}
+		if lock != nil {
+			_ = lock.Unlock()
+			_ = os.Remove(p)
+			continue
+		}
+		ahead++
+	}
+	return ahead, nil
+}
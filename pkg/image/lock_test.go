@@ -0,0 +1,49 @@
+package image
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockProject(t *testing.T) {
+	lockPollInterval = 10 * time.Millisecond
+	dir := t.TempDir()
+
+	// A file left by a build that was killed doesn't hold up the queue
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, buildQueueDir), 0o755))
+	stale := filepath.Join(dir, buildQueueDir, "00000000000000000001-1")
+	require.NoError(t, os.WriteFile(stale, nil, 0o644))
+
+	unlockFirst, err := lockProject(dir)
+	require.NoError(t, err)
+	require.NoFileExists(t, stale)
+
+	locked := make(chan func())
+	go func() {
+		unlockSecond, err := lockProject(dir)
+		require.NoError(t, err)
+		locked <- unlockSecond
+	}()
+
+	select {
+	case <-locked:
+		t.Fatal("The second build got the lock while the first one had it")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	unlockFirst()
+	select {
+	case unlockSecond := <-locked:
+		unlockSecond()
+	case <-time.After(5 * time.Second):
+		t.Fatal("The second build didn't get the lock after the first one finished")
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dir, buildQueueDir))
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
@@ -0,0 +1,39 @@
+package image
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// ExportONNX runs the image to convert the model to ONNX with the predictor's export_onnx() method,
+// and writes it to destPath
+func ExportONNX(imageName string, destPath string, enableGPU bool) error {
+	destDir, err := filepath.Abs(filepath.Dir(destPath))
+	if err != nil {
+		return err
+	}
+	gpus := ""
+	if enableGPU {
+		gpus = "all"
+	}
+
+	err = docker.RunWithIO(docker.RunOptions{
+		Image:   imageName,
+		Args:    []string{"python", "-m", "cog.command.export_onnx", "/cog-export/" + filepath.Base(destPath)},
+		GPUs:    gpus,
+		Volumes: []docker.Volume{{Source: destDir, Destination: "/cog-export"}},
+	}, nil, os.Stderr, os.Stderr)
+
+	if enableGPU && err == docker.ErrMissingDeviceDriver {
+		console.Debug("Missing device driver, re-trying without GPU")
+		return ExportONNX(imageName, destPath, false)
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to convert the model to ONNX: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/dockerfile"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// buildWeightsAndEnvironment builds the weights image at the same time as the environment the model runs in, from
+// the part of the runner's Dockerfile that doesn't need the weights image, so the runner's build that follows only
+// copies the weights and source into it. The weights image's build output is kept until it finishes, so it isn't
+// mixed up with the environment's. If one build fails, the other is stopped, and only the error of the one that
+// failed is returned.
+func buildWeightsAndEnvironment(ctx context.Context, dir, weightsDockerfile, weightsDockerignore, environmentDockerfile, environmentDockerignore, imageName string, secrets []string, buildArgs []string, noCache bool, progressOutput string, timings *buildTimings, section func(string) string) (weightsErr error, environmentErr error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	console.Info("Building the weights image and the model's environment at the same time...")
+	var weightsOutput bytes.Buffer
+	weightsDone := make(chan error, 1)
+	go func() {
+		weightsSection := func(string) string { return dockerfile.SectionWeights }
+		err := buildWithTimingsTo(ctx, &weightsOutput, dir, weightsDockerfile, weightsDockerignore, imageName+"-weights", secrets, buildArgs, noCache, "plain", timings, weightsSection)
+		if err != nil {
+			cancel()
+		}
+		weightsDone <- err
+	}()
+
+	// The environment is tagged so Docker keeps what it built until the runner's build reuses it
+	environmentImage := imageName + "-environment"
+	environmentErr = buildWithTimings(ctx, dir, environmentDockerfile, environmentDockerignore, environmentImage, secrets, buildArgs, noCache, progressOutput, timings, section)
+	if environmentErr != nil {
+		cancel()
+	}
+	weightsErr = <-weightsDone
+
+	// The build that was stopped because the other one failed didn't fail itself
+	if environmentErr != nil && errors.Is(weightsErr, context.Canceled) {
+		weightsErr = nil
+	}
+	if weightsErr != nil && errors.Is(environmentErr, context.Canceled) {
+		environmentErr = nil
+	}
+	if weightsErr != nil {
+		if environmentErr == nil {
+			removeEnvironmentImage(imageName)
+		}
+		console.Info("\nOutput of the weights image's build:")
+		_, _ = os.Stderr.Write(weightsOutput.Bytes())
+	}
+	return weightsErr, environmentErr
+}
+
+// removeEnvironmentImage removes the tag of the image of the model's environment, once the runner has been built
+// from it
+func removeEnvironmentImage(imageName string) {
+	if err := docker.RemoveImage(imageName + "-environment"); err != nil {
+		console.Debugf("%s", err)
+	}
+}
@@ -0,0 +1,16 @@
+package image
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepositoryName(t *testing.T) {
+	require.Equal(t, "hotdog", repositoryName("hotdog"))
+	require.Equal(t, "hotdog", repositoryName("hotdog:latest"))
+	require.Equal(t, "r8.im/alice/hotdog", repositoryName("r8.im/alice/hotdog:v1"))
+	require.Equal(t, "localhost:5000/hotdog", repositoryName("localhost:5000/hotdog"))
+	require.Equal(t, "localhost:5000/hotdog", repositoryName("localhost:5000/hotdog:v1"))
+	require.Equal(t, "r8.im/alice/hotdog", repositoryName("r8.im/alice/hotdog@sha256:abc"))
+}
@@ -0,0 +1,18 @@
+package image
+
+import (
+	"strings"
+)
+
+// QuantizedImageName returns the name of the image with quantized weights, which is the image's name with the
+// quantization method in its tag, e.g. my-model:awq, or my-model:v1-awq
+func QuantizedImageName(imageName string, method string) string {
+	name, tag := imageName, ""
+	if i := strings.LastIndex(imageName, ":"); i > strings.LastIndex(imageName, "/") {
+		name, tag = imageName[:i], imageName[i+1:]
+	}
+	if tag == "" || tag == "latest" {
+		return name + ":" + method
+	}
+	return name + ":" + tag + "-" + method
+}
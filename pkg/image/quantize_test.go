@@ -0,0 +1,14 @@
+package image
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuantizedImageName(t *testing.T) {
+	require.Equal(t, "cog-model:awq", QuantizedImageName("cog-model", "awq"))
+	require.Equal(t, "cog-model:gguf-q4", QuantizedImageName("cog-model:latest", "gguf-q4"))
+	require.Equal(t, "r8.im/user/model:v1-gptq", QuantizedImageName("r8.im/user/model:v1", "gptq"))
+	require.Equal(t, "localhost:5000/model:awq", QuantizedImageName("localhost:5000/model", "awq"))
+}
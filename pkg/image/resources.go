@@ -0,0 +1,26 @@
+package image
+
+import (
+	"strconv"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/global"
+)
+
+// resourceLabels returns the labels for the resources the model needs, with the sizes in bytes
+func resourceLabels(req config.ResourceRequirements) map[string]string {
+	labels := map[string]string{}
+	if req.CPU > 0 {
+		labels[global.LabelNamespace+"resources.cpu"] = strconv.FormatFloat(req.CPU, 'f', -1, 64)
+	}
+	for key, bytes := range map[string]int64{
+		"memory":     req.MemoryBytes,
+		"gpu_memory": req.GPUMemoryBytes,
+		"disk":       req.DiskBytes,
+	} {
+		if bytes > 0 {
+			labels[global.LabelNamespace+"resources."+key] = strconv.FormatInt(bytes, 10)
+		}
+	}
+	return labels
+}
@@ -0,0 +1,18 @@
+package image
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+func TestResourceLabels(t *testing.T) {
+	require.Empty(t, resourceLabels(config.ResourceRequirements{}))
+	require.Equal(t, map[string]string{
+		"run.cog.resources.cpu":        "0.5",
+		"run.cog.resources.memory":     "16000000000",
+		"run.cog.resources.gpu_memory": "24000000000",
+	}, resourceLabels(config.ResourceRequirements{CPU: 0.5, MemoryBytes: 16_000_000_000, GPUMemoryBytes: 24_000_000_000}))
+}
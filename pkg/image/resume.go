@@ -0,0 +1,195 @@
+package image
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/dockerfile"
+	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/util/slices"
+)
+
+// buildStatePath is where the state of a build is kept while it runs, relative to the project directory, so
+// `cog build --resume` can continue it if it fails or is interrupted
+const buildStatePath = ".cog/cache/build_state.json"
+
+// The stages of a build that are skipped when it's resumed, if they finished
+const (
+	stageImage     = "image"
+	stageQuantized = "quantized"
+)
+
+// buildState is what a resumed build needs from the build it continues
+type buildState struct {
+	ImageName string `json:"image_name"`
+	// TmpDir is the generator's temporary directory, relative to the project directory. It's reused, so the
+	// generated files are copied from the same paths, and Docker reuses the layers it cached.
+	TmpDir string `json:"tmp_dir"`
+	// Dockerfiles are the generated Dockerfiles, and ContextHash is a hash of cog.yaml and the names, sizes and
+	// modification times of the files sent to Docker. If either changes, the finished stages are built again.
+	Dockerfiles []string `json:"dockerfiles"`
+	ContextHash string   `json:"context_hash"`
+	// Completed are the stages that finished
+	Completed []string `json:"completed"`
+
+	dir string
+}
+
+// prepareBuildState returns the state to record the build's progress in. If resume is set, and the last build of
+// imageName in dir didn't finish, the generator reuses its temporary directory, and it's continued. Otherwise, the
+// last build is forgotten.
+func prepareBuildState(dir, imageName string, generator *dockerfile.Generator, resume bool) (*buildState, error) {
+	previous, err := loadBuildState(dir)
+	if err != nil {
+		return nil, err
+	}
+	if previous != nil && resume && previous.ImageName == imageName {
+		err := generator.ReuseTmpDir(previous.TmpDir)
+		if err == nil {
+			console.Infof("Resuming the last build of %s...", imageName)
+			return previous, nil
+		}
+		console.Debugf("Failed to reuse %s: %s", previous.TmpDir, err)
+	}
+	if resume {
+		console.Infof("There isn't a build of %s to resume, so starting a new one...", imageName)
+	}
+	if previous != nil {
+		if err := previous.remove(); err != nil {
+			return nil, err
+		}
+	}
+	// This is saved straight away, so the temporary directory can be cleaned up by the next build if this one stops
+	state := &buildState{ImageName: imageName, TmpDir: generator.RelativeTmpDir(), dir: dir}
+	return state, state.save()
+}
+
+func loadBuildState(dir string) (*buildState, error) {
+	contents, err := os.ReadFile(filepath.Join(dir, buildStatePath))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read build state: %w", err)
+	}
+	state := &buildState{dir: dir}
+	if err := json.Unmarshal(contents, state); err != nil {
+		console.Debugf("Ignoring build state in %s, which isn't valid: %s", buildStatePath, err)
+		return nil, nil
+	}
+	return state, nil
+}
+
+// start records the Dockerfiles and context of the build before Docker starts. Stages that finished in the build
+// being resumed are only kept if they haven't changed.
+func (s *buildState) start(cfg *config.Config, dockerignore string, dockerfiles ...string) error {
+	hash, err := contextHash(cfg, s.dir, dockerignore)
+	if err != nil {
+		return err
+	}
+	if len(s.Completed) > 0 && (hash != s.ContextHash || strings.Join(dockerfiles, "\n") != strings.Join(s.Dockerfiles, "\n")) {
+		console.Info("The project has changed since the build stopped, so it's built again with what Docker cached...")
+		s.Completed = nil
+	}
+	s.ContextHash = hash
+	s.Dockerfiles = dockerfiles
+	return s.save()
+}
+
+// completed returns whether stage finished, and the image it built still exists
+func (s *buildState) completed(stage, imageName string) bool {
+	if !slices.ContainsString(s.Completed, stage) {
+		return false
+	}
+	exists, err := docker.ImageExists(imageName)
+	if err != nil || !exists {
+		return false
+	}
+	console.Infof("Skipping the %s stage, which finished before the build stopped...", stage)
+	return true
+}
+
+// progress returns which stages finished, for when the build stops partway through
+func (s *buildState) progress() string {
+	if len(s.Completed) == 0 {
+		return "No stages of the build finished"
+	}
+	return "These stages of the build finished: " + strings.Join(s.Completed, ", ")
+}
+
+func (s *buildState) complete(stage string) error {
+	s.Completed = append(s.Completed, stage)
+	return s.save()
+}
+
+func (s *buildState) save() error {
+	contents, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	p := filepath.Join(s.dir, buildStatePath)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return fmt.Errorf("Failed to save build state: %w", err)
+	}
+	if err := os.WriteFile(p, contents, 0o644); err != nil {
+		return fmt.Errorf("Failed to save build state: %w", err)
+	}
+	return nil
+}
+
+// remove forgets the build, and removes its temporary directory
+func (s *buildState) remove() error {
+	if strings.HasPrefix(s.TmpDir, ".cog/tmp/build") {
+		if err := os.RemoveAll(filepath.Join(s.dir, filepath.FromSlash(s.TmpDir))); err != nil {
+			return fmt.Errorf("Failed to clean up %s: %w", s.TmpDir, err)
+		}
+	}
+	if err := os.Remove(filepath.Join(s.dir, buildStatePath)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Failed to remove build state: %w", err)
+	}
+	return nil
+}
+
+// contextHash returns a hash of cfg, and the names, sizes and modification times of the files in dir that are
+// sent to Docker with dockerignore. Cog's own files in .cog are left out, because the generated ones are in the
+// Dockerfiles.
+func contextHash(cfg *config.Config, dir string, dockerignore string) (string, error) {
+	context, err := measureContext(dir, []string{dockerignore})
+	if err != nil {
+		return "", err
+	}
+	configJSON, err := json.Marshal(cfg)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	hash.Write(configJSON)
+	for _, p := range context.paths {
+		if strings.HasPrefix(p, ".cog/") {
+			continue
+		}
+		info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(p)))
+		if err != nil {
+			return "", fmt.Errorf("Failed to hash the build context: %w", err)
+		}
+		fmt.Fprintf(hash, "\n%s %d %d", p, info.Size(), info.ModTime().UnixNano())
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// ProjectHash returns a hash of cfg and the files in dir that are sent to Docker, so a model started from dir can be
+// checked against the project's current code and cog.yaml
+func ProjectHash(cfg *config.Config, dir string) (string, error) {
+	dockerignore, err := dockerfile.ReadDockerignore(dir)
+	if err != nil {
+		return "", err
+	}
+	return contextHash(cfg, dir, dockerignore)
+}
@@ -0,0 +1,90 @@
+package image
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/dockerfile"
+)
+
+func TestResumeBuild(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "predict.py"), []byte("print('hello')"), 0o644))
+	cfg := &config.Config{Build: &config.Build{PythonVersion: "3.11"}}
+
+	generator, err := dockerfile.NewGenerator(cfg, dir)
+	require.NoError(t, err)
+	state, err := prepareBuildState(dir, "my-model", generator, false)
+	require.NoError(t, err)
+	require.FileExists(t, filepath.Join(dir, buildStatePath))
+	require.NoError(t, state.start(cfg, "", "FROM python:3.11"))
+	require.Equal(t, "No stages of the build finished", state.progress())
+	require.NoError(t, state.complete(stageImage))
+	require.Equal(t, "These stages of the build finished: image", state.progress())
+	generator.KeepTmpDir()
+	require.NoError(t, generator.Cleanup())
+
+	// A resumed build reuses the temporary directory, and keeps the stages that finished
+	resumed, err := dockerfile.NewGenerator(cfg, dir)
+	require.NoError(t, err)
+	newTmpDir := filepath.Join(dir, filepath.FromSlash(resumed.RelativeTmpDir()))
+	state, err = prepareBuildState(dir, "my-model", resumed, true)
+	require.NoError(t, err)
+	require.Equal(t, generator.RelativeTmpDir(), resumed.RelativeTmpDir())
+	require.NoDirExists(t, newTmpDir)
+	require.NoError(t, state.start(cfg, "", "FROM python:3.11"))
+	require.Equal(t, []string{stageImage}, state.Completed)
+
+	// If the project changes, every stage is built again
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "predict.py"), []byte("print('hello, world')"), 0o644))
+	require.NoError(t, state.start(cfg, "", "FROM python:3.11"))
+	require.Empty(t, state.Completed)
+
+	// A build that isn't resumed forgets the last one, and removes its temporary directory
+	fresh, err := dockerfile.NewGenerator(cfg, dir)
+	require.NoError(t, err)
+	state, err = prepareBuildState(dir, "my-model", fresh, false)
+	require.NoError(t, err)
+	require.NoDirExists(t, filepath.Join(dir, filepath.FromSlash(generator.RelativeTmpDir())))
+	require.Equal(t, fresh.RelativeTmpDir(), state.TmpDir)
+	require.NoError(t, state.remove())
+	require.NoFileExists(t, filepath.Join(dir, buildStatePath))
+}
+
+func TestReuseTmpDirOutsideCogTmp(t *testing.T) {
+	generator, err := dockerfile.NewGenerator(&config.Config{Build: &config.Build{}}, t.TempDir())
+	require.NoError(t, err)
+	require.Error(t, generator.ReuseTmpDir("../../etc"))
+	require.Error(t, generator.ReuseTmpDir(".cog/tmp/build1/../../../etc"))
+}
+
+func TestProjectHash(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "predict.py"), []byte("print('hello')"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".dockerignore"), []byte("data\n"), 0o644))
+	cfg := &config.Config{Build: &config.Build{PythonVersion: "3.11"}}
+
+	hash, err := ProjectHash(cfg, dir)
+	require.NoError(t, err)
+
+	// Files that aren't sent to Docker don't change it
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "data"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "data", "cats.csv"), []byte("cat"), 0o644))
+	same, err := ProjectHash(cfg, dir)
+	require.NoError(t, err)
+	require.Equal(t, hash, same)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "predict.py"), []byte("print('hello, world')"), 0o644))
+	changed, err := ProjectHash(cfg, dir)
+	require.NoError(t, err)
+	require.NotEqual(t, hash, changed)
+
+	cfg.Build.PythonVersion = "3.12"
+	changedConfig, err := ProjectHash(cfg, dir)
+	require.NoError(t, err)
+	require.NotEqual(t, changed, changedConfig)
+}
@@ -0,0 +1,189 @@
+package image
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/secrets"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// minSecretLength is how long a value passed with --secret has to be for the image to be checked for it. Shorter
+// values are too likely to be in the image by chance.
+const minSecretLength = 8
+
+// checkContextSecrets fails if files in the build context look like secrets, so they aren't copied into the image
+// by mistake, unless build.secret_scan says otherwise
+func checkContextSecrets(cfg *config.Config, dir string, context *buildContext) error {
+	if cfg.SecretScan() == config.SecretScanOff {
+		return nil
+	}
+	findings := []string{}
+	for _, name := range context.paths {
+		finding, err := secrets.ScanFile(filepath.Join(dir, filepath.FromSlash(name)), name)
+		if err != nil {
+			return fmt.Errorf("Failed to scan %s for secrets: %w", name, err)
+		}
+		if finding != nil {
+			findings = append(findings, "  "+finding.String())
+		}
+	}
+	if len(findings) == 0 {
+		return nil
+	}
+	message := fmt.Sprintf(`These files look like they have secrets in them, which would be copied into the image for anyone who can pull it to read:
+
+%s
+
+Add them to .dockerignore, or to build.ignore in cog.yaml. If the model needs a secret when it runs, pass it with -e instead. If they aren't secrets, set build.secret_scan in cog.yaml to warn or off.`, strings.Join(findings, "\n"))
+	if cfg.SecretScan() == config.SecretScanWarn {
+		console.Warn(message)
+		return nil
+	}
+	return fmt.Errorf("%s", message)
+}
+
+// checkImageSecrets fails if the values of the secrets passed to the build with --secret are in the image's
+// layers or its config, e.g. because a run command copied a secret mount into the image, unless build.secret_scan
+// says otherwise
+func checkImageSecrets(cfg *config.Config, imageName string, buildSecrets []string) error {
+	if cfg.SecretScan() == config.SecretScanOff || len(buildSecrets) == 0 {
+		return nil
+	}
+	ids, values, err := secretValues(buildSecrets)
+	if err != nil || len(values) == 0 {
+		return err
+	}
+
+	console.Info("Checking the secrets passed with --secret aren't in the image...")
+	r, w := io.Pipe()
+	go func() {
+		w.CloseWithError(docker.SaveTo(imageName, w))
+	}()
+	i, where, err := findInImageArchive(r, values)
+	// Stop docker save if the secret was found before the end of the archive
+	r.Close()
+	if err != nil {
+		return fmt.Errorf("Failed to check the image for secrets: %w", err)
+	}
+	if i == -1 {
+		return nil
+	}
+	message := fmt.Sprintf("The secret %s passed with --secret is in the image, in %s, so anyone who can pull the image can read it. Make sure the run commands that use it don't write it to a file or print it.", ids[i], where)
+	if cfg.SecretScan() == config.SecretScanWarn {
+		console.Warn(message)
+		return nil
+	}
+	return fmt.Errorf("%s If it isn't a secret, set build.secret_scan in cog.yaml to warn or off.", message)
+}
+
+// secretValues returns the IDs and values of the secrets passed with --secret, in the forms Docker takes them:
+// id=foo,src=path, id=foo,env=VAR, or id=FOO to take the value from the environment variable FOO
+func secretValues(buildSecrets []string) (ids []string, values [][]byte, err error) {
+	for _, secret := range buildSecrets {
+		fields := map[string]string{}
+		for _, field := range strings.Split(secret, ",") {
+			key, value, _ := strings.Cut(field, "=")
+			fields[key] = value
+		}
+		id := fields["id"]
+		var value []byte
+		switch {
+		case fields["src"] != "" || fields["source"] != "":
+			src := fields["src"]
+			if src == "" {
+				src = fields["source"]
+			}
+			if value, err = os.ReadFile(src); err != nil {
+				return nil, nil, fmt.Errorf("Failed to read secret %s: %w", id, err)
+			}
+		case fields["env"] != "":
+			value = []byte(os.Getenv(fields["env"]))
+		default:
+			value = []byte(os.Getenv(id))
+		}
+		value = bytes.TrimSpace(value)
+		if len(value) < minSecretLength {
+			console.Debugf("Not checking the image for secret %s, because it's shorter than %d characters", id, minSecretLength)
+			continue
+		}
+		ids = append(ids, id)
+		values = append(values, value)
+	}
+	return ids, values, nil
+}
+
+// findInImageArchive returns the index of the first of values that is in the image archive read from r, as
+// written by docker save, and where it is. It looks in the files in each layer, and in the other files in the
+// archive, like the image config, which has the commands that built the image in its history. It returns -1 if
+// none of them are in it.
+func findInImageArchive(r io.Reader, values [][]byte) (int, string, error) {
+	archive := tar.NewReader(r)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return -1, "", nil
+		}
+		if err != nil {
+			return -1, "", err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		entry, err := uncompressed(archive)
+		if err != nil {
+			return -1, "", err
+		}
+		if !isTar(entry) {
+			i, err := secrets.Contains(entry, values)
+			if err != nil || i != -1 {
+				return i, header.Name, err
+			}
+			continue
+		}
+		layer := tar.NewReader(entry)
+		for {
+			file, err := layer.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return -1, "", err
+			}
+			i, err := secrets.Contains(layer, values)
+			if err != nil || i != -1 {
+				return i, "/" + strings.TrimPrefix(file.Name, "/"), err
+			}
+		}
+	}
+}
+
+// uncompressed returns a reader of the contents of r, which are uncompressed if they're gzipped, like the
+// layers of some images
+func uncompressed(r io.Reader) (*bufio.Reader, error) {
+	buffered := bufio.NewReader(r)
+	magic, _ := buffered.Peek(2)
+	if !bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		return buffered, nil
+	}
+	gz, err := gzip.NewReader(buffered)
+	if err != nil {
+		return nil, err
+	}
+	return bufio.NewReader(gz), nil
+}
+
+// isTar returns whether r starts with a tar header
+func isTar(r *bufio.Reader) bool {
+	header, _ := r.Peek(512)
+	return len(header) == 512 && bytes.HasPrefix(header[257:], []byte("ustar"))
+}
@@ -0,0 +1,106 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+func TestCheckContextSecrets(t *testing.T) {
+	dir := t.TempDir()
+	writeContextFile(t, dir, "predict.py", 10)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".env"), []byte("HF_TOKEN=abc\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "download.py"), []byte("\ntoken = 'hf_"+"abcdefghijklmnopqrstuvwxyzABCDEF'\n"), 0o644))
+
+	cfg, err := config.FromYAML([]byte("build:\n  python_version: '3.11'\n"))
+	require.NoError(t, err)
+	context, err := measureContext(dir, []string{""})
+	require.NoError(t, err)
+	err = checkContextSecrets(cfg, dir, context)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "  .env: .env file\n  download.py:2: Hugging Face token\n")
+
+	// Files in .dockerignore aren't copied into the image
+	context, err = measureContext(dir, []string{".env\ndownload.py\n"})
+	require.NoError(t, err)
+	require.NoError(t, checkContextSecrets(cfg, dir, context))
+
+	cfg.Build.SecretScan = config.SecretScanWarn
+	context, err = measureContext(dir, []string{""})
+	require.NoError(t, err)
+	require.NoError(t, checkContextSecrets(cfg, dir, context))
+}
+
+func TestSecretValues(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "token"), []byte("file-secret-value\n"), 0o600))
+	t.Setenv("MY_TOKEN", "env-secret-value")
+	t.Setenv("SHORT", "abc")
+
+	ids, values, err := secretValues([]string{
+		"id=hf,src=" + filepath.Join(dir, "token"),
+		"id=other,env=MY_TOKEN",
+		"id=MY_TOKEN",
+		"id=SHORT",
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"hf", "other", "MY_TOKEN"}, ids)
+	require.Equal(t, [][]byte{[]byte("file-secret-value"), []byte("env-secret-value"), []byte("env-secret-value")}, values)
+}
+
+func TestFindInImageArchive(t *testing.T) {
+	layer := func(name string, contents string, compress bool) []byte {
+		buf := &bytes.Buffer{}
+		tw := tar.NewWriter(buf)
+		require.NoError(t, writeTarFile(tw, name, []byte(contents)))
+		require.NoError(t, tw.Close())
+		if !compress {
+			return buf.Bytes()
+		}
+		compressed := &bytes.Buffer{}
+		gz := gzip.NewWriter(compressed)
+		_, err := gz.Write(buf.Bytes())
+		require.NoError(t, err)
+		require.NoError(t, gz.Close())
+		return compressed.Bytes()
+	}
+	archive := func(files map[string][]byte, order ...string) *bytes.Buffer {
+		buf := &bytes.Buffer{}
+		tw := tar.NewWriter(buf)
+		for _, name := range order {
+			require.NoError(t, writeTarFile(tw, name, files[name]))
+		}
+		require.NoError(t, tw.Close())
+		return buf
+	}
+	values := [][]byte{[]byte("file-secret-value")}
+
+	files := map[string][]byte{
+		"manifest.json":   []byte(`[{"Config": "config.json"}]`),
+		"config.json":     []byte(`{"history": [{"created_by": "RUN pip install torch"}]}`),
+		"abc/layer.tar":   layer("usr/lib/python3/torch.py", "import torch", false),
+		"blobs/sha256/de": layer("root/.cache/token", "file-secret-value\n", true),
+	}
+	i, where, err := findInImageArchive(archive(files, "manifest.json", "config.json", "abc/layer.tar", "blobs/sha256/de"), values)
+	require.NoError(t, err)
+	require.Equal(t, 0, i)
+	require.Equal(t, "/root/.cache/token", where)
+
+	// The commands in the image's history are checked too
+	files["config.json"] = []byte(`{"history": [{"created_by": "RUN echo file-secret-value"}]}`)
+	i, where, err = findInImageArchive(archive(files, "manifest.json", "config.json"), values)
+	require.NoError(t, err)
+	require.Equal(t, 0, i)
+	require.Equal(t, "config.json", where)
+
+	i, _, err = findInImageArchive(archive(files, "manifest.json", "abc/layer.tar"), values)
+	require.NoError(t, err)
+	require.Equal(t, -1, i)
+}
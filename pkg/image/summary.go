@@ -0,0 +1,40 @@
+package image
+
+import (
+	"fmt"
+
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/global"
+)
+
+// Summary describes an image, for commands that print what they built or pushed as JSON
+type Summary struct {
+	Image string `json:"image"`
+	ID    string `json:"id"`
+	// Digest is the image's digest in the registry it was pushed to, if it was
+	Digest     string `json:"digest,omitempty"`
+	SizeBytes  int64  `json:"size_bytes"`
+	CogVersion string `json:"cog_version,omitempty"`
+}
+
+// Summarize describes imageName. If pushed is set, it has the image's digest in the registry it was pushed to.
+func Summarize(imageName string, pushed bool) (*Summary, error) {
+	inspect, err := docker.ImageInspect(imageName)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to inspect %s: %w", imageName, err)
+	}
+	summary := &Summary{
+		Image:     imageName,
+		ID:        inspect.ID,
+		SizeBytes: inspect.Size,
+	}
+	if inspect.Config != nil {
+		summary.CogVersion = inspect.Config.Labels[global.LabelNamespace+"version"]
+	}
+	if pushed {
+		if _, summary.Digest, err = imageDigest(imageName, true); err != nil {
+			return nil, err
+		}
+	}
+	return summary, nil
+}
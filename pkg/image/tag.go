@@ -0,0 +1,43 @@
+package image
+
+import (
+	"fmt"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// DefaultTagTemplate is what images are tagged with when the version is bumped, if cog.yaml doesn't set
+// image.tag_template
+const DefaultTagTemplate = "{{.Version}}"
+
+// TemplatedImageName returns imageName tagged with image.tag_template in cog.yaml, rendered with version and the
+// project's Python, CUDA and CuDNN versions and Git commit. If there isn't a template, or imageName already has a
+// tag, it's returned as it is.
+func TemplatedImageName(cfg *config.Config, dir string, imageName string, version string) (string, error) {
+	if cfg.ImageTagTemplate == "" || ImageRepository(imageName) != imageName {
+		return imageName, nil
+	}
+	data := config.TagData{
+		Version: version,
+		Python:  cfg.Build.PythonVersion,
+		CUDA:    cfg.Build.CUDA,
+		CuDNN:   cfg.Build.CuDNN,
+	}
+	if commit, err := gitHead(dir); err == nil {
+		if len(commit) > 7 {
+			commit = commit[:7]
+		}
+		data.Commit = commit
+	} else {
+		console.Debugf("Failed to get the Git commit for image.tag_template: %s", err)
+	}
+	tag, err := cfg.RenderTag(data)
+	if err != nil {
+		return "", err
+	}
+	if tag == "" {
+		return "", fmt.Errorf("image.tag_template in cog.yaml made an empty tag. If it uses .Version, write the model's version to %s, or run 'cog push --bump'", config.VersionFilename)
+	}
+	return imageName + ":" + tag, nil
+}
@@ -0,0 +1,32 @@
+package image
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+func TestTemplatedImageName(t *testing.T) {
+	cfg := &config.Config{Build: &config.Build{PythonVersion: "3.11", CUDA: "12.1"}}
+	dir := t.TempDir()
+
+	imageName, err := TemplatedImageName(cfg, dir, "r8.im/user/model", "1.2.0")
+	require.NoError(t, err)
+	require.Equal(t, "r8.im/user/model", imageName)
+
+	cfg.ImageTagTemplate = "{{.Version}}-cuda{{.CUDA}}"
+	imageName, err = TemplatedImageName(cfg, dir, "r8.im/user/model", "1.2.0")
+	require.NoError(t, err)
+	require.Equal(t, "r8.im/user/model:1.2.0-cuda12.1", imageName)
+
+	// A tag that's passed in is kept
+	imageName, err = TemplatedImageName(cfg, dir, "localhost:5000/model:dev", "1.2.0")
+	require.NoError(t, err)
+	require.Equal(t, "localhost:5000/model:dev", imageName)
+
+	cfg.ImageTagTemplate = "{{.Version}}"
+	_, err = TemplatedImageName(cfg, dir, "r8.im/user/model", "")
+	require.ErrorContains(t, err, "empty tag")
+}
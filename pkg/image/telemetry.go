@@ -0,0 +1,31 @@
+package image
+
+import (
+	"time"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/telemetry"
+)
+
+// recordBuild reports how long the build took, how big the image is and why it failed, if telemetry is enabled
+func recordBuild(cfg *config.Config, imageName string, started time.Time, err error) {
+	if !telemetry.Enabled() {
+		return
+	}
+	event := telemetry.Event{
+		Type:            "build",
+		DurationSeconds: time.Since(started).Seconds(),
+		Failure:         telemetry.FailureCategory(err),
+	}
+	if cfg.Build != nil {
+		event.GPU = cfg.Build.GPU
+		event.PythonVersion = cfg.Build.PythonVersion
+	}
+	if err == nil {
+		if image, err := docker.ImageInspect(imageName); err == nil {
+			event.ImageSizeBytes = image.Size
+		}
+	}
+	telemetry.Record(event)
+}
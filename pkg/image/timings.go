@@ -0,0 +1,152 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/dockerfile"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// Parts of a build that aren't in the Dockerfile
+const (
+	timingDocker   = "docker"
+	timingFlatten  = "flatten"
+	timingSchema   = "schema validation"
+	timingLicenses = "license scan"
+	timingLabels   = "labels"
+)
+
+// buildTimings records where the time of a build went, for `cog build --timings`. A nil *buildTimings
+// records nothing, so it can be passed around whether or not timings were asked for.
+type buildTimings struct {
+	// mu is held while steps are recorded, because the weights image can be built at the same time as the runner
+	mu       sync.Mutex
+	started  time.Time
+	sections []string
+	times    map[string]*sectionTime
+	// dockerSteps is how many steps were read from the output of docker builds
+	dockerSteps int
+}
+
+type sectionTime struct {
+	duration time.Duration
+	steps    int
+	cached   int
+}
+
+func newBuildTimings() *buildTimings {
+	return &buildTimings{started: time.Now(), times: map[string]*sectionTime{}}
+}
+
+// add records that a step of a section took d
+func (t *buildTimings) add(section string, d time.Duration, cached bool) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, ok := t.times[section]
+	if !ok {
+		s = &sectionTime{}
+		t.times[section] = s
+		t.sections = append(t.sections, section)
+	}
+	s.duration += d
+	s.steps++
+	if cached {
+		s.cached++
+	}
+}
+
+// since records that a section started at start and has just finished
+func (t *buildTimings) since(section string, start time.Time) {
+	t.add(section, time.Since(start), false)
+}
+
+// addSteps records the steps of a docker build, using section to find out which section each instruction is in
+func (t *buildTimings) addSteps(steps []docker.BuildStep, section func(instruction string) string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.dockerSteps += len(steps)
+	t.mu.Unlock()
+	for _, step := range steps {
+		name := timingDocker
+		if instruction := step.Instruction(); instruction != "" {
+			name = section(instruction)
+		}
+		t.add(name, step.Duration, step.Cached)
+	}
+}
+
+// table returns a table of how long each section took, in the order the sections first appeared
+func (t *buildTimings) table() string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "SECTION\tTIME\tSTEPS\tCACHED")
+	var sum time.Duration
+	for _, section := range t.sections {
+		s := t.times[section]
+		sum += s.duration
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\n", section, formatDuration(s.duration), s.steps, s.cached)
+	}
+	total := time.Since(t.started)
+	fmt.Fprintf(w, "total\t%s\n", formatDuration(total))
+	_ = w.Flush()
+	if sum > total {
+		buf.WriteString("Steps in different stages of the Dockerfile run in parallel, so sections can add up to more than the total.\n")
+	}
+	return buf.String()
+}
+
+// print shows the table of timings
+func (t *buildTimings) print() {
+	if t == nil {
+		return
+	}
+	console.Info("")
+	console.Info("Build timings:")
+	if t.dockerSteps == 0 {
+		console.Warn("No build steps were found in the output of docker build, so only the parts of the build outside Docker are shown.")
+	}
+	for _, line := range strings.Split(strings.TrimRight(t.table(), "\n"), "\n") {
+		console.Info(line)
+	}
+}
+
+// timingSection returns the function that finds out which section of a Dockerfile an instruction is in
+func timingSection(generator *dockerfile.Generator) func(string) string {
+	if generator == nil {
+		return dockerfile.InstructionSection
+	}
+	return generator.Section
+}
+
+// buildWithTimings runs docker.Build, recording the time of each step if timings is set
+func buildWithTimings(ctx context.Context, dir, dockerfileContents, dockerignore, imageName string, secrets []string, buildArgs []string, noCache bool, progressOutput string, timings *buildTimings, section func(string) string) error {
+	return buildWithTimingsTo(ctx, os.Stderr, dir, dockerfileContents, dockerignore, imageName, secrets, buildArgs, noCache, progressOutput, timings, section)
+}
+
+// buildWithTimingsTo runs buildWithTimings, writing the build's output to out
+func buildWithTimingsTo(ctx context.Context, out io.Writer, dir, dockerfileContents, dockerignore, imageName string, secrets []string, buildArgs []string, noCache bool, progressOutput string, timings *buildTimings, section func(string) string) error {
+	steps, err := docker.BuildWithOutput(ctx, out, dir, dockerfileContents, dockerignore, imageName, secrets, buildArgs, noCache, progressOutput)
+	timings.addSteps(steps, section)
+	return err
+}
+
+func formatDuration(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%.1fs", d.Seconds())
+	}
+	return d.Round(time.Second).String()
+}
@@ -0,0 +1,37 @@
+package image
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/dockerfile"
+)
+
+func TestBuildTimings(t *testing.T) {
+	timings := newBuildTimings()
+	timings.addSteps([]docker.BuildStep{
+		{Name: "[internal] load build definition from Dockerfile", Duration: 100 * time.Millisecond},
+		{Name: "[stage-1 1/5] FROM docker.io/library/python:3.11-slim", Cached: true},
+		{Name: "[stage-1 2/5] RUN apt-get install -y ffmpeg", Duration: 30 * time.Second},
+		{Name: "[stage-1 3/5] RUN pip install torch", Duration: 90 * time.Second},
+	}, dockerfile.InstructionSection)
+	timings.add(timingSchema, 2*time.Second, false)
+
+	require.Equal(t, []string{timingDocker, dockerfile.SectionBaseImage, "run", timingSchema}, timings.sections)
+	require.Equal(t, 2*time.Minute, timings.times["run"].duration)
+	require.Equal(t, 2, timings.times["run"].steps)
+	require.Equal(t, 1, timings.times[dockerfile.SectionBaseImage].cached)
+
+	table := timings.table()
+	require.Contains(t, table, "SECTION")
+	require.Contains(t, table, "2m0s")
+	// The steps took longer than the test has been running for
+	require.Contains(t, table, "run in parallel")
+
+	var none *buildTimings
+	none.add(timingSchema, time.Second, false)
+	none.print()
+}
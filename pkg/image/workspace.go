@@ -0,0 +1,41 @@
+package image
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/dockerfile"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// buildWorkspaceBase builds the base image of the workspace that cfg is in, if it's in one, so the model can start
+// from it. It's built every time, because Docker's cache makes that quick when the workspace hasn't changed.
+func buildWorkspaceBase(ctx context.Context, cfg *config.Config, secrets []string, buildArgs []string, noCache bool, useCudaBaseImage string, progressOutput string) error {
+	workspace := cfg.Workspace
+	if workspace == nil {
+		return nil
+	}
+	console.Infof("Building the base image of the workspace in %s as %s...", workspace.Dir, workspace.Image)
+	generator, err := dockerfile.NewGenerator(workspace.Config(), workspace.Dir)
+	if err != nil {
+		return fmt.Errorf("Error creating Dockerfile generator: %w", err)
+	}
+	defer func() {
+		if err := generator.Cleanup(); err != nil {
+			console.Warnf("Error cleaning up Dockerfile generator: %s", err)
+		}
+	}()
+	generator.SetUseCudaBaseImage(useCudaBaseImage)
+	dockerfileContents, err := generator.GenerateBase()
+	if err != nil {
+		return fmt.Errorf("Failed to generate Dockerfile for the workspace: %w", err)
+	}
+	// The base image only has the files Cog generates in it, rather than everything in the repository
+	dockerignore := "**\n!" + generator.RelativeTmpDir() + "\n"
+	if err := docker.Build(ctx, workspace.Dir, dockerfileContents, dockerignore, workspace.Image, secrets, buildArgs, noCache, progressOutput); err != nil {
+		return fmt.Errorf("Failed to build the base image of the workspace: %w", err)
+	}
+	return nil
+}
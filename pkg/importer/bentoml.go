@@ -0,0 +1,90 @@
+package importer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// bentofile is the parts of a BentoML bentofile.yaml that Cog can use
+type bentofile struct {
+	Service string `yaml:"service"`
+	Python  struct {
+		Packages        []string `yaml:"packages"`
+		RequirementsTxt string   `yaml:"requirements_txt"`
+	} `yaml:"python"`
+	Docker struct {
+		PythonVersion  string   `yaml:"python_version"`
+		CUDAVersion    string   `yaml:"cuda_version"`
+		SystemPackages []string `yaml:"system_packages"`
+		SetupScript    string   `yaml:"setup_script"`
+		BaseImage      string   `yaml:"base_image"`
+		Dockerfile     string   `yaml:"dockerfile_template"`
+	} `yaml:"docker"`
+	Envs []struct {
+		Name  string `yaml:"name"`
+		Value string `yaml:"value"`
+	} `yaml:"envs"`
+}
+
+func importBentoML(dir string) (*Project, error) {
+	contents, err := os.ReadFile(filepath.Join(dir, "bentofile.yaml"))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read bentofile.yaml: %w", err)
+	}
+	bento := bentofile{}
+	if err := yaml.Unmarshal(contents, &bento); err != nil {
+		return nil, fmt.Errorf("Failed to parse bentofile.yaml: %w", err)
+	}
+
+	p := &Project{
+		Source:         "BentoML",
+		GPU:            bento.Docker.CUDAVersion != "",
+		CUDA:           cudaMinorVersion(bento.Docker.CUDAVersion),
+		PythonVersion:  pythonMinorVersion(bento.Docker.PythonVersion),
+		PythonPackages: bento.Python.Packages,
+		SystemPackages: bento.Docker.SystemPackages,
+		Output:         "str",
+	}
+	if bento.Python.RequirementsTxt != "" {
+		p.PythonRequirements = filepath.ToSlash(filepath.Clean(bento.Python.RequirementsTxt))
+		if len(p.PythonPackages) > 0 {
+			p.note("python.packages were moved to python_packages, but Cog can only use one of python_packages or python_requirements. Add them to %s", p.PythonRequirements)
+			p.PythonPackages = nil
+		}
+	}
+	if bento.Docker.SetupScript != "" {
+		p.Run = append(p.Run, "bash "+bento.Docker.SetupScript)
+		p.note("docker.setup_script is run in build.run, but the script isn't in the image yet when it runs. Move its commands into build.run")
+	}
+	if bento.Docker.BaseImage != "" {
+		p.note("docker.base_image %s can't be used. Cog picks a base image from build.gpu, build.cuda and build.python_version", bento.Docker.BaseImage)
+	}
+	if bento.Docker.Dockerfile != "" {
+		p.note("docker.dockerfile_template %s wasn't translated. Move its commands into build.run", bento.Docker.Dockerfile)
+	}
+	for _, env := range bento.Envs {
+		p.note("Set environment variable %s=%s", env.Name, env.Value)
+	}
+
+	// The service is in the form "module:attribute", e.g. "service:svc"
+	module, attribute, found := strings.Cut(bento.Service, ":")
+	if !found {
+		module, attribute = "service", "svc"
+	}
+	p.Imports = []string{fmt.Sprintf("# from %s import %s", module, attribute)}
+	p.Setup = []string{
+		fmt.Sprintf("# Move the model loading from the %s service in %s.py here, e.g.", attribute, strings.ReplaceAll(module, ".", "/")),
+		"# self.model = bentoml.models.get(\"my_model:latest\").load_model()",
+	}
+	p.Inputs = []Input{{Name: "text", Type: "str", Description: "Input to the model"}}
+	p.Predict = []string{
+		fmt.Sprintf("# Move the body of the %s service's API function here, e.g.", attribute),
+		"# return self.model.predict(text)",
+		"raise NotImplementedError",
+	}
+	return p, nil
+}
@@ -0,0 +1,189 @@
+package importer
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	// pythonImage matches official Python images, e.g. python:3.10-slim
+	pythonImage = regexp.MustCompile(`^(?:docker\.io/)?(?:library/)?python:(\d+\.\d+)`)
+	// cudaImage matches NVIDIA's CUDA images, e.g. nvidia/cuda:11.8.0-cudnn8-runtime-ubuntu22.04
+	cudaImage = regexp.MustCompile(`^(?:docker\.io/)?nvidia/cuda:(\d+\.\d+)`)
+	// pytorchImage matches PyTorch's images, which come with CUDA, e.g. pytorch/pytorch:2.0.1-cuda11.7-cudnn8-runtime
+	pytorchImage = regexp.MustCompile(`^(?:docker\.io/)?pytorch/pytorch:([\d.]+)-cuda(\d+\.\d+)`)
+	aptInstall   = regexp.MustCompile(`^(?:apt-get|apt)\s+install\s+(.*)$`)
+	pipInstall   = regexp.MustCompile(`^(?:python3?\s+-m\s+)?pip3?\s+install\s+(.*)$`)
+)
+
+func importDockerfile(dir string, relDir string) (*Project, error) {
+	instructions, err := readDockerfile(filepath.Join(dir, "Dockerfile"))
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Project{
+		Source: "Dockerfile",
+		Output: "str",
+	}
+	requirements := ""
+	if _, err := os.Stat(filepath.Join(dir, "requirements.txt")); err == nil {
+		requirements = path.Join(relDir, "requirements.txt")
+	}
+
+	for _, instruction := range instructions {
+		keyword, args, _ := strings.Cut(instruction, " ")
+		args = strings.TrimSpace(args)
+		switch strings.ToUpper(keyword) {
+		case "FROM":
+			p.importBaseImage(args)
+		case "RUN":
+			p.importRun(args, relDir, &requirements)
+		case "ENV", "ARG":
+			p.note("Dockerfile %s %s wasn't translated", strings.ToUpper(keyword), args)
+		case "CMD", "ENTRYPOINT":
+			p.note("Dockerfile %s %s was replaced by predict.py. Move the code it runs into the Predictor", strings.ToUpper(keyword), args)
+		case "COPY", "ADD", "WORKDIR", "EXPOSE", "LABEL", "USER", "HEALTHCHECK":
+			// Cog copies the project into the image, and runs its own server
+		default:
+			p.note("Dockerfile %s %s wasn't translated", strings.ToUpper(keyword), args)
+		}
+	}
+
+	if requirements != "" {
+		p.PythonRequirements = requirements
+		if len(p.PythonPackages) > 0 {
+			p.note("Packages installed with pip in the Dockerfile (%s) need to be added to %s", strings.Join(p.PythonPackages, ", "), requirements)
+			p.PythonPackages = nil
+		}
+	}
+
+	p.Setup = []string{
+		"# Load the model here, e.g.",
+		"# self.model = torch.load(\"./weights.pth\")",
+	}
+	p.Inputs = []Input{{Name: "text", Type: "str", Description: "Input to the model"}}
+	p.Predict = []string{
+		"# Run the model here, e.g.",
+		"# return self.model(text)",
+		"raise NotImplementedError",
+	}
+	return p, nil
+}
+
+func (p *Project) importBaseImage(image string) {
+	// Drop options like --platform, and stage names like "AS builder"
+	fields := strings.Fields(image)
+	for len(fields) > 0 && strings.HasPrefix(fields[0], "--") {
+		fields = fields[1:]
+	}
+	if len(fields) == 0 {
+		return
+	}
+	image = fields[0]
+
+	if m := pythonImage.FindStringSubmatch(image); m != nil {
+		p.PythonVersion = m[1]
+	} else if m := cudaImage.FindStringSubmatch(image); m != nil {
+		p.GPU = true
+		p.CUDA = m[1]
+	} else if m := pytorchImage.FindStringSubmatch(image); m != nil {
+		p.GPU = true
+		p.CUDA = m[2]
+		p.PythonPackages = append(p.PythonPackages, "torch=="+m[1])
+	} else {
+		p.note("The base image %s was replaced by one Cog picks. Set build.gpu, build.cuda and build.python_version if they need to match it", image)
+	}
+}
+
+func (p *Project) importRun(command string, relDir string, requirements *string) {
+	for _, part := range splitShellCommands(command) {
+		if m := aptInstall.FindStringSubmatch(part); m != nil {
+			for _, arg := range strings.Fields(m[1]) {
+				if !strings.HasPrefix(arg, "-") {
+					p.SystemPackages = append(p.SystemPackages, arg)
+				}
+			}
+			continue
+		}
+		if m := pipInstall.FindStringSubmatch(part); m != nil {
+			args := strings.Fields(m[1])
+			for i := 0; i < len(args); i++ {
+				switch {
+				case args[i] == "-r" || args[i] == "--requirement":
+					if i+1 < len(args) {
+						*requirements = path.Join(relDir, args[i+1])
+						i++
+					}
+				case strings.HasPrefix(args[i], "-"):
+					// Options like --no-cache-dir
+				default:
+					p.PythonPackages = append(p.PythonPackages, strings.Trim(args[i], `"'`))
+				}
+			}
+			continue
+		}
+		if isHousekeeping(part) {
+			continue
+		}
+		p.Run = append(p.Run, part)
+	}
+}
+
+// splitShellCommands splits a shell command on &&, so each part can be translated separately
+func splitShellCommands(command string) []string {
+	parts := []string{}
+	for _, part := range strings.Split(command, "&&") {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+// isHousekeeping returns whether a command only manages the package manager, which Cog does itself
+func isHousekeeping(command string) bool {
+	for _, prefix := range []string{"apt-get update", "apt update", "apt-get clean", "rm -rf /var/lib/apt/lists", "pip install --upgrade pip", "pip install -U pip"} {
+		if strings.HasPrefix(command, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// readDockerfile returns the instructions in a Dockerfile, with line continuations joined and comments removed
+func readDockerfile(dockerfilePath string) ([]string, error) {
+	f, err := os.Open(dockerfilePath)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read Dockerfile: %w", err)
+	}
+	defer f.Close()
+
+	instructions := []string{}
+	current := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#") || (line == "" && current == "") {
+			continue
+		}
+		if strings.HasSuffix(line, "\\") {
+			current += strings.TrimSuffix(line, "\\") + " "
+			continue
+		}
+		current += line
+		if current = strings.Join(strings.Fields(current), " "); current != "" {
+			instructions = append(instructions, current)
+		}
+		current = ""
+	}
+	if current != "" {
+		instructions = append(instructions, strings.Join(strings.Fields(current), " "))
+	}
+	return instructions, scanner.Err()
+}
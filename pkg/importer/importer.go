@@ -0,0 +1,207 @@
+// Package importer translates projects packaged with other tools into a cog.yaml and predict.py
+package importer
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// Sources that projects can be imported from
+const (
+	SourceBentoML    = "bentoml"
+	SourceMLflow     = "mlflow"
+	SourceDockerfile = "dockerfile"
+)
+
+// Sources are all the sources that projects can be imported from
+var Sources = []string{SourceBentoML, SourceMLflow, SourceDockerfile}
+
+// sourceFiles are the files that identify each source, in the order they are detected
+var sourceFiles = []struct {
+	source string
+	file   string
+}{
+	{SourceBentoML, "bentofile.yaml"},
+	{SourceMLflow, "MLmodel"},
+	{SourceDockerfile, "Dockerfile"},
+}
+
+// Project is what's needed to write a cog.yaml and predict.py for an imported project
+type Project struct {
+	Source             string
+	GPU                bool
+	CUDA               string
+	PythonVersion      string
+	PythonRequirements string
+	PythonPackages     []string
+	SystemPackages     []string
+	Run                []string
+	// Imports, Setup and Predict are lines of Python in predict.py
+	Imports []string
+	Setup   []string
+	Predict []string
+	Inputs  []Input
+	// Output is the Python return type of predict()
+	Output string
+	// Notes are things that couldn't be translated, which the user needs to look at
+	Notes []string
+}
+
+// Input is an argument of predict()
+type Input struct {
+	Name        string
+	Type        string
+	Description string
+}
+
+// Detect returns the source of the project in dir
+func Detect(dir string) (string, error) {
+	for _, s := range sourceFiles {
+		if _, err := os.Stat(filepath.Join(dir, s.file)); err == nil {
+			return s.source, nil
+		}
+	}
+	return "", fmt.Errorf("Couldn't find a bentofile.yaml, MLmodel or Dockerfile in %s", dir)
+}
+
+// Import reads the project in dir from source. relDir is dir relative to where cog.yaml will be written,
+// so the model can refer to files in it.
+func Import(source string, dir string, relDir string) (*Project, error) {
+	switch source {
+	case SourceBentoML:
+		return importBentoML(dir)
+	case SourceMLflow:
+		return importMLflow(dir, relDir)
+	case SourceDockerfile:
+		return importDockerfile(dir, relDir)
+	}
+	return nil, fmt.Errorf("Unknown source '%s', it must be one of %s", source, strings.Join(Sources, ", "))
+}
+
+// CogYAML returns the contents of cog.yaml for the project
+func (p *Project) CogYAML() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := cogYAMLTemplate.Execute(&buf, p); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// PredictPy returns the contents of predict.py for the project
+func (p *Project) PredictPy() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := predictPyTemplate.Execute(&buf, p); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (p *Project) note(format string, a ...interface{}) {
+	p.Notes = append(p.Notes, fmt.Sprintf(format, a...))
+}
+
+// pythonMinorVersion returns the major and minor version of a Python version, e.g. "3.10.4" is "3.10"
+func pythonMinorVersion(version string) string {
+	parts := strings.Split(strings.TrimSpace(version), ".")
+	if len(parts) < 2 {
+		return version
+	}
+	return parts[0] + "." + parts[1]
+}
+
+// cudaMinorVersion returns the major and minor version of a CUDA version, e.g. "11.6.2" is "11.6"
+func cudaMinorVersion(version string) string {
+	return pythonMinorVersion(version)
+}
+
+var invalidIdentifierChars = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// identifier turns a name into a valid Python identifier
+func identifier(name string) string {
+	name = invalidIdentifierChars.ReplaceAllString(name, "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+	return name
+}
+
+// quote returns s as a YAML or Python double-quoted string
+func quote(s string) string {
+	return fmt.Sprintf("%q", s)
+}
+
+var templateFuncs = template.FuncMap{"quote": quote}
+
+var cogYAMLTemplate = template.Must(template.New("cog.yaml").Funcs(templateFuncs).Parse(`# Configuration for Cog ⚙️
+# Reference: https://github.com/replicate/cog/blob/main/docs/yaml.md
+# Imported from {{ .Source }} by cog import
+{{- range .Notes }}
+# TODO: {{ . }}
+{{- end }}
+
+build:
+  gpu: {{ .GPU }}
+{{- if .CUDA }}
+  cuda: {{ quote .CUDA }}
+{{- end }}
+{{- if .PythonVersion }}
+  python_version: {{ quote .PythonVersion }}
+{{- end }}
+{{- if .PythonRequirements }}
+  python_requirements: {{ quote .PythonRequirements }}
+{{- end }}
+{{- if .PythonPackages }}
+  python_packages:
+{{- range .PythonPackages }}
+    - {{ quote . }}
+{{- end }}
+{{- end }}
+{{- if .SystemPackages }}
+  system_packages:
+{{- range .SystemPackages }}
+    - {{ quote . }}
+{{- end }}
+{{- end }}
+{{- if .Run }}
+  run:
+{{- range .Run }}
+    - {{ quote . }}
+{{- end }}
+{{- end }}
+
+predict: "predict.py:Predictor"
+`))
+
+var predictPyTemplate = template.Must(template.New("predict.py").Funcs(templateFuncs).Parse(`# Prediction interface for Cog ⚙️
+# https://github.com/replicate/cog/blob/main/docs/python.md
+# Imported from {{ .Source }} by cog import
+
+from cog import BasePredictor, Input, Path
+{{- range .Imports }}
+{{ . }}
+{{- end }}
+
+
+class Predictor(BasePredictor):
+    def setup(self) -> None:
+        """Load the model into memory to make running multiple predictions efficient"""
+{{- range .Setup }}
+        {{ . }}
+{{- end }}
+
+    def predict(
+        self,
+{{- range .Inputs }}
+        {{ .Name }}: {{ .Type }} = Input(description={{ quote .Description }}),
+{{- end }}
+    ) -> {{ .Output }}:
+        """Run a single prediction on the model"""
+{{- range .Predict }}
+        {{ . }}
+{{- end }}
+`))
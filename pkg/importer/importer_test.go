@@ -0,0 +1,167 @@
+package importer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	return dir
+}
+
+func requireValidConfig(t *testing.T, p *Project) *config.Config {
+	t.Helper()
+	cogYAML, err := p.CogYAML()
+	require.NoError(t, err)
+	cfg, err := config.FromYAML(cogYAML)
+	require.NoError(t, err)
+	require.NoError(t, config.ValidateConfig(cfg, ""))
+	return cfg
+}
+
+func TestDetect(t *testing.T) {
+	source, err := Detect(writeFiles(t, map[string]string{"bentofile.yaml": "", "Dockerfile": ""}))
+	require.NoError(t, err)
+	require.Equal(t, SourceBentoML, source)
+
+	source, err = Detect(writeFiles(t, map[string]string{"MLmodel": ""}))
+	require.NoError(t, err)
+	require.Equal(t, SourceMLflow, source)
+
+	_, err = Detect(t.TempDir())
+	require.Error(t, err)
+}
+
+func TestImportBentoML(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"bentofile.yaml": `
+service: "service:svc"
+include:
+  - "*.py"
+python:
+  packages:
+    - scikit-learn==1.3.0
+    - pandas
+docker:
+  python_version: "3.10.4"
+  cuda_version: "11.8.0"
+  system_packages:
+    - libgomp1
+envs:
+  - name: MODEL_DIR
+    value: /models
+`})
+
+	p, err := Import(SourceBentoML, dir, ".")
+	require.NoError(t, err)
+	cfg := requireValidConfig(t, p)
+	require.True(t, cfg.Build.GPU)
+	require.Equal(t, "11.8", cfg.Build.CUDA)
+	require.Equal(t, "3.10", cfg.Build.PythonVersion)
+	require.Equal(t, []string{"scikit-learn==1.3.0", "pandas"}, cfg.Build.PythonPackages)
+	require.Equal(t, []string{"libgomp1"}, cfg.Build.SystemPackages)
+	require.Equal(t, "predict.py:Predictor", cfg.Predict)
+	require.Equal(t, []string{"Set environment variable MODEL_DIR=/models"}, p.Notes)
+
+	predictPy, err := p.PredictPy()
+	require.NoError(t, err)
+	require.Contains(t, string(predictPy), "# from service import svc\n")
+	require.Contains(t, string(predictPy), `        text: str = Input(description="Input to the model"),`)
+}
+
+func TestImportMLflow(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"MLmodel": `
+artifact_path: model
+flavors:
+  python_function:
+    env:
+      virtualenv: python_env.yaml
+    loader_module: mlflow.sklearn
+    model_path: model.pkl
+    python_version: 3.9.16
+  sklearn:
+    pickled_model: model.pkl
+    sklearn_version: 1.2.2
+signature:
+  inputs: '[{"name": "sepal length (cm)", "type": "double"}, {"name": "count", "type": "long"}]'
+  outputs: '[{"type": "long"}]'
+`,
+		"requirements.txt": "mlflow==2.8.0\nscikit-learn==1.2.2\n",
+	})
+
+	p, err := Import(SourceMLflow, dir, "mlruns/0/abc/artifacts/model")
+	require.NoError(t, err)
+	cfg := requireValidConfig(t, p)
+	require.Equal(t, "3.9", cfg.Build.PythonVersion)
+	require.Equal(t, "mlruns/0/abc/artifacts/model/requirements.txt", cfg.Build.PythonRequirements)
+	require.Empty(t, p.Notes)
+
+	predictPy, err := p.PredictPy()
+	require.NoError(t, err)
+	require.Contains(t, string(predictPy), `        self.model = mlflow.pyfunc.load_model("mlruns/0/abc/artifacts/model")`)
+	require.Contains(t, string(predictPy), `        sepal_length__cm_: float = Input(description="sepal length (cm)"),`)
+	require.Contains(t, string(predictPy), `        count: int = Input(description="count"),`)
+	require.Contains(t, string(predictPy), `        df = pd.DataFrame({"sepal length (cm)": [sepal_length__cm_], "count": [count]})`)
+}
+
+func TestImportMLflowWithoutPyfunc(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"MLmodel": "flavors:\n  keras:\n    keras_version: 2.13.1\n"})
+	_, err := Import(SourceMLflow, dir, ".")
+	require.Error(t, err)
+}
+
+func TestImportDockerfile(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"Dockerfile": `# A model server
+FROM python:3.11-slim AS base
+
+RUN apt-get update && apt-get install -y --no-install-recommends \
+    ffmpeg \
+    libsm6 && rm -rf /var/lib/apt/lists/*
+WORKDIR /app
+COPY requirements.txt .
+RUN pip install --no-cache-dir -r requirements.txt
+RUN pip install gunicorn
+RUN python download_weights.py
+ENV MODEL_PATH=/app/weights
+CMD ["gunicorn", "app:app"]
+`,
+		"requirements.txt": "torch==2.1.0\n",
+	})
+
+	p, err := Import(SourceDockerfile, dir, ".")
+	require.NoError(t, err)
+	cfg := requireValidConfig(t, p)
+	require.False(t, cfg.Build.GPU)
+	require.Equal(t, "3.11", cfg.Build.PythonVersion)
+	require.Equal(t, "requirements.txt", cfg.Build.PythonRequirements)
+	require.Empty(t, cfg.Build.PythonPackages)
+	require.Equal(t, []string{"ffmpeg", "libsm6"}, cfg.Build.SystemPackages)
+	require.Equal(t, []config.RunItem{{Command: "python download_weights.py"}}, cfg.Build.Run)
+	require.Equal(t, []string{
+		"Dockerfile ENV MODEL_PATH=/app/weights wasn't translated",
+		`Dockerfile CMD ["gunicorn", "app:app"] was replaced by predict.py. Move the code it runs into the Predictor`,
+		"Packages installed with pip in the Dockerfile (gunicorn) need to be added to requirements.txt",
+	}, p.Notes)
+}
+
+func TestImportDockerfileWithCUDA(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"Dockerfile": "FROM nvidia/cuda:12.1.0-cudnn8-runtime-ubuntu22.04\nRUN pip3 install torch==2.1.0\n"})
+
+	p, err := Import(SourceDockerfile, dir, ".")
+	require.NoError(t, err)
+	cfg := requireValidConfig(t, p)
+	require.True(t, cfg.Build.GPU)
+	require.Equal(t, "12.1", cfg.Build.CUDA)
+	require.Equal(t, []string{"torch==2.1.0"}, cfg.Build.PythonPackages)
+}
@@ -0,0 +1,110 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// mlmodel is the parts of an MLflow MLmodel file that Cog can use
+type mlmodel struct {
+	Flavors   map[string]map[string]interface{} `yaml:"flavors"`
+	Signature struct {
+		// Inputs and Outputs are JSON
+		Inputs  string `yaml:"inputs"`
+		Outputs string `yaml:"outputs"`
+	} `yaml:"signature"`
+}
+
+// mlflowColumn is a column in an MLflow model's column-based signature
+type mlflowColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// mlflowTypes maps MLflow column types to Python types
+var mlflowTypes = map[string]string{
+	"boolean":  "bool",
+	"integer":  "int",
+	"long":     "int",
+	"float":    "float",
+	"double":   "float",
+	"string":   "str",
+	"binary":   "Path",
+	"datetime": "str",
+}
+
+func importMLflow(dir string, relDir string) (*Project, error) {
+	contents, err := os.ReadFile(filepath.Join(dir, "MLmodel"))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read MLmodel: %w", err)
+	}
+	model := mlmodel{}
+	if err := yaml.Unmarshal(contents, &model); err != nil {
+		return nil, fmt.Errorf("Failed to parse MLmodel: %w", err)
+	}
+
+	p := &Project{
+		Source: "MLflow",
+		Output: "str",
+	}
+	pyfunc, ok := model.Flavors["python_function"]
+	if !ok {
+		return nil, fmt.Errorf("The MLflow model doesn't have a python_function flavor, so Cog can't load it")
+	}
+	if version, ok := pyfunc["python_version"].(string); ok {
+		p.PythonVersion = pythonMinorVersion(version)
+	}
+
+	// MLflow writes the model's dependencies next to it
+	if _, err := os.Stat(filepath.Join(dir, "requirements.txt")); err == nil {
+		p.PythonRequirements = path.Join(relDir, "requirements.txt")
+	} else {
+		p.PythonPackages = []string{"mlflow"}
+		p.note("Add the packages the model needs to python_packages")
+	}
+
+	p.Imports = []string{"import mlflow.pyfunc", "import pandas as pd"}
+	p.Setup = []string{fmt.Sprintf("self.model = mlflow.pyfunc.load_model(%s)", quote(relDir))}
+
+	columns := []mlflowColumn{}
+	if model.Signature.Inputs != "" {
+		if err := json.Unmarshal([]byte(model.Signature.Inputs), &columns); err != nil {
+			return nil, fmt.Errorf("Failed to parse the MLflow model's input signature: %w", err)
+		}
+	}
+	names := []string{}
+	for _, column := range columns {
+		pythonType, ok := mlflowTypes[column.Type]
+		if column.Name == "" || !ok {
+			// Tensor-based signatures don't have names, and have types like "tensor"
+			p.note("The model's input signature couldn't be translated. Change the inputs of predict() to match it")
+			p.Inputs = nil
+			names = nil
+			break
+		}
+		p.Inputs = append(p.Inputs, Input{Name: identifier(column.Name), Type: pythonType, Description: column.Name})
+		names = append(names, fmt.Sprintf("%s: [%s]", quote(column.Name), identifier(column.Name)))
+	}
+	if len(p.Inputs) == 0 {
+		p.Inputs = []Input{{Name: "data", Type: "str", Description: "Input to the model, as JSON"}}
+		p.Imports = append(p.Imports, "import json")
+		names = nil
+	}
+
+	if names != nil {
+		p.Predict = []string{fmt.Sprintf("df = pd.DataFrame({%s})", strings.Join(names, ", "))}
+	} else {
+		p.Predict = []string{"df = pd.DataFrame(json.loads(data))"}
+	}
+	p.Predict = append(p.Predict,
+		"output = self.model.predict(df)",
+		"return str(output[0]) if len(output) == 1 else str(list(output))",
+	)
+	return p, nil
+}
@@ -0,0 +1,58 @@
+package kube
+
+import (
+	"strconv"
+)
+
+type inferenceServiceManifest struct {
+	APIVersion string               `json:"apiVersion"`
+	Kind       string               `json:"kind"`
+	Metadata   objectMeta           `json:"metadata"`
+	Spec       inferenceServiceSpec `json:"spec"`
+}
+
+type inferenceServiceSpec struct {
+	Predictor predictorSpec `json:"predictor"`
+}
+
+type predictorSpec struct {
+	MinReplicas                   *int        `json:"minReplicas,omitempty"`
+	MaxReplicas                   *int        `json:"maxReplicas,omitempty"`
+	ContainerConcurrency          int         `json:"containerConcurrency,omitempty"`
+	Timeout                       int         `json:"timeout,omitempty"`
+	TerminationGracePeriodSeconds int         `json:"terminationGracePeriodSeconds,omitempty"`
+	Containers                    []container `json:"containers"`
+	Affinity                      *affinity   `json:"affinity,omitempty"`
+}
+
+func inferenceService(opts Options) inferenceServiceManifest {
+	// Cog serves its own HTTP API rather than one of KServe's protocols, so it is a custom
+	// predictor. Knative scales it on the number of predictions each replica is running.
+	annotations := map[string]string{
+		"serving.kserve.io/deploymentMode": "Serverless",
+		"autoscaling.knative.dev/metric":   "concurrency",
+	}
+	concurrency := opts.MaxConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	annotations["autoscaling.knative.dev/target"] = strconv.Itoa(concurrency)
+
+	return inferenceServiceManifest{
+		APIVersion: "serving.kserve.io/v1beta1",
+		Kind:       "InferenceService",
+		Metadata:   metadata(opts, annotations),
+		Spec: inferenceServiceSpec{
+			Predictor: predictorSpec{
+				MinReplicas:                   opts.MinReplicas,
+				MaxReplicas:                   opts.MaxReplicas,
+				ContainerConcurrency:          opts.MaxConcurrency,
+				Timeout:                       opts.TimeoutSeconds,
+				TerminationGracePeriodSeconds: opts.TerminationGracePeriodSeconds,
+				// Knative routes HTTP/1 traffic to the port named h1c
+				Containers: []container{modelContainer(opts, "kserve-container", "h1c")},
+				Affinity:   gpuMemoryAffinity(opts),
+			},
+		},
+	}
+}
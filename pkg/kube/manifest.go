@@ -0,0 +1,190 @@
+package kube
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/docker/go-units"
+	"sigs.k8s.io/yaml"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+// Kinds of manifest that can be generated
+const (
+	// KindInferenceService is a KServe InferenceService
+	KindInferenceService = "inferenceservice"
+	// KindSeldonDeployment is a Seldon Core SeldonDeployment
+	KindSeldonDeployment = "seldon"
+)
+
+// Kinds are all of the kinds of manifest that can be generated
+var Kinds = []string{KindInferenceService, KindSeldonDeployment}
+
+// containerPort is the port Cog's HTTP server listens on
+const containerPort = 5000
+
+// Options describe how a model is deployed to Kubernetes
+type Options struct {
+	Name      string
+	Namespace string
+	Image     string
+	// GPUs is the number of GPUs to request for each replica
+	GPUs int
+	// MaxConcurrency is the number of predictions a replica can run at the same time
+	MaxConcurrency int
+	// MinReplicas and MaxReplicas are left to the platform's defaults if nil
+	MinReplicas *int
+	MaxReplicas *int
+	// TimeoutSeconds is how long a prediction can run for, or 0 for the platform's default
+	TimeoutSeconds int
+	// TerminationGracePeriodSeconds is how long a replica has to finish predictions when it is stopped, or 0 for the default
+	TerminationGracePeriodSeconds int
+	// Resources are what each replica requests, from resources in cog.yaml
+	Resources config.ResourceRequirements
+}
+
+// OptionsFromConfig returns the options for deploying image, derived from cog.yaml
+func OptionsFromConfig(cfg *config.Config, name string, image string) Options {
+	opts := Options{
+		Name:                          name,
+		Image:                         image,
+		TimeoutSeconds:                cfg.PredictTimeout,
+		TerminationGracePeriodSeconds: cfg.ShutdownGracePeriod(),
+	}
+	if cfg.Build != nil && cfg.Build.GPU {
+		opts.GPUs = 1
+	}
+	if cfg.Concurrency != nil && cfg.Concurrency.Max > 0 {
+		opts.MaxConcurrency = cfg.Concurrency.Max
+	}
+	// cog.yaml has been validated, so the sizes in it are valid
+	if resources, err := cfg.ResourceRequirements(); err == nil {
+		opts.Resources = resources
+	}
+	return opts
+}
+
+// Manifest returns the YAML manifest of the given kind
+func Manifest(kind string, opts Options) ([]byte, error) {
+	switch kind {
+	case KindInferenceService:
+		return yaml.Marshal(inferenceService(opts))
+	case KindSeldonDeployment:
+		return yaml.Marshal(seldonDeployment(opts))
+	}
+	return nil, fmt.Errorf("Unknown kind '%s'", kind)
+}
+
+type objectMeta struct {
+	Name        string            `json:"name"`
+	Namespace   string            `json:"namespace,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type container struct {
+	Name           string                `json:"name"`
+	Image          string                `json:"image"`
+	Ports          []containerPortSpec   `json:"ports,omitempty"`
+	Resources      *resourceRequirements `json:"resources,omitempty"`
+	ReadinessProbe *probe                `json:"readinessProbe,omitempty"`
+}
+
+type containerPortSpec struct {
+	Name          string `json:"name,omitempty"`
+	ContainerPort int    `json:"containerPort"`
+	Protocol      string `json:"protocol,omitempty"`
+}
+
+type resourceRequirements struct {
+	Limits   map[string]string `json:"limits,omitempty"`
+	Requests map[string]string `json:"requests,omitempty"`
+}
+
+type affinity struct {
+	NodeAffinity nodeAffinity `json:"nodeAffinity"`
+}
+
+type nodeAffinity struct {
+	RequiredDuringSchedulingIgnoredDuringExecution nodeSelector `json:"requiredDuringSchedulingIgnoredDuringExecution"`
+}
+
+type nodeSelector struct {
+	NodeSelectorTerms []nodeSelectorTerm `json:"nodeSelectorTerms"`
+}
+
+type nodeSelectorTerm struct {
+	MatchExpressions []nodeSelectorRequirement `json:"matchExpressions"`
+}
+
+type nodeSelectorRequirement struct {
+	Key      string   `json:"key"`
+	Operator string   `json:"operator"`
+	Values   []string `json:"values"`
+}
+
+type probe struct {
+	Exec execAction `json:"exec"`
+}
+
+type execAction struct {
+	Command []string `json:"command"`
+}
+
+func modelContainer(opts Options, name string, portName string) container {
+	c := container{
+		Name:  name,
+		Image: opts.Image,
+		Ports: []containerPortSpec{{Name: portName, ContainerPort: containerPort, Protocol: "TCP"}},
+		// The server creates this file when setup has finished, if it is running in Kubernetes
+		ReadinessProbe: &probe{Exec: execAction{Command: []string{"test", "-f", "/var/run/cog/ready"}}},
+	}
+	resources := resourceRequirements{Limits: map[string]string{}, Requests: map[string]string{}}
+	if opts.GPUs > 0 {
+		resources.Limits["nvidia.com/gpu"] = strconv.Itoa(opts.GPUs)
+	}
+	if opts.Resources.CPU > 0 {
+		resources.Requests["cpu"] = strconv.FormatFloat(opts.Resources.CPU, 'f', -1, 64)
+	}
+	if opts.Resources.MemoryBytes > 0 {
+		resources.Requests["memory"] = mebibytes(opts.Resources.MemoryBytes)
+	}
+	if opts.Resources.DiskBytes > 0 {
+		resources.Requests["ephemeral-storage"] = mebibytes(opts.Resources.DiskBytes)
+	}
+	if len(resources.Limits) > 0 || len(resources.Requests) > 0 {
+		c.Resources = &resources
+	}
+	return c
+}
+
+// gpuMemoryAffinity returns an affinity for nodes whose GPUs have the memory the model needs, or nil if it doesn't
+// need any. GPU Feature Discovery labels nodes with the memory of their GPUs in MiB.
+func gpuMemoryAffinity(opts Options) *affinity {
+	if opts.GPUs == 0 || opts.Resources.GPUMemoryBytes == 0 {
+		return nil
+	}
+	mib := (opts.Resources.GPUMemoryBytes + units.MiB - 1) / units.MiB
+	return &affinity{NodeAffinity: nodeAffinity{RequiredDuringSchedulingIgnoredDuringExecution: nodeSelector{
+		NodeSelectorTerms: []nodeSelectorTerm{{MatchExpressions: []nodeSelectorRequirement{{
+			Key:      "nvidia.com/gpu.memory",
+			Operator: "Gt",
+			Values:   []string{strconv.FormatInt(mib-1, 10)},
+		}}}},
+	}}}
+}
+
+// mebibytes returns bytes as a Kubernetes quantity in Mi, rounded up
+func mebibytes(bytes int64) string {
+	return strconv.FormatInt((bytes+units.MiB-1)/units.MiB, 10) + "Mi"
+}
+
+func metadata(opts Options, annotations map[string]string) objectMeta {
+	return objectMeta{
+		Name:        opts.Name,
+		Namespace:   opts.Namespace,
+		Labels:      map[string]string{"app.kubernetes.io/managed-by": "cog"},
+		Annotations: annotations,
+	}
+}
@@ -0,0 +1,113 @@
+package kube
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+func TestInferenceServiceManifest(t *testing.T) {
+	cfg, err := config.FromYAML([]byte(`
+build:
+  gpu: true
+predict: predict.py:Predictor
+predict_timeout: 300
+concurrency:
+  max: 4
+shutdown:
+  drain: true
+`))
+	require.NoError(t, err)
+
+	opts := OptionsFromConfig(cfg, "hotdog-detector", "registry.example.com/hotdog-detector:v1")
+	maxReplicas := 3
+	opts.MaxReplicas = &maxReplicas
+
+	manifest, err := Manifest(KindInferenceService, opts)
+	require.NoError(t, err)
+	require.Equal(t, `apiVersion: serving.kserve.io/v1beta1
+kind: InferenceService
+metadata:
+  annotations:
+    autoscaling.knative.dev/metric: concurrency
+    autoscaling.knative.dev/target: "4"
+    serving.kserve.io/deploymentMode: Serverless
+  labels:
+    app.kubernetes.io/managed-by: cog
+  name: hotdog-detector
+spec:
+  predictor:
+    containerConcurrency: 4
+    containers:
+    - image: registry.example.com/hotdog-detector:v1
+      name: kserve-container
+      ports:
+      - containerPort: 5000
+        name: h1c
+        protocol: TCP
+      readinessProbe:
+        exec:
+          command:
+          - test
+          - -f
+          - /var/run/cog/ready
+      resources:
+        limits:
+          nvidia.com/gpu: "1"
+    maxReplicas: 3
+    terminationGracePeriodSeconds: 30
+    timeout: 300
+`, string(manifest))
+}
+
+func TestSeldonDeploymentManifest(t *testing.T) {
+	minReplicas := 2
+	manifest, err := Manifest(KindSeldonDeployment, Options{
+		Name:        "hotdog-detector",
+		Namespace:   "models",
+		Image:       "registry.example.com/hotdog-detector",
+		MinReplicas: &minReplicas,
+	})
+	require.NoError(t, err)
+	require.Contains(t, string(manifest), `kind: SeldonDeployment`)
+	require.Contains(t, string(manifest), `  namespace: models`)
+	require.Contains(t, string(manifest), `    replicas: 2`)
+	require.NotContains(t, string(manifest), `nvidia.com/gpu`)
+	require.NotContains(t, string(manifest), `hpaSpec`)
+}
+
+func TestManifestResources(t *testing.T) {
+	cfg, err := config.FromYAML([]byte(`
+build:
+  gpu: true
+predict: predict.py:Predictor
+resources:
+  cpu: 4
+  memory: 16GB
+  gpu_memory: 40GB
+  disk: 50GB
+`))
+	require.NoError(t, err)
+	opts := OptionsFromConfig(cfg, "hotdog-detector", "registry.example.com/hotdog-detector:v1")
+	for _, kind := range Kinds {
+		manifest, err := Manifest(kind, opts)
+		require.NoError(t, err)
+		for _, line := range []string{
+			`cpu: "4"`,
+			`ephemeral-storage: 47684Mi`,
+			`memory: 15259Mi`,
+			`key: nvidia.com/gpu.memory`,
+			`operator: Gt`,
+			`- "38146"`,
+		} {
+			require.Contains(t, string(manifest), line, kind)
+		}
+	}
+}
+
+func TestManifestUnknownKind(t *testing.T) {
+	_, err := Manifest("deployment", Options{})
+	require.Error(t, err)
+}
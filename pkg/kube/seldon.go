@@ -0,0 +1,92 @@
+package kube
+
+import (
+	"strconv"
+)
+
+type seldonDeploymentManifest struct {
+	APIVersion string               `json:"apiVersion"`
+	Kind       string               `json:"kind"`
+	Metadata   objectMeta           `json:"metadata"`
+	Spec       seldonDeploymentSpec `json:"spec"`
+}
+
+type seldonDeploymentSpec struct {
+	Protocol   string            `json:"protocol"`
+	Predictors []seldonPredictor `json:"predictors"`
+}
+
+type seldonPredictor struct {
+	Name           string                `json:"name"`
+	Replicas       *int                  `json:"replicas,omitempty"`
+	ComponentSpecs []seldonComponentSpec `json:"componentSpecs"`
+	Graph          seldonGraph           `json:"graph"`
+}
+
+type seldonComponentSpec struct {
+	HPASpec *seldonHPASpec `json:"hpaSpec,omitempty"`
+	Spec    seldonPodSpec  `json:"spec"`
+}
+
+type seldonHPASpec struct {
+	MinReplicas *int `json:"minReplicas,omitempty"`
+	MaxReplicas int  `json:"maxReplicas"`
+}
+
+type seldonPodSpec struct {
+	TerminationGracePeriodSeconds int         `json:"terminationGracePeriodSeconds,omitempty"`
+	Containers                    []container `json:"containers"`
+	Affinity                      *affinity   `json:"affinity,omitempty"`
+}
+
+type seldonGraph struct {
+	Name     string         `json:"name"`
+	Type     string         `json:"type"`
+	Endpoint seldonEndpoint `json:"endpoint"`
+}
+
+type seldonEndpoint struct {
+	Type     string `json:"type"`
+	HTTPPort int    `json:"httpPort"`
+}
+
+func seldonDeployment(opts Options) seldonDeploymentManifest {
+	componentSpec := seldonComponentSpec{
+		Spec: seldonPodSpec{
+			TerminationGracePeriodSeconds: opts.TerminationGracePeriodSeconds,
+			Containers:                    []container{modelContainer(opts, "model", "http")},
+			Affinity:                      gpuMemoryAffinity(opts),
+		},
+	}
+	predictor := seldonPredictor{
+		Name:           "default",
+		ComponentSpecs: []seldonComponentSpec{componentSpec},
+		Graph: seldonGraph{
+			Name:     "model",
+			Type:     "MODEL",
+			Endpoint: seldonEndpoint{Type: "REST", HTTPPort: containerPort},
+		},
+	}
+	// Seldon only autoscales when there is a maximum, otherwise it runs a fixed number of replicas
+	if opts.MaxReplicas != nil {
+		predictor.ComponentSpecs[0].HPASpec = &seldonHPASpec{MinReplicas: opts.MinReplicas, MaxReplicas: *opts.MaxReplicas}
+	} else {
+		predictor.Replicas = opts.MinReplicas
+	}
+
+	var annotations map[string]string
+	if opts.TimeoutSeconds > 0 {
+		// In milliseconds
+		annotations = map[string]string{"seldon.io/rest-timeout": strconv.Itoa(opts.TimeoutSeconds * 1000)}
+	}
+
+	return seldonDeploymentManifest{
+		APIVersion: "machinelearning.seldon.io/v1",
+		Kind:       "SeldonDeployment",
+		Metadata:   metadata(opts, annotations),
+		Spec: seldonDeploymentSpec{
+			Protocol:   "seldon",
+			Predictors: []seldonPredictor{predictor},
+		},
+	}
+}
@@ -0,0 +1,259 @@
+// Package licenses classifies the licenses of the packages installed in a model's image,
+// and checks them against a license policy
+package licenses
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/replicate/cog/pkg/util/slices"
+)
+
+// Package is a Python or system package installed in an image, and the license it declares
+type Package struct {
+	// Type is "pip" or "apt"
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	// License is the license as the package declares it, which may be an SPDX expression or free text
+	License string `json:"license"`
+}
+
+// Families of licenses, from least to most restrictive
+const (
+	FamilyPermissive      = "permissive"
+	FamilyWeakCopyleft    = "weak-copyleft"
+	FamilyStrongCopyleft  = "strong-copyleft"
+	FamilyNetworkCopyleft = "network-copyleft"
+	FamilyNonCommercial   = "non-commercial"
+	FamilyUnknown         = "unknown"
+)
+
+// Families are all the license families a policy can deny
+var Families = []string{FamilyPermissive, FamilyWeakCopyleft, FamilyStrongCopyleft, FamilyNetworkCopyleft, FamilyNonCommercial, FamilyUnknown}
+
+// aliases maps the names packages commonly use for their licenses, lowercased, to SPDX identifiers
+var aliases = map[string]string{
+	"mit":                                  "MIT",
+	"mit license":                          "MIT",
+	"expat":                                "MIT",
+	"apache":                               "Apache-2.0",
+	"apache 2":                             "Apache-2.0",
+	"apache 2.0":                           "Apache-2.0",
+	"apache-2":                             "Apache-2.0",
+	"apache license 2.0":                   "Apache-2.0",
+	"apache license, version 2.0":          "Apache-2.0",
+	"apache license version 2.0":           "Apache-2.0",
+	"apache software license":              "Apache-2.0",
+	"apache software license 2.0":          "Apache-2.0",
+	"bsd":                                  "BSD-3-Clause",
+	"bsd license":                          "BSD-3-Clause",
+	"new bsd":                              "BSD-3-Clause",
+	"new bsd license":                      "BSD-3-Clause",
+	"3-clause bsd":                         "BSD-3-Clause",
+	"bsd 3-clause":                         "BSD-3-Clause",
+	"simplified bsd":                       "BSD-2-Clause",
+	"bsd 2-clause":                         "BSD-2-Clause",
+	"bsd-2-clause":                         "BSD-2-Clause",
+	"bsd-3-clause":                         "BSD-3-Clause",
+	"isc license (iscl)":                   "ISC",
+	"isc license":                          "ISC",
+	"python software foundation license":   "PSF-2.0",
+	"psf":                                  "PSF-2.0",
+	"psfl":                                 "PSF-2.0",
+	"zlib/libpng license":                  "Zlib",
+	"the unlicense (unlicense)":            "Unlicense",
+	"public domain":                        "LicenseRef-Public-Domain",
+	"public-domain":                        "LicenseRef-Public-Domain",
+	"mozilla public license 2.0 (mpl 2.0)": "MPL-2.0",
+	"mpl 2.0":                              "MPL-2.0",
+	"eclipse public license 2.0 (epl-2.0)": "EPL-2.0",
+	"historical permission notice and disclaimer (hpnd)":      "HPND",
+	"gnu lesser general public license v2 (lgplv2)":           "LGPL-2.0-only",
+	"gnu lesser general public license v2 or later (lgplv2+)": "LGPL-2.0-or-later",
+	"gnu lesser general public license v3 (lgplv3)":           "LGPL-3.0-only",
+	"gnu lesser general public license v3 or later (lgplv3+)": "LGPL-3.0-or-later",
+	"gnu library or lesser general public license (lgpl)":     "LGPL-2.0-or-later",
+	"gnu general public license (gpl)":                        "GPL-2.0-or-later",
+	"gnu general public license v2 (gplv2)":                   "GPL-2.0-only",
+	"gnu general public license v2 or later (gplv2+)":         "GPL-2.0-or-later",
+	"gnu general public license v3 (gplv3)":                   "GPL-3.0-only",
+	"gnu general public license v3 or later (gplv3+)":         "GPL-3.0-or-later",
+	"gnu affero general public license v3":                    "AGPL-3.0-only",
+	"gnu affero general public license v3 or later (agplv3+)": "AGPL-3.0-or-later",
+	"gpl":  "GPL-2.0-or-later",
+	"lgpl": "LGPL-2.0-or-later",
+}
+
+// gnuShortName matches the short names Debian uses for GNU licenses, e.g. GPL-2+ or LGPL-2.1
+var gnuShortName = regexp.MustCompile(`(?i)^(a|l)?gpl-?(\d)(\.\d)?(\+)?$`)
+
+// Normalize returns the SPDX identifier for a single license, or an empty string if it isn't recognized
+func Normalize(license string) string {
+	license = strings.TrimSpace(license)
+	if id, ok := aliases[strings.ToLower(license)]; ok {
+		return id
+	}
+	// Parentheses around a part of an expression, e.g. "(MIT" in "(MIT OR Apache-2.0)"
+	license = strings.TrimSpace(strings.Trim(license, "()"))
+	if license == "" {
+		return ""
+	}
+	if id, ok := aliases[strings.ToLower(license)]; ok {
+		return id
+	}
+	if m := gnuShortName.FindStringSubmatch(license); m != nil {
+		version := m[2] + m[3]
+		if m[3] == "" {
+			version += ".0"
+		}
+		suffix := "-only"
+		if m[4] != "" {
+			suffix = "-or-later"
+		}
+		return strings.ToUpper(m[1]) + "GPL-" + version + suffix
+	}
+	if Family(license) != FamilyUnknown {
+		return license
+	}
+	return ""
+}
+
+// Family returns the family of the license with the SPDX identifier id
+func Family(id string) string {
+	upper := strings.ToUpper(id)
+	switch {
+	case upper == "":
+		return FamilyUnknown
+	case strings.HasPrefix(upper, "AGPL-"):
+		return FamilyNetworkCopyleft
+	case strings.HasPrefix(upper, "GPL-"):
+		return FamilyStrongCopyleft
+	case strings.HasPrefix(upper, "CC-BY-NC"):
+		return FamilyNonCommercial
+	case strings.HasPrefix(upper, "LGPL-"), strings.HasPrefix(upper, "MPL-"), strings.HasPrefix(upper, "EPL-"),
+		strings.HasPrefix(upper, "CDDL-"), strings.HasPrefix(upper, "CC-BY-SA-"):
+		return FamilyWeakCopyleft
+	case upper == "MIT", upper == "ISC", upper == "ZLIB", upper == "0BSD", upper == "HPND", upper == "UNLICENSE",
+		upper == "CC0-1.0", upper == "PSF-2.0", upper == "PYTHON-2.0", upper == "LICENSEREF-PUBLIC-DOMAIN",
+		strings.HasPrefix(upper, "APACHE-"), strings.HasPrefix(upper, "BSD-"), strings.HasPrefix(upper, "CC-BY-"),
+		strings.HasPrefix(upper, "ARTISTIC-"):
+		return FamilyPermissive
+	}
+	return FamilyUnknown
+}
+
+// Alternatives splits a license expression into the alternatives the package can be used under,
+// each of which is a list of licenses that all apply, e.g. "MIT OR (GPL-2.0 AND BSD-3-Clause)"
+// is [[MIT] [GPL-2.0 BSD-3-Clause]]. Licenses are normalized to SPDX identifiers, or an empty
+// string if they aren't recognized.
+func Alternatives(expression string) [][]string {
+	result := [][]string{}
+	for _, alternative := range strings.Split(expression, " OR ") {
+		ids := []string{}
+		for _, license := range strings.Split(alternative, " AND ") {
+			ids = append(ids, Normalize(license))
+		}
+		result = append(result, ids)
+	}
+	return result
+}
+
+// SPDXExpression returns the license of pkg as an SPDX license expression, or an empty string
+// if any of its licenses aren't recognized
+func (p Package) SPDXExpression() string {
+	alternatives := []string{}
+	for _, ids := range Alternatives(p.License) {
+		for _, id := range ids {
+			if id == "" {
+				return ""
+			}
+		}
+		expression := strings.Join(ids, " AND ")
+		if len(ids) > 1 && len(alternatives) > 0 {
+			expression = "(" + expression + ")"
+		}
+		alternatives = append(alternatives, expression)
+	}
+	return strings.Join(alternatives, " OR ")
+}
+
+// Violation is a package that has a denied license
+type Violation struct {
+	Package Package
+	// Denied are the policy entries that the package's license matched
+	Denied []string
+}
+
+func (v Violation) String() string {
+	license := v.Package.License
+	if license == "" {
+		license = "no license"
+	}
+	return fmt.Sprintf("%s package %s %s (%s) is denied by %s", v.Package.Type, v.Package.Name, v.Package.Version, license, strings.Join(v.Denied, ", "))
+}
+
+// Check returns the packages whose licenses are denied by deny, which is a list of license
+// families or SPDX identifiers. A package that can be used under any of several licenses is
+// only denied if all of them are. Packages named in ignore are never denied.
+func Check(packages []Package, deny []string, ignore []string) []Violation {
+	ignored := map[string]bool{}
+	for _, name := range ignore {
+		ignored[strings.ToLower(name)] = true
+	}
+
+	violations := []Violation{}
+	for _, pkg := range packages {
+		if ignored[strings.ToLower(pkg.Name)] {
+			continue
+		}
+		var denied []string
+		allowed := false
+		for _, ids := range Alternatives(pkg.License) {
+			matched := deniedBy(ids, deny)
+			if len(matched) == 0 {
+				allowed = true
+				break
+			}
+			denied = appendUnique(denied, matched...)
+		}
+		if !allowed {
+			violations = append(violations, Violation{Package: pkg, Denied: denied})
+		}
+	}
+	return violations
+}
+
+// deniedBy returns the entries in deny that match any of the licenses in ids
+func deniedBy(ids []string, deny []string) []string {
+	matched := []string{}
+	for _, id := range ids {
+		family := Family(id)
+		for _, entry := range deny {
+			if strings.EqualFold(entry, family) || matchesID(id, entry) {
+				matched = appendUnique(matched, entry)
+			}
+		}
+	}
+	return matched
+}
+
+// matchesID returns whether the SPDX identifier id is entry, or a variant of it, e.g. GPL-3.0-or-later
+// matches GPL-3.0 and GPL
+func matchesID(id string, entry string) bool {
+	if id == "" {
+		return false
+	}
+	id, entry = strings.ToLower(id), strings.ToLower(entry)
+	return id == entry || strings.HasPrefix(id, entry+"-") || strings.HasPrefix(id, entry+".")
+}
+
+func appendUnique(list []string, items ...string) []string {
+	for _, item := range items {
+		if !slices.ContainsString(list, item) {
+			list = append(list, item)
+		}
+	}
+	return list
+}
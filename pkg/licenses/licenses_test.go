@@ -0,0 +1,70 @@
+package licenses
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalize(t *testing.T) {
+	for license, expected := range map[string]string{
+		"MIT":                                   "MIT",
+		"MIT License":                           "MIT",
+		"Apache Software License":               "Apache-2.0",
+		"Apache-2.0":                            "Apache-2.0",
+		"BSD License":                           "BSD-3-Clause",
+		"Expat":                                 "MIT",
+		"GPL-2+":                                "GPL-2.0-or-later",
+		"LGPL-2.1":                              "LGPL-2.1-only",
+		"GNU General Public License v3 (GPLv3)": "GPL-3.0-only",
+		"(MIT":                                  "MIT",
+		"Some custom license":                   "",
+		"":                                      "",
+	} {
+		require.Equal(t, expected, Normalize(license), license)
+	}
+}
+
+func TestFamily(t *testing.T) {
+	require.Equal(t, FamilyPermissive, Family("MIT"))
+	require.Equal(t, FamilyPermissive, Family("BSD-2-Clause"))
+	require.Equal(t, FamilyWeakCopyleft, Family("LGPL-3.0-only"))
+	require.Equal(t, FamilyWeakCopyleft, Family("MPL-2.0"))
+	require.Equal(t, FamilyStrongCopyleft, Family("GPL-3.0-or-later"))
+	require.Equal(t, FamilyNetworkCopyleft, Family("AGPL-3.0-only"))
+	require.Equal(t, FamilyNonCommercial, Family("CC-BY-NC-SA-4.0"))
+	require.Equal(t, FamilyUnknown, Family(""))
+}
+
+func TestSPDXExpression(t *testing.T) {
+	require.Equal(t, "MIT OR Apache-2.0", Package{License: "MIT License OR Apache Software License"}.SPDXExpression())
+	require.Equal(t, "GPL-2.0-or-later AND BSD-3-Clause", Package{License: "GPL-2+ AND BSD-3-clause"}.SPDXExpression())
+	require.Equal(t, "", Package{License: "MIT OR Custom"}.SPDXExpression())
+}
+
+func TestCheck(t *testing.T) {
+	packages := []Package{
+		{Type: "pip", Name: "requests", Version: "2.31.0", License: "Apache 2.0"},
+		{Type: "pip", Name: "dual", Version: "1.0", License: "GPL-3.0-only OR MIT"},
+		{Type: "pip", Name: "gpl-thing", Version: "1.0", License: "GNU General Public License v3 (GPLv3)"},
+		{Type: "pip", Name: "mystery", Version: "0.1", License: ""},
+		{Type: "apt", Name: "ffmpeg", Version: "7:4.4.2", License: "LGPL-2.1+ AND GPL-2+"},
+		{Type: "apt", Name: "libfoo", Version: "1.0", License: "AGPL-3+"},
+	}
+
+	violations := Check(packages, []string{FamilyStrongCopyleft, FamilyNetworkCopyleft}, []string{"FFmpeg"})
+	names := []string{}
+	for _, v := range violations {
+		names = append(names, v.Package.Name)
+	}
+	require.Equal(t, []string{"gpl-thing", "libfoo"}, names)
+	require.Equal(t, []string{FamilyStrongCopyleft}, violations[0].Denied)
+	require.Equal(t, "pip package gpl-thing 1.0 (GNU General Public License v3 (GPLv3)) is denied by strong-copyleft", violations[0].String())
+
+	violations = Check(packages, []string{"GPL", FamilyUnknown}, nil)
+	names = []string{}
+	for _, v := range violations {
+		names = append(names, v.Package.Name)
+	}
+	require.Equal(t, []string{"gpl-thing", "mystery", "ffmpeg"}, names)
+}
@@ -0,0 +1,164 @@
+package licenses
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/replicate/cog/pkg/global"
+)
+
+const noAssertion = "NOASSERTION"
+
+// SBOM is a software bill of materials for a model's image, in SPDX 2.3 JSON format
+type SBOM struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      SBOMCreationInfo   `json:"creationInfo"`
+	Packages          []SBOMPackage      `json:"packages"`
+	Relationships     []SBOMRelationship `json:"relationships"`
+}
+
+type SBOMCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type SBOMPackage struct {
+	SPDXID                string            `json:"SPDXID"`
+	Name                  string            `json:"name"`
+	VersionInfo           string            `json:"versionInfo,omitempty"`
+	DownloadLocation      string            `json:"downloadLocation"`
+	FilesAnalyzed         bool              `json:"filesAnalyzed"`
+	LicenseConcluded      string            `json:"licenseConcluded"`
+	LicenseDeclared       string            `json:"licenseDeclared"`
+	LicenseComments       string            `json:"licenseComments,omitempty"`
+	PrimaryPackagePurpose string            `json:"primaryPackagePurpose,omitempty"`
+	ExternalRefs          []SBOMExternalRef `json:"externalRefs,omitempty"`
+}
+
+type SBOMExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type SBOMRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+// invalidSPDXIDChars are the characters that can't be used in an SPDXID
+var invalidSPDXIDChars = regexp.MustCompile(`[^A-Za-z0-9.-]`)
+
+// NewSBOM returns an SBOM for the model called name, which is released under modelLicense and its weights
+// under weightsLicense, and has packages installed. The licenses can be empty if they're not known.
+func NewSBOM(name string, modelLicense string, weightsLicense string, packages []Package, created time.Time) *SBOM {
+	model := SBOMPackage{
+		SPDXID:                "SPDXRef-Model",
+		Name:                  name,
+		DownloadLocation:      noAssertion,
+		LicenseConcluded:      orNoAssertion(modelLicense),
+		LicenseDeclared:       orNoAssertion(modelLicense),
+		PrimaryPackagePurpose: "CONTAINER",
+	}
+	sbom := &SBOM{
+		SPDXVersion: "SPDX-2.3",
+		DataLicense: "CC0-1.0",
+		SPDXID:      "SPDXRef-DOCUMENT",
+		Name:        name,
+		CreationInfo: SBOMCreationInfo{
+			Created:  created.UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: cog-" + global.Version},
+		},
+		Packages: []SBOMPackage{model},
+		Relationships: []SBOMRelationship{{
+			SPDXElementID:      "SPDXRef-DOCUMENT",
+			RelationshipType:   "DESCRIBES",
+			RelatedSPDXElement: model.SPDXID,
+		}},
+	}
+
+	if weightsLicense != "" {
+		weights := SBOMPackage{
+			SPDXID:                "SPDXRef-Weights",
+			Name:                  name + "-weights",
+			DownloadLocation:      noAssertion,
+			LicenseConcluded:      weightsLicense,
+			LicenseDeclared:       weightsLicense,
+			PrimaryPackagePurpose: "DATA",
+		}
+		sbom.Packages = append(sbom.Packages, weights)
+		sbom.Relationships = append(sbom.Relationships, SBOMRelationship{
+			SPDXElementID:      model.SPDXID,
+			RelationshipType:   "CONTAINS",
+			RelatedSPDXElement: weights.SPDXID,
+		})
+	}
+
+	for _, pkg := range packages {
+		p := SBOMPackage{
+			SPDXID:           fmt.Sprintf("SPDXRef-%s-%s", pkg.Type, invalidSPDXIDChars.ReplaceAllString(pkg.Name, "-")),
+			Name:             pkg.Name,
+			VersionInfo:      pkg.Version,
+			DownloadLocation: noAssertion,
+			LicenseConcluded: noAssertion,
+			LicenseDeclared:  orNoAssertion(pkg.SPDXExpression()),
+			ExternalRefs: []SBOMExternalRef{{
+				ReferenceCategory: "PACKAGE-MANAGER",
+				ReferenceType:     "purl",
+				ReferenceLocator:  purl(pkg),
+			}},
+		}
+		// Keep the license as the package declared it if it couldn't be turned into SPDX
+		if p.LicenseDeclared == noAssertion && pkg.License != "" {
+			p.LicenseComments = pkg.License
+		}
+		sbom.Packages = append(sbom.Packages, p)
+		sbom.Relationships = append(sbom.Relationships, SBOMRelationship{
+			SPDXElementID:      model.SPDXID,
+			RelationshipType:   "DEPENDS_ON",
+			RelatedSPDXElement: p.SPDXID,
+		})
+	}
+
+	// The namespace has to be unique for each document, so derive it from the contents
+	hash := sha256.New()
+	_ = json.NewEncoder(hash).Encode(sbom)
+	sbom.DocumentNamespace = fmt.Sprintf("https://cog.run/spdx/%s-%s", invalidSPDXIDChars.ReplaceAllString(name, "-"), hex.EncodeToString(hash.Sum(nil))[:16])
+
+	return sbom
+}
+
+// purl returns the package URL of pkg
+func purl(pkg Package) string {
+	kind := "pypi"
+	if pkg.Type == "apt" {
+		kind = "deb"
+	}
+	name := pkg.Name
+	if kind == "pypi" {
+		// PyPI names are case insensitive, so package URLs use lower case
+		name = strings.ToLower(name)
+	}
+	result := fmt.Sprintf("pkg:%s/%s", kind, name)
+	if pkg.Version != "" {
+		result += "@" + pkg.Version
+	}
+	return result
+}
+
+func orNoAssertion(s string) string {
+	if s == "" {
+		return noAssertion
+	}
+	return s
+}
@@ -0,0 +1,39 @@
+package licenses
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSBOM(t *testing.T) {
+	packages := []Package{
+		{Type: "pip", Name: "PyYAML", Version: "6.0.1", License: "MIT License"},
+		{Type: "apt", Name: "ffmpeg", Version: "7:4.4.2", License: "Custom"},
+	}
+	sbom := NewSBOM("hotdog-detector", "Apache-2.0", "CC-BY-NC-4.0", packages, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+
+	require.Equal(t, "SPDX-2.3", sbom.SPDXVersion)
+	require.Equal(t, "2024-01-02T03:04:05Z", sbom.CreationInfo.Created)
+	require.Regexp(t, `^https://cog.run/spdx/hotdog-detector-[0-9a-f]{16}$`, sbom.DocumentNamespace)
+
+	require.Len(t, sbom.Packages, 4)
+	require.Equal(t, "SPDXRef-Model", sbom.Packages[0].SPDXID)
+	require.Equal(t, "Apache-2.0", sbom.Packages[0].LicenseDeclared)
+	require.Equal(t, "SPDXRef-Weights", sbom.Packages[1].SPDXID)
+	require.Equal(t, "CC-BY-NC-4.0", sbom.Packages[1].LicenseDeclared)
+
+	pyyaml := sbom.Packages[2]
+	require.Equal(t, "SPDXRef-pip-PyYAML", pyyaml.SPDXID)
+	require.Equal(t, "MIT", pyyaml.LicenseDeclared)
+	require.Equal(t, "pkg:pypi/pyyaml@6.0.1", pyyaml.ExternalRefs[0].ReferenceLocator)
+
+	ffmpeg := sbom.Packages[3]
+	require.Equal(t, noAssertion, ffmpeg.LicenseDeclared)
+	require.Equal(t, "Custom", ffmpeg.LicenseComments)
+	require.Equal(t, "pkg:deb/ffmpeg@7:4.4.2", ffmpeg.ExternalRefs[0].ReferenceLocator)
+
+	require.Len(t, sbom.Relationships, 4)
+	require.Equal(t, SBOMRelationship{SPDXElementID: "SPDXRef-Model", RelationshipType: "DEPENDS_ON", RelatedSPDXElement: "SPDXRef-apt-ffmpeg"}, sbom.Relationships[3])
+}
@@ -0,0 +1,146 @@
+package outdated
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// osvURL is OSV's API for the known vulnerabilities in a version of a package
+var osvURL = "https://api.osv.dev/v1/query"
+
+// Severities, from least to most urgent
+var severities = []string{"", SeverityLow, SeverityModerate, SeverityHigh, SeverityCritical}
+
+const (
+	SeverityLow      = "low"
+	SeverityModerate = "moderate"
+	SeverityHigh     = "high"
+	SeverityCritical = "critical"
+)
+
+// Vulnerability is a known vulnerability in a version of a package
+type Vulnerability struct {
+	// ID is the ID of the advisory, e.g. GHSA-xxxx-xxxx-xxxx or PYSEC-2024-1, and Aliases are its CVE IDs
+	ID      string
+	Aliases []string
+	Summary string
+	// Severity is low, moderate, high or critical, or empty if it isn't known
+	Severity string
+	// Fixed is the first version after the vulnerable one that fixes it, or empty if it isn't fixed
+	Fixed string
+}
+
+type osvQuery struct {
+	Version string `json:"version"`
+	Package struct {
+		Name      string `json:"name"`
+		Ecosystem string `json:"ecosystem"`
+	} `json:"package"`
+}
+
+type osvResponse struct {
+	Vulns []struct {
+		ID               string   `json:"id"`
+		Aliases          []string `json:"aliases"`
+		Summary          string   `json:"summary"`
+		DatabaseSpecific struct {
+			Severity string `json:"severity"`
+		} `json:"database_specific"`
+		Affected []struct {
+			Package struct {
+				Name      string `json:"name"`
+				Ecosystem string `json:"ecosystem"`
+			} `json:"package"`
+			Ranges []struct {
+				Events []map[string]string `json:"events"`
+			} `json:"ranges"`
+		} `json:"affected"`
+	} `json:"vulns"`
+}
+
+// vulnerabilities returns the known vulnerabilities in version of the PyPI package name
+func vulnerabilities(ctx context.Context, name string, version string) ([]Vulnerability, error) {
+	query := osvQuery{Version: version}
+	query.Package.Name = name
+	query.Package.Ecosystem = "PyPI"
+	body, err := json.Marshal(query)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, osvURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("OSV returned %s", resp.Status)
+	}
+	result := &osvResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return nil, fmt.Errorf("Failed to parse OSV response: %w", err)
+	}
+
+	vulns := []Vulnerability{}
+	for _, v := range result.Vulns {
+		vuln := Vulnerability{ID: v.ID, Summary: v.Summary, Severity: normalizeSeverity(v.DatabaseSpecific.Severity)}
+		for _, alias := range v.Aliases {
+			if strings.HasPrefix(alias, "CVE-") {
+				vuln.Aliases = append(vuln.Aliases, alias)
+			}
+		}
+		for _, affected := range v.Affected {
+			if !strings.EqualFold(affected.Package.Ecosystem, "PyPI") {
+				continue
+			}
+			for _, r := range affected.Ranges {
+				for _, event := range r.Events {
+					fixed := event["fixed"]
+					if fixed != "" && compareVersions(fixed, version) > 0 && (vuln.Fixed == "" || compareVersions(fixed, vuln.Fixed) < 0) {
+						vuln.Fixed = fixed
+					}
+				}
+			}
+		}
+		vulns = append(vulns, vuln)
+	}
+	return vulns, nil
+}
+
+// normalizeSeverity returns the severity in an advisory as one of the Severity constants, e.g. moderate for
+// MODERATE or medium
+func normalizeSeverity(severity string) string {
+	switch strings.ToLower(severity) {
+	case "low":
+		return SeverityLow
+	case "moderate", "medium":
+		return SeverityModerate
+	case "high":
+		return SeverityHigh
+	case "critical":
+		return SeverityCritical
+	}
+	return ""
+}
+
+// moreSevere returns whether severity a is more urgent than b
+func moreSevere(a string, b string) bool {
+	return severityRank(a) > severityRank(b)
+}
+
+func severityRank(severity string) int {
+	for i, s := range severities {
+		if s == severity {
+			return i
+		}
+	}
+	return 0
+}
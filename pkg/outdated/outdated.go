@@ -0,0 +1,217 @@
+// Package outdated checks a model's Python packages and CUDA version against the latest releases that are
+// compatible with it, and updates the versions they're pinned to
+package outdated
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/util/slices"
+	"github.com/replicate/cog/pkg/util/version"
+)
+
+// torchPackages are released together, and are only updated to versions in Cog's compatibility matrix
+var torchPackages = []string{"torch", "torchvision", "torchaudio"}
+
+// Package is a Python package in cog.yaml or the requirements file, and the latest version it can be updated to
+type Package struct {
+	Name string
+	// Current is the version it's pinned to with ==, or empty if it isn't pinned
+	Current string
+	// Latest is the latest release that works with the model's Python and CUDA versions, or empty if it isn't
+	// known
+	Latest string
+	// Note says why Latest isn't the latest release, if it's held back to stay compatible
+	Note string
+	// Vulnerabilities are the known vulnerabilities in Current
+	Vulnerabilities []Vulnerability
+}
+
+// Outdated returns whether there's a later compatible release than the pinned version
+func (p *Package) Outdated() bool {
+	return p.Current != "" && p.Latest != "" && compareVersions(p.Latest, p.Current) > 0
+}
+
+// Urgency returns the severity of the most severe known vulnerability in the pinned version, or an empty string
+// if it doesn't have any. Vulnerabilities whose severity isn't known are moderate.
+func (p *Package) Urgency() string {
+	urgency := ""
+	for _, v := range p.Vulnerabilities {
+		severity := v.Severity
+		if severity == "" {
+			severity = SeverityModerate
+		}
+		if moreSevere(severity, urgency) {
+			urgency = severity
+		}
+	}
+	return urgency
+}
+
+// CUDA is the model's CUDA version, and the latest one its version of torch is built for
+type CUDA struct {
+	Current string
+	Latest  string
+	// Torch is the version of torch that Latest was picked for
+	Torch string
+}
+
+// Report is what Check found
+type Report struct {
+	Packages []*Package
+	// CUDA is set if there's a later CUDA base image the model can use
+	CUDA *CUDA
+}
+
+// Check returns the latest compatible releases of the Python packages of the model configured by cfg in
+// projectDir, and the known vulnerabilities in the versions they're pinned to
+func Check(ctx context.Context, cfg *config.Config, projectDir string) (*Report, error) {
+	requirements, err := Requirements(cfg, projectDir)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{}
+	pinned := map[string]string{}
+	for _, requirement := range requirements {
+		name, current := parseRequirement(requirement)
+		if name == "" || findPackage(report.Packages, name) != nil {
+			continue
+		}
+		report.Packages = append(report.Packages, &Package{Name: name, Current: current})
+		pinned[name] = current
+	}
+
+	torch := latestTorch(cfg, pinned["torch"])
+	for _, p := range report.Packages {
+		if slices.ContainsString(torchPackages, p.Name) {
+			p.Latest, p.Note = latestTorchPackage(torch, p.Name)
+		} else if p.Latest, err = latestOnPyPI(ctx, p.Name, cfg.Build.PythonVersion); err != nil {
+			return nil, fmt.Errorf("Failed to check the releases of %s on PyPI: %w", p.Name, err)
+		}
+		if p.Current == "" {
+			continue
+		}
+		if p.Vulnerabilities, err = vulnerabilities(ctx, p.Name, p.Current); err != nil {
+			return nil, fmt.Errorf("Failed to check %s %s for vulnerabilities: %w", p.Name, p.Current, err)
+		}
+	}
+
+	if cfg.Build.GPU && cfg.Build.CUDA != "" {
+		torchVersion := pinned["torch"]
+		if torch != nil && (torchVersion == "" || compareVersions(torch.TorchVersion(), torchVersion) > 0) {
+			torchVersion = torch.TorchVersion()
+		}
+		if latest := latestCUDAForTorch(torchVersion); latest != "" && version.Greater(latest, cfg.Build.CUDA) {
+			report.CUDA = &CUDA{Current: cfg.Build.CUDA, Latest: latest, Torch: torchVersion}
+		}
+	}
+	return report, nil
+}
+
+// Requirements returns the lines of the model's Python requirements: python_packages_stable, and
+// python_packages or the file in python_requirements
+func Requirements(cfg *config.Config, projectDir string) ([]string, error) {
+	requirements := append(append([]string{}, cfg.Build.PythonPackagesStable...), cfg.Build.PythonPackages...)
+	if cfg.Build.PythonRequirements == "" {
+		return requirements, nil
+	}
+	f, err := os.Open(filepath.Join(projectDir, cfg.Build.PythonRequirements))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read %s: %w", cfg.Build.PythonRequirements, err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		requirements = append(requirements, scanner.Text())
+	}
+	return requirements, scanner.Err()
+}
+
+// requirementRe matches a package in a requirements.txt line, with the version if it's pinned with ==
+var requirementRe = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9._-]*)(\[[^\]]*\])?\s*(==\s*([^\s;#,]+))?`)
+
+// parseRequirement returns the normalized name of the package in a requirements.txt line, and the version it's
+// pinned to, if it is. name is empty if the line isn't a package, e.g. it's an option or a comment.
+func parseRequirement(requirement string) (name string, pinned string) {
+	match := requirementRe.FindStringSubmatch(strings.TrimSpace(requirement))
+	if match == nil {
+		return "", ""
+	}
+	name = strings.ToLower(strings.NewReplacer("_", "-", ".", "-").Replace(match[1]))
+	// Only exact versions are pinned, not 2.* or versions that are also constrained in other ways, e.g. ==2.1,<3
+	if v := match[4]; !strings.Contains(requirement, ",") && !strings.Contains(v, "*") {
+		pinned = strings.SplitN(v, "+", 2)[0]
+	}
+	return name, pinned
+}
+
+func findPackage(packages []*Package, name string) *Package {
+	for _, p := range packages {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// latestTorch returns the latest release of torch in Cog's compatibility matrix that works with the model's Python
+// version and, on a GPU, has a build for its CUDA version, so torch can be updated without changing CUDA. If
+// current is later than all of them, it's kept.
+func latestTorch(cfg *config.Config, current string) *config.TorchCompatibility {
+	var latest *config.TorchCompatibility
+	for i, compat := range config.TorchCompatibilityMatrix {
+		if !slices.ContainsString(compat.Pythons, cfg.Build.PythonVersion) {
+			continue
+		}
+		if cfg.Build.GPU {
+			if compat.CUDA == nil || cfg.Build.CUDA == "" || !version.EqualMinor(*compat.CUDA, cfg.Build.CUDA) {
+				continue
+			}
+		} else if compat.CUDA != nil {
+			continue
+		}
+		if latest == nil || compareVersions(compat.TorchVersion(), latest.TorchVersion()) > 0 {
+			latest = &config.TorchCompatibilityMatrix[i]
+		}
+	}
+	if latest != nil && current != "" && compareVersions(current, latest.TorchVersion()) > 0 {
+		return nil
+	}
+	return latest
+}
+
+// latestTorchPackage returns the version of torch, torchvision or torchaudio that's released with torch
+func latestTorchPackage(torch *config.TorchCompatibility, name string) (latest string, note string) {
+	if torch == nil {
+		return "", ""
+	}
+	switch name {
+	case "torch":
+		return torch.TorchVersion(), ""
+	case "torchvision":
+		latest = torch.TorchvisionVersion()
+	case "torchaudio":
+		latest = strings.SplitN(torch.Torchaudio, "+", 2)[0]
+	}
+	return latest, "released with torch " + torch.TorchVersion()
+}
+
+// latestCUDAForTorch returns the latest CUDA version that torchVersion is built for, and Cog has a base image for
+func latestCUDAForTorch(torchVersion string) string {
+	latest := ""
+	for _, compat := range config.TorchCompatibilityMatrix {
+		if compat.CUDA == nil || compat.TorchVersion() != torchVersion {
+			continue
+		}
+		if latest == "" || version.Greater(*compat.CUDA, latest) {
+			latest = *compat.CUDA
+		}
+	}
+	return latest
+}
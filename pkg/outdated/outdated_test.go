@@ -0,0 +1,150 @@
+package outdated
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+func TestMatchesSpecifiers(t *testing.T) {
+	require.True(t, matchesSpecifiers("3.11", ">=3.8"))
+	require.False(t, matchesSpecifiers("3.7", ">=3.8"))
+	require.True(t, matchesSpecifiers("3.11", ">=3.8, <4"))
+	require.False(t, matchesSpecifiers("3.12", ">=3.8,!=3.12.*"))
+	require.True(t, matchesSpecifiers("3.11", "~=3.9"))
+	require.False(t, matchesSpecifiers("4.0", "~=3.9"))
+}
+
+func TestParseRequirement(t *testing.T) {
+	for _, tc := range []struct {
+		requirement string
+		name        string
+		pinned      string
+	}{
+		{"torch==2.1.0", "torch", "2.1.0"},
+		{"torch==2.1.0+cu121", "torch", "2.1.0"},
+		{"Pillow == 10.0.1  # images", "pillow", "10.0.1"},
+		{"huggingface_hub[cli]==0.20.1", "huggingface-hub", "0.20.1"},
+		{"numpy>=1.26", "numpy", ""},
+		{"numpy==1.*", "numpy", ""},
+		{"numpy==1.26.0,<2", "numpy", ""},
+		{"# a comment", "", ""},
+		{"--extra-index-url https://example.com", "", ""},
+	} {
+		name, pinned := parseRequirement(tc.requirement)
+		require.Equal(t, tc.name, name, tc.requirement)
+		require.Equal(t, tc.pinned, pinned, tc.requirement)
+	}
+}
+
+func TestApplyUpdates(t *testing.T) {
+	updates := []Update{{Name: "torch", From: "2.0.1", To: "2.1.0"}, {Name: "huggingface-hub", From: "0.19.0", To: "0.20.1"}}
+	cogYAML := `build:
+  python_packages:
+    - "torch==2.0.1+cu118" # keep this
+    - huggingface_hub==0.19.0
+    - torchvision==0.15.2
+    - numpy==2.0.10
+`
+	require.Equal(t, `build:
+  python_packages:
+    - "torch==2.1.0+cu118" # keep this
+    - huggingface_hub==0.20.1
+    - torchvision==0.15.2
+    - numpy==2.0.10
+`, applyUpdates(cogYAML, updates))
+
+	// A version that only starts with From isn't changed
+	require.Equal(t, "torch==2.0.10\n", applyUpdates("torch==2.0.10\n", updates))
+	require.Equal(t, "torch==2.1.0", applyUpdates("torch==2.0.1", updates))
+}
+
+func TestLatestTorch(t *testing.T) {
+	cfg := &config.Config{Build: &config.Build{PythonVersion: "3.10", GPU: true, CUDA: "11.8"}}
+	torch := latestTorch(cfg, "")
+	require.NotNil(t, torch)
+	require.NotNil(t, torch.CUDA)
+	require.Equal(t, "11.8", *torch.CUDA)
+	for _, compat := range config.TorchCompatibilityMatrix {
+		if compat.CUDA != nil && *compat.CUDA == "11.8" && strings.Contains(strings.Join(compat.Pythons, ","), "3.10") {
+			require.GreaterOrEqual(t, compareVersions(torch.TorchVersion(), compat.TorchVersion()), 0)
+		}
+	}
+
+	// A version of torch later than Cog knows about is kept
+	require.Nil(t, latestTorch(cfg, "99.0.0"))
+
+	latest, note := latestTorchPackage(torch, "torchvision")
+	require.Equal(t, torch.TorchvisionVersion(), latest)
+	require.Contains(t, note, torch.TorchVersion())
+}
+
+func TestCheck(t *testing.T) {
+	pypi := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/requests/json":
+			_, _ = w.Write([]byte(`{"releases": {
+				"2.30.0": [{"requires_python": ">=3.7"}],
+				"2.31.0": [{"requires_python": ">=3.7"}],
+				"2.32.0": [{"requires_python": ">=3.7", "yanked": true}],
+				"3.0.0": [{"requires_python": ">=3.12"}],
+				"3.1.0rc1": [{"requires_python": ">=3.7"}]
+			}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer pypi.Close()
+	osv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := osvQuery{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&query))
+		if query.Package.Name != "requests" || query.Version != "2.30.0" {
+			_, _ = w.Write([]byte(`{}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"vulns": [{
+			"id": "GHSA-j8r2-6x86-q33q",
+			"aliases": ["CVE-2023-32681", "PYSEC-2023-74"],
+			"database_specific": {"severity": "MODERATE"},
+			"affected": [{"package": {"name": "requests", "ecosystem": "PyPI"}, "ranges": [{"events": [{"introduced": "2.3.0"}, {"fixed": "2.31.0"}]}]}]
+		}]}`))
+	}))
+	defer osv.Close()
+	defer func(pypiOriginal, osvOriginal string) { pypiURL, osvURL = pypiOriginal, osvOriginal }(pypiURL, osvURL)
+	pypiURL, osvURL = pypi.URL, osv.URL
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "requirements.txt"), []byte("requests==2.30.0\nnot-on-pypi\n"), 0o644))
+	cfg := &config.Config{Build: &config.Build{PythonVersion: "3.11", PythonRequirements: "requirements.txt"}}
+	report, err := Check(context.Background(), cfg, dir)
+	require.NoError(t, err)
+	require.Nil(t, report.CUDA)
+	require.Len(t, report.Packages, 2)
+
+	requests := report.Packages[0]
+	require.Equal(t, "2.31.0", requests.Latest)
+	require.True(t, requests.Outdated())
+	require.Equal(t, SeverityModerate, requests.Urgency())
+	require.Equal(t, []Vulnerability{{ID: "GHSA-j8r2-6x86-q33q", Aliases: []string{"CVE-2023-32681"}, Severity: SeverityModerate, Fixed: "2.31.0"}}, requests.Vulnerabilities)
+	require.Equal(t, &Package{Name: "not-on-pypi"}, report.Packages[1])
+
+	changed, err := Apply(cfg, dir, Updates(report))
+	require.Error(t, err, "there isn't a cog.yaml")
+	require.Nil(t, changed)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cog.yaml"), []byte("build:\n  python_requirements: requirements.txt\n"), 0o644))
+	changed, err = Apply(cfg, dir, Updates(report))
+	require.NoError(t, err)
+	require.Equal(t, []string{"requirements.txt"}, changed)
+	contents, err := os.ReadFile(filepath.Join(dir, "requirements.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "requests==2.31.0\nnot-on-pypi\n", string(contents))
+}
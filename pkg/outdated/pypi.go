@@ -0,0 +1,66 @@
+package outdated
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// pypiURL is PyPI's JSON API, which has the releases of a package at pypiURL/<name>/json
+var pypiURL = "https://pypi.org/pypi"
+
+type pypiProject struct {
+	Releases map[string][]pypiFile `json:"releases"`
+}
+
+type pypiFile struct {
+	RequiresPython string `json:"requires_python"`
+	Yanked         bool   `json:"yanked"`
+}
+
+// latestOnPyPI returns the latest final release of the package name that works with pythonVersion, or an empty
+// string if there isn't one
+func latestOnPyPI(ctx context.Context, name string, pythonVersion string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pypiURL+"/"+url.PathEscape(name)+"/json", nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return "", nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("PyPI returned %s", resp.Status)
+	}
+	project := &pypiProject{}
+	if err := json.NewDecoder(resp.Body).Decode(project); err != nil {
+		return "", fmt.Errorf("Failed to parse PyPI response: %w", err)
+	}
+
+	latest := ""
+	for v, files := range project.Releases {
+		if _, ok := parseRelease(v); !ok || !installable(files, pythonVersion) {
+			continue
+		}
+		if latest == "" || compareVersions(v, latest) > 0 {
+			latest = v
+		}
+	}
+	return latest, nil
+}
+
+// installable returns whether a release has a file that isn't yanked and works with pythonVersion
+func installable(files []pypiFile, pythonVersion string) bool {
+	for _, f := range files {
+		if !f.Yanked && (f.RequiresPython == "" || matchesSpecifiers(pythonVersion, f.RequiresPython)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package outdated
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/global"
+)
+
+// Update is a change to the version a package is pinned to
+type Update struct {
+	Name string
+	From string
+	To   string
+}
+
+// Updates returns the updates to the packages in report that are pinned to a version that's outdated
+func Updates(report *Report) []Update {
+	updates := []Update{}
+	for _, p := range report.Packages {
+		if p.Outdated() {
+			updates = append(updates, Update{Name: p.Name, From: p.Current, To: p.Latest})
+		}
+	}
+	return updates
+}
+
+// Apply changes the versions the packages in updates are pinned to in cog.yaml and the requirements file in
+// projectDir. Only the pins are changed, so comments and formatting are kept. It returns the files it changed.
+func Apply(cfg *config.Config, projectDir string, updates []Update) ([]string, error) {
+	changed := []string{}
+	for _, name := range Files(cfg) {
+		p := filepath.Join(projectDir, name)
+		contents, err := os.ReadFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read %s: %w", name, err)
+		}
+		updated := applyUpdates(string(contents), updates)
+		if updated == string(contents) {
+			continue
+		}
+		if err := os.WriteFile(p, []byte(updated), 0o644); err != nil {
+			return nil, fmt.Errorf("Failed to write %s: %w", name, err)
+		}
+		changed = append(changed, name)
+	}
+	return changed, nil
+}
+
+// Files returns the files, relative to the project directory, that Apply changes the pins in
+func Files(cfg *config.Config) []string {
+	files := []string{global.ConfigFilename}
+	if cfg.Build.PythonRequirements != "" {
+		files = append(files, cfg.Build.PythonRequirements)
+	}
+	return files
+}
+
+// applyUpdates returns contents, a cog.yaml or requirements.txt, with the pins in updates changed. A local version
+// like +cu121 is kept.
+func applyUpdates(contents string, updates []Update) string {
+	for _, u := range updates {
+		// Names are normalized, so they match the name with dashes, underscores or dots
+		name := strings.ReplaceAll(regexp.QuoteMeta(u.Name), "-", `[-_.]`)
+		re := regexp.MustCompile(`(?im)^([ \t]*(?:-[ \t]*)?["']?` + name + `(?:\[[^\]]*\])?[ \t]*==[ \t]*)` + regexp.QuoteMeta(u.From) + `([+\s"'#;]|$)`)
+		contents = re.ReplaceAllString(contents, "${1}"+u.To+"${2}")
+	}
+	return contents
+}
@@ -0,0 +1,118 @@
+package outdated
+
+import (
+	"strconv"
+	"strings"
+)
+
+// parseRelease returns the numbers in a final release's version, e.g. [2, 5, 1] for 2.5.1. ok is false for
+// pre-releases, dev releases and versions that aren't numbers, which aren't suggested as updates.
+func parseRelease(v string) (numbers []int, ok bool) {
+	v = strings.TrimPrefix(strings.SplitN(v, "+", 2)[0], "v")
+	if v == "" {
+		return nil, false
+	}
+	for _, part := range strings.Split(v, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, false
+		}
+		numbers = append(numbers, n)
+	}
+	return numbers, true
+}
+
+// compareVersions returns -1, 0 or 1 if a is earlier than, the same as, or later than b. Missing parts are zero,
+// so 2.1 is the same as 2.1.0, and versions that aren't numbers are earlier than every other version.
+func compareVersions(a string, b string) int {
+	aNumbers, aOK := parseRelease(a)
+	bNumbers, bOK := parseRelease(b)
+	switch {
+	case !aOK && !bOK:
+		return 0
+	case !aOK:
+		return -1
+	case !bOK:
+		return 1
+	}
+	for i := 0; i < len(aNumbers) || i < len(bNumbers); i++ {
+		x, y := 0, 0
+		if i < len(aNumbers) {
+			x = aNumbers[i]
+		}
+		if i < len(bNumbers) {
+			y = bNumbers[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// matchesSpecifiers returns whether v matches a comma-separated list of version specifiers, like a package's
+// requires_python, e.g. ">=3.8,!=3.9.*,<3.13". Specifiers that can't be parsed are ignored.
+func matchesSpecifiers(v string, specifiers string) bool {
+	for _, specifier := range strings.Split(specifiers, ",") {
+		specifier = strings.TrimSpace(specifier)
+		if specifier == "" {
+			continue
+		}
+		op := ""
+		for _, candidate := range []string{"===", "==", "!=", "~=", ">=", "<=", ">", "<"} {
+			if strings.HasPrefix(specifier, candidate) {
+				op = candidate
+				break
+			}
+		}
+		if op == "" {
+			continue
+		}
+		target := strings.TrimSpace(strings.TrimPrefix(specifier, op))
+		if !matchesSpecifier(v, op, target) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchesSpecifier(v string, op string, target string) bool {
+	if strings.HasSuffix(target, ".*") {
+		prefix := strings.TrimSuffix(target, ".*")
+		matches := v == prefix || strings.HasPrefix(v, prefix+".")
+		switch op {
+		case "==":
+			return matches
+		case "!=":
+			return !matches
+		}
+		return true
+	}
+	c := compareVersions(v, target)
+	switch op {
+	case "==", "===":
+		return c == 0
+	case "!=":
+		return c != 0
+	case ">=":
+		return c >= 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case "<":
+		return c < 0
+	case "~=":
+		// ~=2.2 means >=2.2,==2.*
+		numbers, ok := parseRelease(target)
+		if !ok || len(numbers) < 2 {
+			return c >= 0
+		}
+		prefix := strings.Join(strings.Split(target, ".")[:len(numbers)-1], ".")
+		return c >= 0 && (v == prefix || strings.HasPrefix(v, prefix+"."))
+	}
+	return true
+}
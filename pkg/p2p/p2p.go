@@ -0,0 +1,128 @@
+// Package p2p generates configuration for the peer-to-peer distribution systems that clusters use to
+// share image layers between nodes, so large weights layers are pulled from the registry once rather
+// than by every node.
+package p2p
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/replicate/cog/pkg/util/slices"
+)
+
+// Systems that configuration can be generated for
+const (
+	// SystemSpegel is Spegel, https://github.com/spegel-org/spegel
+	SystemSpegel = "spegel"
+	// SystemDragonfly is Dragonfly, https://d7y.io
+	SystemDragonfly = "dragonfly"
+)
+
+// Systems are all of the systems that configuration can be generated for
+var Systems = []string{SystemSpegel, SystemDragonfly}
+
+// RegistryURL returns the URL of the registry that image is pushed to
+func RegistryURL(image string) string {
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) == 1 || (!strings.ContainsAny(parts[0], ".:") && parts[0] != "localhost") {
+		return "https://docker.io"
+	}
+	return "https://" + parts[0]
+}
+
+type spegelValues struct {
+	Spegel struct {
+		Registries []string `json:"registries"`
+	} `json:"spegel"`
+}
+
+type dragonflyValues struct {
+	ContainerRuntime struct {
+		Containerd struct {
+			Enable           bool     `json:"enable"`
+			InjectConfigPath bool     `json:"injectConfigPath"`
+			Registries       []string `json:"registries"`
+		} `json:"containerd"`
+	} `json:"containerRuntime"`
+}
+
+// HelmValues returns the values for the Helm chart of system that make it share the layers of images in
+// the registries of images between nodes
+func HelmValues(system string, images []string) ([]byte, error) {
+	registries := []string{}
+	for _, image := range images {
+		registry := RegistryURL(image)
+		if !slices.ContainsString(registries, registry) {
+			registries = append(registries, registry)
+		}
+	}
+
+	switch system {
+	case SystemSpegel:
+		values := spegelValues{}
+		values.Spegel.Registries = registries
+		return yaml.Marshal(values)
+	case SystemDragonfly:
+		values := dragonflyValues{}
+		values.ContainerRuntime.Containerd.Enable = true
+		values.ContainerRuntime.Containerd.InjectConfigPath = true
+		values.ContainerRuntime.Containerd.Registries = registries
+		return yaml.Marshal(values)
+	}
+	return nil, fmt.Errorf("Unknown P2P system '%s'. It must be one of: %s", system, strings.Join(Systems, ", "))
+}
+
+type preheatJob struct {
+	Type string      `json:"type"`
+	Args preheatArgs `json:"args"`
+}
+
+type preheatArgs struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+// PreheatURL returns the URL of the manifest of image, which Dragonfly preheats
+func PreheatURL(image string) string {
+	registry := RegistryURL(image)
+	repository := image
+	if registry != "https://docker.io" || strings.HasPrefix(image, "docker.io/") {
+		repository = strings.SplitN(image, "/", 2)[1]
+	} else if !strings.Contains(repository, "/") {
+		repository = "library/" + repository
+	}
+	reference := "latest"
+	if i := strings.LastIndex(repository, "@"); i != -1 {
+		repository, reference = repository[:i], repository[i+1:]
+	} else if i := strings.LastIndex(repository, ":"); i != -1 && !strings.Contains(repository[i:], "/") {
+		repository, reference = repository[:i], repository[i+1:]
+	}
+	if registry == "https://docker.io" {
+		registry = "https://index.docker.io"
+	}
+	return fmt.Sprintf("%s/v2/%s/manifests/%s", registry, repository, reference)
+}
+
+// Preheat asks the Dragonfly manager at managerURL to distribute the layers of image to the peers in the
+// cluster, so they are already there when nodes pull it
+func Preheat(managerURL string, image string) error {
+	body, err := json.Marshal(preheatJob{Type: "preheat", Args: preheatArgs{Type: "image", URL: PreheatURL(image)}})
+	if err != nil {
+		return err
+	}
+	url := strings.TrimSuffix(managerURL, "/") + "/api/v1/jobs"
+	resp, err := http.Post(url, "application/json", bytes.NewReader(body)) //#nosec G107
+	if err != nil {
+		return fmt.Errorf("Failed to POST HTTP request to %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("Failed to create preheat job: %s returned status %d", url, resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package p2p
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryURL(t *testing.T) {
+	require.Equal(t, "https://r8.im", RegistryURL("r8.im/your-username/hotdog-detector"))
+	require.Equal(t, "https://localhost:5000", RegistryURL("localhost:5000/hotdog-detector"))
+	require.Equal(t, "https://docker.io", RegistryURL("your-username/hotdog-detector"))
+	require.Equal(t, "https://docker.io", RegistryURL("hotdog-detector"))
+}
+
+func TestHelmValues(t *testing.T) {
+	values, err := HelmValues(SystemSpegel, []string{"r8.im/a/b", "r8.im/a/c", "ghcr.io/a/b"})
+	require.NoError(t, err)
+	require.Equal(t, `spegel:
+  registries:
+  - https://r8.im
+  - https://ghcr.io
+`, string(values))
+
+	values, err = HelmValues(SystemDragonfly, []string{"r8.im/a/b"})
+	require.NoError(t, err)
+	require.Equal(t, `containerRuntime:
+  containerd:
+    enable: true
+    injectConfigPath: true
+    registries:
+    - https://r8.im
+`, string(values))
+
+	_, err = HelmValues("kraken", nil)
+	require.ErrorContains(t, err, "Unknown P2P system 'kraken'")
+}
+
+func TestPreheatURL(t *testing.T) {
+	require.Equal(t, "https://r8.im/v2/your-username/hotdog-detector/manifests/latest", PreheatURL("r8.im/your-username/hotdog-detector"))
+	require.Equal(t, "https://localhost:5000/v2/hotdog-detector/manifests/v1", PreheatURL("localhost:5000/hotdog-detector:v1"))
+	require.Equal(t, "https://index.docker.io/v2/library/ubuntu/manifests/22.04", PreheatURL("ubuntu:22.04"))
+	require.Equal(t, "https://r8.im/v2/a/b/manifests/sha256:abc", PreheatURL("r8.im/a/b@sha256:abc"))
+}
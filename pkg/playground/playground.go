@@ -0,0 +1,113 @@
+// Package playground serves a web page with a form, made from a model's schema, to run predictions with the model
+// and preview their outputs, for people who'd rather not use the CLI
+package playground
+
+import (
+	// blank import for embeds
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+
+	"github.com/replicate/cog/pkg/predict"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+//go:embed static/index.html
+var indexHTML []byte
+
+// Model is a model that's running, which the playground runs predictions with. It's a *predict.Predictor, or a
+// fake in tests.
+type Model interface {
+	GetSchema() (*openapi3.T, error)
+	PredictWithTimeout(inputs predict.Inputs, timeout time.Duration) (*predict.Response, error)
+}
+
+// PredictionRequest is the body of POST /api/predictions. Files are data URLs, read by the page.
+type PredictionRequest struct {
+	Input map[string]interface{} `json:"input"`
+}
+
+// Server serves the playground for a model
+type Server struct {
+	name  string
+	model Model
+	// mu makes predictions run one at a time, like `cog predict`, so the page doesn't overwhelm the model
+	mu sync.Mutex
+}
+
+// New returns the playground for model, with name as its title
+func New(name string, model Model) *Server {
+	return &Server{name: name, model: model}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/" && r.Method == http.MethodGet:
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write(indexHTML)
+	case r.URL.Path == "/api/schema" && r.Method == http.MethodGet:
+		schema, err := s.model.GetSchema()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"name": s.name, "schema": schema})
+	case r.URL.Path == "/api/predictions" && r.Method == http.MethodPost:
+		s.predict(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) predict(w http.ResponseWriter, r *http.Request) {
+	// Other web pages can't send JSON here without CORS, which the playground doesn't allow
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		writeError(w, http.StatusUnsupportedMediaType, fmt.Errorf("The request body must be JSON, with Content-Type: application/json"))
+		return
+	}
+	var req PredictionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("Failed to parse the prediction request: %w", err))
+		return
+	}
+	values, err := predict.JSONInputsToStrings(req.Input)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	// The values come from a web page, so unlike -i, values prefixed with @ aren't read from files on this machine
+	inputs := predict.Inputs{}
+	for name, value := range values {
+		value := value
+		inputs[name] = predict.Input{String: &value}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	startedOn := time.Now()
+	response, err := s.model.PredictWithTimeout(inputs, 0)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	console.Infof("Ran a prediction in %s, which %s", time.Since(startedOn).Round(time.Millisecond), response.Status)
+	writeJSON(w, http.StatusOK, response)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		console.Debugf("Failed to write response: %s", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
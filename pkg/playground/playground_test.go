@@ -0,0 +1,66 @@
+package playground
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/predict"
+)
+
+type fakeModel struct {
+	inputs predict.Inputs
+}
+
+func (m *fakeModel) GetSchema() (*openapi3.T, error) {
+	return &openapi3.T{OpenAPI: "3.0.2", Info: &openapi3.Info{Title: "Cog"}}, nil
+}
+
+func (m *fakeModel) PredictWithTimeout(inputs predict.Inputs, timeout time.Duration) (*predict.Response, error) {
+	m.inputs = inputs
+	var output interface{} = "a hot dog"
+	return &predict.Response{Status: "succeeded", Output: &output}, nil
+}
+
+func serve(server *Server, method string, path string, contentType string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestPlayground(t *testing.T) {
+	model := &fakeModel{}
+	server := New("hotdog-detector", model)
+
+	rec := serve(server, http.MethodGet, "/", "", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), "/api/predictions")
+
+	rec = serve(server, http.MethodGet, "/api/schema", "", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), `"name":"hotdog-detector"`)
+	require.Contains(t, rec.Body.String(), `"openapi":"3.0.2"`)
+
+	rec = serve(server, http.MethodPost, "/api/predictions", "application/json", `{"input": {"image": "data:image/png;base64,aGVsbG8=", "steps": 20, "path": "@/etc/passwd"}}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var response predict.Response
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	require.Equal(t, "a hot dog", *response.Output)
+	require.Equal(t, "20", *model.inputs["steps"].String)
+	// Values from the page are never read from files
+	require.Nil(t, model.inputs["path"].File)
+	require.Equal(t, "@/etc/passwd", *model.inputs["path"].String)
+
+	require.Equal(t, http.StatusUnsupportedMediaType, serve(server, http.MethodPost, "/api/predictions", "text/plain", `{"input": {}}`).Code)
+	require.Equal(t, http.StatusNotFound, serve(server, http.MethodGet, "/nope", "", "").Code)
+}
@@ -0,0 +1,56 @@
+package predict
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// AuthTokenEnv is the environment variable the model's HTTP server reads the bearer token it requires from
+const AuthTokenEnv = "COG_AUTH_TOKEN"
+
+// NewAuthToken returns a random token for a model whose HTTP server requires one
+func NewAuthToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("Failed to generate auth token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// RequireAuth starts the model with a new token that its HTTP server requires, and sends it with every request, so
+// the port the model is published on isn't open to anyone on the network. It must be called before Start.
+func (p *Predictor) RequireAuth() error {
+	token, err := NewAuthToken()
+	if err != nil {
+		return err
+	}
+	if p.local != nil {
+		p.local.Env = append(p.local.Env, AuthTokenEnv+"="+token)
+	} else {
+		p.runOptions.Env = append(p.runOptions.Env, AuthTokenEnv+"="+token)
+	}
+	p.SetAuthToken(token)
+	return nil
+}
+
+// SetAuthToken sends token as a bearer token with every request to the model
+func (p *Predictor) SetAuthToken(token string) {
+	if p.header == nil {
+		p.header = http.Header{}
+	}
+	p.header.Set("Authorization", "Bearer "+token)
+}
+
+// authTokenFromEnv returns the token in env, the environment of a container in the form name=value, or "" if it
+// doesn't have one
+func authTokenFromEnv(env []string) string {
+	for _, e := range env {
+		if value, ok := strings.CutPrefix(e, AuthTokenEnv+"="); ok {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,30 @@
+package predict
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/docker"
+)
+
+func TestRequireAuth(t *testing.T) {
+	predictor := NewPredictor(docker.RunOptions{Image: "my-model", Env: []string{"FOO=bar"}})
+	require.NoError(t, predictor.RequireAuth())
+
+	token := authTokenFromEnv(predictor.runOptions.Env)
+	require.Len(t, token, 64)
+	require.Contains(t, predictor.runOptions.Env, "FOO=bar")
+	require.Equal(t, "Bearer "+token, predictor.header.Get("Authorization"))
+
+	other := NewPredictor(docker.RunOptions{Image: "my-model"})
+	require.NoError(t, other.RequireAuth())
+	require.NotEqual(t, token, authTokenFromEnv(other.runOptions.Env))
+}
+
+func TestAuthTokenFromEnv(t *testing.T) {
+	require.Equal(t, "", authTokenFromEnv([]string{"PATH=/usr/bin"}))
+	require.Equal(t, "secret", authTokenFromEnv([]string{"PATH=/usr/bin", AuthTokenEnv + "=secret"}))
+	require.Equal(t, "", authTokenFromEnv([]string{strings.TrimSuffix(AuthTokenEnv, "N") + "=secret"}))
+}
@@ -0,0 +1,120 @@
+package predict
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/replicate/cog/pkg/docker"
+)
+
+// crashLogSize is how much of the end of the container's logs is kept for crash reports
+const crashLogSize = 1024 * 1024
+
+// crashWait is how long to wait for the container to exit after something failed, to tell whether it crashed
+const crashWait = time.Second
+
+// Crash is how the model's container exited while it was running
+type Crash struct {
+	ContainerID string
+	Image       string
+	GPUs        string
+	Env         []string
+	ExitCode    int
+	// Logs is the end of what the container wrote to stdout and stderr
+	Logs []byte
+}
+
+// Reason describes why the container probably exited, from its exit code
+func (c *Crash) Reason() string {
+	if c.OutOfMemory() {
+		return "it was killed, probably because it ran out of memory"
+	}
+	switch c.ExitCode {
+	case 139:
+		return "it crashed with a segmentation fault"
+	case 134:
+		return "it aborted"
+	default:
+		return fmt.Sprintf("it exited with code %d", c.ExitCode)
+	}
+}
+
+// containerExit watches for the model's container to exit, keeping the end of its logs
+type containerExit struct {
+	done     chan struct{}
+	code     int
+	err      error
+	logs     *logTail
+	logsDone chan struct{}
+}
+
+func watchContainer(containerID string) *containerExit {
+	exit := &containerExit{
+		done:     make(chan struct{}),
+		logs:     &logTail{size: crashLogSize},
+		logsDone: make(chan struct{}),
+	}
+	go func() {
+		exit.code, exit.err = docker.ContainerWait(containerID)
+		close(exit.done)
+	}()
+	return exit
+}
+
+// Crashed returns how the model's container exited, if it has exited or exits shortly, and nil otherwise. It's
+// used when starting the model or a prediction failed, to tell whether the container crashed.
+func (p *Predictor) Crashed() *Crash {
+	if p.exit == nil {
+		return nil
+	}
+	select {
+	case <-p.exit.done:
+	case <-time.After(crashWait):
+		return nil
+	}
+	if p.exit.err != nil {
+		return nil
+	}
+	// The logs stop following once the container is gone, so the last of them have been written
+	select {
+	case <-p.exit.logsDone:
+	case <-time.After(time.Second):
+	}
+	return &Crash{
+		ContainerID: p.containerID,
+		Image:       p.runOptions.Image,
+		GPUs:        p.runOptions.GPUs,
+		Env:         p.runOptions.Env,
+		ExitCode:    p.exit.code,
+		Logs:        p.exit.logs.Bytes(),
+	}
+}
+
+// OutOfMemory returns whether the container was probably killed because it ran out of memory
+func (c *Crash) OutOfMemory() bool {
+	return c.ExitCode == 137
+}
+
+// logTail keeps the last size bytes written to it
+type logTail struct {
+	mu   sync.Mutex
+	size int
+	buf  []byte
+}
+
+func (t *logTail) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > t.size {
+		t.buf = t.buf[len(t.buf)-t.size:]
+	}
+	return len(p), nil
+}
+
+func (t *logTail) Bytes() []byte {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]byte{}, t.buf...)
+}
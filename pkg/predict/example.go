@@ -0,0 +1,108 @@
+package predict
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// ExamplesDir is the directory, relative to the project, that holds example inputs
+const ExamplesDir = "examples"
+
+var exampleExtensions = []string{".json", ".yaml", ".yml"}
+
+// Example is a set of inputs for a prediction, stored as a JSON or YAML file in the examples directory.
+// It can also have the output the model is expected to return, which is shown in the model card.
+type Example struct {
+	Input  map[string]interface{} `json:"input"`
+	Output interface{}            `json:"output,omitempty"`
+}
+
+// ListExamples returns the names of the examples in projectDir, sorted alphabetically
+func ListExamples(projectDir string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(projectDir, ExamplesDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+	names := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		ext := filepath.Ext(entry.Name())
+		for _, exampleExt := range exampleExtensions {
+			if ext == exampleExt {
+				names = append(names, strings.TrimSuffix(entry.Name(), ext))
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// LoadExample reads the example called name from projectDir.
+// File inputs in the form @path are resolved relative to the examples directory.
+func LoadExample(projectDir string, name string) (Inputs, error) {
+	example, err := ReadExample(projectDir, name)
+	if err != nil {
+		return nil, err
+	}
+	keyVals, err := JSONInputsToStrings(example.Input)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse example %s: %w", name, err)
+	}
+	return NewInputsWithBaseDir(keyVals, filepath.Join(projectDir, ExamplesDir)), nil
+}
+
+// ReadExample reads the example called name from projectDir, without resolving its inputs
+func ReadExample(projectDir string, name string) (*Example, error) {
+	dir := filepath.Join(projectDir, ExamplesDir)
+	for _, ext := range exampleExtensions {
+		path := filepath.Join(dir, name+ext)
+		contents, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		example, err := parseExample(contents)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse example %s: %w", path, err)
+		}
+		return example, nil
+	}
+
+	names, err := ListExamples(projectDir)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("Example '%s' not found: there are no examples in %s", name, dir)
+	}
+	return nil, fmt.Errorf("Example '%s' not found in %s. Available examples: %s", name, dir, strings.Join(names, ", "))
+}
+
+func parseExample(contents []byte) (*Example, error) {
+	// YAML is a superset of JSON, so this handles both
+	jsonContents, err := yaml.YAMLToJSON(contents)
+	if err != nil {
+		return nil, err
+	}
+	example := &Example{}
+	if err := json.Unmarshal(jsonContents, example); err != nil {
+		return nil, err
+	}
+	if example.Input == nil {
+		return nil, fmt.Errorf("missing 'input'")
+	}
+	return example, nil
+}
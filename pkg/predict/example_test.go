@@ -0,0 +1,59 @@
+package predict
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeExample(t *testing.T, dir string, filename string, contents string) {
+	examplesDir := filepath.Join(dir, ExamplesDir)
+	require.NoError(t, os.MkdirAll(examplesDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(examplesDir, filename), []byte(contents), 0o644))
+}
+
+func TestLoadExampleYAML(t *testing.T) {
+	dir := t.TempDir()
+	writeExample(t, dir, "cat.yaml", `
+input:
+  image: "@cat.jpg"
+  scale: 2.5
+  upscale: true
+  prompt: a cat
+`)
+
+	inputs, err := LoadExample(dir, "cat")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, ExamplesDir, "cat.jpg"), *inputs["image"].File)
+	require.Equal(t, "2.5", *inputs["scale"].String)
+	require.Equal(t, "true", *inputs["upscale"].String)
+	require.Equal(t, "a cat", *inputs["prompt"].String)
+}
+
+func TestLoadExampleJSON(t *testing.T) {
+	dir := t.TempDir()
+	writeExample(t, dir, "dog.json", `{"input": {"steps": 50}}`)
+
+	inputs, err := LoadExample(dir, "dog")
+	require.NoError(t, err)
+	require.Equal(t, "50", *inputs["steps"].String)
+}
+
+func TestLoadExampleNotFound(t *testing.T) {
+	dir := t.TempDir()
+	writeExample(t, dir, "cat.yaml", "input: {}")
+	writeExample(t, dir, "dog.json", `{"input": {}}`)
+
+	_, err := LoadExample(dir, "bird")
+	require.ErrorContains(t, err, "Available examples: cat, dog")
+}
+
+func TestLoadExampleInvalidInput(t *testing.T) {
+	dir := t.TempDir()
+	writeExample(t, dir, "cat.yaml", "input:\n  sizes: [1, 2]\n")
+
+	_, err := LoadExample(dir, "cat")
+	require.ErrorContains(t, err, "input 'sizes' must be a string, number or boolean")
+}
@@ -1,14 +1,22 @@
 package predict
 
 import (
+	"archive/tar"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/mitchellh/go-homedir"
-	"github.com/vincent-petithory/dataurl"
 
 	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/util/files"
 	"github.com/replicate/cog/pkg/util/mime"
 )
 
@@ -41,6 +49,38 @@ func NewInputs(keyVals map[string]string) Inputs {
 	return input
 }
 
+// NewInputsFromJSON reads inputs from a JSON object of input names to values, e.g. {"prompt": "a cat", "steps": 50}.
+// Like -i, strings prefixed with @ are read from files on disk.
+func NewInputsFromJSON(r io.Reader) (Inputs, error) {
+	values := map[string]interface{}{}
+	if err := json.NewDecoder(r).Decode(&values); err != nil {
+		return nil, fmt.Errorf("Failed to parse inputs as a JSON object: %w", err)
+	}
+	keyVals, err := JSONInputsToStrings(values)
+	if err != nil {
+		return nil, err
+	}
+	return NewInputs(keyVals), nil
+}
+
+// JSONInputsToStrings converts JSON input values to the strings the -i flag would have produced
+func JSONInputsToStrings(values map[string]interface{}) (map[string]string, error) {
+	keyVals := map[string]string{}
+	for key, val := range values {
+		switch v := val.(type) {
+		case string:
+			keyVals[key] = v
+		case float64:
+			keyVals[key] = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			keyVals[key] = strconv.FormatBool(v)
+		default:
+			return nil, fmt.Errorf("input '%s' must be a string, number or boolean", key)
+		}
+	}
+	return keyVals, nil
+}
+
 func NewInputsWithBaseDir(keyVals map[string]string, baseDir string) Inputs {
 	input := Inputs{}
 	for key, val := range keyVals {
@@ -55,19 +95,193 @@ func NewInputsWithBaseDir(keyVals map[string]string, baseDir string) Inputs {
 	return input
 }
 
-func (inputs *Inputs) toMap() (map[string]string, error) {
-	keyVals := map[string]string{}
-	for key, input := range *inputs {
-		if input.String != nil {
-			keyVals[key] = *input.String
-		} else if input.File != nil {
-			content, err := os.ReadFile(*input.File)
-			if err != nil {
-				return keyVals, err
+// writeRequest streams a prediction request for inputs to w as JSON, with the prediction ID id if it isn't empty.
+// Files are base64 encoded as they are read so large files are never held in memory,
+// and directories are sent as tar archives.
+func (inputs *Inputs) writeRequest(w io.Writer, id string) error {
+	keys := make([]string, 0, len(*inputs))
+	for key := range *inputs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	if _, err := io.WriteString(w, "{"); err != nil {
+		return err
+	}
+	if id != "" {
+		if _, err := io.WriteString(w, `"id":`); err != nil {
+			return err
+		}
+		if err := writeJSONString(w, id); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, ","); err != nil {
+			return err
+		}
+	}
+	if _, err := io.WriteString(w, `"input":{`); err != nil {
+		return err
+	}
+	for i, key := range keys {
+		input := (*inputs)[key]
+		if i > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		if err := writeJSONString(w, key); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, ":"); err != nil {
+			return err
+		}
+		if input.File != nil {
+			if err := writeFileDataURL(w, *input.File); err != nil {
+				return err
+			}
+		} else if input.String != nil {
+			if err := writeJSONString(w, *input.String); err != nil {
+				return err
 			}
-			mimeType := mime.TypeByExtension(filepath.Ext(*input.File))
-			keyVals[key] = dataurl.New(content, mimeType).String()
 		}
 	}
-	return keyVals, nil
+	_, err := io.WriteString(w, "}}")
+	return err
+}
+
+// requestSize returns the size of the request body writeRequest writes, which means reading any files
+func (inputs *Inputs) requestSize(id string) (int64, error) {
+	w := &countingWriter{}
+	err := inputs.writeRequest(w, id)
+	return w.n, err
+}
+
+// countingWriter counts the bytes written to it and discards them
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+func writeJSONString(w io.Writer, s string) error {
+	encoded, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(encoded)
+	return err
+}
+
+// writeFileDataURL writes path to w as a quoted base64 data URL
+func writeFileDataURL(w io.Writer, path string) error {
+	isDir, err := files.IsDir(path)
+	if err != nil {
+		return fmt.Errorf("Failed to read input %s: %w", path, err)
+	}
+
+	var contentType string
+	var reader io.Reader
+	if isDir {
+		contentType = "application/x-tar"
+		pr, pw := io.Pipe()
+		go func() {
+			pw.CloseWithError(writeTar(pw, path))
+		}()
+		defer pr.Close()
+		reader = pr
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("Failed to read input %s: %w", path, err)
+		}
+		defer f.Close()
+		contentType, err = detectContentType(f)
+		if err != nil {
+			return fmt.Errorf("Failed to read input %s: %w", path, err)
+		}
+		reader = f
+	}
+
+	if _, err := fmt.Fprintf(w, `"data:%s;base64,`, contentType); err != nil {
+		return err
+	}
+	encoder := base64.NewEncoder(base64.StdEncoding, w)
+	if _, err := io.Copy(encoder, reader); err != nil {
+		return fmt.Errorf("Failed to read input %s: %w", path, err)
+	}
+	if err := encoder.Close(); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, `"`)
+	return err
+}
+
+// detectContentType returns the media type of f from its extension, or by sniffing its contents
+// if the extension is unknown. f is left positioned at the start of the file.
+func detectContentType(f *os.File) (string, error) {
+	contentType := mime.TypeByExtension(filepath.Ext(f.Name()))
+	if contentType != "application/octet-stream" {
+		return contentType, nil
+	}
+
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	if n == 0 {
+		return contentType, nil
+	}
+	// Drop parameters like "; charset=utf-8", which aren't valid in a base64 data URL
+	contentType, _, _ = strings.Cut(http.DetectContentType(buf[:n]), ";")
+	return contentType, nil
+}
+
+// writeTar writes the contents of dir to w as a tar archive, with paths relative to dir
+func writeTar(w io.Writer, dir string) error {
+	tw := tar.NewWriter(w)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if relPath == "." {
+			return nil
+		}
+		if !info.Mode().IsRegular() && !info.IsDir() {
+			// Skip symlinks, sockets, etc.
+			return nil
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(relPath)
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
 }
@@ -0,0 +1,113 @@
+package predict
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vincent-petithory/dataurl"
+)
+
+func encodeRequest(t *testing.T, inputs Inputs) map[string]string {
+	var buf bytes.Buffer
+	require.NoError(t, inputs.writeRequest(&buf, ""))
+	request := Request{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &request))
+	return request.Input
+}
+
+func TestWriteRequestWithID(t *testing.T) {
+	inputs := NewInputs(map[string]string{"prompt": "a cat"})
+	var buf bytes.Buffer
+	require.NoError(t, inputs.writeRequest(&buf, "abc123"))
+	require.JSONEq(t, `{"id": "abc123", "input": {"prompt": "a cat"}}`, buf.String())
+}
+
+func TestWriteRequestStringsAndFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "image.png")
+	require.NoError(t, os.WriteFile(path, []byte("not really a png"), 0o644))
+
+	inputs := NewInputs(map[string]string{
+		"prompt": `a "quoted" cat`,
+		"image":  "@" + path,
+	})
+	input := encodeRequest(t, inputs)
+
+	require.Equal(t, `a "quoted" cat`, input["prompt"])
+	image, err := dataurl.DecodeString(input["image"])
+	require.NoError(t, err)
+	require.Equal(t, "image/png", image.ContentType())
+	require.Equal(t, "not really a png", string(image.Data))
+}
+
+func TestRequestSize(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audio.wav")
+	require.NoError(t, os.WriteFile(path, bytes.Repeat([]byte{0}, 3000), 0o644))
+
+	inputs := NewInputs(map[string]string{"audio": "@" + path})
+	var buf bytes.Buffer
+	require.NoError(t, inputs.writeRequest(&buf, "abc123"))
+	size, err := inputs.requestSize("abc123")
+	require.NoError(t, err)
+	require.Equal(t, int64(buf.Len()), size)
+	require.Greater(t, size, int64(4000))
+}
+
+func TestWriteRequestSniffsContentType(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "noextension")
+	require.NoError(t, os.WriteFile(path, []byte("\x89PNG\x0D\x0A\x1A\x0A rest of the image"), 0o644))
+
+	input := encodeRequest(t, NewInputs(map[string]string{"image": "@" + path}))
+
+	image, err := dataurl.DecodeString(input["image"])
+	require.NoError(t, err)
+	require.Equal(t, "image/png", image.ContentType())
+}
+
+func TestWriteRequestDirectory(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "frames", "sub"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "frames", "a.txt"), []byte("a"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "frames", "sub", "b.txt"), []byte("b"), 0o644))
+
+	input := encodeRequest(t, NewInputs(map[string]string{"frames": "@" + filepath.Join(dir, "frames")}))
+
+	archive, err := dataurl.DecodeString(input["frames"])
+	require.NoError(t, err)
+	require.Equal(t, "application/x-tar", archive.ContentType())
+
+	contents := map[string]string{}
+	tr := tar.NewReader(bytes.NewReader(archive.Data))
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		contents[header.Name] = string(data)
+	}
+	require.Equal(t, map[string]string{"a.txt": "a", "sub": "", "sub/b.txt": "b"}, contents)
+}
+
+func TestNewInputsFromJSON(t *testing.T) {
+	inputs, err := NewInputsFromJSON(strings.NewReader(`{"prompt": "a cat", "steps": 50, "upscale": false, "image": "@cat.jpg"}`))
+	require.NoError(t, err)
+	require.Equal(t, "a cat", *inputs["prompt"].String)
+	require.Equal(t, "50", *inputs["steps"].String)
+	require.Equal(t, "false", *inputs["upscale"].String)
+	require.Equal(t, "cat.jpg", *inputs["image"].File)
+
+	_, err = NewInputsFromJSON(strings.NewReader(`not json`))
+	require.ErrorContains(t, err, "Failed to parse inputs as a JSON object")
+}
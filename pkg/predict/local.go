@@ -0,0 +1,91 @@
+package predict
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// localStopTimeout is how long a model running on the host has to exit after it is interrupted before it is killed
+const localStopTimeout = 10 * time.Second
+
+// LocalOptions are how to run a model outside Docker, as a process on the host
+type LocalOptions struct {
+	// Python is the Python executable to run the model with, usually in a virtualenv that has cog installed
+	Python string
+	// Dir is the project directory, with cog.yaml in it
+	Dir string
+	// Env is extra environment variables, in the form name=value
+	Env []string
+}
+
+// NewLocalPredictor makes a predictor that runs the model's HTTP server on the host, instead of in a container
+func NewLocalPredictor(opts LocalOptions) Predictor {
+	if global.Debug {
+		opts.Env = append(opts.Env, "COG_LOG_LEVEL=debug")
+	} else {
+		opts.Env = append(opts.Env, "COG_LOG_LEVEL=warning")
+	}
+	return Predictor{local: &opts}
+}
+
+func (p *Predictor) startLocal(logsWriter io.Writer) error {
+	port, err := freePort()
+	if err != nil {
+		return fmt.Errorf("Failed to find a free port: %w", err)
+	}
+	p.port = port
+
+	cmd := exec.Command(p.local.Python, "-m", "cog.server.http")
+	cmd.Dir = p.local.Dir
+	cmd.Env = append(append(os.Environ(), p.local.Env...), "PORT="+strconv.Itoa(port))
+	cmd.Stdout = logsWriter
+	cmd.Stderr = logsWriter
+	console.Debugf("$ %s -m cog.server.http", p.local.Python)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("Failed to start model: %w", err)
+	}
+	p.process = cmd
+	p.exited = make(chan struct{})
+	go func() {
+		_ = cmd.Wait()
+		close(p.exited)
+	}()
+
+	return p.waitForContainerReady()
+}
+
+func (p *Predictor) stopLocal() error {
+	select {
+	case <-p.exited:
+		return nil
+	default:
+	}
+	if err := p.process.Process.Signal(os.Interrupt); err != nil {
+		return p.process.Process.Kill()
+	}
+	select {
+	case <-p.exited:
+		return nil
+	case <-time.After(localStopTimeout):
+		console.Warnf("Model didn't stop after %s, killing it", localStopTimeout)
+		return p.process.Process.Kill()
+	}
+}
+
+// freePort returns a port on localhost that nothing is listening on
+func freePort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
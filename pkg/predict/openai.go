@@ -0,0 +1,71 @@
+package predict
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// ChatMessage is a message in an OpenAI-compatible chat completion
+type ChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatCompletionRequest struct {
+	Model    string        `json:"model"`
+	Messages []ChatMessage `json:"messages"`
+}
+
+type chatCompletionResponse struct {
+	Choices []struct {
+		Message ChatMessage `json:"message"`
+	} `json:"choices"`
+}
+
+type openAIErrorResponse struct {
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// ChatCompletion sends messages to the model's OpenAI-compatible /v1/chat/completions route,
+// and returns the reply
+func (p *Predictor) ChatCompletion(messages []ChatMessage) (*ChatMessage, error) {
+	body, err := json.Marshal(chatCompletionRequest{Model: "cog", Messages: messages})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := p.newRequest(context.Background(), http.MethodPost, "/v1/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.httpClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to POST HTTP request to %s: %w", req.URL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("The model doesn't serve OpenAI-compatible routes. Set 'openai: true' in cog.yaml")
+	}
+	if resp.StatusCode != http.StatusOK {
+		errorResponse := &openAIErrorResponse{}
+		if err := json.NewDecoder(resp.Body).Decode(errorResponse); err != nil || errorResponse.Error.Message == "" {
+			return nil, fmt.Errorf("/v1/chat/completions call returned status %d", resp.StatusCode)
+		}
+		return nil, fmt.Errorf("/v1/chat/completions call returned status %d: %s", resp.StatusCode, errorResponse.Error.Message)
+	}
+
+	completion := &chatCompletionResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(completion); err != nil {
+		return nil, fmt.Errorf("Failed to decode chat completion response: %w", err)
+	}
+	if len(completion.Choices) == 0 {
+		return nil, fmt.Errorf("Chat completion response has no choices")
+	}
+	return &completion.Choices[0].Message, nil
+}
@@ -0,0 +1,51 @@
+package predict
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestPredictor(t *testing.T, handler http.HandlerFunc) *Predictor {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	_, portString, err := net.SplitHostPort(server.Listener.Addr().String())
+	require.NoError(t, err)
+	port, err := strconv.Atoi(portString)
+	require.NoError(t, err)
+	return &Predictor{port: port}
+}
+
+func TestChatCompletion(t *testing.T) {
+	predictor := newTestPredictor(t, func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v1/chat/completions", r.URL.Path)
+		request := chatCompletionRequest{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		require.Equal(t, []ChatMessage{{Role: "user", Content: "hello"}}, request.Messages)
+		_, _ = w.Write([]byte(`{"choices": [{"index": 0, "message": {"role": "assistant", "content": "hi"}}]}`))
+	})
+
+	reply, err := predictor.ChatCompletion([]ChatMessage{{Role: "user", Content: "hello"}})
+	require.NoError(t, err)
+	require.Equal(t, &ChatMessage{Role: "assistant", Content: "hi"}, reply)
+}
+
+func TestChatCompletionError(t *testing.T) {
+	predictor := newTestPredictor(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error": {"message": "The model doesn't have an input for the prompt"}}`))
+	})
+
+	_, err := predictor.ChatCompletion([]ChatMessage{{Role: "user", Content: "hello"}})
+	require.ErrorContains(t, err, "The model doesn't have an input for the prompt")
+
+	notFound := newTestPredictor(t, http.NotFound)
+	_, err = notFound.ChatCompletion([]ChatMessage{{Role: "user", Content: "hello"}})
+	require.ErrorContains(t, err, "openai: true")
+}
@@ -1,14 +1,20 @@
 package predict
 
 import (
-	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"os"
+	"os/exec"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/docker/go-units"
 	"github.com/getkin/kin-openapi/openapi3"
 
 	"github.com/replicate/cog/pkg/docker"
@@ -18,11 +24,18 @@ import (
 
 type status string
 
+// containerPort is the port the HTTP server listens on inside the container
+const containerPort = 5000
+
+// cancelGracePeriod is how long a prediction has to stop after it is canceled before the request is abandoned
+const cancelGracePeriod = 10 * time.Second
+
 type HealthcheckResponse struct {
 	Status string `json:"status"`
 }
 
 type Request struct {
+	ID string `json:"id,omitempty"`
 	// TODO: could this be Inputs?
 	Input map[string]string `json:"input"`
 }
@@ -43,10 +56,28 @@ type ValidationErrorResponse struct {
 
 type Predictor struct {
 	runOptions docker.RunOptions
+	// local is set if the model runs outside Docker, as a process on the host
+	local *LocalOptions
+	// baseURL is set if the model is already running somewhere else, see NewRemotePredictor
+	baseURL string
+	// header is sent with every request to the model
+	header http.Header
+	// client sends requests to the model, if it isn't http.DefaultClient, and https is set if they use HTTPS
+	client *http.Client
+	https  bool
+	// tlsDir has the certificate made by RequireTLS, until the model has started
+	tlsDir string
+	// maxRequestSize is the largest request the model accepts, or 0 if there's no limit
+	maxRequestSize int64
 
 	// Running state
 	containerID string
 	port        int
+	process     *exec.Cmd
+	// exited is closed when process exits
+	exited chan struct{}
+	// exit is how the container exited, once it has, see Crashed
+	exit *containerExit
 }
 
 func NewPredictor(runOptions docker.RunOptions) Predictor {
@@ -59,8 +90,17 @@ func NewPredictor(runOptions docker.RunOptions) Predictor {
 }
 
 func (p *Predictor) Start(logsWriter io.Writer) error {
+	if p.tlsDir != "" {
+		defer os.RemoveAll(p.tlsDir)
+	}
+	if p.local != nil {
+		return p.startLocal(logsWriter)
+	}
+	if p.baseURL != "" {
+		return p.waitForContainerReady()
+	}
+
 	var err error
-	containerPort := 5000
 
 	p.runOptions.Ports = append(p.runOptions.Ports, docker.Port{HostPort: 0, ContainerPort: containerPort})
 
@@ -74,8 +114,10 @@ func (p *Predictor) Start(logsWriter io.Writer) error {
 		return fmt.Errorf("Failed to determine container port: %w", err)
 	}
 
+	p.exit = watchContainer(p.containerID)
 	go func() {
-		if err := docker.ContainerLogsFollow(p.containerID, logsWriter); err != nil {
+		defer close(p.exit.logsDone)
+		if err := docker.ContainerLogsFollow(p.containerID, io.MultiWriter(logsWriter, p.exit.logs)); err != nil {
 			// if user hits ctrl-c we expect an error signal
 			if !strings.Contains(err.Error(), "signal: interrupt") {
 				console.Warnf("Error getting container logs: %s", err)
@@ -87,8 +129,6 @@ func (p *Predictor) Start(logsWriter io.Writer) error {
 }
 
 func (p *Predictor) waitForContainerReady() error {
-	url := fmt.Sprintf("http://localhost:%d/health-check", p.port)
-
 	start := time.Now()
 	for {
 		now := time.Now()
@@ -98,23 +138,46 @@ func (p *Predictor) waitForContainerReady() error {
 
 		time.Sleep(100 * time.Millisecond)
 
-		cont, err := docker.ContainerInspect(p.containerID)
-		if err != nil {
-			return fmt.Errorf("Failed to get container status: %w", err)
-		}
-		if cont.State != nil && (cont.State.Status == "exited" || cont.State.Status == "dead") {
-			return fmt.Errorf("Container exited unexpectedly")
+		if p.process != nil {
+			select {
+			case <-p.exited:
+				return fmt.Errorf("Model exited unexpectedly")
+			default:
+			}
+		} else if p.containerID != "" {
+			cont, err := docker.ContainerInspect(p.containerID)
+			if err != nil {
+				return fmt.Errorf("Failed to get container status: %w", err)
+			}
+			if cont.State != nil && (cont.State.Status == "exited" || cont.State.Status == "dead") {
+				return fmt.Errorf("Container exited unexpectedly")
+			}
 		}
 
-		resp, err := http.Get(url) //#nosec G107
+		req, err := p.newRequest(context.Background(), http.MethodGet, "/health-check", nil)
+		if err != nil {
+			return err
+		}
+		resp, err := p.httpClient().Do(req)
 		if err != nil {
+			if p.baseURL != "" {
+				// A model that's already running should be reachable straight away
+				return fmt.Errorf("Failed to reach the model at %s: %w", p.baseURL, err)
+			}
 			continue
 		}
+		if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+			resp.Body.Close()
+			return fmt.Errorf("The model's HTTP server returned status %d. Check the token or headers you passed", resp.StatusCode)
+		}
 		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
 			continue
 		}
 		healthcheck := &HealthcheckResponse{}
-		if err := json.NewDecoder(resp.Body).Decode(healthcheck); err != nil {
+		err = json.NewDecoder(resp.Body).Decode(healthcheck)
+		resp.Body.Close()
+		if err != nil {
 			return fmt.Errorf("Container healthcheck returned invalid response: %w", err)
 		}
 		// These status values are defined in python/cog/server/http.py
@@ -131,33 +194,87 @@ func (p *Predictor) waitForContainerReady() error {
 	}
 }
 
+// SetMaxRequestSize makes predictions fail before they're sent if their request is larger than size bytes, the
+// largest request the model accepts
+func (p *Predictor) SetMaxRequestSize(size int64) {
+	p.maxRequestSize = size
+}
+
+// ContainerID returns the ID of the container the model is running in, or "" if it isn't running in one
+func (p *Predictor) ContainerID() string {
+	return p.containerID
+}
+
 func (p *Predictor) Stop() error {
+	if p.process != nil {
+		return p.stopLocal()
+	}
+	if p.baseURL != "" {
+		// It was already running, so it's left running
+		return nil
+	}
 	return docker.Stop(p.containerID)
 }
 
 func (p *Predictor) Predict(inputs Inputs) (*Response, error) {
-	inputMap, err := inputs.toMap()
+	return p.PredictWithTimeout(inputs, 0)
+}
+
+// PredictWithTimeout runs a prediction, canceling it if it hasn't finished after timeout.
+// If timeout is zero, the prediction can run for as long as it needs.
+func (p *Predictor) PredictWithTimeout(inputs Inputs, timeout time.Duration) (*Response, error) {
+	id, err := newPredictionID()
 	if err != nil {
 		return nil, err
 	}
-	request := Request{Input: inputMap}
-	requestBody, err := json.Marshal(request)
+
+	if p.maxRequestSize > 0 {
+		// Check before sending it, because the model would only reject it once it's gone over the limit
+		size, err := inputs.requestSize(id)
+		if err != nil {
+			return nil, err
+		}
+		if size > p.maxRequestSize {
+			return nil, fmt.Errorf("The inputs make a request of %s, which is more than the model accepts. Files are sent base64-encoded, so they're about a third larger. Increase serve.max_request_size in cog.yaml, which is %s", units.HumanSize(float64(size)), units.HumanSize(float64(p.maxRequestSize)))
+		}
+	}
+
+	// Stream the request body so large file inputs don't have to fit in memory
+	requestBody, requestWriter := io.Pipe()
+	go func() {
+		requestWriter.CloseWithError(inputs.writeRequest(requestWriter, id))
+	}()
+	defer requestBody.Close()
+
+	ctx, abandon := context.WithCancel(context.Background())
+	defer abandon()
+
+	req, err := p.newRequest(ctx, http.MethodPost, "/predictions", requestBody)
 	if err != nil {
 		return nil, err
 	}
 
-	url := fmt.Sprintf("http://localhost:%d/predictions", p.port)
-	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(requestBody))
-	if err != nil {
-		return nil, fmt.Errorf("Failed to create HTTP request to %s: %w", url, err)
+	var timedOut atomic.Bool
+	if timeout > 0 {
+		timer := time.AfterFunc(timeout, func() {
+			timedOut.Store(true)
+			console.Warnf("Prediction timed out after %s, canceling it...", timeout)
+			if err := p.Cancel(id); err != nil {
+				console.Warnf("Failed to cancel prediction: %s", err)
+			}
+			// If the model doesn't stop, stop waiting for it
+			time.AfterFunc(cancelGracePeriod, abandon)
+		})
+		defer timer.Stop()
 	}
-	req.Header.Set("Content-Type", "application/json")
 	req.Close = true
 
-	httpClient := &http.Client{}
-	resp, err := httpClient.Do(req)
+	resp, err := p.httpClient().Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to POST HTTP request to %s: %w", url, err)
+		if timedOut.Load() {
+			return nil, fmt.Errorf("Prediction timed out after %s, and did not stop when it was canceled", timeout)
+		}
+		return nil, fmt.Errorf("Failed to POST HTTP request to %s: %w", req.URL, err)
 	}
 	defer resp.Body.Close()
 
@@ -178,14 +295,47 @@ func (p *Predictor) Predict(inputs Inputs) (*Response, error) {
 	if err = json.NewDecoder(resp.Body).Decode(prediction); err != nil {
 		return nil, fmt.Errorf("Failed to decode prediction response: %w", err)
 	}
+	if timedOut.Load() && prediction.Status == "canceled" {
+		return nil, fmt.Errorf("Prediction timed out after %s and was canceled", timeout)
+	}
 	return prediction, nil
 }
 
+// Cancel cancels the running prediction with the ID id
+func (p *Predictor) Cancel(id string) error {
+	req, err := p.newRequest(context.Background(), http.MethodPost, "/predictions/"+id+"/cancel", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.httpClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("Failed to POST HTTP request to %s: %w", req.URL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("/predictions/%s/cancel call returned status %d", id, resp.StatusCode)
+	}
+	return nil
+}
+
+func newPredictionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("Failed to generate prediction ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
 func (p *Predictor) GetSchema() (*openapi3.T, error) {
-	resp, err := http.Get(fmt.Sprintf("http://localhost:%d/openapi.json", p.port))
+	req, err := p.newRequest(context.Background(), http.MethodGet, "/openapi.json", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.httpClient().Do(req)
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("Failed to get OpenAPI schema: %d", resp.StatusCode)
 	}
@@ -0,0 +1,107 @@
+package predict
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/replicate/cog/pkg/docker"
+)
+
+// Environment variables that make the model's worker profile predictions with the PyTorch profiler, see
+// python/cog/server/profiler.py
+const (
+	ProfileDirEnv   = "COG_PROFILE_DIR"
+	ProfileTorchEnv = "COG_PROFILE_TORCH"
+)
+
+// profileContainerDir is where the directory profiles are written to is mounted in the container
+const profileContainerDir = "/var/run/cog/profile"
+
+// pySpyPIDFile is where the PID of py-spy is kept in the container, so it can be stopped
+const pySpyPIDFile = "/tmp/cog-py-spy.pid"
+
+// pySpyInstallScript installs py-spy in the container if the image doesn't have it, and removes the PID file of
+// the last time it ran
+const pySpyInstallScript = `rm -f ` + pySpyPIDFile + ` && (command -v py-spy >/dev/null || pip install --quiet --disable-pip-version-check py-spy)`
+
+// pySpyRecordScript records a flamegraph of the HTTP server and its worker until it's interrupted. tini is PID 1,
+// so the server is found by its command line, which is matched with a pattern that doesn't match this script.
+const pySpyRecordScript = `pid=$(grep -l 'cog[.]server[.]http' /proc/[0-9]*/cmdline 2>/dev/null | cut -d/ -f3 | sort -n | head -n 1)
+if [ -z "$pid" ]; then echo "Failed to find the model's HTTP server" >&2; exit 1; fi
+echo $$ > ` + pySpyPIDFile + `
+exec py-spy record --pid "$pid" --subprocesses --nonblocking --output ` + profileContainerDir + `/flamegraph.svg`
+
+// pySpyStopScript interrupts py-spy and waits for it to write the flamegraph
+const pySpyStopScript = `pid=$(cat ` + pySpyPIDFile + `) && kill -INT "$pid" && while kill -0 "$pid" 2>/dev/null; do sleep 0.1; done`
+
+// EnableProfiling lets StartProfiler profile predictions with py-spy, and with the PyTorch profiler too if torch is
+// set, writing the profiles to dir. It must be called before Start.
+func (p *Predictor) EnableProfiling(dir string, torch bool) error {
+	if p.local != nil {
+		return fmt.Errorf("Profiling is only supported for models running in Docker")
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("Failed to create profile directory %s: %w", dir, err)
+	}
+	p.runOptions.Volumes = append(p.runOptions.Volumes, docker.Volume{Source: dir, Destination: profileContainerDir})
+	// py-spy needs to read the memory of the model's processes
+	p.runOptions.CapAdd = append(p.runOptions.CapAdd, "SYS_PTRACE")
+	if torch {
+		p.runOptions.Env = append(p.runOptions.Env, ProfileDirEnv+"="+profileContainerDir, ProfileTorchEnv+"=true")
+	}
+	return nil
+}
+
+// StartProfiler starts py-spy in the model's container, installing it if the image doesn't have it, and returns a
+// function that stops it once it has written the flamegraph. The model must have been started after EnableProfiling.
+func (p *Predictor) StartProfiler() (func() error, error) {
+	if p.containerID == "" {
+		return nil, fmt.Errorf("Profiling is only supported for models running in Docker")
+	}
+	if err := p.exec(pySpyInstallScript); err != nil {
+		return nil, fmt.Errorf("Failed to install py-spy in the container: %w", err)
+	}
+
+	recorder := make(chan error, 1)
+	go func() {
+		recorder <- p.exec(pySpyRecordScript)
+	}()
+	// Wait until py-spy is running, or has failed to start
+	for p.exec("test -s "+pySpyPIDFile) != nil {
+		select {
+		case err := <-recorder:
+			return nil, fmt.Errorf("Failed to start py-spy: %w", err)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	return func() error {
+		if err := p.exec(pySpyStopScript); err != nil {
+			return fmt.Errorf("Failed to stop py-spy: %w", err)
+		}
+		// py-spy exits with an error when it's interrupted
+		<-recorder
+		return nil
+	}, nil
+}
+
+// exec runs a shell script in the model's container, returning what it wrote to stderr if it fails
+func (p *Predictor) exec(script string) error {
+	var stderr bytes.Buffer
+	if err := docker.Exec(p.containerID, []string{"sh", "-c", script}, io.Discard, &stderr); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
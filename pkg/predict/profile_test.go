@@ -0,0 +1,28 @@
+package predict
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/docker"
+)
+
+func TestEnableProfiling(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "profile")
+	predictor := NewPredictor(docker.RunOptions{Image: "my-model"})
+	require.NoError(t, predictor.EnableProfiling(dir, false))
+	require.DirExists(t, dir)
+	require.Contains(t, predictor.runOptions.Volumes, docker.Volume{Source: dir, Destination: "/var/run/cog/profile"})
+	require.Equal(t, []string{"SYS_PTRACE"}, predictor.runOptions.CapAdd)
+	require.NotContains(t, predictor.runOptions.Env, "COG_PROFILE_TORCH=true")
+
+	predictor = NewPredictor(docker.RunOptions{Image: "my-model"})
+	require.NoError(t, predictor.EnableProfiling(dir, true))
+	require.Contains(t, predictor.runOptions.Env, "COG_PROFILE_DIR=/var/run/cog/profile")
+	require.Contains(t, predictor.runOptions.Env, "COG_PROFILE_TORCH=true")
+
+	_, err := predictor.StartProfiler()
+	require.ErrorContains(t, err, "only supported for models running in Docker")
+}
@@ -0,0 +1,50 @@
+package predict
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// NewRemotePredictor makes a predictor for a model that is already running somewhere else, e.g. a deployment, by
+// the URL of its HTTP server. header is sent with every request, e.g. to authenticate with the server.
+func NewRemotePredictor(baseURL string, header http.Header) (Predictor, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Predictor{}, fmt.Errorf("'%s' isn't the URL of a model's HTTP server, e.g. https://example.com", baseURL)
+	}
+	return Predictor{baseURL: strings.TrimSuffix(baseURL, "/"), header: header}, nil
+}
+
+// url returns the URL of path on the model's HTTP server
+func (p *Predictor) url(path string) string {
+	if p.baseURL != "" {
+		return p.baseURL + path
+	}
+	scheme := "http"
+	if p.https {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://localhost:%d%s", scheme, p.port, path)
+}
+
+// newRequest returns a request for path on the model's HTTP server, with the predictor's headers
+func (p *Predictor) newRequest(ctx context.Context, method string, path string, body io.Reader) (*http.Request, error) {
+	u := p.url(path)
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create HTTP request to %s: %w", u, err)
+	}
+	for name, values := range p.header {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
@@ -0,0 +1,76 @@
+package predict
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRemotePredictorRejectsOtherURLs(t *testing.T) {
+	for _, u := range []string{"example.com", "ftp://example.com", "https://"} {
+		_, err := NewRemotePredictor(u, nil)
+		require.ErrorContains(t, err, "isn't the URL of a model's HTTP server", u)
+	}
+}
+
+func TestRemotePredictor(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/health-check":
+			_, _ = w.Write([]byte(`{"status": "READY"}`))
+		case "/predictions":
+			request := map[string]interface{}{}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+			require.Equal(t, map[string]interface{}{"text": "hello"}, request["input"])
+			_, _ = w.Write([]byte(`{"status": "succeeded", "output": "hello world"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	predictor, err := NewRemotePredictor(server.URL+"/", http.Header{"Authorization": []string{"Bearer secret"}})
+	require.NoError(t, err)
+	require.NoError(t, predictor.Start(io.Discard))
+	prediction, err := predictor.Predict(Inputs{"text": Input{String: stringPtr("hello")}})
+	require.NoError(t, err)
+	require.Equal(t, "hello world", *prediction.Output)
+	// The model was already running, so it isn't stopped
+	require.NoError(t, predictor.Stop())
+
+	unauthorized, err := NewRemotePredictor(server.URL, nil)
+	require.NoError(t, err)
+	require.ErrorContains(t, unauthorized.Start(os.Stderr), "returned status 401")
+}
+
+func TestMaxRequestSize(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_, _ = w.Write([]byte(`{"status": "succeeded", "output": "hello"}`))
+	}))
+	t.Cleanup(server.Close)
+
+	predictor, err := NewRemotePredictor(server.URL, nil)
+	require.NoError(t, err)
+	predictor.SetMaxRequestSize(100)
+	_, err = predictor.Predict(Inputs{"text": Input{String: stringPtr("hello")}})
+	require.NoError(t, err)
+	_, err = predictor.Predict(Inputs{"text": Input{String: stringPtr(strings.Repeat("a", 100))}})
+	require.ErrorContains(t, err, "more than the model accepts")
+	require.Equal(t, 1, requests)
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,120 @@
+package predict
+
+import (
+	"crypto/x509"
+	"fmt"
+	"path/filepath"
+
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/global"
+)
+
+// RunnerProjectLabel is set on containers started by `cog start`, with the directory of the project they run
+var RunnerProjectLabel = global.LabelNamespace + "runner.project"
+
+// RunnerHashLabel is set on containers started by `cog start`, with the hash of the project's cog.yaml and code
+// they were started with
+var RunnerHashLabel = global.LabelNamespace + "runner.hash"
+
+// Runner is a long-lived model container started by `cog start`
+type Runner struct {
+	ContainerID string
+	ProjectDir  string
+	Image       string
+	Status      string
+	Port        int
+	// Hash is the hash of the project's cog.yaml and code it was started with
+	Hash string
+	// AuthToken is the token the model requires, if it was started with one
+	AuthToken string
+	// TLSCert is the certificate the model serves HTTPS with, in base64 DER, if it serves HTTPS
+	TLSCert string
+}
+
+// RunnerLabels returns the labels that mark a container as the runner for projectDir, started with the project's
+// cog.yaml and code that have the given hash
+func RunnerLabels(projectDir string, hash string) (map[string]string, error) {
+	absProjectDir, err := filepath.Abs(projectDir)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{RunnerProjectLabel: absProjectDir, RunnerHashLabel: hash}, nil
+}
+
+// ListRunners returns all running runners, or only the runner for projectDir if it is not empty
+func ListRunners(projectDir string) ([]Runner, error) {
+	labels := map[string]string{RunnerProjectLabel: ""}
+	if projectDir != "" {
+		absProjectDir, err := filepath.Abs(projectDir)
+		if err != nil {
+			return nil, err
+		}
+		labels[RunnerProjectLabel] = absProjectDir
+	}
+	ids, err := docker.ListContainers(labels)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list running models: %w", err)
+	}
+
+	runners := []Runner{}
+	for _, id := range ids {
+		cont, err := docker.ContainerInspect(id)
+		if err != nil {
+			// The container may have stopped since it was listed
+			continue
+		}
+		runner := Runner{ContainerID: id}
+		if cont.Config != nil {
+			runner.ProjectDir = cont.Config.Labels[RunnerProjectLabel]
+			runner.Image = cont.Config.Image
+			runner.Hash = cont.Config.Labels[RunnerHashLabel]
+			runner.AuthToken = authTokenFromEnv(cont.Config.Env)
+			runner.TLSCert = cont.Config.Labels[RunnerTLSCertLabel]
+		}
+		if cont.State != nil {
+			runner.Status = cont.State.Status
+		}
+		if port, err := docker.GetPort(id, containerPort); err == nil {
+			runner.Port = port
+		}
+		runners = append(runners, runner)
+	}
+	return runners, nil
+}
+
+// FindRunner returns the runner for projectDir, or nil if there isn't one
+func FindRunner(projectDir string) (*Runner, error) {
+	runners, err := ListRunners(projectDir)
+	if err != nil {
+		return nil, err
+	}
+	if len(runners) == 0 {
+		return nil, nil
+	}
+	return &runners[0], nil
+}
+
+// UpToDate returns whether the runner was started with the project's cog.yaml and code that have hash, rather than
+// older ones
+func (r *Runner) UpToDate(hash string) bool {
+	return r.Hash == hash
+}
+
+// Connect makes a predictor for a runner that is already running, waiting for it to be ready
+func (r *Runner) Connect() (Predictor, error) {
+	p := Predictor{containerID: r.ContainerID, port: r.Port}
+	if r.AuthToken != "" {
+		p.SetAuthToken(r.AuthToken)
+	}
+	cert, err := certificateFromLabel(r.TLSCert)
+	if err != nil {
+		return p, err
+	}
+	if cert != nil {
+		p.trustCertificates([]*x509.Certificate{cert})
+	}
+	if p.port == 0 {
+		return p, fmt.Errorf("Failed to determine port of container %s", r.ContainerID)
+	}
+	return p, p.waitForContainerReady()
+}
@@ -0,0 +1,100 @@
+package predict
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDocker puts a docker command on PATH that lists the container with labels, or none if labels is nil, and
+// returns the path of the file it records its arguments in
+func fakeDocker(t *testing.T, labels map[string]string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("The fake docker command is a shell script")
+	}
+	dir := t.TempDir()
+	inspect, err := json.Marshal([]map[string]interface{}{{
+		"Id":     "c0ffee",
+		"State":  map[string]interface{}{"Status": "running"},
+		"Config": map[string]interface{}{"Image": "cog-model-base", "Labels": labels, "Env": []string{AuthTokenEnv + "=secret"}},
+	}})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "inspect.json"), inspect, 0o644))
+
+	ps := ""
+	if labels != nil {
+		ps = "echo c0ffee"
+	}
+	callsPath := filepath.Join(dir, "calls")
+	script := `#!/bin/sh
+echo "$@" >> ` + callsPath + `
+case "$1" in
+ps) ` + ps + ` ;;
+container) cat ` + filepath.Join(dir, "inspect.json") + ` ;;
+port) echo 0.0.0.0:49153 ;;
+esac
+`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "docker"), []byte(script), 0o755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return callsPath
+}
+
+func readCalls(t *testing.T, callsPath string) []string {
+	t.Helper()
+	calls, err := os.ReadFile(callsPath)
+	require.NoError(t, err)
+	return strings.Split(strings.TrimSpace(string(calls)), "\n")
+}
+
+func TestFindRunner(t *testing.T) {
+	projectDir := t.TempDir()
+	labels, err := RunnerLabels(projectDir, "abc")
+	require.NoError(t, err)
+	callsPath := fakeDocker(t, labels)
+
+	runner, err := FindRunner(projectDir)
+	require.NoError(t, err)
+	require.Equal(t, &Runner{
+		ContainerID: "c0ffee",
+		ProjectDir:  projectDir,
+		Image:       "cog-model-base",
+		Status:      "running",
+		Port:        49153,
+		Hash:        "abc",
+		AuthToken:   "secret",
+	}, runner)
+	require.Equal(t, []string{
+		"ps --quiet --no-trunc --filter label=" + RunnerProjectLabel + "=" + projectDir,
+		"container inspect c0ffee",
+		"port c0ffee 5000",
+	}, readCalls(t, callsPath))
+
+	// The runner is reused until the project's cog.yaml or code changes
+	require.True(t, runner.UpToDate("abc"))
+	require.False(t, runner.UpToDate("def"))
+}
+
+func TestFindRunnerNotRunning(t *testing.T) {
+	fakeDocker(t, nil)
+	runner, err := FindRunner(t.TempDir())
+	require.NoError(t, err)
+	require.Nil(t, runner)
+}
+
+func TestListAllRunners(t *testing.T) {
+	labels, err := RunnerLabels(t.TempDir(), "abc")
+	require.NoError(t, err)
+	callsPath := fakeDocker(t, labels)
+
+	runners, err := ListRunners("")
+	require.NoError(t, err)
+	require.Len(t, runners, 1)
+	// Runners for every project have the label, whatever its value
+	require.Equal(t, "ps --quiet --no-trunc --filter label="+RunnerProjectLabel, readCalls(t, callsPath)[0])
+}
@@ -0,0 +1,176 @@
+package predict
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/global"
+)
+
+// Environment variables the model's HTTP server reads the certificate and key it serves HTTPS with from
+const (
+	TLSCertFileEnv = "COG_TLS_CERT_FILE"
+	TLSKeyFileEnv  = "COG_TLS_KEY_FILE"
+)
+
+// tlsContainerDir is where the certificate made by RequireTLS is mounted in the container
+const tlsContainerDir = "/var/run/cog/tls"
+
+// RunnerTLSCertLabel is set on containers that serve HTTPS, with the certificate they serve in base64 DER, so
+// later commands can trust it
+var RunnerTLSCertLabel = global.LabelNamespace + "runner.tls_cert"
+
+// RequireTLS makes the model serve HTTPS with a new self-signed certificate, which requests to it trust. It must be
+// called before Start.
+func (p *Predictor) RequireTLS() error {
+	cert, certPEM, keyPEM, err := newSelfSignedCertificate()
+	if err != nil {
+		return err
+	}
+	dir, err := os.MkdirTemp("", "cog-tls-")
+	if err != nil {
+		return fmt.Errorf("Failed to create temporary directory: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "cert.pem"), certPEM, 0o644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "key.pem"), keyPEM, 0o644); err != nil {
+		return err
+	}
+	// The server reads them when it starts, so they're removed once it's ready
+	p.tlsDir = dir
+
+	if p.local != nil {
+		p.local.Env = append(p.local.Env,
+			TLSCertFileEnv+"="+filepath.Join(dir, "cert.pem"),
+			TLSKeyFileEnv+"="+filepath.Join(dir, "key.pem"))
+	} else {
+		p.runOptions.Volumes = append(p.runOptions.Volumes, docker.Volume{Source: dir, Destination: tlsContainerDir})
+		p.runOptions.Env = append(p.runOptions.Env,
+			TLSCertFileEnv+"="+path.Join(tlsContainerDir, "cert.pem"),
+			TLSKeyFileEnv+"="+path.Join(tlsContainerDir, "key.pem"))
+		labels := map[string]string{RunnerTLSCertLabel: base64.StdEncoding.EncodeToString(cert.Raw)}
+		for k, v := range p.runOptions.Labels {
+			labels[k] = v
+		}
+		p.runOptions.Labels = labels
+	}
+	p.trustCertificates([]*x509.Certificate{cert})
+	return nil
+}
+
+// TrustCertificates makes requests to the model use HTTPS, and trust the certificates in certsPEM, e.g. the
+// self-signed certificate a model with serve.tls.auto generated
+func (p *Predictor) TrustCertificates(certsPEM []byte) error {
+	certs := []*x509.Certificate{}
+	for {
+		var block *pem.Block
+		block, certsPEM = pem.Decode(certsPEM)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("Failed to parse certificate: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return fmt.Errorf("There are no PEM certificates in the file")
+	}
+	p.trustCertificates(certs)
+	return nil
+}
+
+func (p *Predictor) trustCertificates(certs []*x509.Certificate) {
+	pool := x509.NewCertPool()
+	for _, cert := range certs {
+		pool.AddCert(cert)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	p.client = &http.Client{Transport: transport}
+	p.https = true
+}
+
+// httpClient returns the client that sends requests to the model
+func (p *Predictor) httpClient() *http.Client {
+	if p.client != nil {
+		return p.client
+	}
+	return http.DefaultClient
+}
+
+// certificateFromLabel returns the certificate in a RunnerTLSCertLabel, or nil if it isn't set
+func certificateFromLabel(label string) (*x509.Certificate, error) {
+	if label == "" {
+		return nil, nil
+	}
+	der, err := base64.StdEncoding.DecodeString(label)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode the model's certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse the model's certificate: %w", err)
+	}
+	return cert, nil
+}
+
+// newSelfSignedCertificate returns a certificate for localhost that is its own CA, and its key, as PEM
+func newSelfSignedCertificate() (*x509.Certificate, []byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("Failed to generate TLS key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("Failed to generate certificate serial number: %w", err)
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "cog"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(1, 0, 0),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("Failed to create TLS certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	return cert, certPEM, keyPEM, nil
+}
@@ -0,0 +1,57 @@
+package predict
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/docker"
+)
+
+func TestRequireTLS(t *testing.T) {
+	predictor := NewPredictor(docker.RunOptions{Image: "my-model", Labels: map[string]string{RunnerProjectLabel: "/src"}})
+	require.NoError(t, predictor.RequireTLS())
+	t.Cleanup(func() { os.RemoveAll(predictor.tlsDir) })
+
+	require.FileExists(t, filepath.Join(predictor.tlsDir, "cert.pem"))
+	require.FileExists(t, filepath.Join(predictor.tlsDir, "key.pem"))
+	require.Contains(t, predictor.runOptions.Volumes, docker.Volume{Source: predictor.tlsDir, Destination: "/var/run/cog/tls"})
+	require.Contains(t, predictor.runOptions.Env, "COG_TLS_CERT_FILE=/var/run/cog/tls/cert.pem")
+	require.Contains(t, predictor.runOptions.Env, "COG_TLS_KEY_FILE=/var/run/cog/tls/key.pem")
+	require.Equal(t, "/src", predictor.runOptions.Labels[RunnerProjectLabel])
+
+	cert, err := certificateFromLabel(predictor.runOptions.Labels[RunnerTLSCertLabel])
+	require.NoError(t, err)
+	require.Equal(t, []string{"localhost"}, cert.DNSNames)
+
+	predictor.port = 5000
+	require.Equal(t, "https://localhost:5000/health-check", predictor.url("/health-check"))
+}
+
+func TestTrustCertificates(t *testing.T) {
+	_, certPEM, keyPEM, err := newSelfSignedCertificate()
+	require.NoError(t, err)
+	keyPair, err := tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"status": "READY"}`))
+	}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{keyPair}}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	predictor, err := NewRemotePredictor(server.URL, nil)
+	require.NoError(t, err)
+	require.ErrorContains(t, predictor.Start(os.Stderr), "certificate")
+
+	require.NoError(t, predictor.TrustCertificates(certPEM))
+	require.NoError(t, predictor.Start(os.Stderr))
+
+	require.ErrorContains(t, predictor.TrustCertificates([]byte("not a certificate")), "no PEM certificates")
+}
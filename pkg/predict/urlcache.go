@@ -0,0 +1,187 @@
+package predict
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/util/mime"
+)
+
+// URLCacheDirEnv is the environment variable that sets where files downloaded from URLs are cached
+const URLCacheDirEnv = "COG_INPUT_CACHE_DIR"
+
+// URLCache is a content-addressed cache of files downloaded from URLs, shared by predictions, so inputs passed as
+// URLs are only downloaded again if they've changed
+type URLCache struct {
+	// Dir has the files, named by the SHA-256 of their contents, and what URLs they were downloaded from
+	Dir string
+	// Client downloads the files, or http.DefaultClient if it's nil
+	Client *http.Client
+}
+
+// urlCacheEntry is what the cache knows about a URL
+type urlCacheEntry struct {
+	URL          string `json:"url"`
+	File         string `json:"file"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// NewURLCache returns the cache in COG_INPUT_CACHE_DIR, or in the user's cache directory if it isn't set
+func NewURLCache() (*URLCache, error) {
+	dir := os.Getenv(URLCacheDirEnv)
+	if dir == "" {
+		cacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return nil, fmt.Errorf("Failed to find cache directory: %w", err)
+		}
+		dir = filepath.Join(cacheDir, "cog", "inputs")
+	}
+	return &URLCache{Dir: dir}, nil
+}
+
+// Fetch returns the path of a file with the contents of rawURL, downloading it unless the cache has it and the
+// server says it hasn't changed
+func (c *URLCache) Fetch(ctx context.Context, rawURL string) (string, error) {
+	entryPath := filepath.Join(c.Dir, "urls", sha256Hex([]byte(rawURL))+".json")
+	entry, err := readURLCacheEntry(entryPath)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("Failed to create HTTP request to %s: %w", rawURL, err)
+	}
+	if entry != nil {
+		if entry.ETag != "" {
+			req.Header.Set("If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			req.Header.Set("If-Modified-Since", entry.LastModified)
+		}
+	}
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("Failed to download %s: %w", rawURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && entry != nil {
+		console.Debugf("Using cached %s", rawURL)
+		return filepath.Join(c.Dir, "files", entry.File), nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Failed to download %s: status %d", rawURL, resp.StatusCode)
+	}
+
+	console.Infof("Downloading %s...", rawURL)
+	file, err := c.writeFile(resp.Body, urlExtension(rawURL, resp.Header.Get("Content-Type")))
+	if err != nil {
+		return "", fmt.Errorf("Failed to download %s: %w", rawURL, err)
+	}
+	entry = &urlCacheEntry{
+		URL:          rawURL,
+		File:         file,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+	if err := writeURLCacheEntry(entryPath, entry); err != nil {
+		return "", err
+	}
+	return filepath.Join(c.Dir, "files", file), nil
+}
+
+// writeFile writes r to the cache, named by the SHA-256 of its contents and ext, and returns its name
+func (c *URLCache) writeFile(r io.Reader, ext string) (string, error) {
+	filesDir := filepath.Join(c.Dir, "files")
+	if err := os.MkdirAll(filesDir, 0o755); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(filesDir, ".download-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hash), r); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	name := hex.EncodeToString(hash.Sum(nil)) + ext
+	// Renaming is atomic, so predictions running at the same time never see half a file
+	if err := os.Rename(tmp.Name(), filepath.Join(filesDir, name)); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+func readURLCacheEntry(p string) (*urlCacheEntry, error) {
+	contents, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entry := &urlCacheEntry{}
+	if err := json.Unmarshal(contents, entry); err != nil {
+		// It's only a cache, so it's downloaded again
+		return nil, nil
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(filepath.Dir(p)), "files", entry.File)); err != nil {
+		return nil, nil
+	}
+	return entry, nil
+}
+
+func writeURLCacheEntry(p string, entry *urlCacheEntry) error {
+	contents, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, contents, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+// urlExtension returns the extension of the file at rawURL, from its path, or otherwise its content type, so the
+// model gets a file with the right extension
+func urlExtension(rawURL string, contentType string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		if ext := path.Ext(u.Path); ext != "" && mime.TypeByExtension(ext) != "application/octet-stream" {
+			return ext
+		}
+	}
+	contentType, _, _ = strings.Cut(contentType, ";")
+	return mime.ExtensionByType(strings.TrimSpace(contentType))
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,90 @@
+package predict
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestURLCache(t *testing.T) {
+	contents := "first version"
+	etag := `"v1"`
+	downloads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		downloads++
+		w.Header().Set("ETag", etag)
+		_, _ = w.Write([]byte(contents))
+	}))
+	t.Cleanup(server.Close)
+
+	cache := &URLCache{Dir: t.TempDir()}
+	ctx := context.Background()
+
+	path, err := cache.Fetch(ctx, server.URL+"/audio.wav")
+	require.NoError(t, err)
+	require.Equal(t, ".wav", filepath.Ext(path))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "first version", string(data))
+
+	cached, err := cache.Fetch(ctx, server.URL+"/audio.wav")
+	require.NoError(t, err)
+	require.Equal(t, path, cached)
+	require.Equal(t, 1, downloads)
+
+	// The same contents from another URL are stored once
+	other, err := cache.Fetch(ctx, server.URL+"/other.wav")
+	require.NoError(t, err)
+	require.Equal(t, path, other)
+	require.Equal(t, 2, downloads)
+
+	contents = "second version"
+	etag = `"v2"`
+	changed, err := cache.Fetch(ctx, server.URL+"/audio.wav")
+	require.NoError(t, err)
+	require.NotEqual(t, path, changed)
+	data, err = os.ReadFile(changed)
+	require.NoError(t, err)
+	require.Equal(t, "second version", string(data))
+}
+
+func TestURLCacheDownloadsAgainIfFileIsMissing(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") != "" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write([]byte("not really a png"))
+	}))
+	t.Cleanup(server.Close)
+
+	cache := &URLCache{Dir: t.TempDir()}
+	path, err := cache.Fetch(context.Background(), server.URL+"/image")
+	require.NoError(t, err)
+	require.Equal(t, ".png", filepath.Ext(path))
+	require.NoError(t, os.Remove(path))
+
+	path, err = cache.Fetch(context.Background(), server.URL+"/image")
+	require.NoError(t, err)
+	require.FileExists(t, path)
+}
+
+func TestURLCacheFailedDownload(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(server.Close)
+
+	cache := &URLCache{Dir: t.TempDir()}
+	_, err := cache.Fetch(context.Background(), server.URL+"/missing.png")
+	require.ErrorContains(t, err, "status 404")
+}
@@ -0,0 +1,112 @@
+// Package predictor checks a model's predictor without running it, so mistakes in predict.py are found
+// before the image is built
+package predictor
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// analyzePy parses the predictor with Python's ast module and checks it like Cog does when it loads it
+//
+//go:embed analyze.py
+var analyzePy []byte
+
+// Problem is something wrong with a predictor
+type Problem struct {
+	// File is the path of the predictor's source file, relative to the project directory
+	File string
+	// Line is the line the problem is on, or 0 if it isn't on a line
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+func (p Problem) String() string {
+	if p.Line == 0 {
+		return fmt.Sprintf("%s: %s", p.File, p.Message)
+	}
+	return fmt.Sprintf("%s:%d: %s", p.File, p.Line, p.Message)
+}
+
+// ProblemsError is returned by Analyze when it finds problems with a predictor
+type ProblemsError struct {
+	Ref      string
+	Problems []Problem
+}
+
+func (e *ProblemsError) Error() string {
+	lines := []string{fmt.Sprintf("There are problems with %s:", e.Ref)}
+	for _, p := range e.Problems {
+		lines = append(lines, "    "+p.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ErrPythonNotFound is returned by Analyze if Python isn't installed, so the predictor can't be analyzed
+var ErrPythonNotFound = errors.New("python3 not found")
+
+// Analyze checks the predictor ref, e.g. predict.py:Predictor, in dir, without importing it. It checks that
+// the file parses, that the class has a predict() method whose inputs have types Cog supports, and that
+// setup() can be called by Cog. It returns a *ProblemsError if there are problems.
+func Analyze(dir string, ref string) error {
+	file, _, _ := strings.Cut(ref, ":")
+	out, err := runAnalyzer(dir, ref)
+	if err != nil {
+		return err
+	}
+	problems := []Problem{}
+	if err := json.Unmarshal(out, &problems); err != nil {
+		return fmt.Errorf("Failed to analyze %s: %w", ref, err)
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	for i := range problems {
+		problems[i].File = file
+	}
+	return &ProblemsError{Ref: ref, Problems: problems}
+}
+
+// Inputs returns the names of the inputs of the predictor ref in dir, without importing it, or nil if they can't
+// be worked out without running the code, e.g. because predict() is inherited from a class in another module
+func Inputs(dir string, ref string) ([]string, error) {
+	out, err := runAnalyzer(dir, ref, "--inputs")
+	if err != nil {
+		return nil, err
+	}
+	var inputs []string
+	if err := json.Unmarshal(out, &inputs); err != nil {
+		return nil, fmt.Errorf("Failed to analyze %s: %w", ref, err)
+	}
+	return inputs, nil
+}
+
+// runAnalyzer runs analyze.py on the predictor ref in dir with args, and returns what it prints
+func runAnalyzer(dir string, ref string, args ...string) ([]byte, error) {
+	file, name, ok := strings.Cut(ref, ":")
+	if !ok {
+		return nil, fmt.Errorf("'%s' must be in the form 'predict.py:Predictor'", ref)
+	}
+	python, err := exec.LookPath("python3")
+	if err != nil {
+		return nil, ErrPythonNotFound
+	}
+	cmd := exec.Command(python, append([]string{"-", filepath.Join(dir, file), name}, args...)...) //#nosec G204
+	cmd.Stdin = bytes.NewReader(analyzePy)
+	stderr := new(bytes.Buffer)
+	cmd.Stderr = stderr
+	console.Debug("$ " + strings.Join(cmd.Args, " "))
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to analyze %s: %w\n%s", ref, err, stderr.String())
+	}
+	return out, nil
+}
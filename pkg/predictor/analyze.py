@@ -0,0 +1,235 @@
+"""
+Checks a predictor without importing it, so mistakes are found before the
+image is built. It is run with the Python on the host, so it only uses the
+standard library, and works on Python 3.7 and later.
+
+Usage: python3 analyze.py <path to predict.py> <class or function name> [--inputs]
+
+It prints a JSON list of problems, each with the line they are on and a message.
+With --inputs, it prints the names of the predictor's inputs instead, or null if
+they can't be worked out.
+It only reports things Cog would definitely reject: anything it can't work out
+without running the code, like types imported from other modules, is allowed.
+"""
+import ast
+import json
+import sys
+
+ALLOWED_INPUT_TYPES = {
+    "builtins.str",
+    "builtins.int",
+    "builtins.float",
+    "builtins.bool",
+    "cog.Path",
+    "cog.File",
+    "cog.types.Path",
+    "cog.types.File",
+}
+CONTAINER_TYPES = {
+    "typing.Union",
+    "typing.List",
+    "builtins.list",
+}
+READABLE_TYPES = "str, int, float, bool, cog.File, cog.Path, or a Union or List of those types"
+
+
+class Analyzer:
+    def __init__(self, tree):
+        self.problems = []
+        # Maps names in the module to what they refer to, e.g. Path -> cog.Path
+        self.names = {}
+        self.classes = {}
+        self.functions = {}
+        for node in tree.body:
+            if isinstance(node, ast.Import):
+                for alias in node.names:
+                    self.names[alias.asname or alias.name] = alias.name
+            elif isinstance(node, ast.ImportFrom):
+                for alias in node.names:
+                    if node.level == 0 and node.module:
+                        self.names[alias.asname or alias.name] = (
+                            node.module + "." + alias.name
+                        )
+                    else:
+                        self.names[alias.asname or alias.name] = None
+            elif isinstance(node, ast.ClassDef):
+                self.classes[node.name] = node
+                self.names[node.name] = None
+            elif isinstance(node, (ast.FunctionDef, ast.AsyncFunctionDef)):
+                self.functions[node.name] = node
+                self.names[node.name] = None
+            elif isinstance(node, (ast.Assign, ast.AnnAssign)):
+                targets = node.targets if isinstance(node, ast.Assign) else [node.target]
+                for target in targets:
+                    if isinstance(target, ast.Name):
+                        self.names[target.id] = None
+
+    def problem(self, node, message):
+        self.problems.append({"line": node.lineno, "message": message})
+
+    def resolve(self, node):
+        """
+        Returns the qualified name of a name or attribute, e.g. cog.Path, or None
+        if it can't be worked out without running the code.
+        """
+        if isinstance(node, ast.Name):
+            if node.id in self.names:
+                return self.names[node.id]
+            if node.id in ("str", "int", "float", "bool", "list"):
+                return "builtins." + node.id
+            return None
+        if isinstance(node, ast.Attribute):
+            base = self.resolve(node.value)
+            if base is None and isinstance(node.value, ast.Name):
+                base = self.names.get(node.value.id, node.value.id)
+            return base + "." + node.attr if base else None
+        return None
+
+    def check_input_type(self, annotation, name):
+        if isinstance(annotation, ast.BinOp) and isinstance(annotation.op, ast.BitOr):
+            self.check_input_type(annotation.left, name)
+            self.check_input_type(annotation.right, name)
+            return
+        if isinstance(annotation, ast.Subscript):
+            container = self.resolve(annotation.value)
+            if container == "typing.Optional":
+                self.problem(
+                    annotation,
+                    f"Unsupported input type Optional for parameter `{name}`. Give the parameter a default instead",
+                )
+                return
+            if container not in CONTAINER_TYPES:
+                return
+            args = annotation.slice
+            # Python 3.8 wraps subscripts in ast.Index
+            if hasattr(ast, "Index") and isinstance(args, getattr(ast, "Index")):
+                args = args.value
+            for arg in args.elts if isinstance(args, ast.Tuple) else [args]:
+                self.check_input_type(arg, name)
+            return
+        if isinstance(annotation, ast.Constant) and annotation.value is None:
+            self.problem(
+                annotation,
+                f"Unsupported input type None for parameter `{name}`. Give the parameter a default instead",
+            )
+            return
+        qualified = self.resolve(annotation)
+        if qualified is None or qualified in ALLOWED_INPUT_TYPES:
+            return
+        if qualified.startswith(("builtins.", "pathlib.", "typing.")) or qualified in (
+            "cog.Input",
+            "cog.BasePredictor",
+        ):
+            self.problem(
+                annotation,
+                f"Unsupported input type {qualified.replace('builtins.', '')} for parameter `{name}`. Supported input types are: {READABLE_TYPES}",
+            )
+
+    def check_predict(self, func):
+        args = func.args
+        if args.vararg or args.kwarg:
+            star = args.vararg or args.kwarg
+            self.problem(
+                star,
+                f"{func.name}() can't take *{star.arg} or **{star.arg}: each input must be a named parameter",
+            )
+        params = getattr(args, "posonlyargs", []) + args.args + args.kwonlyargs
+        if params and params[0].arg == "self":
+            params = params[1:]
+        for param in params:
+            if param.annotation is None:
+                self.problem(
+                    param,
+                    f"No input type provided for parameter `{param.arg}`. Supported input types are: {READABLE_TYPES}",
+                )
+            else:
+                self.check_input_type(param.annotation, param.arg)
+
+    def check_setup(self, func):
+        args = func.args
+        params = getattr(args, "posonlyargs", []) + args.args
+        defaults = [None] * (len(params) - len(args.defaults)) + list(args.defaults)
+        for param, default in list(zip(params, defaults))[1:]:
+            if param.arg != "weights" and default is None:
+                self.problem(
+                    param,
+                    f"setup() has a parameter `{param.arg}` without a default, but Cog only passes it `weights`",
+                )
+
+    def find_method(self, cls, name, seen=()):
+        for node in cls.body:
+            if isinstance(node, (ast.FunctionDef, ast.AsyncFunctionDef)) and node.name == name:
+                return node, True
+        known = True
+        for base in cls.bases:
+            if isinstance(base, ast.Name) and base.id in self.classes and base.id not in seen:
+                method, base_known = self.find_method(
+                    self.classes[base.id], name, seen + (cls.name,)
+                )
+                if method is not None:
+                    return method, True
+                known = known and base_known
+            elif self.resolve(base) not in ("cog.BasePredictor", "cog.predictor.BasePredictor"):
+                # It could be inherited from a class in another module
+                known = False
+        return None, known
+
+    def inputs(self, name):
+        """
+        Returns the names of the inputs of predict(), or None if they can't be
+        worked out without running the code.
+        """
+        if name in self.functions:
+            func = self.functions[name]
+        elif name in self.classes:
+            func, _ = self.find_method(self.classes[name], "predict")
+        else:
+            return None
+        if func is None or func.args.vararg or func.args.kwarg:
+            return None
+        args = func.args
+        params = getattr(args, "posonlyargs", []) + args.args + args.kwonlyargs
+        if name in self.classes and params and params[0].arg == "self":
+            params = params[1:]
+        return [param.arg for param in params]
+
+    def check(self, name):
+        if name in self.functions:
+            self.check_predict(self.functions[name])
+            return
+        if name not in self.classes:
+            # It could come from a star import
+            if name not in self.names and "*" not in self.names:
+                self.problems.append(
+                    {"line": 0, "message": f"There is no class or function called {name}"}
+                )
+            return
+        cls = self.classes[name]
+        predict, known = self.find_method(cls, "predict")
+        if predict is not None:
+            self.check_predict(predict)
+        elif known:
+            self.problem(cls, f"{name} doesn't have a predict() method")
+        setup, _ = self.find_method(cls, "setup")
+        if setup is not None:
+            self.check_setup(setup)
+
+
+def main(path, name, inputs=False):
+    with open(path, encoding="utf-8") as f:
+        source = f.read()
+    try:
+        tree = ast.parse(source, filename=path)
+    except SyntaxError as e:
+        if inputs:
+            return None
+        return [{"line": e.lineno or 0, "message": f"Syntax error: {e.msg}"}]
+    analyzer = Analyzer(tree)
+    if inputs:
+        return analyzer.inputs(name)
+    analyzer.check(name)
+    return sorted(analyzer.problems, key=lambda p: p["line"])
+
+
+if __name__ == "__main__":
+    print(json.dumps(main(sys.argv[1], sys.argv[2], sys.argv[3:] == ["--inputs"])))
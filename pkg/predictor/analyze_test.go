@@ -0,0 +1,106 @@
+package predictor
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func analyze(t *testing.T, source string) []string {
+	t.Helper()
+	if _, err := exec.LookPath("python3"); err != nil {
+		t.Skip("python3 not found")
+	}
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "predict.py"), []byte(source), 0o644))
+	err := Analyze(dir, "predict.py:Predictor")
+	if err == nil {
+		return nil
+	}
+	var problemsErr *ProblemsError
+	require.True(t, errors.As(err, &problemsErr), err.Error())
+	problems := []string{}
+	for _, p := range problemsErr.Problems {
+		problems = append(problems, p.String())
+	}
+	return problems
+}
+
+func TestAnalyzeValidPredictor(t *testing.T) {
+	require.Empty(t, analyze(t, `
+from typing import List, Union
+from cog import BasePredictor, Input, Path
+from mymodule import Custom
+
+class Predictor(BasePredictor):
+    def setup(self, weights=None):
+        pass
+
+    def predict(self, prompt: str, images: List[Path], scale: Union[int, float] = 1, other: Custom = None) -> str:
+        return prompt
+`))
+}
+
+func TestAnalyzeInvalidPredictor(t *testing.T) {
+	require.Equal(t, []string{
+		"predict.py:6: setup() has a parameter `model` without a default, but Cog only passes it `weights`",
+		"predict.py:8: Unsupported input type pathlib.Path for parameter `image`. Supported input types are: str, int, float, bool, cog.File, cog.Path, or a Union or List of those types",
+		"predict.py:8: No input type provided for parameter `scale`. Supported input types are: str, int, float, bool, cog.File, cog.Path, or a Union or List of those types",
+	}, analyze(t, `
+from pathlib import Path
+from cog import BasePredictor
+
+class Predictor(BasePredictor):
+    def setup(self, model):
+        pass
+    def predict(self, image: Path, scale=1) -> str:
+        pass
+`))
+}
+
+func TestAnalyzeSyntaxError(t *testing.T) {
+	problems := analyze(t, "class Predictor:\n    def predict(self:\n")
+	require.Len(t, problems, 1)
+	require.Contains(t, problems[0], "predict.py:2: Syntax error")
+}
+
+func TestAnalyzeMissingPredictor(t *testing.T) {
+	require.Equal(t, []string{"predict.py: There is no class or function called Predictor"}, analyze(t, "class Model:\n    pass\n"))
+	require.Equal(t, []string{"predict.py:1: Predictor doesn't have a predict() method"}, analyze(t, "class Predictor:\n    pass\n"))
+}
+
+func TestInputs(t *testing.T) {
+	if _, err := exec.LookPath("python3"); err != nil {
+		t.Skip("python3 not found")
+	}
+	for _, tc := range []struct {
+		source string
+		inputs []string
+	}{
+		{`
+from cog import BasePredictor, Input
+
+class Base(BasePredictor):
+    def predict(self, prompt: str, num_steps: int = Input(default=20)) -> str:
+        return prompt
+
+class Predictor(Base):
+    pass
+`, []string{"prompt", "num_steps"}},
+		{"def Predictor(text: str, *, fast: bool = False) -> str:\n    return text\n", []string{"text", "fast"}},
+		// predict() could come from a class in another module
+		{"from models import Base\n\nclass Predictor(Base):\n    pass\n", nil},
+		{"class Predictor:\n    def predict(self, **inputs) -> str:\n        pass\n", nil},
+		{"class Predictor:\n    def predict(self:\n", nil},
+	} {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "predict.py"), []byte(tc.source), 0o644))
+		inputs, err := Inputs(dir, "predict.py:Predictor")
+		require.NoError(t, err)
+		require.Equal(t, tc.inputs, inputs, tc.source)
+	}
+}
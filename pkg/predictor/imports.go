@@ -0,0 +1,112 @@
+package predictor
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	importRe     = regexp.MustCompile(`(?m)^[ \t]*import[ \t]+([^#\n]+)`)
+	fromImportRe = regexp.MustCompile(`(?m)^[ \t]*from[ \t]+(\.*)([\w.]*)[ \t]+import[ \t]+(\([^)]*\)|[^#\n]+)`)
+	// lineContinuationRe matches a backslash at the end of a line, which continues the statement on the next
+	lineContinuationRe = regexp.MustCompile(`\\\r?\n`)
+)
+
+// LocalImports returns the Python files in dir that files import, directly or through other files, including
+// files themselves. Paths are relative to dir. Modules that aren't in dir, like installed packages, are left out.
+//
+// It finds imports by scanning the source rather than running it, so it finds imports inside functions and
+// conditions, and imports in strings and docstrings too. That only means it can find more files than are needed.
+func LocalImports(dir string, files []string) ([]string, error) {
+	found := map[string]bool{}
+	queue := append([]string{}, files...)
+	for len(queue) > 0 {
+		file := path.Clean(filepath.ToSlash(queue[0]))
+		queue = queue[1:]
+		if found[file] {
+			continue
+		}
+		found[file] = true
+
+		source, err := os.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read %s: %w", file, err)
+		}
+		for _, module := range importedModules(file, string(source)) {
+			for _, candidate := range moduleFiles(dir, module) {
+				if !found[candidate] {
+					queue = append(queue, candidate)
+				}
+			}
+		}
+	}
+
+	imports := make([]string, 0, len(found))
+	for file := range found {
+		imports = append(imports, file)
+	}
+	sort.Strings(imports)
+	return imports, nil
+}
+
+// importedModules returns the modules that the Python file imports, as paths relative to the project directory
+// without an extension, e.g. "models/unet" for "import models.unet". Relative imports are resolved against file.
+func importedModules(file string, source string) []string {
+	source = lineContinuationRe.ReplaceAllString(source, " ")
+	modules := []string{}
+	for _, match := range importRe.FindAllStringSubmatch(source, -1) {
+		for _, name := range strings.Split(match[1], ",") {
+			name = strings.TrimSpace(strings.Split(strings.TrimSpace(name), " ")[0])
+			if name != "" {
+				modules = append(modules, strings.ReplaceAll(name, ".", "/"))
+			}
+		}
+	}
+	for _, match := range fromImportRe.FindAllStringSubmatch(source, -1) {
+		base := ""
+		if dots := len(match[1]); dots > 0 {
+			base = path.Dir(file)
+			for i := 1; i < dots; i++ {
+				base = path.Dir(base)
+			}
+		}
+		module := path.Join(base, strings.ReplaceAll(match[2], ".", "/"))
+		modules = append(modules, module)
+		// The imported names could be submodules, e.g. from models import unet
+		names := strings.Trim(strings.TrimSpace(match[3]), "()")
+		for _, name := range strings.Split(names, ",") {
+			name = strings.TrimSpace(strings.Split(strings.TrimSpace(name), " ")[0])
+			if name != "" && name != "*" {
+				modules = append(modules, path.Join(module, name))
+			}
+		}
+	}
+	return modules
+}
+
+// moduleFiles returns the files in dir for module, and the __init__.py files of the packages it is in
+func moduleFiles(dir string, module string) []string {
+	files := []string{}
+	parts := strings.Split(module, "/")
+	for i := 1; i < len(parts); i++ {
+		files = appendIfExists(files, dir, path.Join(append(parts[:i:i], "__init__.py")...))
+	}
+	files = appendIfExists(files, dir, module+".py")
+	files = appendIfExists(files, dir, path.Join(module, "__init__.py"))
+	return files
+}
+
+func appendIfExists(files []string, dir string, file string) []string {
+	if file == "" || strings.HasPrefix(file, "../") {
+		return files
+	}
+	if info, err := os.Stat(filepath.Join(dir, file)); err == nil && !info.IsDir() {
+		return append(files, file)
+	}
+	return files
+}
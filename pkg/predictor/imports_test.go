@@ -0,0 +1,62 @@
+package predictor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalImports(t *testing.T) {
+	dir := t.TempDir()
+	for name, contents := range map[string]string{
+		"predict.py": `import os, json
+import torch
+from cog import BasePredictor
+from models import (
+    unet,
+    vae as autoencoder,
+)
+import utils.images as images
+from helpers import *
+
+class Predictor(BasePredictor):
+    def setup(self):
+        from lazy import loader
+`,
+		"models/__init__.py":         "",
+		"models/unet.py":             "from .layers import attention\nfrom . import blocks\n",
+		"models/vae.py":              "",
+		"models/layers/__init__.py":  "",
+		"models/layers/attention.py": "",
+		"models/blocks.py":           "",
+		"models/unused.py":           "",
+		"utils/images.py":            "",
+		"helpers.py":                 "import \\\n    common\n",
+		"common.py":                  "",
+		"lazy/__init__.py":           "",
+		"lazy/loader.py":             "",
+		"train.py":                   "",
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(contents), 0o644))
+	}
+
+	imports, err := LocalImports(dir, []string{"predict.py"})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"common.py",
+		"helpers.py",
+		"lazy/__init__.py",
+		"lazy/loader.py",
+		"models/__init__.py",
+		"models/blocks.py",
+		"models/layers/__init__.py",
+		"models/layers/attention.py",
+		"models/unet.py",
+		"models/vae.py",
+		"predict.py",
+		"utils/images.py",
+	}, imports)
+}
@@ -0,0 +1,168 @@
+// Package provenance describes how a model image was built, as SLSA provenance in an in-toto statement
+package provenance
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/replicate/cog/pkg/global"
+)
+
+const (
+	// StatementType is the in-toto statement type
+	StatementType = "https://in-toto.io/Statement/v1"
+	// PredicateType is the SLSA provenance predicate type
+	PredicateType = "https://slsa.dev/provenance/v1"
+	// BuildType describes how Cog builds images, so consumers know how to interpret the parameters
+	BuildType = "https://cog.run/provenance/build/v1"
+	// BuilderID identifies Cog as the builder
+	BuilderID = "https://github.com/replicate/cog"
+)
+
+// Statement is an in-toto statement that the image in its subject was built as described by its predicate
+type Statement struct {
+	Type          string    `json:"_type"`
+	Subject       []Subject `json:"subject"`
+	PredicateType string    `json:"predicateType"`
+	Predicate     Predicate `json:"predicate"`
+}
+
+type Subject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// Predicate is SLSA provenance
+type Predicate struct {
+	BuildDefinition BuildDefinition `json:"buildDefinition"`
+	RunDetails      RunDetails      `json:"runDetails"`
+}
+
+type BuildDefinition struct {
+	BuildType            string                 `json:"buildType"`
+	ExternalParameters   map[string]interface{} `json:"externalParameters"`
+	InternalParameters   map[string]interface{} `json:"internalParameters,omitempty"`
+	ResolvedDependencies []ResourceDescriptor   `json:"resolvedDependencies,omitempty"`
+}
+
+type ResourceDescriptor struct {
+	URI    string            `json:"uri,omitempty"`
+	Name   string            `json:"name,omitempty"`
+	Digest map[string]string `json:"digest,omitempty"`
+}
+
+type RunDetails struct {
+	Builder  Builder       `json:"builder"`
+	Metadata BuildMetadata `json:"metadata"`
+}
+
+type Builder struct {
+	ID      string            `json:"id"`
+	Version map[string]string `json:"version,omitempty"`
+}
+
+type BuildMetadata struct {
+	StartedOn  string `json:"startedOn,omitempty"`
+	FinishedOn string `json:"finishedOn,omitempty"`
+}
+
+// Options describe a build of an image
+type Options struct {
+	// Image is the name of the image, without a tag if Digest is a registry digest
+	Image string
+	// Digest is the image's digest in the form "sha256:...", either from a registry or its local ID
+	Digest string
+	// Config is the contents of cog.yaml
+	Config []byte
+	// Format is the format the image was built in, e.g. "sagemaker"
+	Format string
+	// GitURL and GitCommit are the repository and commit of the model's source, if it is in Git
+	GitURL    string
+	GitCommit string
+	// GitDirty is whether the model's source had uncommitted changes
+	GitDirty   bool
+	StartedOn  time.Time
+	FinishedOn time.Time
+}
+
+// New returns the provenance for a build of an image
+func New(opts Options) *Statement {
+	external := map[string]interface{}{
+		"config": map[string]interface{}{
+			"path":   global.ConfigFilename,
+			"digest": map[string]string{"sha256": sha256Hex(opts.Config)},
+		},
+	}
+	if opts.Format != "" {
+		external["format"] = opts.Format
+	}
+	if opts.GitURL != "" || opts.GitCommit != "" {
+		external["source"] = sourceURI(opts.GitURL)
+	}
+
+	dependencies := []ResourceDescriptor{}
+	if opts.GitCommit != "" {
+		dependencies = append(dependencies, ResourceDescriptor{
+			URI:    sourceURI(opts.GitURL),
+			Digest: map[string]string{"gitCommit": opts.GitCommit},
+		})
+	}
+
+	return &Statement{
+		Type:          StatementType,
+		Subject:       []Subject{{Name: opts.Image, Digest: digestMap(opts.Digest)}},
+		PredicateType: PredicateType,
+		Predicate: Predicate{
+			BuildDefinition: BuildDefinition{
+				BuildType:          BuildType,
+				ExternalParameters: external,
+				InternalParameters: map[string]interface{}{
+					"cogVersion": global.Version,
+					"gitDirty":   opts.GitDirty,
+				},
+				ResolvedDependencies: dependencies,
+			},
+			RunDetails: RunDetails{
+				Builder: Builder{
+					ID:      BuilderID,
+					Version: map[string]string{"cog": global.Version},
+				},
+				Metadata: BuildMetadata{
+					StartedOn:  formatTime(opts.StartedOn),
+					FinishedOn: formatTime(opts.FinishedOn),
+				},
+			},
+		},
+	}
+}
+
+// sourceURI returns the URI of a Git repository in the form SLSA expects, e.g. "git+https://github.com/replicate/cog"
+func sourceURI(gitURL string) string {
+	if gitURL == "" || strings.HasPrefix(gitURL, "git+") {
+		return gitURL
+	}
+	return "git+" + gitURL
+}
+
+// digestMap turns "sha256:abc" into {"sha256": "abc"}
+func digestMap(digest string) map[string]string {
+	algorithm, value, found := strings.Cut(digest, ":")
+	if !found {
+		return map[string]string{"sha256": digest}
+	}
+	return map[string]string{algorithm: value}
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
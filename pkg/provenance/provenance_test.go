@@ -0,0 +1,60 @@
+package provenance
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/global"
+)
+
+func TestNew(t *testing.T) {
+	statement := New(Options{
+		Image:      "r8.im/alice/hotdog",
+		Digest:     "sha256:abc123",
+		Config:     []byte("build:\n  gpu: true\n"),
+		Format:     "sagemaker",
+		GitURL:     "https://github.com/alice/hotdog.git",
+		GitCommit:  "0123456789abcdef",
+		StartedOn:  time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		FinishedOn: time.Date(2024, 1, 2, 3, 14, 5, 0, time.UTC),
+	})
+
+	require.Equal(t, StatementType, statement.Type)
+	require.Equal(t, PredicateType, statement.PredicateType)
+	require.Equal(t, []Subject{{Name: "r8.im/alice/hotdog", Digest: map[string]string{"sha256": "abc123"}}}, statement.Subject)
+
+	definition := statement.Predicate.BuildDefinition
+	require.Equal(t, BuildType, definition.BuildType)
+	require.Equal(t, "sagemaker", definition.ExternalParameters["format"])
+	require.Equal(t, "git+https://github.com/alice/hotdog.git", definition.ExternalParameters["source"])
+	require.Equal(t, map[string]interface{}{
+		"path":   "cog.yaml",
+		"digest": map[string]string{"sha256": "69be1080f5b248ab7070b25ec87683cfb30be401bc0eb98d6490a2b0a1e22dcd"},
+	}, definition.ExternalParameters["config"])
+	require.Equal(t, []ResourceDescriptor{{
+		URI:    "git+https://github.com/alice/hotdog.git",
+		Digest: map[string]string{"gitCommit": "0123456789abcdef"},
+	}}, definition.ResolvedDependencies)
+
+	details := statement.Predicate.RunDetails
+	require.Equal(t, BuilderID, details.Builder.ID)
+	require.Equal(t, global.Version, details.Builder.Version["cog"])
+	require.Equal(t, "2024-01-02T03:04:05Z", details.Metadata.StartedOn)
+	require.Equal(t, "2024-01-02T03:14:05Z", details.Metadata.FinishedOn)
+
+	data, err := json.Marshal(statement)
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"_type":"https://in-toto.io/Statement/v1"`)
+}
+
+func TestNewWithoutGit(t *testing.T) {
+	statement := New(Options{Image: "hotdog", Digest: "sha256:abc123", Config: []byte("")})
+
+	definition := statement.Predicate.BuildDefinition
+	require.NotContains(t, definition.ExternalParameters, "source")
+	require.Empty(t, definition.ResolvedDependencies)
+	require.Equal(t, "", statement.Predicate.RunDetails.Metadata.StartedOn)
+}
@@ -0,0 +1,206 @@
+package replay
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif"  // decoders for comparing images
+	_ "image/jpeg" // decoders for comparing images
+	_ "image/png"  // decoders for comparing images
+	"math"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/vincent-petithory/dataurl"
+)
+
+// Options are how close an output has to be to the recorded one to match
+type Options struct {
+	// Tolerance is how far numbers can be from the recorded ones, relative to the larger of them, or absolute for
+	// numbers smaller than 1
+	Tolerance float64
+	// ImageDistance is how many of the 64 bits of the perceptual hashes of images can differ
+	ImageDistance int
+}
+
+// DefaultOptions allow for the rounding errors and compression artifacts of running a model on other hardware
+var DefaultOptions = Options{Tolerance: 1e-6, ImageDistance: 5}
+
+// Compare returns the differences between the output a model returned for a fixture and the fixture's recorded
+// output, or nothing if they match. Files are compared byte for byte, except images, which are compared by their
+// perceptual hashes, so small changes in pixels don't fail.
+func Compare(fixture *Fixture, dir string, name string, output interface{}, opts Options) []string {
+	c := comparison{dir: dir, filePrefix: "@" + name + "/", opts: opts}
+	c.compare("output", fixture.Output, output)
+	return c.differences
+}
+
+type comparison struct {
+	dir         string
+	filePrefix  string
+	opts        Options
+	differences []string
+}
+
+func (c *comparison) differ(path string, format string, args ...interface{}) {
+	c.differences = append(c.differences, path+": "+fmt.Sprintf(format, args...))
+}
+
+func (c *comparison) compare(path string, expected interface{}, actual interface{}) {
+	switch e := expected.(type) {
+	case string:
+		if strings.HasPrefix(e, c.filePrefix) {
+			c.compareFile(path, e, actual)
+			return
+		}
+		if a, ok := actual.(string); !ok || a != e {
+			c.differ(path, "expected %s, got %s", summarize(e), summarize(actual))
+		}
+	case float64:
+		a, ok := actual.(float64)
+		if !ok {
+			c.differ(path, "expected %v, got %s", e, summarize(actual))
+			return
+		}
+		if math.Abs(a-e) > c.opts.Tolerance*math.Max(1, math.Max(math.Abs(a), math.Abs(e))) {
+			c.differ(path, "expected %v, got %v", e, a)
+		}
+	case []interface{}:
+		a, ok := actual.([]interface{})
+		if !ok {
+			c.differ(path, "expected a list, got %s", summarize(actual))
+			return
+		}
+		if len(a) != len(e) {
+			c.differ(path, "expected %d items, got %d", len(e), len(a))
+			return
+		}
+		for i := range e {
+			c.compare(fmt.Sprintf("%s[%d]", path, i), e[i], a[i])
+		}
+	case map[string]interface{}:
+		a, ok := actual.(map[string]interface{})
+		if !ok {
+			c.differ(path, "expected an object, got %s", summarize(actual))
+			return
+		}
+		keys := []string{}
+		for k := range e {
+			keys = append(keys, k)
+		}
+		for k := range a {
+			if _, ok := e[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			ev, inExpected := e[k]
+			av, inActual := a[k]
+			switch {
+			case !inActual:
+				c.differ(path+"."+k, "missing")
+			case !inExpected:
+				c.differ(path+"."+k, "unexpected %s", summarize(av))
+			default:
+				c.compare(path+"."+k, ev, av)
+			}
+		}
+	default:
+		if expected != actual {
+			c.differ(path, "expected %s, got %s", summarize(expected), summarize(actual))
+		}
+	}
+}
+
+func (c *comparison) compareFile(path string, reference string, actual interface{}) {
+	a, ok := actual.(string)
+	if !ok || !strings.HasPrefix(a, "data:") {
+		c.differ(path, "expected a file, got %s", summarize(actual))
+		return
+	}
+	got, err := dataurl.DecodeString(a)
+	if err != nil {
+		c.differ(path, "failed to decode the file: %s", err)
+		return
+	}
+	want, err := os.ReadFile(filepath.Join(c.dir, strings.TrimPrefix(reference, "@")))
+	if err != nil {
+		c.differ(path, "failed to read the recorded file: %s", err)
+		return
+	}
+	if bytes.Equal(want, got.Data) {
+		return
+	}
+	wantImage, _, wantErr := image.Decode(bytes.NewReader(want))
+	gotImage, _, gotErr := image.Decode(bytes.NewReader(got.Data))
+	if wantErr != nil || gotErr != nil {
+		c.differ(path, "the file is different from %s", reference)
+		return
+	}
+	if distance := bits.OnesCount64(imageHash(wantImage) ^ imageHash(gotImage)); distance > c.opts.ImageDistance {
+		c.differ(path, "the image looks different from %s (%d of 64 bits of their perceptual hashes differ)", reference, distance)
+	}
+}
+
+// imageHash returns the difference hash of img: whether each pixel is brighter than the one to its right, in a 9x8
+// grayscale thumbnail of it. Images that look the same have hashes that differ by only a few bits.
+func imageHash(img image.Image) uint64 {
+	const width, height = 9, 8
+	bounds := img.Bounds()
+	var thumbnail [height][width]float64
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			// Average the pixels the thumbnail's pixel covers
+			x0 := bounds.Min.X + x*bounds.Dx()/width
+			x1 := bounds.Min.X + (x+1)*bounds.Dx()/width
+			y0 := bounds.Min.Y + y*bounds.Dy()/height
+			y1 := bounds.Min.Y + (y+1)*bounds.Dy()/height
+			if x1 == x0 {
+				x1++
+			}
+			if y1 == y0 {
+				y1++
+			}
+			var sum float64
+			for py := y0; py < y1; py++ {
+				for px := x0; px < x1; px++ {
+					r, g, b, _ := img.At(px, py).RGBA()
+					sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+				}
+			}
+			thumbnail[y][x] = sum / float64((x1-x0)*(y1-y0))
+		}
+	}
+	var hash uint64
+	for y := 0; y < height; y++ {
+		for x := 0; x < width-1; x++ {
+			hash <<= 1
+			if thumbnail[y][x] > thumbnail[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// summarize returns a short description of an output value, so differences between long outputs are readable
+func summarize(v interface{}) string {
+	if v == nil {
+		return "null"
+	}
+	s, ok := v.(string)
+	if !ok {
+		return fmt.Sprintf("%v", v)
+	}
+	if strings.HasPrefix(s, "data:") {
+		return "a file"
+	}
+	if len(s) > 80 {
+		s = s[:77] + "..."
+	}
+	return fmt.Sprintf("%q", s)
+}
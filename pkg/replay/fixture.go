@@ -0,0 +1,166 @@
+// Package replay records predictions as fixtures, and checks a model still returns the same outputs for them, so a
+// project's fixtures are a regression suite for new builds
+package replay
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vincent-petithory/dataurl"
+
+	"github.com/replicate/cog/pkg/predict"
+	"github.com/replicate/cog/pkg/util/files"
+	"github.com/replicate/cog/pkg/util/mime"
+)
+
+// DefaultDir is the directory, relative to the project, that fixtures are recorded in
+const DefaultDir = "fixtures"
+
+// Fixture is the inputs of a prediction and the output the model returned. It's stored as name.json in the fixtures
+// directory, and the files in it are in a directory called name next to it, referred to as @name/file like the
+// files in examples.
+type Fixture struct {
+	Input  map[string]interface{} `json:"input"`
+	Output interface{}            `json:"output"`
+}
+
+// List returns the names of the fixtures in dir, sorted alphabetically
+func List(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() && filepath.Ext(entry.Name()) == ".json" {
+			names = append(names, strings.TrimSuffix(entry.Name(), ".json"))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Load reads the fixture called name from dir, and returns it with its inputs, ready to send to the model
+func Load(dir string, name string) (*Fixture, predict.Inputs, error) {
+	contents, err := os.ReadFile(filepath.Join(dir, name+".json"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to read fixture %s: %w", name, err)
+	}
+	fixture := &Fixture{}
+	if err := json.Unmarshal(contents, fixture); err != nil {
+		return nil, nil, fmt.Errorf("Failed to parse fixture %s: %w", name, err)
+	}
+	keyVals := map[string]string{}
+	for key, val := range fixture.Input {
+		switch v := val.(type) {
+		case string:
+			keyVals[key] = v
+		case float64:
+			keyVals[key] = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			keyVals[key] = strconv.FormatBool(v)
+		default:
+			return nil, nil, fmt.Errorf("Input '%s' of fixture %s must be a string, number or boolean", key, name)
+		}
+	}
+	return fixture, predict.NewInputsWithBaseDir(keyVals, dir), nil
+}
+
+// Record writes a fixture called name to dir with inputs and the output the model returned for them. File inputs
+// and outputs are copied into the fixture, so it doesn't depend on files elsewhere.
+func Record(dir string, name string, inputs predict.Inputs, output interface{}) error {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return fmt.Errorf("'%s' isn't a valid fixture name. It must be a file name, like hotdog", name)
+	}
+	filesDir := filepath.Join(dir, name)
+	// Files from an earlier recording with the same name would be left behind
+	if err := os.RemoveAll(filesDir); err != nil {
+		return err
+	}
+	fixture := Fixture{Input: map[string]interface{}{}}
+	for key, input := range inputs {
+		switch {
+		case input.File != nil:
+			isDir, err := files.IsDir(*input.File)
+			if err != nil {
+				return fmt.Errorf("Failed to read input %s: %w", *input.File, err)
+			}
+			if isDir {
+				return fmt.Errorf("Input '%s' is a directory, which can't be recorded", key)
+			}
+			if err := os.MkdirAll(filesDir, 0o755); err != nil {
+				return err
+			}
+			fileName := key + filepath.Ext(*input.File)
+			if err := files.CopyFile(*input.File, filepath.Join(filesDir, fileName)); err != nil {
+				return fmt.Errorf("Failed to copy input %s: %w", *input.File, err)
+			}
+			fixture.Input[key] = "@" + name + "/" + fileName
+		case input.String != nil:
+			fixture.Input[key] = *input.String
+		}
+	}
+	var err error
+	if fixture.Output, err = recordOutput(output, "output", dir, name); err != nil {
+		return err
+	}
+	contents, err := json.MarshalIndent(fixture, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, name+".json"), append(contents, '\n'), 0o644)
+}
+
+// recordOutput returns output with the files in it, which are data URLs, written to the fixture's directory and
+// replaced by references to them. key names the files after where they are in the output, e.g. output.0.png.
+func recordOutput(output interface{}, key string, dir string, name string) (interface{}, error) {
+	switch v := output.(type) {
+	case string:
+		if !strings.HasPrefix(v, "data:") {
+			return v, nil
+		}
+		data, err := dataurl.DecodeString(v)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to decode output file: %w", err)
+		}
+		if err := os.MkdirAll(filepath.Join(dir, name), 0o755); err != nil {
+			return nil, err
+		}
+		fileName := key + mime.ExtensionByType(data.ContentType())
+		if err := os.WriteFile(filepath.Join(dir, name, fileName), data.Data, 0o644); err != nil {
+			return nil, err
+		}
+		return "@" + name + "/" + fileName, nil
+	case []interface{}:
+		recorded := make([]interface{}, len(v))
+		for i, item := range v {
+			var err error
+			if recorded[i], err = recordOutput(item, fmt.Sprintf("%s.%d", key, i), dir, name); err != nil {
+				return nil, err
+			}
+		}
+		return recorded, nil
+	case map[string]interface{}:
+		recorded := map[string]interface{}{}
+		for k, item := range v {
+			var err error
+			if recorded[k], err = recordOutput(item, key+"."+k, dir, name); err != nil {
+				return nil, err
+			}
+		}
+		return recorded, nil
+	default:
+		return v, nil
+	}
+}
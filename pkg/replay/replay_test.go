@@ -0,0 +1,124 @@
+package replay
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vincent-petithory/dataurl"
+
+	"github.com/replicate/cog/pkg/predict"
+)
+
+// gradient returns an image that gets brighter from left to right, or right to left if mirrored
+func gradient(t *testing.T, encode func(*bytes.Buffer, image.Image) error, mirrored bool) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			v := x
+			if mirrored {
+				v = 63 - x
+			}
+			img.Set(x, y, color.RGBA{uint8(v * 4), uint8(v*2 + y), uint8(v * 3), 255})
+		}
+	}
+	var buf bytes.Buffer
+	require.NoError(t, encode(&buf, img))
+	return buf.Bytes()
+}
+
+func encodePNG(buf *bytes.Buffer, img image.Image) error {
+	return png.Encode(buf, img)
+}
+
+func encodeJPEG(buf *bytes.Buffer, img image.Image) error {
+	return jpeg.Encode(buf, img, &jpeg.Options{Quality: 70})
+}
+
+func TestRecordAndLoad(t *testing.T) {
+	dir := t.TempDir()
+	inputPath := filepath.Join(t.TempDir(), "input.jpg")
+	require.NoError(t, os.WriteFile(inputPath, []byte("not really a jpeg"), 0o644))
+	imageData := gradient(t, encodePNG, false)
+
+	inputs := predict.NewInputs(map[string]string{"image": "@" + inputPath, "scale": "2"})
+	output := map[string]interface{}{
+		"images": []interface{}{dataurl.New(imageData, "image/png").String()},
+		"score":  0.5,
+	}
+	require.NoError(t, Record(dir, "hotdog", inputs, output))
+
+	names, err := List(dir)
+	require.NoError(t, err)
+	require.Equal(t, []string{"hotdog"}, names)
+
+	fixture, loaded, err := Load(dir, "hotdog")
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"image": "@hotdog/image.jpg", "scale": "2"}, fixture.Input)
+	require.Equal(t, map[string]interface{}{"images": []interface{}{"@hotdog/output.images.0.png"}, "score": 0.5}, fixture.Output)
+	require.Equal(t, filepath.Join(dir, "hotdog", "image.jpg"), *loaded["image"].File)
+	require.Equal(t, "2", *loaded["scale"].String)
+	recorded, err := os.ReadFile(filepath.Join(dir, "hotdog", "output.images.0.png"))
+	require.NoError(t, err)
+	require.Equal(t, imageData, recorded)
+
+	require.Empty(t, Compare(fixture, dir, "hotdog", output, DefaultOptions))
+
+	require.ErrorContains(t, Record(dir, "../hotdog", inputs, output), "isn't a valid fixture name")
+}
+
+func TestCompare(t *testing.T) {
+	fixture := &Fixture{Output: map[string]interface{}{
+		"text":   "a hot dog",
+		"score":  0.5,
+		"labels": []interface{}{"hot dog", "sausage"},
+	}}
+
+	require.Empty(t, Compare(fixture, "", "test", map[string]interface{}{
+		"text":   "a hot dog",
+		"score":  0.5000000001,
+		"labels": []interface{}{"hot dog", "sausage"},
+	}, DefaultOptions))
+
+	require.Equal(t, []string{
+		"output.extra: unexpected true",
+		"output.labels: expected 2 items, got 1",
+		"output.score: expected 0.5, got 0.6",
+		"output.text: missing",
+	}, Compare(fixture, "", "test", map[string]interface{}{
+		"score":  0.6,
+		"labels": []interface{}{"hot dog"},
+		"extra":  true,
+	}, DefaultOptions))
+
+	require.Empty(t, Compare(fixture, "", "test", map[string]interface{}{
+		"text":   "a hot dog",
+		"score":  0.6,
+		"labels": []interface{}{"hot dog", "sausage"},
+	}, Options{Tolerance: 0.2}))
+}
+
+func TestCompareImages(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "test"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "test", "output.png"), gradient(t, encodePNG, false), 0o644))
+	fixture := &Fixture{Output: "@test/output.png"}
+
+	// The same image, compressed differently
+	jpegOutput := dataurl.New(gradient(t, encodeJPEG, false), "image/jpeg").String()
+	require.Empty(t, Compare(fixture, dir, "test", jpegOutput, DefaultOptions))
+
+	mirrored := dataurl.New(gradient(t, encodePNG, true), "image/png").String()
+	differences := Compare(fixture, dir, "test", mirrored, DefaultOptions)
+	require.Len(t, differences, 1)
+	require.Contains(t, differences[0], "the image looks different")
+
+	differences = Compare(fixture, dir, "test", dataurl.New([]byte("not an image"), "text/plain").String(), DefaultOptions)
+	require.Equal(t, []string{"output: the file is different from @test/output.png"}, differences)
+}
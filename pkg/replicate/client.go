@@ -0,0 +1,207 @@
+package replicate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/replicate/cog/pkg/global"
+)
+
+// TokenEnvVar is the environment variable the Replicate API token is read from
+const TokenEnvVar = "REPLICATE_API_TOKEN"
+
+// ErrNotFound is returned when a model or deployment doesn't exist
+var ErrNotFound = fmt.Errorf("Not found")
+
+type Client struct {
+	BaseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+type Model struct {
+	Owner      string `json:"owner"`
+	Name       string `json:"name"`
+	Visibility string `json:"visibility"`
+}
+
+type Version struct {
+	ID         string `json:"id"`
+	CreatedAt  string `json:"created_at"`
+	CogVersion string `json:"cog_version"`
+}
+
+type DeploymentConfiguration struct {
+	Hardware     string `json:"hardware,omitempty"`
+	MinInstances *int   `json:"min_instances,omitempty"`
+	MaxInstances *int   `json:"max_instances,omitempty"`
+}
+
+type Deployment struct {
+	Owner          string `json:"owner"`
+	Name           string `json:"name"`
+	CurrentRelease struct {
+		Number        int                     `json:"number"`
+		Model         string                  `json:"model"`
+		Version       string                  `json:"version"`
+		Configuration DeploymentConfiguration `json:"configuration"`
+	} `json:"current_release"`
+}
+
+// NewClient creates a client for the Replicate API, authenticated with token
+func NewClient(token string) *Client {
+	return &Client{
+		BaseURL:    "https://" + global.ReplicateAPIHost + "/v1",
+		token:      token,
+		httpClient: &http.Client{},
+	}
+}
+
+// NewClientFromEnv creates a client for the Replicate API with the token in REPLICATE_API_TOKEN
+func NewClientFromEnv() (*Client, error) {
+	token := os.Getenv(TokenEnvVar)
+	if token == "" {
+		return nil, fmt.Errorf("%s is not set. Get an API token from https://%s/account/api-tokens", TokenEnvVar, global.ReplicateWebsiteHost)
+	}
+	return NewClient(token), nil
+}
+
+// ParseImageName returns the owner and name of the model in a Replicate image name, like r8.im/owner/name
+func ParseImageName(imageName string) (owner string, name string, err error) {
+	prefix := global.ReplicateRegistryHost + "/"
+	if !strings.HasPrefix(imageName, prefix) {
+		return "", "", fmt.Errorf("Image name '%s' is not on Replicate, it must be in the form %sowner/name", imageName, prefix)
+	}
+	// Ignore any tag, because Replicate makes a version for every push
+	parts := strings.Split(strings.SplitN(strings.TrimPrefix(imageName, prefix), ":", 2)[0], "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("Image name '%s' is not valid, it must be in the form %sowner/name", imageName, prefix)
+	}
+	return parts[0], parts[1], nil
+}
+
+func (c *Client) GetModel(owner string, name string) (*Model, error) {
+	model := &Model{}
+	if err := c.request(http.MethodGet, fmt.Sprintf("/models/%s/%s", owner, name), nil, model); err != nil {
+		return nil, err
+	}
+	return model, nil
+}
+
+// CreateModel creates a model. visibility is "public" or "private", and hardware is the SKU the model runs on by default, e.g. "gpu-a40-large"
+func (c *Client) CreateModel(owner string, name string, visibility string, hardware string) (*Model, error) {
+	body := map[string]string{
+		"owner":      owner,
+		"name":       name,
+		"visibility": visibility,
+		"hardware":   hardware,
+	}
+	model := &Model{}
+	if err := c.request(http.MethodPost, "/models", body, model); err != nil {
+		return nil, err
+	}
+	return model, nil
+}
+
+// LatestVersion returns the most recently pushed version of a model
+func (c *Client) LatestVersion(owner string, name string) (*Version, error) {
+	page := struct {
+		Results []Version `json:"results"`
+	}{}
+	if err := c.request(http.MethodGet, fmt.Sprintf("/models/%s/%s/versions", owner, name), nil, &page); err != nil {
+		return nil, err
+	}
+	if len(page.Results) == 0 {
+		return nil, ErrNotFound
+	}
+	return &page.Results[0], nil
+}
+
+func (c *Client) GetDeployment(owner string, name string) (*Deployment, error) {
+	deployment := &Deployment{}
+	if err := c.request(http.MethodGet, fmt.Sprintf("/deployments/%s/%s", owner, name), nil, deployment); err != nil {
+		return nil, err
+	}
+	return deployment, nil
+}
+
+// CreateDeployment creates a deployment called name that runs version of model, which is in the form owner/name
+func (c *Client) CreateDeployment(name string, model string, version string, configuration DeploymentConfiguration) (*Deployment, error) {
+	body := struct {
+		Name    string `json:"name"`
+		Model   string `json:"model"`
+		Version string `json:"version"`
+		DeploymentConfiguration
+	}{name, model, version, configuration}
+	deployment := &Deployment{}
+	if err := c.request(http.MethodPost, "/deployments", body, deployment); err != nil {
+		return nil, err
+	}
+	return deployment, nil
+}
+
+// UpdateDeployment makes a deployment run version. Empty fields in configuration are left as they are.
+func (c *Client) UpdateDeployment(owner string, name string, version string, configuration DeploymentConfiguration) (*Deployment, error) {
+	body := struct {
+		Version string `json:"version"`
+		DeploymentConfiguration
+	}{version, configuration}
+	deployment := &Deployment{}
+	if err := c.request(http.MethodPatch, fmt.Sprintf("/deployments/%s/%s", owner, name), body, deployment); err != nil {
+		return nil, err
+	}
+	return deployment, nil
+}
+
+func (c *Client) request(method string, path string, body interface{}, out interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	url := c.BaseURL + path
+	req, err := http.NewRequest(method, url, reqBody)
+	if err != nil {
+		return fmt.Errorf("Failed to create HTTP request to %s: %w", url, err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "cog/"+global.Version)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("Failed to %s %s: %w", method, url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		// The API returns errors as {"detail": "..."}
+		apiError := struct {
+			Detail string `json:"detail"`
+		}{}
+		if err := json.NewDecoder(resp.Body).Decode(&apiError); err == nil && apiError.Detail != "" {
+			return fmt.Errorf("Replicate API returned status %d: %s", resp.StatusCode, apiError.Detail)
+		}
+		return fmt.Errorf("Replicate API returned status %d for %s %s", resp.StatusCode, method, path)
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("Failed to decode response from %s: %w", url, err)
+	}
+	return nil
+}
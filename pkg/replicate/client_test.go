@@ -0,0 +1,86 @@
+package replicate
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseImageName(t *testing.T) {
+	owner, name, err := ParseImageName("r8.im/alice/hotdog-detector")
+	require.NoError(t, err)
+	require.Equal(t, "alice", owner)
+	require.Equal(t, "hotdog-detector", name)
+
+	owner, name, err = ParseImageName("r8.im/alice/hotdog-detector:latest")
+	require.NoError(t, err)
+	require.Equal(t, "alice", owner)
+	require.Equal(t, "hotdog-detector", name)
+
+	_, _, err = ParseImageName("docker.io/alice/hotdog-detector")
+	require.Error(t, err)
+	_, _, err = ParseImageName("r8.im/hotdog-detector")
+	require.Error(t, err)
+}
+
+func TestLatestVersion(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		require.Equal(t, "/models/alice/hotdog-detector/versions", r.URL.Path)
+		_, _ = w.Write([]byte(`{"results": [{"id": "v2", "created_at": "2023-02-01"}, {"id": "v1", "created_at": "2023-01-01"}]}`))
+	}))
+	defer server.Close()
+
+	client := NewClient("secret")
+	client.BaseURL = server.URL
+	version, err := client.LatestVersion("alice", "hotdog-detector")
+	require.NoError(t, err)
+	require.Equal(t, "v2", version.ID)
+}
+
+func TestUpdateDeployment(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPatch, r.Method)
+		require.Equal(t, "/deployments/alice/hotdog", r.URL.Path)
+		body := map[string]interface{}{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		require.Equal(t, map[string]interface{}{"version": "v2", "max_instances": float64(3)}, body)
+		_, _ = w.Write([]byte(`{"owner": "alice", "name": "hotdog", "current_release": {"number": 2, "version": "v2"}}`))
+	}))
+	defer server.Close()
+
+	client := NewClient("secret")
+	client.BaseURL = server.URL
+	maxInstances := 3
+	deployment, err := client.UpdateDeployment("alice", "hotdog", "v2", DeploymentConfiguration{MaxInstances: &maxInstances})
+	require.NoError(t, err)
+	require.Equal(t, 2, deployment.CurrentRelease.Number)
+}
+
+func TestNotFound(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	client := NewClient("secret")
+	client.BaseURL = server.URL
+	_, err := client.GetDeployment("alice", "hotdog")
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"detail": "You do not have permission"}`))
+	}))
+	defer server.Close()
+
+	client := NewClient("secret")
+	client.BaseURL = server.URL
+	_, err := client.GetModel("alice", "hotdog")
+	require.ErrorContains(t, err, "status 403: You do not have permission")
+}
@@ -0,0 +1,188 @@
+// Package secrets finds API keys, tokens and private keys, so they aren't built into images by mistake
+package secrets
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// patterns match the secrets of common services, by the kind of secret they are
+var patterns = []struct {
+	kind    string
+	pattern *regexp.Regexp
+}{
+	{"AWS access key", regexp.MustCompile(`\bAKIA[0-9A-Z]{16}\b`)},
+	{"GitHub token", regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+	{"Hugging Face token", regexp.MustCompile(`\bhf_[A-Za-z0-9]{30,}\b`)},
+	{"Replicate API token", regexp.MustCompile(`\br8_[A-Za-z0-9]{30,}\b`)},
+	{"Stripe secret key", regexp.MustCompile(`\bsk_live_[A-Za-z0-9]{24,}\b`)},
+	{"OpenAI or Anthropic API key", regexp.MustCompile(`\bsk-[A-Za-z0-9_\-]{20,}`)},
+	{"Slack token", regexp.MustCompile(`\bxox[baprs]-[A-Za-z0-9\-]{10,}`)},
+	{"Google API key", regexp.MustCompile(`\bAIza[0-9A-Za-z_\-]{35}\b`)},
+	{"private key", regexp.MustCompile(`-----BEGIN ([A-Z]+ )?PRIVATE KEY-----`)},
+}
+
+// secretNameWords are the words in environment variable names that usually hold secrets
+var secretNameWords = []string{"SECRET", "SECRETS", "TOKEN", "PASSWORD", "PASSWD", "APIKEY", "CREDENTIAL", "CREDENTIALS"}
+
+// secretNamePairs are the pairs of words in environment variable names that usually hold secrets
+var secretNamePairs = [][2]string{{"API", "KEY"}, {"ACCESS", "KEY"}, {"PRIVATE", "KEY"}, {"SECRET", "KEY"}}
+
+// Find returns the kind of secret that s contains, e.g. "Hugging Face token", or an empty string if it doesn't have one
+func Find(s string) string {
+	for _, p := range patterns {
+		if p.pattern.MatchString(s) {
+			return p.kind
+		}
+	}
+	return ""
+}
+
+// IsSecretName returns whether name is the name of an environment variable that usually holds a secret, e.g.
+// HF_TOKEN or AWS_SECRET_ACCESS_KEY. Only whole words count, so TOKENIZERS_PARALLELISM isn't one.
+func IsSecretName(name string) bool {
+	words := strings.FieldsFunc(strings.ToUpper(name), func(r rune) bool {
+		return r == '_' || r == '-' || r == '.'
+	})
+	for i, word := range words {
+		for _, secretWord := range secretNameWords {
+			if word == secretWord {
+				return true
+			}
+		}
+		if i == 0 {
+			continue
+		}
+		for _, pair := range secretNamePairs {
+			if words[i-1] == pair[0] && word == pair[1] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MaxScanSize is how big a file can be before ScanFile skips it. Bigger files are usually weights or data.
+const MaxScanSize = 1024 * 1024
+
+// binarySniffSize is how much of a file is checked for NUL bytes, which only binary files have
+const binarySniffSize = 8000
+
+// Finding is a secret that was found in a file
+type Finding struct {
+	// Path is the path of the file, relative to the directory that was scanned
+	Path string
+	// Line is the line the secret is on, or 0 if the whole file is a secret, like an SSH private key
+	Line int
+	// Kind is the kind of secret, e.g. "Hugging Face token"
+	Kind string
+}
+
+func (f Finding) String() string {
+	if f.Line == 0 {
+		return f.Path + ": " + f.Kind
+	}
+	return fmt.Sprintf("%s:%d: %s", f.Path, f.Line, f.Kind)
+}
+
+// FileKind returns the kind of secret that a file called name usually is, like a .env file or an SSH private key,
+// or an empty string if it isn't usually one. name is a slash-separated path.
+func FileKind(name string) string {
+	base := path.Base(name)
+	switch {
+	case base == ".env" || strings.HasPrefix(base, ".env.") && !isExampleEnvFile(base):
+		return ".env file"
+	case base == "id_rsa" || base == "id_dsa" || base == "id_ecdsa" || base == "id_ed25519":
+		return "SSH private key"
+	case base == ".netrc":
+		return ".netrc file"
+	case base == ".git-credentials":
+		return "Git credentials"
+	case base == ".pypirc":
+		return "PyPI credentials"
+	case base == "credentials" && path.Base(path.Dir(name)) == ".aws":
+		return "AWS credentials"
+	}
+	return ""
+}
+
+func isExampleEnvFile(name string) bool {
+	for _, suffix := range []string{".example", ".sample", ".template", ".dist"} {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ScanFile looks for a secret in the file at filePath, which is called name in the finding. It returns nil if
+// there isn't one. Binary files, and files bigger than MaxScanSize, are only checked by their name.
+func ScanFile(filePath string, name string) (*Finding, error) {
+	if kind := FileKind(name); kind != "" {
+		return &Finding{Path: name, Kind: kind}, nil
+	}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > MaxScanSize {
+		return nil, nil
+	}
+	contents, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	sniff := contents
+	if len(sniff) > binarySniffSize {
+		sniff = sniff[:binarySniffSize]
+	}
+	if bytes.IndexByte(sniff, 0) != -1 {
+		return nil, nil
+	}
+	for i, line := range strings.Split(string(contents), "\n") {
+		if kind := Find(line); kind != "" {
+			return &Finding{Path: name, Line: i + 1, Kind: kind}, nil
+		}
+	}
+	return nil, nil
+}
+
+// Contains returns the index of the first of values that is in what r reads, or -1 if none of them are. It reads
+// r in chunks, so it can search through big files and archives.
+func Contains(r io.Reader, values [][]byte) (int, error) {
+	longest := 0
+	for _, value := range values {
+		if len(value) > longest {
+			longest = len(value)
+		}
+	}
+	if longest == 0 {
+		return -1, nil
+	}
+	// Each chunk starts with the end of the previous one, so values that span two chunks are found
+	buf := make([]byte, 0, 64*1024+longest)
+	chunk := make([]byte, 64*1024)
+	for {
+		n, err := r.Read(chunk)
+		buf = append(buf, chunk[:n]...)
+		for i, value := range values {
+			if len(value) > 0 && bytes.Contains(buf, value) {
+				return i, nil
+			}
+		}
+		if err == io.EOF {
+			return -1, nil
+		}
+		if err != nil {
+			return -1, err
+		}
+		if keep := longest - 1; len(buf) > keep {
+			buf = append(buf[:0], buf[len(buf)-keep:]...)
+		}
+	}
+}
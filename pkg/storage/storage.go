@@ -0,0 +1,135 @@
+// Package storage uploads files to object storage. It runs the cloud providers' CLIs, so credentials work the same
+// way they do for them, e.g. with profiles, SSO or the metadata server.
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// URL prefixes of the object storage files can be uploaded to
+const (
+	S3Prefix  = "s3://"
+	GCSPrefix = "gs://"
+)
+
+// MaxS3URLExpiry is the longest a presigned S3 URL can be valid for
+const MaxS3URLExpiry = 7 * 24 * time.Hour
+
+// IsURL returns whether s is the URL of an object or prefix in object storage, like s3://bucket/key
+func IsURL(s string) bool {
+	return strings.HasPrefix(s, S3Prefix) || strings.HasPrefix(s, GCSPrefix)
+}
+
+// Upload writes the contents of r to the object at url
+func Upload(ctx context.Context, r io.Reader, url string, contentType string) error {
+	args, err := uploadArgs(url, contentType)
+	if err != nil {
+		return err
+	}
+	if err := lookPath(args[0], url); err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...) //#nosec G204
+	cmd.Env = os.Environ()
+	cmd.Stdin = r
+	cmd.Stdout = os.Stderr // it only prints progress
+	cmd.Stderr = os.Stderr
+	console.Debug("$ " + strings.Join(cmd.Args, " "))
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("Failed to upload to %s: %w", url, err)
+	}
+	return nil
+}
+
+// SignURL returns an HTTPS URL that anyone can download the object at url from, until expiry has passed
+func SignURL(ctx context.Context, url string, expiry time.Duration) (string, error) {
+	args, err := signArgs(url, expiry)
+	if err != nil {
+		return "", err
+	}
+	if err := lookPath(args[0], url); err != nil {
+		return "", err
+	}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...) //#nosec G204
+	cmd.Env = os.Environ()
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	console.Debug("$ " + strings.Join(cmd.Args, " "))
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("Failed to sign a URL for %s: %w\n%s", url, err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func uploadArgs(url string, contentType string) ([]string, error) {
+	if err := checkObjectURL(url); err != nil {
+		return nil, err
+	}
+	switch {
+	case strings.HasPrefix(url, S3Prefix):
+		args := []string{"aws", "s3", "cp", "--only-show-errors", "-", url}
+		if contentType != "" {
+			args = append(args, "--content-type", contentType)
+		}
+		return args, nil
+	default:
+		args := []string{"gcloud", "storage", "cp", "-", url}
+		if contentType != "" {
+			args = append(args, "--content-type="+contentType)
+		}
+		return args, nil
+	}
+}
+
+func signArgs(url string, expiry time.Duration) ([]string, error) {
+	if err := checkObjectURL(url); err != nil {
+		return nil, err
+	}
+	seconds := int64(expiry / time.Second)
+	if seconds <= 0 {
+		return nil, fmt.Errorf("Signed URLs must be valid for at least a second")
+	}
+	switch {
+	case strings.HasPrefix(url, S3Prefix):
+		if expiry > MaxS3URLExpiry {
+			return nil, fmt.Errorf("Signed S3 URLs can be valid for at most %s", MaxS3URLExpiry)
+		}
+		return []string{"aws", "s3", "presign", url, "--expires-in", fmt.Sprint(seconds)}, nil
+	default:
+		return []string{"gcloud", "storage", "sign-url", url, fmt.Sprintf("--duration=%ds", seconds), "--format=value(signed_url)"}, nil
+	}
+}
+
+// checkObjectURL checks url is the URL of an object, with a bucket and a key
+func checkObjectURL(url string) error {
+	if !IsURL(url) {
+		return fmt.Errorf("%s isn't an s3:// or gs:// URL", url)
+	}
+	rest := strings.TrimPrefix(strings.TrimPrefix(url, S3Prefix), GCSPrefix)
+	bucket, key, _ := strings.Cut(rest, "/")
+	if bucket == "" || key == "" || strings.HasSuffix(key, "/") {
+		return fmt.Errorf("%s isn't the URL of an object, like s3://bucket/output.png", url)
+	}
+	return nil
+}
+
+// lookPath checks the CLI that uploads to url is installed
+func lookPath(name string, url string) error {
+	if _, err := exec.LookPath(name); err == nil {
+		return nil
+	}
+	if name == "aws" {
+		return fmt.Errorf("Uploading to %s needs the AWS CLI, but aws isn't installed. See https://aws.amazon.com/cli/", url)
+	}
+	return fmt.Errorf("Uploading to %s needs the Google Cloud CLI, but gcloud isn't installed. See https://cloud.google.com/sdk/docs/install", url)
+}
@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsURL(t *testing.T) {
+	require.True(t, IsURL("s3://bucket/outputs/"))
+	require.True(t, IsURL("gs://bucket/output.png"))
+	require.False(t, IsURL("outputs/"))
+	require.False(t, IsURL("https://example.com/output.png"))
+}
+
+func TestUploadArgs(t *testing.T) {
+	args, err := uploadArgs("s3://bucket/outputs/output.png", "image/png")
+	require.NoError(t, err)
+	require.Equal(t, []string{"aws", "s3", "cp", "--only-show-errors", "-", "s3://bucket/outputs/output.png", "--content-type", "image/png"}, args)
+
+	args, err = uploadArgs("gs://bucket/output.txt", "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"gcloud", "storage", "cp", "-", "gs://bucket/output.txt"}, args)
+
+	for _, url := range []string{"s3://bucket", "s3://bucket/outputs/", "gs:///output.png", "outputs/output.png"} {
+		_, err := uploadArgs(url, "")
+		require.Error(t, err, url)
+	}
+}
+
+func TestSignArgs(t *testing.T) {
+	args, err := signArgs("s3://bucket/output.png", time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, []string{"aws", "s3", "presign", "s3://bucket/output.png", "--expires-in", "3600"}, args)
+
+	args, err = signArgs("gs://bucket/output.png", 24*time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, []string{"gcloud", "storage", "sign-url", "gs://bucket/output.png", "--duration=86400s", "--format=value(signed_url)"}, args)
+
+	_, err = signArgs("s3://bucket/output.png", 8*24*time.Hour)
+	require.ErrorContains(t, err, "at most")
+	_, err = signArgs("s3://bucket/output.png", 0)
+	require.ErrorContains(t, err, "at least a second")
+}
@@ -0,0 +1,42 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// failureCategories are the categories of build errors, in the order they're checked. The error's message is
+// matched, rather than sent, because it can have paths, image names and secrets in it.
+var failureCategories = []struct {
+	name      string
+	fragments []string
+}{
+	{"secrets", []string{"secret"}},
+	{"build_context", []string{"build context"}},
+	{"docker_unavailable", []string{"Failed to connect to Docker", "docker command wasn't found", "Cannot connect to the Docker daemon", "Windows containers"}},
+	{"weights", []string{"weights"}},
+	{"schema", []string{"schema", "type signature"}},
+	{"docker_build", []string{"Failed to build"}},
+	{"config", []string{"cog.yaml"}},
+}
+
+// FailureCategory returns the category of a build error, e.g. docker_build or config, or an empty string if
+// there wasn't one
+func FailureCategory(err error) string {
+	if err == nil {
+		return ""
+	}
+	if errors.Is(err, context.Canceled) {
+		return "canceled"
+	}
+	message := err.Error()
+	for _, category := range failureCategories {
+		for _, fragment := range category.fragments {
+			if strings.Contains(message, fragment) {
+				return category.name
+			}
+		}
+	}
+	return "other"
+}
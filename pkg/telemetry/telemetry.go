@@ -0,0 +1,234 @@
+// Package telemetry reports anonymized statistics about builds to Cog's maintainers, so they know what to work on
+// first. It's off unless it's been turned on with `cog telemetry enable`, and every event is written to a local log
+// before it's sent, so it's always possible to see exactly what was reported.
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+
+	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/util/files"
+)
+
+// endpoint is where events are sent
+var endpoint = "https://telemetry.cog.run/v1/events"
+
+// sendTimeout is how long sending an event can hold up the command that produced it
+const sendTimeout = 2 * time.Second
+
+// Event is what's reported. It doesn't have anything that identifies the user, their machine or their model: no
+// image names, paths, package names or error messages.
+type Event struct {
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	// ID is random, and generated when telemetry is enabled, so events from one installation can be counted once
+	ID         string `json:"id"`
+	CogVersion string `json:"cog_version"`
+	OS         string `json:"os"`
+	Arch       string `json:"arch"`
+
+	DurationSeconds float64 `json:"duration_seconds"`
+	ImageSizeBytes  int64   `json:"image_size_bytes,omitempty"`
+	GPU             bool    `json:"gpu"`
+	PythonVersion   string  `json:"python_version,omitempty"`
+	// Failure is the category of the error the build failed with, from FailureCategory, or empty if it succeeded
+	Failure string `json:"failure,omitempty"`
+}
+
+type settings struct {
+	Enabled bool   `json:"enabled"`
+	ID      string `json:"id"`
+}
+
+// Status is whether telemetry is enabled, and why
+type Status struct {
+	Enabled bool
+	// DisabledBy is the environment variable that turned telemetry off, even though it's been enabled
+	DisabledBy string
+	// LogPath is the file every event is written to
+	LogPath string
+}
+
+// GetStatus returns whether events are recorded
+func GetStatus() (*Status, error) {
+	s, err := loadSettings()
+	if err != nil {
+		return nil, err
+	}
+	logPath, err := LogPath()
+	if err != nil {
+		return nil, err
+	}
+	status := &Status{Enabled: s.Enabled, LogPath: logPath}
+	if disabledBy := disabledByEnv(); disabledBy != "" && s.Enabled {
+		status.Enabled = false
+		status.DisabledBy = disabledBy
+	}
+	return status, nil
+}
+
+// Enabled returns whether events are recorded, so callers can skip the work of measuring them if they aren't
+func Enabled() bool {
+	status, err := GetStatus()
+	return err == nil && status.Enabled
+}
+
+// Enable turns telemetry on, with a new random ID
+func Enable() error {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	return writeSettings(&settings{Enabled: true, ID: hex.EncodeToString(id)})
+}
+
+// Disable turns telemetry off, and forgets the ID
+func Disable() error {
+	return writeSettings(&settings{})
+}
+
+// Record writes e to the local log and sends it, if telemetry is enabled. Errors are only logged, so telemetry
+// never breaks the command that's recording it.
+func Record(e Event) {
+	if err := record(e); err != nil {
+		console.Debugf("Failed to record telemetry: %s", err)
+	}
+}
+
+func record(e Event) error {
+	status, err := GetStatus()
+	if err != nil || !status.Enabled {
+		return err
+	}
+	s, err := loadSettings()
+	if err != nil {
+		return err
+	}
+	e.ID = s.ID
+	e.CogVersion = global.Version
+	e.OS = runtime.GOOS
+	e.Arch = runtime.GOARCH
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if err := appendLog(status.LogPath, body); err != nil {
+		return err
+	}
+	return sendTo(endpoint, body)
+}
+
+func sendTo(url string, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return nil
+}
+
+// disabledByEnv returns the environment variable that turns telemetry off, if one is set
+func disabledByEnv() string {
+	for _, name := range []string{"COG_NO_TELEMETRY", "DO_NOT_TRACK"} {
+		if value := os.Getenv(name); value != "" && value != "0" && value != "false" {
+			return name
+		}
+	}
+	return ""
+}
+
+func appendLog(path string, event []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(event, '\n'))
+	return err
+}
+
+func loadSettings() (*settings, error) {
+	s := settings{}
+	p, err := settingsPath()
+	if err != nil {
+		return nil, err
+	}
+	exists, err := files.Exists(p)
+	if err != nil || !exists {
+		return &s, err
+	}
+	text, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(text, &s); err != nil {
+		return nil, fmt.Errorf("Failed to parse %s: %w", p, err)
+	}
+	return &s, nil
+}
+
+func writeSettings(s *settings) error {
+	p, err := settingsPath()
+	if err != nil {
+		return err
+	}
+	contents, err := json.MarshalIndent(s, "", " ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(p, contents, 0o600)
+}
+
+func userDir() (string, error) {
+	return homedir.Expand("~/.config/cog")
+}
+
+func settingsPath() (string, error) {
+	dir, err := userDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "telemetry.json"), nil
+}
+
+// LogPath returns the file every recorded event is written to, one JSON object per line
+func LogPath() (string, error) {
+	dir, err := userDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "telemetry-events.jsonl"), nil
+}
@@ -0,0 +1,93 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnableDisable(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("COG_NO_TELEMETRY", "")
+	t.Setenv("DO_NOT_TRACK", "")
+
+	status, err := GetStatus()
+	require.NoError(t, err)
+	require.False(t, status.Enabled)
+
+	require.NoError(t, Enable())
+	status, err = GetStatus()
+	require.NoError(t, err)
+	require.True(t, status.Enabled)
+	s, err := loadSettings()
+	require.NoError(t, err)
+	require.Len(t, s.ID, 32)
+
+	t.Setenv("DO_NOT_TRACK", "1")
+	status, err = GetStatus()
+	require.NoError(t, err)
+	require.False(t, status.Enabled)
+	require.Equal(t, "DO_NOT_TRACK", status.DisabledBy)
+
+	require.NoError(t, Disable())
+	s, err = loadSettings()
+	require.NoError(t, err)
+	require.Equal(t, settings{}, *s)
+}
+
+func TestRecord(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("COG_NO_TELEMETRY", "")
+	t.Setenv("DO_NOT_TRACK", "")
+
+	var received []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+	defer func(original string) { endpoint = original }(endpoint)
+	endpoint = server.URL
+
+	// Nothing is written or sent until telemetry is enabled
+	logPath, err := LogPath()
+	require.NoError(t, err)
+	require.NoFileExists(t, logPath)
+
+	require.NoError(t, record(Event{Type: "build"}))
+	require.Nil(t, received)
+
+	require.NoError(t, Enable())
+	require.NoError(t, record(Event{Type: "build", DurationSeconds: 12.5, ImageSizeBytes: 1024, Failure: "docker_build", Time: time.Unix(0, 0)}))
+	contents, err := os.ReadFile(logPath)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(contents)), "\n")
+	require.Len(t, lines, 1)
+	event := Event{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &event))
+	require.Equal(t, "build", event.Type)
+	require.Equal(t, 12.5, event.DurationSeconds)
+	require.Equal(t, "docker_build", event.Failure)
+	require.NotEmpty(t, event.ID)
+	require.NotEmpty(t, event.OS)
+	// What's sent is exactly what's logged
+	require.Equal(t, lines[0], string(received))
+}
+
+func TestFailureCategory(t *testing.T) {
+	require.Equal(t, "", FailureCategory(nil))
+	require.Equal(t, "canceled", FailureCategory(fmt.Errorf("Failed to build Docker image: %w", context.Canceled)))
+	require.Equal(t, "docker_build", FailureCategory(fmt.Errorf("Failed to build Docker image: exit status 1")))
+	require.Equal(t, "secrets", FailureCategory(fmt.Errorf("build.env.API_TOKEN in cog.yaml looks like a secret")))
+	require.Equal(t, "config", FailureCategory(fmt.Errorf("build.timezone in cog.yaml must be a time zone name")))
+	require.Equal(t, "other", FailureCategory(fmt.Errorf("something else")))
+}
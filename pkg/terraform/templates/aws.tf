@@ -0,0 +1,282 @@
+# Runs {{.Image}} on Amazon ECS{{if .GPUs}}, on GPU instances{{else}} with Fargate{{end}}.
+# Generated by `cog deploy terraform --provider aws`.
+#
+# If the image is in a private registry other than ECR, add repositoryCredentials to the container definition.
+
+terraform {
+  required_providers {
+    aws = {
+      source  = "hashicorp/aws"
+      version = "~> 5.0"
+    }
+  }
+}
+
+variable "region" {
+  type    = string
+  default = "us-east-1"
+}
+
+variable "vpc_id" {
+  description = "The VPC to run the model in"
+  type        = string
+}
+
+variable "subnet_ids" {
+  description = "The subnets to run the model in"
+  type        = list(string)
+}
+
+variable "allowed_cidr_blocks" {
+  description = "The addresses that can send requests to the model"
+  type        = list(string)
+  default     = ["0.0.0.0/0"]
+}
+
+variable "desired_count" {
+  description = "How many replicas of the model to run"
+  type        = number
+  default     = 1
+}
+
+variable "cpu" {
+  description = "CPU units for each replica, 1024 per vCPU"
+  type        = number
+  default     = {{.CPUUnits}}
+}
+
+variable "memory" {
+  description = "Memory for each replica, in MiB"
+  type        = number
+  default     = {{.MemoryMiB}}
+}
+{{- if .GPUs}}
+
+variable "instance_type" {
+  description = "The GPU instance type. Each instance runs one replica, so it needs {{.GPUs}} GPU{{if gt .GPUs 1}}s{{end}}{{if .GPUMemoryMiB}} with {{.GPUMemoryMiB}} MiB of memory{{end}}, and more vCPUs and memory than a replica"
+  type        = string
+  default     = "{{.AWSMachine.Type}}"
+}
+
+variable "max_instances" {
+  description = "The most GPU instances to run"
+  type        = number
+  default     = 2
+}
+
+variable "disk_size" {
+  description = "The size of each instance's disk, in GiB, which has to fit the image{{if .DiskMiB}} and what the model writes{{end}}"
+  type        = number
+  default     = {{.DiskGiB}}
+}
+{{- end}}
+
+provider "aws" {
+  region = var.region
+}
+
+resource "aws_ecs_cluster" "model" {
+  name = "{{.Name}}"
+}
+
+resource "aws_cloudwatch_log_group" "model" {
+  name              = "/ecs/{{.Name}}"
+  retention_in_days = 30
+}
+
+resource "aws_iam_role" "execution" {
+  name = "{{.Name}}-execution"
+  assume_role_policy = jsonencode({
+    Version   = "2012-10-17"
+    Statement = [{ Effect = "Allow", Principal = { Service = "ecs-tasks.amazonaws.com" }, Action = "sts:AssumeRole" }]
+  })
+}
+
+resource "aws_iam_role_policy_attachment" "execution" {
+  role       = aws_iam_role.execution.name
+  policy_arn = "arn:aws:iam::aws:policy/service-role/AmazonECSTaskExecutionRolePolicy"
+}
+
+resource "aws_ecs_task_definition" "model" {
+  family                   = "{{.Name}}"
+  requires_compatibilities = ["{{if .GPUs}}EC2{{else}}FARGATE{{end}}"]
+  network_mode             = "awsvpc"
+  cpu                      = var.cpu
+  memory                   = var.memory
+  execution_role_arn       = aws_iam_role.execution.arn
+{{- if and .FargateStorageGiB (not .GPUs)}}
+
+  # Fits the image and what the model writes
+  ephemeral_storage {
+    size_in_gib = {{.FargateStorageGiB}}
+  }
+{{- end}}
+
+  container_definitions = jsonencode([{
+    name         = "model"
+    image        = "{{.Image}}"
+    essential    = true
+    portMappings = [{ containerPort = {{.Port}}, protocol = "tcp" }]
+{{- if .GPUs}}
+    resourceRequirements = [{ type = "GPU", value = "{{.GPUs}}" }]
+{{- end}}
+{{- if .StopTimeout}}
+    stopTimeout = {{.StopTimeout}}
+{{- end}}
+    # The container is healthy once the model's setup() has finished
+    healthCheck = {
+      command     = ["CMD", "test", "-f", "/var/run/cog/ready"]
+      interval    = 10
+      startPeriod = 300
+      retries     = 10
+    }
+    logConfiguration = {
+      logDriver = "awslogs"
+      options = {
+        awslogs-group         = aws_cloudwatch_log_group.model.name
+        awslogs-region        = var.region
+        awslogs-stream-prefix = "model"
+      }
+    }
+  }])
+}
+
+resource "aws_security_group" "model" {
+  name   = "{{.Name}}"
+  vpc_id = var.vpc_id
+
+  ingress {
+    from_port   = {{.Port}}
+    to_port     = {{.Port}}
+    protocol    = "tcp"
+    cidr_blocks = var.allowed_cidr_blocks
+  }
+
+  egress {
+    from_port   = 0
+    to_port     = 0
+    protocol    = "-1"
+    cidr_blocks = ["0.0.0.0/0"]
+  }
+}
+{{- if .GPUs}}
+
+data "aws_ssm_parameter" "gpu_ami" {
+  name = "/aws/service/ecs/optimized-ami/amazon-linux-2/gpu/recommended/image_id"
+}
+
+resource "aws_iam_role" "instance" {
+  name = "{{.Name}}-instance"
+  assume_role_policy = jsonencode({
+    Version   = "2012-10-17"
+    Statement = [{ Effect = "Allow", Principal = { Service = "ec2.amazonaws.com" }, Action = "sts:AssumeRole" }]
+  })
+}
+
+resource "aws_iam_role_policy_attachment" "instance" {
+  role       = aws_iam_role.instance.name
+  policy_arn = "arn:aws:iam::aws:policy/service-role/AmazonEC2ContainerServiceforEC2Role"
+}
+
+resource "aws_iam_instance_profile" "instance" {
+  name = "{{.Name}}-instance"
+  role = aws_iam_role.instance.name
+}
+
+resource "aws_launch_template" "gpu" {
+  name_prefix   = "{{.Name}}-"
+  image_id      = data.aws_ssm_parameter.gpu_ami.value
+  instance_type = var.instance_type
+  user_data     = base64encode("#!/bin/bash\necho ECS_CLUSTER=${aws_ecs_cluster.model.name} >> /etc/ecs/ecs.config\n")
+
+  iam_instance_profile {
+    arn = aws_iam_instance_profile.instance.arn
+  }
+
+  block_device_mappings {
+    device_name = "/dev/xvda"
+    ebs {
+      volume_size = var.disk_size
+      volume_type = "gp3"
+    }
+  }
+}
+
+resource "aws_autoscaling_group" "gpu" {
+  name                = "{{.Name}}-gpu"
+  min_size            = 0
+  max_size            = var.max_instances
+  vpc_zone_identifier = var.subnet_ids
+
+  launch_template {
+    id      = aws_launch_template.gpu.id
+    version = "$Latest"
+  }
+
+  tag {
+    key                 = "AmazonECSManaged"
+    value               = true
+    propagate_at_launch = true
+  }
+}
+
+resource "aws_ecs_capacity_provider" "gpu" {
+  name = "{{.Name}}-gpu"
+
+  auto_scaling_group_provider {
+    auto_scaling_group_arn = aws_autoscaling_group.gpu.arn
+
+    managed_scaling {
+      status          = "ENABLED"
+      target_capacity = 100
+    }
+  }
+}
+
+resource "aws_ecs_cluster_capacity_providers" "model" {
+  cluster_name       = aws_ecs_cluster.model.name
+  capacity_providers = [aws_ecs_capacity_provider.gpu.name]
+
+  default_capacity_provider_strategy {
+    capacity_provider = aws_ecs_capacity_provider.gpu.name
+    weight            = 1
+  }
+}
+{{- end}}
+
+resource "aws_ecs_service" "model" {
+  name            = "{{.Name}}"
+  cluster         = aws_ecs_cluster.model.id
+  task_definition = aws_ecs_task_definition.model.arn
+  desired_count   = var.desired_count
+{{- if .GPUs}}
+
+  capacity_provider_strategy {
+    capacity_provider = aws_ecs_capacity_provider.gpu.name
+    weight            = 1
+  }
+
+  network_configuration {
+    subnets         = var.subnet_ids
+    security_groups = [aws_security_group.model.id]
+  }
+
+  depends_on = [aws_ecs_cluster_capacity_providers.model]
+{{- else}}
+  launch_type     = "FARGATE"
+
+  network_configuration {
+    subnets          = var.subnet_ids
+    security_groups  = [aws_security_group.model.id]
+    assign_public_ip = true
+  }
+{{- end}}
+}
+
+output "cluster" {
+  value = aws_ecs_cluster.model.name
+}
+
+output "service" {
+  value = aws_ecs_service.model.name
+}
@@ -0,0 +1,268 @@
+{{- if .GPUs -}}
+# Runs {{.Image}} on a GKE cluster with a GPU node pool.
+# Generated by `cog deploy terraform --provider gcp`.
+#
+# If the image is in a private registry other than Artifact Registry, add image_pull_secrets to the deployment.
+
+terraform {
+  required_providers {
+    google = {
+      source  = "hashicorp/google"
+      version = "~> 5.0"
+    }
+    kubernetes = {
+      source  = "hashicorp/kubernetes"
+      version = "~> 2.0"
+    }
+  }
+}
+
+variable "project" {
+  type = string
+}
+
+variable "zone" {
+  description = "The zone to run the cluster in, which must have the GPU type"
+  type        = string
+  default     = "us-central1-a"
+}
+
+variable "replicas" {
+  description = "How many replicas of the model to run"
+  type        = number
+  default     = 1
+}
+
+variable "max_nodes" {
+  description = "The most GPU nodes to run"
+  type        = number
+  default     = 2
+}
+
+variable "machine_type" {
+  description = "The GPU nodes' machine type. Each node runs one replica, so it needs more vCPUs and memory than a replica"
+  type        = string
+  default     = "{{.GCPMachine.Type}}"
+}
+
+variable "gpu_type" {
+  description = "The GPU type{{if .GPUMemoryMiB}}, which needs {{.GPUMemoryMiB}} MiB of memory{{end}}"
+  type        = string
+  default     = "{{.GCPMachine.GPUType}}"
+}
+
+variable "disk_size" {
+  description = "The size of each node's disk, in GB, which has to fit the image{{if .DiskMiB}} and what the model writes{{end}}"
+  type        = number
+  default     = {{.DiskGiB}}
+}
+
+variable "cpu" {
+  description = "vCPUs for each replica"
+  type        = string
+  default     = "{{.CPUs}}"
+}
+
+variable "memory" {
+  description = "Memory for each replica"
+  type        = string
+  default     = "{{.MemoryMiB}}Mi"
+}
+
+provider "google" {
+  project = var.project
+}
+
+resource "google_container_cluster" "model" {
+  name                     = "{{.Name}}"
+  location                 = var.zone
+  remove_default_node_pool = true
+  initial_node_count       = 1
+  deletion_protection      = false
+}
+
+resource "google_container_node_pool" "gpu" {
+  name     = "gpu"
+  cluster  = google_container_cluster.model.id
+  location = var.zone
+
+  autoscaling {
+    min_node_count = 0
+    max_node_count = var.max_nodes
+  }
+
+  node_config {
+    machine_type = var.machine_type
+    disk_size_gb = var.disk_size
+    oauth_scopes = ["https://www.googleapis.com/auth/cloud-platform"]
+
+    guest_accelerator {
+      type  = var.gpu_type
+      count = {{.GPUs}}
+
+      gpu_driver_installation_config {
+        gpu_driver_version = "LATEST"
+      }
+    }
+  }
+}
+
+data "google_client_config" "default" {}
+
+provider "kubernetes" {
+  host                   = "https://${google_container_cluster.model.endpoint}"
+  token                  = data.google_client_config.default.access_token
+  cluster_ca_certificate = base64decode(google_container_cluster.model.master_auth[0].cluster_ca_certificate)
+}
+
+resource "kubernetes_deployment" "model" {
+  metadata {
+    name = "{{.Name}}"
+  }
+
+  spec {
+    replicas = var.replicas
+
+    selector {
+      match_labels = { app = "{{.Name}}" }
+    }
+
+    template {
+      metadata {
+        labels = { app = "{{.Name}}" }
+      }
+
+      spec {
+        node_selector = { "cloud.google.com/gke-accelerator" = var.gpu_type }
+{{- if .GracePeriodSeconds}}
+        termination_grace_period_seconds = {{.GracePeriodSeconds}}
+{{- end}}
+
+        container {
+          name  = "model"
+          image = "{{.Image}}"
+
+          port {
+            container_port = {{.Port}}
+          }
+
+          resources {
+            limits   = { "nvidia.com/gpu" = {{.GPUs}} }
+            requests = { cpu = var.cpu, memory = var.memory{{if .DiskMiB}}, "ephemeral-storage" = "{{.DiskMiB}}Mi"{{end}} }
+          }
+
+          # A replica is ready once the model's setup() has finished
+          readiness_probe {
+            exec {
+              command = ["test", "-f", "/var/run/cog/ready"]
+            }
+          }
+        }
+      }
+    }
+  }
+
+  depends_on = [google_container_node_pool.gpu]
+}
+
+resource "kubernetes_service" "model" {
+  metadata {
+    name = "{{.Name}}"
+  }
+
+  spec {
+    type     = "LoadBalancer"
+    selector = { app = "{{.Name}}" }
+
+    port {
+      port        = 80
+      target_port = {{.Port}}
+    }
+  }
+}
+
+output "url" {
+  value = "http://${kubernetes_service.model.status[0].load_balancer[0].ingress[0].ip}"
+}
+{{- else -}}
+# Runs {{.Image}} on Cloud Run.
+# Generated by `cog deploy terraform --provider gcp`.
+#
+# Cloud Run pulls images from Artifact Registry or Docker Hub, so push the image to one of them.
+
+terraform {
+  required_providers {
+    google = {
+      source  = "hashicorp/google"
+      version = "~> 5.0"
+    }
+  }
+}
+
+variable "project" {
+  type = string
+}
+
+variable "region" {
+  type    = string
+  default = "us-central1"
+}
+
+variable "min_instances" {
+  type    = number
+  default = 0
+}
+
+variable "max_instances" {
+  type    = number
+  default = 3
+}
+
+variable "cpu" {
+  description = "vCPUs for each instance"
+  type        = string
+  default     = "{{.CPUs}}"
+}
+
+variable "memory" {
+  description = "Memory for each instance{{if .DiskMiB}}, which has the disk space the model writes to, because Cloud Run's disk is in memory{{end}}"
+  type        = string
+  default     = "{{.CloudRunMemoryMiB}}Mi"
+}
+
+provider "google" {
+  project = var.project
+  region  = var.region
+}
+
+resource "google_cloud_run_v2_service" "model" {
+  name     = "{{.Name}}"
+  location = var.region
+
+  template {
+    timeout                          = "{{.RequestTimeout}}s"
+    max_instance_request_concurrency = {{.MaxConcurrency}}
+
+    scaling {
+      min_instance_count = var.min_instances
+      max_instance_count = var.max_instances
+    }
+
+    containers {
+      image = "{{.Image}}"
+
+      ports {
+        container_port = {{.Port}}
+      }
+
+      resources {
+        limits = { cpu = var.cpu, memory = var.memory }
+      }
+    }
+  }
+}
+
+output "url" {
+  value = google_cloud_run_v2_service.model.uri
+}
+{{- end}}
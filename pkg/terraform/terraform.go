@@ -0,0 +1,228 @@
+// Package terraform generates Terraform configuration that runs a model's image on a cloud provider
+package terraform
+
+import (
+	"bytes"
+	// blank import for embeds
+	_ "embed"
+	"fmt"
+	"math"
+	"strings"
+	"text/template"
+
+	"github.com/docker/go-units"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+// Providers that configuration can be generated for
+const (
+	// ProviderAWS runs the model on Amazon ECS: on Fargate, or on GPU instances if it needs a GPU
+	ProviderAWS = "aws"
+	// ProviderGCP runs the model on Cloud Run, or on a GKE cluster with a GPU node pool if it needs a GPU
+	ProviderGCP = "gcp"
+)
+
+// Providers are all of the providers that configuration can be generated for
+var Providers = []string{ProviderAWS, ProviderGCP}
+
+// containerPort is the port Cog's HTTP server listens on
+const containerPort = 5000
+
+// The resources a replica gets if resources in cog.yaml doesn't say, which fit on the smallest machines: 1 vCPU on
+// Fargate and Cloud Run, and a g5.xlarge or g2-standard-4 with a GPU, less what the node keeps for itself
+const (
+	defaultCPUs         = 1
+	defaultMemoryMiB    = 2048
+	defaultGPUCPUs      = 3
+	defaultGPUMemoryMiB = 12288
+)
+
+// ECS waits at most 2 minutes for a container to stop, and Cloud Run waits at most an hour for a request
+const (
+	maxECSStopTimeout      = 120
+	maxCloudRunTimeout     = 3600
+	defaultCloudRunTimeout = 300
+)
+
+//go:embed templates/aws.tf
+var awsTemplate string
+
+//go:embed templates/gcp.tf
+var gcpTemplate string
+
+// Options describe the infrastructure a model runs on
+type Options struct {
+	Name  string
+	Image string
+	// GPUs is the number of GPUs each replica needs, and CPUs and MemoryMiB are the vCPUs and memory it's given
+	GPUs      int
+	CPUs      float64
+	MemoryMiB int
+	// GPUMemoryMiB is the memory each GPU needs, and DiskMiB is the disk space the model writes to, or 0 if
+	// resources in cog.yaml doesn't say
+	GPUMemoryMiB int
+	DiskMiB      int
+	// MaxConcurrency is the number of predictions a replica can run at the same time
+	MaxConcurrency int
+	// TimeoutSeconds is how long a prediction can run for, or 0 for the platform's default
+	TimeoutSeconds int
+	// GracePeriodSeconds is how long a replica has to finish predictions when it's stopped, or 0 for the default
+	GracePeriodSeconds int
+}
+
+// OptionsFromConfig returns the options for running image, derived from cog.yaml
+func OptionsFromConfig(cfg *config.Config, name string, image string) Options {
+	opts := Options{
+		Name:               name,
+		Image:              image,
+		CPUs:               defaultCPUs,
+		MemoryMiB:          defaultMemoryMiB,
+		MaxConcurrency:     1,
+		TimeoutSeconds:     cfg.PredictTimeout,
+		GracePeriodSeconds: cfg.ShutdownGracePeriod(),
+	}
+	if cfg.Build != nil && cfg.Build.GPU {
+		opts.GPUs = 1
+		opts.CPUs = defaultGPUCPUs
+		opts.MemoryMiB = defaultGPUMemoryMiB
+	}
+	if cfg.Concurrency != nil && cfg.Concurrency.Max > 0 {
+		opts.MaxConcurrency = cfg.Concurrency.Max
+	}
+	// cog.yaml has been validated, so the sizes in it are valid
+	if resources, err := cfg.ResourceRequirements(); err == nil {
+		if resources.CPU > 0 {
+			opts.CPUs = resources.CPU
+		}
+		if resources.MemoryBytes > 0 {
+			opts.MemoryMiB = mebibytes(resources.MemoryBytes)
+		}
+		opts.GPUMemoryMiB = mebibytes(resources.GPUMemoryBytes)
+		opts.DiskMiB = mebibytes(resources.DiskBytes)
+	}
+	return opts
+}
+
+// mebibytes returns bytes in MiB, rounded up
+func mebibytes(bytes int64) int {
+	return int((bytes + units.MiB - 1) / units.MiB)
+}
+
+// Generate returns the Terraform configuration that runs the model on provider
+func Generate(provider string, opts Options) ([]byte, error) {
+	var text string
+	switch provider {
+	case ProviderAWS:
+		text = awsTemplate
+	case ProviderGCP:
+		text = gcpTemplate
+	default:
+		return nil, fmt.Errorf("Unknown provider '%s', it must be one of: %s", provider, strings.Join(Providers, ", "))
+	}
+	tmpl, err := template.New(provider).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, newTemplateData(opts)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// gpuMachine is a machine with a GPU, from smallest to biggest
+type gpuMachine struct {
+	// GPUMemoryMiB is the memory of its GPU
+	GPUMemoryMiB int
+	// Type is the instance type on AWS, or the machine type on GCP, and GPUType is the GPU's type on GCP
+	Type    string
+	GPUType string
+}
+
+// The machines with one GPU a model runs on, picked by how much GPU memory it needs
+var (
+	awsGPUMachines = []gpuMachine{
+		{GPUMemoryMiB: 24 * 1024, Type: "g5.xlarge"},
+		{GPUMemoryMiB: 48 * 1024, Type: "g6e.xlarge"},
+		{GPUMemoryMiB: 80 * 1024, Type: "p5.48xlarge"},
+	}
+	gcpGPUMachines = []gpuMachine{
+		{GPUMemoryMiB: 24 * 1024, Type: "g2-standard-4", GPUType: "nvidia-l4"},
+		{GPUMemoryMiB: 40 * 1024, Type: "a2-highgpu-1g", GPUType: "nvidia-tesla-a100"},
+		{GPUMemoryMiB: 80 * 1024, Type: "a2-ultragpu-1g", GPUType: "nvidia-a100-80gb"},
+	}
+)
+
+// smallestGPUMachine returns the smallest machine whose GPU has gpuMemoryMiB, or the biggest if none of them do
+func smallestGPUMachine(machines []gpuMachine, gpuMemoryMiB int) gpuMachine {
+	for _, m := range machines {
+		if m.GPUMemoryMiB >= gpuMemoryMiB {
+			return m
+		}
+	}
+	return machines[len(machines)-1]
+}
+
+// Disk sizes, in GiB: what a GPU machine's disk has for the image, and the least and most a Fargate task can have
+const (
+	imageDiskGiB           = 100
+	minFargateStorageGiB   = 21
+	maxFargateStorageGiB   = 200
+	fargateImageStorageGiB = 20
+)
+
+// templateData is what the templates are executed with
+type templateData struct {
+	Options
+	Port int
+	// CPUUnits are the vCPUs in ECS's units
+	CPUUnits int
+	// AWSMachine and GCPMachine are the machines a model that needs a GPU runs on
+	AWSMachine gpuMachine
+	GCPMachine gpuMachine
+	// DiskGiB is the size of a GPU machine's disk, and FargateStorageGiB is the storage of a Fargate task, or 0
+	// for the default
+	DiskGiB           int
+	FargateStorageGiB int
+	// CloudRunMemoryMiB is the memory of a Cloud Run instance, whose disk is in memory
+	CloudRunMemoryMiB int
+	// StopTimeout is how long ECS waits for the container to stop
+	StopTimeout int
+	// RequestTimeout is how long Cloud Run waits for a request
+	RequestTimeout int
+}
+
+func newTemplateData(opts Options) templateData {
+	diskGiB := (opts.DiskMiB + 1023) / 1024
+	data := templateData{
+		Options:           opts,
+		Port:              containerPort,
+		CPUUnits:          int(math.Ceil(opts.CPUs * 1024)),
+		AWSMachine:        smallestGPUMachine(awsGPUMachines, opts.GPUMemoryMiB),
+		GCPMachine:        smallestGPUMachine(gcpGPUMachines, opts.GPUMemoryMiB),
+		DiskGiB:           imageDiskGiB + diskGiB,
+		CloudRunMemoryMiB: opts.MemoryMiB + opts.DiskMiB,
+		StopTimeout:       opts.GracePeriodSeconds,
+		RequestTimeout:    opts.TimeoutSeconds,
+	}
+	if opts.DiskMiB > 0 {
+		data.FargateStorageGiB = fargateImageStorageGiB + diskGiB
+		if data.FargateStorageGiB < minFargateStorageGiB {
+			data.FargateStorageGiB = minFargateStorageGiB
+		}
+		if data.FargateStorageGiB > maxFargateStorageGiB {
+			data.FargateStorageGiB = maxFargateStorageGiB
+		}
+	}
+	if data.StopTimeout > maxECSStopTimeout {
+		data.StopTimeout = maxECSStopTimeout
+	}
+	if data.RequestTimeout <= 0 {
+		data.RequestTimeout = defaultCloudRunTimeout
+	}
+	if data.RequestTimeout > maxCloudRunTimeout {
+		data.RequestTimeout = maxCloudRunTimeout
+	}
+	return data
+}
@@ -0,0 +1,108 @@
+package terraform
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+func TestOptionsFromConfig(t *testing.T) {
+	cfg := &config.Config{Build: &config.Build{}, PredictTimeout: 600}
+	opts := OptionsFromConfig(cfg, "hotdog-detector", "registry.example.com/hotdog-detector")
+	require.Equal(t, Options{Name: "hotdog-detector", Image: "registry.example.com/hotdog-detector", CPUs: 1, MemoryMiB: 2048, MaxConcurrency: 1, TimeoutSeconds: 600}, opts)
+
+	cfg.Build.GPU = true
+	cfg.Concurrency = &config.Concurrency{Max: 4}
+	cfg.Shutdown = &config.Shutdown{GracePeriod: 300}
+	opts = OptionsFromConfig(cfg, "hotdog-detector", "registry.example.com/hotdog-detector")
+	require.Equal(t, 1, opts.GPUs)
+	require.Equal(t, 3.0, opts.CPUs)
+	require.Equal(t, 12288, opts.MemoryMiB)
+	require.Equal(t, 4, opts.MaxConcurrency)
+	require.Equal(t, 300, opts.GracePeriodSeconds)
+
+	cfg.Resources = &config.Resources{CPU: 0.5, Memory: "16GB", GPUMemory: "40GB", Disk: "10GB"}
+	opts = OptionsFromConfig(cfg, "hotdog-detector", "registry.example.com/hotdog-detector")
+	require.Equal(t, 0.5, opts.CPUs)
+	require.Equal(t, 15259, opts.MemoryMiB)
+	require.Equal(t, 38147, opts.GPUMemoryMiB)
+	require.Equal(t, 9537, opts.DiskMiB)
+}
+
+func TestGenerateAWS(t *testing.T) {
+	opts := Options{Name: "hotdog-detector", Image: "registry.example.com/hotdog-detector", CPUs: 1, MemoryMiB: 2048, MaxConcurrency: 1}
+	tf := generate(t, ProviderAWS, opts)
+	require.Contains(t, tf, `requires_compatibilities = ["FARGATE"]`)
+	require.Contains(t, tf, "  default     = 1024\n")
+	require.Contains(t, tf, `launch_type     = "FARGATE"`)
+	require.NotContains(t, tf, "aws_autoscaling_group")
+	require.NotContains(t, tf, "stopTimeout")
+
+	opts.GPUs, opts.CPUs, opts.MemoryMiB, opts.GracePeriodSeconds = 1, 3, 12288, 300
+	tf = generate(t, ProviderAWS, opts)
+	require.Contains(t, tf, `requires_compatibilities = ["EC2"]`)
+	require.Contains(t, tf, "  default     = 3072\n")
+	require.Contains(t, tf, `resourceRequirements = [{ type = "GPU", value = "1" }]`)
+	require.Contains(t, tf, `default     = "g5.xlarge"`)
+	require.Contains(t, tf, "stopTimeout = 120\n")
+	require.Contains(t, tf, "capacity_provider = aws_ecs_capacity_provider.gpu.name")
+	require.NotContains(t, tf, "FARGATE")
+	require.NotContains(t, tf, "ephemeral_storage")
+
+	// The instance is picked by how much GPU memory the model needs, and its disk fits what the model writes
+	opts.GPUMemoryMiB, opts.DiskMiB = 40*1024, 50*1024
+	tf = generate(t, ProviderAWS, opts)
+	require.Contains(t, tf, `default     = "g6e.xlarge"`)
+	require.Contains(t, tf, "  default     = 150\n")
+
+	opts = Options{Name: "hotdog-detector", Image: "registry.example.com/hotdog-detector", CPUs: 0.5, MemoryMiB: 1024, MaxConcurrency: 1, DiskMiB: 30 * 1024}
+	tf = generate(t, ProviderAWS, opts)
+	require.Contains(t, tf, "  default     = 512\n")
+	require.Contains(t, tf, "size_in_gib = 50\n")
+}
+
+func TestGenerateGCP(t *testing.T) {
+	opts := Options{Name: "hotdog-detector", Image: "us-docker.pkg.dev/acme/models/hotdog-detector", CPUs: 1, MemoryMiB: 2048, MaxConcurrency: 4, TimeoutSeconds: 7200}
+	tf := generate(t, ProviderGCP, opts)
+	require.Contains(t, tf, `resource "google_cloud_run_v2_service" "model"`)
+	require.Contains(t, tf, `timeout                          = "3600s"`)
+	require.Contains(t, tf, "max_instance_request_concurrency = 4\n")
+	require.Contains(t, tf, `default     = "2048Mi"`)
+	require.NotContains(t, tf, "kubernetes")
+
+	// Cloud Run's disk is in memory
+	opts.DiskMiB = 1024
+	tf = generate(t, ProviderGCP, opts)
+	require.Contains(t, tf, `default     = "3072Mi"`)
+
+	opts.GPUs, opts.CPUs, opts.MemoryMiB, opts.GPUMemoryMiB = 1, 3, 12288, 80*1024
+	tf = generate(t, ProviderGCP, opts)
+	require.Contains(t, tf, `resource "google_container_node_pool" "gpu"`)
+	require.Contains(t, tf, `default     = "a2-ultragpu-1g"`)
+	require.Contains(t, tf, `default     = "nvidia-a100-80gb"`)
+	require.Contains(t, tf, "      count = 1\n")
+	require.Contains(t, tf, `limits   = { "nvidia.com/gpu" = 1 }`)
+	require.Contains(t, tf, `requests = { cpu = var.cpu, memory = var.memory, "ephemeral-storage" = "1024Mi" }`)
+	require.NotContains(t, tf, "cloud_run")
+}
+
+func TestGenerateUnknownProvider(t *testing.T) {
+	_, err := Generate("azure", Options{})
+	require.Error(t, err)
+}
+
+// generate returns the configuration for provider, checking its blocks are balanced
+func generate(t *testing.T, provider string, opts Options) string {
+	t.Helper()
+	tf, err := Generate(provider, opts)
+	require.NoError(t, err)
+	s := string(tf)
+	require.Equal(t, strings.Count(s, "{"), strings.Count(s, "}"), s)
+	require.Equal(t, strings.Count(s, "["), strings.Count(s, "]"), s)
+	require.NotContains(t, s, "<no value>")
+	require.True(t, strings.HasSuffix(s, "}\n"), s)
+	return s
+}
@@ -0,0 +1,83 @@
+"""
+Triton Python backend model that runs a Cog predictor.
+
+The model's source code, including cog.yaml, is in the src directory next to
+this file. The Python environment Triton runs this in must have cog and the
+model's Python packages installed.
+"""
+import asyncio
+import inspect
+import json
+import os
+import sys
+
+import numpy as np
+import triton_python_backend_utils as pb_utils
+
+SRC_DIR = os.path.join(os.path.dirname(os.path.abspath(__file__)), "src")
+
+
+class TritonPythonModel:
+    def initialize(self, args):
+        from cog.predictor import (
+            get_input_type,
+            get_predict,
+            get_predictor_ref,
+            load_config,
+            load_predictor_from_ref,
+            run_setup,
+        )
+
+        model_config = json.loads(args["model_config"])
+        self.input_names = [i["name"] for i in model_config["input"]]
+
+        # Cog models expect to be run from their source directory
+        os.chdir(SRC_DIR)
+        sys.path.insert(0, SRC_DIR)
+
+        self.predictor = load_predictor_from_ref(get_predictor_ref(load_config()))
+        run_setup(self.predictor)
+        self.predict = get_predict(self.predictor)
+        self.input_type = get_input_type(self.predictor)
+
+    def execute(self, requests):
+        return [self._execute(request) for request in requests]
+
+    def _execute(self, request):
+        from cog.files import upload_file
+        from cog.json import make_encodeable, upload_files
+        from cog.types import URLPath
+
+        inputs = {}
+        for name in self.input_names:
+            tensor = pb_utils.get_input_tensor_by_name(request, name)
+            if tensor is None:
+                continue
+            value = tensor.as_numpy().reshape(-1)[0]
+            if isinstance(value, bytes):
+                value = value.decode("utf-8")
+            elif isinstance(value, np.generic):
+                value = value.item()
+            inputs[name] = value
+
+        try:
+            payload = self.input_type(**inputs).dict()
+            for name, value in payload.items():
+                if isinstance(value, URLPath):
+                    payload[name] = value.convert()
+
+            result = self.predict(**payload)
+            if inspect.iscoroutine(result):
+                result = asyncio.run(result)
+            elif inspect.isgenerator(result):
+                result = list(result)
+
+            # Files are returned as data URLs
+            output = upload_files(make_encodeable(result), upload_file=upload_file)
+        except Exception as e:
+            return pb_utils.InferenceResponse(error=pb_utils.TritonError(str(e)))
+
+        output_tensor = pb_utils.Tensor(
+            "output", np.array([json.dumps(output)], dtype=np.object_)
+        )
+        return pb_utils.InferenceResponse(output_tensors=[output_tensor])
@@ -0,0 +1,144 @@
+// Package triton exports Cog models as Triton Inference Server model repositories
+package triton
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// modelPy is the Python backend model that runs the predictor
+//
+//go:embed model.py
+var modelPy []byte
+
+// ModelVersion is the version of the model that is exported. Triton serves the highest version
+// in the model's directory.
+const ModelVersion = "1"
+
+// SourceDir is the directory, inside the model version's directory, that holds the model's source code
+const SourceDir = "src"
+
+// ModelDir returns the directory for the model called name in repositoryDir
+func ModelDir(repositoryDir string, name string) string {
+	return filepath.Join(repositoryDir, name)
+}
+
+// WriteModel writes the model configuration and Python backend to the model's directory in repositoryDir.
+// The model's source code must be copied to SourceDir separately.
+func WriteModel(repositoryDir string, name string, schema *openapi3.T, gpu bool) error {
+	modelConfig, err := ModelConfig(name, schema, gpu)
+	if err != nil {
+		return err
+	}
+	versionDir := filepath.Join(ModelDir(repositoryDir, name), ModelVersion)
+	if err := os.MkdirAll(versionDir, 0o755); err != nil {
+		return fmt.Errorf("Failed to create %s: %w", versionDir, err)
+	}
+	if err := os.WriteFile(filepath.Join(ModelDir(repositoryDir, name), "config.pbtxt"), []byte(modelConfig), 0o644); err != nil {
+		return fmt.Errorf("Failed to write model configuration: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(versionDir, "model.py"), modelPy, 0o644); err != nil {
+		return fmt.Errorf("Failed to write model.py: %w", err)
+	}
+	return nil
+}
+
+// ModelConfig returns the config.pbtxt for a model with the inputs in schema. Each input is a
+// single value, and the output is the prediction's output encoded as JSON.
+func ModelConfig(name string, schema *openapi3.T, gpu bool) (string, error) {
+	inputSchema, ok := schema.Components.Schemas["Input"]
+	if !ok || inputSchema.Value == nil {
+		return "", fmt.Errorf("The model's schema doesn't have any inputs")
+	}
+	required := map[string]bool{}
+	for _, name := range inputSchema.Value.Required {
+		required[name] = true
+	}
+
+	names := make([]string, 0, len(inputSchema.Value.Properties))
+	for name := range inputSchema.Value.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sort.SliceStable(names, func(i, j int) bool {
+		return order(inputSchema.Value.Properties[names[i]]) < order(inputSchema.Value.Properties[names[j]])
+	})
+
+	inputs := []string{}
+	for _, name := range names {
+		dataType, err := dataType(inputSchema.Value.Properties[name])
+		if err != nil {
+			return "", fmt.Errorf("Input %s can't be exported to Triton: %w", name, err)
+		}
+		input := fmt.Sprintf("  {\n    name: %q\n    data_type: %s\n    dims: [ 1 ]\n", name, dataType)
+		if !required[name] {
+			input += "    optional: true\n"
+		}
+		inputs = append(inputs, input+"  }")
+	}
+
+	kind := "KIND_CPU"
+	if gpu {
+		kind = "KIND_GPU"
+	}
+
+	return fmt.Sprintf(`name: %q
+backend: "python"
+max_batch_size: 0
+input [
+%s
+]
+output [
+  {
+    name: "output"
+    data_type: TYPE_STRING
+    dims: [ 1 ]
+  }
+]
+instance_group [
+  {
+    kind: %s
+    count: 1
+  }
+]
+`, name, strings.Join(inputs, ",\n"), kind), nil
+}
+
+func dataType(property *openapi3.SchemaRef) (string, error) {
+	if property.Value == nil {
+		return "", fmt.Errorf("missing schema")
+	}
+	schemaType := property.Value.Type
+	// Inputs with choices refer to an enum schema
+	if schemaType == "" && len(property.Value.AllOf) > 0 && property.Value.AllOf[0].Value != nil {
+		schemaType = property.Value.AllOf[0].Value.Type
+	}
+	switch schemaType {
+	case "string":
+		// Files are passed as URLs
+		return "TYPE_STRING", nil
+	case "integer":
+		return "TYPE_INT64", nil
+	case "number":
+		return "TYPE_FP64", nil
+	case "boolean":
+		return "TYPE_BOOL", nil
+	}
+	return "", fmt.Errorf("unsupported type '%s'", schemaType)
+}
+
+func order(property *openapi3.SchemaRef) float64 {
+	if property.Value == nil {
+		return 0
+	}
+	if o, ok := property.Value.Extensions["x-order"].(float64); ok {
+		return o
+	}
+	return 0
+}
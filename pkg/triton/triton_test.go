@@ -0,0 +1,96 @@
+package triton
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/require"
+)
+
+const testSchema = `{
+  "openapi": "3.0.2",
+  "info": {"title": "Cog", "version": "0.1.0"},
+  "paths": {},
+  "components": {
+    "schemas": {
+      "Input": {
+        "type": "object",
+        "title": "Input",
+        "required": ["prompt"],
+        "properties": {
+          "steps": {"type": "integer", "title": "Steps", "default": 50, "x-order": 2},
+          "prompt": {"type": "string", "title": "Prompt", "x-order": 0},
+          "image": {"type": "string", "format": "uri", "title": "Image", "x-order": 1},
+          "scheduler": {"allOf": [{"$ref": "#/components/schemas/scheduler"}], "default": "DDIM", "x-order": 3}
+        }
+      },
+      "scheduler": {"type": "string", "title": "scheduler", "enum": ["DDIM", "K_EULER"]}
+    }
+  }
+}`
+
+func loadTestSchema(t *testing.T) *openapi3.T {
+	t.Helper()
+	schema, err := openapi3.NewLoader().LoadFromData([]byte(testSchema))
+	require.NoError(t, err)
+	return schema
+}
+
+func TestModelConfig(t *testing.T) {
+	modelConfig, err := ModelConfig("hotdog-detector", loadTestSchema(t), true)
+	require.NoError(t, err)
+	require.Equal(t, `name: "hotdog-detector"
+backend: "python"
+max_batch_size: 0
+input [
+  {
+    name: "prompt"
+    data_type: TYPE_STRING
+    dims: [ 1 ]
+  },
+  {
+    name: "image"
+    data_type: TYPE_STRING
+    dims: [ 1 ]
+    optional: true
+  },
+  {
+    name: "steps"
+    data_type: TYPE_INT64
+    dims: [ 1 ]
+    optional: true
+  },
+  {
+    name: "scheduler"
+    data_type: TYPE_STRING
+    dims: [ 1 ]
+    optional: true
+  }
+]
+output [
+  {
+    name: "output"
+    data_type: TYPE_STRING
+    dims: [ 1 ]
+  }
+]
+instance_group [
+  {
+    kind: KIND_GPU
+    count: 1
+  }
+]
+`, modelConfig)
+}
+
+func TestWriteModel(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, WriteModel(dir, "hotdog-detector", loadTestSchema(t), false))
+
+	modelConfig, err := os.ReadFile(filepath.Join(dir, "hotdog-detector", "config.pbtxt"))
+	require.NoError(t, err)
+	require.Contains(t, string(modelConfig), "kind: KIND_CPU")
+	require.FileExists(t, filepath.Join(dir, "hotdog-detector", "1", "model.py"))
+}
@@ -0,0 +1,26 @@
+package files
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// IsExecutable returns whether path is a file that Windows runs, which it decides by its extension
+func IsExecutable(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return false
+	}
+	pathext := os.Getenv("PATHEXT")
+	if pathext == "" {
+		pathext = ".com;.exe;.bat;.cmd"
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, e := range strings.Split(strings.ToLower(pathext), ";") {
+		if e != "" && e == ext {
+			return true
+		}
+	}
+	return false
+}
@@ -4,8 +4,6 @@ import (
 	"fmt"
 	"io"
 	"os"
-
-	"golang.org/x/sys/unix"
 )
 
 func Exists(path string) (bool, error) {
@@ -26,10 +24,6 @@ func IsDir(path string) (bool, error) {
 	return file.Mode().IsDir(), nil
 }
 
-func IsExecutable(path string) bool {
-	return unix.Access(path, unix.X_OK) == nil
-}
-
 func CopyFile(src string, dest string) error {
 	in, err := os.Open(src)
 	if err != nil {
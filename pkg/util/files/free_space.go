@@ -0,0 +1,6 @@
+package files
+
+// FreeSpace returns how many bytes can be written to the filesystem that path is on
+func FreeSpace(path string) (int64, error) {
+	return freeSpace(path)
+}
@@ -0,0 +1,35 @@
+package files
+
+import (
+	"os"
+)
+
+// Lock is an exclusive lock on a file. The operating system releases it if the process exits without unlocking
+// it, so a build that was killed doesn't leave its project locked.
+type Lock struct {
+	file *os.File
+}
+
+// TryLock takes an exclusive lock on the file at path, creating it if it doesn't exist. It returns nil if
+// another process has the lock.
+func TryLock(path string) (*Lock, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	locked, err := lockFile(f)
+	if err != nil || !locked {
+		f.Close()
+		return nil, err
+	}
+	return &Lock{file: f}, nil
+}
+
+// Unlock releases the lock
+func (l *Lock) Unlock() error {
+	if err := unlockFile(l.file); err != nil {
+		l.file.Close()
+		return err
+	}
+	return l.file.Close()
+}
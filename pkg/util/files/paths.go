@@ -0,0 +1,25 @@
+package files
+
+import (
+	"runtime"
+	"strings"
+)
+
+// CaseInsensitive is whether paths that only differ by case are the same file, which they are on Windows
+var CaseInsensitive = runtime.GOOS == "windows"
+
+// SamePath returns whether a and b, which are separated by forward slashes, are the same path
+func SamePath(a string, b string) bool {
+	if CaseInsensitive {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// InDir returns whether p is dir, or is in it. Both are separated by forward slashes.
+func InDir(p string, dir string) bool {
+	if SamePath(p, dir) {
+		return true
+	}
+	return len(p) > len(dir) && p[len(dir)] == '/' && SamePath(p[:len(dir)], dir)
+}
@@ -0,0 +1,19 @@
+package files
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInDir(t *testing.T) {
+	require.True(t, InDir("weights", "weights"))
+	require.True(t, InDir("weights/model.bin", "weights"))
+	require.False(t, InDir("weights-old/model.bin", "weights"))
+	require.False(t, InDir("Weights/model.bin", "weights"))
+
+	defer func(caseInsensitive bool) { CaseInsensitive = caseInsensitive }(CaseInsensitive)
+	CaseInsensitive = true
+	require.True(t, InDir("Weights/model.bin", "weights"))
+	require.True(t, SamePath("Predict.py", "predict.py"))
+}
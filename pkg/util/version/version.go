@@ -102,3 +102,25 @@ func (v *Version) Matches(other *Version) bool {
 func Matches(v1 string, v2 string) bool {
 	return MustVersion(v1).Matches(MustVersion(v2))
 }
+
+// Bump returns the version with part, which is major, minor or patch, incremented, and the parts after it reset
+func (v *Version) Bump(part string) (*Version, error) {
+	switch part {
+	case "major":
+		return &Version{Major: v.Major + 1}, nil
+	case "minor":
+		return &Version{Major: v.Major, Minor: v.Minor + 1}, nil
+	case "patch":
+		return &Version{Major: v.Major, Minor: v.Minor, Patch: v.Patch + 1}, nil
+	default:
+		return nil, fmt.Errorf("Invalid version part %s, must be major, minor or patch", part)
+	}
+}
+
+func (v *Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Metadata != "" {
+		s += "+" + v.Metadata
+	}
+	return s
+}
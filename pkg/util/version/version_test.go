@@ -27,3 +27,23 @@ func TestVersionEqual(t *testing.T) {
 		require.Equal(t, tt.equal, Equal(tt.v1, tt.v2))
 	}
 }
+
+func TestVersionBump(t *testing.T) {
+	for _, tt := range []struct {
+		v        string
+		part     string
+		expected string
+	}{
+		{"1.2.3", "major", "2.0.0"},
+		{"1.2.3", "minor", "1.3.0"},
+		{"1.2.3", "patch", "1.2.4"},
+		{"1", "minor", "1.1.0"},
+		{"1.2.3+build.4", "patch", "1.2.4"},
+	} {
+		bumped, err := MustVersion(tt.v).Bump(tt.part)
+		require.NoError(t, err)
+		require.Equal(t, tt.expected, bumped.String())
+	}
+	_, err := MustVersion("1.2.3").Bump("build")
+	require.Error(t, err)
+}
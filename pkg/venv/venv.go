@@ -0,0 +1,160 @@
+// Package venv manages the Python virtualenvs that models are run in when they run on the host instead of in Docker
+package venv
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/dockerfile"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// stampFilename is the file in a virtualenv with the checksum of what was installed in it, so it's only
+// reinstalled when that changes
+const stampFilename = ".cog-installed"
+
+// Dir returns where the virtualenv for the project in projectDir is. It's in the user's cache directory, not the
+// project, so it isn't sent to Docker in build contexts.
+func Dir(projectDir string) (string, error) {
+	absProjectDir, err := filepath.Abs(projectDir)
+	if err != nil {
+		return "", err
+	}
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("Failed to find cache directory: %w", err)
+	}
+	name := fmt.Sprintf("%s-%s", filepath.Base(absProjectDir), checksum(absProjectDir)[:8])
+	return filepath.Join(cacheDir, "cog", "venvs", name), nil
+}
+
+// Python returns the python executable in the virtualenv at dir
+func Python(dir string) string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(dir, "Scripts", "python.exe")
+	}
+	return filepath.Join(dir, "bin", "python")
+}
+
+// Ensure creates the virtualenv for the project in projectDir, or updates it if cog.yaml or cog have changed, and
+// returns its python executable. Python packages are installed for the host, without a GPU, so on Apple Silicon
+// PyTorch can use Metal. system_packages and run commands can't be installed outside Docker, so they are skipped.
+func Ensure(cfg *config.Config, projectDir string) (string, error) {
+	if len(cfg.Build.SystemPackages) > 0 || len(cfg.Build.Run) > 0 {
+		console.Warn("system_packages and run in cog.yaml are skipped when running outside Docker, so install anything the model needs from them yourself")
+	}
+
+	requirements, err := Requirements(cfg)
+	if err != nil {
+		return "", err
+	}
+	dir, err := Dir(projectDir)
+	if err != nil {
+		return "", err
+	}
+	python := Python(dir)
+	stamp := checksum(cfg.Build.PythonVersion, requirements, dockerfile.CogWheel())
+	if installed, err := os.ReadFile(filepath.Join(dir, stampFilename)); err == nil && string(installed) == stamp {
+		console.Debugf("Python packages in %s are up to date", dir)
+		return python, nil
+	}
+
+	hostPython, err := findPython(cfg.Build.PythonVersion)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(python); err != nil {
+		console.Infof("Creating virtualenv in %s...", dir)
+		if err := run(hostPython, "-m", "venv", dir); err != nil {
+			return "", fmt.Errorf("Failed to create virtualenv in %s: %w", dir, err)
+		}
+	}
+
+	console.Info("Installing Python packages...")
+	wheel := filepath.Join(dir, dockerfile.CogWheelFilename)
+	if err := os.WriteFile(wheel, dockerfile.CogWheel(), 0o644); err != nil {
+		return "", fmt.Errorf("Failed to write %s: %w", wheel, err)
+	}
+	args := []string{"-m", "pip", "install", wheel}
+	if requirements != "" {
+		requirementsFile := filepath.Join(dir, "requirements.txt")
+		if err := os.WriteFile(requirementsFile, []byte(requirements), 0o644); err != nil {
+			return "", fmt.Errorf("Failed to write %s: %w", requirementsFile, err)
+		}
+		args = append(args, "-r", requirementsFile)
+	}
+	if err := run(python, args...); err != nil {
+		return "", fmt.Errorf("Failed to install Python packages: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, stampFilename), []byte(stamp), 0o644); err != nil {
+		return "", fmt.Errorf("Failed to write %s: %w", stampFilename, err)
+	}
+	return python, nil
+}
+
+// Requirements returns the requirements.txt to install in the virtualenv. They're the CPU packages for the host,
+// even if the model uses a GPU, because CUDA packages don't install on it.
+func Requirements(cfg *config.Config) (string, error) {
+	hostCfg := *cfg
+	build := *cfg.Build
+	build.GPU = false
+	hostCfg.Build = &build
+
+	stable, err := hostCfg.StablePythonRequirementsForArch(runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		return "", err
+	}
+	requirements, err := hostCfg.PythonRequirementsForArch(runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(strings.Join([]string{stable, requirements}, "\n")), nil
+}
+
+// findPython returns a Python on the PATH with the version that cog.yaml asks for
+func findPython(version string) (string, error) {
+	for _, name := range []string{"python" + majorMinor(version), "python3", "python"} {
+		p, err := exec.LookPath(name)
+		if err != nil {
+			continue
+		}
+		out, err := exec.Command(p, "-c", `import sys; print("%d.%d" % sys.version_info[:2])`).Output()
+		if err != nil {
+			continue
+		}
+		if strings.TrimSpace(string(out)) == majorMinor(version) {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("Python %s wasn't found. Install it, for example with `brew install python@%s`, so the model can run outside Docker", version, majorMinor(version))
+}
+
+func majorMinor(version string) string {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return version
+	}
+	return parts[0] + "." + parts[1]
+}
+
+func checksum(parts ...interface{}) string {
+	h := sha256.New()
+	for _, part := range parts {
+		fmt.Fprintf(h, "%s\n", part)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+func run(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	console.Debug("$ " + strings.Join(cmd.Args, " "))
+	return cmd.Run()
+}
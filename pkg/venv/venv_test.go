@@ -0,0 +1,50 @@
+package venv
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+func TestRequirementsWithoutGPU(t *testing.T) {
+	cfg := &config.Config{
+		Build: &config.Build{
+			GPU:           true,
+			PythonVersion: "3.8",
+			PythonPackages: []string{
+				"torch==1.7.1",
+				"foo==1.0.0",
+			},
+			CUDA: "11.8",
+		},
+	}
+	require.NoError(t, cfg.ValidateAndComplete(""))
+
+	requirements, err := Requirements(cfg)
+	require.NoError(t, err)
+	require.NotContains(t, requirements, "+cu")
+	require.Contains(t, requirements, "foo==1.0.0")
+	// The model still uses a GPU in Docker
+	require.True(t, cfg.Build.GPU)
+}
+
+func TestMajorMinor(t *testing.T) {
+	require.Equal(t, "3.11", majorMinor("3.11"))
+	require.Equal(t, "3.11", majorMinor("3.11.4"))
+	require.Equal(t, "3", majorMinor("3"))
+}
+
+func TestDir(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	dir, err := Dir("/src/my-model")
+	require.NoError(t, err)
+	require.Contains(t, dir, "my-model-")
+
+	other, err := Dir("/other/my-model")
+	require.NoError(t, err)
+	require.NotEqual(t, dir, other)
+}
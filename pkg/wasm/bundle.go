@@ -0,0 +1,78 @@
+// Package wasm writes bundles that run Cog models with wasi-nn, for edge deployment
+package wasm
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/getkin/kin-openapi/openapi3"
+
+	"github.com/replicate/cog/pkg/global"
+)
+
+const (
+	// ModelFile is the name of the ONNX model in a bundle
+	ModelFile = "model.onnx"
+	// ManifestFile is the name of the manifest that describes a bundle
+	ManifestFile = "manifest.json"
+	// SchemaFile is the name of the model's OpenAPI schema in a bundle
+	SchemaFile = "openapi_schema.json"
+)
+
+// Manifest describes a bundle, and how a wasi-nn host loads its model
+type Manifest struct {
+	Name       string `json:"name"`
+	CogVersion string `json:"cog_version"`
+	Graph      Graph  `json:"graph"`
+	Schema     string `json:"schema"`
+}
+
+// Graph is how the model is loaded with wasi-nn's load()
+type Graph struct {
+	// Path of the model in the bundle
+	Path string `json:"path"`
+	// Encoding is the wasi-nn graph encoding
+	Encoding string `json:"encoding"`
+	// ExecutionTarget is the wasi-nn execution target
+	ExecutionTarget string `json:"execution_target"`
+}
+
+// WriteBundle writes the manifest and schema for the model called name to dir, which must
+// already contain the model in ONNX format as ModelFile
+func WriteBundle(dir string, name string, schema *openapi3.T, gpu bool) error {
+	if _, err := os.Stat(filepath.Join(dir, ModelFile)); err != nil {
+		return fmt.Errorf("The model was not converted to ONNX: %w", err)
+	}
+
+	target := "cpu"
+	if gpu {
+		target = "gpu"
+	}
+	manifest := Manifest{
+		Name:       name,
+		CogVersion: global.Version,
+		Graph: Graph{
+			Path:            ModelFile,
+			Encoding:        "onnx",
+			ExecutionTarget: target,
+		},
+		Schema: SchemaFile,
+	}
+	if err := writeJSON(filepath.Join(dir, ManifestFile), manifest); err != nil {
+		return err
+	}
+	return writeJSON(filepath.Join(dir, SchemaFile), schema)
+}
+
+func writeJSON(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("Failed to write %s: %w", path, err)
+	}
+	return nil
+}
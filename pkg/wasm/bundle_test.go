@@ -0,0 +1,29 @@
+package wasm
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteBundle(t *testing.T) {
+	dir := t.TempDir()
+	schema := &openapi3.T{OpenAPI: "3.0.2", Info: &openapi3.Info{Title: "Cog", Version: "0.1.0"}}
+
+	require.Error(t, WriteBundle(dir, "hotdog-detector", schema, false))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ModelFile), []byte("onnx"), 0o644))
+	require.NoError(t, WriteBundle(dir, "hotdog-detector", schema, true))
+
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	require.NoError(t, err)
+	manifest := Manifest{}
+	require.NoError(t, json.Unmarshal(data, &manifest))
+	require.Equal(t, "hotdog-detector", manifest.Name)
+	require.Equal(t, Graph{Path: ModelFile, Encoding: "onnx", ExecutionTarget: "gpu"}, manifest.Graph)
+	require.FileExists(t, filepath.Join(dir, SchemaFile))
+}
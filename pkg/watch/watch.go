@@ -0,0 +1,126 @@
+// Package watch watches a project directory for files that change, by polling it
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// DefaultInterval is how often the project directory is checked for changes
+const DefaultInterval = 500 * time.Millisecond
+
+// DefaultDebounce is how long files have to stop changing before the changes are reported, so that saving
+// several files, or a file being written in parts, is one change
+const DefaultDebounce = time.Second
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// Watcher watches the files in a directory, apart from the ones Ignore returns true for
+type Watcher struct {
+	Dir string
+	// Ignore returns whether the path, relative to Dir, isn't watched. If a directory is ignored, so is
+	// everything in it.
+	Ignore   func(p string, isDir bool) bool
+	Interval time.Duration
+	Debounce time.Duration
+
+	files map[string]fileState
+}
+
+// New returns a Watcher for the files in dir as they are now
+func New(dir string, ignore func(p string, isDir bool) bool) (*Watcher, error) {
+	w := &Watcher{Dir: dir, Ignore: ignore, Interval: DefaultInterval, Debounce: DefaultDebounce}
+	files, err := w.scan()
+	if err != nil {
+		return nil, err
+	}
+	w.files = files
+	return w, nil
+}
+
+// Wait blocks until files have been created, changed or deleted since it last returned, or since the Watcher
+// was created, and have stopped changing for Debounce. It returns their paths, relative to Dir, sorted. If ctx is
+// canceled, it returns ctx's error.
+func (w *Watcher) Wait(ctx context.Context) ([]string, error) {
+	changed := map[string]bool{}
+	lastChange := time.Time{}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(w.Interval):
+		}
+		files, err := w.scan()
+		if err != nil {
+			return nil, err
+		}
+		if diff := changedFiles(w.files, files); len(diff) > 0 {
+			for _, p := range diff {
+				changed[p] = true
+			}
+			lastChange = time.Now()
+		}
+		w.files = files
+		if len(changed) > 0 && time.Since(lastChange) >= w.Debounce {
+			break
+		}
+	}
+	paths := []string{}
+	for p := range changed {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+func (w *Watcher) scan() (map[string]fileState, error) {
+	files := map[string]fileState{}
+	err := filepath.Walk(w.Dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			// Files can be deleted while the directory is walked
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		rel, err := filepath.Rel(w.Dir, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		if w.Ignore != nil && w.Ignore(filepath.ToSlash(rel), info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.IsDir() {
+			files[filepath.ToSlash(rel)] = fileState{modTime: info.ModTime(), size: info.Size()}
+		}
+		return nil
+	})
+	return files, err
+}
+
+func changedFiles(before map[string]fileState, after map[string]fileState) []string {
+	changed := []string{}
+	for p, state := range after {
+		if previous, ok := before[p]; !ok || previous != state {
+			changed = append(changed, p)
+		}
+	}
+	for p := range before {
+		if _, ok := after[p]; !ok {
+			changed = append(changed, p)
+		}
+	}
+	return changed
+}
@@ -0,0 +1,50 @@
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "predict.py"), []byte("a"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "old.py"), []byte("a"), 0o644))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, ".cog", "tmp"), 0o755))
+
+	w, err := New(dir, func(p string, isDir bool) bool {
+		return p == ".cog" || strings.HasSuffix(p, ".pyc")
+	})
+	require.NoError(t, err)
+	w.Interval = 10 * time.Millisecond
+	w.Debounce = 50 * time.Millisecond
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		_ = os.WriteFile(filepath.Join(dir, "predict.py"), []byte("ab"), 0o644)
+		_ = os.WriteFile(filepath.Join(dir, ".cog", "tmp", "Dockerfile"), []byte("FROM python"), 0o644)
+		_ = os.WriteFile(filepath.Join(dir, "predict.pyc"), []byte("x"), 0o644)
+		time.Sleep(20 * time.Millisecond)
+		_ = os.Remove(filepath.Join(dir, "old.py"))
+	}()
+
+	changed, err := w.Wait(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{"old.py", "predict.py"}, changed)
+}
+
+func TestWatcherCanceled(t *testing.T) {
+	w, err := New(t.TempDir(), func(p string, isDir bool) bool { return false })
+	require.NoError(t, err)
+	w.Interval = 10 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	_, err = w.Wait(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
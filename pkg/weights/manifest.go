@@ -9,6 +9,7 @@ import (
 	"io"
 	"os"
 	"path"
+	"path/filepath"
 )
 
 // Manifest contains metadata about weights files in a model
@@ -20,6 +21,8 @@ type Manifest struct {
 type Metadata struct {
 	// CRC32 is the CRC32 checksum of the file encoded as a hexadecimal string
 	CRC32 string `json:"crc32"`
+	// SHA256 is the SHA-256 checksum of the file encoded as a hexadecimal string, which is only in signed manifests
+	SHA256 string `json:"sha256,omitempty"`
 }
 
 // NewManifest creates a new manifest
@@ -27,6 +30,68 @@ func NewManifest() *Manifest {
 	return &Manifest{}
 }
 
+// ManifestForDir creates a manifest of the weights files in dir, with paths relative to dir
+func ManifestForDir(dir string) (*Manifest, error) {
+	walker := func(root string, walkFn filepath.WalkFunc) error {
+		return filepath.Walk(filepath.Join(dir, root), func(path string, info os.FileInfo, err error) error {
+			rel, relErr := filepath.Rel(dir, path)
+			if relErr != nil {
+				return relErr
+			}
+			return walkFn(rel, info, err)
+		})
+	}
+	dirs, files, err := FindWeights(walker)
+	if err != nil {
+		return nil, err
+	}
+
+	m := NewManifest()
+	for _, weightsDir := range dirs {
+		err := walker(weightsDir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			return m.addFileAs(filepath.Join(dir, path), filepath.ToSlash(path))
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, path := range files {
+		if err := m.addFileAs(filepath.Join(dir, path), filepath.ToSlash(path)); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// ManifestForPath creates a manifest of every file at p, which is a file or a directory in root, with paths
+// relative to root
+func ManifestForPath(root string, p string) (*Manifest, error) {
+	m := NewManifest()
+	err := filepath.Walk(filepath.Join(root, p), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		return m.addFileAs(path, filepath.ToSlash(rel))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // LoadManifest loads a manifest from a file
 func LoadManifest(filename string) (*Manifest, error) {
 	if _, err := os.Stat(filename); err != nil {
@@ -76,8 +141,14 @@ func (m *Manifest) Equal(other *Manifest) bool {
 	return true
 }
 
-// AddFile adds a file to the manifest, calculating its CRC32 checksum
+// AddFile adds a file to the manifest, calculating its CRC32 checksum. It's keyed by path with forward slashes, so
+// manifests are the same on every OS.
 func (m *Manifest) AddFile(path string) error {
+	return m.addFileAs(path, filepath.ToSlash(path))
+}
+
+// addFileAs adds the file at path to the manifest as name
+func (m *Manifest) addFileAs(path string, name string) error {
 	crc32Algo := crc32.NewIEEE()
 	// generate checksum of file
 	file, err := os.Open(path)
@@ -99,7 +170,7 @@ func (m *Manifest) AddFile(path string) error {
 	if m.Files == nil {
 		m.Files = make(map[string]Metadata)
 	}
-	m.Files[path] = Metadata{
+	m.Files[name] = Metadata{
 		CRC32: encoded,
 	}
 
@@ -0,0 +1,42 @@
+package weights
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestManifestForDir(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "predict.py"), []byte("print('hello')"), 0o644))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "models"), 0o755))
+	weightsFile, err := os.Create(filepath.Join(dir, "models", "model.bin"))
+	require.NoError(t, err)
+	require.NoError(t, weightsFile.Truncate(sizeThreshold))
+	require.NoError(t, weightsFile.Close())
+
+	m, err := ManifestForDir(dir)
+	require.NoError(t, err)
+	require.Equal(t, []string{"models/model.bin"}, keys(m.Files))
+}
+
+func TestManifestForPath(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "weights", "int8"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "weights", "int8", "model.safetensors"), []byte("weights"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "weights", "fp16.safetensors"), []byte("weights"), 0o644))
+
+	m, err := ManifestForPath(dir, "weights/int8")
+	require.NoError(t, err)
+	require.Equal(t, map[string]Metadata{"weights/int8/model.safetensors": {CRC32: "5873d21a"}}, m.Files)
+}
+
+func keys(files map[string]Metadata) []string {
+	names := []string{}
+	for name := range files {
+		names = append(names, name)
+	}
+	return names
+}
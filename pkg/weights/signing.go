@@ -0,0 +1,84 @@
+package weights
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// LoadSigningKey loads the Ed25519 private key that signs weights manifests from a PEM file, as written by
+// `openssl genpkey -algorithm ed25519`
+func LoadSigningKey(path string) (ed25519.PrivateKey, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read weights signing key: %w", err)
+	}
+	block, _ := pem.Decode(contents)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("The weights signing key %s isn't a PEM private key. Create one with: openssl genpkey -algorithm ed25519 -out %s", path, path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse weights signing key %s: %w", path, err)
+	}
+	ed25519Key, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("The weights signing key %s must be an Ed25519 key. Create one with: openssl genpkey -algorithm ed25519 -out %s", path, path)
+	}
+	return ed25519Key, nil
+}
+
+// EncodePublicKey returns the public key of key as a PEM file, as written by `openssl pkey -pubout`
+func EncodePublicKey(key ed25519.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+// AddSHA256 adds the SHA-256 checksums of the files in the manifest, which are at their paths in root. They're
+// what signed manifests are checked with, because CRC32 checksums can be forged.
+func (m *Manifest) AddSHA256(root string) error {
+	names := []string{}
+	for name := range m.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		file, err := os.Open(filepath.Join(root, filepath.FromSlash(name)))
+		if err != nil {
+			return fmt.Errorf("failed to open file %s: %w", name, err)
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("failed to generate checksum of file %s: %w", name, err)
+		}
+		metadata := m.Files[name]
+		metadata.SHA256 = hex.EncodeToString(h.Sum(nil))
+		m.Files[name] = metadata
+	}
+	return nil
+}
+
+// Sign returns the manifest as JSON, and the Ed25519 signature of that JSON with key
+func (m *Manifest) Sign(key ed25519.PrivateKey) (contents []byte, signature []byte, err error) {
+	if m.Files == nil {
+		m.Files = map[string]Metadata{}
+	}
+	contents, err = json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, nil, err
+	}
+	return contents, ed25519.Sign(key, contents), nil
+}
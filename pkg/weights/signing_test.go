@@ -0,0 +1,52 @@
+package weights
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadSigningKey(t *testing.T) {
+	dir := t.TempDir()
+	key := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	keyPath := filepath.Join(dir, "weights.key")
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+
+	loaded, err := LoadSigningKey(keyPath)
+	require.NoError(t, err)
+	require.Equal(t, key, loaded)
+
+	publicKey, err := EncodePublicKey(loaded)
+	require.NoError(t, err)
+	require.Equal(t, "-----BEGIN PUBLIC KEY-----\nMCowBQYDK2VwAyEAO2onvM62pC1io6jQKm8Nc2UyFXcd4kOmOsBIoYtZ2ik=\n-----END PUBLIC KEY-----\n", string(publicKey))
+
+	require.NoError(t, os.WriteFile(keyPath, []byte("not a key"), 0o600))
+	_, err = LoadSigningKey(keyPath)
+	require.ErrorContains(t, err, "isn't a PEM private key")
+}
+
+func TestSignManifest(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "weights"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "weights", "model.bin"), []byte("weights"), 0o644))
+
+	m, err := ManifestForPath(dir, "weights")
+	require.NoError(t, err)
+	require.NoError(t, m.AddSHA256(dir))
+	require.Equal(t, map[string]Metadata{"weights/model.bin": {
+		CRC32:  "5873d21a",
+		SHA256: "9a129038d9a00aed0cf6a7ea059ca50a813449061ab87848cf1a13eafdf33b2c",
+	}}, m.Files)
+
+	key := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	contents, signature, err := m.Sign(key)
+	require.NoError(t, err)
+	require.True(t, ed25519.Verify(key.Public().(ed25519.PublicKey), contents, signature))
+}
@@ -2,9 +2,12 @@ package weights
 
 import (
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
 	"strings"
+
+	"github.com/replicate/cog/pkg/util/files"
 )
 
 var prefixesToIgnore = []string{".cog", ".git", "__pycache__"}
@@ -27,6 +30,8 @@ func FindWeights(fw FileWalker) ([]string, []string, error) {
 		if err != nil {
 			return err
 		}
+		// paths are used in Dockerfiles and .dockerignore files, which are separated by forward slashes on every OS
+		path = filepath.ToSlash(path)
 		if info.IsDir() {
 			return nil
 		}
@@ -127,7 +132,7 @@ func getDirsAndRootfiles(files []string) ([]string, []string) {
 	// for large model files in root directory, we should not add the "." to dirs
 	var rootFiles []string
 	for _, f := range files {
-		dir := filepath.Dir(f)
+		dir := path.Dir(f)
 		if dir == "." || dir == "/" {
 			rootFiles = append(rootFiles, f)
 			continue
@@ -143,9 +148,7 @@ func getDirsAndRootfiles(files []string) ([]string, []string) {
 
 func hasParent(dir string, dirs []string) bool {
 	for _, d := range dirs {
-		parent := d + string(filepath.Separator)
-		child := dir + string(filepath.Separator)
-		if strings.HasPrefix(child, parent) {
+		if files.InDir(dir, d) {
 			return true
 		}
 
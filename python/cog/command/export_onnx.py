@@ -0,0 +1,29 @@
+"""
+python -m cog.command.export_onnx <path>
+
+Runs the predictor's setup() and writes its model to path in ONNX format,
+using the predictor's export_onnx() method.
+"""
+import sys
+
+from ..predictor import (
+    get_predictor_ref,
+    load_config,
+    load_predictor_from_ref,
+    run_setup,
+)
+
+if __name__ == "__main__":
+    path = sys.argv[1]
+    config = load_config()
+    predictor = load_predictor_from_ref(get_predictor_ref(config))
+    export_onnx = getattr(predictor, "export_onnx", None)
+    if export_onnx is None:
+        print(
+            "The model can't be converted to ONNX: the predictor must have an "
+            "export_onnx(path) method",
+            file=sys.stderr,
+        )
+        sys.exit(1)
+    run_setup(predictor)
+    export_onnx(path)
@@ -0,0 +1,105 @@
+"""
+python -m cog.command.licenses [system package ...]
+
+This prints a JSON list of the Python packages installed in the image, and the
+given system packages, with the licenses they declare.
+"""
+import json
+import os
+import re
+import subprocess
+import sys
+from importlib import metadata
+from typing import Any, Dict, List, Optional
+
+LICENSE_CLASSIFIER_PREFIX = "License :: "
+
+
+def python_packages() -> List[Dict[str, Any]]:
+    packages = []
+    for dist in metadata.distributions():
+        meta = dist.metadata
+        name = meta.get("Name")
+        if not name:
+            continue
+        packages.append(
+            {
+                "type": "pip",
+                "name": name,
+                "version": dist.version,
+                "license": python_license(meta),
+            }
+        )
+    return packages
+
+
+def python_license(meta: Any) -> str:
+    expression = meta.get("License-Expression")
+    if expression:
+        return expression
+    # Classifiers are more consistent than the free-form License field, so
+    # prefer them
+    classifiers = [
+        c[len(LICENSE_CLASSIFIER_PREFIX) :].split(" :: ")[-1]
+        for c in meta.get_all("Classifier") or []
+        if c.startswith(LICENSE_CLASSIFIER_PREFIX)
+    ]
+    if classifiers:
+        return " OR ".join(classifiers)
+    license = meta.get("License") or ""
+    # Some packages put the whole license text in this field
+    if "\n" in license.strip():
+        return license.strip().splitlines()[0]
+    return license.strip()
+
+
+def system_packages(names: List[str]) -> List[Dict[str, Any]]:
+    packages = []
+    for name in names:
+        packages.append(
+            {
+                "type": "apt",
+                "name": name,
+                "version": dpkg_version(name),
+                "license": debian_license(name),
+            }
+        )
+    return packages
+
+
+def dpkg_version(name: str) -> str:
+    try:
+        return subprocess.check_output(
+            ["dpkg-query", "--showformat=${Version}", "--show", name],
+            stderr=subprocess.DEVNULL,
+            text=True,
+        ).strip()
+    except (OSError, subprocess.CalledProcessError):
+        return ""
+
+
+def debian_license(name: str) -> Optional[str]:
+    """
+    Returns the licenses in a package's machine-readable copyright file, or
+    None if it doesn't have one.
+    """
+    path = os.path.join("/usr/share/doc", name, "copyright")
+    try:
+        with open(path, encoding="utf-8", errors="replace") as f:
+            contents = f.read()
+    except OSError:
+        return None
+    licenses = []
+    for match in re.finditer(r"^License:[ \t]*(\S.*)$", contents, re.MULTILINE):
+        # Debian writes expressions in lower case, e.g. "GPL-2+ or Artistic"
+        license = re.sub(r"\s+or\s+", " OR ", match.group(1).strip())
+        license = re.sub(r"\s+and\s+", " AND ", license)
+        if license not in licenses:
+            licenses.append(license)
+    if not licenses:
+        return None
+    return " AND ".join(licenses)
+
+
+if __name__ == "__main__":
+    print(json.dumps(python_packages() + system_packages(sys.argv[1:]), indent=2))
@@ -0,0 +1,12 @@
+"""
+python -m cog.command.prefetch_weights
+
+Downloads the model's lazy weights, and the weights of the profile in
+COG_WEIGHTS_PROFILE, into COG_WEIGHTS_CACHE, so containers that share the
+cache don't have to download them when they start. Run by `cog prefetch`.
+"""
+from ..weights import prepare_weights_files, prepare_weights_profile
+
+if __name__ == "__main__":
+    prepare_weights_files()
+    prepare_weights_profile()
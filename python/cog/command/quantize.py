@@ -0,0 +1,133 @@
+"""
+python -m cog.command.quantize --method <awq|gptq|gguf-q4> <path> [path ...]
+
+Quantizes the Hugging Face models in the given weights directories in place.
+A directory is a Hugging Face model if it has a config.json in it. Other
+weights are left as they are.
+"""
+import argparse
+import os
+import shutil
+import subprocess
+import sys
+from typing import List
+
+
+def find_models(paths: List[str]) -> List[str]:
+    models = []
+    for root_path in paths:
+        if not os.path.isdir(root_path):
+            continue
+        for root, _, files in os.walk(root_path):
+            if "config.json" in files and any(
+                f.endswith((".safetensors", ".bin")) for f in files
+            ):
+                models.append(root)
+    return models
+
+
+def require_gpu(method: str) -> None:
+    import torch
+
+    if not torch.cuda.is_available():
+        print(
+            f"Quantizing with {method} needs a GPU, but the build can't see one. "
+            "Build on a machine with a GPU, with Docker's default runtime set to nvidia.",
+            file=sys.stderr,
+        )
+        sys.exit(1)
+
+
+def quantize_awq(model_path: str, out_path: str) -> None:
+    from awq import AutoAWQForCausalLM
+    from transformers import AutoTokenizer
+
+    model = AutoAWQForCausalLM.from_pretrained(model_path)
+    tokenizer = AutoTokenizer.from_pretrained(model_path)
+    model.quantize(
+        tokenizer,
+        quant_config={
+            "zero_point": True,
+            "q_group_size": 128,
+            "w_bit": 4,
+            "version": "GEMM",
+        },
+    )
+    model.save_quantized(out_path)
+    tokenizer.save_pretrained(out_path)
+
+
+def quantize_gptq(model_path: str, out_path: str) -> None:
+    from transformers import AutoModelForCausalLM, AutoTokenizer, GPTQConfig
+
+    tokenizer = AutoTokenizer.from_pretrained(model_path)
+    model = AutoModelForCausalLM.from_pretrained(
+        model_path,
+        device_map="auto",
+        quantization_config=GPTQConfig(bits=4, dataset="c4", tokenizer=tokenizer),
+    )
+    model.save_pretrained(out_path)
+    tokenizer.save_pretrained(out_path)
+
+
+def quantize_gguf_q4(model_path: str, out_path: str) -> None:
+    llama_cpp = os.environ.get("LLAMA_CPP", "/llama.cpp")
+    os.makedirs(out_path)
+    f16 = os.path.join(out_path, "model-f16.gguf")
+    subprocess.run(  # noqa: S603
+        [
+            sys.executable,
+            os.path.join(llama_cpp, "convert_hf_to_gguf.py"),
+            model_path,
+            "--outtype",
+            "f16",
+            "--outfile",
+            f16,
+        ],
+        check=True,
+    )
+    subprocess.run(  # noqa: S603
+        [
+            os.path.join(llama_cpp, "llama-quantize"),
+            f16,
+            os.path.join(out_path, "model-q4_k_m.gguf"),
+            "Q4_K_M",
+        ],
+        check=True,
+    )
+    os.remove(f16)
+    for name in os.listdir(model_path):
+        if name.startswith("tokenizer") or name.endswith(".json"):
+            shutil.copy(os.path.join(model_path, name), out_path)
+
+
+QUANTIZERS = {
+    "awq": quantize_awq,
+    "gptq": quantize_gptq,
+    "gguf-q4": quantize_gguf_q4,
+}
+
+if __name__ == "__main__":
+    parser = argparse.ArgumentParser()
+    parser.add_argument("--method", required=True, choices=QUANTIZERS.keys())
+    parser.add_argument("paths", nargs="+")
+    args = parser.parse_args()
+
+    models = find_models(args.paths)
+    if not models:
+        print(
+            "There are no Hugging Face models to quantize in the weights: "
+            "a model is a directory with a config.json and .safetensors or .bin files",
+            file=sys.stderr,
+        )
+        sys.exit(1)
+
+    if args.method in ("awq", "gptq"):
+        require_gpu(args.method)
+
+    for model in models:
+        print(f"Quantizing {model} with {args.method}...")
+        quantized = model.rstrip("/") + ".quantized"
+        QUANTIZERS[args.method](model, quantized)
+        shutil.rmtree(model)
+        os.rename(quantized, model)
@@ -0,0 +1,32 @@
+"""
+python -m cog.command.verify
+
+Checks that the predictor can be imported and that the HTTP server can load it,
+so broken dependencies fail the build rather than the first prediction. Run at
+the end of the build if build.verify is set in cog.yaml.
+"""
+import sys
+import traceback
+
+from ..errors import ConfigDoesNotExist, PredictorNotSet
+from ..predictor import get_predictor_ref, load_config
+from ..server.http import create_app
+
+if __name__ == "__main__":
+    try:
+        config = load_config()
+        ref = get_predictor_ref(config)
+        # This imports the predictor, and checks its inputs and outputs
+        create_app(config, shutdown_event=None)
+    except (ConfigDoesNotExist, PredictorNotSet):
+        # There is no predictor to check
+        sys.exit(0)
+    except Exception:
+        traceback.print_exc()
+        print(
+            "\nThe predictor failed to load. Fix the error above, "
+            "or set build.verify to false in cog.yaml to skip this check.",
+            file=sys.stderr,
+        )
+        sys.exit(1)
+    print(f"Loaded {ref}")
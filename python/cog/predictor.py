@@ -43,6 +43,11 @@ from .types import (
 from .types import (
     Path as CogPath,
 )
+from .weights import (
+    prepare_weights_files,
+    prepare_weights_profile,
+    verify_weights_manifest,
+)
 
 ALLOWED_INPUT_TYPES: List[Type[Any]] = [str, int, float, bool, CogFile, CogPath]
 
@@ -65,6 +70,7 @@ class BasePredictor(ABC):
 
 
 def run_setup(predictor: BasePredictor) -> None:
+    prepare_weights()
     weights = get_weights_argument(predictor)
     if weights:
         predictor.setup(weights=weights)
@@ -73,19 +79,31 @@ def run_setup(predictor: BasePredictor) -> None:
 
 
 async def run_setup_async(predictor: BasePredictor) -> None:
+    prepare_weights()
     weights = get_weights_argument(predictor)
     maybe_coro = predictor.setup(weights=weights) if weights else predictor.setup()
     if maybe_coro:
         return await maybe_coro
 
 
+def prepare_weights() -> None:
+    # Fail before setup() loads weights that have been tampered with
+    verify_weights_manifest()
+    prepare_weights_files()
+    # The weights of the profile in COG_WEIGHTS_PROFILE are passed to setup(),
+    # and predictors that don't take weights can read COG_WEIGHTS_PATH
+    path = prepare_weights_profile()
+    if path is not None:
+        os.environ["COG_WEIGHTS_PATH"] = path
+
+
 def get_weights_argument(predictor: BasePredictor) -> Union[CogFile, CogPath, None]:
     # by the time we get here we assume predictor has a setup method
     weights_type = get_weights_type(predictor.setup)
     if weights_type is None:
         return None
     weights_url = os.environ.get("COG_WEIGHTS")
-    weights_path = "weights"
+    weights_path = os.environ.get("COG_WEIGHTS_PATH", "weights")
 
     # TODO: Cog{File,Path}.validate(...) methods accept either "real"
     # paths/files or URLs to those things. In future we can probably tidy this
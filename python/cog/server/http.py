@@ -1,13 +1,17 @@
 import argparse
 import asyncio
 import functools
+import hmac
+import json
 import logging
 import os
 import signal
 import socket
+import subprocess
 import sys
 import textwrap
 import threading
+import time
 import traceback
 from datetime import datetime, timezone
 from enum import Enum, auto, unique
@@ -17,7 +21,9 @@ from typing import (
     Awaitable,
     Callable,
     Dict,
+    List,
     Optional,
+    Set,
     TypeVar,
     Union,
 )
@@ -28,9 +34,10 @@ if TYPE_CHECKING:
 import attrs
 import structlog
 import uvicorn
-from fastapi import Body, FastAPI, Header, HTTPException, Path, Response
+from fastapi import Body, FastAPI, Header, HTTPException, Path, Request, Response
 from fastapi.encoders import jsonable_encoder
 from fastapi.exceptions import RequestValidationError
+from fastapi.middleware.cors import CORSMiddleware
 from fastapi.responses import JSONResponse
 from pydantic import ValidationError
 from pydantic.error_wrappers import ErrorWrapper
@@ -46,6 +53,8 @@ from ..predictor import (
     load_config,
     load_predictor_from_ref,
 )
+from . import openai_compat
+from .limits import MaxRequestSizeMiddleware
 from .runner import (
     PredictionRunner,
     RunnerBusyError,
@@ -53,6 +62,7 @@ from .runner import (
     SetupTask,
     UnknownPredictionError,
 )
+from .tls import self_signed_certificate
 
 log = structlog.get_logger("cog.server.http")
 
@@ -70,6 +80,9 @@ class MyState:
     health: Health
     setup_task: Optional[SetupTask]
     setup_result: Optional[SetupResult]
+    warmup_task: "Optional[asyncio.Task[None]]"
+    runner: "Optional[PredictionRunner]"
+    draining: bool
 
 
 class MyFastAPI(FastAPI):
@@ -85,17 +98,65 @@ def create_app(
     threads: int = 1,
     upload_url: Optional[str] = None,
     mode: str = "predict",
+    queue_size: int = 0,
+    predict_timeout: int = 0,
+    api_format: str = "cog",
+    aip_health_route: str = "/health",
+    aip_predict_route: str = "/predict",
+    openai: bool = False,
+    auth_token: Optional[str] = None,
+    cors_origins: Optional[List[str]] = None,
+    max_request_size: int = 0,
 ) -> MyFastAPI:
     app = MyFastAPI(
         title="Cog",  # TODO: mention model name?
         # version=None # TODO
     )
 
+    if auth_token:
+        # Health checks stay open, so orchestrators can probe the model
+        # without the token
+        unauthenticated_paths = {"/health-check", "/ping", aip_health_route}
+        expected_header = f"Bearer {auth_token}"
+
+        @app.middleware("http")
+        async def require_auth_token(request: Request, call_next: Any) -> Any:
+            if request.url.path in unauthenticated_paths:
+                return await call_next(request)
+            header = request.headers.get("authorization", "")
+            if not hmac.compare_digest(header.encode(), expected_header.encode()):
+                return JSONResponse(
+                    {"detail": "Missing or invalid auth token"},
+                    status_code=401,
+                    headers={"WWW-Authenticate": "Bearer"},
+                )
+            return await call_next(request)
+
+    if max_request_size > 0:
+        app.add_middleware(MaxRequestSizeMiddleware, max_size=max_request_size)
+
+    if cors_origins:
+        # Added last, so it's outermost and answers preflight requests, which
+        # don't have the auth token
+        app.add_middleware(
+            CORSMiddleware,
+            allow_origins=cors_origins,
+            allow_methods=["*"],
+            allow_headers=["*"],
+        )
+
     app.state.health = Health.STARTING
     app.state.setup_task = None
     app.state.setup_result = None
+    app.state.warmup_task = None
+    app.state.runner = None
+    app.state.draining = False
     started_at = datetime.now(tz=timezone.utc)
 
+    # Example inputs from cog.yaml that are run once after setup, before the
+    # model reports itself as ready
+    warmup_inputs = config.get("warmup") or []
+
     predictor_ref = get_predictor_ref(config, mode)
 
     try:
@@ -132,6 +193,7 @@ def create_app(
         shutdown_event=shutdown_event,
         upload_url=upload_url,
     )
+    app.state.runner = runner
 
     class PredictionRequest(schema.PredictionRequest.with_types(input_type=InputType)):
         pass
@@ -142,6 +204,10 @@ def create_app(
 
     http_semaphore = asyncio.Semaphore(threads)
 
+    # Predictions run one at a time. This is the number of predictions that
+    # are waiting for the runner to finish the one it's running.
+    queued = 0
+
     if TYPE_CHECKING:
         P = ParamSpec("P")
         T = TypeVar("T")
@@ -157,6 +223,26 @@ def create_app(
     @app.on_event("startup")
     def startup() -> None:
         app.state.setup_task = runner.setup()
+        if warmup_inputs:
+            app.state.setup_task.add_done_callback(_start_warmup)
+
+    def _start_warmup(task: SetupTask) -> None:
+        if task.cancelled() or task.exception() is not None:
+            return
+        if task.result().status != schema.Status.SUCCEEDED:
+            return
+        app.state.warmup_task = asyncio.create_task(_warmup())
+
+    async def _warmup() -> None:
+        for i, input in enumerate(warmup_inputs):
+            log.info("running warm-up prediction", index=i)
+            request = PredictionRequest(input=input)
+            _, async_result = runner.predict(request, upload=False)
+            prediction = await async_result
+            if prediction.status != schema.Status.SUCCEEDED:
+                raise RuntimeError(
+                    f"Warm-up prediction {i} {prediction.status}: {prediction.error}"
+                )
 
     @app.on_event("shutdown")
     def shutdown() -> None:
@@ -173,6 +259,7 @@ def create_app(
     @app.get("/health-check")
     async def healthcheck() -> Any:
         await _check_setup_task()
+        await _check_warmup_task()
         if app.state.health == Health.READY:
             health = Health.BUSY if runner.is_busy() else Health.READY
         else:
@@ -193,7 +280,10 @@ def create_app(
         """
         Run a single prediction on the model
         """
-        if runner.is_busy():
+        if app.state.draining:
+            return JSONResponse({"detail": "Shutting down"}, status_code=503)
+
+        if not await _wait_for_runner():
             return JSONResponse(
                 {"detail": "Already running a prediction"}, status_code=409
             )
@@ -217,6 +307,9 @@ def create_app(
         """
         Run a single prediction on the model (idempotent creation).
         """
+        if app.state.draining:
+            return JSONResponse({"detail": "Shutting down"}, status_code=503)
+
         if request.id is not None and request.id != prediction_id:
             raise RequestValidationError(
                 [
@@ -238,6 +331,24 @@ def create_app(
 
         return await _predict(request=request, respond_async=respond_async)
 
+    async def _wait_for_runner() -> bool:
+        """
+        Wait for the runner to become free if there is room in the queue.
+        Returns False if the prediction should be rejected. The caller must
+        start the prediction straight away, without awaiting anything else.
+        """
+        nonlocal queued
+        if not runner.is_busy():
+            return True
+        if queued >= queue_size:
+            return False
+        queued += 1
+        try:
+            await runner.wait_until_free()
+        finally:
+            queued -= 1
+        return True
+
     async def _predict(
         *, request: Optional[PredictionRequest], respond_async: bool = False
     ) -> Response:
@@ -263,6 +374,11 @@ def create_app(
                 {"detail": "Already running a prediction"}, status_code=409
             )
 
+        if predict_timeout:
+            asyncio.ensure_future(
+                _cancel_after_timeout(initial_response.id, async_result)
+            )
+
         if respond_async:
             return JSONResponse(jsonable_encoder(initial_response), status_code=202)
 
@@ -283,6 +399,23 @@ def create_app(
         encoded_response = jsonable_encoder(response_object)
         return JSONResponse(content=encoded_response)
 
+    async def _cancel_after_timeout(
+        prediction_id: Optional[str], result: "asyncio.Future[Any]"
+    ) -> None:
+        """
+        Cancel a prediction if it is still running after predict_timeout seconds
+        """
+        # asyncio.wait doesn't cancel the prediction or raise its errors, which
+        # are handled by the caller
+        await asyncio.wait({result}, timeout=predict_timeout)
+        if result.done():
+            return
+        log.warn("prediction timed out, canceling", timeout=predict_timeout)
+        try:
+            runner.cancel(prediction_id)
+        except UnknownPredictionError:
+            pass
+
     @app.post("/predictions/{prediction_id}/cancel")
     async def cancel(prediction_id: str = Path(..., title="Prediction ID")) -> Any:
         """
@@ -297,6 +430,180 @@ def create_app(
         else:
             return JSONResponse({}, status_code=200)
 
+    if api_format == "sagemaker":
+
+        @app.get("/ping")
+        async def sagemaker_ping() -> Any:
+            """
+            SageMaker health check, which succeeds once the model is ready
+            """
+            return await _ready()
+
+        @limited
+        @app.post(
+            "/invocations",
+            response_model=PredictionResponse,
+            response_model_exclude_unset=True,
+        )
+        async def sagemaker_invocations(
+            body: Union[Dict[str, Any], None] = Body(default=None),
+        ) -> Any:
+            """
+            Run a prediction from a SageMaker invocation. The body is either a
+            prediction request, or the inputs on their own.
+            """
+            if app.state.draining:
+                return JSONResponse({"detail": "Shutting down"}, status_code=503)
+
+            if body is not None and "input" not in body:
+                body = {"input": body}
+            try:
+                request = PredictionRequest(**(body or {}))
+            except ValidationError as e:
+                return JSONResponse(
+                    {"detail": jsonable_encoder(e.errors())}, status_code=422
+                )
+
+            if not await _wait_for_runner():
+                return JSONResponse(
+                    {"detail": "Already running a prediction"}, status_code=409
+                )
+
+            return await _predict(request=request)
+
+    if api_format == "vertex":
+
+        @app.get(aip_health_route)
+        async def vertex_health() -> Any:
+            """
+            Vertex AI health check, which succeeds once the model is ready
+            """
+            return await _ready()
+
+        @limited
+        @app.post(aip_predict_route)
+        async def vertex_predict(body: Dict[str, Any] = Body(...)) -> Any:
+            """
+            Run a prediction for each of the instances in a Vertex AI request.
+            Parameters are added to the inputs of every instance.
+            """
+            if app.state.draining:
+                return JSONResponse({"error": "Shutting down"}, status_code=503)
+
+            instances = body.get("instances")
+            if not isinstance(instances, list):
+                return JSONResponse(
+                    {"error": "'instances' must be a list"}, status_code=400
+                )
+            parameters = body.get("parameters") or {}
+
+            predictions = []
+            for instance in instances:
+                if not isinstance(instance, dict):
+                    return JSONResponse(
+                        {"error": "Each instance must be an object of inputs"},
+                        status_code=400,
+                    )
+                try:
+                    request = PredictionRequest(input={**parameters, **instance})
+                except ValidationError as e:
+                    return JSONResponse(
+                        {"error": str(e)},
+                        status_code=400,
+                    )
+
+                if not await _wait_for_runner():
+                    return JSONResponse(
+                        {"error": "Already running a prediction"}, status_code=429
+                    )
+
+                response = await _predict(request=request)
+                prediction = json.loads(response.body)
+                if response.status_code != 200:
+                    return JSONResponse(
+                        {"error": prediction.get("detail")},
+                        status_code=response.status_code,
+                    )
+                if prediction.get("status") != "succeeded":
+                    return JSONResponse(
+                        {"error": prediction.get("error") or "Prediction failed"},
+                        status_code=500,
+                    )
+                predictions.append(prediction.get("output"))
+
+            return JSONResponse({"predictions": predictions})
+
+    if openai:
+        openai_model = config.get("image") or "cog"
+        if isinstance(openai_model, dict):
+            # image can be a map with the name and a tag_template
+            openai_model = openai_model.get("name") or "cog"
+        input_fields = set(InputType.__fields__.keys())
+
+        @app.get("/v1/models")
+        async def openai_models() -> Any:
+            return openai_compat.models_response(openai_model)
+
+        @limited
+        @app.post("/v1/completions")
+        async def openai_completions(body: Dict[str, Any] = Body(...)) -> Any:
+            """
+            OpenAI-compatible completion, using the model's prompt input
+            """
+            return await _openai_predict(
+                body, openai_compat.completion_input, openai_compat.completion_response
+            )
+
+        @limited
+        @app.post("/v1/chat/completions")
+        async def openai_chat_completions(body: Dict[str, Any] = Body(...)) -> Any:
+            """
+            OpenAI-compatible chat completion, using the model's messages or
+            prompt input
+            """
+            return await _openai_predict(
+                body, openai_compat.chat_input, openai_compat.chat_response
+            )
+
+        async def _openai_predict(
+            body: Dict[str, Any],
+            to_input: Callable[[Dict[str, Any], Set[str]], Dict[str, Any]],
+            to_response: Callable[[str, Any], Dict[str, Any]],
+        ) -> Response:
+            if app.state.draining:
+                return JSONResponse(
+                    openai_compat.error_response("Shutting down"), status_code=503
+                )
+
+            try:
+                request = PredictionRequest(input=to_input(body, input_fields))
+            except (openai_compat.OpenAIError, ValidationError) as e:
+                return JSONResponse(
+                    openai_compat.error_response(str(e)), status_code=400
+                )
+
+            if not await _wait_for_runner():
+                return JSONResponse(
+                    openai_compat.error_response("Already running a prediction"),
+                    status_code=429,
+                )
+
+            response = await _predict(request=request)
+            prediction = json.loads(response.body)
+            if response.status_code != 200:
+                return JSONResponse(
+                    openai_compat.error_response(str(prediction.get("detail"))),
+                    status_code=response.status_code,
+                )
+            if prediction.get("status") != "succeeded":
+                return JSONResponse(
+                    openai_compat.error_response(
+                        prediction.get("error") or "Prediction failed"
+                    ),
+                    status_code=500,
+                )
+            return JSONResponse(to_response(openai_model, prediction.get("output")))
+
     @app.post("/shutdown")
     async def start_shutdown() -> Any:
         log.info("shutdown requested via http")
@@ -304,6 +611,13 @@ def create_app(
             shutdown_event.set()
         return JSONResponse({}, status_code=200)
 
+    async def _ready() -> Response:
+        await _check_setup_task()
+        await _check_warmup_task()
+        if app.state.health == Health.READY:
+            return JSONResponse({}, status_code=200)
+        return JSONResponse({"status": app.state.health.name}, status_code=503)
+
     async def _check_setup_task() -> Any:
         if app.state.setup_task is None:
             return
@@ -314,16 +628,34 @@ def create_app(
         # this can raise CancelledError
         result = app.state.setup_task.result()
 
-        if result.status == schema.Status.SUCCEEDED:
-            app.state.health = Health.READY
-        else:
+        if result.status != schema.Status.SUCCEEDED:
             app.state.health = Health.SETUP_FAILED
+        elif not warmup_inputs:
+            app.state.health = Health.READY
+        # Otherwise, stay in STARTING until warm-up has completed
 
         app.state.setup_result = result
 
         # Reset app.state.setup_task so future calls are a no-op
         app.state.setup_task = None
 
+    async def _check_warmup_task() -> Any:
+        if app.state.warmup_task is None:
+            return
+
+        if not app.state.warmup_task.done():
+            return
+
+        exc = app.state.warmup_task.exception()
+        if exc is None:
+            app.state.health = Health.READY
+        else:
+            log.error("warm-up failed", exc_info=exc)
+            app.state.health = Health.SETUP_FAILED
+
+        # Reset app.state.warmup_task so future calls are a no-op
+        app.state.warmup_task = None
+
     return app
 
 
@@ -367,6 +699,25 @@ class Server(uvicorn.Server):
         os.kill(os.getpid(), signal.SIGKILL)
 
 
+def drain(app: MyFastAPI, grace_period: float) -> None:
+    """
+    Stop accepting predictions, and wait up to grace_period seconds for running
+    predictions to finish.
+    """
+    app.state.draining = True
+    runner = app.state.runner
+    if runner is None or not runner.is_busy():
+        return
+
+    log.info("waiting for running predictions to finish", grace_period=grace_period)
+    deadline = time.monotonic() + grace_period
+    while runner.is_busy():
+        if time.monotonic() > deadline:
+            log.warn("predictions still running after grace period, shutting down")
+            return
+        time.sleep(0.1)
+
+
 def is_port_in_use(port: int) -> bool:
     with socket.socket(socket.AF_INET, socket.SOCK_STREAM) as s:
         return s.connect_ex(("localhost", port)) == 0
@@ -433,12 +784,28 @@ if __name__ == "__main__":
     config = load_config()
 
     threads: Optional[int] = args.threads
+    # The model runs one prediction at a time, so accepting concurrency.max
+    # predictions at once means the rest of them wait in the queue
+    queue_size = int(os.environ.get("COG_QUEUE_SIZE", 0))
+    if os.environ.get("COG_MAX_CONCURRENCY"):
+        max_concurrency = int(os.environ["COG_MAX_CONCURRENCY"])
+        queue_size = max(queue_size, max_concurrency - 1)
+        if threads is None:
+            threads = max_concurrency
     if threads is None:
         if config.get("build", {}).get("gpu", False):
             threads = 1
         else:
             threads = _cpu_count()
 
+    api_format = os.environ.get("COG_API_FORMAT", "cog")
+
+    # Configured with auth in cog.yaml
+    auth_token = os.environ.get("COG_AUTH_TOKEN") or None
+    if auth_token is None and os.environ.get("COG_AUTH_REQUIRED", "").lower() == "true":
+        log.error("This model requires an auth token, but COG_AUTH_TOKEN isn't set")
+        sys.exit(1)
+
     shutdown_event = threading.Event()
     app = create_app(
         config=config,
@@ -446,13 +813,40 @@ if __name__ == "__main__":
         threads=threads,
         upload_url=args.upload_url,
         mode=args.mode,
+        queue_size=queue_size,
+        predict_timeout=int(os.environ.get("COG_PREDICT_TIMEOUT", 0)),
+        api_format=api_format,
+        aip_health_route=os.environ.get("AIP_HEALTH_ROUTE", "/health"),
+        aip_predict_route=os.environ.get("AIP_PREDICT_ROUTE", "/predict"),
+        openai=os.environ.get("COG_OPENAI", "").lower() == "true",
+        auth_token=auth_token,
+        cors_origins=[
+            origin
+            for origin in os.environ.get("COG_CORS_ORIGINS", "").split(",")
+            if origin
+        ],
+        max_request_size=int(os.environ.get("COG_MAX_REQUEST_SIZE", 0)),
     )
 
-    port = int(os.getenv("PORT", 5000))
+    if api_format == "vertex":
+        port = int(os.getenv("AIP_HTTP_PORT", 8080))
+    else:
+        port = int(os.getenv("PORT", 5000))
     if is_port_in_use(port):
         log.error(f"Port {port} is already in use")
         sys.exit(1)
 
+    # Configured with serve.tls in cog.yaml
+    ssl_certfile = os.environ.get("COG_TLS_CERT_FILE") or None
+    ssl_keyfile = os.environ.get("COG_TLS_KEY_FILE") or None
+    if ssl_certfile is None and os.environ.get("COG_TLS_AUTO", "").lower() == "true":
+        try:
+            ssl_certfile, ssl_keyfile = self_signed_certificate()
+        except (OSError, subprocess.CalledProcessError) as e:
+            log.error(f"Failed to generate a self-signed certificate: {e}")
+            sys.exit(1)
+        log.info(f"Serving HTTPS with a self-signed certificate in {ssl_certfile}")
+
     server_config = uvicorn.Config(
         app,
         host="0.0.0.0",
@@ -460,9 +854,16 @@ if __name__ == "__main__":
         log_config=None,
         # This is the default, but to be explicit: only run a single worker
         workers=1,
+        ssl_certfile=ssl_certfile,
+        ssl_keyfile=ssl_keyfile,
     )
 
-    if args.await_explicit_shutdown:
+    # Configured with shutdown in cog.yaml
+    shutdown_drain = os.environ.get("COG_SHUTDOWN_DRAIN", "").lower() == "true"
+    shutdown_grace_period = float(os.environ.get("COG_SHUTDOWN_GRACE_PERIOD", 30))
+    shutdown_sigterm = os.environ.get("COG_SHUTDOWN_SIGTERM", "shutdown")
+
+    if args.await_explicit_shutdown or shutdown_sigterm == "ignore":
         signal.signal(signal.SIGTERM, signal_ignore)
     else:
         signal.signal(signal.SIGTERM, signal_set_event(shutdown_event))
@@ -475,4 +876,7 @@ if __name__ == "__main__":
     except KeyboardInterrupt:
         pass
 
+    if shutdown_drain:
+        drain(app, shutdown_grace_period)
+
     s.stop()
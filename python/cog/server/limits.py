@@ -0,0 +1,66 @@
+from typing import Any, Awaitable, Callable, Dict
+
+from fastapi import HTTPException
+
+Scope = Dict[str, Any]
+Message = Dict[str, Any]
+Receive = Callable[[], Awaitable[Message]]
+Send = Callable[[Message], Awaitable[None]]
+ASGIApp = Callable[[Scope, Receive, Send], Awaitable[None]]
+
+
+class MaxRequestSizeMiddleware:
+    """
+    Reject requests with bodies larger than max_size bytes with a 413 status.
+
+    Requests with a Content-Length are rejected before their body is read.
+    Streamed requests, like the ones `cog predict` sends, are rejected as soon
+    as they go over the limit.
+    """
+
+    def __init__(self, app: ASGIApp, max_size: int) -> None:
+        self.app = app
+        self.max_size = max_size
+
+    async def __call__(self, scope: Scope, receive: Receive, send: Send) -> None:
+        if scope["type"] != "http":
+            await self.app(scope, receive, send)
+            return
+
+        for name, value in scope["headers"]:
+            if name == b"content-length" and value.isdigit():
+                if int(value) > self.max_size:
+                    await self._reject(send)
+                    return
+
+        received = 0
+
+        async def limited_receive() -> Message:
+            nonlocal received
+            message = await receive()
+            if message["type"] == "http.request":
+                received += len(message.get("body", b""))
+                if received > self.max_size:
+                    # FastAPI turns this into a response, even while it's
+                    # parsing the body
+                    raise HTTPException(status_code=413, detail=self._detail())
+            return message
+
+        await self.app(scope, limited_receive, send)
+
+    def _detail(self) -> str:
+        return f"The request is larger than the maximum of {self.max_size} bytes"
+
+    async def _reject(self, send: Send) -> None:
+        body = ('{"detail": "%s"}' % self._detail()).encode()
+        await send(
+            {
+                "type": "http.response.start",
+                "status": 413,
+                "headers": [
+                    (b"content-type", b"application/json"),
+                    (b"content-length", str(len(body)).encode()),
+                ],
+            }
+        )
+        await send({"type": "http.response.body", "body": body})
@@ -0,0 +1,193 @@
+"""
+Maps OpenAI-compatible completion requests onto a predictor's inputs, and its
+outputs onto OpenAI-compatible responses, so language models can be used by
+OpenAI clients.
+"""
+import json
+import time
+import uuid
+from typing import Any, Dict, List, Optional, Set, Tuple
+
+# Names the predictor might use for each OpenAI parameter, in order of preference
+PROMPT_INPUTS = ("prompt", "text", "input")
+PARAMETER_INPUTS = {
+    "max_tokens": ("max_tokens", "max_new_tokens", "max_length"),
+    "temperature": ("temperature",),
+    "top_p": ("top_p",),
+    "stop": ("stop_sequences", "stop"),
+    "seed": ("seed",),
+    "presence_penalty": ("presence_penalty",),
+    "frequency_penalty": ("frequency_penalty",),
+}
+
+
+class OpenAIError(Exception):
+    pass
+
+
+def completion_input(
+    body: Dict[str, Any], input_fields: Set[str]
+) -> Dict[str, Any]:
+    """
+    Returns the inputs for a request to /v1/completions.
+    """
+    _check_supported(body)
+    prompt = body.get("prompt")
+    if isinstance(prompt, list):
+        if len(prompt) != 1:
+            raise OpenAIError("Only a single prompt is supported")
+        prompt = prompt[0]
+    if not isinstance(prompt, str):
+        raise OpenAIError("'prompt' must be a string")
+
+    inputs = _parameter_inputs(body, input_fields)
+    inputs[_prompt_input(input_fields)] = prompt
+    return inputs
+
+
+def chat_input(body: Dict[str, Any], input_fields: Set[str]) -> Dict[str, Any]:
+    """
+    Returns the inputs for a request to /v1/chat/completions. If the predictor
+    takes a `messages` input, the messages are passed to it as JSON. Otherwise,
+    they are turned into a prompt, with system messages passed as the
+    `system_prompt` input if there is one.
+    """
+    _check_supported(body)
+    messages = body.get("messages")
+    if not isinstance(messages, list) or not messages:
+        raise OpenAIError("'messages' must be a non-empty list")
+
+    inputs = _parameter_inputs(body, input_fields)
+    if "messages" in input_fields:
+        inputs["messages"] = json.dumps(messages)
+        return inputs
+
+    system = [_content(m) for m in messages if m.get("role") == "system"]
+    conversation = [m for m in messages if m.get("role") != "system"]
+    if system and "system_prompt" in input_fields:
+        inputs["system_prompt"] = "\n".join(system)
+    else:
+        system_messages = [{"role": "system", "content": s} for s in system]
+        conversation = system_messages + conversation
+
+    if len(conversation) == 1 and conversation[0].get("role") == "user":
+        prompt = _content(conversation[0])
+    else:
+        lines = [
+            f"{m.get('role', 'user').capitalize()}: {_content(m)}" for m in conversation
+        ]
+        prompt = "\n".join(lines + ["Assistant:"])
+    inputs[_prompt_input(input_fields)] = prompt
+    return inputs
+
+
+def completion_response(model: str, output: Any) -> Dict[str, Any]:
+    return {
+        "id": f"cmpl-{uuid.uuid4().hex}",
+        "object": "text_completion",
+        "created": int(time.time()),
+        "model": model,
+        "choices": [
+            {
+                "index": 0,
+                "text": output_text(output),
+                "logprobs": None,
+                "finish_reason": "stop",
+            }
+        ],
+    }
+
+
+def chat_response(model: str, output: Any) -> Dict[str, Any]:
+    return {
+        "id": f"chatcmpl-{uuid.uuid4().hex}",
+        "object": "chat.completion",
+        "created": int(time.time()),
+        "model": model,
+        "choices": [
+            {
+                "index": 0,
+                "message": {"role": "assistant", "content": output_text(output)},
+                "finish_reason": "stop",
+            }
+        ],
+    }
+
+
+def models_response(model: str) -> Dict[str, Any]:
+    return {
+        "object": "list",
+        "data": [{"id": model, "object": "model", "created": 0, "owned_by": "cog"}],
+    }
+
+
+def error_response(message: str) -> Dict[str, Any]:
+    return {"error": {"message": message, "type": "invalid_request_error"}}
+
+
+def output_text(output: Any) -> str:
+    """
+    Returns the text of a prediction's output. Language models often yield
+    their output a token at a time, which is returned as a list.
+    """
+    if output is None:
+        return ""
+    if isinstance(output, str):
+        return output
+    if isinstance(output, list) and all(isinstance(o, str) for o in output):
+        return "".join(output)
+    return json.dumps(output)
+
+
+def _check_supported(body: Dict[str, Any]) -> None:
+    if body.get("stream"):
+        raise OpenAIError("Streaming is not supported")
+    if body.get("n", 1) != 1:
+        raise OpenAIError("Only one choice is supported")
+
+
+def _prompt_input(input_fields: Set[str]) -> str:
+    name = _first(PROMPT_INPUTS, input_fields)
+    if name is not None:
+        return name
+    raise OpenAIError(
+        "The model doesn't have an input for the prompt. "
+        f"It must have one of: {', '.join(PROMPT_INPUTS)}"
+    )
+
+
+def _parameter_inputs(
+    body: Dict[str, Any], input_fields: Set[str]
+) -> Dict[str, Any]:
+    inputs: Dict[str, Any] = {}
+    for parameter, names in PARAMETER_INPUTS.items():
+        value = body.get(parameter)
+        if value is None:
+            continue
+        name = _first(names, input_fields)
+        if name is None:
+            continue
+        if parameter == "stop" and isinstance(value, list):
+            value = ",".join(value)
+        inputs[name] = value
+    return inputs
+
+
+def _first(names: Tuple[str, ...], input_fields: Set[str]) -> Optional[str]:
+    for name in names:
+        if name in input_fields:
+            return name
+    return None
+
+
+def _content(message: Dict[str, Any]) -> str:
+    content = message.get("content")
+    if isinstance(content, list):
+        # Content parts, of which only text is supported
+        parts: List[str] = [
+            p.get("text", "")
+            for p in content
+            if isinstance(p, dict) and p.get("type") == "text"
+        ]
+        return "".join(parts)
+    return content or ""
@@ -0,0 +1,39 @@
+import contextlib
+import itertools
+import os
+import sys
+from typing import Iterator
+
+# Set by `cog predict --profile-torch`, see pkg/predict/profile.go
+PROFILE_DIR_ENV = "COG_PROFILE_DIR"
+PROFILE_TORCH_ENV = "COG_PROFILE_TORCH"
+
+_trace_numbers = itertools.count()
+
+
+@contextlib.contextmanager
+def torch_profiler() -> Iterator[None]:
+    """
+    Profile a prediction with the PyTorch profiler, if COG_PROFILE_TORCH is
+    set, and write a Chrome trace of it to COG_PROFILE_DIR. It does nothing
+    if the model doesn't use PyTorch.
+    """
+    directory = os.environ.get(PROFILE_DIR_ENV)
+    if not directory or os.environ.get(PROFILE_TORCH_ENV) != "true":
+        yield
+        return
+    # Only profile models that have imported PyTorch, rather than importing it
+    if "torch" not in sys.modules:
+        yield
+        return
+    import torch.profiler
+
+    activities = [torch.profiler.ProfilerActivity.CPU]
+    if torch.cuda.is_available():
+        activities.append(torch.profiler.ProfilerActivity.CUDA)
+    with torch.profiler.profile(
+        activities=activities, record_shapes=True, profile_memory=True
+    ) as profiler:
+        yield
+    path = os.path.join(directory, f"torch-trace-{next(_trace_numbers)}.json")
+    profiler.export_chrome_trace(path)
@@ -62,6 +62,9 @@ class PredictionRunner:
 
         self._worker = Worker(predictor_ref=predictor_ref)
         self._should_cancel = asyncio.Event()
+        # Notified when setup or a prediction finishes. It's created once
+        # there's an event loop to wait on it in.
+        self._free: Optional[asyncio.Condition] = None
 
         self._shutdown_event = shutdown_event
         self._upload_url = upload_url
@@ -88,6 +91,7 @@ class PredictionRunner:
             raise RunnerBusyError()
         self._result = asyncio.create_task(setup(worker=self._worker))
         self._result.add_done_callback(self.make_error_handler("setup"))
+        self._result.add_done_callback(self._notify_free)
         return self._result
 
     # TODO: Make the return type AsyncResult[schema.PredictionResponse] when we
@@ -131,6 +135,7 @@ class PredictionRunner:
         self._result = asyncio.create_task(coro)
         self._result.add_done_callback(handle_cleanup)
         self._result.add_done_callback(self.make_error_handler("prediction"))
+        self._result.add_done_callback(self._notify_free)
 
         return (self._response, self._result)
 
@@ -145,6 +150,29 @@ class PredictionRunner:
         self._result = None
         return False
 
+    async def wait_until_free(self) -> None:
+        """
+        Wait until setup and the prediction that's running have finished.
+        Waiters are woken in the order they started waiting. The caller must
+        start its prediction without awaiting anything in between, so another
+        waiter can't start one first.
+        """
+        if self._free is None:
+            self._free = asyncio.Condition()
+        async with self._free:
+            await self._free.wait_for(lambda: not self.is_busy())
+
+    def _notify_free(self, _: RunnerTask) -> None:
+        free = self._free
+        if free is None:
+            return
+
+        async def notify() -> None:
+            async with free:
+                free.notify_all()
+
+        asyncio.ensure_future(notify())
+
     def shutdown(self) -> None:
         if self._result:
             self._result.cancel()
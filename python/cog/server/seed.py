@@ -0,0 +1,26 @@
+import os
+import random
+import sys
+from typing import Optional
+
+# Set by `cog predict --seed`, to make predictions reproducible
+SEED_ENV = "COG_SEED"
+
+
+def seed_from_env() -> Optional[int]:
+    """
+    Seed the random number generators of Python, NumPy and PyTorch with the
+    seed in COG_SEED, if it is set. It's called before every prediction, so
+    each prediction starts from the same state.
+    """
+    value = os.environ.get(SEED_ENV)
+    if not value:
+        return None
+    seed = int(value)
+    random.seed(seed)
+    # Only seed the libraries the model has imported, rather than importing them
+    if "numpy" in sys.modules:
+        sys.modules["numpy"].random.seed(seed % 2**32)
+    if "torch" in sys.modules:
+        sys.modules["torch"].manual_seed(seed)
+    return seed
@@ -0,0 +1,54 @@
+import os
+import socket
+import subprocess
+from typing import Tuple
+
+# Where a self-signed certificate is written, so it can be copied out of the
+# container with `docker cp` and trusted by clients
+SELF_SIGNED_DIR = "/var/run/cog/tls"
+
+
+def self_signed_certificate(directory: str = SELF_SIGNED_DIR) -> Tuple[str, str]:
+    """
+    Generate a certificate for localhost and this container's hostname that
+    is its own CA, with openssl, and return the paths of it and its key. If
+    there already is one in directory, it's reused.
+    """
+    cert_file = os.path.join(directory, "cert.pem")
+    key_file = os.path.join(directory, "key.pem")
+    if os.path.exists(cert_file) and os.path.exists(key_file):
+        return cert_file, key_file
+
+    os.makedirs(directory, exist_ok=True)
+    names = ["DNS:localhost", "IP:127.0.0.1", "IP:::1"]
+    hostname = socket.gethostname()
+    if hostname and hostname != "localhost":
+        names.append(f"DNS:{hostname}")
+    subprocess.run(
+        [
+            "openssl",
+            "req",
+            "-x509",
+            "-newkey",
+            "ec",
+            "-pkeyopt",
+            "ec_paramgen_curve:prime256v1",
+            "-nodes",
+            "-days",
+            "365",
+            "-subj",
+            "/CN=cog",
+            "-addext",
+            "subjectAltName=" + ",".join(names),
+            "-addext",
+            "basicConstraints=critical,CA:TRUE",
+            "-keyout",
+            key_file,
+            "-out",
+            cert_file,
+        ],
+        check=True,
+        stdout=subprocess.DEVNULL,
+        stderr=subprocess.PIPE,
+    )
+    return cert_file, key_file
@@ -34,6 +34,8 @@ from .exceptions import (
     InvalidStateException,
 )
 from .helpers import StreamRedirector, WrappedStream
+from .profiler import torch_profiler
+from .seed import seed_from_env
 
 _spawn = multiprocessing.get_context("spawn")
 
@@ -272,7 +274,8 @@ class _ChildWorker(_spawn.Process):  # type: ignore
         self._events.send(done)
 
     async def _predict_async(self, payload: Dict[str, Any]) -> None:
-        with self._handle_predict_error():
+        with self._handle_predict_error(), torch_profiler():
+            seed_from_env()
             predict = get_predict(self._predictor)
             result = predict(**payload)
             if result:
@@ -286,7 +289,8 @@ class _ChildWorker(_spawn.Process):  # type: ignore
                     self._events.send(PredictionOutput(payload=make_encodeable(result)))
 
     def _predict_sync(self, payload: Dict[str, Any]) -> None:
-        with self._handle_predict_error():
+        with self._handle_predict_error(), torch_profiler():
+            seed_from_env()
             predict = get_predict(self._predictor)
             result = predict(**payload)
             if result:
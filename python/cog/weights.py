@@ -0,0 +1,307 @@
+"""
+Prepares the model's weights when the container starts.
+
+Weights profiles are sets of weights, e.g. fp16 and int8, that are declared in
+cog.yaml. The default profile is built into the image, and the others are
+downloaded when the container starts with COG_WEIGHTS_PROFILE set to them.
+
+Weights files are downloaded when the container starts if they aren't in the
+image, which they aren't if weights.lazy is set in cog.yaml.
+
+Downloads are resumed if they are interrupted, checked against their SHA-256
+checksums, and kept in COG_WEIGHTS_CACHE, which can be a volume that is shared
+between containers.
+
+If the image was built with `cog build --sign-weights`, the weights in it are
+checked against the signed manifest of them with the public key in
+COG_WEIGHTS_PUBLIC_KEY, and the container fails to start if the key isn't set
+or they have been tampered with.
+"""
+import base64
+import fcntl
+import hashlib
+import json
+import os
+import shutil
+import tarfile
+import tempfile
+import time
+import zlib
+from typing import Any, Dict, Optional
+from urllib.parse import urlparse
+
+import requests
+import structlog
+from cryptography.exceptions import InvalidSignature
+from cryptography.hazmat.primitives.asymmetric.ed25519 import Ed25519PublicKey
+from cryptography.hazmat.primitives.serialization import load_pem_public_key
+
+log = structlog.get_logger("cog.weights")
+
+WEIGHTS_CONFIG_PATH = "/etc/cog/weights.json"
+WEIGHTS_MANIFEST_PATH = "/etc/cog/weights-manifest.json"
+DEFAULT_CACHE_DIR = "/var/cache/cog/weights"
+DOWNLOAD_ATTEMPTS = 5
+CHUNK_SIZE = 1024 * 1024
+
+
+class WeightsError(Exception):
+    pass
+
+
+def load_config(path: str = WEIGHTS_CONFIG_PATH) -> Optional[Dict[str, Any]]:
+    if not os.path.exists(path):
+        return None
+    with open(path, encoding="utf-8") as f:
+        return json.load(f)
+
+
+def prepare_weights_files(config_path: str = WEIGHTS_CONFIG_PATH) -> None:
+    """
+    Downloads the weights files that aren't in the image.
+    """
+    config = load_config(config_path)
+    if config is None:
+        return
+    for file in config.get("files", []):
+        if os.path.exists(file["path"]):
+            continue
+        cached = fetch(file["url"], file["sha256"])
+        os.makedirs(os.path.dirname(os.path.abspath(file["path"])), exist_ok=True)
+        link(cached, file["path"])
+
+
+def prepare_weights_profile(config_path: str = WEIGHTS_CONFIG_PATH) -> Optional[str]:
+    """
+    Makes sure the weights of the profile in COG_WEIGHTS_PROFILE, or the
+    default profile, are on disk, and returns their path. It returns None if
+    the model doesn't have weights profiles.
+    """
+    config = load_config(config_path)
+    if config is None or not config.get("profiles"):
+        return None
+
+    name = os.environ.get("COG_WEIGHTS_PROFILE") or config["default"]
+    by_name = {p["name"]: p for p in config["profiles"]}
+    if name not in by_name:
+        raise WeightsError(
+            f"Unknown weights profile '{name}' in COG_WEIGHTS_PROFILE. "
+            f"It must be one of: {', '.join(by_name)}"
+        )
+    profile = by_name[name]
+    path = profile["path"]
+
+    if not os.path.exists(path):
+        if not profile.get("url"):
+            raise WeightsError(
+                f"The weights for the profile '{name}' aren't in the image, "
+                "and it doesn't have a url to download them from"
+            )
+        download(profile["url"], path, profile.get("sha256"))
+        verify(profile)
+
+    log.info("using weights profile", profile=name, path=path)
+    return path
+
+
+def verify_weights_manifest(manifest_path: str = WEIGHTS_MANIFEST_PATH) -> None:
+    """
+    Checks the weights in the image against the manifest that was signed when
+    it was built, with the public key in COG_WEIGHTS_PUBLIC_KEY. The key isn't
+    in the image, so whoever can change the weights can't replace it too. It
+    raises WeightsError if the key isn't set or anything doesn't match, so the
+    container fails to start rather than run weights that may have been
+    tampered with.
+    """
+    trusted_key = os.environ.get("COG_WEIGHTS_PUBLIC_KEY")
+    if not os.path.exists(manifest_path):
+        if trusted_key:
+            raise WeightsError(
+                "COG_WEIGHTS_PUBLIC_KEY is set, but the image doesn't have a "
+                "signed weights manifest. Build it with cog build --sign-weights"
+            )
+        return
+    if not trusted_key:
+        raise WeightsError(
+            "The image has a signed weights manifest, but COG_WEIGHTS_PUBLIC_KEY "
+            "isn't set, so the weights can't be checked. Set it to the public key "
+            "of the key the image was signed with"
+        )
+
+    try:
+        with open(manifest_path, "rb") as f:
+            contents = f.read()
+        with open(manifest_path + ".sig", encoding="utf-8") as f:
+            signature = base64.b64decode(f.read().strip())
+        public_key = parse_public_key(trusted_key)
+    except (OSError, ValueError) as e:
+        raise WeightsError(f"Failed to read the signed weights manifest: {e}") from e
+
+    try:
+        public_key.verify(signature, contents)
+    except InvalidSignature:
+        raise WeightsError(
+            "The signature of the weights manifest doesn't match the public key, "
+            "so the weights may have been tampered with"
+        ) from None
+    files = json.loads(contents)["files"]
+    for name, metadata in sorted(files.items()):
+        if not os.path.exists(name):
+            raise WeightsError(
+                f"The weights file {name} in the signed weights manifest is missing"
+            )
+        if sha256sum(name) != metadata["sha256"]:
+            raise WeightsError(
+                f"The weights file {name} has changed since the weights manifest "
+                "was signed, so it may have been tampered with"
+            )
+    log.info("verified weights against the signed manifest", files=len(files))
+
+
+def parse_public_key(key: str) -> Ed25519PublicKey:
+    """
+    Parses an Ed25519 public key, which is either a PEM file, as written by
+    `openssl pkey -pubout`, or the 32 bytes of the key encoded in base64.
+    """
+    key = key.strip()
+    if key.startswith("-----BEGIN PUBLIC KEY-----"):
+        public_key = load_pem_public_key(key.encode())
+        if not isinstance(public_key, Ed25519PublicKey):
+            raise ValueError("the public key isn't an Ed25519 key")
+        return public_key
+    raw = base64.b64decode(key)
+    if len(raw) != 32:
+        raise ValueError("the public key must be a PEM file or 32 bytes in base64")
+    return Ed25519PublicKey.from_public_bytes(raw)
+
+
+def cache_dir() -> str:
+    return os.environ.get("COG_WEIGHTS_CACHE", DEFAULT_CACHE_DIR)
+
+
+def fetch(url: str, sha256: Optional[str] = None) -> str:
+    """
+    Downloads url into the cache, unless it is already there, and returns its
+    path in the cache. If the download is interrupted, it is resumed from
+    where it stopped. Containers that share the cache wait for each other
+    rather than downloading the same file twice.
+    """
+    directory = cache_dir()
+    os.makedirs(directory, exist_ok=True)
+    key = sha256 or hashlib.sha256(url.encode()).hexdigest()
+    cached = os.path.join(directory, key)
+    if os.path.exists(cached):
+        return cached
+
+    with open(cached + ".lock", "w", encoding="utf-8") as lock:
+        fcntl.flock(lock, fcntl.LOCK_EX)
+        if os.path.exists(cached):
+            return cached
+
+        partial = cached + ".partial"
+        for attempt in range(1, DOWNLOAD_ATTEMPTS + 1):
+            try:
+                download_to(url, partial)
+                break
+            except (requests.ConnectionError, requests.Timeout) as e:
+                if attempt == DOWNLOAD_ATTEMPTS:
+                    raise WeightsError(f"Failed to download {url}: {e}") from e
+                log.info("download interrupted, resuming", url=url, error=str(e))
+                time.sleep(attempt)
+
+        if sha256 is not None:
+            actual = sha256sum(partial)
+            if actual != sha256:
+                os.remove(partial)
+                raise WeightsError(
+                    f"The SHA-256 checksum of {url} is {actual}, "
+                    f"but it should be {sha256}"
+                )
+        os.rename(partial, cached)
+    return cached
+
+
+def download_to(url: str, partial: str) -> None:
+    offset = os.path.getsize(partial) if os.path.exists(partial) else 0
+    headers = {"Range": f"bytes={offset}-"} if offset else {}
+    with requests.get(url, headers=headers, stream=True, timeout=60) as resp:
+        if resp.status_code == 416:
+            # The partial download is already complete
+            return
+        resp.raise_for_status()
+        if offset and resp.status_code != 206:
+            # The server doesn't support resuming, so start again
+            offset = 0
+        total = offset + int(resp.headers.get("Content-Length", 0))
+        done = offset
+        reported = 0
+        log.info("downloading weights", url=url, size=total, offset=offset)
+        with open(partial, "ab" if offset else "wb") as f:
+            for chunk in resp.iter_content(chunk_size=CHUNK_SIZE):
+                f.write(chunk)
+                done += len(chunk)
+                if total and done * 10 // total > reported:
+                    reported = done * 10 // total
+                    log.info("downloading weights", url=url, percent=reported * 10)
+
+
+def link(cached: str, path: str) -> None:
+    try:
+        os.link(cached, path)
+    except OSError:
+        # The cache is on another filesystem, e.g. a volume
+        os.symlink(cached, path)
+
+
+def download(url: str, path: str, sha256: Optional[str] = None) -> None:
+    """
+    Downloads the weights at url to path. Tarballs are extracted into path,
+    and other files are saved in path with their name from the URL.
+    """
+    cached = fetch(url, sha256)
+    parent = os.path.dirname(os.path.abspath(path))
+    os.makedirs(parent, exist_ok=True)
+    with tempfile.TemporaryDirectory(dir=parent) as tmp:
+        filename = os.path.basename(urlparse(url).path) or "weights"
+        extracted = os.path.join(tmp, "extracted")
+        if filename.endswith((".tar", ".tar.gz", ".tgz")):
+            with tarfile.open(cached) as tar:
+                tar.extractall(extracted)  # noqa: S202
+        else:
+            os.makedirs(extracted)
+            shutil.copy(cached, os.path.join(extracted, filename))
+        os.rename(extracted, path)
+
+
+def verify(profile: Dict[str, Any]) -> None:
+    """
+    Checks the downloaded weights against the checksums of the weights that
+    were in the project when the image was built.
+    """
+    for name, metadata in profile.get("files", {}).items():
+        if not os.path.exists(name):
+            raise WeightsError(
+                f"The weights for the profile '{profile['name']}' are missing {name}"
+            )
+        if crc32(name) != metadata["crc32"]:
+            raise WeightsError(
+                f"The weights for the profile '{profile['name']}' are different "
+                f"to the ones the image was built with: {name} has changed"
+            )
+
+
+def sha256sum(path: str) -> str:
+    h = hashlib.sha256()
+    with open(path, "rb") as f:
+        for chunk in iter(lambda: f.read(CHUNK_SIZE), b""):
+            h.update(chunk)
+    return h.hexdigest()
+
+
+def crc32(path: str) -> str:
+    checksum = 0
+    with open(path, "rb") as f:
+        for chunk in iter(lambda: f.read(CHUNK_SIZE), b""):
+            checksum = zlib.crc32(chunk, checksum)
+    # Encoded the same way as the weights manifest that cog build writes
+    return checksum.to_bytes(4, "little").hex()
@@ -2,7 +2,7 @@ import os
 import threading
 import time
 from contextlib import ExitStack
-from typing import Any, Dict, Optional
+from typing import Any, Dict, List, Optional
 from unittest import mock
 
 import pytest
@@ -39,15 +39,33 @@ def uses_predictor_with_client_options(name, **options):
     )
 
 
-def make_client(fixture_name: str, upload_url: Optional[str] = None):
+def make_client(
+    fixture_name: str,
+    upload_url: Optional[str] = None,
+    config: Optional[Dict[str, Any]] = None,
+    predict_timeout: int = 0,
+    api_format: str = "cog",
+    openai: bool = False,
+    auth_token: Optional[str] = None,
+    cors_origins: Optional[List[str]] = None,
+    max_request_size: int = 0,
+    queue_size: int = 0,
+):
     """
     Creates a fastapi test client for an app that uses the requested Predictor.
     """
-    config = {"predict": _fixture_path(fixture_name)}
+    config = {"predict": _fixture_path(fixture_name), **(config or {})}
     app = create_app(
         config=config,
         shutdown_event=threading.Event(),
         upload_url=upload_url,
+        predict_timeout=predict_timeout,
+        api_format=api_format,
+        openai=openai,
+        auth_token=auth_token,
+        cors_origins=cors_origins,
+        max_request_size=max_request_size,
+        queue_size=queue_size,
     )
     return TestClient(app)
 
@@ -2,6 +2,7 @@ import base64
 import io
 import time
 import unittest.mock as mock
+from concurrent.futures import ThreadPoolExecutor
 
 import responses
 from PIL import Image
@@ -18,6 +19,26 @@ def test_setup_healthcheck():
     assert data["setup"] == {}
 
 
+@uses_predictor_with_client_options(
+    "input_string", config={"warmup": [{"text": "warm"}]}
+)
+def test_warmup_runs_before_ready(client, match):
+    resp = client.get("/health-check")
+    assert resp.json()["status"] == "READY"
+
+    resp = client.post("/predictions", json={"input": {"text": "baz"}})
+    assert resp.status_code == 200
+    assert resp.json() == match({"status": "succeeded", "output": "baz"})
+
+
+@uses_predictor_with_client_options(
+    "input_string", config={"warmup": [{"wrong": "input"}]}
+)
+def test_warmup_failure_fails_setup(client):
+    resp = client.get("/health-check")
+    assert resp.json()["status"] == "SETUP_FAILED"
+
+
 @uses_predictor("setup")
 def test_setup_is_called(client, match):
     resp = client.post("/predictions")
@@ -468,6 +489,32 @@ def test_prediction_idempotent_endpoint_conflict(client, match):
     assert resp2.status_code == 409
 
 
+@uses_predictor_with_client_options("sleep", queue_size=3)
+def test_prediction_queue(client):
+    # The model runs one prediction at a time, and the rest wait in the queue
+    with ThreadPoolExecutor(max_workers=4) as executor:
+        results = list(
+            executor.map(
+                lambda _: client.post("/predictions", json={"input": {"sleep": 0.2}}),
+                range(4),
+            )
+        )
+    assert [r.status_code for r in results] == [200, 200, 200, 200]
+    assert all(r.json()["status"] == "succeeded" for r in results)
+
+
+@uses_predictor_with_client_options("sleep", queue_size=1)
+def test_prediction_queue_full(client):
+    with ThreadPoolExecutor(max_workers=3) as executor:
+        results = list(
+            executor.map(
+                lambda _: client.post("/predictions", json={"input": {"sleep": 0.5}}),
+                range(3),
+            )
+        )
+    assert sorted(r.status_code for r in results) == [200, 200, 409]
+
+
 # a basic end-to-end test for async predictions. if you're adding more
 # exhaustive tests of webhooks, consider adding them to test_runner.py
 @responses.activate
@@ -532,6 +579,164 @@ def test_prediction_cancel(client):
     assert resp.status_code == 200
 
 
+@uses_predictor("sleep")
+def test_predictions_are_rejected_while_draining(client):
+    client.app.state.draining = True
+    resp = client.post("/predictions", json={"input": {"sleep": 0}})
+    assert resp.status_code == 503
+    resp = client.put("/predictions/123", json={"input": {"sleep": 0}})
+    assert resp.status_code == 503
+
+
+@uses_predictor_with_client_options("input_string", api_format="sagemaker")
+def test_sagemaker_routes(client, match):
+    resp = client.get("/ping")
+    assert resp.status_code == 200
+
+    resp = client.post("/invocations", json={"text": "baz"})
+    assert resp.status_code == 200
+    assert resp.json() == match({"status": "succeeded", "output": "baz"})
+
+    resp = client.post("/invocations", json={"input": {"text": "baz"}})
+    assert resp.status_code == 200
+    assert resp.json() == match({"status": "succeeded", "output": "baz"})
+
+    resp = client.post("/invocations", json={"input": {}})
+    assert resp.status_code == 422
+
+
+@uses_predictor_with_client_options("input_string", api_format="vertex")
+def test_vertex_routes(client):
+    resp = client.get("/health")
+    assert resp.status_code == 200
+
+    resp = client.post("/predict", json={"instances": [{"text": "a"}, {"text": "b"}]})
+    assert resp.status_code == 200
+    assert resp.json() == {"predictions": ["a", "b"]}
+
+    resp = client.post(
+        "/predict", json={"instances": [{}], "parameters": {"text": "baz"}}
+    )
+    assert resp.status_code == 200
+    assert resp.json() == {"predictions": ["baz"]}
+
+    resp = client.post("/predict", json={"instances": {"text": "a"}})
+    assert resp.status_code == 400
+
+
+@uses_predictor_with_client_options("input_string", openai=True)
+def test_openai_routes(client):
+    resp = client.post("/v1/completions", json={"model": "cog", "prompt": "baz"})
+    assert resp.status_code == 200
+    assert resp.json()["object"] == "text_completion"
+    assert resp.json()["choices"][0]["text"] == "baz"
+
+    resp = client.post(
+        "/v1/chat/completions",
+        json={"model": "cog", "messages": [{"role": "user", "content": "baz"}]},
+    )
+    assert resp.status_code == 200
+    assert resp.json()["object"] == "chat.completion"
+    assert resp.json()["choices"][0]["message"] == {
+        "role": "assistant",
+        "content": "baz",
+    }
+
+    resp = client.post(
+        "/v1/chat/completions",
+        json={"messages": [{"role": "user", "content": "baz"}], "stream": True},
+    )
+    assert resp.status_code == 400
+    assert resp.json()["error"]["message"] == "Streaming is not supported"
+
+
+@uses_predictor_with_client_options("input_string", auth_token="secret")
+def test_auth_token(client, match):
+    resp = client.post("/predictions", json={"input": {"text": "baz"}})
+    assert resp.status_code == 401
+    assert resp.headers["WWW-Authenticate"] == "Bearer"
+
+    resp = client.post(
+        "/predictions",
+        json={"input": {"text": "baz"}},
+        headers={"Authorization": "Bearer wrong"},
+    )
+    assert resp.status_code == 401
+
+    resp = client.post(
+        "/predictions",
+        json={"input": {"text": "baz"}},
+        headers={"Authorization": "Bearer secret"},
+    )
+    assert resp.status_code == 200
+    assert resp.json() == match({"status": "succeeded", "output": "baz"})
+
+    # Health checks don't need the token
+    assert client.get("/health-check").status_code == 200
+
+
+@uses_predictor_with_client_options(
+    "input_string", auth_token="secret", cors_origins=["https://example.com"]
+)
+def test_cors(client):
+    # Preflight requests don't have the auth token
+    resp = client.options(
+        "/predictions",
+        headers={
+            "Origin": "https://example.com",
+            "Access-Control-Request-Method": "POST",
+            "Access-Control-Request-Headers": "authorization,content-type",
+        },
+    )
+    assert resp.status_code == 200
+    assert resp.headers["Access-Control-Allow-Origin"] == "https://example.com"
+
+    resp = client.post(
+        "/predictions",
+        json={"input": {"text": "baz"}},
+        headers={"Origin": "https://example.com", "Authorization": "Bearer secret"},
+    )
+    assert resp.status_code == 200
+    assert resp.headers["Access-Control-Allow-Origin"] == "https://example.com"
+
+    resp = client.get("/health-check", headers={"Origin": "https://other.example"})
+    assert "Access-Control-Allow-Origin" not in resp.headers
+
+
+@uses_predictor_with_client_options("input_string", max_request_size=100)
+def test_max_request_size(client, match):
+    resp = client.post("/predictions", json={"input": {"text": "baz"}})
+    assert resp.status_code == 200
+    assert resp.json() == match({"status": "succeeded", "output": "baz"})
+
+    resp = client.post("/predictions", json={"input": {"text": "a" * 100}})
+    assert resp.status_code == 413
+
+    # Streamed requests don't have a Content-Length
+    def body():
+        yield b'{"input": {"text": "'
+        yield b"a" * 100
+        yield b'"}}'
+
+    resp = client.post(
+        "/predictions", data=body(), headers={"Content-Type": "application/json"}
+    )
+    assert resp.status_code == 413
+
+
+@uses_predictor("input_string")
+def test_sagemaker_routes_are_only_added_for_sagemaker(client):
+    assert client.get("/ping").status_code == 404
+    assert client.post("/invocations", json={"text": "baz"}).status_code == 404
+
+
+@uses_predictor_with_client_options("sleep", predict_timeout=1)
+def test_prediction_timeout(client, match):
+    resp = client.post("/predictions", json={"input": {"sleep": 30}})
+    assert resp.status_code == 200
+    assert resp.json() == match({"status": "canceled"})
+
+
 @uses_predictor_with_client_options(
     "setup_weights",
     env={"COG_WEIGHTS": "data:text/plain; charset=utf-8;base64,aGVsbG8="},
@@ -0,0 +1,71 @@
+import pytest
+from cog.server.openai_compat import (
+    OpenAIError,
+    chat_input,
+    completion_input,
+    output_text,
+)
+
+
+def test_completion_input_maps_parameters():
+    fields = {"prompt", "max_new_tokens", "temperature", "stop_sequences"}
+    body = {
+        "prompt": "Once upon a time",
+        "max_tokens": 10,
+        "temperature": 0.5,
+        "top_p": 0.9,
+        "stop": ["\n", "."],
+    }
+    assert completion_input(body, fields) == {
+        "prompt": "Once upon a time",
+        "max_new_tokens": 10,
+        "temperature": 0.5,
+        "stop_sequences": "\n,.",
+    }
+
+
+def test_completion_input_requires_prompt_input():
+    with pytest.raises(OpenAIError):
+        completion_input({"prompt": "hello"}, {"image"})
+
+
+def test_chat_input_uses_system_prompt():
+    body = {
+        "messages": [
+            {"role": "system", "content": "Be brief."},
+            {"role": "user", "content": "Hello"},
+        ]
+    }
+    assert chat_input(body, {"prompt", "system_prompt"}) == {
+        "prompt": "Hello",
+        "system_prompt": "Be brief.",
+    }
+
+
+def test_chat_input_renders_conversation():
+    body = {
+        "messages": [
+            {"role": "system", "content": "Be brief."},
+            {"role": "user", "content": "Hello"},
+            {"role": "assistant", "content": "Hi"},
+            {"role": "user", "content": [{"type": "text", "text": "How are you?"}]},
+        ]
+    }
+    assert chat_input(body, {"prompt"}) == {
+        "prompt": "System: Be brief.\nUser: Hello\nAssistant: Hi\n"
+        "User: How are you?\nAssistant:"
+    }
+
+
+def test_chat_input_passes_messages():
+    body = {"messages": [{"role": "user", "content": "Hello"}]}
+    assert chat_input(body, {"messages"}) == {
+        "messages": '[{"role": "user", "content": "Hello"}]'
+    }
+
+
+def test_output_text():
+    assert output_text("hello") == "hello"
+    assert output_text(["hel", "lo"]) == "hello"
+    assert output_text(None) == ""
+    assert output_text({"a": 1}) == '{"a": 1}'
@@ -0,0 +1,14 @@
+import sys
+
+from cog.server.profiler import torch_profiler
+
+
+def test_torch_profiler_without_torch(monkeypatch, tmp_path):
+    monkeypatch.setenv("COG_PROFILE_DIR", str(tmp_path))
+    monkeypatch.setenv("COG_PROFILE_TORCH", "true")
+    monkeypatch.delitem(sys.modules, "torch", raising=False)
+
+    with torch_profiler():
+        pass
+
+    assert list(tmp_path.iterdir()) == []
@@ -0,0 +1,14 @@
+import random
+
+from cog.server.seed import seed_from_env
+
+
+def test_seed_from_env(monkeypatch):
+    monkeypatch.delenv("COG_SEED", raising=False)
+    assert seed_from_env() is None
+
+    monkeypatch.setenv("COG_SEED", "42")
+    assert seed_from_env() == 42
+    first = random.random()
+    seed_from_env()
+    assert random.random() == first
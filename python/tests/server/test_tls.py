@@ -0,0 +1,21 @@
+import shutil
+import ssl
+
+import pytest
+
+from cog.server.tls import self_signed_certificate
+
+
+@pytest.mark.skipif(shutil.which("openssl") is None, reason="requires openssl")
+def test_self_signed_certificate(tmp_path):
+    cert_file, key_file = self_signed_certificate(str(tmp_path))
+
+    context = ssl.SSLContext(ssl.PROTOCOL_TLS_SERVER)
+    context.load_cert_chain(cert_file, key_file)
+
+    # It's reused when the server restarts
+    with open(cert_file) as f:
+        cert = f.read()
+    assert self_signed_certificate(str(tmp_path)) == (cert_file, key_file)
+    with open(cert_file) as f:
+        assert f.read() == cert
@@ -0,0 +1,185 @@
+import hashlib
+import json
+import os
+
+import pytest
+from cog.weights import (
+    WeightsError,
+    crc32,
+    fetch,
+    prepare_weights_files,
+    prepare_weights_profile,
+    verify,
+    verify_weights_manifest,
+)
+
+
+def write_profiles(tmp_path, profiles):
+    path = tmp_path / "weights.json"
+    path.write_text(json.dumps(profiles))
+    return str(path)
+
+
+def test_no_profiles(tmp_path):
+    assert prepare_weights_profile(str(tmp_path / "missing.json")) is None
+
+
+def test_default_profile(tmp_path, monkeypatch):
+    monkeypatch.chdir(tmp_path)
+    monkeypatch.delenv("COG_WEIGHTS_PROFILE", raising=False)
+    os.makedirs("weights/fp16")
+    profiles_path = write_profiles(
+        tmp_path,
+        {
+            "default": "fp16",
+            "profiles": [
+                {"name": "fp16", "path": "weights/fp16"},
+                {
+                    "name": "int8",
+                    "path": "weights/int8",
+                    "url": "https://example.com/int8.tar",
+                },
+            ],
+        },
+    )
+    assert prepare_weights_profile(profiles_path) == "weights/fp16"
+
+
+def test_unknown_profile(tmp_path, monkeypatch):
+    monkeypatch.setenv("COG_WEIGHTS_PROFILE", "int4")
+    profiles_path = write_profiles(
+        tmp_path,
+        {"default": "fp16", "profiles": [{"name": "fp16", "path": "weights/fp16"}]},
+    )
+    with pytest.raises(WeightsError, match="Unknown weights profile 'int4'"):
+        prepare_weights_profile(profiles_path)
+
+
+def test_verify(tmp_path, monkeypatch):
+    monkeypatch.chdir(tmp_path)
+    os.makedirs("weights/int8")
+    with open("weights/int8/model.safetensors", "wb") as f:
+        f.write(b"weights")
+    # The same checksum as cog build writes for this file
+    assert crc32("weights/int8/model.safetensors") == "5873d21a"
+
+    profile = {
+        "name": "int8",
+        "files": {"weights/int8/model.safetensors": {"crc32": "5873d21a"}},
+    }
+    verify(profile)
+
+    profile["files"]["weights/int8/model.safetensors"]["crc32"] = "00000000"
+    with pytest.raises(WeightsError, match="has changed"):
+        verify(profile)
+
+
+def test_prepare_weights_files(tmp_path, monkeypatch, httpserver):
+    monkeypatch.chdir(tmp_path)
+    monkeypatch.setenv("COG_WEIGHTS_CACHE", str(tmp_path / "cache"))
+    httpserver.expect_request("/model.safetensors").respond_with_data(b"weights")
+    url = httpserver.url_for("/model.safetensors")
+    sha256 = "3bc40ea4d0c6a6bc69d6d66c4b63a0d9d9c2b7a8fa3a2b1c8e3ad6b4fba7d5d4"
+    config_path = tmp_path / "weights.json"
+
+    config_path.write_text(
+        json.dumps(
+            {"files": [{"url": url, "path": "weights/model.bin", "sha256": sha256}]}
+        )
+    )
+    with pytest.raises(WeightsError, match="SHA-256 checksum"):
+        prepare_weights_files(str(config_path))
+
+    sha256 = hashlib.sha256(b"weights").hexdigest()
+    config_path.write_text(
+        json.dumps(
+            {"files": [{"url": url, "path": "weights/model.bin", "sha256": sha256}]}
+        )
+    )
+    prepare_weights_files(str(config_path))
+    with open("weights/model.bin", "rb") as f:
+        assert f.read() == b"weights"
+    # It is cached by its checksum, so other containers can use it
+    cached = fetch("https://example.com/unused", sha256)
+    assert cached == str(tmp_path / "cache" / sha256)
+
+
+# A manifest of weights/model.bin with the contents b"weights", signed by
+# cog build --sign-weights with the Ed25519 key whose seed is 32 zero bytes
+SIGNED_MANIFEST = (
+    b'{\n  "files": {\n    "weights/model.bin": {\n      "crc32": "5873d21a",\n'
+    b'      "sha256": "9a129038d9a00aed0cf6a7ea059ca50a813449061ab87848cf1a13eafdf33b2c"\n'
+    b"    }\n  }\n}"
+)
+MANIFEST_SIGNATURE = "IE0FVYV8ueCJ2jWaaN4JPPEynvRvaNaBsJe9Lu+NkFMoOvOrCzu4IlmxBNZLdgTNQR9iKy/RqAUMBPRkSafsAQ=="
+MANIFEST_PUBLIC_KEY = """-----BEGIN PUBLIC KEY-----
+MCowBQYDK2VwAyEAO2onvM62pC1io6jQKm8Nc2UyFXcd4kOmOsBIoYtZ2ik=
+-----END PUBLIC KEY-----
+"""
+
+
+def write_signed_manifest(tmp_path, manifest=SIGNED_MANIFEST):
+    manifest_path = tmp_path / "weights-manifest.json"
+    manifest_path.write_bytes(manifest)
+    (tmp_path / "weights-manifest.json.sig").write_text(MANIFEST_SIGNATURE + "\n")
+    return str(manifest_path)
+
+
+def test_verify_weights_manifest(tmp_path, monkeypatch):
+    monkeypatch.chdir(tmp_path)
+    monkeypatch.setenv("COG_WEIGHTS_PUBLIC_KEY", MANIFEST_PUBLIC_KEY)
+    os.makedirs("weights")
+    with open("weights/model.bin", "wb") as f:
+        f.write(b"weights")
+    manifest_path = write_signed_manifest(tmp_path)
+
+    verify_weights_manifest(manifest_path)
+
+    # Tampered weights
+    with open("weights/model.bin", "wb") as f:
+        f.write(b"backdoor")
+    with pytest.raises(WeightsError, match="has changed since"):
+        verify_weights_manifest(manifest_path)
+
+    # A tampered manifest, e.g. with the checksum of the tampered weights
+    tampered = SIGNED_MANIFEST.replace(
+        b"9a129038", hashlib.sha256(b"backdoor").hexdigest()[:8].encode()
+    )
+    manifest_path = write_signed_manifest(tmp_path, tampered)
+    with pytest.raises(WeightsError, match="signature"):
+        verify_weights_manifest(manifest_path)
+
+
+def test_verify_weights_manifest_without_key(tmp_path, monkeypatch):
+    monkeypatch.chdir(tmp_path)
+    monkeypatch.delenv("COG_WEIGHTS_PUBLIC_KEY", raising=False)
+    os.makedirs("weights")
+    with open("weights/model.bin", "wb") as f:
+        f.write(b"weights")
+    manifest_path = write_signed_manifest(tmp_path)
+
+    # The key isn't in the image, so it can't start without one it trusts
+    with pytest.raises(WeightsError, match="COG_WEIGHTS_PUBLIC_KEY isn't set"):
+        verify_weights_manifest(manifest_path)
+
+    # Images without a signed manifest don't need a key
+    verify_weights_manifest(str(tmp_path / "missing.json"))
+
+
+def test_verify_weights_manifest_with_another_key(tmp_path, monkeypatch):
+    monkeypatch.chdir(tmp_path)
+    os.makedirs("weights")
+    with open("weights/model.bin", "wb") as f:
+        f.write(b"weights")
+    manifest_path = write_signed_manifest(tmp_path)
+
+    # The public key from RFC 8032's first test vector
+    monkeypatch.setenv(
+        "COG_WEIGHTS_PUBLIC_KEY", "11qYAYKxCrfVS/7TyWQHOg7hcvPapiMlrwIaaPcHURo="
+    )
+    with pytest.raises(WeightsError, match="signature"):
+        verify_weights_manifest(manifest_path)
+
+    # The trusted key is set, so an image without a signed manifest fails
+    with pytest.raises(WeightsError, match="doesn't have a signed weights manifest"):
+        verify_weights_manifest(str(tmp_path / "missing.json"))
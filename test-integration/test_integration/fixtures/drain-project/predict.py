@@ -0,0 +1,9 @@
+import time
+
+from cog import BasePredictor
+
+
+class Predictor(BasePredictor):
+    def predict(self, sleep: float) -> str:
+        time.sleep(sleep)
+        return "done"
@@ -1,6 +1,7 @@
 import pathlib
 import shutil
 import subprocess
+import time
 from pathlib import Path
 
 import pytest
@@ -193,3 +194,24 @@ def test_predict_many_inputs(tmpdir_factory):
         capture_output=True,
     )
     assert result.stdout.decode() == "hello default 20 world jpg foo 6\n"
+
+
+def test_predict_drains_running_predictions_on_shutdown():
+    project_dir = Path(__file__).parent / "fixtures/drain-project"
+    subprocess.run(["cog", "start"], cwd=project_dir, check=True)
+    try:
+        # cog predict uses the model started by cog start
+        predict = subprocess.Popen(
+            ["cog", "predict", "-i", "sleep=5"],
+            cwd=project_dir,
+            stdout=subprocess.PIPE,
+        )
+        # Give the prediction time to start before stopping the model
+        time.sleep(2)
+        subprocess.run(["cog", "stop"], cwd=project_dir, check=True)
+
+        stdout, _ = predict.communicate(timeout=60)
+        assert predict.returncode == 0
+        assert stdout == b"done\n"
+    finally:
+        subprocess.run(["cog", "stop"], cwd=project_dir)
@@ -73,13 +73,19 @@ func fetchCUDABaseImageTags(url string) ([]string, error) {
 func parseCUDABaseImage(tag string) (*config.CUDABaseImage, error) {
 	parts := strings.Split(tag, "-")
 	if len(parts) != 4 {
-		return nil, fmt.Errorf("Tag must be in the format <cudaVersion>-cudnn<cudnnVersion>-{devel,runtime}-ubuntu<ubuntuVersion>. Invalid tag: %s", tag)
+		return nil, fmt.Errorf("Tag must be in the format <cudaVersion>-cudnn[<cudnnVersion>]-{devel,runtime}-ubuntu<ubuntuVersion>. Invalid tag: %s", tag)
+	}
+
+	// Since CUDA 12.4, tags don't have the cuDNN version in them, and have cuDNN 9
+	cuDNN := strings.TrimPrefix(parts[1], "cudnn")
+	if cuDNN == "" {
+		cuDNN = "9"
 	}
 
 	return &config.CUDABaseImage{
 		Tag:     tag,
 		CUDA:    parts[0],
-		CuDNN:   strings.Split(parts[1], "cudnn")[1],
+		CuDNN:   cuDNN,
 		IsDevel: parts[2] == "devel",
 		Ubuntu:  strings.Split(parts[3], "ubuntu")[1],
 	}, nil